@@ -0,0 +1,274 @@
+// Package admin serves an HTTP API managing the websocket connections of a node at runtime: listing
+// the connections and their subscriptions, closing connections, changing the log level and
+// toggling the maintenance mode.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// CloseKilled is the websocket close code of the connections closed through the API when the
+// request doesn't set one.
+const CloseKilled = 4403
+
+const defaultKillReason = "killed"
+
+// Handler serves the admin API. Mount it on a separate listener, or under a prefix with
+// http.StripPrefix:
+//
+//	GET    /connections             lists the connections, oldest first
+//	GET    /connections/{id}        returns a connection
+//	DELETE /connections/{id}        closes a connection, with the optional code and reason query parameters
+//	GET    /subscriptions           lists the operations of every connection, with their state
+//	GET    /log-level               returns the log level
+//	PUT    /log-level               sets the log level from {"level": "debug"}
+//	GET    /maintenance             returns {"enabled": true, "reason": "..."}
+//	PUT    /maintenance             rejects the new connections with the reason of {"reason": "..."}
+//	DELETE /maintenance             accepts the new connections again
+//
+// The endpoints of the fields left nil answer 404.
+type Handler struct {
+	Registry    *transport.Registry
+	Maintenance *transport.Maintenance
+	// LogLevel is the level of the slog handlers of the application.
+	LogLevel *slog.LevelVar
+	// Auth protects the endpoints, e.g. with BearerAuth. Every request is rejected with 401 when
+	// it is nil.
+	Auth func(next http.Handler) http.Handler
+
+	once sync.Once
+	mux  http.Handler
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(h.init)
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) init() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /connections", h.listConnections)
+	mux.HandleFunc("GET /connections/{id}", h.getConnection)
+	mux.HandleFunc("DELETE /connections/{id}", h.killConnection)
+	mux.HandleFunc("GET /subscriptions", h.listSubscriptions)
+	mux.HandleFunc("GET /log-level", h.getLogLevel)
+	mux.HandleFunc("PUT /log-level", h.setLogLevel)
+	mux.HandleFunc("GET /maintenance", h.getMaintenance)
+	mux.HandleFunc("PUT /maintenance", h.enableMaintenance)
+	mux.HandleFunc("DELETE /maintenance", h.disableMaintenance)
+
+	if h.Auth == nil {
+		h.mux = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sendError(w, http.StatusUnauthorized, "no authentication configured")
+		})
+		return
+	}
+	h.mux = h.Auth(mux)
+}
+
+// BearerAuth returns an Auth middleware accepting the requests with the given bearer token.
+func BearerAuth(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				sendError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Connection is a connection returned by the API.
+type Connection struct {
+	ID            string    `json:"id"`
+	RemoteAddr    string    `json:"remoteAddr"`
+	Subprotocol   string    `json:"subprotocol"`
+	Tenant        string    `json:"tenant,omitempty"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	Subscriptions []string  `json:"subscriptions"`
+}
+
+// Subscription is an operation returned by the API.
+type Subscription struct {
+	ConnectionID  string `json:"connectionId"`
+	ID            string `json:"id"`
+	OperationName string `json:"operationName,omitempty"`
+	QueryHash     string `json:"queryHash"`
+	// State is the current state of the operation, e.g. "active".
+	State transport.OperationState `json:"state"`
+	// Transitions are the states of the operation with the time it entered them, oldest first.
+	Transitions []transport.OperationTransition `json:"transitions"`
+}
+
+func newConnection(conn *transport.Connection) Connection {
+	info := conn.Info()
+	return Connection{
+		ID:            info.ID,
+		RemoteAddr:    info.RemoteAddr,
+		Subprotocol:   info.Subprotocol,
+		Tenant:        transport.GetTenant(conn.Context()),
+		ConnectedAt:   conn.ConnectedAt(),
+		Subscriptions: conn.Subscriptions(),
+	}
+}
+
+func (h *Handler) listConnections(w http.ResponseWriter, r *http.Request) {
+	if h.Registry == nil {
+		http.NotFound(w, r)
+		return
+	}
+	conns := h.Registry.Connections()
+	res := make([]Connection, len(conns))
+	for i, conn := range conns {
+		res[i] = newConnection(conn)
+	}
+	sendJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) connection(w http.ResponseWriter, r *http.Request) *transport.Connection {
+	if h.Registry == nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	conn := h.Registry.Get(r.PathValue("id"))
+	if conn == nil {
+		sendError(w, http.StatusNotFound, "connection not found")
+	}
+	return conn
+}
+
+func (h *Handler) getConnection(w http.ResponseWriter, r *http.Request) {
+	if conn := h.connection(w, r); conn != nil {
+		sendJSON(w, http.StatusOK, newConnection(conn))
+	}
+}
+
+func (h *Handler) killConnection(w http.ResponseWriter, r *http.Request) {
+	conn := h.connection(w, r)
+	if conn == nil {
+		return
+	}
+
+	code := CloseKilled
+	if s := r.URL.Query().Get("code"); s != "" {
+		var err error
+		if code, err = strconv.Atoi(s); err != nil || code < 1000 || code > 4999 {
+			sendError(w, http.StatusBadRequest, "invalid close code")
+			return
+		}
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = defaultKillReason
+	}
+	conn.Close(code, reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if h.Registry == nil {
+		http.NotFound(w, r)
+		return
+	}
+	res := []Subscription{}
+	for _, conn := range h.Registry.Connections() {
+		id := conn.Info().ID
+		for _, op := range conn.Operations() {
+			res = append(res, Subscription{
+				ConnectionID:  id,
+				ID:            op.ID,
+				OperationName: op.Name,
+				QueryHash:     op.QueryHash,
+				State:         op.State(),
+				Transitions:   op.Transitions(),
+			})
+		}
+	}
+	sendJSON(w, http.StatusOK, res)
+}
+
+type logLevel struct {
+	Level slog.Level `json:"level"`
+}
+
+func (h *Handler) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	if h.LogLevel == nil {
+		http.NotFound(w, r)
+		return
+	}
+	sendJSON(w, http.StatusOK, logLevel{Level: h.LogLevel.Level()})
+}
+
+func (h *Handler) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	if h.LogLevel == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.LogLevel.Set(req.Level)
+	sendJSON(w, http.StatusOK, req)
+}
+
+type maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+func (h *Handler) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	if h.Maintenance == nil {
+		http.NotFound(w, r)
+		return
+	}
+	reason, enabled := h.Maintenance.Reason()
+	sendJSON(w, http.StatusOK, maintenance{Enabled: enabled, Reason: reason})
+}
+
+func (h *Handler) enableMaintenance(w http.ResponseWriter, r *http.Request) {
+	if h.Maintenance == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req maintenance
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.Maintenance.Enable(req.Reason)
+	sendJSON(w, http.StatusOK, maintenance{Enabled: true, Reason: req.Reason})
+}
+
+func (h *Handler) disableMaintenance(w http.ResponseWriter, r *http.Request) {
+	if h.Maintenance == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.Maintenance.Disable()
+	sendJSON(w, http.StatusOK, maintenance{})
+}
+
+func sendJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func sendError(w http.ResponseWriter, code int, message string) {
+	sendJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,157 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "secret"
+
+func newTestHandler(t *testing.T) (*Handler, http.Handler) {
+	h := &Handler{
+		Registry:    transport.NewRegistry(),
+		Maintenance: &transport.Maintenance{},
+		LogLevel:    &slog.LevelVar{},
+		Auth:        BearerAuth(testToken),
+	}
+	ws := &transport.Websocket{
+		Upgrader: transport.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		Registry:    h.Registry,
+		Maintenance: h.Maintenance,
+	}
+	return h, graphqlws.NewHandlerFunc(transporttest.NewFakeService(), http.NotFoundHandler(), graphqlws.WithWebsocketTransport(ws))
+}
+
+func connect(t *testing.T, handler http.Handler) *transporttest.Client {
+	c, err := transporttest.NewClient(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	assert.NoError(t, c.Init(nil))
+	return c
+}
+
+func do(t *testing.T, h http.Handler, method string, path string, body string, v interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if v != nil {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w.Code
+}
+
+func TestHandlerConnections(t *testing.T) {
+	h, handler := newTestHandler(t)
+	c := connect(t, handler)
+	assert.NoError(t, c.Subscribe("1", transporttest.Operation{Query: "subscription Values { value }", OperationName: "Values"}))
+	assert.Eventually(t, func() bool {
+		conns := h.Registry.Connections()
+		return len(conns) == 1 && len(conns[0].Subscriptions()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	var conns []Connection
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/connections", "", &conns))
+	if !assert.Len(t, conns, 1) {
+		return
+	}
+	assert.Equal(t, []string{"1"}, conns[0].Subscriptions)
+	assert.NotEmpty(t, conns[0].RemoteAddr)
+
+	var conn Connection
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/connections/"+conns[0].ID, "", &conn))
+	assert.Equal(t, conns[0].ID, conn.ID)
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/connections/unknown", "", nil))
+
+	var subs []Subscription
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/subscriptions", "", &subs))
+	if assert.Len(t, subs, 1) {
+		assert.Equal(t, conns[0].ID, subs[0].ConnectionID)
+		assert.Equal(t, "1", subs[0].ID)
+		assert.Equal(t, "Values", subs[0].OperationName)
+		assert.NotEmpty(t, subs[0].QueryHash)
+		assert.Equal(t, transport.OperationActive, subs[0].State)
+		if assert.Len(t, subs[0].Transitions, 2) {
+			assert.Equal(t, transport.OperationPending, subs[0].Transitions[0].State)
+		}
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodDelete, "/connections/"+conns[0].ID+"?code=42", "", nil))
+	assert.Equal(t, http.StatusNoContent, do(t, h, http.MethodDelete, "/connections/"+conns[0].ID+"?reason=bye", "", nil))
+	for {
+		_, err := c.Read()
+		if err != nil {
+			assert.True(t, websocket.IsCloseError(err, CloseKilled), "unexpected error %v", err)
+			break
+		}
+	}
+}
+
+func TestHandlerLogLevel(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	var level map[string]string
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPut, "/log-level", `{"level":"debug"}`, &level))
+	assert.Equal(t, slog.LevelDebug, h.LogLevel.Level())
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/log-level", "", &level))
+	assert.Equal(t, map[string]string{"level": "DEBUG"}, level)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPut, "/log-level", `{"level":"loud"}`, nil))
+}
+
+func TestHandlerMaintenance(t *testing.T) {
+	h, handler := newTestHandler(t)
+	open := connect(t, handler)
+
+	var m map[string]interface{}
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPut, "/maintenance", `{"reason":"upgrading"}`, &m))
+	assert.Equal(t, map[string]interface{}{"enabled": true, "reason": "upgrading"}, m)
+
+	_, err := transporttest.NewClient(handler)
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.NoError(t, open.Ping())
+
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodDelete, "/maintenance", "", &m))
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/maintenance", "", &m))
+	assert.Equal(t, map[string]interface{}{"enabled": false, "reason": ""}, m)
+	connect(t, handler)
+}
+
+func TestHandlerAuth(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/connections", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	r := httptest.NewRequest(http.MethodGet, "/connections", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	unprotected := &Handler{Registry: transport.NewRegistry()}
+	assert.Equal(t, http.StatusUnauthorized, do(t, unprotected, http.MethodGet, "/connections", "", nil))
+}
+
+func TestHandlerDisabledEndpoints(t *testing.T) {
+	h := &Handler{Auth: BearerAuth(testToken)}
+	for _, path := range []string{"/connections", "/subscriptions", "/log-level", "/maintenance"} {
+		assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, path, "", nil), path)
+	}
+}
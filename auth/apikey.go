@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// rateInterval is the interval of the rate limits of the API keys.
+const rateInterval = time.Minute
+
+var (
+	// ErrUnknownAPIKey is returned by the APIKeyStores for the keys they don't know.
+	ErrUnknownAPIKey = errors.New("auth: unknown API key")
+	// ErrRateLimited is returned for the connections and the operations beyond the rate limit of
+	// their API key.
+	ErrRateLimited = errors.New("auth: API key rate limit exceeded")
+	// ErrAuthenticationUnavailable is returned instead of the failures of the APIKeyStores and of
+	// the introspection endpoints, so that their details aren't sent to the clients, the failures
+	// are logged, see WithLogger.
+	ErrAuthenticationUnavailable = errors.New("auth: authentication unavailable")
+)
+
+// APIKey describes the client of an API key.
+type APIKey struct {
+	// ID identifies the client, it is the ID of its principal.
+	ID string `json:"id"`
+	// Scopes are the scopes granted to the client.
+	Scopes []string `json:"scopes,omitempty"`
+	// RateLimit is the number of connections and operations the client may start per minute,
+	// across its connections, it doesn't limit when zero.
+	RateLimit int `json:"rateLimit,omitempty"`
+	// Attributes are the attributes of the principal.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// APIKeyStore looks the API keys up, e.g. in a database.
+type APIKeyStore interface {
+	// LookupAPIKey returns the client of a key, or ErrUnknownAPIKey.
+	LookupAPIKey(ctx context.Context, key string) (*APIKey, error)
+}
+
+// APIKeyStoreFunc is an APIKeyStore calling the function.
+type APIKeyStoreFunc func(ctx context.Context, key string) (*APIKey, error)
+
+// LookupAPIKey implements APIKeyStore
+func (f APIKeyStoreFunc) LookupAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	return f(ctx, key)
+}
+
+// StaticAPIKeys is an APIKeyStore of the clients of a fixed set of keys.
+type StaticAPIKeys map[string]*APIKey
+
+var _ APIKeyStore = StaticAPIKeys{}
+
+// LookupAPIKey implements APIKeyStore
+func (s StaticAPIKeys) LookupAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	if client, ok := s[key]; ok {
+		return client, nil
+	}
+	return nil, ErrUnknownAPIKey
+}
+
+// APIKeysFromEnv returns the keys of the environment variables "<prefix><ID>", whose value is the
+// key of the client ID, in lower case. The comma separated scopes of the client are read from
+// "<prefix><ID>_SCOPES", e.g. GRAPHQLWS_KEY_BILLING=... and GRAPHQLWS_KEY_BILLING_SCOPES=read,write.
+func APIKeysFromEnv(prefix string) StaticAPIKeys {
+	keys := StaticAPIKeys{}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		id, ok := strings.CutPrefix(name, prefix)
+		if !ok || id == "" || value == "" || strings.HasSuffix(id, "_SCOPES") {
+			continue
+		}
+		client := &APIKey{ID: strings.ToLower(id)}
+		if scopes := os.Getenv(name + "_SCOPES"); scopes != "" {
+			for _, scope := range strings.Split(scopes, ",") {
+				client.Scopes = append(client.Scopes, strings.TrimSpace(scope))
+			}
+		}
+		keys[value] = client
+	}
+	return keys
+}
+
+// LoadAPIKeys reads the keys of a JSON file mapping the keys to their APIKey, e.g.
+// {"3f9a...": {"id": "billing", "scopes": ["read"], "rateLimit": 60}}.
+func LoadAPIKeys(path string) (StaticAPIKeys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys StaticAPIKeys
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("auth: decoding %s: %w", path, err)
+	}
+	for _, client := range keys {
+		if client == nil || client.ID == "" {
+			return nil, fmt.Errorf("auth: no id for a key of %s", path)
+		}
+	}
+	return keys, nil
+}
+
+type apiKeyCtxKey struct{}
+
+// apiKeyLimiter counts the connections and operations of the clients of the API keys during the
+// current interval.
+type apiKeyLimiter struct {
+	mu      sync.Mutex
+	start   time.Time
+	started map[string]int
+}
+
+// allow counts a connection or an operation of a client, it returns false beyond its rate limit.
+func (l *apiKeyLimiter) allow(client *APIKey) bool {
+	if client.RateLimit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now := time.Now(); now.Sub(l.start) >= rateInterval {
+		l.start = now
+		l.started = map[string]int{}
+	}
+	if l.started[client.ID] >= client.RateLimit {
+		return false
+	}
+	l.started[client.ID]++
+	return true
+}
+
+type apiKeyAuth struct {
+	limiter *apiKeyLimiter
+	client  *APIKey
+}
+
+// APIKeyInitFunc returns an InitFunc authenticating the machine clients with the API key of the
+// init payload, in its "apiKey" or "x-api-key" entry or its Authorization with the "ApiKey "
+// prefix. The principal of the client is stored in the context, the connections beyond the rate
+// limit of the key are rejected, see APIKeySubscribeFunc to limit their operations too. The
+// connections are rejected with ErrAuthenticationUnavailable when the store fails.
+func APIKeyInitFunc(store APIKeyStore, opts ...Option) transport.WebsocketInitFunc {
+	c := newConfig(opts)
+	limiter := &apiKeyLimiter{}
+	return func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+		key := apiKey(initPayload)
+		if key == "" {
+			return c.authenticated(ctx, initPayload, nil)
+		}
+		client, err := store.LookupAPIKey(ctx, key)
+		switch {
+		case errors.Is(err, ErrUnknownAPIKey):
+			return ctx, ErrUnknownAPIKey
+		case err != nil:
+			c.logger.ErrorContext(ctx, "unable to look the API key up", "error", err)
+			return ctx, ErrAuthenticationUnavailable
+		}
+		if !limiter.allow(client) {
+			return ctx, ErrRateLimited
+		}
+		ctx = context.WithValue(ctx, apiKeyCtxKey{}, &apiKeyAuth{limiter: limiter, client: client})
+		return c.authenticated(ctx, initPayload, &Principal{ID: client.ID, Scopes: client.Scopes, Attributes: client.Attributes})
+	}
+}
+
+// APIKeySubscribeFunc returns a SubscribeFunc rejecting the operations beyond the rate limit of
+// the API key of their connection, authenticated by APIKeyInitFunc, before calling next when not
+// nil.
+func APIKeySubscribeFunc(next transport.WebsocketSubscribeFunc) transport.WebsocketSubscribeFunc {
+	return func(ctx context.Context, op *transport.OperationInfo) (context.Context, error) {
+		if auth, ok := ctx.Value(apiKeyCtxKey{}).(*apiKeyAuth); ok && !auth.limiter.allow(auth.client) {
+			return ctx, ErrRateLimited
+		}
+		if next != nil {
+			return next(ctx, op)
+		}
+		return ctx, nil
+	}
+}
+
+func apiKey(initPayload transport.InitPayload) string {
+	for _, name := range []string{"apiKey", "x-api-key"} {
+		if key := initPayload.GetString(name); key != "" {
+			return key
+		}
+	}
+	authorization := initPayload.Authorization()
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "apikey ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyInitFunc(t *testing.T) {
+	store := StaticAPIKeys{
+		"k-billing": {ID: "billing", Scopes: []string{"read"}, RateLimit: 3},
+		"k-orders":  {ID: "orders"},
+	}
+	init := APIKeyInitFunc(store)
+	subscribe := APIKeySubscribeFunc(nil)
+	ctx := context.Background()
+
+	authenticated, err := init(ctx, transport.InitPayload{"apiKey": "k-billing"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{ID: "billing", Scopes: []string{"read"}}, GetPrincipal(authenticated))
+	assert.Equal(t, "billing", transport.GetIdentity(authenticated))
+	_, err = init(ctx, transport.InitPayload{"Authorization": "ApiKey k-billing"})
+	assert.NoError(t, err)
+
+	// the connections and the operations share the rate limit of the key
+	_, err = subscribe(authenticated, &transport.OperationInfo{ID: "1"})
+	assert.NoError(t, err)
+	_, err = subscribe(authenticated, &transport.OperationInfo{ID: "2"})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	_, err = init(ctx, transport.InitPayload{"x-api-key": "k-billing"})
+	assert.ErrorIs(t, err, ErrRateLimited)
+
+	orders, err := init(ctx, transport.InitPayload{"x-api-key": "k-orders"})
+	assert.NoError(t, err)
+	for range 5 {
+		_, err = subscribe(orders, &transport.OperationInfo{ID: "1"})
+		assert.NoError(t, err)
+	}
+
+	_, err = init(ctx, transport.InitPayload{"apiKey": "unknown"})
+	assert.ErrorIs(t, err, ErrUnknownAPIKey)
+	_, err = init(ctx, transport.InitPayload{"Authorization": "Bearer token"})
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+func TestAPIKeyInitFuncStoreFailure(t *testing.T) {
+	var logs bytes.Buffer
+	store := APIKeyStoreFunc(func(ctx context.Context, key string) (*APIKey, error) {
+		if key == "revoked" {
+			return nil, fmt.Errorf("key %s revoked: %w", key, ErrUnknownAPIKey)
+		}
+		return nil, errors.New("dial tcp 10.0.0.12:5432: connection refused")
+	})
+	init := APIKeyInitFunc(store, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	_, err := init(context.Background(), transport.InitPayload{"apiKey": "k-billing"})
+	assert.Equal(t, ErrAuthenticationUnavailable, err, "Expected the failure of the store not to be sent to the client")
+	assert.Contains(t, logs.String(), "connection refused")
+
+	_, err = init(context.Background(), transport.InitPayload{"apiKey": "revoked"})
+	assert.Equal(t, ErrUnknownAPIKey, err)
+}
+
+func TestAPIKeysFromEnv(t *testing.T) {
+	t.Setenv("TEST_KEY_BILLING", "k-billing")
+	t.Setenv("TEST_KEY_BILLING_SCOPES", "read, write")
+	t.Setenv("TEST_KEY_ORDERS", "k-orders")
+
+	assert.Equal(t, StaticAPIKeys{
+		"k-billing": {ID: "billing", Scopes: []string{"read", "write"}},
+		"k-orders":  {ID: "orders"},
+	}, APIKeysFromEnv("TEST_KEY_"))
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"k-billing": {"id": "billing", "scopes": ["read"], "rateLimit": 60}}`), 0o600))
+	keys, err := LoadAPIKeys(path)
+	assert.NoError(t, err)
+	client, err := keys.LookupAPIKey(context.Background(), "k-billing")
+	assert.NoError(t, err)
+	assert.Equal(t, &APIKey{ID: "billing", Scopes: []string{"read"}, RateLimit: 60}, client)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"k-billing": {"scopes": ["read"]}}`), 0o600))
+	_, err = LoadAPIKeys(path)
+	assert.Error(t, err)
+}
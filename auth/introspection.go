@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+const defaultIntrospectionCacheEntries = 10000
+
+// ErrInactiveToken is returned for the tokens the introspection endpoint reports as inactive,
+// e.g. expired or revoked.
+var ErrInactiveToken = errors.New("auth: inactive token")
+
+// ClientCredentials authenticate the server to the introspection endpoint with HTTP basic
+// authentication.
+type ClientCredentials struct {
+	ID     string
+	Secret string
+}
+
+type introspector struct {
+	config
+	url         string
+	credentials ClientCredentials
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]introspectionEntry
+}
+
+type introspectionEntry struct {
+	principal *Principal
+	err       error
+	expires   time.Time
+}
+
+// OAuth2IntrospectionInitFunc returns an InitFunc validating the opaque bearer tokens of the init
+// payload, in its Authorization, against an RFC 7662 introspection endpoint. The principal of an
+// active token is stored in the context, its ID is the subject, the username or the client id of
+// the token, and its attributes are the introspection response. The responses are cached, see
+// WithCacheTTL, with the tokens hashed. The connections are rejected with
+// ErrAuthenticationUnavailable when the endpoint fails.
+func OAuth2IntrospectionInitFunc(introspectionURL string, credentials ClientCredentials, opts ...Option) transport.WebsocketInitFunc {
+	i := &introspector{
+		config:      newConfig(opts),
+		url:         introspectionURL,
+		credentials: credentials,
+		cache:       map[[sha256.Size]byte]introspectionEntry{},
+	}
+	return i.init
+}
+
+func (i *introspector) init(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+	token := bearerToken(initPayload)
+	if token == "" {
+		return i.authenticated(ctx, initPayload, nil)
+	}
+	p, err := i.introspect(ctx, token)
+	if err != nil {
+		return ctx, err
+	}
+	return i.authenticated(ctx, initPayload, p)
+}
+
+// introspect returns the principal of an active token, from the cache when possible.
+func (i *introspector) introspect(ctx context.Context, token string) (*Principal, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+	i.mu.Lock()
+	entry, ok := i.cache[key]
+	i.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.principal, entry.err
+	}
+
+	response, err := i.request(ctx, token)
+	if err != nil {
+		// the failures of the endpoint aren't cached, nor sent to the client since they may tell
+		// the URL of the endpoint
+		i.logger.ErrorContext(ctx, "unable to introspect the token", "error", err)
+		return nil, ErrAuthenticationUnavailable
+	}
+	entry = introspectionEntry{expires: now.Add(i.cacheTTL)}
+	if active, _ := response["active"].(bool); active {
+		entry.principal = principalOf(response)
+		if exp, ok := response["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(entry.expires) {
+			entry.expires = time.Unix(int64(exp), 0)
+		}
+	} else {
+		entry.err = ErrInactiveToken
+	}
+	if i.cacheTTL > 0 {
+		i.store(key, entry, now)
+	}
+	return entry.principal, entry.err
+}
+
+func (i *introspector) store(key [sha256.Size]byte, entry introspectionEntry, now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.cache) >= defaultIntrospectionCacheEntries {
+		for k, e := range i.cache {
+			if !now.Before(e.expires) {
+				delete(i.cache, k)
+			}
+		}
+		if len(i.cache) >= defaultIntrospectionCacheEntries {
+			return
+		}
+	}
+	i.cache[key] = entry
+}
+
+func (i *introspector) request(ctx context.Context, token string) (map[string]interface{}, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.credentials.ID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.credentials.ID), url.QueryEscape(i.credentials.Secret))
+	}
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth: introspecting token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: introspecting token: %s", resp.Status)
+	}
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("auth: decoding introspection response: %w", err)
+	}
+	return response, nil
+}
+
+func principalOf(response map[string]interface{}) *Principal {
+	p := &Principal{Attributes: response}
+	for _, claim := range []string{"sub", "username", "client_id"} {
+		if id, _ := response[claim].(string); id != "" {
+			p.ID = id
+			break
+		}
+	}
+	if scope, _ := response["scope"].(string); scope != "" {
+		p.Scopes = strings.Fields(scope)
+	}
+	return p
+}
+
+// bearerToken returns the token of the Authorization of the init payload, with or without the
+// "Bearer " prefix.
+func bearerToken(initPayload transport.InitPayload) string {
+	authorization := initPayload.Authorization()
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return strings.TrimSpace(authorization)
+}
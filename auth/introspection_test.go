@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIntrospectionServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "gateway" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var response map[string]interface{}
+		switch r.PostFormValue("token") {
+		case "active":
+			response = map[string]interface{}{"active": true, "sub": "user-1", "scope": "read:orders write:orders", "exp": time.Now().Add(time.Hour).Unix()}
+		case "expiring":
+			response = map[string]interface{}{"active": true, "client_id": "worker", "exp": time.Now().Unix()}
+		case "failing":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		default:
+			response = map[string]interface{}{"active": false}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOAuth2IntrospectionInitFunc(t *testing.T) {
+	var requests atomic.Int32
+	server := newIntrospectionServer(t, &requests)
+	var logs bytes.Buffer
+	init := OAuth2IntrospectionInitFunc(server.URL, ClientCredentials{ID: "gateway", Secret: "s3cret"}, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	ctx := context.Background()
+
+	for range 2 {
+		authenticated, err := init(ctx, transport.InitPayload{"Authorization": "Bearer active"})
+		assert.NoError(t, err)
+		p := GetPrincipal(authenticated)
+		if assert.NotNil(t, p) {
+			assert.Equal(t, "user-1", p.ID)
+			assert.Equal(t, []string{"read:orders", "write:orders"}, p.Scopes)
+		}
+	}
+	assert.Equal(t, int32(1), requests.Load(), "Expected the response to be cached")
+
+	_, err := init(ctx, transport.InitPayload{"authorization": "revoked"})
+	assert.ErrorIs(t, err, ErrInactiveToken)
+	_, err = init(ctx, transport.InitPayload{"authorization": "revoked"})
+	assert.ErrorIs(t, err, ErrInactiveToken)
+	assert.Equal(t, int32(2), requests.Load(), "Expected the inactive tokens to be cached")
+
+	_, err = init(ctx, transport.InitPayload{})
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = init(ctx, transport.InitPayload{"Authorization": "Bearer failing"})
+	assert.Equal(t, ErrAuthenticationUnavailable, err, "Expected the failure of the endpoint not to be sent to the client")
+	assert.Contains(t, logs.String(), "500 Internal Server Error")
+	_, err = init(ctx, transport.InitPayload{"Authorization": "Bearer failing"})
+	assert.Equal(t, ErrAuthenticationUnavailable, err)
+	assert.Equal(t, int32(4), requests.Load(), "Expected the failures not to be cached")
+
+	// the responses are cached until the tokens expire
+	for range 2 {
+		authenticated, err := init(ctx, transport.InitPayload{"Authorization": "Bearer expiring"})
+		assert.NoError(t, err)
+		assert.Equal(t, "worker", GetPrincipal(authenticated).ID)
+	}
+	assert.Equal(t, int32(6), requests.Load())
+}
+
+func TestOAuth2IntrospectionInitFuncOptions(t *testing.T) {
+	var requests atomic.Int32
+	server := newIntrospectionServer(t, &requests)
+	var next atomic.Int32
+	init := OAuth2IntrospectionInitFunc(server.URL, ClientCredentials{ID: "gateway", Secret: "s3cret"},
+		WithAnonymous(),
+		WithRequiredScopes("read:orders"),
+		WithHTTPClient(server.Client()),
+		WithNext(func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+			next.Add(1)
+			return ctx, nil
+		}),
+	)
+
+	ctx, err := init(context.Background(), transport.InitPayload{})
+	assert.NoError(t, err)
+	assert.Nil(t, GetPrincipal(ctx))
+	_, err = init(context.Background(), transport.InitPayload{"Authorization": "Bearer active"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), next.Load())
+
+	_, err = init(context.Background(), transport.InitPayload{"Authorization": "Bearer expiring"})
+	assert.ErrorContains(t, err, "missing scope read:orders")
+	assert.Equal(t, int32(2), next.Load())
+}
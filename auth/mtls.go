@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"slices"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// CertificateMapper maps the verified chain of a client certificate, leaf first, to a principal.
+type CertificateMapper func(chain []*x509.Certificate) (*Principal, error)
+
+// CertificateInitFunc returns an InitFunc authenticating the connections with their client
+// certificate, for the service-to-service consumers authenticated by mTLS. The server must
+// request and verify the client certificates, see tls.Config.ClientAuth. The principal is stored
+// in the context before calling next, when not nil.
+func CertificateInitFunc(mapper CertificateMapper, next transport.WebsocketInitFunc) transport.WebsocketInitFunc {
+	return func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+		chain := transport.GetConnectionInfo(ctx).ClientCertificates()
+		if len(chain) == 0 {
+			return ctx, ErrUnauthenticated
+		}
+		p, err := mapper(chain)
+		if err != nil {
+			return ctx, err
+		}
+		ctx = WithPrincipal(ctx, p)
+		if next != nil {
+			return next(ctx, initPayload)
+		}
+		return ctx, nil
+	}
+}
+
+// SPIFFEIDMapper maps the certificates to the principal of their SPIFFE ID, the URI SAN
+// "spiffe://<trust domain>/<path>", when their trust domain is one of trustDomains, or any when
+// empty.
+func SPIFFEIDMapper(trustDomains ...string) CertificateMapper {
+	return func(chain []*x509.Certificate) (*Principal, error) {
+		for _, uri := range chain[0].URIs {
+			if uri.Scheme != "spiffe" {
+				continue
+			}
+			if len(trustDomains) != 0 && !slices.Contains(trustDomains, uri.Host) {
+				return nil, fmt.Errorf("auth: untrusted SPIFFE ID %s", uri)
+			}
+			return &Principal{ID: uri.String(), Attributes: map[string]interface{}{"trustDomain": uri.Host}}, nil
+		}
+		return nil, fmt.Errorf("auth: no SPIFFE ID in certificate of %s", chain[0].Subject)
+	}
+}
+
+// CommonNameMapper maps the certificates to the principal of their common name, when it is one of
+// allowed, or any when empty.
+func CommonNameMapper(allowed ...string) CertificateMapper {
+	return func(chain []*x509.Certificate) (*Principal, error) {
+		cn := chain[0].Subject.CommonName
+		if cn == "" || len(allowed) != 0 && !slices.Contains(allowed, cn) {
+			return nil, fmt.Errorf("auth: common name %q not allowed", cn)
+		}
+		return &Principal{ID: cn}, nil
+	}
+}
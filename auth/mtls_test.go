@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCertificate returns a certificate signed by parent, or self-signed when nil.
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func newTestCA(t *testing.T) tls.Certificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newTestClientCertificate(t *testing.T, ca tls.Certificate, cn string, uris ...string) tls.Certificate {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		assert.NoError(t, err)
+		template.URIs = append(template.URIs, u)
+	}
+	return newTestCertificate(t, template, &ca)
+}
+
+func TestSPIFFEIDMapper(t *testing.T) {
+	ca := newTestCA(t)
+	cert := newTestClientCertificate(t, ca, "orders", "spiffe://prod.example.com/ns/orders/sa/worker")
+
+	p, err := SPIFFEIDMapper("prod.example.com")([]*x509.Certificate{cert.Leaf})
+	assert.NoError(t, err)
+	assert.Equal(t, "spiffe://prod.example.com/ns/orders/sa/worker", p.ID)
+	assert.Equal(t, "prod.example.com", p.Attributes["trustDomain"])
+
+	_, err = SPIFFEIDMapper("staging.example.com")([]*x509.Certificate{cert.Leaf})
+	assert.Error(t, err)
+	_, err = SPIFFEIDMapper()([]*x509.Certificate{newTestClientCertificate(t, ca, "orders").Leaf})
+	assert.Error(t, err)
+}
+
+func TestCommonNameMapper(t *testing.T) {
+	ca := newTestCA(t)
+	chain := []*x509.Certificate{newTestClientCertificate(t, ca, "billing").Leaf}
+
+	p, err := CommonNameMapper()(chain)
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", p.ID)
+	p, err = CommonNameMapper("orders", "billing")(chain)
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", p.ID)
+	_, err = CommonNameMapper("orders")(chain)
+	assert.Error(t, err)
+}
+
+func TestCertificateInitFunc(t *testing.T) {
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	principals := make(chan *Principal, 1)
+	ws := &transport.Websocket{
+		InitFunc: CertificateInitFunc(CommonNameMapper("orders"), func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+			principals <- GetPrincipal(ctx)
+			return ctx, nil
+		}),
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.Do(w, r, transporttest.NewFakeService())
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	dial := func(certificates ...tls.Certificate) *websocket.Conn {
+		dialer := websocket.Dialer{
+			Subprotocols:    []string{"graphql-transport-ws"},
+			TLSClientConfig: &tls.Config{RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs, Certificates: certificates},
+		}
+		conn, _, err := dialer.Dial("wss"+strings.TrimPrefix(server.URL, "https"), nil)
+		assert.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		return conn
+	}
+
+	conn := dial(newTestClientCertificate(t, ca, "orders"))
+	var msg map[string]interface{}
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "connection_ack", msg["type"])
+	assert.Equal(t, &Principal{ID: "orders"}, <-principals)
+
+	// the connections without certificate, or with a certificate not allowed, are closed
+	for _, conn := range []*websocket.Conn{dial(), dial(newTestClientCertificate(t, ca, "billing"))} {
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "unexpected error %v", err)
+	}
+	assert.Empty(t, principals)
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+const defaultDecisionCacheEntries = 10000
+
+var (
+	// ErrPolicyDenied is returned for the connections and the operations denied by a policy.
+	ErrPolicyDenied = errors.New("auth: denied by policy")
+	// ErrPolicyUnavailable is returned by the InitFuncs and the SubscribeFuncs instead of the
+	// failures of the server and of the decisions, so that their details aren't sent to the
+	// clients, the failures are logged, see WithLogger.
+	ErrPolicyUnavailable = errors.New("auth: policy evaluation unavailable")
+)
+
+// PolicyDecision is the decision of a policy. The policies decide either a boolean, whether they
+// allow, or an object with the fields of the decision, e.g.
+//
+//	subscribe := {"allow": true, "filter": "region == $principal.attributes.region"} if { ... }
+type PolicyDecision struct {
+	// Allow is true when the policy allows the connection or the operation.
+	Allow bool `json:"allow"`
+	// Reason is sent to the clients denied, after ErrPolicyDenied.
+	Reason string `json:"reason,omitempty"`
+	// Filter is a pubsub filter expression, the operations only receive the messages matching it.
+	// Its variables are the fields of the input of the policy, e.g. $principal.id.
+	Filter string `json:"filter,omitempty"`
+}
+
+// OPA evaluates the policies of an Open Policy Agent server, with its Data API, so that the
+// authorization rules are managed outside of the Go code. The policies are named by the path of
+// their decision, e.g. "graphqlws/subscribe" for the rule subscribe of the package graphqlws.
+//
+// The input of the policies has the principal authenticated by the previous InitFuncs, when
+// there is one, the init payload and the connection; the input of the subscribe policies has the
+// operation too. The decisions are cached by input, see WithCacheTTL, and the failures of the
+// server aren't. The connections and the operations are rejected with ErrPolicyUnavailable when
+// the server fails.
+type OPA struct {
+	config
+	url string
+
+	mu      sync.Mutex
+	cache   map[[sha256.Size]byte]decisionEntry
+	filters map[string]*pubsub.FilterExpr
+}
+
+type decisionEntry struct {
+	decision *PolicyDecision
+	expires  time.Time
+}
+
+// NewOPA returns an OPA evaluating the policies of the server at serverURL, e.g.
+// "http://localhost:8181". WithHTTPClient and WithCacheTTL configure the requests, WithNext is
+// called by the InitFunc once the connection is allowed.
+func NewOPA(serverURL string, opts ...Option) *OPA {
+	return &OPA{
+		config:  newConfig(opts),
+		url:     strings.TrimSuffix(serverURL, "/"),
+		cache:   map[[sha256.Size]byte]decisionEntry{},
+		filters: map[string]*pubsub.FilterExpr{},
+	}
+}
+
+// InitFunc returns an InitFunc rejecting the connections the policy doesn't allow.
+func (o *OPA) InitFunc(policy string) transport.WebsocketInitFunc {
+	return func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+		decision, err := o.Decide(ctx, policy, policyInput(ctx, initPayload, nil))
+		if err != nil {
+			return ctx, o.unavailable(ctx, policy, err)
+		}
+		if !decision.Allow {
+			return ctx, decision.denied()
+		}
+		if o.next != nil {
+			return o.next(ctx, initPayload)
+		}
+		return ctx, nil
+	}
+}
+
+// SubscribeFunc returns a SubscribeFunc rejecting the operations the policy doesn't allow, with
+// the FORBIDDEN code, and binding the Filter of its decision, see pubsub.WithFilter, before
+// calling next when not nil.
+func (o *OPA) SubscribeFunc(policy string, next transport.WebsocketSubscribeFunc) transport.WebsocketSubscribeFunc {
+	return func(ctx context.Context, op *transport.OperationInfo) (context.Context, error) {
+		input := policyInput(ctx, transport.GetInitPayload(ctx), op)
+		decision, err := o.Decide(ctx, policy, input)
+		if err != nil {
+			return ctx, o.unavailable(ctx, policy, err)
+		}
+		if !decision.Allow {
+			return ctx, &transport.ForbiddenError{Err: decision.denied()}
+		}
+		if decision.Filter != "" {
+			pred, err := o.filter(decision.Filter, input)
+			if err != nil {
+				return ctx, o.unavailable(ctx, policy, err)
+			}
+			ctx = pubsub.WithFilter(ctx, pred)
+		}
+		if next != nil {
+			return next(ctx, op)
+		}
+		return ctx, nil
+	}
+}
+
+// Decide evaluates a policy with input, from the cache when possible. The undefined decisions
+// deny. Its errors tell the URL of the server and the policy, they aren't meant for the clients.
+func (o *OPA) Decide(ctx context.Context, policy string, input interface{}) (*PolicyDecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(append([]byte(policy+"\x00"), body...))
+	now := time.Now()
+	o.mu.Lock()
+	entry, ok := o.cache[key]
+	o.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.decision, nil
+	}
+
+	decision, err := o.request(ctx, policy, body)
+	if err != nil {
+		return nil, err
+	}
+	if o.cacheTTL > 0 {
+		o.store(key, decisionEntry{decision: decision, expires: now.Add(o.cacheTTL)}, now)
+	}
+	return decision, nil
+}
+
+func (o *OPA) store(key [sha256.Size]byte, entry decisionEntry, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.cache) >= defaultDecisionCacheEntries {
+		for k, e := range o.cache {
+			if !now.Before(e.expires) {
+				delete(o.cache, k)
+			}
+		}
+		if len(o.cache) >= defaultDecisionCacheEntries {
+			return
+		}
+	}
+	o.cache[key] = entry
+}
+
+func (o *OPA) request(ctx context.Context, policy string, body []byte) (*PolicyDecision, error) {
+	url := o.url + "/v1/data/" + strings.Trim(policy, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth: evaluating policy %s: %w", policy, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: evaluating policy %s: %s", policy, resp.Status)
+	}
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("auth: decoding decision of policy %s: %w", policy, err)
+	}
+	decision := &PolicyDecision{}
+	switch {
+	case len(response.Result) == 0:
+		// undefined
+	case response.Result[0] == '{':
+		err = json.Unmarshal(response.Result, decision)
+	default:
+		err = json.Unmarshal(response.Result, &decision.Allow)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auth: decoding decision of policy %s: %w", policy, err)
+	}
+	return decision, nil
+}
+
+// filter binds a filter expression with input, the expressions are compiled once.
+func (o *OPA) filter(expr string, input map[string]interface{}) (pubsub.Predicate, error) {
+	o.mu.Lock()
+	f, ok := o.filters[expr]
+	o.mu.Unlock()
+	if !ok {
+		var err error
+		if f, err = pubsub.CompileFilter(expr); err != nil {
+			return nil, err
+		}
+		o.mu.Lock()
+		if len(o.filters) < defaultDecisionCacheEntries {
+			o.filters[expr] = f
+		}
+		o.mu.Unlock()
+	}
+	return f.Bind(input)
+}
+
+// unavailable logs the failure of a policy and returns ErrPolicyUnavailable.
+func (o *OPA) unavailable(ctx context.Context, policy string, err error) error {
+	o.logger.ErrorContext(ctx, "unable to evaluate the policy", "policy", policy, "error", err)
+	return ErrPolicyUnavailable
+}
+
+func (d *PolicyDecision) denied() error {
+	if d.Reason == "" {
+		return ErrPolicyDenied
+	}
+	return fmt.Errorf("%w: %s", ErrPolicyDenied, d.Reason)
+}
+
+// policyInput returns the input of the policies, without the ids of the connection and the
+// operation nor the port of the client so that the decisions are cached across them.
+func policyInput(ctx context.Context, initPayload transport.InitPayload, op *transport.OperationInfo) map[string]interface{} {
+	input := map[string]interface{}{"initPayload": initPayload}
+	if p := GetPrincipal(ctx); p != nil {
+		input["principal"] = map[string]interface{}{"id": p.ID, "scopes": p.Scopes, "attributes": p.Attributes}
+	}
+	if info := transport.GetConnectionInfo(ctx); info != nil {
+		host, _, err := net.SplitHostPort(info.RemoteAddr)
+		if err != nil {
+			host = info.RemoteAddr
+		}
+		input["connection"] = map[string]interface{}{"remoteIP": host, "subprotocol": info.Subprotocol}
+	}
+	if tenant := transport.GetTenant(ctx); tenant != "" {
+		input["tenant"] = tenant
+	}
+	if op != nil {
+		input["operation"] = map[string]interface{}{
+			"name":          op.Name,
+			"query":         op.Query,
+			"queryHash":     op.QueryHash,
+			"variableNames": op.VariableNames,
+			"extensions":    op.Extensions,
+		}
+	}
+	return input
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOPAServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var request struct {
+			Input struct {
+				InitPayload map[string]interface{} `json:"initPayload"`
+				Principal   *struct {
+					ID     string   `json:"id"`
+					Scopes []string `json:"scopes"`
+				} `json:"principal"`
+				Operation *struct {
+					Name string `json:"name"`
+				} `json:"operation"`
+			} `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		input := request.Input
+		var result interface{}
+		switch r.URL.Path {
+		case "/v1/data/graphqlws/connect":
+			switch input.InitPayload["client"] {
+			case "banned":
+				result = map[string]interface{}{"allow": false, "reason": "banned client"}
+			case "failing":
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			default:
+				result = input.Principal != nil
+			}
+		case "/v1/data/graphqlws/subscribe":
+			switch {
+			case input.Operation == nil || input.Principal == nil:
+			case input.Operation.Name == "Orders":
+				result = map[string]interface{}{"allow": true, "filter": "owner == $principal.id"}
+			case input.Operation.Name == "Admin":
+				result = map[string]interface{}{"allow": len(input.Principal.Scopes) != 0}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response := map[string]interface{}{}
+		if result != nil {
+			response["result"] = result
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOPAInitFunc(t *testing.T) {
+	var requests atomic.Int32
+	server := newOPAServer(t, &requests)
+	var logs bytes.Buffer
+	opa := NewOPA(server.URL+"/", WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	init := opa.InitFunc("graphqlws/connect")
+	ctx := WithPrincipal(context.Background(), &Principal{ID: "user-1"})
+
+	for range 2 {
+		_, err := init(ctx, transport.InitPayload{"client": "web"})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), requests.Load(), "Expected the decision to be cached")
+
+	_, err := init(context.Background(), transport.InitPayload{"client": "web"})
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+
+	_, err = init(ctx, transport.InitPayload{"client": "banned"})
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	assert.ErrorContains(t, err, "banned client")
+
+	for range 2 {
+		_, err = init(ctx, transport.InitPayload{"client": "failing"})
+		assert.Equal(t, ErrPolicyUnavailable, err, "Expected the failure of the server not to be sent to the client")
+	}
+	assert.Contains(t, logs.String(), "500 Internal Server Error")
+	assert.Equal(t, int32(5), requests.Load(), "Expected the failures not to be cached")
+
+	for _, ttl := range []time.Duration{-time.Second, 0} {
+		var next bool
+		uncached := NewOPA(server.URL, WithCacheTTL(ttl), WithNext(func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+			next = true
+			return ctx, nil
+		}))
+		before := requests.Load()
+		_, err = uncached.InitFunc("graphqlws/connect")(ctx, transport.InitPayload{"client": "web"})
+		assert.NoError(t, err)
+		assert.True(t, next)
+		_, err = uncached.InitFunc("graphqlws/connect")(ctx, transport.InitPayload{"client": "web"})
+		assert.NoError(t, err)
+		assert.Equal(t, before+2, requests.Load(), "Expected nothing to be cached with a TTL of %s", ttl)
+	}
+}
+
+func TestOPASubscribeFunc(t *testing.T) {
+	var requests atomic.Int32
+	server := newOPAServer(t, &requests)
+	subscribe := NewOPA(server.URL).SubscribeFunc("graphqlws/subscribe", nil)
+	ctx, cancel := context.WithCancel(WithPrincipal(context.Background(), &Principal{ID: "user-1"}))
+	defer cancel()
+
+	_, err := subscribe(ctx, &transport.OperationInfo{Name: "Admin"})
+	var forbidden *transport.ForbiddenError
+	assert.ErrorAs(t, err, &forbidden)
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+
+	_, err = subscribe(ctx, &transport.OperationInfo{Name: "Unknown"})
+	assert.ErrorIs(t, err, ErrPolicyDenied, "Expected the undefined decisions to deny")
+
+	filtered, err := subscribe(ctx, &transport.OperationInfo{Name: "Orders"})
+	assert.NoError(t, err)
+	broker := pubsub.NewMemory()
+	orders, err := broker.Subscribe(filtered, "orders/#")
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "orders/1", json.RawMessage(`{"owner":"user-2"}`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/2", json.RawMessage(`{"owner":"user-1"}`)))
+	select {
+	case msg := <-orders:
+		assert.Equal(t, "orders/2", msg.Topic)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the order of the principal")
+	}
+}
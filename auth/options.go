@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+const (
+	defaultCacheTTL    = time.Minute
+	defaultHTTPTimeout = 10 * time.Second
+)
+
+// defaultHTTPClient sends the requests of the InitFuncs without WithHTTPClient, unlike
+// http.DefaultClient it doesn't wait forever for an endpoint not responding.
+var defaultHTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
+
+// Option configures the InitFuncs of the package.
+type Option func(*config)
+
+type config struct {
+	client         *http.Client
+	cacheTTL       time.Duration
+	requiredScopes []string
+	anonymous      bool
+	next           transport.WebsocketInitFunc
+	logger         *slog.Logger
+}
+
+func newConfig(opts []Option) config {
+	c := config{client: defaultHTTPClient, cacheTTL: defaultCacheTTL, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithHTTPClient sends the introspection and the OPA requests with client, otherwise with a client
+// timing the requests out after 10 seconds.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// WithCacheTTL caches the introspection responses and the OPA decisions for ttl, or until the
+// tokens expire when sooner, it defaults to a minute. Nothing is cached when ttl is zero or
+// negative.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.cacheTTL = ttl
+	}
+}
+
+// WithRequiredScopes rejects the principals without all the scopes.
+func WithRequiredScopes(scopes ...string) Option {
+	return func(c *config) {
+		c.requiredScopes = scopes
+	}
+}
+
+// WithAnonymous accepts the connections without credentials, without principal in their context.
+func WithAnonymous() Option {
+	return func(c *config) {
+		c.anonymous = true
+	}
+}
+
+// WithNext calls next once the connection is authenticated.
+func WithNext(next transport.WebsocketInitFunc) Option {
+	return func(c *config) {
+		c.next = next
+	}
+}
+
+// WithLogger writes the failures hidden from the clients to logger, e.g. of an APIKeyStore,
+// slog.Default() otherwise.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// authenticated stores the principal in the context and calls the next InitFunc, the connections
+// without principal are rejected unless they may be anonymous.
+func (c *config) authenticated(ctx context.Context, initPayload transport.InitPayload, p *Principal) (context.Context, error) {
+	if p == nil {
+		if !c.anonymous {
+			return ctx, ErrUnauthenticated
+		}
+	} else {
+		for _, scope := range c.requiredScopes {
+			if !p.HasScope(scope) {
+				return ctx, fmt.Errorf("auth: missing scope %s", scope)
+			}
+		}
+		ctx = WithPrincipal(ctx, p)
+	}
+	if c.next != nil {
+		return c.next(ctx, initPayload)
+	}
+	return ctx, nil
+}
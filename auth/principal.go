@@ -0,0 +1,48 @@
+// Package auth authenticates the connections of the transport from their init payload or their
+// TLS connection, and stores the authenticated Principal in their context for the resolvers.
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// ErrUnauthenticated is returned by the InitFuncs for the connections without credentials.
+var ErrUnauthenticated = errors.New("auth: unauthenticated")
+
+type principalCtxKey struct{}
+
+// Principal is the authenticated client of a connection.
+type Principal struct {
+	// ID identifies the principal, e.g. a SPIFFE ID, the common name of a certificate or the
+	// subject of a token.
+	ID string
+	// Scopes are the scopes granted to the principal.
+	Scopes []string
+	// Attributes are the other attributes of the principal, e.g. the claims of a token.
+	Attributes map[string]interface{}
+}
+
+// HasScope returns true if the scope is granted to the principal.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && slices.Contains(p.Scopes, scope)
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal, identified by its ID for the
+// transport.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	if p != nil {
+		ctx = transport.WithIdentity(ctx, p.ID)
+	}
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+// GetPrincipal returns the principal of the connection of ctx, or nil when it isn't
+// authenticated.
+func GetPrincipal(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalCtxKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,561 @@
+// Package client implements a graphql-transport-ws client, running many operations over a single
+// websocket connection.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Subprotocol is the subprotocol spoken by the client.
+const Subprotocol = "graphql-transport-ws"
+
+const (
+	defaultAckTimeout = 10 * time.Second
+	// payloadBuffer is the number of payloads of a subscription buffered before the connection
+	// waits for the subscription to receive them.
+	payloadBuffer = 16
+)
+
+// ErrClosed is returned once the client was closed.
+var ErrClosed = errors.New("client closed")
+
+// ErrHeartbeatTimeout is returned once the client closed a connection on which nothing was
+// received within the heartbeat window.
+var ErrHeartbeatTimeout = errors.New("no message received from the server within the heartbeat window")
+
+// Request is a GraphQL operation.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Option configures a Client.
+type Option func(*config)
+
+type config struct {
+	socketConfig
+	header                http.Header
+	headerFunc            func(ctx context.Context) (http.Header, error)
+	initPayload           interface{}
+	initPayloadFunc       func(ctx context.Context) (interface{}, error)
+	ackTimeout            time.Duration
+	heartbeat             time.Duration
+	onHeartbeatTimeout    func()
+	operationInterceptors []OperationInterceptor
+	eventInterceptors     []EventInterceptor
+}
+
+// OperationInterceptor is called before an operation is sent, it can change the request or refuse
+// it by returning an error. The maps of the request are shared with the caller of Subscribe, they
+// must be replaced rather than modified.
+type OperationInterceptor func(ctx context.Context, req *Request) error
+
+// EventInterceptor is called with every message received from the server, e.g. to log them or
+// emit metrics. It must not block.
+type EventInterceptor func(event Event)
+
+// Event is a message received from the server.
+type Event struct {
+	// ID is the id of the operation the message belongs to, it is empty for the messages of the
+	// connection.
+	ID      string
+	Type    string
+	Payload json.RawMessage
+}
+
+// WithHeader sets the headers of the upgrade request. Browsers don't let the clients built for
+// js/wasm set them, the credentials are sent with WithInitPayload instead.
+func WithHeader(header http.Header) Option {
+	return func(cfg *config) {
+		cfg.header = header
+	}
+}
+
+// WithHeaderFunc sets a function returning headers added to the upgrade request every time the
+// connection is dialed, e.g. to refresh an authorization header.
+func WithHeaderFunc(fn func(ctx context.Context) (http.Header, error)) Option {
+	return func(cfg *config) {
+		cfg.headerFunc = fn
+	}
+}
+
+// WithInitPayload sets the payload of the connection_init message.
+func WithInitPayload(payload interface{}) Option {
+	return func(cfg *config) {
+		cfg.initPayload = payload
+	}
+}
+
+// WithInitPayloadFunc sets a function returning the payload of the connection_init message every
+// time the connection is dialed, it takes precedence over WithInitPayload.
+func WithInitPayloadFunc(fn func(ctx context.Context) (interface{}, error)) Option {
+	return func(cfg *config) {
+		cfg.initPayloadFunc = fn
+	}
+}
+
+// WithHeartbeat closes the connection when nothing is received from the server within window,
+// detecting the servers that are gone without closing the connection, e.g. behind a NAT dropping
+// half-open connections. The client pings the server once nothing was received for a third of
+// the window. The active operations fail with ErrHeartbeatTimeout and onTimeout, if not nil, is
+// called. The operations subscribed with retries over a Pool are resumed on a new connection.
+func WithHeartbeat(window time.Duration, onTimeout func()) Option {
+	return func(cfg *config) {
+		cfg.heartbeat = window
+		cfg.onHeartbeatTimeout = onTimeout
+	}
+}
+
+// WithOperationInterceptor adds an interceptor of the operations, they are called in the order
+// they were added.
+func WithOperationInterceptor(interceptor OperationInterceptor) Option {
+	return func(cfg *config) {
+		cfg.operationInterceptors = append(cfg.operationInterceptors, interceptor)
+	}
+}
+
+// WithEventInterceptor adds an interceptor of the messages received from the server, they are
+// called in the order they were added.
+func WithEventInterceptor(interceptor EventInterceptor) Option {
+	return func(cfg *config) {
+		cfg.eventInterceptors = append(cfg.eventInterceptors, interceptor)
+	}
+}
+
+// WithAckTimeout sets how long the client waits for the server to acknowledge the connection, it
+// defaults to 10 seconds.
+func WithAckTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.ackTimeout = timeout
+	}
+}
+
+// Client is a connection to a graphql-transport-ws server.
+type Client struct {
+	conn    socket
+	writeMu sync.Mutex
+	nextID  atomic.Uint64
+
+	operationInterceptors []OperationInterceptor
+	eventInterceptors     []EventInterceptor
+	heartbeat             time.Duration
+	onHeartbeatTimeout    func()
+	lastRead              atomic.Int64
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+	err  error
+	done chan struct{}
+}
+
+// Dial connects to the server at url and waits for the connection to be acknowledged.
+func Dial(ctx context.Context, url string, opts ...Option) (*Client, error) {
+	cfg := config{
+		socketConfig: defaultSocketConfig(),
+		ackTimeout:   defaultAckTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	header := cfg.header
+	if cfg.headerFunc != nil {
+		extra, err := cfg.headerFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		header = header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		for key, values := range extra {
+			header[key] = values
+		}
+	}
+	if cfg.initPayloadFunc != nil {
+		payload, err := cfg.initPayloadFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cfg.initPayload = payload
+	}
+
+	conn, err := dialSocket(ctx, url, header, cfg.socketConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:                  conn,
+		operationInterceptors: cfg.operationInterceptors,
+		eventInterceptors:     cfg.eventInterceptors,
+		heartbeat:             cfg.heartbeat,
+		onHeartbeatTimeout:    cfg.onHeartbeatTimeout,
+		subs:                  map[string]*Subscription{},
+		done:                  make(chan struct{}),
+	}
+	if err := c.init(ctx, cfg); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	c.lastRead.Store(time.Now().UnixNano())
+	go c.read()
+	if c.heartbeat > 0 {
+		go c.ping()
+	}
+	return c, nil
+}
+
+// init sends connection_init and waits for connection_ack.
+func (c *Client) init(ctx context.Context, cfg config) error {
+	m := message{Type: "connection_init"}
+	if cfg.initPayload != nil {
+		b, err := json.Marshal(cfg.initPayload)
+		if err != nil {
+			return err
+		}
+		m.Payload = b
+	}
+	if err := c.write(m); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(cfg.ackTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = c.conn.SetReadDeadline(deadline)
+	defer func() { _ = c.conn.SetReadDeadline(time.Time{}) }()
+
+	for {
+		var m message
+		if err := c.readMessage(&m); err != nil {
+			return err
+		}
+		c.intercept(m)
+		switch m.Type {
+		case "connection_ack":
+			return nil
+		case "ping":
+			if err := c.write(message{Type: "pong", Payload: m.Payload}); err != nil {
+				return err
+			}
+		case "pong":
+		default:
+			return fmt.Errorf("unexpected %s message before connection_ack", m.Type)
+		}
+	}
+}
+
+// Subscribe starts an operation, it is stopped when ctx is done.
+func (c *Client) Subscribe(ctx context.Context, req Request) (*Subscription, error) {
+	return c.subscribe(ctx, req, nil)
+}
+
+// subscribe starts an operation, onFinish is called once it ended or failed to start.
+func (c *Client) subscribe(ctx context.Context, req Request, onFinish func()) (*Subscription, error) {
+	var err error
+	for _, intercept := range c.operationInterceptors {
+		if err = intercept(ctx, &req); err != nil {
+			break
+		}
+	}
+	var payload []byte
+	if err == nil {
+		payload, err = json.Marshal(req)
+	}
+	if err != nil {
+		if onFinish != nil {
+			onFinish()
+		}
+		return nil, err
+	}
+
+	s := &Subscription{
+		client:   c,
+		id:       strconv.FormatUint(c.nextID.Add(1), 10),
+		payloads: make(chan json.RawMessage, payloadBuffer),
+		done:     make(chan struct{}),
+		onFinish: onFinish,
+	}
+
+	c.mu.Lock()
+	if c.subs == nil {
+		err := c.err
+		c.mu.Unlock()
+		if onFinish != nil {
+			onFinish()
+		}
+		return nil, err
+	}
+	c.subs[s.id] = s
+	c.mu.Unlock()
+
+	if err := c.write(message{ID: s.id, Type: "subscribe", Payload: payload}); err != nil {
+		if c.remove(s.id) != nil {
+			s.finish(err)
+		}
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = s.cancel(ctx.Err()) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		stop()
+	} else {
+		s.stop = stop
+	}
+	return s, nil
+}
+
+// Done is closed once the connection is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection was closed, or nil while it is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection, the active subscriptions fail with ErrClosed.
+func (c *Client) Close() error {
+	c.writeMu.Lock()
+	_ = c.conn.WriteClose(websocket.CloseNormalClosure, "")
+	c.writeMu.Unlock()
+
+	c.shutdown(ErrClosed)
+	return c.conn.Close()
+}
+
+func (c *Client) write(m message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(b)
+}
+
+// readMessage reads the next message sent by the server.
+func (c *Client) readMessage(m *message) error {
+	b, err := c.conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, m)
+}
+
+func (c *Client) read() {
+	for {
+		if c.heartbeat > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.heartbeat))
+		}
+		var m message
+		if err := c.readMessage(&m); err != nil {
+			var netErr net.Error
+			if c.heartbeat > 0 && errors.As(err, &netErr) && netErr.Timeout() {
+				err = ErrHeartbeatTimeout
+				if c.onHeartbeatTimeout != nil {
+					c.onHeartbeatTimeout()
+				}
+			}
+			c.shutdown(err)
+			_ = c.conn.Close()
+			return
+		}
+		c.lastRead.Store(time.Now().UnixNano())
+		c.intercept(m)
+
+		switch m.Type {
+		case "next":
+			if s := c.subscription(m.ID); s != nil {
+				s.deliver(m.Payload)
+			}
+		case "error":
+			var errs gqlerror.List
+			if err := json.Unmarshal(m.Payload, &errs); err != nil {
+				errs = gqlerror.List{gqlerror.Errorf("invalid error payload: %s", m.Payload)}
+			}
+			if s := c.remove(m.ID); s != nil {
+				s.finish(errs)
+			}
+		case "complete":
+			if s := c.remove(m.ID); s != nil {
+				s.finish(nil)
+			}
+		case "ping":
+			if err := c.write(message{Type: "pong", Payload: m.Payload}); err != nil {
+				c.shutdown(err)
+				_ = c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// ping pings the server once nothing was received for a third of the heartbeat window, leaving
+// at least a third of the window for the pong.
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.heartbeat / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, c.lastRead.Load())) >= c.heartbeat/3 {
+			_ = c.write(message{Type: "ping"})
+		}
+	}
+}
+
+func (c *Client) intercept(m message) {
+	for _, intercept := range c.eventInterceptors {
+		intercept(Event{ID: m.ID, Type: m.Type, Payload: m.Payload})
+	}
+}
+
+// shutdown fails the active subscriptions with err once the connection is closed.
+func (c *Client) shutdown(err error) {
+	c.mu.Lock()
+	subs := c.subs
+	if subs == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.subs = nil
+	c.err = err
+	close(c.done)
+	c.mu.Unlock()
+
+	for _, s := range subs {
+		s.finish(err)
+	}
+}
+
+func (c *Client) subscription(id string) *Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subs[id]
+}
+
+// remove unregisters a subscription, it returns nil if the subscription wasn't active.
+func (c *Client) remove(id string) *Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.subs[id]
+	if !ok {
+		return nil
+	}
+	delete(c.subs, id)
+	return s
+}
+
+// Subscription is an operation started by a Client.
+type Subscription struct {
+	client   *Client
+	id       string
+	payloads chan json.RawMessage
+	stop     func() bool
+	onFinish func()
+
+	mu       sync.Mutex
+	finished bool
+	err      error
+	done     chan struct{}
+}
+
+// ID returns the id of the operation on its connection.
+func (s *Subscription) ID() string {
+	return s.id
+}
+
+// Payloads returns the payloads of the next messages, the channel is closed when the operation
+// ends. The connection waits for the slow subscriptions to receive their payloads.
+func (s *Subscription) Payloads() <-chan json.RawMessage {
+	return s.payloads
+}
+
+// Err returns why the operation ended once Payloads is closed. It is nil when the server
+// completed the operation or it was closed, gqlerror.List when the server sent an error message
+// and the error of the context when it was done.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the operation.
+func (s *Subscription) Close() error {
+	return s.cancel(nil)
+}
+
+func (s *Subscription) cancel(err error) error {
+	if s.client.remove(s.id) == nil {
+		return nil
+	}
+	s.finish(err)
+	return s.client.write(message{ID: s.id, Type: "complete"})
+}
+
+func (s *Subscription) deliver(payload json.RawMessage) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	select {
+	case s.payloads <- payload:
+	case <-s.done:
+	}
+}
+
+// finish ends the operation, it is called once by the goroutine that unregistered it.
+func (s *Subscription) finish(err error) {
+	close(s.done)
+
+	s.mu.Lock()
+	s.finished = true
+	s.err = err
+	close(s.payloads)
+	if s.stop != nil {
+		s.stop()
+	}
+	s.mu.Unlock()
+
+	if s.onFinish != nil {
+		s.onFinish()
+	}
+}
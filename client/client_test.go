@@ -0,0 +1,291 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+)
+
+func newTestServer(t *testing.T, service transport.GraphQLService, ws *transport.Websocket) string {
+	t.Helper()
+	if ws == nil {
+		ws = &transport.Websocket{}
+	}
+	ws.Upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	server := httptest.NewServer(graphqlws.NewHandlerFunc(service, http.NotFoundHandler(), graphqlws.WithWebsocketTransport(ws)))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string, opts ...Option) *Client {
+	t.Helper()
+	c, err := Dial(context.Background(), url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func decodePayload(t *testing.T, raw json.RawMessage) map[string]interface{} {
+	t.Helper()
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &payload))
+	return payload
+}
+
+func next(t *testing.T, s *Subscription) (json.RawMessage, bool) {
+	t.Helper()
+	select {
+	case p, ok := <-s.Payloads():
+		return p, ok
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for payload")
+		return nil, false
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	service := transporttest.NewFakeService()
+	service.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+	c := dial(t, newTestServer(t, service, nil))
+
+	s, err := c.Subscribe(context.Background(), Request{
+		Query:     "subscription($n: Int) { value(n: $n) }",
+		Variables: map[string]interface{}{"n": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, ok := next(t, s)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"value": float64(1)}}, decodePayload(t, payload))
+	assert.Equal(t, "subscription($n: Int) { value(n: $n) }", service.Operations()[0].Query)
+
+	service.CompleteAll()
+	_, ok = next(t, s)
+	assert.False(t, ok)
+	assert.NoError(t, s.Err())
+}
+
+func TestSubscribeReportsErrors(t *testing.T) {
+	service := transporttest.NewFakeService()
+	service.FailWith(errors.New("boom"))
+	c := dial(t, newTestServer(t, service, nil))
+
+	s, err := c.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok := next(t, s)
+	assert.False(t, ok)
+	var errs gqlerror.List
+	if assert.ErrorAs(t, s.Err(), &errs) {
+		assert.Equal(t, "boom", errs[0].Message)
+	}
+}
+
+func TestSubscriptionStops(t *testing.T) {
+	service := transporttest.NewFakeService()
+	c := dial(t, newTestServer(t, service, nil))
+
+	s, err := c.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool { return service.ActiveCount() == 1 }, time.Second, time.Millisecond)
+	assert.NoError(t, s.Close())
+	assert.Eventually(t, func() bool { return service.ActiveCount() == 0 }, time.Second, time.Millisecond)
+	assert.NoError(t, s.Err())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err = c.Subscribe(ctx, Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool { return service.ActiveCount() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	_, ok := next(t, s)
+	assert.False(t, ok)
+	assert.ErrorIs(t, s.Err(), context.Canceled)
+	assert.Eventually(t, func() bool { return service.ActiveCount() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestClose(t *testing.T) {
+	c := dial(t, newTestServer(t, transporttest.NewFakeService(), nil))
+
+	s, err := c.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, c.Close())
+
+	_, ok := next(t, s)
+	assert.False(t, ok)
+	assert.ErrorIs(t, s.Err(), ErrClosed)
+	assert.ErrorIs(t, c.Err(), ErrClosed)
+	<-c.Done()
+
+	_, err = c.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestDialSendsInitPayload(t *testing.T) {
+	ws := &transport.Websocket{
+		InitFunc: func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+			if initPayload.Authorization() != "secret" {
+				return nil, errors.New("unauthorized")
+			}
+			return ctx, nil
+		},
+	}
+	url := newTestServer(t, transporttest.NewFakeService(), ws)
+
+	dial(t, url, WithInitPayload(map[string]interface{}{"Authorization": "secret"}))
+
+	_, err := Dial(context.Background(), url, WithInitPayload(map[string]interface{}{"Authorization": "wrong"}))
+	assert.Error(t, err)
+}
+
+func TestInterceptors(t *testing.T) {
+	service := transporttest.NewFakeService()
+	service.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+
+	var mu sync.Mutex
+	var events []string
+	c := dial(t, newTestServer(t, service, nil),
+		WithOperationInterceptor(func(ctx context.Context, req *Request) error {
+			if req.OperationName == "Forbidden" {
+				return errors.New("forbidden")
+			}
+			req.Query = strings.Replace(req.Query, "value", "value(n: 1)", 1)
+			return nil
+		}),
+		WithEventInterceptor(func(event Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event.ID+":"+event.Type)
+		}),
+	)
+
+	_, err := c.Subscribe(context.Background(), Request{Query: "subscription Forbidden { value }", OperationName: "Forbidden"})
+	assert.EqualError(t, err, "forbidden")
+
+	s, err := c.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(t, s)
+	assert.Equal(t, "subscription { value(n: 1) }", service.Operations()[0].Query)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{":connection_ack", s.ID() + ":next"}, events)
+}
+
+func TestDialFuncs(t *testing.T) {
+	inits := make(chan string, 2)
+	ws := &transport.Websocket{
+		InitFunc: func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+			inits <- initPayload.Authorization()
+			return ctx, nil
+		},
+	}
+	ws.Upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	handler := graphqlws.NewHandlerFunc(transporttest.NewFakeService(), http.NotFoundHandler(), graphqlws.WithWebsocketTransport(ws))
+	headers := make(chan http.Header, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	var token atomic.Int32
+	opts := []Option{
+		WithHeader(http.Header{"X-Static": {"static"}}),
+		WithHeaderFunc(func(ctx context.Context) (http.Header, error) {
+			return http.Header{"X-Token": {strconv.Itoa(int(token.Add(1)))}}, nil
+		}),
+		WithInitPayloadFunc(func(ctx context.Context) (interface{}, error) {
+			return map[string]interface{}{"Authorization": "token " + strconv.Itoa(int(token.Load()))}, nil
+		}),
+	}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	for _, expected := range []string{"1", "2"} {
+		dial(t, url, opts...)
+		header := <-headers
+		assert.Equal(t, "static", header.Get("X-Static"))
+		assert.Equal(t, expected, header.Get("X-Token"))
+		assert.Equal(t, "token "+expected, <-inits)
+	}
+
+	_, err := Dial(context.Background(), url, WithHeaderFunc(func(ctx context.Context) (http.Header, error) {
+		return nil, errors.New("no token")
+	}))
+	assert.EqualError(t, err, "no token")
+}
+
+func TestHeartbeat(t *testing.T) {
+	c := dial(t, newTestServer(t, transporttest.NewFakeService(), nil), WithHeartbeat(300*time.Millisecond, func() {
+		t.Error("unexpected heartbeat timeout")
+	}))
+
+	time.Sleep(time.Second)
+	assert.NoError(t, c.Err())
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{Subprotocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, _ = conn.ReadMessage()
+		_ = conn.WriteJSON(message{Type: "connection_ack"})
+		for { // never answer the pings
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	timedOut := make(chan struct{})
+	c := dial(t, "ws"+strings.TrimPrefix(server.URL, "http"), WithHeartbeat(50*time.Millisecond, func() { close(timedOut) }))
+	s, err := c.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-timedOut:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the heartbeat timeout")
+	}
+	<-c.Done()
+	assert.ErrorIs(t, c.Err(), ErrHeartbeatTimeout)
+	_, ok := next(t, s)
+	assert.False(t, ok)
+	assert.ErrorIs(t, s.Err(), ErrHeartbeatTimeout)
+	assert.False(t, IsFatal(s.Err()))
+}
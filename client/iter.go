@@ -0,0 +1,70 @@
+//go:build go1.23
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Subscriber starts operations, it is implemented by Client and Pool.
+type Subscriber interface {
+	Subscribe(ctx context.Context, req Request) (*Subscription, error)
+}
+
+var (
+	_ Subscriber = &Client{}
+	_ Subscriber = &Pool{}
+)
+
+// Subscribe starts an operation and returns an iterator over the data of its payloads decoded into
+// T. The payloads with errors are yielded with a gqlerror.List along with their partial data, and
+// the operation ending with an error yields it last. The operation is stopped when the loop breaks
+// or ctx is done, the iterator can be ranged over once.
+//
+//	events, err := client.Subscribe[struct{ Messages Message }](ctx, c, "subscription { messages { text } }", nil)
+//	if err != nil {
+//		return err
+//	}
+//	for event, err := range events {
+//		...
+//	}
+func Subscribe[T any](ctx context.Context, s Subscriber, query string, variables map[string]interface{}) (iter.Seq2[T, error], error) {
+	sub, err := s.Subscribe(ctx, Request{Query: query, Variables: variables})
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(T, error) bool) {
+		defer sub.Close()
+		for payload := range sub.Payloads() {
+			data, err := decodeData[T](payload)
+			if !yield(data, err) {
+				return
+			}
+		}
+		if err := sub.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}, nil
+}
+
+func decodeData[T any](payload json.RawMessage) (T, error) {
+	var res struct {
+		Data   *T            `json:"data"`
+		Errors gqlerror.List `json:"errors"`
+	}
+	var data T
+	res.Data = &data
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return data, err
+	}
+	if len(res.Errors) != 0 {
+		return data, res.Errors
+	}
+	return data, nil
+}
@@ -0,0 +1,106 @@
+//go:build go1.23
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// newScriptedServer serves graphql-transport-ws, answering every subscribe message with the next
+// messages then the final message.
+func newScriptedServer(t *testing.T, payloads []string, final message) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{Subprotocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var m message
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			switch m.Type {
+			case "connection_init":
+				_ = conn.WriteJSON(message{Type: "connection_ack"})
+			case "subscribe":
+				for _, payload := range payloads {
+					_ = conn.WriteJSON(message{ID: m.ID, Type: "next", Payload: []byte(payload)})
+				}
+				final.ID = m.ID
+				_ = conn.WriteJSON(final)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+type valueEvent struct {
+	Value int `json:"value"`
+}
+
+func TestSubscribeIterator(t *testing.T) {
+	c := dial(t, newScriptedServer(t, []string{
+		`{"data":{"value":1}}`,
+		`{"data":{"value":2},"errors":[{"message":"partial"}]}`,
+	}, message{Type: "complete"}))
+
+	events, err := Subscribe[valueEvent](context.Background(), c, "subscription { value }", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []int
+	var errs []error
+	for event, err := range events {
+		values = append(values, event.Value)
+		errs = append(errs, err)
+	}
+	assert.Equal(t, []int{1, 2}, values)
+	assert.NoError(t, errs[0])
+	assert.Equal(t, gqlerror.List{{Message: "partial"}}, errs[1])
+}
+
+func TestSubscribeIteratorYieldsErrors(t *testing.T) {
+	c := dial(t, newScriptedServer(t, nil, message{Type: "error", Payload: []byte(`[{"message":"boom"}]`)}))
+
+	events, err := Subscribe[valueEvent](context.Background(), c, "subscription { value }", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var yielded int
+	for event, err := range events {
+		yielded++
+		assert.Zero(t, event)
+		assert.Equal(t, gqlerror.List{{Message: "boom"}}, err)
+	}
+	assert.Equal(t, 1, yielded)
+}
+
+func TestSubscribeIteratorBreakStops(t *testing.T) {
+	c := dial(t, newScriptedServer(t, []string{`{"data":{"value":1}}`, `{"data":{"value":2}}`}, message{Type: "complete"}))
+
+	events, err := Subscribe[valueEvent](context.Background(), c, "subscription { value }", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for event := range events {
+		assert.Equal(t, 1, event.Value)
+		break
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Empty(t, c.subs)
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolExhausted is returned when every connection of a pool runs as many operations as allowed.
+var ErrPoolExhausted = errors.New("client pool exhausted")
+
+// PoolConfig configures a Pool.
+type PoolConfig struct {
+	// MaxConnections is the maximum number of connections of the pool, it defaults to 1.
+	MaxConnections int
+	// MaxOperationsPerConnection is the maximum number of operations run over a connection. A new
+	// connection is dialed when every connection runs as many operations, the operations are not
+	// capped when it is zero.
+	MaxOperationsPerConnection int
+	// IdleTimeout is how long a connection without operations is kept open, the idle connections
+	// are kept until the pool is closed when it is zero.
+	IdleTimeout time.Duration
+}
+
+// Pool spreads the operations over connections to the same server. The connections are dialed when
+// the operations need them, and the operations fill a connection before the next one is used.
+type Pool struct {
+	url  string
+	opts []Option
+	cfg  PoolConfig
+
+	mu     sync.Mutex
+	conns  []*pooledConn
+	closed bool
+}
+
+type pooledConn struct {
+	client *Client
+	active int
+	idle   *time.Timer
+}
+
+// NewPool returns a Pool of connections to the server at url.
+func NewPool(url string, cfg PoolConfig, opts ...Option) *Pool {
+	if cfg.MaxConnections <= 0 {
+		cfg.MaxConnections = 1
+	}
+	return &Pool{url: url, opts: opts, cfg: cfg}
+}
+
+// Subscribe starts an operation over a connection with room for it, a connection is dialed if
+// none has room. It returns ErrPoolExhausted when the pool can't dial more connections.
+func (p *Pool) Subscribe(ctx context.Context, req Request) (*Subscription, error) {
+	pc, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pc.client.subscribe(ctx, req, func() { p.release(pc) })
+}
+
+// acquire reserves room for an operation on a connection.
+func (p *Pool) acquire(ctx context.Context) (*pooledConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+
+	live := p.conns[:0]
+	for _, pc := range p.conns {
+		if pc.client.Err() == nil {
+			live = append(live, pc)
+		} else if pc.idle != nil {
+			pc.idle.Stop()
+		}
+	}
+	clear(p.conns[len(live):])
+	p.conns = live
+
+	for _, pc := range p.conns {
+		if p.cfg.MaxOperationsPerConnection == 0 || pc.active < p.cfg.MaxOperationsPerConnection {
+			pc.reserve()
+			return pc, nil
+		}
+	}
+	if len(p.conns) >= p.cfg.MaxConnections {
+		return nil, ErrPoolExhausted
+	}
+
+	c, err := Dial(ctx, p.url, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	pc := &pooledConn{client: c}
+	p.conns = append(p.conns, pc)
+	pc.reserve()
+	return pc, nil
+}
+
+func (pc *pooledConn) reserve() {
+	pc.active++
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+}
+
+// release frees the room of an operation that ended, the connection is closed once it was idle for
+// IdleTimeout.
+func (p *Pool) release(pc *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc.active--
+	if pc.active > 0 || p.cfg.IdleTimeout <= 0 || p.closed {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(p.cfg.IdleTimeout, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if pc.idle != timer {
+			return
+		}
+		pc.idle = nil
+		for i, conn := range p.conns {
+			if conn == pc {
+				p.conns = append(p.conns[:i], p.conns[i+1:]...)
+				break
+			}
+		}
+		_ = pc.client.Close()
+	})
+	pc.idle = timer
+}
+
+// Len returns the number of open connections of the pool.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+// Close closes the connections of the pool, their operations fail with ErrClosed.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = nil
+	p.closed = true
+	for _, pc := range conns {
+		if pc.idle != nil {
+			pc.idle.Stop()
+			pc.idle = nil
+		}
+	}
+	p.mu.Unlock()
+
+	for _, pc := range conns {
+		_ = pc.client.Close()
+	}
+	return nil
+}
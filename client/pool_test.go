@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+)
+
+func TestPool(t *testing.T) {
+	service := transporttest.NewFakeService()
+	pool := NewPool(newTestServer(t, service, nil), PoolConfig{MaxConnections: 2, MaxOperationsPerConnection: 2})
+	t.Cleanup(func() { _ = pool.Close() })
+	assert.Equal(t, 0, pool.Len())
+
+	var subs []*Subscription
+	for i := 0; i < 4; i++ {
+		s, err := pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, s)
+		assert.Equal(t, i/2+1, pool.Len())
+	}
+	assert.Same(t, subs[0].client, subs[1].client)
+	assert.Same(t, subs[2].client, subs[3].client)
+	assert.NotSame(t, subs[0].client, subs[2].client)
+	assert.Eventually(t, func() bool { return service.ActiveCount() == 4 }, time.Second, time.Millisecond)
+
+	_, err := pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	assert.ErrorIs(t, err, ErrPoolExhausted)
+
+	assert.NoError(t, subs[1].Close())
+	s, err := pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Same(t, subs[0].client, s.client)
+
+	assert.NoError(t, pool.Close())
+	_, ok := next(t, s)
+	assert.False(t, ok)
+	assert.ErrorIs(t, s.Err(), ErrClosed)
+	_, err = pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestPoolReapsIdleConnections(t *testing.T) {
+	service := transporttest.NewFakeService()
+	pool := NewPool(newTestServer(t, service, nil), PoolConfig{IdleTimeout: 20 * time.Millisecond})
+	t.Cleanup(func() { _ = pool.Close() })
+
+	s, err := pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.client
+	assert.NoError(t, s.Close())
+	assert.Eventually(t, func() bool { return pool.Len() == 0 }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, first.Err(), ErrClosed)
+
+	s, err = pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotSame(t, first, s.client)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, pool.Len())
+	assert.NoError(t, s.client.Err())
+}
+
+func TestPoolReplacesClosedConnections(t *testing.T) {
+	pool := NewPool(newTestServer(t, transporttest.NewFakeService(), nil), PoolConfig{})
+	t.Cleanup(func() { _ = pool.Close() })
+
+	s, err := pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.client
+	assert.NoError(t, first.Close())
+
+	s, err = pool.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotSame(t, first, s.client)
+	assert.Equal(t, 1, pool.Len())
+}
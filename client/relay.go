@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+var _ transport.GraphQLService = &RelayService{}
+
+// RelayService is a GraphQLService forwarding the operations to a remote graphql-transport-ws
+// endpoint and sending back its payloads untouched. Served by a transport.Websocket, it turns the
+// package into a subscription proxy translating the protocol of its clients, e.g. legacy graphql-ws
+// clients in front of an upstream only speaking graphql-transport-ws.
+//
+// The operations are forwarded over the connections of a Pool along with their extensions.
+type RelayService struct {
+	pool *Pool
+}
+
+// NewRelayService returns a RelayService forwarding the operations to the server at url over a
+// single connection, it is dialed on the first operation and dialed again once closed.
+func NewRelayService(url string, opts ...Option) *RelayService {
+	return NewPoolRelayService(NewPool(url, PoolConfig{}, opts...))
+}
+
+// NewPoolRelayService returns a RelayService forwarding the operations over the connections of
+// pool.
+func NewPoolRelayService(pool *Pool) *RelayService {
+	return &RelayService{pool: pool}
+}
+
+// Subscribe implements transport.GraphQLService. The errors of the upstream are sent to the
+// client with transport.AddSubscriptionError.
+func (r *RelayService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	sub, err := r.pool.Subscribe(ctx, Request{
+		Query:         document,
+		OperationName: operationName,
+		Variables:     variableValues,
+		Extensions:    transport.GetOperationExtensions(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make(chan interface{})
+	go func() {
+		defer close(payloads)
+		for payload := range sub.Payloads() {
+			select {
+			case payloads <- payload:
+			case <-ctx.Done():
+				_ = sub.Close()
+				return
+			}
+		}
+
+		err := sub.Err()
+		var errs gqlerror.List
+		switch {
+		case err == nil || ctx.Err() != nil:
+		case errors.As(err, &errs):
+			for _, e := range errs {
+				transport.AddSubscriptionError(ctx, e)
+			}
+		default:
+			transport.AddSubscriptionError(ctx, gqlerror.Errorf("upstream: %s", err))
+		}
+	}()
+	return payloads, nil
+}
+
+// Close closes the upstream connections, the active operations fail and the next ones are refused.
+func (r *RelayService) Close() error {
+	return r.pool.Close()
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+)
+
+// dialRelay connects a legacy graphql-ws client to a handler serving relay.
+func dialRelay(t *testing.T, relay transport.GraphQLService) *transporttest.Client {
+	t.Helper()
+	c, err := transporttest.NewClient(graphqlws.NewHandlerFunc(relay, http.NotFoundHandler()), transporttest.WithSubprotocol("graphql-ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	if err := c.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRelayService(t *testing.T) {
+	upstream := transporttest.NewFakeService()
+	upstream.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+	relay := NewRelayService(newTestServer(t, upstream, nil))
+	t.Cleanup(func() { _ = relay.Close() })
+	c := dialRelay(t, relay)
+
+	err := c.Subscribe("1", transporttest.Operation{
+		Query:     "subscription($n: Int) { value(n: $n) }",
+		Variables: map[string]interface{}{"n": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.Expect("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1", m.ID)
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"value": float64(1)}}, decodePayload(t, m.Payload))
+	if ops := upstream.Operations(); assert.Len(t, ops, 1) {
+		assert.Equal(t, "subscription($n: Int) { value(n: $n) }", ops[0].Query)
+		assert.Equal(t, json.Number("2"), ops[0].Variables["n"])
+	}
+
+	upstream.CompleteAll()
+	m, err = c.Expect("complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1", m.ID)
+}
+
+func TestRelayServiceForwardsErrors(t *testing.T) {
+	upstream := transporttest.NewFakeService()
+	upstream.FailWith(errors.New("boom"))
+	relay := NewRelayService(newTestServer(t, upstream, nil))
+	t.Cleanup(func() { _ = relay.Close() })
+	c := dialRelay(t, relay)
+
+	if err := c.Subscribe("1", transporttest.Operation{Query: "subscription { value }"}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.Expect("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(m.Payload), "boom")
+}
+
+func TestRelayServiceStopsUpstream(t *testing.T) {
+	upstream := transporttest.NewFakeService()
+	relay := NewRelayService(newTestServer(t, upstream, nil))
+	t.Cleanup(func() { _ = relay.Close() })
+	c := dialRelay(t, relay)
+
+	if err := c.Subscribe("1", transporttest.Operation{Query: "subscription { value }"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool { return upstream.ActiveCount() == 1 }, time.Second, time.Millisecond)
+	if err := c.Stop("1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool { return upstream.ActiveCount() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestRelayServiceClose(t *testing.T) {
+	relay := NewRelayService(newTestServer(t, transporttest.NewFakeService(), nil))
+	assert.NoError(t, relay.Close())
+	_, err := relay.Subscribe(context.Background(), "subscription { value }", "", nil)
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// fatalCloseCodes are the close codes of graphql-transport-ws reporting a mistake of the client,
+// dialing again would fail the same way.
+var fatalCloseCodes = []int{
+	4400, // bad request
+	4401, // unauthorized
+	4403, // forbidden
+	4406, // subprotocol not acceptable
+	4409, // subscriber already exists
+	4429, // too many initialisation requests
+}
+
+// IsFatal returns true if an operation that ended with err must not be subscribed again: the
+// server sent an error message for the operation, the connection was closed with a close code
+// reporting a mistake of the client such as 4401 Unauthorized, the client was closed or the
+// context was done.
+func IsFatal(err error) bool {
+	var errs gqlerror.List
+	if errors.As(err, &errs) || errors.Is(err, ErrClosed) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var closeErr *websocket.CloseError
+	return errors.As(err, &closeErr) && slices.Contains(fatalCloseCodes, closeErr.Code)
+}
+
+// retryAfter returns the delay before reconnecting asked by the server closing the connection.
+func retryAfter(err error) time.Duration {
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return 0
+	}
+	return transport.ParseCloseReason(closeErr.Code, closeErr.Text).RetryAfter
+}
+
+// RetryPolicy configures how an operation is subscribed again once its connection is lost.
+type RetryPolicy struct {
+	// MaxAttempts is the number of consecutive attempts before the operation fails, the attempts
+	// are not limited when it is zero. The attempts are reset once a payload is received.
+	MaxAttempts int
+	// MinBackoff is the delay before the first attempt, it defaults to 100ms. It doubles with
+	// every attempt and is jittered.
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, it defaults to 30s. A longer delay asked by the
+	// server with the retry-after of its close reason is honoured.
+	MaxBackoff time.Duration
+	// Fatal returns true if the operation must fail with err instead of being subscribed again, it
+	// defaults to IsFatal.
+	Fatal func(err error) bool
+	// OnRetry is called before an attempt with the error ending the previous one.
+	OnRetry func(attempt int, err error)
+	// Resume configures how the operation resumes from its cursor when it is subscribed again.
+	Resume ResumeConfig
+}
+
+const defaultResumeExtension = "resumeFrom"
+
+// ResumeConfig configures how an operation subscribed again resumes where it left off, when the
+// server supports it. The cursor of the operation is declared with RetryingSubscription.ResumeFrom
+// or extracted from the payloads by Cursor, and injected into the variables or the extensions of
+// the operation when it is subscribed again.
+type ResumeConfig struct {
+	// Variable is the variable set to the cursor, the cursor is sent as an extension when it is
+	// empty.
+	Variable string
+	// Extension is the extension set to the cursor when Variable is empty, it defaults to
+	// "resumeFrom".
+	Extension string
+	// Cursor extracts the cursor of a payload once it was received, the payloads without a cursor
+	// return false.
+	Cursor func(payload json.RawMessage) (cursor interface{}, ok bool)
+}
+
+// inject returns req resuming from cursor.
+func (c ResumeConfig) inject(req Request, cursor interface{}) Request {
+	if c.Variable != "" {
+		req.Variables = maps.Clone(req.Variables)
+		if req.Variables == nil {
+			req.Variables = map[string]interface{}{}
+		}
+		req.Variables[c.Variable] = cursor
+		return req
+	}
+
+	name := c.Extension
+	if name == "" {
+		name = defaultResumeExtension
+	}
+	req.Extensions = maps.Clone(req.Extensions)
+	if req.Extensions == nil {
+		req.Extensions = map[string]interface{}{}
+	}
+	req.Extensions[name] = cursor
+	return req
+}
+
+func (p RetryPolicy) fatal(err error) bool {
+	if p.Fatal != nil {
+		return p.Fatal(err)
+	}
+	return IsFatal(err)
+}
+
+// backoff returns the jittered delay before an attempt, attempts start at 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	d := minBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// RetryingSubscription is an operation subscribed again following a RetryPolicy when it ends
+// with an error that isn't fatal.
+type RetryingSubscription struct {
+	s        Subscriber
+	req      Request
+	policy   RetryPolicy
+	payloads chan json.RawMessage
+	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	cursor interface{}
+	closed bool
+	err    error
+}
+
+// SubscribeWithRetry starts an operation with s and subscribes it again when it ends with an error
+// that isn't fatal. The subscriber must dial again the connections that are lost, like Pool and
+// RelayService do. The operation is stopped when ctx is done.
+func SubscribeWithRetry(ctx context.Context, s Subscriber, req Request, policy RetryPolicy) *RetryingSubscription {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &RetryingSubscription{
+		s:        s,
+		req:      req,
+		policy:   policy,
+		payloads: make(chan json.RawMessage),
+		cancel:   cancel,
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Payloads returns the payloads of the operation, the channel is closed when the operation ends.
+func (r *RetryingSubscription) Payloads() <-chan json.RawMessage {
+	return r.payloads
+}
+
+// Err returns why the operation ended once Payloads is closed. It is nil when the server completed
+// the operation or it was closed.
+func (r *RetryingSubscription) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ResumeFrom declares the cursor the operation resumes from when it is subscribed again, see
+// ResumeConfig.
+func (r *RetryingSubscription) ResumeFrom(cursor interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cursor = cursor
+}
+
+// Close stops the operation.
+func (r *RetryingSubscription) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.cancel()
+	return nil
+}
+
+func (r *RetryingSubscription) run(ctx context.Context) {
+	defer r.cancel()
+
+	var attempt int
+	for {
+		err := r.subscribe(ctx, &attempt)
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err == nil || r.policy.fatal(err) || (r.policy.MaxAttempts > 0 && attempt >= r.policy.MaxAttempts) {
+			r.finish(err)
+			return
+		}
+
+		attempt++
+		if r.policy.OnRetry != nil {
+			r.policy.OnRetry(attempt, err)
+		}
+		timer := time.NewTimer(max(r.policy.backoff(attempt), retryAfter(err)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			r.finish(ctx.Err())
+			return
+		}
+	}
+}
+
+// subscribe runs the operation once, it returns why it ended.
+func (r *RetryingSubscription) subscribe(ctx context.Context, attempt *int) error {
+	req := r.req
+	r.mu.Lock()
+	if r.cursor != nil {
+		req = r.policy.Resume.inject(req, r.cursor)
+	}
+	r.mu.Unlock()
+
+	sub, err := r.s.Subscribe(ctx, req)
+	if err != nil {
+		return err
+	}
+	for payload := range sub.Payloads() {
+		select {
+		case r.payloads <- payload:
+			*attempt = 0
+			if r.policy.Resume.Cursor != nil {
+				if cursor, ok := r.policy.Resume.Cursor(payload); ok {
+					r.ResumeFrom(cursor)
+				}
+			}
+		case <-ctx.Done():
+			_ = sub.Close()
+			return ctx.Err()
+		}
+	}
+	return sub.Err()
+}
+
+func (r *RetryingSubscription) finish(err error) {
+	r.mu.Lock()
+	if r.closed {
+		err = nil
+	}
+	r.err = err
+	r.mu.Unlock()
+	close(r.payloads)
+}
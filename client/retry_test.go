@@ -0,0 +1,217 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// newFlakyServer serves graphql-transport-ws, the nth connection sends a payload to the first
+// operation then is closed with closeCodes[n]. The connections after the last close code complete
+// the operations after a payload. The operations are sent to requests unless it is nil.
+func newFlakyServer(t *testing.T, requests chan<- Request, closeCodes ...int) string {
+	t.Helper()
+	var conns atomic.Int32
+	upgrader := websocket.Upgrader{Subprotocols: []string{Subprotocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := int(conns.Add(1)) - 1
+		for {
+			var m message
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			switch m.Type {
+			case "connection_init":
+				_ = conn.WriteJSON(message{Type: "connection_ack"})
+			case "subscribe":
+				if requests != nil {
+					var req Request
+					_ = json.Unmarshal(m.Payload, &req)
+					requests <- req
+				}
+				_ = conn.WriteJSON(message{ID: m.ID, Type: "next", Payload: []byte(fmt.Sprintf(`{"data":{"value":%d}}`, n))})
+				if n < len(closeCodes) {
+					_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCodes[n], ""))
+					return
+				}
+				_ = conn.WriteJSON(message{ID: m.ID, Type: "complete"})
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func collect(t *testing.T, r *RetryingSubscription) []string {
+	t.Helper()
+	var payloads []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p, ok := <-r.Payloads():
+			if !ok {
+				return payloads
+			}
+			payloads = append(payloads, string(p))
+		case <-timeout:
+			t.Fatal("timed out waiting for the operation to end")
+		}
+	}
+}
+
+func TestIsFatal(t *testing.T) {
+	for _, tc := range []struct {
+		err   error
+		fatal bool
+	}{
+		{gqlerror.List{{Message: "boom"}}, true},
+		{ErrClosed, true},
+		{context.Canceled, true},
+		{&websocket.CloseError{Code: 4401}, true},
+		{fmt.Errorf("wrapped: %w", &websocket.CloseError{Code: 4403}), true},
+		{&websocket.CloseError{Code: websocket.CloseServiceRestart}, false},
+		{&websocket.CloseError{Code: 4500}, false},
+		{io.ErrUnexpectedEOF, false},
+	} {
+		assert.Equal(t, tc.fatal, IsFatal(tc.err), "%v", tc.err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		d := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, d, max/2)
+		assert.LessOrEqual(t, d, max)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryAfter(fmt.Errorf("wrapped: %w", &websocket.CloseError{Code: websocket.CloseTryAgainLater, Text: "maintenance; retry-after=5"})))
+	assert.Equal(t, time.Duration(0), retryAfter(&websocket.CloseError{Code: websocket.CloseTryAgainLater, Text: "maintenance"}))
+	assert.Equal(t, time.Duration(0), retryAfter(io.ErrUnexpectedEOF))
+}
+
+func TestSubscribeWithRetry(t *testing.T) {
+	pool := NewPool(newFlakyServer(t, nil, websocket.CloseServiceRestart, websocket.CloseTryAgainLater), PoolConfig{})
+	t.Cleanup(func() { _ = pool.Close() })
+
+	var retries []int
+	r := SubscribeWithRetry(context.Background(), pool, Request{Query: "subscription { value }"}, RetryPolicy{
+		MinBackoff: time.Millisecond,
+		OnRetry: func(attempt int, err error) {
+			retries = append(retries, attempt)
+			assert.Error(t, err)
+		},
+	})
+
+	assert.Equal(t, []string{`{"data":{"value":0}}`, `{"data":{"value":1}}`, `{"data":{"value":2}}`}, collect(t, r))
+	assert.NoError(t, r.Err())
+	assert.Equal(t, []int{1, 1}, retries)
+}
+
+func TestSubscribeWithRetryFatalCloseCode(t *testing.T) {
+	pool := NewPool(newFlakyServer(t, nil, 4401), PoolConfig{})
+	t.Cleanup(func() { _ = pool.Close() })
+
+	r := SubscribeWithRetry(context.Background(), pool, Request{Query: "subscription { value }"}, RetryPolicy{
+		MinBackoff: time.Millisecond,
+		OnRetry:    func(attempt int, err error) { t.Errorf("unexpected retry after %v", err) },
+	})
+
+	assert.Len(t, collect(t, r), 1)
+	assert.True(t, websocket.IsCloseError(r.Err(), 4401))
+}
+
+func TestSubscribeWithRetryMaxAttempts(t *testing.T) {
+	boom := errors.New("boom")
+	var attempts int
+	s := subscriberFunc(func(ctx context.Context, req Request) (*Subscription, error) {
+		attempts++
+		return nil, boom
+	})
+
+	r := SubscribeWithRetry(context.Background(), s, Request{}, RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond})
+	assert.Empty(t, collect(t, r))
+	assert.ErrorIs(t, r.Err(), boom)
+	assert.Equal(t, 4, attempts)
+}
+
+func TestSubscribeWithRetryClose(t *testing.T) {
+	s := subscriberFunc(func(ctx context.Context, req Request) (*Subscription, error) {
+		return nil, errors.New("boom")
+	})
+
+	r := SubscribeWithRetry(context.Background(), s, Request{}, RetryPolicy{MinBackoff: time.Hour})
+	assert.NoError(t, r.Close())
+	assert.Empty(t, collect(t, r))
+	assert.NoError(t, r.Err())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r = SubscribeWithRetry(ctx, s, Request{}, RetryPolicy{MinBackoff: time.Hour})
+	cancel()
+	assert.Empty(t, collect(t, r))
+	assert.ErrorIs(t, r.Err(), context.Canceled)
+}
+
+func TestSubscribeWithRetryResumes(t *testing.T) {
+	requests := make(chan Request, 3)
+	pool := NewPool(newFlakyServer(t, requests, websocket.CloseServiceRestart, websocket.CloseServiceRestart), PoolConfig{})
+	t.Cleanup(func() { _ = pool.Close() })
+
+	r := SubscribeWithRetry(context.Background(), pool, Request{Query: "subscription($after: Int) { value(after: $after) }"}, RetryPolicy{
+		MinBackoff: time.Millisecond,
+		Resume: ResumeConfig{
+			Variable: "after",
+			Cursor: func(payload json.RawMessage) (interface{}, bool) {
+				var res struct{ Data struct{ Value int } }
+				return res.Data.Value * 10, json.Unmarshal(payload, &res) == nil
+			},
+		},
+	})
+	assert.Len(t, collect(t, r), 3)
+
+	assert.Nil(t, (<-requests).Variables)
+	assert.Equal(t, map[string]interface{}{"after": float64(0)}, (<-requests).Variables)
+	assert.Equal(t, map[string]interface{}{"after": float64(10)}, (<-requests).Variables)
+}
+
+func TestSubscribeWithRetryResumeFromExtension(t *testing.T) {
+	requests := make(chan Request, 2)
+	pool := NewPool(newFlakyServer(t, requests, websocket.CloseServiceRestart), PoolConfig{})
+	t.Cleanup(func() { _ = pool.Close() })
+
+	r := SubscribeWithRetry(context.Background(), pool, Request{
+		Query:      "subscription { value }",
+		Extensions: map[string]interface{}{"trace": true},
+	}, RetryPolicy{MinBackoff: 100 * time.Millisecond})
+	<-r.Payloads()
+	r.ResumeFrom("cursor-1")
+	assert.Len(t, collect(t, r), 1)
+
+	assert.Equal(t, map[string]interface{}{"trace": true}, (<-requests).Extensions)
+	assert.Equal(t, map[string]interface{}{"trace": true, "resumeFrom": "cursor-1"}, (<-requests).Extensions)
+}
+
+type subscriberFunc func(ctx context.Context, req Request) (*Subscription, error)
+
+func (f subscriberFunc) Subscribe(ctx context.Context, req Request) (*Subscription, error) {
+	return f(ctx, req)
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+var _ transport.GraphQLService = &Router{}
+
+// Upstream is a remote graphql-transport-ws endpoint operations are routed to.
+type Upstream struct {
+	// URL is the address of the endpoint.
+	URL string
+	// Options configure the connections to the endpoint.
+	Options []Option
+	// Connections is the number of connections the operations routed to the upstream are spread
+	// over, it defaults to 1.
+	Connections int
+	// HealthCheckInterval is how often a connection to the upstream is dialed to check it is
+	// healthy. The operations routed to an unhealthy upstream are refused until a check passes,
+	// the upstreams are not checked when it is zero.
+	HealthCheckInterval time.Duration
+}
+
+// RouteFunc returns the name of the upstream an operation is forwarded to.
+type RouteFunc func(ctx context.Context, req Request) (string, error)
+
+// RouteByOperationName routes the operations by name, the other operations are routed to fallback.
+// They are refused if fallback is empty.
+func RouteByOperationName(routes map[string]string, fallback string) RouteFunc {
+	return func(ctx context.Context, req Request) (string, error) {
+		if name, ok := routes[req.OperationName]; ok {
+			return name, nil
+		}
+		if fallback == "" {
+			return "", fmt.Errorf("no upstream serves the operation %q", req.OperationName)
+		}
+		return fallback, nil
+	}
+}
+
+// Router is a GraphQLService stitching the subscriptions of many upstreams: every operation is
+// relayed to the upstream chosen by its RouteFunc.
+type Router struct {
+	route     RouteFunc
+	upstreams map[string]*upstream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type upstream struct {
+	relays  []*RelayService
+	next    atomic.Uint64
+	healthy atomic.Bool
+}
+
+// NewRouter returns a Router relaying the operations to the upstreams by name. The health checks of
+// the upstreams run until the router is closed.
+func NewRouter(route RouteFunc, upstreams map[string]Upstream) *Router {
+	r := &Router{
+		route:     route,
+		upstreams: make(map[string]*upstream, len(upstreams)),
+		done:      make(chan struct{}),
+	}
+	for name, cfg := range upstreams {
+		u := &upstream{relays: make([]*RelayService, max(cfg.Connections, 1))}
+		for i := range u.relays {
+			u.relays[i] = NewRelayService(cfg.URL, cfg.Options...)
+		}
+		u.healthy.Store(true)
+		r.upstreams[name] = u
+		if cfg.HealthCheckInterval > 0 {
+			go r.checkHealth(u, cfg)
+		}
+	}
+	return r
+}
+
+// Subscribe implements transport.GraphQLService
+func (r *Router) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	name, err := r.route(ctx, Request{
+		Query:         document,
+		OperationName: operationName,
+		Variables:     variableValues,
+		Extensions:    transport.GetOperationExtensions(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	u, ok := r.upstreams[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown upstream %s", name)
+	}
+	if !u.healthy.Load() {
+		return nil, fmt.Errorf("upstream %s is unhealthy", name)
+	}
+
+	relay := u.relays[u.next.Add(1)%uint64(len(u.relays))]
+	return relay.Subscribe(ctx, document, operationName, variableValues)
+}
+
+// Healthy returns whether the last health check of an upstream passed, the upstreams are healthy
+// until checked.
+func (r *Router) Healthy(name string) bool {
+	u, ok := r.upstreams[name]
+	return ok && u.healthy.Load()
+}
+
+// Close closes the connections to the upstreams and stops their health checks.
+func (r *Router) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	for _, u := range r.upstreams {
+		for _, relay := range u.relays {
+			_ = relay.Close()
+		}
+	}
+	return nil
+}
+
+func (r *Router) checkHealth(u *upstream, cfg Upstream) {
+	ticker := time.NewTicker(cfg.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.HealthCheckInterval)
+		c, err := Dial(ctx, cfg.URL, cfg.Options...)
+		cancel()
+		if err == nil {
+			_ = c.Close()
+		}
+		u.healthy.Store(err == nil)
+	}
+}
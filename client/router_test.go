@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+)
+
+func TestRouteByOperationName(t *testing.T) {
+	route := RouteByOperationName(map[string]string{"Chat": "chat"}, "")
+
+	name, err := route(context.Background(), Request{OperationName: "Chat"})
+	assert.NoError(t, err)
+	assert.Equal(t, "chat", name)
+
+	_, err = route(context.Background(), Request{OperationName: "Prices"})
+	assert.EqualError(t, err, `no upstream serves the operation "Prices"`)
+
+	name, err = RouteByOperationName(nil, "default")(context.Background(), Request{OperationName: "Prices"})
+	assert.NoError(t, err)
+	assert.Equal(t, "default", name)
+}
+
+func TestRouter(t *testing.T) {
+	chat, prices := transporttest.NewFakeService(), transporttest.NewFakeService()
+	router := NewRouter(RouteByOperationName(map[string]string{"Chat": "chat"}, "prices"), map[string]Upstream{
+		"chat":   {URL: newTestServer(t, chat, nil), Connections: 2},
+		"prices": {URL: newTestServer(t, prices, nil)},
+	})
+	t.Cleanup(func() { _ = router.Close() })
+	c := dialRelay(t, router)
+
+	for _, id := range []string{"1", "2", "3"} {
+		assert.NoError(t, c.Subscribe(id, transporttest.Operation{Query: "subscription Chat { messages }", OperationName: "Chat"}))
+	}
+	assert.NoError(t, c.Subscribe("4", transporttest.Operation{Query: "subscription Prices { prices }", OperationName: "Prices"}))
+	assert.Eventually(t, func() bool { return chat.ActiveCount() == 3 && prices.ActiveCount() == 1 }, time.Second, time.Millisecond)
+
+	var dialed int
+	for _, relay := range router.upstreams["chat"].relays {
+		dialed += relay.pool.Len()
+	}
+	assert.Equal(t, 2, dialed)
+
+	assert.NoError(t, c.Subscribe("5", transporttest.Operation{Query: "subscription { value }"}))
+	assert.Eventually(t, func() bool { return prices.ActiveCount() == 2 }, time.Second, time.Millisecond)
+}
+
+func TestRouterHealthChecks(t *testing.T) {
+	var down atomic.Bool
+	handler := graphqlws.NewHandlerFunc(transporttest.NewFakeService(), http.NotFoundHandler())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	router := NewRouter(RouteByOperationName(nil, "main"), map[string]Upstream{
+		"main": {URL: "ws" + strings.TrimPrefix(server.URL, "http"), HealthCheckInterval: 10 * time.Millisecond},
+	})
+	t.Cleanup(func() { _ = router.Close() })
+	assert.True(t, router.Healthy("main"))
+	assert.False(t, router.Healthy("unknown"))
+
+	down.Store(true)
+	assert.Eventually(t, func() bool { return !router.Healthy("main") }, time.Second, time.Millisecond)
+	_, err := router.Subscribe(context.Background(), "subscription { value }", "", nil)
+	assert.EqualError(t, err, "upstream main is unhealthy")
+
+	down.Store(false)
+	assert.Eventually(t, func() bool { return router.Healthy("main") }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,17 @@
+package client
+
+import "time"
+
+// socket is the websocket connection of a Client. It is implemented with gorilla/websocket, and
+// with the WebSocket API of the browsers when the client is built for js/wasm.
+type socket interface {
+	// ReadMessage returns the next text message. Close frames are returned as
+	// *websocket.CloseError and read deadlines as errors whose Timeout method returns true.
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends a text message.
+	WriteMessage(data []byte) error
+	// WriteClose sends a close frame.
+	WriteClose(code int, reason string) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
@@ -0,0 +1,57 @@
+//go:build !(js && wasm)
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type socketConfig struct {
+	dialer *websocket.Dialer
+}
+
+func defaultSocketConfig() socketConfig {
+	return socketConfig{dialer: websocket.DefaultDialer}
+}
+
+// WithDialer sets the dialer of the connection, it defaults to websocket.DefaultDialer.
+func WithDialer(dialer *websocket.Dialer) Option {
+	return func(cfg *config) {
+		cfg.dialer = dialer
+	}
+}
+
+type gorillaSocket struct {
+	*websocket.Conn
+}
+
+func dialSocket(ctx context.Context, url string, header http.Header, cfg socketConfig) (socket, error) {
+	dialer := *cfg.dialer
+	dialer.Subprotocols = []string{Subprotocol}
+	conn, _, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	return gorillaSocket{conn}, nil
+}
+
+func (s gorillaSocket) ReadMessage() ([]byte, error) {
+	for {
+		typ, b, err := s.Conn.ReadMessage()
+		if err != nil || typ == websocket.TextMessage {
+			return b, err
+		}
+	}
+}
+
+func (s gorillaSocket) WriteMessage(data []byte) error {
+	return s.Conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (s gorillaSocket) WriteClose(code int, reason string) error {
+	return s.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
@@ -0,0 +1,159 @@
+//go:build js && wasm
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type socketConfig struct{}
+
+func defaultSocketConfig() socketConfig {
+	return socketConfig{}
+}
+
+// jsSocket is a connection opened with the WebSocket API of the browser. The messages are queued
+// by the event handlers of the WebSocket, they must not block the event loop of the browser.
+type jsSocket struct {
+	ws       js.Value
+	handlers map[string]js.Func
+
+	mu       sync.Mutex
+	queue    [][]byte
+	notify   chan struct{}
+	closed   chan struct{}
+	closeErr error
+	deadline time.Time
+}
+
+func dialSocket(ctx context.Context, url string, header http.Header, cfg socketConfig) (socket, error) {
+	s := &jsSocket{
+		ws:       js.Global().Get("WebSocket").New(url, []interface{}{Subprotocol}),
+		handlers: map[string]js.Func{},
+		notify:   make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	opened := make(chan struct{})
+	s.on("open", func(event js.Value) {
+		close(opened)
+	})
+	s.on("message", func(event js.Value) {
+		data := event.Get("data")
+		if data.Type() != js.TypeString {
+			return
+		}
+		s.mu.Lock()
+		s.queue = append(s.queue, []byte(data.String()))
+		s.mu.Unlock()
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	})
+	s.on("close", func(event js.Value) {
+		s.mu.Lock()
+		s.closeErr = &websocket.CloseError{Code: event.Get("code").Int(), Text: event.Get("reason").String()}
+		s.mu.Unlock()
+		close(s.closed)
+		for event, fn := range s.handlers {
+			s.ws.Call("removeEventListener", event, fn)
+			fn.Release()
+		}
+	})
+
+	select {
+	case <-opened:
+		if protocol := s.ws.Get("protocol").String(); protocol != Subprotocol {
+			_ = s.Close()
+			return nil, errors.New("websocket: the server didn't accept the " + Subprotocol + " subprotocol")
+		}
+		return s, nil
+	case <-s.closed:
+		return nil, s.closeErr
+	case <-ctx.Done():
+		_ = s.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// on sets the handler of an event of the WebSocket, the handlers are removed once it is closed.
+func (s *jsSocket) on(event string, handler func(event js.Value)) {
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		handler(args[0])
+		return nil
+	})
+	s.handlers[event] = fn
+	s.ws.Call("addEventListener", event, fn)
+}
+
+func (s *jsSocket) ReadMessage() ([]byte, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) != 0 {
+			b := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return b, nil
+		}
+		deadline, closeErr := s.deadline, s.closeErr
+		s.mu.Unlock()
+		if closeErr != nil {
+			return nil, closeErr
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		select {
+		case <-s.notify:
+		case <-s.closed:
+		case <-timeout:
+			return nil, os.ErrDeadlineExceeded
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (s *jsSocket) WriteMessage(data []byte) error {
+	select {
+	case <-s.closed:
+		return s.closeErr
+	default:
+	}
+	if s.ws.Get("readyState").Int() != 1 { // OPEN
+		return websocket.ErrCloseSent
+	}
+	s.ws.Call("send", string(data))
+	return nil
+}
+
+func (s *jsSocket) WriteClose(code int, reason string) error {
+	s.ws.Call("close", code, reason)
+	return nil
+}
+
+func (s *jsSocket) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	return nil
+}
+
+func (s *jsSocket) Close() error {
+	s.ws.Call("close")
+	return nil
+}
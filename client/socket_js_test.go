@@ -0,0 +1,87 @@
+//go:build js && wasm
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"syscall/js"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWebSocket replaces the WebSocket API with a server acknowledging the connections, answering
+// every operation with a payload and a complete message, and closing the connections with 4403
+// when the url is ws://forbidden.
+const fakeWebSocket = `globalThis.WebSocket = class {
+	constructor(url, protocols) {
+		this.url = url;
+		this.protocol = protocols[0];
+		this.readyState = 0;
+		this.listeners = {};
+		setTimeout(() => {
+			if (url === "ws://forbidden") {
+				this.close(4403, "Forbidden");
+				return;
+			}
+			this.readyState = 1;
+			this.emit("open", {});
+		});
+	}
+	addEventListener(type, listener) {
+		(this.listeners[type] = this.listeners[type] || []).push(listener);
+	}
+	removeEventListener(type, listener) {
+		this.listeners[type] = (this.listeners[type] || []).filter((l) => l !== listener);
+	}
+	emit(type, event) {
+		(this.listeners[type] || []).forEach((listener) => listener(event));
+	}
+	reply(message) {
+		setTimeout(() => this.emit("message", { data: JSON.stringify(message) }));
+	}
+	send(data) {
+		const message = JSON.parse(data);
+		switch (message.type) {
+		case "connection_init":
+			this.reply({ type: "connection_ack" });
+			break;
+		case "subscribe":
+			this.reply({ id: message.id, type: "next", payload: { data: { query: message.payload.query } } });
+			this.reply({ id: message.id, type: "complete" });
+			break;
+		}
+	}
+	close(code, reason) {
+		this.readyState = 3;
+		setTimeout(() => this.emit("close", { code: code || 1005, reason: reason || "" }));
+	}
+}`
+
+func TestJSSocket(t *testing.T) {
+	js.Global().Call("eval", fakeWebSocket)
+
+	c, err := Dial(context.Background(), "ws://server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s, err := c.Subscribe(context.Background(), Request{Query: "subscription { value }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, ok := <-s.Payloads()
+	assert.True(t, ok)
+	var res struct{ Data struct{ Query string } }
+	assert.NoError(t, json.Unmarshal(payload, &res))
+	assert.Equal(t, "subscription { value }", res.Data.Query)
+	_, ok = <-s.Payloads()
+	assert.False(t, ok)
+	assert.NoError(t, s.Err())
+
+	_, err = Dial(context.Background(), "ws://forbidden")
+	assert.True(t, websocket.IsCloseError(err, 4403))
+}
@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/redis"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+const (
+	defaultMaxBufferedEvents = 100
+	defaultBufferTTL         = 10 * time.Minute
+)
+
+// RedisEventBuffer is a transport.EventBuffer storing the events of every resumption token in a
+// Redis stream, so a client can resume its subscriptions on any node.
+type RedisEventBuffer struct {
+	client redis.Client
+	prefix string
+
+	// MaxEvents is the approximate number of events kept per token, it defaults to 100
+	MaxEvents int
+	// TTL is how long the events and owner of a token are kept after the last write, it defaults
+	// to 10 minutes
+	TTL time.Duration
+}
+
+var _ transport.EventBuffer = &RedisEventBuffer{}
+
+// NewRedisEventBuffer returns a buffer whose keys are prefixed with prefix, it defaults to
+// "graphqlws:".
+func NewRedisEventBuffer(client redis.Client, prefix string) *RedisEventBuffer {
+	if prefix == "" {
+		prefix = "graphqlws:"
+	}
+	return &RedisEventBuffer{client: client, prefix: prefix}
+}
+
+func (b *RedisEventBuffer) eventsKey(token string) string {
+	return b.prefix + "events:" + token
+}
+
+func (b *RedisEventBuffer) ownerKey(token string) string {
+	return b.prefix + "owner:" + token
+}
+
+func (b *RedisEventBuffer) maxEvents() int {
+	if b.MaxEvents == 0 {
+		return defaultMaxBufferedEvents
+	}
+	return b.MaxEvents
+}
+
+func (b *RedisEventBuffer) ttl() time.Duration {
+	if b.TTL == 0 {
+		return defaultBufferTTL
+	}
+	return b.TTL
+}
+
+// Append implements transport.EventBuffer
+func (b *RedisEventBuffer) Append(ctx context.Context, token string, payload json.RawMessage) (string, error) {
+	key := b.eventsKey(token)
+	id, err := redis.String(b.client.Do(ctx, "XADD", key, "MAXLEN", "~", b.maxEvents(), "*", "payload", []byte(payload)))
+	if err != nil {
+		return "", err
+	}
+
+	// the owner is kept as long as the events, it was only given a TTL when claimed
+	if _, err := b.client.Do(ctx, "PEXPIRE", key, b.ttl().Milliseconds()); err != nil {
+		return "", err
+	}
+	if _, err := b.client.Do(ctx, "PEXPIRE", b.ownerKey(token), b.ttl().Milliseconds()); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// After implements transport.EventBuffer
+func (b *RedisEventBuffer) After(ctx context.Context, token string, id string) ([]transport.BufferedEvent, error) {
+	start := "-"
+	if id != "" {
+		start = "(" + id
+	}
+
+	entries, err := redis.Values(b.client.Do(ctx, "XRANGE", b.eventsKey(token), start, "+"))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]transport.BufferedEvent, 0, len(entries))
+	for _, entry := range entries {
+		event, err := decodeStreamEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Claim implements transport.EventBuffer
+func (b *RedisEventBuffer) Claim(ctx context.Context, token string, owner string) error {
+	_, err := b.client.Do(ctx, "SET", b.ownerKey(token), owner, "PX", b.ttl().Milliseconds())
+	return err
+}
+
+// Owner implements transport.EventBuffer
+func (b *RedisEventBuffer) Owner(ctx context.Context, token string) (string, error) {
+	owner, err := redis.String(b.client.Do(ctx, "GET", b.ownerKey(token)))
+	if errors.Is(err, redis.ErrNil) {
+		return "", nil
+	}
+	return owner, err
+}
+
+// decodeStreamEntry decodes an entry returned by XRANGE, [id, [field, value, ...]].
+func decodeStreamEntry(entry interface{}) (transport.BufferedEvent, error) {
+	parts, ok := entry.([]interface{})
+	if !ok || len(parts) != 2 {
+		return transport.BufferedEvent{}, fmt.Errorf("cluster: unexpected stream entry %v", entry)
+	}
+	id, _ := redis.String(parts[0], nil)
+	fields, err := redis.Strings(parts[1], nil)
+	if err != nil {
+		return transport.BufferedEvent{}, err
+	}
+
+	event := transport.BufferedEvent{ID: id}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "payload" {
+			event.Payload = json.RawMessage(fields[i+1])
+		}
+	}
+	return event, nil
+}
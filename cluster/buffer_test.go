@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/redis/redistest"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEventBuffer(t *testing.T) (*RedisEventBuffer, *redistest.Client) {
+	client := redistest.NewClient()
+	return NewRedisEventBuffer(client, "test:"), client
+}
+
+func TestRedisEventBuffer(t *testing.T) {
+	ctx := context.Background()
+	buffer, _ := newTestEventBuffer(t)
+	buffer.MaxEvents = 2
+
+	var ids []string
+	for _, payload := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		id, err := buffer.Append(ctx, "tok", json.RawMessage(payload))
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	events, err := buffer.After(ctx, "tok", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []transport.BufferedEvent{
+		{ID: ids[1], Payload: json.RawMessage(`{"n":2}`)},
+		{ID: ids[2], Payload: json.RawMessage(`{"n":3}`)},
+	}, events)
+
+	events, err = buffer.After(ctx, "tok", ids[1])
+	assert.NoError(t, err)
+	assert.Equal(t, []transport.BufferedEvent{{ID: ids[2], Payload: json.RawMessage(`{"n":3}`)}}, events)
+
+	owner, err := buffer.Owner(ctx, "tok")
+	assert.NoError(t, err)
+	assert.Empty(t, owner)
+	assert.NoError(t, buffer.Claim(ctx, "tok", "node-a"))
+	owner, err = buffer.Owner(ctx, "tok")
+	assert.NoError(t, err)
+	assert.Equal(t, "node-a", owner)
+}
+
+func TestRedisEventBufferAppendRefreshesOwner(t *testing.T) {
+	ctx := context.Background()
+	buffer, server := newTestEventBuffer(t)
+	buffer.TTL = time.Minute
+
+	assert.NoError(t, buffer.Claim(ctx, "tok", "node-a"))
+	for _, payload := range []string{`{"n":1}`, `{"n":2}`} {
+		server.FastForward(50 * time.Second)
+		_, err := buffer.Append(ctx, "tok", json.RawMessage(payload))
+		assert.NoError(t, err)
+	}
+	server.FastForward(50 * time.Second)
+
+	owner, err := buffer.Owner(ctx, "tok")
+	assert.NoError(t, err)
+	assert.Equal(t, "node-a", owner)
+	events, err := buffer.After(ctx, "tok", "")
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func newResumableHandler(buffer transport.EventBuffer, svc *transporttest.FakeService) http.Handler {
+	ws := &transport.Websocket{
+		Upgrader: transport.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		Resumption: &transport.Resumption{Buffer: buffer, Window: time.Second, AllowAnonymous: true},
+	}
+	return graphqlws.NewHandlerFunc(svc, http.NotFoundHandler(), graphqlws.WithWebsocketTransport(ws))
+}
+
+func subscribeWithToken(t *testing.T, handler http.Handler, resumption map[string]string) *transporttest.Client {
+	c, err := transporttest.NewClient(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	assert.NoError(t, c.Init(nil))
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":      "subscription { n }",
+		"extensions": map[string]interface{}{"resumption": resumption},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, c.Send(transporttest.Message{Type: "subscribe", ID: "1", Payload: payload}))
+	return c
+}
+
+func readResumptionEvent(t *testing.T, c *transporttest.Client) (string, json.RawMessage) {
+	m, err := c.Expect("next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := []byte(m.Payload)
+	var payload struct {
+		Data       json.RawMessage `json:"data"`
+		Extensions struct {
+			Resumption struct {
+				EventID string `json:"eventId"`
+			} `json:"resumption"`
+		} `json:"extensions"`
+	}
+	assert.NoError(t, json.Unmarshal(raw, &payload))
+	return payload.Extensions.Resumption.EventID, payload.Data
+}
+
+func TestResumptionOnAnotherNode(t *testing.T) {
+	buffer, _ := newTestEventBuffer(t)
+	svcA, svcB := transporttest.NewFakeService(), transporttest.NewFakeService()
+	nodeA, nodeB := newResumableHandler(buffer, svcA), newResumableHandler(buffer, svcB)
+
+	svcA.Queue(map[string]interface{}{"data": map[string]interface{}{"n": 1}})
+	c := subscribeWithToken(t, nodeA, map[string]string{"token": "tok"})
+	lastEventID, _ := readResumptionEvent(t, c)
+	assert.NotEmpty(t, lastEventID)
+
+	// the client drops while node A keeps buffering
+	c.Close()
+	svcA.Publish(map[string]interface{}{"data": map[string]interface{}{"n": 2}})
+	assert.Eventually(t, func() bool {
+		events, err := buffer.After(context.Background(), "tok", lastEventID)
+		return err == nil && len(events) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	resumed := subscribeWithToken(t, nodeB, map[string]string{"token": "tok", "lastEventId": lastEventID})
+	_, data := readResumptionEvent(t, resumed)
+	assert.JSONEq(t, `{"n":2}`, string(data))
+
+	// node A stops the detached operation on its next event
+	svcA.Publish(map[string]interface{}{"data": map[string]interface{}{"n": 3}})
+	assert.Eventually(t, func() bool { return svcA.ActiveCount() == 0 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,282 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// CloseKicked is the websocket close code used for connections kicked through a Node
+const CloseKicked = 4403
+
+const (
+	defaultTTL           = 30 * time.Second
+	unregisterTimeout    = 5 * time.Second
+	defaultKickReason    = "kicked"
+	heartbeatIntervalDiv = 3
+
+	minResubscribeBackoff = 100 * time.Millisecond
+	maxResubscribeBackoff = 30 * time.Second
+)
+
+// Node registers the connections of a transport Registry in a Store and executes the commands
+// published by any node. Every replica runs its own Node sharing the same Store.
+type Node struct {
+	// ID identifies the node in the Store, a random id is generated by Run when empty
+	ID       string
+	Store    Store
+	Registry *transport.Registry
+	// TTL is how long a session outlives the last heartbeat of its node, it defaults to 30 seconds
+	TTL time.Duration
+	// HeartbeatInterval is how often the sessions are refreshed, it defaults to a third of TTL.
+	// Subscriptions of a session are updated on every heartbeat.
+	HeartbeatInterval time.Duration
+	// UserIDFunc returns the user owning a connection, for KickUser and Session.UserID
+	UserIDFunc func(conn *transport.Connection) string
+	// BroadcastFunc receives the payloads sent with Broadcast, on every node
+	BroadcastFunc func(ctx context.Context, payload json.RawMessage)
+	// ErrorFunc is called when the Store fails while the node is running
+	ErrorFunc func(ctx context.Context, err error)
+
+	events eventQueue
+}
+
+// Run registers the connections of the Registry until ctx is cancelled, then unregisters them.
+// The commands are subscribed again when their subscription is lost, with a backoff while the
+// Store fails.
+func (n *Node) Run(ctx context.Context) error {
+	if n.ID == "" {
+		n.ID = newNodeID()
+	}
+
+	commands, err := n.Store.Commands(ctx)
+	if err != nil {
+		return err
+	}
+
+	n.events.init()
+	cancel := n.Registry.Listen(n.events.push)
+	defer cancel()
+
+	n.heartbeat(ctx)
+
+	ticker := time.NewTicker(n.heartbeatInterval())
+	defer ticker.Stop()
+
+	var (
+		retry    <-chan time.Time
+		attempts int
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			n.unregisterAll()
+			return nil
+		case <-ticker.C:
+			n.heartbeat(ctx)
+		case <-n.events.notify:
+			for _, event := range n.events.drain() {
+				n.handleEvent(ctx, event)
+			}
+		case <-retry:
+			commands, retry = n.resubscribe(ctx, &attempts)
+		case cmd, ok := <-commands:
+			if !ok {
+				if ctx.Err() != nil {
+					commands = nil
+					continue
+				}
+				// the subscription was lost, subscribe again
+				commands, retry = n.resubscribe(ctx, &attempts)
+				continue
+			}
+			n.handleCommand(ctx, cmd)
+		}
+	}
+}
+
+// resubscribe subscribes to the commands again. A failure is reported and retried once the
+// returned channel fires, after a backoff doubling with every failed attempt.
+func (n *Node) resubscribe(ctx context.Context, attempts *int) (<-chan Command, <-chan time.Time) {
+	commands, err := n.Store.Commands(ctx)
+	if err == nil {
+		*attempts = 0
+		return commands, nil
+	}
+	n.report(ctx, err)
+	backoff := minResubscribeBackoff
+	for i := 0; i < *attempts && backoff < maxResubscribeBackoff; i++ {
+		backoff *= 2
+	}
+	*attempts++
+	return nil, time.After(min(backoff, maxResubscribeBackoff))
+}
+
+// KickConnection closes the connection with the given id, whichever node owns it.
+func (n *Node) KickConnection(ctx context.Context, connectionID string, reason string) error {
+	return n.Store.Publish(ctx, Command{Type: KickConnection, ConnectionID: connectionID, Reason: reason})
+}
+
+// KickUser closes every connection of the user on every node.
+func (n *Node) KickUser(ctx context.Context, userID string, reason string) error {
+	return n.Store.Publish(ctx, Command{Type: KickUser, UserID: userID, Reason: reason})
+}
+
+// Broadcast sends payload, encoded to JSON, to the BroadcastFunc of every node.
+func (n *Node) Broadcast(ctx context.Context, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return n.Store.Publish(ctx, Command{Type: Broadcast, Payload: b})
+}
+
+// Sessions returns the sessions of every node.
+func (n *Node) Sessions(ctx context.Context) ([]Session, error) {
+	return n.Store.Sessions(ctx)
+}
+
+// CountSessions returns the number of sessions of every node.
+func (n *Node) CountSessions(ctx context.Context) (int, error) {
+	sessions, err := n.Store.Sessions(ctx)
+	return len(sessions), err
+}
+
+func (n *Node) ttl() time.Duration {
+	if n.TTL == 0 {
+		return defaultTTL
+	}
+	return n.TTL
+}
+
+func (n *Node) heartbeatInterval() time.Duration {
+	if n.HeartbeatInterval == 0 {
+		return n.ttl() / heartbeatIntervalDiv
+	}
+	return n.HeartbeatInterval
+}
+
+func (n *Node) userID(conn *transport.Connection) string {
+	if n.UserIDFunc == nil {
+		return ""
+	}
+	return n.UserIDFunc(conn)
+}
+
+func (n *Node) session(conn *transport.Connection) Session {
+	info := conn.Info()
+	return Session{
+		NodeID:        n.ID,
+		ConnectionID:  info.ID,
+		UserID:        n.userID(conn),
+		RemoteAddr:    info.RemoteAddr,
+		ConnectedAt:   conn.ConnectedAt(),
+		Subscriptions: conn.Subscriptions(),
+	}
+}
+
+func (n *Node) heartbeat(ctx context.Context) {
+	for _, conn := range n.Registry.Connections() {
+		n.report(ctx, n.Store.Register(ctx, n.session(conn), n.ttl()))
+	}
+}
+
+func (n *Node) handleEvent(ctx context.Context, event transport.RegistryEvent) {
+	switch event.Type {
+	case transport.ConnectionRegistered:
+		n.report(ctx, n.Store.Register(ctx, n.session(event.Connection), n.ttl()))
+	case transport.ConnectionUnregistered:
+		n.report(ctx, n.Store.Unregister(ctx, n.ID, event.Connection.Info().ID))
+	}
+}
+
+func (n *Node) handleCommand(ctx context.Context, cmd Command) {
+	reason := cmd.Reason
+	if reason == "" {
+		reason = defaultKickReason
+	}
+
+	switch cmd.Type {
+	case KickConnection:
+		if conn := n.Registry.Get(cmd.ConnectionID); conn != nil {
+			conn.Close(CloseKicked, reason)
+		}
+	case KickUser:
+		if cmd.UserID == "" {
+			return
+		}
+		for _, conn := range n.Registry.Connections() {
+			if n.userID(conn) == cmd.UserID {
+				conn.Close(CloseKicked, reason)
+			}
+		}
+	case Broadcast:
+		if n.BroadcastFunc != nil {
+			n.BroadcastFunc(ctx, cmd.Payload)
+		}
+	}
+}
+
+func (n *Node) unregisterAll() {
+	// the context of Run is done, removing the sessions now avoids waiting for their TTL
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+
+	for _, event := range n.events.drain() {
+		n.handleEvent(ctx, event)
+	}
+	for _, conn := range n.Registry.Connections() {
+		n.report(ctx, n.Store.Unregister(ctx, n.ID, conn.Info().ID))
+	}
+}
+
+func (n *Node) report(ctx context.Context, err error) {
+	if err != nil && n.ErrorFunc != nil {
+		n.ErrorFunc(ctx, err)
+	}
+}
+
+// eventQueue buffers registry events, registry listeners must not block while the store may.
+type eventQueue struct {
+	mu     sync.Mutex
+	events []transport.RegistryEvent
+	notify chan struct{}
+}
+
+func (q *eventQueue) init() {
+	q.mu.Lock()
+	q.events = nil
+	q.notify = make(chan struct{}, 1)
+	q.mu.Unlock()
+}
+
+func (q *eventQueue) push(event transport.RegistryEvent) {
+	q.mu.Lock()
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) drain() []transport.RegistryEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	events := q.events
+	q.events = nil
+	return events
+}
+
+func newNodeID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,233 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type testNode struct {
+	*Node
+	handler http.Handler
+}
+
+func startTestNode(t *testing.T, id string, store Store, configure ...func(*Node)) *testNode {
+	registry := transport.NewRegistry()
+	ws := &transport.Websocket{
+		Upgrader: transport.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		Registry: registry,
+	}
+	node := &Node{
+		ID:       id,
+		Store:    store,
+		Registry: registry,
+		UserIDFunc: func(conn *transport.Connection) string {
+			return conn.InitPayload().GetString("user")
+		},
+	}
+	for _, fn := range configure {
+		fn(node)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, node.Run(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	svc := transporttest.NewFakeService()
+	return &testNode{
+		Node:    node,
+		handler: graphqlws.NewHandlerFunc(svc, http.NotFoundHandler(), graphqlws.WithWebsocketTransport(ws)),
+	}
+}
+
+func (n *testNode) connect(t *testing.T, user string) *transporttest.Client {
+	c, err := transporttest.NewClient(n.handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	assert.NoError(t, c.Init(map[string]string{"user": user}))
+	return c
+}
+
+func waitForSessions(t *testing.T, node *testNode, count int) {
+	assert.Eventually(t, func() bool {
+		n, err := node.CountSessions(context.Background())
+		return err == nil && n == count
+	}, time.Second, 5*time.Millisecond)
+}
+
+func expectKicked(t *testing.T, c *transporttest.Client) {
+	for {
+		_, err := c.Read()
+		if err == nil {
+			continue
+		}
+		assert.True(t, websocket.IsCloseError(err, CloseKicked), "Expected kick close, got %v", err)
+		return
+	}
+}
+
+func TestNodeSessionsAcrossNodes(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	a := startTestNode(t, "a", store)
+	b := startTestNode(t, "b", store)
+
+	a.connect(t, "alice")
+	bob := b.connect(t, "bob")
+	waitForSessions(t, a, 2)
+
+	sessions, err := b.Sessions(context.Background())
+	assert.NoError(t, err)
+	users := map[string]string{}
+	for _, s := range sessions {
+		users[s.UserID] = s.NodeID
+	}
+	assert.Equal(t, map[string]string{"alice": "a", "bob": "b"}, users)
+
+	bob.Close()
+	waitForSessions(t, a, 1)
+}
+
+func TestNodeKickUser(t *testing.T) {
+	store := NewMemoryStore()
+	a := startTestNode(t, "a", store)
+	b := startTestNode(t, "b", store)
+
+	alice1 := a.connect(t, "alice")
+	alice2 := b.connect(t, "alice")
+	bob := b.connect(t, "bob")
+	waitForSessions(t, a, 3)
+
+	assert.NoError(t, a.KickUser(context.Background(), "alice", "banned"))
+	expectKicked(t, alice1)
+	expectKicked(t, alice2)
+	waitForSessions(t, a, 1)
+
+	assert.NoError(t, bob.Ping())
+	_, err := bob.Expect("pong")
+	assert.NoError(t, err)
+}
+
+func TestNodeKickConnection(t *testing.T) {
+	store := NewMemoryStore()
+	a := startTestNode(t, "a", store)
+	b := startTestNode(t, "b", store)
+
+	c := b.connect(t, "alice")
+	waitForSessions(t, a, 1)
+
+	sessions, err := a.Sessions(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, a.KickConnection(context.Background(), sessions[0].ConnectionID, ""))
+	expectKicked(t, c)
+}
+
+// flakyStore loses the first subscription of the commands and fails to subscribe again a few times.
+type flakyStore struct {
+	*MemoryStore
+	failures int
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *flakyStore) Commands(ctx context.Context) (<-chan Command, error) {
+	s.mu.Lock()
+	s.calls++
+	calls := s.calls
+	s.mu.Unlock()
+	switch {
+	case calls == 1:
+		lost := make(chan Command)
+		close(lost)
+		return lost, nil
+	case calls <= 1+s.failures:
+		return nil, errors.New("unavailable")
+	}
+	return s.MemoryStore.Commands(ctx)
+}
+
+func TestNodeSubscribesAgainToCommands(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failures: 2}
+	errs := make(chan error, 2)
+	a := startTestNode(t, "a", store, func(n *Node) {
+		n.ErrorFunc = func(ctx context.Context, err error) { errs <- err }
+	})
+	c := a.connect(t, "alice")
+
+	for range store.failures {
+		assert.EqualError(t, <-errs, "unavailable")
+	}
+	assert.Eventually(t, func() bool {
+		store.MemoryStore.mu.Lock()
+		defer store.MemoryStore.mu.Unlock()
+		return len(store.MemoryStore.subscribers) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.NoError(t, a.KickUser(context.Background(), "alice", ""))
+	expectKicked(t, c)
+}
+
+func TestNodeBroadcast(t *testing.T) {
+	store := NewMemoryStore()
+	received := make(chan json.RawMessage, 2)
+	onBroadcast := func(n *Node) {
+		n.BroadcastFunc = func(ctx context.Context, payload json.RawMessage) { received <- payload }
+	}
+	a := startTestNode(t, "a", store, onBroadcast)
+	b := startTestNode(t, "b", store, onBroadcast)
+
+	// sessions are registered once the nodes listen for commands
+	a.connect(t, "alice")
+	b.connect(t, "bob")
+	waitForSessions(t, a, 2)
+
+	assert.NoError(t, a.Broadcast(context.Background(), map[string]string{"message": "hello"}))
+	for i := 0; i < 2; i++ {
+		select {
+		case payload := <-received:
+			assert.JSONEq(t, `{"message":"hello"}`, string(payload))
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for broadcast")
+		}
+	}
+}
+
+func TestNodeHeartbeatRefreshesSessions(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	a := startTestNode(t, "a", store, func(n *Node) {
+		n.TTL = time.Minute
+		n.HeartbeatInterval = 10 * time.Millisecond
+	})
+	a.connect(t, "alice")
+	waitForSessions(t, a, 1)
+
+	sessions, err := a.Sessions(context.Background())
+	assert.NoError(t, err)
+	key := "test:session:a:" + sessions[0].ConnectionID
+
+	server.FastForward(2 * time.Minute)
+	assert.Eventually(t, func() bool {
+		_, ok := server.Get(key)
+		return ok
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/redis"
+)
+
+// RedisStore is a Store shared by every node connected to the same Redis server. Sessions are
+// stored as keys expiring after their TTL and commands are relayed through a pub/sub channel.
+type RedisStore struct {
+	client redis.Client
+	prefix string
+}
+
+var _ Store = &RedisStore{}
+
+// NewRedisStore returns a store whose keys and channel are prefixed with prefix, it defaults to
+// "graphqlws:".
+func NewRedisStore(client redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "graphqlws:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (r *RedisStore) sessionKey(nodeID string, connectionID string) string {
+	return r.prefix + "session:" + sessionKey(nodeID, connectionID)
+}
+
+func (r *RedisStore) commandsChannel() string {
+	return r.prefix + "commands"
+}
+
+// Register implements Store
+func (r *RedisStore) Register(ctx context.Context, s Session, ttl time.Duration) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Do(ctx, "SET", r.sessionKey(s.NodeID, s.ConnectionID), b, "PX", ttl.Milliseconds())
+	return err
+}
+
+// Unregister implements Store
+func (r *RedisStore) Unregister(ctx context.Context, nodeID string, connectionID string) error {
+	_, err := r.client.Do(ctx, "DEL", r.sessionKey(nodeID, connectionID))
+	return err
+}
+
+// Sessions implements Store
+func (r *RedisStore) Sessions(ctx context.Context) ([]Session, error) {
+	keys, err := redis.Scan(ctx, r.client, redis.GlobEscape(r.prefix)+"session:*")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return []Session{}, nil
+	}
+
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	values, err := redis.Strings(r.client.Do(ctx, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(values))
+	for _, v := range values {
+		// keys expiring between SCAN and MGET come back as nil
+		if v == "" {
+			continue
+		}
+		var s Session
+		if err := json.Unmarshal([]byte(v), &s); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// Publish implements Store
+func (r *RedisStore) Publish(ctx context.Context, cmd Command) error {
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Do(ctx, "PUBLISH", r.commandsChannel(), b)
+	return err
+}
+
+// Commands implements Store. Messages that can't be decoded are dropped.
+func (r *RedisStore) Commands(ctx context.Context) (<-chan Command, error) {
+	messages, err := r.client.Subscribe(ctx, r.commandsChannel())
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make(chan Command)
+	go func() {
+		defer close(commands)
+		for m := range messages {
+			var cmd Command
+			if err := json.Unmarshal([]byte(m.Payload), &cmd); err != nil {
+				continue
+			}
+
+			select {
+			case commands <- cmd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return commands, nil
+}
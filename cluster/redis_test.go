@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/redis/redistest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *redistest.Client) {
+	client := redistest.NewClient()
+	return NewRedisStore(client, "test:"), client
+}
+
+func TestRedisStoreSessions(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisStore(t)
+
+	connectedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := Session{NodeID: "a", ConnectionID: "1", UserID: "alice", ConnectedAt: connectedAt, Subscriptions: []string{"1"}}
+	assert.NoError(t, store.Register(ctx, session, time.Minute))
+	assert.NoError(t, store.Register(ctx, Session{NodeID: "b", ConnectionID: "2", ConnectedAt: connectedAt}, 10*time.Second))
+	assert.NoError(t, store.Register(ctx, Session{NodeID: "a", ConnectionID: "3", ConnectedAt: connectedAt}, time.Minute))
+	assert.NoError(t, store.Unregister(ctx, "a", "3"))
+
+	_, ok := server.Get("test:session:a:1")
+	assert.True(t, ok, "Expected session to be stored under the prefix")
+
+	server.FastForward(30 * time.Second)
+
+	sessions, err := store.Sessions(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Session{session}, sessions)
+}
+
+func TestRedisStoreNoSessions(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+
+	sessions, err := store.Sessions(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestRedisStoreSessionsEscapesPrefix(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisStore(t)
+	globbing := NewRedisStore(store.client, "test*")
+
+	assert.NoError(t, store.Register(ctx, Session{NodeID: "a", ConnectionID: "1"}, time.Minute))
+	assert.NoError(t, globbing.Register(ctx, Session{NodeID: "a", ConnectionID: "2"}, time.Minute))
+	_, ok := server.Get("test*session:a:2")
+	assert.True(t, ok)
+
+	sessions, err := globbing.Sessions(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 1, "Expected the prefix not to match the keys of other prefixes") {
+		assert.Equal(t, "2", sessions[0].ConnectionID)
+	}
+}
+
+func TestRedisStoreCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, _ := newTestRedisStore(t)
+
+	commands, err := store.Commands(ctx)
+	assert.NoError(t, err)
+
+	cmd := Command{Type: Broadcast, Payload: []byte(`{"message":"hello"}`)}
+	assert.NoError(t, store.Publish(ctx, cmd))
+
+	select {
+	case received := <-commands:
+		assert.Equal(t, cmd, received)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for command")
+	}
+}
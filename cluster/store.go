@@ -0,0 +1,175 @@
+// Package cluster coordinates websocket sessions across the replicas of a deployment. Every node
+// registers its connections in a shared Store with a TTL refreshed by heartbeats, which allows
+// counting sessions, kicking users and broadcasting to every node from any replica.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Session describes a connection registered by a node.
+type Session struct {
+	NodeID       string    `json:"nodeId"`
+	ConnectionID string    `json:"connectionId"`
+	UserID       string    `json:"userId,omitempty"`
+	RemoteAddr   string    `json:"remoteAddr,omitempty"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	// Subscriptions are the ids of the active operations as of the last heartbeat
+	Subscriptions []string `json:"subscriptions,omitempty"`
+}
+
+// CommandType identifies a cross-node operation
+type CommandType string
+
+const (
+	// KickConnection closes the connection with the given id on the node owning it
+	KickConnection CommandType = "kick_connection"
+	// KickUser closes every connection of a user on every node
+	KickUser CommandType = "kick_user"
+	// Broadcast delivers a payload to the BroadcastFunc of every node
+	Broadcast CommandType = "broadcast"
+)
+
+// Command is a cross-node operation published through the Store.
+type Command struct {
+	Type         CommandType     `json:"type"`
+	ConnectionID string          `json:"connectionId,omitempty"`
+	UserID       string          `json:"userId,omitempty"`
+	Reason       string          `json:"reason,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+}
+
+// Store keeps the sessions of every node and relays commands between nodes.
+type Store interface {
+	// Register stores a session, replacing any previous registration, which expires after ttl.
+	Register(ctx context.Context, s Session, ttl time.Duration) error
+	// Unregister removes a session.
+	Unregister(ctx context.Context, nodeID string, connectionID string) error
+	// Sessions returns the sessions that haven't expired.
+	Sessions(ctx context.Context) ([]Session, error)
+	// Publish sends a command to every node.
+	Publish(ctx context.Context, cmd Command) error
+	// Commands returns the commands published after the call, until ctx is cancelled.
+	Commands(ctx context.Context) (<-chan Command, error)
+}
+
+// MemoryStore is a Store for a single process, useful for tests and single node deployments.
+type MemoryStore struct {
+	// publishMu serializes the commands, they are sent without holding mu since the subscribers
+	// need it to stop.
+	publishMu sync.Mutex
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	// subscribers maps the subscriptions to the done channels of their contexts.
+	subscribers map[chan Command]<-chan struct{}
+}
+
+type memorySession struct {
+	session   Session
+	expiresAt time.Time
+}
+
+var _ Store = &MemoryStore{}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:    map[string]memorySession{},
+		subscribers: map[chan Command]<-chan struct{}{},
+	}
+}
+
+func sessionKey(nodeID string, connectionID string) string {
+	return nodeID + ":" + connectionID
+}
+
+// Register implements Store
+func (m *MemoryStore) Register(ctx context.Context, s Session, ttl time.Duration) error {
+	m.mu.Lock()
+	m.sessions[sessionKey(s.NodeID, s.ConnectionID)] = memorySession{session: s, expiresAt: time.Now().Add(ttl)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Unregister implements Store
+func (m *MemoryStore) Unregister(ctx context.Context, nodeID string, connectionID string) error {
+	m.mu.Lock()
+	delete(m.sessions, sessionKey(nodeID, connectionID))
+	m.mu.Unlock()
+	return nil
+}
+
+// Sessions implements Store
+func (m *MemoryStore) Sessions(ctx context.Context) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := make([]Session, 0, len(m.sessions))
+	for key, s := range m.sessions {
+		if !now.Before(s.expiresAt) {
+			delete(m.sessions, key)
+			continue
+		}
+		sessions = append(sessions, s.session)
+	}
+	return sessions, nil
+}
+
+// Publish implements Store
+func (m *MemoryStore) Publish(ctx context.Context, cmd Command) error {
+	m.publishMu.Lock()
+	defer m.publishMu.Unlock()
+
+	m.mu.Lock()
+	subscribers := make(map[chan Command]<-chan struct{}, len(m.subscribers))
+	for sub, done := range m.subscribers {
+		subscribers[sub] = done
+	}
+	m.mu.Unlock()
+
+	for sub, done := range subscribers {
+		select {
+		case sub <- cmd:
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Commands implements Store
+func (m *MemoryStore) Commands(ctx context.Context) (<-chan Command, error) {
+	in := make(chan Command, 16)
+	m.mu.Lock()
+	m.subscribers[in] = ctx.Done()
+	m.mu.Unlock()
+
+	out := make(chan Command)
+	go func() {
+		defer close(out)
+		defer func() {
+			m.mu.Lock()
+			delete(m.subscribers, in)
+			m.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case cmd := <-in:
+				select {
+				case out <- cmd:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
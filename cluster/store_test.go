@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreSessions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	assert.NoError(t, store.Register(ctx, Session{NodeID: "a", ConnectionID: "1"}, time.Minute))
+	assert.NoError(t, store.Register(ctx, Session{NodeID: "b", ConnectionID: "2"}, time.Nanosecond))
+	assert.NoError(t, store.Register(ctx, Session{NodeID: "a", ConnectionID: "3"}, time.Minute))
+	assert.NoError(t, store.Unregister(ctx, "a", "3"))
+	time.Sleep(time.Millisecond)
+
+	sessions, err := store.Sessions(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Session{{NodeID: "a", ConnectionID: "1"}}, sessions)
+}
+
+func TestMemoryStoreCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := NewMemoryStore()
+
+	commands, err := store.Commands(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Publish(context.Background(), Command{Type: KickUser, UserID: "alice"}))
+	assert.Equal(t, Command{Type: KickUser, UserID: "alice"}, <-commands)
+
+	cancel()
+	for range commands {
+	}
+	assert.NoError(t, store.Publish(context.Background(), Command{Type: KickUser, UserID: "bob"}))
+}
+
+func TestMemoryStoreCancelledSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := NewMemoryStore()
+
+	_, err := store.Commands(ctx)
+	assert.NoError(t, err)
+
+	published := make(chan error, 1)
+	go func() {
+		for range 32 {
+			if err := store.Publish(context.Background(), Command{Type: KickUser, UserID: "alice"}); err != nil {
+				published <- err
+				return
+			}
+		}
+		published <- nil
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-published:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by a cancelled subscriber")
+	}
+}
@@ -0,0 +1,84 @@
+// Command example-server runs a small GraphQL server exposing a counter and a chat subscription
+// over websockets, together with a GraphiQL playground.
+//
+// Usage:
+//
+//	go run ./cmd/example-server -addr :8080
+//
+// Then open http://localhost:8080 and run
+//
+//	subscription { counter }
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+//go:embed playground.html
+var playground []byte
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// httpHandler serves queries and mutations sent over HTTP POST.
+func httpHandler(svc *service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			transport.SendErrorf(w, http.StatusMethodNotAllowed, "only POST requests are supported")
+			return
+		}
+
+		var req graphqlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			transport.SendErrorf(w, http.StatusBadRequest, "invalid json: %s", err.Error())
+			return
+		}
+
+		res, err := svc.execute(req.Query, req.OperationName, req.Variables)
+		if err != nil {
+			transport.SendErrorf(w, http.StatusOK, "%s", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
+
+func newMux(svc *service) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", graphqlws.NewHandlerFunc(svc, httpHandler(svc)))
+	mux.HandleFunc("/schema.graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(schema))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(playground)
+	})
+	return mux
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	flag.Parse()
+
+	log.Printf("playground available on http://localhost%s", *addr)
+	if err := http.ListenAndServe(*addr, newMux(newService())); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// schema documents the operations understood by the example service.
+const schema = `
+type Query {
+	rooms: [String!]!
+}
+
+type Mutation {
+	sendMessage(room: String!, text: String!): Message!
+}
+
+type Subscription {
+	counter: Int!
+	chat(room: String!): Message!
+}
+
+type Message {
+	room: String!
+	text: String!
+	sentAt: String!
+}
+`
+
+type chatMessage struct {
+	Room   string `json:"room"`
+	Text   string `json:"text"`
+	SentAt string `json:"sentAt"`
+}
+
+// service is a tiny hand written GraphQL service, it only resolves the root fields of the example
+// schema and ignores selection sets.
+type service struct {
+	counterInterval time.Duration
+
+	mu    sync.Mutex
+	rooms map[string]map[chan chatMessage]struct{}
+}
+
+func newService() *service {
+	return &service{
+		counterInterval: time.Second,
+		rooms:           map[string]map[chan chatMessage]struct{}{},
+	}
+}
+
+// rootField parses the document and returns the single root field of the selected operation.
+func rootField(document string, operationName string, variables map[string]interface{}) (ast.Operation, *ast.Field, error) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: document})
+	if err != nil {
+		return "", nil, err
+	}
+
+	op := doc.Operations.ForName(operationName)
+	if op == nil {
+		return "", nil, errors.New("operation not found")
+	}
+	if len(op.SelectionSet) != 1 {
+		return "", nil, errors.New("exactly one root field must be selected")
+	}
+	field, ok := op.SelectionSet[0].(*ast.Field)
+	if !ok {
+		return "", nil, errors.New("fragments are not supported on the root type")
+	}
+
+	return op.Operation, field, nil
+}
+
+func stringArgument(field *ast.Field, name string, variables map[string]interface{}) (string, error) {
+	arg := field.Arguments.ForName(name)
+	if arg == nil {
+		return "", fmt.Errorf("argument %s is required", name)
+	}
+
+	value, err := arg.Value.Value(variables)
+	if err != nil {
+		return "", err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %s must be a string", name)
+	}
+	return s, nil
+}
+
+func response(field *ast.Field, value interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"data": map[string]interface{}{field.Alias: value},
+	}
+}
+
+// Subscribe implements transport.GraphQLService.
+func (s *service) Subscribe(ctx context.Context, document string, operationName string, variables map[string]interface{}) (<-chan interface{}, error) {
+	opType, field, err := rootField(document, operationName, variables)
+	if err != nil {
+		return nil, err
+	}
+	if opType != ast.Subscription {
+		return nil, fmt.Errorf("%s operations are served over HTTP", opType)
+	}
+
+	switch field.Name {
+	case "counter":
+		return s.counter(ctx, field), nil
+	case "chat":
+		room, err := stringArgument(field, "room", variables)
+		if err != nil {
+			return nil, err
+		}
+		return s.chat(ctx, field, room), nil
+	default:
+		return nil, fmt.Errorf("unknown subscription field %s", field.Name)
+	}
+}
+
+func (s *service) counter(ctx context.Context, field *ast.Field) <-chan interface{} {
+	payloads := make(chan interface{})
+	go func() {
+		defer close(payloads)
+		ticker := time.NewTicker(s.counterInterval)
+		defer ticker.Stop()
+
+		for n := 1; ; n++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case payloads <- response(field, n):
+			}
+		}
+	}()
+	return payloads
+}
+
+func (s *service) chat(ctx context.Context, field *ast.Field, room string) <-chan interface{} {
+	messages := make(chan chatMessage, 16)
+	s.mu.Lock()
+	if s.rooms[room] == nil {
+		s.rooms[room] = map[chan chatMessage]struct{}{}
+	}
+	s.rooms[room][messages] = struct{}{}
+	s.mu.Unlock()
+
+	payloads := make(chan interface{})
+	go func() {
+		defer close(payloads)
+		defer func() {
+			s.mu.Lock()
+			delete(s.rooms[room], messages)
+			if len(s.rooms[room]) == 0 {
+				delete(s.rooms, room)
+			}
+			s.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m := <-messages:
+				select {
+				case <-ctx.Done():
+					return
+				case payloads <- response(field, m):
+				}
+			}
+		}
+	}()
+	return payloads
+}
+
+// sendMessage delivers a message to every subscriber of the room. Slow subscribers miss messages
+// instead of blocking the sender.
+func (s *service) sendMessage(room string, text string) chatMessage {
+	m := chatMessage{Room: room, Text: text, SentAt: time.Now().UTC().Format(time.RFC3339)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for subscriber := range s.rooms[room] {
+		select {
+		case subscriber <- m:
+		default:
+		}
+	}
+	return m
+}
+
+func (s *service) roomNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.rooms))
+	for name := range s.rooms {
+		names = append(names, name)
+	}
+	return names
+}
+
+// execute resolves query and mutation operations sent over HTTP.
+func (s *service) execute(document string, operationName string, variables map[string]interface{}) (map[string]interface{}, error) {
+	opType, field, err := rootField(document, operationName, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opType == ast.Query && field.Name == "rooms":
+		return response(field, s.roomNames()), nil
+	case opType == ast.Mutation && field.Name == "sendMessage":
+		room, err := stringArgument(field, "room", variables)
+		if err != nil {
+			return nil, err
+		}
+		text, err := stringArgument(field, "text", variables)
+		if err != nil {
+			return nil, err
+		}
+		return response(field, s.sendMessage(room, text)), nil
+	case opType == ast.Subscription:
+		return nil, errors.New("subscriptions are served over websockets")
+	default:
+		return nil, fmt.Errorf("unknown %s field %s", opType, field.Name)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterSubscription(t *testing.T) {
+	svc := newService()
+	svc.counterInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	payloads, err := svc.Subscribe(ctx, "subscription { value: counter }", "", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"value": 1}}, <-payloads)
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"value": 2}}, <-payloads)
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	svc := newService()
+
+	_, err := svc.Subscribe(context.Background(), "subscription {", "", nil)
+	assert.Error(t, err, "Expected a syntax error")
+
+	_, err = svc.Subscribe(context.Background(), "query { rooms }", "", nil)
+	assert.EqualError(t, err, "query operations are served over HTTP")
+
+	_, err = svc.Subscribe(context.Background(), "subscription { unknown }", "", nil)
+	assert.EqualError(t, err, "unknown subscription field unknown")
+
+	_, err = svc.Subscribe(context.Background(), "subscription { chat }", "", nil)
+	assert.EqualError(t, err, "argument room is required")
+}
+
+func TestChatOverWebsocket(t *testing.T) {
+	svc := newService()
+	mux := newMux(svc)
+
+	c, err := transporttest.NewClient(mux, transporttest.WithPath("/graphql"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	assert.NoError(t, c.Init(nil))
+	assert.NoError(t, c.Subscribe("1", transporttest.Operation{
+		Query:     "subscription ($room: String!) { chat(room: $room) { text } }",
+		Variables: map[string]interface{}{"room": "lobby"},
+	}))
+
+	deadline := time.Now().Add(time.Second)
+	for len(svc.roomNames()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	recorder := httptest.NewRecorder()
+	body := bytes.NewBufferString(`{"query":"mutation { sendMessage(room: \"lobby\", text: \"hello\") { text } }"}`)
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/graphql", body))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"text":"hello"`)
+
+	m, err := c.Expect("next")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", m.ID)
+}
+
+func TestPlayground(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newMux(newService()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "GraphiQL")
+}
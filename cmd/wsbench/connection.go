@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type dialect struct {
+	subscribe string
+	next      string
+}
+
+var dialects = map[string]dialect{
+	"graphql-ws":           {subscribe: "start", next: "data"},
+	"graphql-transport-ws": {subscribe: "subscribe", next: "next"},
+}
+
+type frame struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// runConnection opens one connection, starts its subscriptions and counts the received messages
+// until ctx is cancelled.
+func runConnection(ctx context.Context, cfg config, index int, st *stats) {
+	d := dialects[cfg.subprotocol]
+	start := time.Now()
+
+	dialer := websocket.Dialer{Subprotocols: []string{cfg.subprotocol}}
+	conn, _, err := dialer.DialContext(ctx, cfg.url, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			st.addError("dial")
+		}
+		return
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		_ = conn.Close()
+	}()
+
+	if err := conn.WriteJSON(frame{Type: "connection_init", Payload: cfg.initPayload}); err != nil {
+		st.addError("init")
+		return
+	}
+	for {
+		var f frame
+		if err := conn.ReadJSON(&f); err != nil {
+			if ctx.Err() == nil {
+				st.addError("init")
+			}
+			return
+		}
+		if f.Type == "connection_ack" {
+			break
+		}
+		if f.Type != "ka" {
+			st.addError("init")
+			return
+		}
+	}
+	st.addHandshake(time.Since(start))
+
+	for i := 0; i < cfg.subscriptions; i++ {
+		query := cfg.queries[(index*cfg.subscriptions+i)%len(cfg.queries)]
+		payload, err := json.Marshal(map[string]interface{}{"query": query})
+		if err != nil {
+			st.addError("subscribe")
+			return
+		}
+		if err := conn.WriteJSON(frame{Type: d.subscribe, ID: fmt.Sprint(i + 1), Payload: payload}); err != nil {
+			st.addError("subscribe")
+			return
+		}
+	}
+
+	for {
+		var f frame
+		if err := conn.ReadJSON(&f); err != nil {
+			if ctx.Err() == nil {
+				st.addError("read")
+			}
+			return
+		}
+
+		switch f.Type {
+		case d.next:
+			st.addMessage()
+		case "error", "connection_error":
+			st.addError("operation")
+		case "ping":
+			if err := conn.WriteJSON(frame{Type: "pong"}); err != nil {
+				st.addError("write")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport/transporttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	svc := transporttest.NewFakeService()
+	for i := 0; i < 4; i++ {
+		svc.Queue(map[string]interface{}{"data": map[string]interface{}{"value": i}})
+	}
+
+	ws := &transport.Websocket{
+		Upgrader: transport.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.Do(w, r, svc)
+	}))
+	defer server.Close()
+
+	st := newStats()
+	run(context.Background(), config{
+		url:           "ws" + strings.TrimPrefix(server.URL, "http"),
+		subprotocol:   "graphql-transport-ws",
+		connections:   2,
+		subscriptions: 1,
+		queries:       queryList{"subscription { value }"},
+		duration:      200 * time.Millisecond,
+	}, st)
+
+	assert.Len(t, st.handshakes, 2)
+	assert.Equal(t, int64(4), st.messages)
+	assert.Empty(t, st.errors)
+}
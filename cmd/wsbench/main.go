@@ -0,0 +1,115 @@
+// Command wsbench opens many concurrent GraphQL subscriptions against a server and reports
+// handshake latency, message throughput and error rates.
+//
+// Usage:
+//
+//	wsbench -url ws://localhost:8080/graphql -connections 1000 -subscriptions 2 \
+//		-query 'subscription { counter }' -ramp-up 10s -duration 1m
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+type queryList []string
+
+func (q *queryList) String() string {
+	return strings.Join(*q, ", ")
+}
+
+func (q *queryList) Set(value string) error {
+	*q = append(*q, value)
+	return nil
+}
+
+type config struct {
+	url           string
+	subprotocol   string
+	connections   int
+	subscriptions int
+	queries       queryList
+	rampUp        time.Duration
+	duration      time.Duration
+	initPayload   json.RawMessage
+}
+
+func main() {
+	var cfg config
+	var initPayload string
+	flag.StringVar(&cfg.url, "url", "ws://localhost:8080/graphql", "websocket endpoint of the server")
+	flag.StringVar(&cfg.subprotocol, "protocol", "graphql-transport-ws", "subprotocol to negotiate, graphql-ws or graphql-transport-ws")
+	flag.IntVar(&cfg.connections, "connections", 100, "number of concurrent connections")
+	flag.IntVar(&cfg.subscriptions, "subscriptions", 1, "number of subscriptions per connection")
+	flag.Var(&cfg.queries, "query", "subscription document, repeat the flag to run a mix of subscriptions")
+	flag.DurationVar(&cfg.rampUp, "ramp-up", 0, "time over which the connections are opened")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "duration of the benchmark")
+	flag.StringVar(&initPayload, "init-payload", "", "JSON payload of the connection_init message")
+	flag.Parse()
+
+	if len(cfg.queries) == 0 {
+		fmt.Fprintln(os.Stderr, "at least one -query is required")
+		os.Exit(2)
+	}
+	if _, ok := dialects[cfg.subprotocol]; !ok {
+		fmt.Fprintf(os.Stderr, "unsupported protocol %s\n", cfg.subprotocol)
+		os.Exit(2)
+	}
+	if initPayload != "" {
+		if !json.Valid([]byte(initPayload)) {
+			fmt.Fprintln(os.Stderr, "-init-payload must be valid JSON")
+			os.Exit(2)
+		}
+		cfg.initPayload = json.RawMessage(initPayload)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	st := newStats()
+	elapsed := run(ctx, cfg, st)
+	st.report(os.Stdout, elapsed)
+}
+
+// run opens the connections, spreading them over the ramp-up period, and keeps them open until the
+// duration elapses or ctx is cancelled.
+func run(ctx context.Context, cfg config, st *stats) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+
+	var spacing time.Duration
+	if cfg.connections > 0 {
+		spacing = cfg.rampUp / time.Duration(cfg.connections)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.connections; i++ {
+		if i > 0 && spacing > 0 {
+			select {
+			case <-time.After(spacing):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			runConnection(ctx, cfg, index, st)
+		}(i)
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+	return time.Since(start)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stats collects the results reported by every connection of a benchmark run.
+type stats struct {
+	mu         sync.Mutex
+	handshakes []time.Duration
+	messages   int64
+	errors     map[string]int
+}
+
+func newStats() *stats {
+	return &stats{errors: map[string]int{}}
+}
+
+func (s *stats) addHandshake(d time.Duration) {
+	s.mu.Lock()
+	s.handshakes = append(s.handshakes, d)
+	s.mu.Unlock()
+}
+
+func (s *stats) addMessage() {
+	s.mu.Lock()
+	s.messages++
+	s.mu.Unlock()
+}
+
+func (s *stats) addError(kind string) {
+	s.mu.Lock()
+	s.errors[kind]++
+	s.mu.Unlock()
+}
+
+// percentile returns the p-th percentile of sorted durations using the nearest rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	handshakes := append([]time.Duration(nil), s.handshakes...)
+	sort.Slice(handshakes, func(i, j int) bool { return handshakes[i] < handshakes[j] })
+
+	fmt.Fprintf(w, "connections established: %d\n", len(handshakes))
+	if len(handshakes) > 0 {
+		fmt.Fprintf(w, "handshake latency: min=%s p50=%s p95=%s p99=%s max=%s\n",
+			handshakes[0],
+			percentile(handshakes, 50),
+			percentile(handshakes, 95),
+			percentile(handshakes, 99),
+			handshakes[len(handshakes)-1],
+		)
+	}
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(s.messages) / elapsed.Seconds()
+	}
+	fmt.Fprintf(w, "messages received: %d (%.1f msg/s)\n", s.messages, rate)
+
+	total := 0
+	kinds := make([]string, 0, len(s.errors))
+	for kind, n := range s.errors {
+		kinds = append(kinds, kind)
+		total += n
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(w, "errors: %d\n", total)
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "  %s: %d\n", kind, s.errors[kind])
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 95*time.Millisecond, percentile(sorted, 95))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+	assert.Equal(t, 1*time.Millisecond, percentile(sorted, 0))
+}
+
+func TestStatsReport(t *testing.T) {
+	s := newStats()
+	s.addHandshake(2 * time.Millisecond)
+	s.addHandshake(1 * time.Millisecond)
+	s.addMessage()
+	s.addMessage()
+	s.addError("dial")
+
+	var out bytes.Buffer
+	s.report(&out, time.Second)
+
+	assert.Contains(t, out.String(), "connections established: 2")
+	assert.Contains(t, out.String(), "min=1ms")
+	assert.Contains(t, out.String(), "messages received: 2 (2.0 msg/s)")
+	assert.Contains(t, out.String(), "dial: 1")
+}
@@ -0,0 +1,156 @@
+// Package collab relays the updates and awareness states of collaborative documents between the
+// clients of the transport's DocumentSync through a pubsub.Broker, e.g. for Yjs or Automerge
+// documents edited from several replicas.
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// leaveTimeout bounds the publication of the awareness of the clients leaving a document.
+const leaveTimeout = 5 * time.Second
+
+// ErrNoClientID is returned for the awareness states of the clients without ClientID.
+var ErrNoClientID = errors.New("collab: no client id")
+
+// Hub is a transport.SyncHandler publishing the updates of the documents to the topic
+// "<prefix><document>/updates" and signaling the awareness states of their clients to
+// "<prefix><document>/awareness/<client>".
+//
+// With a broker keeping a replay buffer, e.g. a pubsub.Memory with a Replay, the updates are
+// numbered by the broker and a client joining a document with the Seq of the last update it has
+// catches up with the following ones, the join fails with pubsub.ErrReplayUnavailable when they
+// were dropped. The clients receive their own updates as well, they are told apart by their
+// ClientID.
+type Hub struct {
+	Broker pubsub.Broker
+	// Prefix is the prefix of the topics of the documents, it defaults to "documents/".
+	Prefix string
+	// Authorize is called with the documents joined, they are all allowed when nil.
+	Authorize func(ctx context.Context, document string) error
+	// ErrorFunc is called with the failures to publish the awareness of the clients leaving.
+	ErrorFunc func(ctx context.Context, err error)
+}
+
+var _ transport.SyncHandler = &Hub{}
+
+// Join implements transport.SyncHandler
+func (h *Hub) Join(ctx context.Context, document string, join transport.SyncFrame) (<-chan transport.SyncFrame, error) {
+	if h.Authorize != nil {
+		if err := h.Authorize(ctx, document); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var updates <-chan pubsub.Message
+	var err error
+	if replayer, ok := h.Broker.(pubsub.Replayer); ok && join.Seq != 0 {
+		updates, err = replayer.SubscribeFrom(ctx, h.topic(document, "updates"), join.Seq)
+	} else {
+		updates, err = h.Broker.Subscribe(ctx, h.topic(document, "updates"))
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	awareness, err := h.Broker.Subscribe(ctx, h.topic(document, "awareness/+"))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	frames := make(chan transport.SyncFrame)
+	go func() {
+		defer close(frames)
+		defer cancel()
+		for updates != nil || awareness != nil {
+			var msg pubsub.Message
+			var ok bool
+			select {
+			case msg, ok = <-updates:
+				if !ok {
+					updates = nil
+					continue
+				}
+			case msg, ok = <-awareness:
+				if !ok {
+					awareness = nil
+					continue
+				}
+			}
+			var frame transport.SyncFrame
+			if err := json.Unmarshal(msg.Payload, &frame); err != nil {
+				continue
+			}
+			if frame.Kind == transport.SyncUpdate {
+				frame.Seq = msg.Seq
+			}
+			select {
+			case frames <- frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if join.ClientID != "" {
+		context.AfterFunc(ctx, func() {
+			// the other clients drop the awareness state of the client
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaveTimeout)
+			defer cancel()
+			err := h.signal(ctx, document, transport.SyncFrame{Kind: transport.SyncAwareness, ClientID: join.ClientID, Awareness: json.RawMessage("null")})
+			if err != nil && h.ErrorFunc != nil {
+				h.ErrorFunc(ctx, err)
+			}
+		})
+	}
+	return frames, nil
+}
+
+// Receive implements transport.SyncHandler, the updates are published and the awareness states
+// signaled, or published when the broker doesn't implement pubsub.Signaler.
+func (h *Hub) Receive(ctx context.Context, document string, frame transport.SyncFrame) error {
+	switch frame.Kind {
+	case transport.SyncUpdate:
+		frame.Seq = 0
+		b, err := json.Marshal(frame)
+		if err != nil {
+			return err
+		}
+		return h.Broker.Publish(ctx, h.topic(document, "updates"), b)
+	case transport.SyncAwareness:
+		return h.signal(ctx, document, frame)
+	}
+	return nil
+}
+
+func (h *Hub) signal(ctx context.Context, document string, frame transport.SyncFrame) error {
+	if frame.ClientID == "" {
+		return ErrNoClientID
+	}
+	b, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	topic := h.topic(document, "awareness/"+frame.ClientID)
+	err = pubsub.Signal(ctx, h.Broker, topic, b)
+	if errors.Is(err, pubsub.ErrSignalUnavailable) {
+		return h.Broker.Publish(ctx, topic, b)
+	}
+	return err
+}
+
+func (h *Hub) topic(document string, kind string) string {
+	prefix := h.Prefix
+	if prefix == "" {
+		prefix = "documents/"
+	}
+	return prefix + document + "/" + kind
+}
@@ -0,0 +1,84 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// receive returns the next frame of a document.
+func receive(t *testing.T, frames <-chan transport.SyncFrame) transport.SyncFrame {
+	t.Helper()
+	select {
+	case frame, ok := <-frames:
+		if !ok {
+			t.Fatal("frames closed")
+		}
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+		return transport.SyncFrame{}
+	}
+}
+
+func TestHub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := &Hub{Broker: &pubsub.Memory{Replay: &pubsub.Replay{}}}
+
+	alice, err := hub.Join(ctx, "42", transport.SyncFrame{Kind: transport.SyncJoin, ClientID: "a"})
+	assert.NoError(t, err)
+	bobCtx, bobCancel := context.WithCancel(ctx)
+	bob, err := hub.Join(bobCtx, "42", transport.SyncFrame{Kind: transport.SyncJoin, ClientID: "b"})
+	assert.NoError(t, err)
+
+	update := transport.SyncFrame{Kind: transport.SyncUpdate, ClientID: "a", Clock: transport.VectorClock{"a": 1}, Update: json.RawMessage(`"AQ=="`)}
+	assert.NoError(t, hub.Receive(ctx, "42", update))
+	assert.NoError(t, hub.Receive(ctx, "42", transport.SyncFrame{Kind: transport.SyncUpdate, ClientID: "a", Clock: transport.VectorClock{"a": 2}, Update: json.RawMessage(`"Ag=="`)}))
+	update.Seq = 1
+	assert.Equal(t, update, receive(t, alice))
+	assert.Equal(t, update, receive(t, bob))
+	assert.Equal(t, uint64(2), receive(t, bob).Seq)
+
+	assert.NoError(t, hub.Receive(ctx, "42", transport.SyncFrame{Kind: transport.SyncAwareness, ClientID: "b", Awareness: json.RawMessage(`{"cursor":3}`)}))
+	// the update 2 and the awareness state may come in any order
+	kinds := map[transport.SyncKind]transport.SyncFrame{}
+	for i := 0; i < 2; i++ {
+		frame := receive(t, alice)
+		kinds[frame.Kind] = frame
+	}
+	assert.Equal(t, uint64(2), kinds[transport.SyncUpdate].Seq)
+	assert.JSONEq(t, `{"cursor":3}`, string(kinds[transport.SyncAwareness].Awareness))
+	assert.Equal(t, ErrNoClientID, hub.Receive(ctx, "42", transport.SyncFrame{Kind: transport.SyncAwareness}))
+
+	// the awareness state of a client leaving is cleared
+	bobCancel()
+	for range bob {
+	}
+	frame := receive(t, alice)
+	assert.Equal(t, "b", frame.ClientID)
+	assert.Equal(t, "null", string(frame.Awareness))
+
+	// a client catches up from the last update it has
+	carol, err := hub.Join(ctx, "42", transport.SyncFrame{Kind: transport.SyncJoin, Seq: 1})
+	assert.NoError(t, err)
+	frame = receive(t, carol)
+	assert.Equal(t, uint64(2), frame.Seq)
+	assert.Equal(t, `"Ag=="`, string(frame.Update))
+}
+
+func TestHubAuthorize(t *testing.T) {
+	hub := &Hub{
+		Broker: pubsub.NewMemory(),
+		Authorize: func(ctx context.Context, document string) error {
+			return pubsub.ErrForbidden
+		},
+	}
+	_, err := hub.Join(context.Background(), "42", transport.SyncFrame{Kind: transport.SyncJoin})
+	assert.Equal(t, pubsub.ErrForbidden, err)
+}
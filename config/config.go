@@ -0,0 +1,228 @@
+// Package config loads the settings of the websocket transport from environment variables or from
+// a YAML or JSON file, e.g. to deploy the same binary in several environments.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a string, e.g. "1m30s".
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config holds the settings of a transport.Websocket. The env tags are the names of the
+// environment variables read by FromEnv, after the prefix.
+type Config struct {
+	InitTimeout        Duration `json:"initTimeout" yaml:"initTimeout" env:"INIT_TIMEOUT"`
+	KeepAliveInterval  Duration `json:"keepAliveInterval" yaml:"keepAliveInterval" env:"KEEP_ALIVE_INTERVAL"`
+	PingPongInterval   Duration `json:"pingPongInterval" yaml:"pingPongInterval" env:"PING_PONG_INTERVAL"`
+	PongWaitMultiplier int      `json:"pongWaitMultiplier" yaml:"pongWaitMultiplier" env:"PONG_WAIT_MULTIPLIER"`
+	MaxMissedPongs     int      `json:"maxMissedPongs" yaml:"maxMissedPongs" env:"MAX_MISSED_PONGS"`
+	RetryAfter         Duration `json:"retryAfter" yaml:"retryAfter" env:"RETRY_AFTER"`
+	StrictProtocol     bool     `json:"strictProtocol" yaml:"strictProtocol" env:"STRICT_PROTOCOL"`
+
+	// Compression negotiates per message compression, it requires a websocket library supporting
+	// it, see transport.CompressionSupported.
+	Compression bool `json:"compression" yaml:"compression" env:"COMPRESSION"`
+	// AllowedOrigins are the origins allowed to connect, e.g. "https://example.com", "*" allows
+	// any origin. The origin must match the host of the request when empty.
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins" env:"ALLOWED_ORIGINS"`
+
+	// MaxMessages, MaxBytes and QuotaInterval set the transport.Quota of every connection, no quota
+	// is set when MaxMessages and MaxBytes are zero.
+	MaxMessages   int      `json:"maxMessages" yaml:"maxMessages" env:"MAX_MESSAGES"`
+	MaxBytes      int      `json:"maxBytes" yaml:"maxBytes" env:"MAX_BYTES"`
+	QuotaInterval Duration `json:"quotaInterval" yaml:"quotaInterval" env:"QUOTA_INTERVAL"`
+}
+
+// FromFile reads a configuration from a YAML file, or a JSON file when its extension is .json.
+// Unknown settings are rejected.
+func FromFile(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&c)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err = dec.Decode(&c); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// FromEnv reads a configuration from the environment variables named after the env tags of
+// Config, with the prefix, e.g. GRAPHQLWS_INIT_TIMEOUT=5s for the prefix "GRAPHQLWS_". Lists are
+// comma separated.
+func FromEnv(prefix string) (*Config, error) {
+	var c Config
+	if err := c.ApplyEnv(prefix); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ApplyEnv overrides the settings whose environment variable is set, e.g. to adjust a
+// configuration read from a file.
+func (c *Config) ApplyEnv(prefix string) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := prefix + v.Type().Field(i).Tag.Get("env")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		return field.Addr().Interface().(*Duration).UnmarshalText([]byte(value))
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
+
+// Validate returns an error if a setting is invalid.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Compression && !transport.CompressionSupported {
+		errs = append(errs, errors.New("compression isn't supported by the websocket library"))
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid allowed origin %q", origin))
+		}
+	}
+	if c.MaxMessages < 0 || c.MaxBytes < 0 || c.QuotaInterval < 0 {
+		errs = append(errs, errors.New("negative quota"))
+	}
+	if err := c.websocket().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Options returns the options configuring a transport.Websocket, to be combined with the options
+// of the application in transport.NewWebsocket.
+func (c *Config) Options() []transport.Option {
+	opts := []transport.Option{
+		transport.WithInitTimeout(time.Duration(c.InitTimeout)),
+		transport.WithKeepAlive(time.Duration(c.KeepAliveInterval)),
+		transport.WithPingPong(time.Duration(c.PingPongInterval), c.PongWaitMultiplier),
+		transport.WithCompression(c.Compression),
+		func(t *transport.Websocket) {
+			t.MaxMissedPongs = c.MaxMissedPongs
+			t.RetryAfter = time.Duration(c.RetryAfter)
+			t.StrictProtocol = c.StrictProtocol
+		},
+	}
+	if len(c.AllowedOrigins) != 0 {
+		opts = append(opts, transport.WithCheckOrigin(allowOrigins(c.AllowedOrigins)))
+	}
+	if c.MaxMessages != 0 || c.MaxBytes != 0 {
+		quota := &transport.Quota{MaxMessages: c.MaxMessages, MaxBytes: c.MaxBytes, Interval: time.Duration(c.QuotaInterval)}
+		opts = append(opts, func(t *transport.Websocket) { t.Quota = quota })
+	}
+	return opts
+}
+
+// websocket returns the Websocket configured by c alone.
+func (c *Config) websocket() *transport.Websocket {
+	t := &transport.Websocket{}
+	for _, opt := range c.Options() {
+		opt(t)
+	}
+	return t
+}
+
+// allowOrigins returns a CheckOrigin accepting the requests without an origin or from one of
+// the origins.
+func allowOrigins(origins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range origins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
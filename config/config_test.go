@@ -0,0 +1,113 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFromFile(t *testing.T) {
+	expected := &Config{
+		InitTimeout:       Duration(5 * time.Second),
+		KeepAliveInterval: Duration(10 * time.Second),
+		AllowedOrigins:    []string{"https://example.com"},
+		MaxMessages:       100,
+		QuotaInterval:     Duration(time.Minute),
+	}
+
+	c, err := FromFile(writeFile(t, "config.yaml", `
+initTimeout: 5s
+keepAliveInterval: 10s
+allowedOrigins:
+  - https://example.com
+maxMessages: 100
+quotaInterval: 1m
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, c)
+
+	c, err = FromFile(writeFile(t, "config.json", `{
+	"initTimeout": "5s",
+	"keepAliveInterval": "10s",
+	"allowedOrigins": ["https://example.com"],
+	"maxMessages": 100,
+	"quotaInterval": "1m"
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, c)
+
+	_, err = FromFile(writeFile(t, "config.yaml", "initTimeot: 5s"))
+	assert.Error(t, err, "Expected unknown settings to be rejected")
+	_, err = FromFile(writeFile(t, "config.json", `{"initTimeout": "5 seconds"}`))
+	assert.Error(t, err)
+	_, err = FromFile(writeFile(t, "config.yaml", "initTimeout: -5s"))
+	assert.EqualError(t, err, "InitTimeout is negative")
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("TEST_PING_PONG_INTERVAL", "2s")
+	t.Setenv("TEST_PONG_WAIT_MULTIPLIER", "3")
+	t.Setenv("TEST_STRICT_PROTOCOL", "true")
+	t.Setenv("TEST_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	c, err := FromEnv("TEST_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &Config{
+		PingPongInterval:   Duration(2 * time.Second),
+		PongWaitMultiplier: 3,
+		StrictProtocol:     true,
+		AllowedOrigins:     []string{"https://a.example.com", "https://b.example.com"},
+	}, c)
+
+	t.Setenv("TEST_MAX_BYTES", "many")
+	_, err = FromEnv("TEST_")
+	assert.EqualError(t, err, `TEST_MAX_BYTES: strconv.Atoi: parsing "many": invalid syntax`)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Error(t, (&Config{AllowedOrigins: []string{"example.com"}}).Validate())
+	assert.Error(t, (&Config{MaxBytes: -1}).Validate())
+	assert.NoError(t, (&Config{AllowedOrigins: []string{"*"}}).Validate())
+	assert.Equal(t, !transport.CompressionSupported, (&Config{Compression: true}).Validate() != nil)
+}
+
+func TestOptions(t *testing.T) {
+	c := &Config{
+		InitTimeout:    Duration(5 * time.Second),
+		RetryAfter:     Duration(time.Minute),
+		AllowedOrigins: []string{"https://example.com"},
+		MaxMessages:    10,
+	}
+	ws, err := transport.NewWebsocket(c.Options()...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 5*time.Second, ws.InitTimeout)
+	assert.Equal(t, time.Minute, ws.RetryAfter)
+	if assert.NotNil(t, ws.Quota) {
+		assert.Equal(t, 10, ws.Quota.MaxMessages)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+	assert.True(t, ws.Upgrader.CheckOrigin(r))
+	r.Header.Set("Origin", "https://example.com")
+	assert.True(t, ws.Upgrader.CheckOrigin(r))
+	r.Header.Set("Origin", "https://evil.example.com")
+	assert.False(t, ws.Upgrader.CheckOrigin(r))
+}
@@ -0,0 +1,172 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type entitiesResponse struct {
+	Data struct {
+		Entities []interface{} `json:"_entities"`
+	} `json:"data"`
+	Errors gqlerror.List `json:"errors"`
+}
+
+// resolve resolves the fields of the entities of an event owned by other subgraphs.
+func (g *Gateway) resolve(ctx context.Context, p *plan, variables map[string]interface{}, payload json.RawMessage) *response {
+	var res response
+	if err := jsonDecode(payload, &res); err != nil {
+		return &response{Errors: gqlerror.List{gqlerror.Errorf("subgraph %s: invalid payload: %s", p.subgraph, err)}}
+	}
+	if res.Data == nil {
+		return &res
+	}
+
+	for _, f := range p.fetches {
+		res.Errors = append(res.Errors, g.execute(ctx, f, []interface{}{res.Data}, variables)...)
+	}
+	stripInjected(res.Data)
+	return &res
+}
+
+// execute resolves a fetch for the entities found under roots, then its nested fetches.
+func (g *Gateway) execute(ctx context.Context, f *fetch, roots []interface{}, variables map[string]interface{}) gqlerror.List {
+	var entities []map[string]interface{}
+	for _, root := range roots {
+		collect(root, f.path, func(obj map[string]interface{}) {
+			if obj[typenameAlias] == f.typeName {
+				entities = append(entities, obj)
+			}
+		})
+	}
+	if len(entities) == 0 {
+		return nil
+	}
+
+	representations := make([]interface{}, len(entities))
+	for i, entity := range entities {
+		representation := map[string]interface{}{"__typename": f.typeName}
+		for _, key := range f.keys {
+			representation[key] = entity[injectedPrefix+key]
+		}
+		representations[i] = representation
+	}
+	vars := selectVariables(variables, f.variables)
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	vars[representationsName] = representations
+
+	var res entitiesResponse
+	if err := g.query(ctx, f.subgraph, f.query, vars, &res); err != nil {
+		return gqlerror.List{gqlerror.Errorf("subgraph %s: %s", f.subgraph, err)}
+	}
+
+	errs := res.Errors
+	resolved := make([]interface{}, 0, len(entities))
+	for i, entity := range entities {
+		if i >= len(res.Data.Entities) {
+			break
+		}
+		if fields, ok := res.Data.Entities[i].(map[string]interface{}); ok {
+			merge(entity, fields)
+			resolved = append(resolved, entity)
+		}
+	}
+	for _, nested := range f.fetches {
+		errs = append(errs, g.execute(ctx, nested, resolved, variables)...)
+	}
+	return errs
+}
+
+// query sends a query to the HTTP endpoint of a subgraph.
+func (g *Gateway) query(ctx context.Context, name string, query string, variables map[string]interface{}, v interface{}) error {
+	subgraph := g.Subgraphs[name]
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subgraph.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range subgraph.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := g.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// collect calls fn with the objects found at path under value, lists are flattened.
+func collect(value interface{}, path []string, fn func(map[string]interface{})) {
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			collect(item, path, fn)
+		}
+	case map[string]interface{}:
+		if len(path) == 0 {
+			fn(value)
+			return
+		}
+		collect(value[path[0]], path[1:], fn)
+	}
+}
+
+// merge merges the fields resolved by a subgraph into an entity.
+func merge(dst map[string]interface{}, src map[string]interface{}) {
+	for key, value := range src {
+		existing, ok := dst[key].(map[string]interface{})
+		if fields, isObject := value.(map[string]interface{}); ok && isObject {
+			merge(existing, fields)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// stripInjected removes the fields added to the queries sent to the subgraphs.
+func stripInjected(value interface{}) {
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			stripInjected(item)
+		}
+	case map[string]interface{}:
+		for key, field := range value {
+			if strings.HasPrefix(key, injectedPrefix) {
+				delete(value, key)
+				continue
+			}
+			stripInjected(field)
+		}
+	}
+}
+
+func jsonDecode(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,162 @@
+// Package federation serves the subscriptions of a federated graph: the subscriptions are run by
+// the subgraph owning their root field and the fields of their entities owned by other subgraphs
+// are resolved for every event.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/client"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// Subgraph is a service of the federated graph.
+type Subgraph struct {
+	// URL is the HTTP endpoint answering the _entities queries.
+	URL string
+	// WebsocketURL is the graphql-transport-ws endpoint running the subscriptions owned by the
+	// subgraph.
+	WebsocketURL string
+	// Header is sent with the requests to the subgraph.
+	Header http.Header
+}
+
+var _ transport.GraphQLService = &Gateway{}
+
+// Gateway is a GraphQLService forwarding the subscriptions to the subgraphs owning them over
+// graphql-transport-ws. The fields of the entities of the events owned by other subgraphs are
+// resolved with _entities queries, as with Apollo Federation. Entity keys must be scalar fields.
+type Gateway struct {
+	// Schema is the schema of the federated graph, as seen by the clients.
+	Schema *ast.Schema
+	// Subgraphs are the services of the graph by name.
+	Subgraphs map[string]Subgraph
+	// Owners maps the "Type.field" coordinates to the subgraphs resolving them. Every root
+	// subscription field must be listed, the fields that aren't listed are resolved by the
+	// subgraph resolving their parent.
+	Owners map[string]string
+	// Keys maps the entity types to the names of their key fields.
+	Keys map[string][]string
+	// HTTPClient sends the _entities queries, it defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	mu      sync.Mutex
+	clients map[string]*client.Client
+}
+
+type response struct {
+	Data       interface{}     `json:"data"`
+	Errors     gqlerror.List   `json:"errors,omitempty"`
+	Extensions json.RawMessage `json:"extensions,omitempty"`
+}
+
+// Subscribe implements transport.GraphQLService
+func (g *Gateway) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	doc, errs := gqlparser.LoadQuery(g.Schema, document)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	op := doc.Operations.ForName(operationName)
+	if op == nil {
+		return nil, fmt.Errorf("operation %s not found", operationName)
+	}
+	p, err := g.plan(op)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := g.client(ctx, p.subgraph)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := c.Subscribe(ctx, client.Request{
+		Query:         p.query,
+		OperationName: op.Name,
+		Variables:     selectVariables(variableValues, p.variables),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make(chan interface{})
+	go func() {
+		defer close(payloads)
+		for payload := range sub.Payloads() {
+			select {
+			case payloads <- g.resolve(ctx, p, variableValues, payload):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		var errs gqlerror.List
+		if err := sub.Err(); err != nil && ctx.Err() == nil {
+			if list, ok := err.(gqlerror.List); ok {
+				errs = list
+			} else {
+				errs = gqlerror.List{gqlerror.Errorf("subgraph %s: %s", p.subgraph, err)}
+			}
+			select {
+			case payloads <- &response{Errors: errs}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return payloads, nil
+}
+
+// client returns the connection to the subgraph, it is dialed again once closed.
+func (g *Gateway) client(ctx context.Context, name string) (*client.Client, error) {
+	subgraph, ok := g.Subgraphs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown subgraph %s", name)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.clients[name]; ok && c.Err() == nil {
+		return c, nil
+	}
+
+	c, err := client.Dial(ctx, subgraph.WebsocketURL, client.WithHeader(subgraph.Header))
+	if err != nil {
+		return nil, fmt.Errorf("subgraph %s: %w", name, err)
+	}
+	if g.clients == nil {
+		g.clients = map[string]*client.Client{}
+	}
+	g.clients[name] = c
+	return c, nil
+}
+
+// Close closes the connections to the subgraphs.
+func (g *Gateway) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for name, c := range g.clients {
+		_ = c.Close()
+		delete(g.clients, name)
+	}
+	return nil
+}
+
+func selectVariables(values map[string]interface{}, names []string) map[string]interface{} {
+	if len(names) == 0 {
+		return nil
+	}
+	selected := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if value, ok := values[name]; ok {
+			selected[name] = value
+		}
+	}
+	return selected
+}
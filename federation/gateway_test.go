@@ -0,0 +1,149 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// newSubgraphServer serves a graphql-transport-ws subgraph sending events to the subscriptions.
+func newSubgraphServer(t *testing.T, subscribed chan<- json.RawMessage, events ...string) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var m wsMessage
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			switch m.Type {
+			case "connection_init":
+				_ = conn.WriteJSON(wsMessage{Type: "connection_ack"})
+			case "subscribe":
+				subscribed <- m.Payload
+				for _, event := range events {
+					_ = conn.WriteJSON(wsMessage{ID: m.ID, Type: "next", Payload: json.RawMessage(event)})
+				}
+				_ = conn.WriteJSON(wsMessage{ID: m.ID, Type: "complete"})
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// newEntitiesServer serves the _entities queries of a subgraph with resolve.
+func newEntitiesServer(t *testing.T, resolve func(representation map[string]interface{}) interface{}) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string `json:"query"`
+			Variables struct {
+				Representations []map[string]interface{} `json:"representations"`
+			} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entities := make([]interface{}, len(req.Variables.Representations))
+		for i, representation := range req.Variables.Representations {
+			entities[i] = resolve(representation)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"_entities": entities}})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestGatewaySubscribe(t *testing.T) {
+	subscribed := make(chan json.RawMessage, 1)
+	g := newTestGateway()
+	g.Subgraphs = map[string]Subgraph{
+		"reviews": {WebsocketURL: newSubgraphServer(t, subscribed,
+			`{"data":{"reviewAdded":{"body":"great","author":{"_fed_typename":"User","_fed_id":"1"}}}}`,
+			`{"data":{"reviewAdded":{"body":"meh","author":{"_fed_typename":"User","_fed_id":"2"}}}}`,
+		)},
+		"accounts": {URL: newEntitiesServer(t, func(representation map[string]interface{}) interface{} {
+			return map[string]interface{}{"name": "user " + representation["id"].(string)}
+		})},
+	}
+	t.Cleanup(func() { _ = g.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payloads, err := g.Subscribe(ctx, `subscription($upc: ID!) { reviewAdded(product: $upc) { body author { name } } }`, "", map[string]interface{}{"upc": "p1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	assert.NoError(t, json.Unmarshal(<-subscribed, &req))
+	assert.Contains(t, req.Query, "_fed_id: id")
+	assert.Equal(t, map[string]interface{}{"upc": "p1"}, req.Variables)
+
+	var bodies []string
+	for payload := range payloads {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(b))
+	}
+	assert.Equal(t, []string{
+		`{"data":{"reviewAdded":{"author":{"name":"user 1"},"body":"great"}}}`,
+		`{"data":{"reviewAdded":{"author":{"name":"user 2"},"body":"meh"}}}`,
+	}, bodies)
+}
+
+func TestGatewaySubscribeEntitiesError(t *testing.T) {
+	subscribed := make(chan json.RawMessage, 1)
+	g := newTestGateway()
+	g.Subgraphs = map[string]Subgraph{
+		"reviews": {WebsocketURL: newSubgraphServer(t, subscribed,
+			`{"data":{"reviewAdded":{"body":"great","author":{"_fed_typename":"User","_fed_id":"1"}}}}`,
+		)},
+		"accounts": {URL: "http://127.0.0.1:0"},
+	}
+	t.Cleanup(func() { _ = g.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payloads, err := g.Subscribe(ctx, `subscription { reviewAdded(product: "1") { body author { name } } }`, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := (<-payloads).(*response)
+	assert.Equal(t, map[string]interface{}{"reviewAdded": map[string]interface{}{"body": "great", "author": map[string]interface{}{}}}, res.Data)
+	if assert.Len(t, res.Errors, 1) {
+		assert.Contains(t, res.Errors[0].Message, "subgraph accounts")
+	}
+}
+
+func TestGatewaySubscribeUnknownSubgraph(t *testing.T) {
+	g := newTestGateway()
+	_, err := g.Subscribe(context.Background(), `subscription { priceChanged { name } }`, "", nil)
+	assert.EqualError(t, err, "unknown subgraph products")
+}
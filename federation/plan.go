@@ -0,0 +1,263 @@
+package federation
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+)
+
+// injectedPrefix prefixes the aliases of the fields added to the queries sent to the subgraphs,
+// they are removed from the responses sent to the clients.
+const injectedPrefix = "_fed_"
+
+const (
+	typenameAlias       = injectedPrefix + "typename"
+	representationsName = "representations"
+)
+
+// plan is a subscription split between the subgraph running it and the subgraphs resolving the
+// fields of its entities.
+type plan struct {
+	subgraph  string
+	query     string
+	variables []string
+	fetches   []*fetch
+}
+
+// fetch resolves fields of the entities found at a path of the result from another subgraph.
+type fetch struct {
+	subgraph  string
+	typeName  string
+	keys      []string
+	path      []string
+	query     string
+	variables []string
+	fetches   []*fetch
+}
+
+type planner struct {
+	schema *ast.Schema
+	owners map[string]string
+	keys   map[string][]string
+	op     *ast.OperationDefinition
+}
+
+func (g *Gateway) plan(op *ast.OperationDefinition) (*plan, error) {
+	if op.Operation != ast.Subscription {
+		return nil, fmt.Errorf("the gateway only serves subscriptions, got a %s", op.Operation)
+	}
+	p := &planner{schema: g.Schema, owners: g.Owners, keys: g.Keys, op: op}
+
+	root := p.schema.Subscription
+	var subgraph string
+	for _, selection := range op.SelectionSet {
+		field, ok := selection.(*ast.Field)
+		if !ok {
+			return nil, fmt.Errorf("fragments are not supported at the root of subscriptions")
+		}
+		if field.Name == "__typename" {
+			continue
+		}
+		owner, ok := p.owners[root.Name+"."+field.Name]
+		if !ok {
+			return nil, fmt.Errorf("no subgraph owns %s.%s", root.Name, field.Name)
+		}
+		if subgraph != "" && owner != subgraph {
+			return nil, fmt.Errorf("the subscription spans the subgraphs %s and %s", subgraph, owner)
+		}
+		subgraph = owner
+	}
+
+	selections, fetches, err := p.split(subgraph, root, op.SelectionSet, nil)
+	if err != nil {
+		return nil, err
+	}
+	query, variables := p.format(&ast.OperationDefinition{
+		Operation:    ast.Subscription,
+		Name:         op.Name,
+		SelectionSet: selections,
+	}, nil)
+	return &plan{subgraph: subgraph, query: query, variables: variables, fetches: fetches}, nil
+}
+
+// split returns the selections of set resolved by subgraph, along with the fetches resolving the
+// other ones. The key fields of the entities are added to the selections when they are needed.
+func (p *planner) split(subgraph string, parent *ast.Definition, set ast.SelectionSet, path []string) (ast.SelectionSet, []*fetch, error) {
+	var kept ast.SelectionSet
+	var fetches []*fetch
+	remote := map[string]ast.SelectionSet{}
+	var remoteOrder []string
+
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			owner := subgraph
+			if o, ok := p.owners[parent.Name+"."+selection.Name]; ok && !strings.HasPrefix(selection.Name, "__") {
+				owner = o
+			}
+			if owner != subgraph {
+				if _, ok := remote[owner]; !ok {
+					remoteOrder = append(remoteOrder, owner)
+				}
+				remote[owner] = append(remote[owner], selection)
+				continue
+			}
+
+			field := *selection
+			if len(selection.SelectionSet) != 0 {
+				child := p.schema.Types[selection.Definition.Type.Name()]
+				selections, childFetches, err := p.split(subgraph, child, selection.SelectionSet, appendPath(path, selection.Alias))
+				if err != nil {
+					return nil, nil, err
+				}
+				field.SelectionSet = selections
+				fetches = append(fetches, childFetches...)
+			}
+			kept = append(kept, &field)
+		case *ast.InlineFragment:
+			selections, fragmentFetches, err := p.fragment(subgraph, parent, selection.TypeCondition, selection.SelectionSet, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			kept = append(kept, &ast.InlineFragment{TypeCondition: selection.TypeCondition, Directives: selection.Directives, SelectionSet: selections})
+			fetches = append(fetches, fragmentFetches...)
+		case *ast.FragmentSpread:
+			def := selection.Definition
+			selections, fragmentFetches, err := p.fragment(subgraph, parent, def.TypeCondition, def.SelectionSet, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			kept = append(kept, &ast.InlineFragment{TypeCondition: def.TypeCondition, Directives: selection.Directives, SelectionSet: selections})
+			fetches = append(fetches, fragmentFetches...)
+		}
+	}
+
+	if len(remote) == 0 {
+		return kept, fetches, nil
+	}
+	keys, ok := p.keys[parent.Name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s has fields of other subgraphs but isn't an entity", parent.Name)
+	}
+	kept = append(kept, &ast.Field{Alias: typenameAlias, Name: "__typename"})
+	for _, key := range keys {
+		kept = append(kept, &ast.Field{Alias: injectedPrefix + key, Name: key})
+	}
+
+	for _, owner := range remoteOrder {
+		f, err := p.entityFetch(owner, parent, keys, remote[owner], path)
+		if err != nil {
+			return nil, nil, err
+		}
+		fetches = append(fetches, f)
+	}
+	return kept, fetches, nil
+}
+
+func (p *planner) fragment(subgraph string, parent *ast.Definition, typeCondition string, set ast.SelectionSet, path []string) (ast.SelectionSet, []*fetch, error) {
+	if typeCondition != "" {
+		parent = p.schema.Types[typeCondition]
+	}
+	return p.split(subgraph, parent, set, path)
+}
+
+// entityFetch plans the resolution of the selections of an entity by the subgraph owning them.
+func (p *planner) entityFetch(subgraph string, entity *ast.Definition, keys []string, set ast.SelectionSet, path []string) (*fetch, error) {
+	selections, fetches, err := p.split(subgraph, entity, set, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := &ast.Field{
+		Alias: "_entities",
+		Name:  "_entities",
+		Arguments: ast.ArgumentList{{
+			Name:  representationsName,
+			Value: &ast.Value{Kind: ast.Variable, Raw: representationsName},
+		}},
+		SelectionSet: ast.SelectionSet{&ast.InlineFragment{TypeCondition: entity.Name, SelectionSet: selections}},
+	}
+	representations := &ast.VariableDefinition{
+		Variable: representationsName,
+		Type:     ast.NonNullListType(ast.NonNullNamedType("_Any", nil), nil),
+	}
+	query, variables := p.format(&ast.OperationDefinition{
+		Operation:    ast.Query,
+		SelectionSet: ast.SelectionSet{entities},
+	}, representations)
+
+	return &fetch{
+		subgraph:  subgraph,
+		typeName:  entity.Name,
+		keys:      keys,
+		path:      path,
+		query:     query,
+		variables: variables,
+		fetches:   fetches,
+	}, nil
+}
+
+// format formats the operation, declaring the variables of the client operation it uses. It
+// returns the names of these variables.
+func (p *planner) format(op *ast.OperationDefinition, extra *ast.VariableDefinition) (string, []string) {
+	used := map[string]bool{}
+	collectVariables(op.SelectionSet, used)
+
+	var variables []string
+	if extra != nil {
+		op.VariableDefinitions = append(op.VariableDefinitions, extra)
+	}
+	for _, def := range p.op.VariableDefinitions {
+		if used[def.Variable] {
+			op.VariableDefinitions = append(op.VariableDefinitions, def)
+			variables = append(variables, def.Variable)
+		}
+	}
+
+	var buf bytes.Buffer
+	formatter.NewFormatter(&buf).FormatQueryDocument(&ast.QueryDocument{Operations: ast.OperationList{op}})
+	return buf.String(), variables
+}
+
+func collectVariables(set ast.SelectionSet, used map[string]bool) {
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			for _, arg := range selection.Arguments {
+				collectValueVariables(arg.Value, used)
+			}
+			collectDirectivesVariables(selection.Directives, used)
+			collectVariables(selection.SelectionSet, used)
+		case *ast.InlineFragment:
+			collectDirectivesVariables(selection.Directives, used)
+			collectVariables(selection.SelectionSet, used)
+		}
+	}
+}
+
+func collectDirectivesVariables(directives ast.DirectiveList, used map[string]bool) {
+	for _, directive := range directives {
+		for _, arg := range directive.Arguments {
+			collectValueVariables(arg.Value, used)
+		}
+	}
+}
+
+func collectValueVariables(value *ast.Value, used map[string]bool) {
+	if value == nil {
+		return
+	}
+	if value.Kind == ast.Variable {
+		used[value.Raw] = true
+	}
+	for _, child := range value.Children {
+		collectValueVariables(child.Value, used)
+	}
+}
+
+func appendPath(path []string, key string) []string {
+	return append(path[:len(path):len(path)], key)
+}
@@ -0,0 +1,136 @@
+package federation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var testSchema = gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Query { me: User }
+	type Subscription {
+		reviewAdded(product: ID!): Review
+		priceChanged: Product
+		ping: String
+	}
+	type Review { id: ID! body: String! author: User! product: Product! }
+	type User { id: ID! name: String! }
+	type Product { upc: ID! name: String! price(currency: String): Int reviews: [Review!]! }
+`})
+
+func newTestGateway() *Gateway {
+	return &Gateway{
+		Schema: testSchema,
+		Owners: map[string]string{
+			"Subscription.reviewAdded":  "reviews",
+			"Subscription.priceChanged": "products",
+			"User.name":                 "accounts",
+			"Product.name":              "products",
+			"Product.price":             "products",
+			"Product.reviews":           "reviews",
+		},
+		Keys: map[string][]string{
+			"User":    {"id"},
+			"Product": {"upc"},
+		},
+	}
+}
+
+func planQuery(g *Gateway, query string) (*plan, error) {
+	doc, errs := gqlparser.LoadQuery(g.Schema, query)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	return g.plan(doc.Operations[0])
+}
+
+func TestPlan(t *testing.T) {
+	p, err := planQuery(newTestGateway(), `subscription OnReview($upc: ID!, $currency: String) {
+		reviewAdded(product: $upc) {
+			body
+			author { name }
+			product { ... on Product { price(currency: $currency) } }
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "reviews", p.subgraph)
+	assert.Equal(t, []string{"upc"}, p.variables)
+	assert.Equal(t, `subscription OnReview ($upc: ID!) {
+	reviewAdded(product: $upc) {
+		body
+		author {
+			_fed_typename: __typename
+			_fed_id: id
+		}
+		product {
+			... on Product {
+				_fed_typename: __typename
+				_fed_upc: upc
+			}
+		}
+	}
+}
+`, p.query)
+
+	if assert.Len(t, p.fetches, 2) {
+		author, product := p.fetches[0], p.fetches[1]
+		assert.Equal(t, "accounts", author.subgraph)
+		assert.Equal(t, "User", author.typeName)
+		assert.Equal(t, []string{"id"}, author.keys)
+		assert.Equal(t, []string{"reviewAdded", "author"}, author.path)
+		assert.Empty(t, author.variables)
+		assert.Equal(t, `query ($representations: [_Any!]!) {
+	_entities(representations: $representations) {
+		... on User {
+			name
+		}
+	}
+}
+`, author.query)
+
+		assert.Equal(t, "products", product.subgraph)
+		assert.Equal(t, []string{"reviewAdded", "product"}, product.path)
+		assert.Equal(t, []string{"currency"}, product.variables)
+		assert.Contains(t, product.query, "price(currency: $currency)")
+	}
+}
+
+func TestPlanNestedFetches(t *testing.T) {
+	p, err := planQuery(newTestGateway(), `subscription { priceChanged { name reviews { body author { name } } } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "products", p.subgraph)
+	if assert.Len(t, p.fetches, 1) {
+		reviews := p.fetches[0]
+		assert.Equal(t, "reviews", reviews.subgraph)
+		assert.Equal(t, []string{"priceChanged"}, reviews.path)
+		if assert.Len(t, reviews.fetches, 1) {
+			assert.Equal(t, "accounts", reviews.fetches[0].subgraph)
+			assert.Equal(t, []string{"reviews", "author"}, reviews.fetches[0].path)
+		}
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	g := newTestGateway()
+	for query, message := range map[string]string{
+		"query { me { id } }":   "the gateway only serves subscriptions, got a query",
+		"subscription { ping }": "no subgraph owns Subscription.ping",
+	} {
+		_, err := planQuery(g, query)
+		if assert.Error(t, err, query) {
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+
+	delete(g.Keys, "User")
+	_, err := planQuery(g, `subscription { reviewAdded(product: "1") { author { name } } }`)
+	assert.EqualError(t, err, "User has fields of other subgraphs but isn't an entity")
+}
@@ -5,12 +5,11 @@ import (
 	"time"
 
 	"github.com/annibuliful-lab/graphqlws-subscription/transport"
-	"github.com/gorilla/websocket"
 )
 
 type GraphQLService = transport.GraphQLService
 
-var defaultUpgrader = websocket.Upgrader{
+var defaultUpgrader = transport.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
@@ -0,0 +1,183 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/redis"
+)
+
+var errUnexpectedRangeReply = errors.New("presence: unexpected ZRANGE reply")
+
+// RedisStore is a Store shared by every node connected to the same Redis server. The presences of
+// a topic are stored in a hash by id, next to a sorted set of their ids scored by their expiry, so
+// that listing a topic reads its own keys only. Both keys expire with the last presence of the
+// topic. Diffs are relayed through a pub/sub channel.
+type RedisStore struct {
+	client redis.Client
+	prefix string
+	// now returns the time the presences expire from
+	now func() time.Time
+}
+
+var _ Store = &RedisStore{}
+
+// NewRedisStore returns a store whose keys and channel are prefixed with prefix, it defaults to
+// "graphqlws:".
+func NewRedisStore(client redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "graphqlws:"
+	}
+	return &RedisStore{client: client, prefix: prefix, now: time.Now}
+}
+
+func (r *RedisStore) presencesKey(topic string) string {
+	return r.prefix + "presences:" + topic
+}
+
+func (r *RedisStore) expiriesKey(topic string) string {
+	return r.prefix + "presence-expiries:" + topic
+}
+
+func (r *RedisStore) diffsChannel() string {
+	return r.prefix + "presence-diffs"
+}
+
+// Track implements Store
+func (r *RedisStore) Track(ctx context.Context, p Presence, ttl time.Duration) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	presences, expiries := r.presencesKey(p.Topic), r.expiriesKey(p.Topic)
+	if _, err := r.client.Do(ctx, "HSET", presences, p.ID, b); err != nil {
+		return err
+	}
+	if _, err := r.client.Do(ctx, "ZADD", expiries, r.now().Add(ttl).UnixMilli(), p.ID); err != nil {
+		return err
+	}
+
+	// the keys expire with the presence expiring last
+	last, err := redis.Strings(r.client.Do(ctx, "ZRANGE", expiries, -1, -1, "WITHSCORES"))
+	if err != nil {
+		return err
+	}
+	if len(last) != 2 {
+		return errUnexpectedRangeReply
+	}
+	expiresAt, err := strconv.ParseFloat(last[1], 64)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{presences, expiries} {
+		if _, err := r.client.Do(ctx, "PEXPIREAT", key, int64(expiresAt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Untrack implements Store
+func (r *RedisStore) Untrack(ctx context.Context, topic string, id string) error {
+	if _, err := r.client.Do(ctx, "ZREM", r.expiriesKey(topic), id); err != nil {
+		return err
+	}
+	_, err := r.client.Do(ctx, "HDEL", r.presencesKey(topic), id)
+	return err
+}
+
+// List implements Store. The expired presences of the topic are removed.
+func (r *RedisStore) List(ctx context.Context, topic string) ([]Presence, error) {
+	presences, expiries := r.presencesKey(topic), r.expiriesKey(topic)
+	now := r.now().UnixMilli()
+
+	expired, err := redis.Strings(r.client.Do(ctx, "ZRANGEBYSCORE", expiries, "-inf", now))
+	if err != nil {
+		return nil, err
+	}
+	if len(expired) > 0 {
+		if _, err := r.client.Do(ctx, "ZREMRANGEBYSCORE", expiries, "-inf", now); err != nil {
+			return nil, err
+		}
+		// a presence tracked again meanwhile is stored again by its next heartbeat
+		if _, err := r.client.Do(ctx, append([]interface{}{"HDEL", presences}, toArgs(expired)...)...); err != nil {
+			return nil, err
+		}
+	}
+
+	ids, err := redis.Strings(r.client.Do(ctx, "ZRANGEBYSCORE", expiries, "("+strconv.FormatInt(now, 10), "+inf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []Presence{}, nil
+	}
+
+	values, err := redis.Strings(r.client.Do(ctx, append([]interface{}{"HMGET", presences}, toArgs(ids)...)...))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Presence, 0, len(values))
+	for _, v := range values {
+		// the presences untracked meanwhile come back as nil
+		if v == "" {
+			continue
+		}
+		var p Presence
+		if err := json.Unmarshal([]byte(v), &p); err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// Publish implements Store
+func (r *RedisStore) Publish(ctx context.Context, diff Diff) error {
+	b, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Do(ctx, "PUBLISH", r.diffsChannel(), b)
+	return err
+}
+
+// Diffs implements Store. Messages that can't be decoded are dropped.
+func (r *RedisStore) Diffs(ctx context.Context) (<-chan Diff, error) {
+	messages, err := r.client.Subscribe(ctx, r.diffsChannel())
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make(chan Diff)
+	go func() {
+		defer close(diffs)
+		for m := range messages {
+			var diff Diff
+			if err := json.Unmarshal([]byte(m.Payload), &diff); err != nil {
+				continue
+			}
+
+			select {
+			case diffs <- diff:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return diffs, nil
+}
+
+func toArgs(items []string) []interface{} {
+	args := make([]interface{}, len(items))
+	for i, item := range items {
+		args[i] = item
+	}
+	return args
+}
@@ -0,0 +1,92 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/redis"
+	"github.com/annibuliful-lab/graphqlws-subscription/redis/redistest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *redistest.Client) {
+	client := redistest.NewClient()
+	return NewRedisStore(client, "test:"), client
+}
+
+func TestRedisStorePresences(t *testing.T) {
+	ctx := context.Background()
+	store, client := newTestRedisStore(t)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	joinedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	alice := Presence{ID: "1", Topic: "documents/1", UserID: "alice", Meta: []byte(`{"cursor":3}`), JoinedAt: joinedAt}
+	assert.NoError(t, store.Track(ctx, alice, time.Minute))
+	assert.NoError(t, store.Track(ctx, Presence{ID: "2", Topic: "documents/1", UserID: "bob", JoinedAt: joinedAt}, 10*time.Second))
+	assert.NoError(t, store.Track(ctx, Presence{ID: "3", Topic: "documents/1", UserID: "carol", JoinedAt: joinedAt}, time.Minute))
+	assert.NoError(t, store.Untrack(ctx, "documents/1", "3"))
+	assert.NoError(t, store.Track(ctx, Presence{ID: "4", Topic: "documents/1:x", UserID: "dave", JoinedAt: joinedAt}, time.Minute))
+
+	now = now.Add(30 * time.Second)
+	presences, err := store.List(ctx, "documents/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Presence{alice}, presences)
+
+	// the expired presences are removed from the topic
+	keys, err := redis.Strings(client.Do(ctx, "HMGET", "test:presences:documents/1", "1", "2"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{string(mustMarshal(t, alice)), ""}, keys)
+
+	presences, err = store.List(ctx, "documents/*")
+	assert.NoError(t, err)
+	assert.Empty(t, presences)
+}
+
+func TestRedisStoreKeysExpireWithTheLastPresence(t *testing.T) {
+	ctx := context.Background()
+	store, client := newTestRedisStore(t)
+
+	assert.NoError(t, store.Track(ctx, Presence{ID: "1", Topic: "online", UserID: "alice"}, time.Minute))
+	assert.NoError(t, store.Track(ctx, Presence{ID: "2", Topic: "online", UserID: "bob"}, 10*time.Second))
+
+	client.FastForward(30 * time.Second)
+	keys, err := redis.Scan(ctx, client, "test:*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test:presence-expiries:online", "test:presences:online"}, keys)
+
+	client.FastForward(time.Minute)
+	keys, err = redis.Scan(ctx, client, "test:*")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRedisStoreDiffs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, _ := newTestRedisStore(t)
+
+	diffs, err := store.Diffs(ctx)
+	assert.NoError(t, err)
+
+	diff := Diff{Topic: "online", Leaves: []Presence{{ID: "1", Topic: "online", UserID: "alice", JoinedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}}
+	assert.NoError(t, store.Publish(ctx, diff))
+
+	select {
+	case received := <-diffs:
+		assert.Equal(t, diff, received)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for diff")
+	}
+}
@@ -0,0 +1,153 @@
+// Package presence tracks the users present on topics, e.g. the users online or the viewers of a
+// document, and reports the presences joining and leaving a topic as diffs. The presences of
+// every node are kept in a shared Store with a TTL refreshed by heartbeats, so that the members
+// of a topic are accurate across the replicas of a deployment.
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Presence is a user present on a topic, through a subscription or a connection.
+type Presence struct {
+	// ID uniquely identifies the presence, a user may be present several times on a topic.
+	ID           string          `json:"id"`
+	Topic        string          `json:"topic"`
+	UserID       string          `json:"userId"`
+	ConnectionID string          `json:"connectionId,omitempty"`
+	Meta         json.RawMessage `json:"meta,omitempty"`
+	JoinedAt     time.Time       `json:"joinedAt"`
+}
+
+// Diff is the presences joining and leaving a topic.
+type Diff struct {
+	Topic  string     `json:"topic"`
+	Joins  []Presence `json:"joins,omitempty"`
+	Leaves []Presence `json:"leaves,omitempty"`
+}
+
+// Store keeps the presences of every node and relays their diffs between nodes.
+type Store interface {
+	// Track stores a presence, replacing any previous one with the same id, which expires after
+	// ttl.
+	Track(ctx context.Context, p Presence, ttl time.Duration) error
+	// Untrack removes a presence.
+	Untrack(ctx context.Context, topic string, id string) error
+	// List returns the presences of a topic that haven't expired.
+	List(ctx context.Context, topic string) ([]Presence, error)
+	// Publish sends a diff to every node.
+	Publish(ctx context.Context, diff Diff) error
+	// Diffs returns the diffs published after the call, until ctx is cancelled.
+	Diffs(ctx context.Context) (<-chan Diff, error)
+}
+
+// MemoryStore is a Store for a single process, useful for tests and single node deployments.
+type MemoryStore struct {
+	mu          sync.Mutex
+	presences   map[string]map[string]memoryPresence
+	subscribers map[chan Diff]struct{}
+}
+
+type memoryPresence struct {
+	presence  Presence
+	expiresAt time.Time
+}
+
+var _ Store = &MemoryStore{}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		presences:   map[string]map[string]memoryPresence{},
+		subscribers: map[chan Diff]struct{}{},
+	}
+}
+
+// Track implements Store
+func (m *MemoryStore) Track(ctx context.Context, p Presence, ttl time.Duration) error {
+	m.mu.Lock()
+	if m.presences[p.Topic] == nil {
+		m.presences[p.Topic] = map[string]memoryPresence{}
+	}
+	m.presences[p.Topic][p.ID] = memoryPresence{presence: p, expiresAt: time.Now().Add(ttl)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Untrack implements Store
+func (m *MemoryStore) Untrack(ctx context.Context, topic string, id string) error {
+	m.mu.Lock()
+	delete(m.presences[topic], id)
+	if len(m.presences[topic]) == 0 {
+		delete(m.presences, topic)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// List implements Store
+func (m *MemoryStore) List(ctx context.Context, topic string) ([]Presence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	presences := make([]Presence, 0, len(m.presences[topic]))
+	for id, p := range m.presences[topic] {
+		if !now.Before(p.expiresAt) {
+			delete(m.presences[topic], id)
+			continue
+		}
+		presences = append(presences, p.presence)
+	}
+	return presences, nil
+}
+
+// Publish implements Store
+func (m *MemoryStore) Publish(ctx context.Context, diff Diff) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for sub := range m.subscribers {
+		select {
+		case sub <- diff:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Diffs implements Store
+func (m *MemoryStore) Diffs(ctx context.Context) (<-chan Diff, error) {
+	in := make(chan Diff, 16)
+	m.mu.Lock()
+	m.subscribers[in] = struct{}{}
+	m.mu.Unlock()
+
+	out := make(chan Diff)
+	go func() {
+		defer close(out)
+		defer func() {
+			m.mu.Lock()
+			delete(m.subscribers, in)
+			m.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case diff := <-in:
+				select {
+				case out <- diff:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
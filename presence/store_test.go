@@ -0,0 +1,42 @@
+package presence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorePresences(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	assert.NoError(t, store.Track(ctx, Presence{ID: "1", Topic: "online", UserID: "alice"}, time.Minute))
+	assert.NoError(t, store.Track(ctx, Presence{ID: "2", Topic: "online", UserID: "bob"}, time.Nanosecond))
+	assert.NoError(t, store.Track(ctx, Presence{ID: "3", Topic: "online", UserID: "carol"}, time.Minute))
+	assert.NoError(t, store.Track(ctx, Presence{ID: "4", Topic: "documents/1", UserID: "alice"}, time.Minute))
+	assert.NoError(t, store.Untrack(ctx, "online", "3"))
+	time.Sleep(time.Millisecond)
+
+	presences, err := store.List(ctx, "online")
+	assert.NoError(t, err)
+	assert.Equal(t, []Presence{{ID: "1", Topic: "online", UserID: "alice"}}, presences)
+}
+
+func TestMemoryStoreDiffs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := NewMemoryStore()
+
+	diffs, err := store.Diffs(ctx)
+	assert.NoError(t, err)
+
+	diff := Diff{Topic: "online", Joins: []Presence{{ID: "1", Topic: "online", UserID: "alice"}}}
+	assert.NoError(t, store.Publish(context.Background(), diff))
+	assert.Equal(t, diff, <-diffs)
+
+	cancel()
+	for range diffs {
+	}
+	assert.NoError(t, store.Publish(context.Background(), diff))
+}
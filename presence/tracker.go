@@ -0,0 +1,323 @@
+package presence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+const (
+	defaultTTL           = 30 * time.Second
+	untrackTimeout       = 5 * time.Second
+	heartbeatIntervalDiv = 3
+)
+
+// ErrNoUser is returned when tracking a context without user, see Tracker.UserIDFunc.
+var ErrNoUser = errors.New("presence: no user")
+
+// Tracker tracks the presences of the subscriptions and connections of a node in a Store and
+// delivers the diffs published by any node to its subscribers. Every replica runs its own
+// Tracker sharing the same Store.
+//
+// A presence leaves its topic when the context it was tracked with is done, e.g. the context of
+// a subscription resolver or the context returned by the InitFunc of a connection. The presences
+// of a node that stops without leaving expire after TTL, without diff.
+type Tracker struct {
+	Store Store
+	// TTL is how long a presence outlives the last heartbeat of its node, it defaults to 30
+	// seconds.
+	TTL time.Duration
+	// HeartbeatInterval is how often the presences are refreshed, it defaults to a third of TTL.
+	HeartbeatInterval time.Duration
+	// UserIDFunc returns the user of a context, the contexts without user can't be tracked.
+	UserIDFunc func(ctx context.Context) string
+	// ErrorFunc is called when the Store fails outside of a call of the Tracker.
+	ErrorFunc func(ctx context.Context, err error)
+
+	once    sync.Once
+	local   *pubsub.Memory
+	mu      sync.Mutex
+	tracked map[string]Presence
+}
+
+func (t *Tracker) init() {
+	t.once.Do(func() {
+		t.local = pubsub.NewMemory()
+		t.tracked = map[string]Presence{}
+	})
+}
+
+// Run refreshes the presences of the node and delivers the diffs of the Store to the
+// subscribers until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context) error {
+	t.init()
+	diffs, err := t.Store.Diffs(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(t.heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			t.heartbeat(ctx)
+		case diff, ok := <-diffs:
+			if !ok {
+				if ctx.Err() != nil {
+					continue
+				}
+				// the subscription was lost, subscribe again
+				diffs, err = t.Store.Diffs(ctx)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			t.deliver(ctx, diff)
+		}
+	}
+}
+
+// Track adds the user of ctx to a topic until ctx is done, and publishes the diffs of its join
+// and leave. The meta is encoded to JSON, e.g. the status of the user or the cursor of an
+// editor.
+func (t *Tracker) Track(ctx context.Context, topic string, meta any) error {
+	t.init()
+	if !validTopic(topic) {
+		return pubsub.ErrInvalidTopic
+	}
+	var userID string
+	if t.UserIDFunc != nil {
+		userID = t.UserIDFunc(ctx)
+	}
+	if userID == "" {
+		return ErrNoUser
+	}
+	id, err := newPresenceID()
+	if err != nil {
+		return err
+	}
+	p := Presence{ID: id, Topic: topic, UserID: userID, JoinedAt: time.Now()}
+	if info := transport.GetConnectionInfo(ctx); info != nil {
+		p.ConnectionID = info.ID
+	}
+	if meta != nil {
+		b, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		p.Meta = b
+	}
+
+	if err := t.Store.Track(ctx, p, t.ttl()); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.tracked[p.ID] = p
+	t.mu.Unlock()
+	context.AfterFunc(ctx, func() { t.untrack(ctx, p) })
+	return t.Store.Publish(ctx, Diff{Topic: topic, Joins: []Presence{p}})
+}
+
+// Subscribe returns the diffs of a topic until ctx is done, the first one joining the current
+// presences of the topic. The diffs are delivered while the Tracker runs.
+func (t *Tracker) Subscribe(ctx context.Context, topic string) (<-chan Diff, error) {
+	t.init()
+	if !validTopic(topic) {
+		return nil, pubsub.ErrInvalidTopic
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	diffs, err := pubsub.NewTopic[Diff](t.local, topic).Subscribe(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	current, err := t.Store.List(ctx, topic)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sortPresences(current)
+
+	out := make(chan Diff)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		// the joins published between the subscription and the listing are in both
+		listed := make(map[string]bool, len(current))
+		for _, p := range current {
+			listed[p.ID] = true
+		}
+		diff := Diff{Topic: topic, Joins: current}
+		for {
+			if len(diff.Joins) > 0 || len(diff.Leaves) > 0 {
+				select {
+				case out <- diff:
+				case <-ctx.Done():
+					return
+				}
+			}
+			var ok bool
+			if diff, ok = <-diffs; !ok {
+				return
+			}
+			if len(listed) > 0 {
+				joins := diff.Joins[:0:0]
+				for _, p := range diff.Joins {
+					if listed[p.ID] {
+						delete(listed, p.ID)
+						continue
+					}
+					joins = append(joins, p)
+				}
+				diff.Joins = joins
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Join tracks the user of ctx on a topic and returns the diffs of the topic, see Track and
+// Subscribe, e.g. for a subscription resolver of the users viewing a document.
+func (t *Tracker) Join(ctx context.Context, topic string, meta any) (<-chan Diff, error) {
+	if err := t.Track(ctx, topic, meta); err != nil {
+		return nil, err
+	}
+	// the presence of the caller is in the first diff, both end with ctx
+	return t.Subscribe(ctx, topic)
+}
+
+// List returns the presences of a topic on every node, sorted by join time.
+func (t *Tracker) List(ctx context.Context, topic string) ([]Presence, error) {
+	presences, err := t.Store.List(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	sortPresences(presences)
+	return presences, nil
+}
+
+// Users returns the sorted ids of the users present on a topic on every node.
+func (t *Tracker) Users(ctx context.Context, topic string) ([]string, error) {
+	presences, err := t.Store.List(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	users := []string{}
+	for _, p := range presences {
+		if !seen[p.UserID] {
+			seen[p.UserID] = true
+			users = append(users, p.UserID)
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (t *Tracker) untrack(ctx context.Context, p Presence) {
+	t.mu.Lock()
+	delete(t.tracked, p.ID)
+	t.mu.Unlock()
+
+	// the context of the presence is done
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), untrackTimeout)
+	defer cancel()
+	err := t.Store.Untrack(ctx, p.Topic, p.ID)
+	if err == nil {
+		err = t.Store.Publish(ctx, Diff{Topic: p.Topic, Leaves: []Presence{p}})
+	}
+	t.report(ctx, err)
+}
+
+func (t *Tracker) heartbeat(ctx context.Context) {
+	t.mu.Lock()
+	presences := make([]Presence, 0, len(t.tracked))
+	for _, p := range t.tracked {
+		presences = append(presences, p)
+	}
+	t.mu.Unlock()
+
+	for _, p := range presences {
+		t.report(ctx, t.Store.Track(ctx, p, t.ttl()))
+	}
+}
+
+func (t *Tracker) deliver(ctx context.Context, diff Diff) {
+	if !validTopic(diff.Topic) {
+		return
+	}
+	b, err := json.Marshal(diff)
+	if err == nil {
+		err = t.local.Publish(ctx, diff.Topic, b)
+	}
+	if ctx.Err() == nil {
+		t.report(ctx, err)
+	}
+}
+
+func (t *Tracker) ttl() time.Duration {
+	if t.TTL == 0 {
+		return defaultTTL
+	}
+	return t.TTL
+}
+
+func (t *Tracker) heartbeatInterval() time.Duration {
+	if t.HeartbeatInterval == 0 {
+		return t.ttl() / heartbeatIntervalDiv
+	}
+	return t.HeartbeatInterval
+}
+
+func (t *Tracker) report(ctx context.Context, err error) {
+	if err != nil && t.ErrorFunc != nil {
+		t.ErrorFunc(ctx, err)
+	}
+}
+
+// validTopic returns true if the topic isn't empty and has no wildcard, the diffs are delivered
+// through a pubsub.Memory.
+func validTopic(topic string) bool {
+	if topic == "" {
+		return false
+	}
+	for _, level := range strings.Split(topic, "/") {
+		if level == "+" || level == "#" {
+			return false
+		}
+	}
+	return true
+}
+
+func sortPresences(presences []Presence) {
+	sort.Slice(presences, func(i, j int) bool {
+		if !presences[i].JoinedAt.Equal(presences[j].JoinedAt) {
+			return presences[i].JoinedAt.Before(presences[j].JoinedAt)
+		}
+		return presences[i].ID < presences[j].ID
+	})
+}
+
+func newPresenceID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("presence: generating presence id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
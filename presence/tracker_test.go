@@ -0,0 +1,126 @@
+package presence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+type userKey struct{}
+
+func withUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// runTestTracker runs a tracker whose users are those of withUser.
+func runTestTracker(t *testing.T, tracker *Tracker) *Tracker {
+	tracker.UserIDFunc = func(ctx context.Context) string {
+		userID, _ := ctx.Value(userKey{}).(string)
+		return userID
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tracker.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return tracker
+}
+
+// receive returns the next diff of a subscription.
+func receive(t *testing.T, diffs <-chan Diff) Diff {
+	t.Helper()
+	select {
+	case diff, ok := <-diffs:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return diff
+	case <-time.After(time.Second):
+		t.Fatal("no diff received")
+		return Diff{}
+	}
+}
+
+func users(presences []Presence) []string {
+	users := []string{}
+	for _, p := range presences {
+		users = append(users, p.UserID)
+	}
+	return users
+}
+
+func TestTracker(t *testing.T) {
+	store := NewMemoryStore()
+	// two nodes sharing the store
+	a, b := runTestTracker(t, &Tracker{Store: store}), runTestTracker(t, &Tracker{Store: store})
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.subscribers) == 2
+	}, time.Second, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.NoError(t, a.Track(withUser(ctx, "alice"), "documents/1", map[string]int{"cursor": 3}))
+	diffs, err := a.Subscribe(ctx, "documents/1")
+	assert.NoError(t, err)
+	diff := receive(t, diffs)
+	assert.Equal(t, []string{"alice"}, users(diff.Joins))
+	assert.JSONEq(t, `{"cursor":3}`, string(diff.Joins[0].Meta))
+
+	bobCtx, bobCancel := context.WithCancel(withUser(ctx, "bob"))
+	bobDiffs, err := b.Join(bobCtx, "documents/1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, users(receive(t, bobDiffs).Joins))
+	assert.Equal(t, []string{"bob"}, users(receive(t, diffs).Joins))
+
+	assert.NoError(t, b.Track(withUser(ctx, "alice"), "documents/1", nil))
+	assert.Equal(t, []string{"alice"}, users(receive(t, diffs).Joins))
+	userIDs, err := b.Users(ctx, "documents/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, userIDs)
+	presences, err := a.List(ctx, "documents/1")
+	assert.NoError(t, err)
+	assert.Len(t, presences, 3)
+
+	bobCancel()
+	diff = receive(t, diffs)
+	assert.Equal(t, []string{"bob"}, users(diff.Leaves))
+	assert.Empty(t, diff.Joins)
+	for range bobDiffs {
+	}
+	userIDs, err = a.Users(ctx, "documents/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, userIDs)
+}
+
+func TestTrackerHeartbeat(t *testing.T) {
+	store := NewMemoryStore()
+	tracker := runTestTracker(t, &Tracker{Store: store, TTL: 50 * time.Millisecond, HeartbeatInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.NoError(t, tracker.Track(withUser(ctx, "alice"), "online", nil))
+	time.Sleep(150 * time.Millisecond)
+	presences, err := store.List(ctx, "online")
+	assert.NoError(t, err)
+	assert.Len(t, presences, 1)
+}
+
+func TestTrackerInvalid(t *testing.T) {
+	tracker := runTestTracker(t, &Tracker{Store: NewMemoryStore()})
+	ctx := context.Background()
+
+	assert.Equal(t, ErrNoUser, tracker.Track(ctx, "online", nil))
+	assert.Equal(t, pubsub.ErrInvalidTopic, tracker.Track(withUser(ctx, "alice"), "documents/+", nil))
+	_, err := tracker.Subscribe(ctx, "")
+	assert.Equal(t, pubsub.ErrInvalidTopic, err)
+}
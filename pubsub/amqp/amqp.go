@@ -0,0 +1,252 @@
+// Package amqp is a pubsub driver for RabbitMQ and the other AMQP 0.9.1 brokers. The topics are
+// published to a topic exchange, with their levels as the words of the routing keys, and every
+// process consumes the patterns of its subscriptions from an exclusive queue.
+//
+// The Broker opens its channels with Dial, e.g. wrapping a channel of github.com/rabbitmq/amqp091-go
+// in the Channel interface, and dials again when a channel fails: the exchange and the queue are
+// declared again, and the queue bound to the patterns of the current subscriptions.
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+const (
+	defaultExchange      = "graphqlws"
+	defaultRetryInterval = time.Second
+)
+
+// ErrNotConnected is returned when publishing while the channel is being recovered.
+var ErrNotConnected = errors.New("amqp: not connected")
+
+// Delivery is a message consumed from a queue.
+type Delivery struct {
+	RoutingKey string
+	Body       []byte
+}
+
+// Channel is the subset of an AMQP channel used by the Broker.
+type Channel interface {
+	// ExchangeDeclare declares a durable topic exchange.
+	ExchangeDeclare(ctx context.Context, name string) error
+	// QueueDeclare declares an exclusive queue deleted with the channel, named by the server, and
+	// returns its name.
+	QueueDeclare(ctx context.Context) (string, error)
+	QueueBind(ctx context.Context, queue string, routingKey string, exchange string) error
+	QueueUnbind(ctx context.Context, queue string, routingKey string, exchange string) error
+	// Consume returns the deliveries of a queue, acknowledged automatically. The deliveries are
+	// closed with the channel, e.g. when the connection is lost.
+	Consume(ctx context.Context, queue string) (<-chan Delivery, error)
+	Publish(ctx context.Context, exchange string, routingKey string, body []byte) error
+	Close() error
+}
+
+// Broker is a pubsub.Broker publishing and consuming through AMQP channels. Run consumes the
+// messages and recovers the channel when it fails.
+type Broker struct {
+	// Dial opens a channel, it is called again to recover from the failures of the channel.
+	Dial func(ctx context.Context) (Channel, error)
+	// Exchange is the name of the topic exchange, it defaults to "graphqlws".
+	Exchange string
+	// RetryInterval is the delay before dialing again after a failure, it defaults to 1 second.
+	RetryInterval time.Duration
+	// ErrorFunc is called with the failures of the channel.
+	ErrorFunc func(ctx context.Context, err error)
+
+	once   sync.Once
+	fanout pubsub.Fanout
+
+	// mu guards the channel, which is nil while it is recovered, and serialises its use
+	mu    sync.Mutex
+	ch    Channel
+	queue string
+}
+
+var _ pubsub.Broker = &Broker{}
+
+func (b *Broker) init() {
+	b.once.Do(func() {
+		b.fanout.Bind = b.bind
+		b.fanout.Unbind = b.unbind
+	})
+}
+
+func (b *Broker) exchange() string {
+	if b.Exchange == "" {
+		return defaultExchange
+	}
+	return b.Exchange
+}
+
+func (b *Broker) retryInterval() time.Duration {
+	if b.RetryInterval == 0 {
+		return defaultRetryInterval
+	}
+	return b.RetryInterval
+}
+
+// RoutingKey returns the routing key of a topic or of a pattern, e.g. "orders.*.status" for
+// "orders/+/status". The levels must not contain dots.
+func RoutingKey(topic string) string {
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		if level == "+" {
+			levels[i] = "*"
+		}
+	}
+	return strings.Join(levels, ".")
+}
+
+// Topic returns the topic of a routing key.
+func Topic(routingKey string) string {
+	return strings.ReplaceAll(routingKey, ".", "/")
+}
+
+// validTopic returns true if the topic maps to a routing key and back.
+func validTopic(topic string) bool {
+	return !strings.ContainsAny(topic, ".*")
+}
+
+// Publish implements pubsub.Broker
+func (b *Broker) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	if !validTopic(topic) || strings.ContainsAny(topic, "+#") {
+		return pubsub.ErrInvalidTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		return ErrNotConnected
+	}
+	return b.ch.Publish(ctx, b.exchange(), RoutingKey(topic), payload)
+}
+
+// Subscribe implements pubsub.Broker, the subscriptions made while the channel is recovered
+// receive their messages once it is.
+func (b *Broker) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	b.init()
+	if !validTopic(topic) {
+		return nil, pubsub.ErrInvalidTopic
+	}
+	return b.fanout.Subscribe(ctx, topic)
+}
+
+func (b *Broker) bind(ctx context.Context, pattern string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		// bound once the channel is recovered
+		return nil
+	}
+	return b.ch.QueueBind(ctx, b.queue, RoutingKey(pattern), b.exchange())
+}
+
+func (b *Broker) unbind(pattern string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		return
+	}
+	ctx := context.Background()
+	b.report(ctx, b.ch.QueueUnbind(ctx, b.queue, RoutingKey(pattern), b.exchange()))
+}
+
+// Run consumes the messages of the subscriptions until ctx is done, dialing a new channel after
+// every failure.
+func (b *Broker) Run(ctx context.Context) error {
+	b.init()
+	for {
+		deliveries, err := b.connect(ctx)
+		if err == nil {
+			err = b.consume(ctx, deliveries)
+		}
+		b.disconnect()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.report(ctx, err)
+
+		timer := time.NewTimer(b.retryInterval())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// connect opens a channel, declares the exchange and the queue, and binds the patterns
+// subscribed to.
+func (b *Broker) connect(ctx context.Context) (<-chan Delivery, error) {
+	ch, err := b.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := ch.ExchangeDeclare(ctx, b.exchange()); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	queue, err := ch.QueueDeclare(ctx)
+	if err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	for _, pattern := range b.fanout.Patterns() {
+		if err := ch.QueueBind(ctx, queue, RoutingKey(pattern), b.exchange()); err != nil {
+			_ = ch.Close()
+			return nil, err
+		}
+	}
+	deliveries, err := ch.Consume(ctx, queue)
+	if err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	b.ch, b.queue = ch, queue
+	return deliveries, nil
+}
+
+var errChannelClosed = errors.New("amqp: channel closed")
+
+func (b *Broker) consume(ctx context.Context, deliveries <-chan Delivery) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return errChannelClosed
+			}
+			msg := pubsub.Message{Topic: Topic(d.RoutingKey), Payload: d.Body}
+			if err := b.fanout.Deliver(ctx, msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (b *Broker) disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch != nil {
+		_ = b.ch.Close()
+		b.ch = nil
+	}
+}
+
+func (b *Broker) report(ctx context.Context, err error) {
+	if err != nil && b.ErrorFunc != nil {
+		b.ErrorFunc(ctx, err)
+	}
+}
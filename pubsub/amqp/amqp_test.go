@@ -0,0 +1,171 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub/internal/pubsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testExchange is a topic exchange routing the messages to the queues of its channels.
+type testExchange struct {
+	mu       sync.Mutex
+	channels []*testChannel
+	dials    int
+}
+
+func (e *testExchange) dial(ctx context.Context) (Channel, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dials++
+	ch := &testChannel{exchange: e, bindings: map[string]bool{}, deliveries: make(chan Delivery, 16)}
+	e.channels = append(e.channels, ch)
+	return ch, nil
+}
+
+// fail closes the channels, as a lost connection does.
+func (e *testExchange) fail() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, ch := range e.channels {
+		close(ch.deliveries)
+	}
+	e.channels = nil
+}
+
+// bindings returns the sorted routing keys bound by the open channels.
+func (e *testExchange) bindings() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var bindings []string
+	for _, ch := range e.channels {
+		for key := range ch.bindings {
+			bindings = append(bindings, key)
+		}
+	}
+	slices.Sort(bindings)
+	return bindings
+}
+
+type testChannel struct {
+	exchange   *testExchange
+	bindings   map[string]bool
+	deliveries chan Delivery
+}
+
+func (c *testChannel) ExchangeDeclare(ctx context.Context, name string) error { return nil }
+
+func (c *testChannel) QueueDeclare(ctx context.Context) (string, error) { return "amq.gen-1", nil }
+
+func (c *testChannel) QueueBind(ctx context.Context, queue string, routingKey string, exchange string) error {
+	c.exchange.mu.Lock()
+	defer c.exchange.mu.Unlock()
+	c.bindings[routingKey] = true
+	return nil
+}
+
+func (c *testChannel) QueueUnbind(ctx context.Context, queue string, routingKey string, exchange string) error {
+	c.exchange.mu.Lock()
+	defer c.exchange.mu.Unlock()
+	delete(c.bindings, routingKey)
+	return nil
+}
+
+func (c *testChannel) Consume(ctx context.Context, queue string) (<-chan Delivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *testChannel) Publish(ctx context.Context, exchange string, routingKey string, body []byte) error {
+	c.exchange.mu.Lock()
+	defer c.exchange.mu.Unlock()
+	for _, ch := range c.exchange.channels {
+		for key := range ch.bindings {
+			if pubsub.Match(strings.ReplaceAll(Topic(key), "*", "+"), Topic(routingKey)) {
+				ch.deliveries <- Delivery{RoutingKey: routingKey, Body: body}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (c *testChannel) Close() error {
+	c.exchange.mu.Lock()
+	defer c.exchange.mu.Unlock()
+	if i := slices.Index(c.exchange.channels, c); i >= 0 {
+		c.exchange.channels = slices.Delete(c.exchange.channels, i, i+1)
+		close(c.deliveries)
+	}
+	return nil
+}
+
+func TestRoutingKey(t *testing.T) {
+	assert.Equal(t, "orders.*.status", RoutingKey("orders/+/status"))
+	assert.Equal(t, "user.#", RoutingKey("user/#"))
+	assert.Equal(t, "orders/42/status", Topic("orders.42.status"))
+}
+
+func TestBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exchange := &testExchange{}
+	var mu sync.Mutex
+	var errs []error
+	broker := &Broker{
+		Dial:          exchange.dial,
+		RetryInterval: 10 * time.Millisecond,
+		ErrorFunc: func(ctx context.Context, err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	}
+	assert.Equal(t, ErrNotConnected, broker.Publish(ctx, "orders/42/status", json.RawMessage(`{}`)))
+
+	// subscribed before the channel is opened
+	status, err := broker.Subscribe(ctx, "orders/+/status")
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- broker.Run(ctx) }()
+	assert.Eventually(t, func() bool { return len(exchange.bindings()) == 1 }, time.Second, time.Millisecond)
+
+	userCtx, cancelUser := context.WithCancel(ctx)
+	user, err := broker.Subscribe(userCtx, "user/#")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders.*.status", "user.#"}, exchange.bindings())
+
+	assert.NoError(t, broker.Publish(ctx, "orders/42/status", json.RawMessage(`{"status":"paid"}`)))
+	assert.NoError(t, broker.Publish(ctx, "user/1", json.RawMessage(`{}`)))
+	assert.Equal(t, pubsub.Message{Topic: "orders/42/status", Payload: json.RawMessage(`{"status":"paid"}`)}, pubsubtest.Receive(t, status))
+	assert.Equal(t, "user/1", pubsubtest.Receive(t, user).Topic)
+
+	cancelUser()
+	assert.Eventually(t, func() bool { return len(exchange.bindings()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, pubsub.ErrInvalidTopic, broker.Publish(ctx, "orders.42", json.RawMessage(`{}`)))
+	assert.Equal(t, pubsub.ErrInvalidTopic, broker.Publish(ctx, "orders/+/status", json.RawMessage(`{}`)))
+
+	// the channel is recovered with the bindings of the subscriptions
+	exchange.fail()
+	assert.Eventually(t, func() bool {
+		exchange.mu.Lock()
+		defer exchange.mu.Unlock()
+		return exchange.dials == 2 && len(exchange.channels) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"orders.*.status"}, exchange.bindings())
+	assert.NoError(t, broker.Publish(ctx, "orders/43/status", json.RawMessage(`{}`)))
+	assert.Equal(t, "orders/43/status", pubsubtest.Receive(t, status).Topic)
+	mu.Lock()
+	assert.Equal(t, []error{errChannelClosed}, errs)
+	mu.Unlock()
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+}
@@ -0,0 +1,161 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrForbidden is returned when a topic isn't allowed by an Authorizer denying the unmatched topics.
+var ErrForbidden = errors.New("pubsub: forbidden")
+
+// AuthorizeFunc returns an error if the topic isn't allowed in ctx, e.g. the context of an
+// operation of the transport, holding its init payload and tenant.
+type AuthorizeFunc func(ctx context.Context, topic string) error
+
+type authorizationRule struct {
+	pattern string
+	fn      AuthorizeFunc
+}
+
+// Authorizer checks the topics published and subscribed to against the rules of their patterns,
+// so that the security of the topics lives in one place rather than in every resolver.
+//
+// The patterns are topics with wildcards: "+" matches a single level and "#", as the last level,
+// matches any number of levels, e.g. "orders/+/status" or "user/#". Every rule whose pattern
+// matches a topic is evaluated in the order of registration, the first error denies it. A
+// subscription to a pattern is checked by the rules of the patterns matching some of its topics,
+// e.g. the rules of "user/1/#" check the subscriptions to "user/#", and they receive the pattern
+// as their topic.
+type Authorizer struct {
+	// DenyUnmatched denies the topics matched by no rule with ErrForbidden, they are allowed
+	// otherwise.
+	DenyUnmatched bool
+
+	mu        sync.RWMutex
+	subscribe []authorizationRule
+	publish   []authorizationRule
+}
+
+// AuthorizeSubscribe adds a rule checking the subscriptions to the topics matching pattern.
+func (a *Authorizer) AuthorizeSubscribe(pattern string, fn AuthorizeFunc) {
+	a.mu.Lock()
+	a.subscribe = append(a.subscribe, authorizationRule{pattern: pattern, fn: fn})
+	a.mu.Unlock()
+}
+
+// AuthorizePublish adds a rule checking the messages published to the topics matching pattern.
+func (a *Authorizer) AuthorizePublish(pattern string, fn AuthorizeFunc) {
+	a.mu.Lock()
+	a.publish = append(a.publish, authorizationRule{pattern: pattern, fn: fn})
+	a.mu.Unlock()
+}
+
+// CanSubscribe returns an error if a subscription to the topic isn't allowed in ctx.
+func (a *Authorizer) CanSubscribe(ctx context.Context, topic string) error {
+	a.mu.RLock()
+	rules := a.subscribe
+	a.mu.RUnlock()
+	return a.authorize(ctx, rules, topic)
+}
+
+// CanPublish returns an error if publishing to the topic isn't allowed in ctx.
+func (a *Authorizer) CanPublish(ctx context.Context, topic string) error {
+	a.mu.RLock()
+	rules := a.publish
+	a.mu.RUnlock()
+	return a.authorize(ctx, rules, topic)
+}
+
+func (a *Authorizer) authorize(ctx context.Context, rules []authorizationRule, topic string) error {
+	matched := false
+	for _, rule := range rules {
+		if !overlaps(rule.pattern, topic) {
+			continue
+		}
+		matched = true
+		if err := rule.fn(ctx, topic); err != nil {
+			return err
+		}
+	}
+	if !matched && a.DenyUnmatched {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Match returns true if the topic matches the pattern, see Authorizer for the wildcards.
+func Match(pattern string, topic string) bool {
+	for {
+		level, rest, more := strings.Cut(pattern, "/")
+		if level == "#" && !more {
+			return true
+		}
+		topicLevel, topicRest, topicMore := strings.Cut(topic, "/")
+		if level != "+" && level != topicLevel {
+			return false
+		}
+		if !more || !topicMore {
+			// "a/#" matches "a" as well
+			return more == topicMore || (!topicMore && rest == "#")
+		}
+		pattern, topic = rest, topicRest
+	}
+}
+
+// overlaps returns true if a topic matches both patterns.
+func overlaps(a string, b string) bool {
+	levelsA, levelsB := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; ; i++ {
+		switch {
+		case i == len(levelsA) && i == len(levelsB):
+			return true
+		case i == len(levelsA):
+			return levelsB[i] == "#"
+		case i == len(levelsB):
+			return levelsA[i] == "#"
+		case levelsA[i] == "#" || levelsB[i] == "#":
+			return true
+		case levelsA[i] != "+" && levelsB[i] != "+" && levelsA[i] != levelsB[i]:
+			return false
+		}
+	}
+}
+
+// Authorized is a Broker checking the topics with an Authorizer before publishing and subscribing.
+type Authorized struct {
+	Broker
+	Authorizer *Authorizer
+}
+
+var _ Broker = Authorized{}
+
+// Publish implements Broker
+func (a Authorized) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	if err := a.Authorizer.CanPublish(ctx, topic); err != nil {
+		return err
+	}
+	return a.Broker.Publish(ctx, topic, payload)
+}
+
+// Subscribe implements Broker
+func (a Authorized) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	if err := a.Authorizer.CanSubscribe(ctx, topic); err != nil {
+		return nil, err
+	}
+	return a.Broker.Subscribe(ctx, topic)
+}
+
+// SubscribeFrom implements Replayer when the broker does.
+func (a Authorized) SubscribeFrom(ctx context.Context, topic string, seq uint64) (<-chan Message, error) {
+	replayer, ok := a.Broker.(Replayer)
+	if !ok {
+		return nil, ErrReplayUnavailable
+	}
+	if err := a.Authorizer.CanSubscribe(ctx, topic); err != nil {
+		return nil, err
+	}
+	return replayer.SubscribeFrom(ctx, topic, seq)
+}
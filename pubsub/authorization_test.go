@@ -0,0 +1,99 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"orders/42/status", "orders/42/status", true},
+		{"orders/42/status", "orders/43/status", false},
+		{"orders/+/status", "orders/42/status", true},
+		{"orders/+/status", "orders/42/items", false},
+		{"orders/+", "orders/42/status", false},
+		{"user/#", "user/1/messages", true},
+		{"user/#", "user", true},
+		{"user/#", "users/1", false},
+		{"#", "anything/at/all", true},
+		{"orders", "orders/42", false},
+		{"orders/42", "orders", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Match(tt.pattern, tt.topic), "%s %s", tt.pattern, tt.topic)
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{"user/1/#", "user/#", true},
+		{"user/1/#", "user/+/messages", true},
+		{"user/1/#", "user/2/messages", false},
+		{"user/+", "user/1/messages", false},
+		{"user/#", "user", true},
+		{"orders", "orders", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, overlaps(tt.a, tt.b), "%s %s", tt.a, tt.b)
+		assert.Equal(t, tt.want, overlaps(tt.b, tt.a), "%s %s", tt.b, tt.a)
+	}
+}
+
+type userKey struct{}
+
+func TestAuthorizer(t *testing.T) {
+	errNotOwner := errors.New("not the owner")
+	a := &Authorizer{}
+	a.AuthorizeSubscribe("user/+/#", func(ctx context.Context, topic string) error {
+		if strings.Split(topic, "/")[1] != ctx.Value(userKey{}) {
+			return errNotOwner
+		}
+		return nil
+	})
+	a.AuthorizePublish("user/#", func(ctx context.Context, topic string) error {
+		return ErrForbidden
+	})
+
+	ctx := context.WithValue(context.Background(), userKey{}, "1")
+	assert.NoError(t, a.CanSubscribe(ctx, "user/1/messages"))
+	assert.Equal(t, errNotOwner, a.CanSubscribe(ctx, "user/2/messages"))
+	assert.Equal(t, ErrForbidden, a.CanPublish(ctx, "user/1/messages"))
+	assert.NoError(t, a.CanSubscribe(ctx, "orders"))
+	// the pattern includes the topics of the other users
+	assert.Equal(t, errNotOwner, a.CanSubscribe(ctx, "user/#"))
+
+	a.DenyUnmatched = true
+	assert.Equal(t, ErrForbidden, a.CanSubscribe(ctx, "orders"))
+}
+
+func TestAuthorized(t *testing.T) {
+	a := &Authorizer{DenyUnmatched: true}
+	allow := func(ctx context.Context, topic string) error { return nil }
+	a.AuthorizeSubscribe("public/#", allow)
+	a.AuthorizePublish("public/#", allow)
+	broker := Authorized{Broker: NewMemory(), Authorizer: a}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := broker.Subscribe(ctx, "private")
+	assert.Equal(t, ErrForbidden, err)
+	assert.Equal(t, ErrForbidden, broker.Publish(ctx, "private", json.RawMessage(`{}`)))
+
+	messages, err := broker.Subscribe(ctx, "public/news")
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "public/news", json.RawMessage(`{}`)))
+	assert.Equal(t, "public/news", receive(t, messages).Topic)
+}
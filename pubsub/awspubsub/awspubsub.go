@@ -0,0 +1,260 @@
+// Package awspubsub is a pubsub driver for AWS: the messages are published to an SNS topic and
+// received from an SQS queue subscribed to it, or to the rules of an EventBridge bus. Every process
+// receives from a queue of its own, so that all of them receive every message.
+//
+// The queues and their subscriptions are provisioned beforehand, e.g. with the infrastructure of
+// the application: the Client only publishes to SNS and receives, deletes and extends the
+// messages of SQS in batches, e.g. with the clients of github.com/aws/aws-sdk-go-v2.
+package awspubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+// TopicAttribute is the message attribute holding the topic of the messages published to SNS.
+const TopicAttribute = "topic"
+
+const (
+	defaultMaxMessages       = 10
+	defaultWaitTime          = 20 * time.Second
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultRetryInterval     = time.Second
+)
+
+// Message is a message received from SQS.
+type Message struct {
+	ID            string
+	ReceiptHandle string
+	Body          string
+	// Attributes are the message attributes of the message.
+	Attributes map[string]string
+}
+
+// ReceiveInput are the parameters of a ReceiveMessage call.
+type ReceiveInput struct {
+	QueueURL          string
+	MaxMessages       int
+	WaitTime          time.Duration
+	VisibilityTimeout time.Duration
+}
+
+// Client is the subset of the SNS and SQS clients used by the Broker.
+type Client interface {
+	// Publish publishes a message to an SNS topic with string message attributes.
+	Publish(ctx context.Context, topicARN string, body string, attributes map[string]string) error
+	// ReceiveMessages long polls a queue for a batch of messages.
+	ReceiveMessages(ctx context.Context, input ReceiveInput) ([]Message, error)
+	// DeleteMessages deletes a batch of messages from a queue.
+	DeleteMessages(ctx context.Context, queueURL string, receiptHandles []string) error
+	// ChangeVisibility extends the visibility timeout of a batch of messages of a queue.
+	ChangeVisibility(ctx context.Context, queueURL string, receiptHandles []string, timeout time.Duration) error
+}
+
+// DecodeFunc returns the topic and the payload of a received message.
+type DecodeFunc func(msg Message) (topic string, payload json.RawMessage, err error)
+
+// DecodeSNS decodes the messages delivered by SNS, with or without raw message delivery.
+func DecodeSNS(msg Message) (string, json.RawMessage, error) {
+	if topic, ok := msg.Attributes[TopicAttribute]; ok {
+		// raw message delivery
+		return topic, json.RawMessage(msg.Body), nil
+	}
+	var notification struct {
+		Message           string
+		MessageAttributes map[string]struct{ Value string }
+	}
+	if err := json.Unmarshal([]byte(msg.Body), &notification); err != nil {
+		return "", nil, err
+	}
+	topic := notification.MessageAttributes[TopicAttribute].Value
+	if topic == "" {
+		return "", nil, errNoTopic
+	}
+	return topic, json.RawMessage(notification.Message), nil
+}
+
+// DecodeEventBridge decodes the events delivered by EventBridge, their topic is their source and
+// detail type joined by a slash, e.g. "orders/OrderPaid", and their payload is their detail.
+func DecodeEventBridge(msg Message) (string, json.RawMessage, error) {
+	var event struct {
+		Source     string          `json:"source"`
+		DetailType string          `json:"detail-type"`
+		Detail     json.RawMessage `json:"detail"`
+	}
+	if err := json.Unmarshal([]byte(msg.Body), &event); err != nil {
+		return "", nil, err
+	}
+	if event.Source == "" || event.DetailType == "" {
+		return "", nil, errNoTopic
+	}
+	return event.Source + "/" + event.DetailType, event.Detail, nil
+}
+
+var errNoTopic = errors.New("awspubsub: message without topic")
+
+// Broker is a pubsub.Broker publishing to SNS and receiving from SQS. Run long polls the queue for
+// batches of messages.
+//
+// The messages are deleted from the queue once they are delivered to the local subscriptions, the
+// visibility timeout of the batch being extended while the subscriptions lag behind. The messages
+// which can't be delivered within the visibility timeout are deleted as well: receiving them again
+// would duplicate them for the subscriptions which received them.
+type Broker struct {
+	Client Client
+	// TopicARN is the SNS topic the messages are published to.
+	TopicARN string
+	// QueueURL is the SQS queue of the process, subscribed to the SNS topic or to an EventBridge
+	// rule.
+	QueueURL string
+	// Decode returns the topic and the payload of the received messages, it defaults to DecodeSNS.
+	Decode DecodeFunc
+	// MaxMessages is the size of the batches received, it defaults to 10, the maximum of SQS.
+	MaxMessages int
+	// WaitTime is the duration of the long polls, it defaults to 20 seconds, the maximum of SQS.
+	WaitTime time.Duration
+	// VisibilityTimeout is the time to deliver a message before it is extended, it defaults to 30
+	// seconds.
+	VisibilityTimeout time.Duration
+	// RetryInterval is the delay before receiving again after a failure, it defaults to 1 second.
+	RetryInterval time.Duration
+	// ErrorFunc is called with the failures of the queue and the messages which can't be decoded.
+	ErrorFunc func(ctx context.Context, err error)
+
+	fanout pubsub.Fanout
+}
+
+var _ pubsub.Broker = &Broker{}
+
+// Publish implements pubsub.Broker
+func (b *Broker) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	for _, level := range strings.Split(topic, "/") {
+		if level == "+" || level == "#" {
+			return pubsub.ErrInvalidTopic
+		}
+	}
+	return b.Client.Publish(ctx, b.TopicARN, string(payload), map[string]string{TopicAttribute: topic})
+}
+
+// Subscribe implements pubsub.Broker
+func (b *Broker) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	return b.fanout.Subscribe(ctx, topic)
+}
+
+// Run receives the messages of the queue until ctx is done.
+func (b *Broker) Run(ctx context.Context) error {
+	input := ReceiveInput{
+		QueueURL:          b.QueueURL,
+		MaxMessages:       b.MaxMessages,
+		WaitTime:          b.WaitTime,
+		VisibilityTimeout: b.visibilityTimeout(),
+	}
+	if input.MaxMessages == 0 {
+		input.MaxMessages = defaultMaxMessages
+	}
+	if input.WaitTime == 0 {
+		input.WaitTime = defaultWaitTime
+	}
+
+	for {
+		messages, err := b.Client.ReceiveMessages(ctx, input)
+		if err == nil {
+			err = b.deliver(ctx, messages)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		b.report(ctx, err)
+
+		timer := time.NewTimer(b.retryInterval())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// deliver delivers a batch of messages to the local subscriptions, extending its visibility
+// timeout until it is done, then deletes it.
+func (b *Broker) deliver(ctx context.Context, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	handles := make([]string, len(messages))
+	for i, msg := range messages {
+		handles[i] = msg.ReceiptHandle
+	}
+
+	timeout := b.visibilityTimeout()
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := b.Client.ChangeVisibility(ctx, b.QueueURL, handles, timeout); ctx.Err() == nil {
+					b.report(ctx, err)
+				}
+			}
+		}
+	}()
+
+	decode := b.Decode
+	if decode == nil {
+		decode = DecodeSNS
+	}
+	for _, msg := range messages {
+		topic, payload, err := decode(msg)
+		if err != nil {
+			b.report(ctx, err)
+			continue
+		}
+		deliverCtx, cancel := context.WithTimeout(ctx, timeout)
+		b.report(ctx, b.fanout.Deliver(deliverCtx, pubsub.Message{Topic: topic, Payload: payload}))
+		cancel()
+	}
+	close(done)
+	wg.Wait()
+	if ctx.Err() != nil {
+		// left in the queue for the next run
+		return ctx.Err()
+	}
+	return b.Client.DeleteMessages(ctx, b.QueueURL, handles)
+}
+
+func (b *Broker) visibilityTimeout() time.Duration {
+	if b.VisibilityTimeout == 0 {
+		return defaultVisibilityTimeout
+	}
+	return b.VisibilityTimeout
+}
+
+func (b *Broker) retryInterval() time.Duration {
+	if b.RetryInterval == 0 {
+		return defaultRetryInterval
+	}
+	return b.RetryInterval
+}
+
+func (b *Broker) report(ctx context.Context, err error) {
+	if err != nil && b.ErrorFunc != nil {
+		b.ErrorFunc(ctx, err)
+	}
+}
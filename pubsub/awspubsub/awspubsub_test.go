@@ -0,0 +1,146 @@
+package awspubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub/internal/pubsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient is an SNS topic with raw message delivery to a single queue.
+type testClient struct {
+	mu        sync.Mutex
+	queue     chan Message
+	inputs    []ReceiveInput
+	deleted   []string
+	extended  int
+	failFirst bool
+	n         int
+}
+
+func (c *testClient) Publish(ctx context.Context, topicARN string, body string, attributes map[string]string) error {
+	c.mu.Lock()
+	c.n++
+	handle := strconv.Itoa(c.n)
+	c.mu.Unlock()
+	c.queue <- Message{ID: handle, ReceiptHandle: handle, Body: body, Attributes: attributes}
+	return nil
+}
+
+func (c *testClient) ReceiveMessages(ctx context.Context, input ReceiveInput) ([]Message, error) {
+	c.mu.Lock()
+	c.inputs = append(c.inputs, input)
+	fail := c.failFirst
+	c.failFirst = false
+	c.mu.Unlock()
+	if fail {
+		return nil, errors.New("throttled")
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case msg := <-c.queue:
+		messages := []Message{msg}
+		for len(messages) < input.MaxMessages {
+			select {
+			case msg := <-c.queue:
+				messages = append(messages, msg)
+			default:
+				return messages, nil
+			}
+		}
+		return messages, nil
+	}
+}
+
+func (c *testClient) DeleteMessages(ctx context.Context, queueURL string, receiptHandles []string) error {
+	c.mu.Lock()
+	c.deleted = append(c.deleted, receiptHandles...)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *testClient) ChangeVisibility(ctx context.Context, queueURL string, receiptHandles []string, timeout time.Duration) error {
+	c.mu.Lock()
+	c.extended++
+	c.mu.Unlock()
+	return nil
+}
+
+func TestDecode(t *testing.T) {
+	topic, payload, err := DecodeSNS(Message{Body: `{"Type":"Notification","Message":"{\"id\":1}","MessageAttributes":{"topic":{"Type":"String","Value":"orders/1"}}}`})
+	assert.NoError(t, err)
+	assert.Equal(t, "orders/1", topic)
+	assert.Equal(t, json.RawMessage(`{"id":1}`), payload)
+
+	topic, payload, err = DecodeEventBridge(Message{Body: `{"source":"orders","detail-type":"OrderPaid","detail":{"id":1}}`})
+	assert.NoError(t, err)
+	assert.Equal(t, "orders/OrderPaid", topic)
+	assert.Equal(t, json.RawMessage(`{"id":1}`), payload)
+
+	_, _, err = DecodeEventBridge(Message{Body: `{"detail":{}}`})
+	assert.Equal(t, errNoTopic, err)
+}
+
+func TestBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &testClient{queue: make(chan Message, 16), failFirst: true}
+	var mu sync.Mutex
+	var errs []string
+	broker := &Broker{
+		Client:            client,
+		TopicARN:          "arn:aws:sns:us-east-1:123456789012:events",
+		QueueURL:          "https://sqs.us-east-1.amazonaws.com/123456789012/graphqlws-1",
+		VisibilityTimeout: 20 * time.Millisecond,
+		RetryInterval:     10 * time.Millisecond,
+		Decode: func(msg Message) (string, json.RawMessage, error) {
+			// the batch is extended while it is delivered
+			time.Sleep(15 * time.Millisecond)
+			return DecodeSNS(msg)
+		},
+		ErrorFunc: func(ctx context.Context, err error) {
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		},
+	}
+
+	status, err := broker.Subscribe(ctx, "orders/+/status")
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "user/1", json.RawMessage(`{}`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/42/status", json.RawMessage(`{"status":"paid"}`)))
+	assert.Equal(t, pubsub.ErrInvalidTopic, broker.Publish(ctx, "orders/+/status", json.RawMessage(`{}`)))
+
+	done := make(chan error)
+	go func() { done <- broker.Run(ctx) }()
+	assert.Equal(t, pubsub.Message{Topic: "orders/42/status", Payload: json.RawMessage(`{"status":"paid"}`)}, pubsubtest.Receive(t, status))
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.deleted) == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.Equal(t, []string{"1", "2"}, client.deleted)
+	assert.NotZero(t, client.extended)
+	assert.Equal(t, ReceiveInput{
+		QueueURL:          broker.QueueURL,
+		MaxMessages:       10,
+		WaitTime:          20 * time.Second,
+		VisibilityTimeout: 20 * time.Millisecond,
+	}, client.inputs[0])
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"throttled"}, errs)
+}
@@ -0,0 +1,288 @@
+// Package cdc publishes the row changes captured by Debezium to the topics of a pubsub.Broker, so
+// that the clients subscribe to the changes of the rows without custom glue, e.g. the updates of
+// the "inventory.orders" table published to "orders/{id}".
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+const defaultRetryInterval = time.Second
+
+// ErrTombstone is returned when parsing the tombstone following the deletion of a row, it carries
+// no change.
+var ErrTombstone = errors.New("cdc: tombstone")
+
+// Operation is the kind of a change.
+type Operation string
+
+const (
+	Create   Operation = "c"
+	Update   Operation = "u"
+	Delete   Operation = "d"
+	Read     Operation = "r" // read by a snapshot
+	Truncate Operation = "t"
+)
+
+// SourceInfo is the origin of a change.
+type SourceInfo struct {
+	Connector string `json:"connector"`
+	Database  string `json:"db"`
+	Schema    string `json:"schema"`
+	Table     string `json:"table"`
+}
+
+// ChangeEvent is a change event of Debezium.
+type ChangeEvent struct {
+	Operation Operation       `json:"op"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Source    SourceInfo      `json:"source"`
+	// Timestamp is the time the change was processed by the connector, in milliseconds.
+	Timestamp int64 `json:"ts_ms"`
+}
+
+// Row returns the state of the row after the change, or before it for a deletion.
+func (e ChangeEvent) Row() json.RawMessage {
+	if e.Operation == Delete {
+		return e.Before
+	}
+	return e.After
+}
+
+var errNotChangeEvent = errors.New("cdc: not a change event")
+
+// ParseEvent parses the value of a change event, with or without the schema of the JSON
+// converter.
+func ParseEvent(value []byte) (ChangeEvent, error) {
+	if len(value) == 0 {
+		return ChangeEvent{}, ErrTombstone
+	}
+	var envelope struct {
+		Schema  json.RawMessage `json:"schema"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return ChangeEvent{}, err
+	}
+	if envelope.Payload != nil {
+		value = envelope.Payload
+	}
+	var event ChangeEvent
+	if err := json.Unmarshal(value, &event); err != nil {
+		return ChangeEvent{}, err
+	}
+	if event.Operation == "" {
+		return ChangeEvent{}, errNotChangeEvent
+	}
+	// the missing rows are null
+	if string(event.Before) == "null" {
+		event.Before = nil
+	}
+	if string(event.After) == "null" {
+		event.After = nil
+	}
+	return event, nil
+}
+
+// Change is the default payload of the changes published.
+type Change struct {
+	Operation Operation       `json:"operation"`
+	Table     string          `json:"table"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// PayloadFunc returns the payload published for a change.
+type PayloadFunc func(event ChangeEvent) (any, error)
+
+// RowPayload returns a PayloadFunc publishing the row of the changes decoded to T, see
+// ChangeEvent.Row, e.g. to subscribe to the topics with a pubsub.Topic[T].
+func RowPayload[T any]() PayloadFunc {
+	return func(event ChangeEvent) (any, error) {
+		var row T
+		if err := json.Unmarshal(event.Row(), &row); err != nil {
+			return nil, err
+		}
+		return row, nil
+	}
+}
+
+// Mapping publishes the changes of a table to a topic.
+type Mapping struct {
+	// Table is the table of the changes, qualified by its schema or database, e.g.
+	// "inventory.orders", or not.
+	Table string
+	// Topic is the topic of the changes, its "{column}" placeholders are replaced with the columns
+	// of the row, e.g. "orders/{id}".
+	Topic string
+	// Operations are the operations published, all of them when empty.
+	Operations []Operation
+	// Payload returns the payload of a change, it defaults to a Change.
+	Payload PayloadFunc
+}
+
+// matches returns true if the mapping publishes the event.
+func (m Mapping) matches(event ChangeEvent) bool {
+	table := event.Source.Table
+	if m.Table != table && m.Table != event.Source.Schema+"."+table && m.Table != event.Source.Database+"."+table {
+		return false
+	}
+	return len(m.Operations) == 0 || slices.Contains(m.Operations, event.Operation)
+}
+
+// topic returns the topic of an event, with the placeholders replaced.
+func (m Mapping) topic(event ChangeEvent) (string, error) {
+	if !strings.Contains(m.Topic, "{") {
+		return m.Topic, nil
+	}
+	var row map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(event.Row()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&row); err != nil {
+		return "", err
+	}
+	return pubsub.ExpandTopic(m.Topic, row)
+}
+
+func (m Mapping) payload(event ChangeEvent) (json.RawMessage, error) {
+	var payload any = Change{
+		Operation: event.Operation,
+		Table:     event.Source.Table,
+		Before:    event.Before,
+		After:     event.After,
+	}
+	if m.Payload != nil {
+		var err error
+		if payload, err = m.Payload(event); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(payload)
+}
+
+// Record is a message of a Kafka topic of Debezium.
+type Record struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// Reader is the subset of a Kafka consumer group reader used by the Source, e.g. an adapter of the
+// reader of github.com/segmentio/kafka-go.
+type Reader interface {
+	// FetchMessage returns the next record, without committing it.
+	FetchMessage(ctx context.Context) (Record, error)
+	CommitMessages(ctx context.Context, records ...Record) error
+}
+
+// Source publishes the change events read from Kafka to the topics of their mappings. Every
+// mapping matching an event publishes it, and the record of the event is committed once it is
+// published.
+type Source struct {
+	Reader   Reader
+	Broker   pubsub.Broker
+	Mappings []Mapping
+	// RetryInterval is the delay before publishing again after a failure, it defaults to 1 second.
+	RetryInterval time.Duration
+	// ErrorFunc is called with the failures of the reader and of the broker, and with the events
+	// which can't be mapped, they are skipped.
+	ErrorFunc func(ctx context.Context, err error)
+}
+
+// Run publishes the change events until ctx is done.
+func (s *Source) Run(ctx context.Context) error {
+	for {
+		record, err := s.Reader.FetchMessage(ctx)
+		if err == nil {
+			err = s.publish(ctx, record)
+		}
+		if err == nil {
+			err = s.Reader.CommitMessages(ctx, record)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		s.report(ctx, err)
+		if err := s.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// publish publishes the event of a record to the topics of its mappings, retrying the failures of
+// the broker.
+func (s *Source) publish(ctx context.Context, record Record) error {
+	event, err := ParseEvent(record.Value)
+	if errors.Is(err, ErrTombstone) {
+		return nil
+	}
+	if err != nil {
+		s.report(ctx, err)
+		return nil
+	}
+
+	for _, mapping := range s.Mappings {
+		if !mapping.matches(event) {
+			continue
+		}
+		topic, err := mapping.topic(event)
+		if err != nil {
+			s.report(ctx, err)
+			continue
+		}
+		payload, err := mapping.payload(event)
+		if err != nil {
+			s.report(ctx, err)
+			continue
+		}
+		for {
+			err := s.Broker.Publish(ctx, topic, payload)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.report(ctx, err)
+			if err := s.wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Source) wait(ctx context.Context) error {
+	retryInterval := s.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultRetryInterval
+	}
+	timer := time.NewTimer(retryInterval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Source) report(ctx context.Context, err error) {
+	if err != nil && s.ErrorFunc != nil {
+		s.ErrorFunc(ctx, err)
+	}
+}
@@ -0,0 +1,155 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub/internal/pubsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	orderCreated = `{"schema":{},"payload":{"op":"c","before":null,"after":{"id":9007199254740993,"status":"new"},"source":{"connector":"postgresql","db":"shop","schema":"inventory","table":"orders"},"ts_ms":1700000000000}}`
+	orderDeleted = `{"op":"d","before":{"id":42,"status":"paid"},"after":null,"source":{"connector":"postgresql","db":"shop","schema":"inventory","table":"orders"},"ts_ms":1700000000001}`
+	userUpdated  = `{"op":"u","before":{"id":1},"after":{"id":1},"source":{"db":"shop","schema":"inventory","table":"users"}}`
+)
+
+func TestParseEvent(t *testing.T) {
+	event, err := ParseEvent([]byte(orderCreated))
+	assert.NoError(t, err)
+	assert.Equal(t, Create, event.Operation)
+	assert.Equal(t, SourceInfo{Connector: "postgresql", Database: "shop", Schema: "inventory", Table: "orders"}, event.Source)
+	assert.JSONEq(t, `{"id":9007199254740993,"status":"new"}`, string(event.Row()))
+
+	event, err = ParseEvent([]byte(orderDeleted))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":42,"status":"paid"}`, string(event.Row()))
+
+	_, err = ParseEvent(nil)
+	assert.Equal(t, ErrTombstone, err)
+	_, err = ParseEvent([]byte(`{"id":1}`))
+	assert.Equal(t, errNotChangeEvent, err)
+}
+
+func TestMappingTopic(t *testing.T) {
+	event, _ := ParseEvent([]byte(orderCreated))
+	topic, err := Mapping{Topic: "orders/{id}/{status}"}.topic(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "orders/9007199254740993/new", topic)
+
+	_, err = Mapping{Topic: "orders/{customer}"}.topic(event)
+	assert.EqualError(t, err, `pubsub: no field "customer" for topic "orders/{customer}"`)
+}
+
+// testReader returns the records then blocks until ctx is done.
+type testReader struct {
+	mu        sync.Mutex
+	records   []Record
+	committed []int64
+}
+
+func (r *testReader) FetchMessage(ctx context.Context) (Record, error) {
+	r.mu.Lock()
+	if len(r.records) > 0 {
+		record := r.records[0]
+		r.records = r.records[1:]
+		r.mu.Unlock()
+		return record, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return Record{}, ctx.Err()
+}
+
+func (r *testReader) CommitMessages(ctx context.Context, records ...Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range records {
+		r.committed = append(r.committed, record.Offset)
+	}
+	return nil
+}
+
+// failingBroker fails the first publication.
+type failingBroker struct {
+	pubsub.Broker
+	failed bool
+}
+
+func (b *failingBroker) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	if !b.failed {
+		b.failed = true
+		return errors.New("unavailable")
+	}
+	return b.Broker.Publish(ctx, topic, payload)
+}
+
+type order struct {
+	ID     json.Number `json:"id"`
+	Status string      `json:"status"`
+}
+
+func TestSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := pubsub.NewMemory()
+	changes, err := broker.Subscribe(ctx, "orders/#")
+	assert.NoError(t, err)
+	statuses, err := pubsub.NewTopic[order](broker, "orders/+/status").Subscribe(ctx)
+	assert.NoError(t, err)
+
+	reader := &testReader{records: []Record{
+		{Offset: 1, Value: []byte(orderCreated)},
+		{Offset: 2, Value: []byte(userUpdated)},
+		{Offset: 3, Value: []byte(`not json`)},
+		{Offset: 4, Value: []byte(orderDeleted)},
+		{Offset: 5},
+	}}
+	var mu sync.Mutex
+	var errs []string
+	source := &Source{
+		Reader: reader,
+		Broker: &failingBroker{Broker: broker},
+		Mappings: []Mapping{
+			{Table: "inventory.orders", Topic: "orders/{id}"},
+			{Table: "orders", Topic: "orders/{id}/status", Operations: []Operation{Create, Update}, Payload: RowPayload[order]()},
+		},
+		RetryInterval: 10 * time.Millisecond,
+		ErrorFunc: func(ctx context.Context, err error) {
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		},
+	}
+	done := make(chan error)
+	go func() { done <- source.Run(ctx) }()
+
+	msg := pubsubtest.Receive(t, changes)
+	assert.Equal(t, "orders/9007199254740993", msg.Topic)
+	assert.JSONEq(t, `{"operation":"c","table":"orders","after":{"id":9007199254740993,"status":"new"}}`, string(msg.Payload))
+	assert.Equal(t, "orders/9007199254740993/status", pubsubtest.Receive(t, changes).Topic)
+	select {
+	case status := <-statuses:
+		assert.Equal(t, order{ID: "9007199254740993", Status: "new"}, status)
+	case <-time.After(time.Second):
+		t.Fatal("no status received")
+	}
+	msg = pubsubtest.Receive(t, changes)
+	assert.Equal(t, "orders/42", msg.Topic)
+	assert.JSONEq(t, `{"operation":"d","table":"orders","before":{"id":42,"status":"paid"}}`, string(msg.Payload))
+
+	assert.Eventually(t, func() bool {
+		reader.mu.Lock()
+		defer reader.mu.Unlock()
+		return len(reader.committed) == 5
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"unavailable", "invalid character 'o' in literal null (expecting 'u')"}, errs)
+}
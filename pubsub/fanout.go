@@ -0,0 +1,92 @@
+package pubsub
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Fanout delivers the messages a driver receives from its backend to the subscriptions of the
+// process, so that the process subscribes once to every pattern of the backend whatever the
+// number of its subscriptions.
+type Fanout struct {
+	// Bind subscribes the process to a pattern in the backend, it is called by the first
+	// subscription to the pattern.
+	Bind func(ctx context.Context, pattern string) error
+	// Unbind unsubscribes the process from a pattern, it is called once the last subscription to
+	// the pattern is done.
+	Unbind func(pattern string)
+
+	once     sync.Once
+	local    *Memory
+	mu       sync.Mutex
+	patterns map[string]int
+}
+
+func (f *Fanout) init() {
+	f.once.Do(func() {
+		f.local = NewMemory()
+		f.patterns = map[string]int{}
+	})
+}
+
+// Subscribe returns the messages delivered to a pattern after the call, until ctx is done.
+func (f *Fanout) Subscribe(ctx context.Context, pattern string) (<-chan Message, error) {
+	f.init()
+	if !validPattern(pattern) {
+		return nil, ErrInvalidTopic
+	}
+
+	f.mu.Lock()
+	f.patterns[pattern]++
+	first := f.patterns[pattern] == 1
+	f.mu.Unlock()
+	if first && f.Bind != nil {
+		if err := f.Bind(ctx, pattern); err != nil {
+			f.release(pattern, false)
+			return nil, err
+		}
+	}
+
+	messages, err := f.local.Subscribe(ctx, pattern)
+	if err != nil {
+		f.release(pattern, true)
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { f.release(pattern, true) })
+	return messages, nil
+}
+
+// release drops a subscription to a pattern, unbinding the pattern with the last one when bound.
+func (f *Fanout) release(pattern string, bound bool) {
+	f.mu.Lock()
+	f.patterns[pattern]--
+	last := f.patterns[pattern] == 0
+	if last {
+		delete(f.patterns, pattern)
+	}
+	f.mu.Unlock()
+	if last && bound && f.Unbind != nil {
+		f.Unbind(pattern)
+	}
+}
+
+// Deliver sends a message received from the backend to the subscriptions matching its topic.
+func (f *Fanout) Deliver(ctx context.Context, msg Message) error {
+	f.init()
+	return f.local.Publish(ctx, msg.Topic, msg.Payload)
+}
+
+// Patterns returns the sorted patterns subscribed to, e.g. to subscribe again after recovering
+// from a failure of the backend.
+func (f *Fanout) Patterns() []string {
+	f.init()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	patterns := make([]string, 0, len(f.patterns))
+	for pattern := range f.patterns {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
@@ -0,0 +1,54 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanout(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		calls = append(calls, call)
+		mu.Unlock()
+	}
+	f := &Fanout{
+		Bind: func(ctx context.Context, pattern string) error {
+			if pattern == "denied" {
+				return errors.New("denied")
+			}
+			record("bind " + pattern)
+			return nil
+		},
+		Unbind: func(pattern string) { record("unbind " + pattern) },
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	first, err := f.Subscribe(ctx1, "orders/+")
+	assert.NoError(t, err)
+	second, err := f.Subscribe(ctx2, "orders/+")
+	assert.NoError(t, err)
+	_, err = f.Subscribe(ctx2, "denied")
+	assert.EqualError(t, err, "denied")
+	assert.Equal(t, []string{"orders/+"}, f.Patterns())
+
+	assert.NoError(t, f.Deliver(context.Background(), Message{Topic: "orders/1", Payload: json.RawMessage(`{}`)}))
+	assert.Equal(t, "orders/1", receive(t, first).Topic)
+	assert.Equal(t, "orders/1", receive(t, second).Topic)
+
+	// the pattern is unbound with its last subscription
+	cancel1()
+	cancel2()
+	assert.Eventually(t, func() bool { return len(f.Patterns()) == 0 }, time.Second, time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"bind orders/+", "unbind orders/+"}, calls)
+}
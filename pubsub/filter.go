@@ -0,0 +1,443 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Predicate tells whether a subscription receives a message.
+type Predicate func(msg Message) bool
+
+type filterCtxKey struct{}
+
+// WithFilter returns a copy of ctx whose subscriptions only receive the messages matching pred,
+// so that e.g. "only the orders of the region of the user" doesn't require a topic per region.
+// It is meant to be bound once an operation starts, e.g. by the SubscribeFunc of the transport,
+// for the subscriptions of its resolver. The filters of the parent contexts apply too.
+//
+// The Memory broker, and the brokers delivering through it like the Fanout of the drivers,
+// evaluate the filters while fanning out the messages, before queuing them. The predicates must
+// be fast and mustn't use the broker.
+func WithFilter(ctx context.Context, pred Predicate) context.Context {
+	if parent := filterFrom(ctx); parent != nil {
+		pred = And(parent, pred)
+	}
+	return context.WithValue(ctx, filterCtxKey{}, pred)
+}
+
+func filterFrom(ctx context.Context) Predicate {
+	pred, _ := ctx.Value(filterCtxKey{}).(Predicate)
+	return pred
+}
+
+// And returns a Predicate matching the messages matched by every predicate.
+func And(preds ...Predicate) Predicate {
+	return func(msg Message) bool {
+		for _, pred := range preds {
+			if !pred(msg) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a Predicate matching the messages matched by any predicate.
+func Or(preds ...Predicate) Predicate {
+	return func(msg Message) bool {
+		for _, pred := range preds {
+			if pred(msg) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterExpr is a compiled filter expression evaluated against the JSON payloads of the
+// messages, see CompileFilter.
+type FilterExpr struct {
+	source string
+	root   filterNode
+}
+
+// CompileFilter compiles a filter expression comparing the fields of the payloads, by their dot
+// separated path, with literals or with variables bound at subscribe time, e.g.
+//
+//	region == $region && (amount >= 100 || customer.tier in ["gold", "platinum"])
+//
+// The operators are ==, !=, <, <=, >, >=, in, &&, || and !, the literals are the JSON strings,
+// in double or single quotes, numbers, booleans, null and lists. A path alone is true when its
+// value is neither false, null, zero nor empty, and the missing fields are null.
+func CompileFilter(expr string) (*FilterExpr, error) {
+	p := &filterParser{tokens: tokenizeFilter(expr)}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pubsub: compiling filter %q: %w", expr, err)
+	}
+	return &FilterExpr{source: expr, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (f *FilterExpr) String() string {
+	return f.source
+}
+
+// Bind returns the Predicate of the expression with the values of its variables, by their name
+// without "$". The variables missing from vars are null. The messages whose payload isn't JSON
+// aren't matched.
+func (f *FilterExpr) Bind(vars map[string]interface{}) (Predicate, error) {
+	// the values are normalized to the types of the decoded payloads
+	b, err := json.Marshal(vars)
+	if err != nil {
+		return nil, err
+	}
+	var bound map[string]interface{}
+	if err := json.Unmarshal(b, &bound); err != nil {
+		return nil, err
+	}
+	return func(msg Message) bool {
+		var payload interface{}
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return false
+		}
+		return truthy(f.root.eval(payload, bound))
+	}, nil
+}
+
+// filterNode is a node of a compiled filter expression.
+type filterNode interface {
+	eval(payload interface{}, vars map[string]interface{}) interface{}
+}
+
+type (
+	literalNode  struct{ value interface{} }
+	pathNode     struct{ path []string }
+	variableNode struct{ path []string }
+	listNode     struct{ items []filterNode }
+	notNode      struct{ operand filterNode }
+	logicalNode  struct {
+		and         bool
+		left, right filterNode
+	}
+	compareNode struct {
+		op          string
+		left, right filterNode
+	}
+)
+
+func (n literalNode) eval(payload interface{}, vars map[string]interface{}) interface{} {
+	return n.value
+}
+
+func (n pathNode) eval(payload interface{}, vars map[string]interface{}) interface{} {
+	return lookupPath(payload, n.path)
+}
+
+func (n variableNode) eval(payload interface{}, vars map[string]interface{}) interface{} {
+	return lookupPath(vars[n.path[0]], n.path[1:])
+}
+
+func (n listNode) eval(payload interface{}, vars map[string]interface{}) interface{} {
+	items := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		items[i] = item.eval(payload, vars)
+	}
+	return items
+}
+
+func (n notNode) eval(payload interface{}, vars map[string]interface{}) interface{} {
+	return !truthy(n.operand.eval(payload, vars))
+}
+
+func (n logicalNode) eval(payload interface{}, vars map[string]interface{}) interface{} {
+	left := truthy(n.left.eval(payload, vars))
+	if left != n.and {
+		return left
+	}
+	return truthy(n.right.eval(payload, vars))
+}
+
+func (n compareNode) eval(payload interface{}, vars map[string]interface{}) interface{} {
+	left, right := n.left.eval(payload, vars), n.right.eval(payload, vars)
+	switch n.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "in":
+		items, _ := right.([]interface{})
+		for _, item := range items {
+			if equal(left, item) {
+				return true
+			}
+		}
+		return false
+	}
+	var cmp int
+	switch left := left.(type) {
+	case float64:
+		right, ok := right.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case left < right:
+			cmp = -1
+		case left > right:
+			cmp = 1
+		}
+	case string:
+		right, ok := right.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(left, right)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func lookupPath(v interface{}, path []string) interface{} {
+	for _, name := range path {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = object[name]
+	}
+	return v
+}
+
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil, bool, float64, string:
+		return a == b
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) != 0
+	case map[string]interface{}:
+		return len(v) != 0
+	}
+	return true
+}
+
+type filterToken struct {
+	kind byte // 'i'dentifier, '$'variable, 's'tring, 'n'umber, 'o'perator, '?' invalid
+	text string
+}
+
+func tokenizeFilter(expr string) []filterToken {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(expr) && expr[end] != c {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return append(tokens, filterToken{'?', expr[i:]})
+			}
+			tokens = append(tokens, filterToken{'s', expr[i : end+1]})
+			i = end + 1
+		case c == '$' || c == '_' || unicode.IsLetter(rune(c)):
+			end := i + 1
+			for end < len(expr) && (expr[end] == '_' || expr[end] == '.' || unicode.IsLetter(rune(expr[end])) || unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			kind := byte('i')
+			if c == '$' {
+				kind = '$'
+			}
+			tokens = append(tokens, filterToken{kind, expr[i:end]})
+			i = end
+		case c == '-' || unicode.IsDigit(rune(c)):
+			end := i + 1
+			for end < len(expr) && strings.IndexByte("0123456789.eE+-", expr[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, filterToken{'n', expr[i:end]})
+			i = end
+		default:
+			op := string(c)
+			if i+1 < len(expr) {
+				switch two := expr[i : i+2]; two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					op = two
+				}
+			}
+			tokens = append(tokens, filterToken{'o', op})
+			i += len(op)
+		}
+	}
+	return tokens
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) accept(kind byte, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept('o', text) {
+		return fmt.Errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept('o', "||") {
+		var right filterNode
+		if right, err = p.parseAnd(); err == nil {
+			left = logicalNode{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.accept('o', "&&") {
+		var right filterNode
+		if right, err = p.parseUnary(); err == nil {
+			left = logicalNode{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept('o', "!") {
+		operand, err := p.parseUnary()
+		return notNode{operand}, err
+	}
+	if p.accept('o', "(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == 'o' && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="),
+		t.kind == 'i' && t.text == "in":
+		p.pos++
+		right, err := p.parseOperand()
+		return compareNode{op: t.text, left: left, right: right}, err
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseOperand() (filterNode, error) {
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case 'i':
+		switch t.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null":
+			return literalNode{nil}, nil
+		}
+		return pathNode{strings.Split(t.text, ".")}, nil
+	case '$':
+		if len(t.text) == 1 {
+			return nil, fmt.Errorf("unnamed variable")
+		}
+		return variableNode{strings.Split(t.text[1:], ".")}, nil
+	case 's':
+		if t.text[0] == '\'' {
+			t.text = `"` + strings.ReplaceAll(strings.ReplaceAll(t.text[1:len(t.text)-1], `\'`, `'`), `"`, `\"`) + `"`
+		}
+		var s string
+		if err := json.Unmarshal([]byte(t.text), &s); err != nil {
+			return nil, fmt.Errorf("invalid string %s", t.text)
+		}
+		return literalNode{s}, nil
+	case 'n':
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t.text)
+		}
+		return literalNode{n}, nil
+	case 'o':
+		if t.text == "[" {
+			var items []filterNode
+			for !p.accept('o', "]") {
+				if len(items) != 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return listNode{items}, nil
+		}
+	case 0:
+		return nil, fmt.Errorf("unexpected end")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
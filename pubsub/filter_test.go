@@ -0,0 +1,91 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileFilter(t *testing.T) {
+	payload := json.RawMessage(`{"region":"eu","amount":150,"customer":{"tier":"gold","name":"O'Brien"},"tags":[],"paid":true}`)
+	vars := map[string]interface{}{"region": "eu", "min": 100, "user": map[string]interface{}{"tiers": []string{"gold"}}}
+
+	for expr, expected := range map[string]bool{
+		`region == $region`:                       true,
+		`region != "eu"`:                          false,
+		`amount >= $min && amount < 200`:          true,
+		`amount > 1.5e2`:                          false,
+		`customer.tier in ["gold", 'platinum']`:   true,
+		`customer.tier in $user.tiers`:            true,
+		`customer.name == 'O\'Brien'`:             true,
+		`paid && !(region == "us" || amount < 0)`: true,
+		`tags || missing`:                         false,
+		`missing == null && $missing == null`:     true,
+		`region < "fr" && customer.tier > "fr"`:   true,
+		`amount == "150"`:                         false,
+		`region == $region || amount / 2`:         false,
+	} {
+		f, err := CompileFilter(expr)
+		if expr == `region == $region || amount / 2` {
+			assert.Error(t, err, expr)
+			continue
+		}
+		if !assert.NoError(t, err, expr) {
+			continue
+		}
+		pred, err := f.Bind(vars)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, pred(Message{Payload: payload}), expr)
+	}
+
+	for _, expr := range []string{``, `region ==`, `(region == "eu"`, `"unterminated`, `$`, `region == [1,`} {
+		_, err := CompileFilter(expr)
+		assert.Error(t, err, expr)
+	}
+
+	filter, err := CompileFilter(`region == "eu"`)
+	assert.NoError(t, err)
+	pred, err := filter.Bind(nil)
+	assert.NoError(t, err)
+	assert.False(t, pred(Message{Payload: json.RawMessage(`not json`)}))
+}
+
+func TestMemoryFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := &Memory{Retain: true}
+	assert.NoError(t, broker.Publish(ctx, "orders/1", json.RawMessage(`{"region":"us"}`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/2", json.RawMessage(`{"region":"eu"}`)))
+
+	filter, err := CompileFilter(`region == $region`)
+	assert.NoError(t, err)
+	region, err := filter.Bind(map[string]interface{}{"region": "eu"})
+	assert.NoError(t, err)
+	filtered := WithFilter(ctx, region)
+	filtered = WithFilter(filtered, func(msg Message) bool { return msg.Topic != "orders/4" })
+	messages, err := broker.Subscribe(filtered, "orders/+")
+	assert.NoError(t, err)
+	all, err := broker.Subscribe(ctx, "orders/+")
+	assert.NoError(t, err)
+
+	// the retained messages are filtered too
+	assert.Equal(t, "orders/2", receive(t, messages).Topic)
+	receive(t, all)
+	receive(t, all)
+
+	for i, payload := range []string{`{"region":"us"}`, `{"region":"eu"}`, `{"region":"eu"}`} {
+		topic := "orders/" + string(rune('3'+i))
+		assert.NoError(t, broker.Publish(ctx, topic, json.RawMessage(payload)))
+		assert.Equal(t, topic, receive(t, all).Topic)
+	}
+	assert.NoError(t, broker.Signal(ctx, "orders/9", json.RawMessage(`{"region":"us"}`)))
+	assert.NoError(t, broker.Signal(ctx, "orders/9", json.RawMessage(`{"region":"eu"}`)))
+
+	assert.Equal(t, "orders/5", receive(t, messages).Topic)
+	msg := receive(t, messages)
+	assert.Equal(t, "orders/9", msg.Topic)
+	assert.JSONEq(t, `{"region":"eu"}`, string(msg.Payload))
+	assert.Empty(t, messages)
+}
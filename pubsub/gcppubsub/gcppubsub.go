@@ -0,0 +1,274 @@
+// Package gcppubsub is a pubsub driver for Google Cloud Pub/Sub. The topics are published as the
+// "topic" attribute of the messages of a single Pub/Sub topic, and every process receives them from
+// a subscription of its own, filtered to the topics it serves.
+//
+// The subscriptions are created and deleted through the Client, e.g. with the subscription admin of
+// cloud.google.com/go/pubsub, and FilterExpression builds the filter keeping the topics of a
+// process; Pub/Sub doesn't allow changing it once the subscription is created.
+package gcppubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+// TopicAttribute is the attribute of the messages holding their topic.
+const TopicAttribute = "topic"
+
+const (
+	defaultAckDeadline            = 10 * time.Second
+	defaultMaxExtension           = 30 * time.Second
+	defaultExpiration             = 24 * time.Hour
+	defaultMaxOutstandingMessages = 1000
+	defaultMaxOutstandingBytes    = 64 << 20
+	defaultRetryInterval          = time.Second
+)
+
+// Message is a message published to or received from Pub/Sub.
+type Message struct {
+	Data       []byte
+	Attributes map[string]string
+	// Ack acknowledges a received message.
+	Ack func()
+}
+
+// SubscriptionConfig configures the subscription of a process.
+type SubscriptionConfig struct {
+	// Topic is the Pub/Sub topic subscribed to.
+	Topic string
+	// Filter is the filter expression of the subscription, it can't be changed once created.
+	Filter string
+	// AckDeadline is the time to acknowledge a message before it is delivered again.
+	AckDeadline time.Duration
+	// Expiration deletes the subscription after this long without receiving, e.g. once the process
+	// crashed.
+	Expiration time.Duration
+}
+
+// ReceiveSettings are the flow control settings of the subscription.
+type ReceiveSettings struct {
+	// MaxExtension is the maximum time the deadline of a message is extended while it is delivered.
+	MaxExtension           time.Duration
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+}
+
+// Client is the subset of the Pub/Sub client used by the Broker.
+type Client interface {
+	CreateSubscription(ctx context.Context, id string, config SubscriptionConfig) error
+	DeleteSubscription(ctx context.Context, id string) error
+	Publish(ctx context.Context, topic string, msg *Message) error
+	// Receive calls fn with the messages of the subscription until ctx is done or it fails.
+	Receive(ctx context.Context, subscription string, settings ReceiveSettings, fn func(ctx context.Context, msg *Message)) error
+}
+
+// FlowControl limits the messages received and not delivered yet to the subscriptions of the
+// process, Pub/Sub holds the others back. The zero values use the defaults of 1000 messages and
+// 64MB.
+type FlowControl struct {
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+}
+
+// Broker is a pubsub.Broker publishing and receiving through a Pub/Sub topic. Run creates the
+// subscription of the process, receives its messages and deletes it once done.
+//
+// The messages are acknowledged once they are delivered to the local subscriptions, or dropped
+// after AckDeadline when the subscriptions lag behind: delivering them again would duplicate them
+// for the subscriptions which received them.
+type Broker struct {
+	Client Client
+	// Topic is the Pub/Sub topic of the messages.
+	Topic string
+	// SubscriptionID is the subscription of the process, it defaults to "graphqlws-" followed by
+	// a random suffix.
+	SubscriptionID string
+	// Filter is the filter expression of the subscription, e.g. made by FilterExpression, so that
+	// the process doesn't receive the topics it doesn't serve. It receives every topic when empty.
+	Filter string
+	// AckDeadline is the time to deliver a message to the local subscriptions, it defaults to 10
+	// seconds, the minimum of Pub/Sub.
+	AckDeadline time.Duration
+	// MaxExtension bounds the extensions of the deadline of the messages, it defaults to 30
+	// seconds.
+	MaxExtension time.Duration
+	// Expiration deletes the subscription of a process once it stopped receiving, it defaults to
+	// 24 hours, the minimum of Pub/Sub.
+	Expiration  time.Duration
+	FlowControl FlowControl
+	// RetryInterval is the delay before receiving again after a failure, it defaults to 1 second.
+	RetryInterval time.Duration
+	// ErrorFunc is called with the failures of the subscription.
+	ErrorFunc func(ctx context.Context, err error)
+
+	once   sync.Once
+	id     string
+	fanout pubsub.Fanout
+}
+
+var _ pubsub.Broker = &Broker{}
+
+func (b *Broker) init() {
+	b.once.Do(func() {
+		b.id = b.SubscriptionID
+		if b.id == "" {
+			suffix := make([]byte, 8)
+			_, _ = rand.Read(suffix)
+			b.id = "graphqlws-" + hex.EncodeToString(suffix)
+		}
+	})
+}
+
+// Subscription returns the ID of the subscription of the process.
+func (b *Broker) Subscription() string {
+	b.init()
+	return b.id
+}
+
+// FilterExpression returns a filter expression receiving the topics with one of the prefixes, e.g.
+// "orders/" for the subscriptions to "orders/+/status".
+func FilterExpression(prefixes ...string) string {
+	conditions := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		conditions[i] = "hasPrefix(attributes." + TopicAttribute + ", " + strconv.Quote(prefix) + ")"
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// Publish implements pubsub.Broker
+func (b *Broker) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	for _, level := range strings.Split(topic, "/") {
+		if level == "+" || level == "#" {
+			return pubsub.ErrInvalidTopic
+		}
+	}
+	return b.Client.Publish(ctx, b.Topic, &Message{
+		Data:       payload,
+		Attributes: map[string]string{TopicAttribute: topic},
+	})
+}
+
+// Subscribe implements pubsub.Broker, the subscription of the process must receive the topics
+// matching the pattern, see Filter.
+func (b *Broker) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	return b.fanout.Subscribe(ctx, topic)
+}
+
+// Run receives the messages of the subscription of the process until ctx is done, then deletes
+// the subscription.
+func (b *Broker) Run(ctx context.Context) error {
+	b.init()
+	err := b.retry(ctx, func() error {
+		return b.Client.CreateSubscription(ctx, b.id, SubscriptionConfig{
+			Topic:       b.Topic,
+			Filter:      b.Filter,
+			AckDeadline: b.ackDeadline(),
+			Expiration:  b.expiration(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		b.report(ctx, b.Client.DeleteSubscription(context.WithoutCancel(ctx), b.id))
+	}()
+
+	settings := ReceiveSettings{
+		MaxExtension:           b.maxExtension(),
+		MaxOutstandingMessages: b.FlowControl.MaxOutstandingMessages,
+		MaxOutstandingBytes:    b.FlowControl.MaxOutstandingBytes,
+	}
+	if settings.MaxOutstandingMessages == 0 {
+		settings.MaxOutstandingMessages = defaultMaxOutstandingMessages
+	}
+	if settings.MaxOutstandingBytes == 0 {
+		settings.MaxOutstandingBytes = defaultMaxOutstandingBytes
+	}
+	return b.retry(ctx, func() error {
+		err := b.Client.Receive(ctx, b.id, settings, b.receive)
+		if err == nil && ctx.Err() == nil {
+			// Receive returning before ctx is done is a failure as well
+			err = errReceiveStopped
+		}
+		return err
+	})
+}
+
+var errReceiveStopped = errors.New("gcppubsub: receive stopped")
+
+// receive delivers a message to the local subscriptions and acknowledges it.
+func (b *Broker) receive(ctx context.Context, msg *Message) {
+	defer msg.Ack()
+	ctx, cancel := context.WithTimeout(ctx, b.ackDeadline())
+	defer cancel()
+	topic := msg.Attributes[TopicAttribute]
+	if topic == "" {
+		return
+	}
+	b.report(ctx, b.fanout.Deliver(ctx, pubsub.Message{Topic: topic, Payload: msg.Data}))
+}
+
+// retry calls fn until it succeeds or ctx is done, waiting RetryInterval after every failure.
+func (b *Broker) retry(ctx context.Context, fn func() error) error {
+	for {
+		err := fn()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			return nil
+		}
+		b.report(ctx, err)
+
+		timer := time.NewTimer(b.retryInterval())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *Broker) ackDeadline() time.Duration {
+	if b.AckDeadline == 0 {
+		return defaultAckDeadline
+	}
+	return b.AckDeadline
+}
+
+func (b *Broker) maxExtension() time.Duration {
+	if b.MaxExtension == 0 {
+		return defaultMaxExtension
+	}
+	return b.MaxExtension
+}
+
+func (b *Broker) expiration() time.Duration {
+	if b.Expiration == 0 {
+		return defaultExpiration
+	}
+	return b.Expiration
+}
+
+func (b *Broker) retryInterval() time.Duration {
+	if b.RetryInterval == 0 {
+		return defaultRetryInterval
+	}
+	return b.RetryInterval
+}
+
+func (b *Broker) report(ctx context.Context, err error) {
+	if err != nil && b.ErrorFunc != nil {
+		b.ErrorFunc(ctx, err)
+	}
+}
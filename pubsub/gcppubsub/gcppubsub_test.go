@@ -0,0 +1,166 @@
+package gcppubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub/internal/pubsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient delivers the messages published to the subscriptions whose filter is a list of
+// prefixes.
+type testClient struct {
+	mu            sync.Mutex
+	subscriptions map[string]SubscriptionConfig
+	queues        map[string]chan *Message
+	settings      ReceiveSettings
+	acked         int
+	failReceive   bool
+}
+
+func newTestClient() *testClient {
+	return &testClient{subscriptions: map[string]SubscriptionConfig{}, queues: map[string]chan *Message{}}
+}
+
+func (c *testClient) CreateSubscription(ctx context.Context, id string, config SubscriptionConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[id] = config
+	c.queues[id] = make(chan *Message, 16)
+	return nil
+}
+
+func (c *testClient) DeleteSubscription(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.subscriptions, id)
+	return nil
+}
+
+func (c *testClient) Publish(ctx context.Context, topic string, msg *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, config := range c.subscriptions {
+		if config.Topic == topic && c.filter(config.Filter, msg.Attributes[TopicAttribute]) {
+			c.queues[id] <- &Message{Data: msg.Data, Attributes: msg.Attributes, Ack: c.ack}
+		}
+	}
+	return nil
+}
+
+// filter evaluates the expressions of FilterExpression.
+func (c *testClient) filter(filter string, topic string) bool {
+	if filter == "" {
+		return true
+	}
+	for _, condition := range strings.Split(filter, " OR ") {
+		prefix := strings.TrimSuffix(strings.TrimPrefix(condition, `hasPrefix(attributes.topic, "`), `")`)
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *testClient) ack() {
+	c.mu.Lock()
+	c.acked++
+	c.mu.Unlock()
+}
+
+func (c *testClient) Receive(ctx context.Context, subscription string, settings ReceiveSettings, fn func(ctx context.Context, msg *Message)) error {
+	c.mu.Lock()
+	c.settings = settings
+	queue := c.queues[subscription]
+	fail := c.failReceive
+	c.failReceive = false
+	c.mu.Unlock()
+	if fail {
+		return errors.New("unavailable")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-queue:
+			fn(ctx, msg)
+		}
+	}
+}
+
+func TestFilterExpression(t *testing.T) {
+	assert.Equal(t, `hasPrefix(attributes.topic, "orders/") OR hasPrefix(attributes.topic, "user/")`, FilterExpression("orders/", "user/"))
+}
+
+func TestBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := newTestClient()
+	client.failReceive = true
+	var mu sync.Mutex
+	var errs []string
+	broker := &Broker{
+		Client:        client,
+		Topic:         "events",
+		Filter:        FilterExpression("orders/"),
+		FlowControl:   FlowControl{MaxOutstandingMessages: 10},
+		RetryInterval: 10 * time.Millisecond,
+		ErrorFunc: func(ctx context.Context, err error) {
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		},
+	}
+	assert.True(t, strings.HasPrefix(broker.Subscription(), "graphqlws-"))
+
+	status, err := broker.Subscribe(ctx, "orders/+/status")
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- broker.Run(ctx) }()
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.settings.MaxOutstandingMessages != 0 && !client.failReceive
+	}, time.Second, time.Millisecond)
+
+	client.mu.Lock()
+	assert.Equal(t, SubscriptionConfig{
+		Topic:       "events",
+		Filter:      `hasPrefix(attributes.topic, "orders/")`,
+		AckDeadline: 10 * time.Second,
+		Expiration:  24 * time.Hour,
+	}, client.subscriptions[broker.Subscription()])
+	assert.Equal(t, ReceiveSettings{
+		MaxExtension:           30 * time.Second,
+		MaxOutstandingMessages: 10,
+		MaxOutstandingBytes:    64 << 20,
+	}, client.settings)
+	client.mu.Unlock()
+
+	// the topics excluded by the filter aren't received
+	assert.NoError(t, broker.Publish(ctx, "user/1", json.RawMessage(`{}`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/42/status", json.RawMessage(`{"status":"paid"}`)))
+	assert.Equal(t, pubsub.Message{Topic: "orders/42/status", Payload: json.RawMessage(`{"status":"paid"}`)}, pubsubtest.Receive(t, status))
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.acked == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, pubsub.ErrInvalidTopic, broker.Publish(ctx, "orders/#", json.RawMessage(`{}`)))
+
+	// the subscription is deleted once done
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	client.mu.Lock()
+	assert.Empty(t, client.subscriptions)
+	client.mu.Unlock()
+	mu.Lock()
+	assert.Equal(t, []string{"unavailable"}, errs)
+	mu.Unlock()
+}
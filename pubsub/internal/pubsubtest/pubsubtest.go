@@ -0,0 +1,22 @@
+// Package pubsubtest provides the helpers shared by the tests of the pubsub drivers.
+package pubsubtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+// Receive returns the next message of a subscription, failing the test when none is received
+// within a second.
+func Receive(t *testing.T, messages <-chan pubsub.Message) pubsub.Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return pubsub.Message{}
+	}
+}
@@ -0,0 +1,198 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// jsonSchema is the subset of JSON Schema supported by JSONSchema.
+type jsonSchema struct {
+	Type                 jsonSchemaType         `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *json.Number           `json:"minimum"`
+	Maximum              *json.Number           `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+
+	// deny is true for the false schema, e.g. "additionalProperties": false
+	deny bool
+}
+
+// jsonSchemaType is the type keyword, a type or a list of types.
+type jsonSchemaType []string
+
+func (t *jsonSchemaType) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = jsonSchemaType{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+func (s *jsonSchema) UnmarshalJSON(b []byte) error {
+	var allow bool
+	if err := json.Unmarshal(b, &allow); err == nil {
+		s.deny = !allow
+		return nil
+	}
+	type plain jsonSchema
+	return json.Unmarshal(b, (*plain)(s))
+}
+
+// JSONSchema returns a ValidateFunc checking the payloads against a JSON Schema. The keywords type,
+// properties, required, additionalProperties, items, enum, minimum, maximum, minLength, maxLength,
+// minItems and maxItems are supported, the others are ignored.
+func JSONSchema(schema []byte) (ValidateFunc, error) {
+	var s jsonSchema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("pubsub: invalid JSON schema: %w", err)
+	}
+	return func(payload json.RawMessage) error {
+		v, err := decodeJSON(payload)
+		if err != nil {
+			return err
+		}
+		return s.validate(v, "$")
+	}, nil
+}
+
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	if s.deny {
+		return fmt.Errorf("%s: not allowed", path)
+	}
+	if len(s.Type) > 0 && !s.hasType(v) {
+		return fmt.Errorf("%s: expected %v", path, []string(s.Type))
+	}
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return fmt.Errorf("%s: not one of the values of the enum", path)
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+			if property == nil {
+				continue
+			}
+			if err := property.validate(v[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s: fewer than %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%s: more than %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d characters", path, *s.MaxLength)
+		}
+	case json.Number:
+		n, _ := new(big.Float).SetString(v.String())
+		if s.Minimum != nil {
+			if min, _ := new(big.Float).SetString(s.Minimum.String()); n.Cmp(min) < 0 {
+				return fmt.Errorf("%s: less than %s", path, *s.Minimum)
+			}
+		}
+		if s.Maximum != nil {
+			if max, _ := new(big.Float).SetString(s.Maximum.String()); n.Cmp(max) > 0 {
+				return fmt.Errorf("%s: greater than %s", path, *s.Maximum)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) hasType(v interface{}) bool {
+	for _, t := range s.Type {
+		switch v := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if n, ok := new(big.Float).SetString(v.String()); t == "integer" && ok && n.IsInt() {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *jsonSchema) inEnum(v interface{}) bool {
+	for _, value := range s.Enum {
+		if n, ok := v.(json.Number); ok {
+			if f, ok := value.(float64); ok {
+				if g, err := n.Float64(); err == nil && g == f {
+					return true
+				}
+			}
+			continue
+		}
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// Package mongostream publishes the documents changed in MongoDB to the topics of a pubsub.Broker
+// by tailing a change stream, resuming it after the last change published when the process
+// restarts.
+//
+// The Watcher opens the change streams, e.g. with go.mongodb.org/mongo-driver, and returns the
+// documents as relaxed extended JSON, which is published as is: the ObjectIDs reach the clients as
+// {"$oid": "..."} objects.
+package mongostream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+const defaultRetryInterval = time.Second
+
+// ChangeEvent is an event of a change stream.
+type ChangeEvent struct {
+	// ResumeToken is the _id of the event, resuming the stream after it.
+	ResumeToken json.RawMessage
+	// OperationType is the operation of the change, e.g. "insert", "update" or "delete".
+	OperationType string
+	Database      string
+	Collection    string
+	DocumentKey   json.RawMessage
+	// FullDocument is the document after the change, it is nil for the deletions.
+	FullDocument json.RawMessage
+}
+
+// Stream is an open change stream.
+type Stream interface {
+	// Next returns the next event, waiting for it until ctx is done.
+	Next(ctx context.Context) (ChangeEvent, error)
+	Close(ctx context.Context) error
+}
+
+// Watcher opens change streams, e.g. on a database or a deployment, with the full documents of the
+// updates looked up.
+type Watcher interface {
+	// Watch opens a change stream, resuming after the token when not nil.
+	Watch(ctx context.Context, resumeAfter json.RawMessage) (Stream, error)
+}
+
+// TokenStore persists the resume token of the last change published.
+type TokenStore interface {
+	// Load returns the token saved, or nil.
+	Load(ctx context.Context) (json.RawMessage, error)
+	Save(ctx context.Context, token json.RawMessage) error
+}
+
+// FileTokenStore is a TokenStore saving the token in a file.
+type FileTokenStore struct {
+	Path string
+}
+
+var _ TokenStore = FileTokenStore{}
+
+// Load implements TokenStore
+func (f FileTokenStore) Load(ctx context.Context) (json.RawMessage, error) {
+	token, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return token, err
+}
+
+// Save implements TokenStore, replacing the file so that it is never left half written.
+func (f FileTokenStore) Save(ctx context.Context, token json.RawMessage) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(token); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+// Mapping publishes the changed documents of a collection to a topic.
+type Mapping struct {
+	// Collection is the collection of the documents, qualified by its database, e.g. "shop.orders",
+	// or not.
+	Collection string
+	// Topic is the topic of the documents, its "{field}" placeholders are replaced with the fields
+	// of the document, or of its key for the deletions, e.g. "orders/{_id}".
+	Topic string
+	// Operations are the operations published, all of them when empty.
+	Operations []string
+	// Match returns true if a document is published, all of them are when nil.
+	Match func(event ChangeEvent) bool
+}
+
+func (m Mapping) matches(event ChangeEvent) bool {
+	if m.Collection != event.Collection && m.Collection != event.Database+"."+event.Collection {
+		return false
+	}
+	if len(m.Operations) > 0 && !slices.Contains(m.Operations, event.OperationType) {
+		return false
+	}
+	return m.Match == nil || m.Match(event)
+}
+
+// topic returns the topic of an event, with the placeholders replaced.
+func (m Mapping) topic(event ChangeEvent) (string, error) {
+	document := event.FullDocument
+	if document == nil {
+		document = event.DocumentKey
+	}
+	fields := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return "", err
+	}
+	for name, value := range fields {
+		// the ObjectIds and the 64-bit integers of the extended JSON are wrapped
+		if wrapped, ok := value.(map[string]any); ok && len(wrapped) == 1 {
+			for _, key := range []string{"$oid", "$numberLong", "$numberDecimal"} {
+				if v, ok := wrapped[key]; ok {
+					fields[name] = v
+				}
+			}
+		}
+	}
+	return pubsub.ExpandTopic(m.Topic, fields)
+}
+
+// Change is the payload of the changes published.
+type Change struct {
+	Operation   string          `json:"operation"`
+	Collection  string          `json:"collection"`
+	DocumentKey json.RawMessage `json:"documentKey"`
+	Document    json.RawMessage `json:"document,omitempty"`
+}
+
+// Source publishes the documents of a change stream to the topics of their mappings, and saves the
+// resume token of the changes once published so that a restart resumes after them.
+type Source struct {
+	Watcher  Watcher
+	Broker   pubsub.Broker
+	Mappings []Mapping
+	// Tokens persists the resume token, the stream starts from the current changes when nil.
+	Tokens TokenStore
+	// SaveInterval saves the resume token at most once per interval rather than after every
+	// change, it is saved as well when Run returns. A restart publishes again the changes of the
+	// last interval.
+	SaveInterval time.Duration
+	// RetryInterval is the delay before watching again after a failure, it defaults to 1 second.
+	RetryInterval time.Duration
+	// ErrorFunc is called with the failures of the stream, of the broker and of the token store,
+	// and with the documents which can't be mapped, they are skipped.
+	ErrorFunc func(ctx context.Context, err error)
+
+	token json.RawMessage
+	saved time.Time
+}
+
+// Run publishes the changes until ctx is done.
+func (s *Source) Run(ctx context.Context) error {
+	if s.Tokens != nil {
+		token, err := s.Tokens.Load(ctx)
+		if err != nil {
+			return err
+		}
+		s.token = token
+		defer s.save(context.WithoutCancel(ctx), true)
+	}
+
+	for {
+		err := s.watch(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.report(ctx, err)
+
+		if err := s.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// watch publishes the changes of a stream until it fails.
+func (s *Source) watch(ctx context.Context) error {
+	stream, err := s.Watcher.Watch(ctx, s.token)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	for {
+		event, err := stream.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.publish(ctx, event); err != nil {
+			return err
+		}
+		s.token = event.ResumeToken
+		s.save(ctx, false)
+	}
+}
+
+// publish publishes an event to the topics of its mappings, retrying the failures of the broker.
+func (s *Source) publish(ctx context.Context, event ChangeEvent) error {
+	for _, mapping := range s.Mappings {
+		if !mapping.matches(event) {
+			continue
+		}
+		topic, err := mapping.topic(event)
+		if err != nil {
+			s.report(ctx, err)
+			continue
+		}
+		payload, err := json.Marshal(Change{
+			Operation:   event.OperationType,
+			Collection:  event.Collection,
+			DocumentKey: event.DocumentKey,
+			Document:    event.FullDocument,
+		})
+		if err != nil {
+			s.report(ctx, err)
+			continue
+		}
+		for {
+			err := s.Broker.Publish(ctx, topic, payload)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.report(ctx, err)
+			if err := s.wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// save saves the resume token when the SaveInterval elapsed, or when forced.
+func (s *Source) save(ctx context.Context, force bool) {
+	if s.Tokens == nil {
+		return
+	}
+	if s.token == nil || (!force && time.Since(s.saved) < s.SaveInterval) {
+		return
+	}
+	s.saved = time.Now()
+	s.report(ctx, s.Tokens.Save(ctx, s.token))
+}
+
+func (s *Source) wait(ctx context.Context) error {
+	retryInterval := s.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultRetryInterval
+	}
+	timer := time.NewTimer(retryInterval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Source) report(ctx context.Context, err error) {
+	if err != nil && s.ErrorFunc != nil {
+		s.ErrorFunc(ctx, err)
+	}
+}
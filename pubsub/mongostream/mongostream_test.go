@@ -0,0 +1,143 @@
+package mongostream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub/internal/pubsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testWatcher streams the events following the resume token, the first stream failing after its
+// first event.
+type testWatcher struct {
+	mu      sync.Mutex
+	events  []ChangeEvent
+	resumed []string
+}
+
+func (w *testWatcher) Watch(ctx context.Context, resumeAfter json.RawMessage) (Stream, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.resumed = append(w.resumed, string(resumeAfter))
+	next := 0
+	for i, event := range w.events {
+		if string(event.ResumeToken) == string(resumeAfter) {
+			next = i + 1
+		}
+	}
+	stream := &testStream{events: w.events[next:]}
+	if len(w.resumed) == 1 {
+		stream.failAfter = 1
+	}
+	return stream, nil
+}
+
+type testStream struct {
+	events    []ChangeEvent
+	failAfter int
+	n         int
+}
+
+func (s *testStream) Next(ctx context.Context) (ChangeEvent, error) {
+	if s.failAfter != 0 && s.n == s.failAfter {
+		return ChangeEvent{}, errors.New("connection reset")
+	}
+	if s.n == len(s.events) {
+		<-ctx.Done()
+		return ChangeEvent{}, ctx.Err()
+	}
+	s.n++
+	return s.events[s.n-1], nil
+}
+
+func (s *testStream) Close(ctx context.Context) error { return nil }
+
+func TestSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := pubsub.NewMemory()
+	orders, err := broker.Subscribe(ctx, "orders/#")
+	assert.NoError(t, err)
+
+	watcher := &testWatcher{events: []ChangeEvent{
+		{
+			ResumeToken:   json.RawMessage(`{"_data":"1"}`),
+			OperationType: "insert",
+			Database:      "shop",
+			Collection:    "orders",
+			DocumentKey:   json.RawMessage(`{"_id":{"$oid":"652f1b0c9d1e8a3f4c2b1a00"}}`),
+			FullDocument:  json.RawMessage(`{"_id":{"$oid":"652f1b0c9d1e8a3f4c2b1a00"},"status":"new"}`),
+		},
+		{
+			ResumeToken:   json.RawMessage(`{"_data":"2"}`),
+			OperationType: "insert",
+			Database:      "shop",
+			Collection:    "users",
+			DocumentKey:   json.RawMessage(`{"_id":1}`),
+			FullDocument:  json.RawMessage(`{"_id":1}`),
+		},
+		{
+			ResumeToken:   json.RawMessage(`{"_data":"3"}`),
+			OperationType: "delete",
+			Database:      "shop",
+			Collection:    "orders",
+			DocumentKey:   json.RawMessage(`{"_id":{"$numberLong":"42"}}`),
+		},
+	}}
+	tokens := FileTokenStore{Path: filepath.Join(t.TempDir(), "token")}
+	var mu sync.Mutex
+	var errs []string
+	source := &Source{
+		Watcher:       watcher,
+		Broker:        broker,
+		Mappings:      []Mapping{{Collection: "shop.orders", Topic: "orders/{_id}"}},
+		Tokens:        tokens,
+		RetryInterval: 10 * time.Millisecond,
+		ErrorFunc: func(ctx context.Context, err error) {
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		},
+	}
+	done := make(chan error)
+	go func() { done <- source.Run(ctx) }()
+
+	msg := pubsubtest.Receive(t, orders)
+	assert.Equal(t, "orders/652f1b0c9d1e8a3f4c2b1a00", msg.Topic)
+	assert.JSONEq(t, `{"operation":"insert","collection":"orders","documentKey":{"_id":{"$oid":"652f1b0c9d1e8a3f4c2b1a00"}},"document":{"_id":{"$oid":"652f1b0c9d1e8a3f4c2b1a00"},"status":"new"}}`, string(msg.Payload))
+	// resumed after the failure of the stream
+	msg = pubsubtest.Receive(t, orders)
+	assert.Equal(t, "orders/42", msg.Topic)
+	assert.JSONEq(t, `{"operation":"delete","collection":"orders","documentKey":{"_id":{"$numberLong":"42"}}}`, string(msg.Payload))
+
+	assert.Eventually(t, func() bool {
+		token, _ := tokens.Load(ctx)
+		return string(token) == `{"_data":"3"}`
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	watcher.mu.Lock()
+	assert.Equal(t, []string{"", `{"_data":"1"}`}, watcher.resumed)
+	watcher.mu.Unlock()
+	mu.Lock()
+	assert.Equal(t, []string{"connection reset"}, errs)
+	mu.Unlock()
+
+	// a restart resumes after the saved token
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { done <- source.Run(ctx) }()
+	assert.Eventually(t, func() bool {
+		watcher.mu.Lock()
+		defer watcher.mu.Unlock()
+		return len(watcher.resumed) == 3
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, `{"_data":"3"}`, watcher.resumed[2])
+}
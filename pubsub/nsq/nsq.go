@@ -0,0 +1,159 @@
+// Package nsq is a pubsub driver for NSQ. The messages of every topic are published to a single
+// NSQ topic, and every process consumes them from an ephemeral channel of its own, deleted by nsqd
+// once the process disconnects.
+//
+// The messages are wrapped in a JSON envelope holding their topic, NSQ messages having no
+// attributes. The Client publishes and consumes them, e.g. with a producer and a consumer of
+// github.com/nsqio/go-nsq.
+package nsq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+const (
+	defaultTopic         = "graphqlws"
+	defaultMaxInFlight   = 200
+	defaultRetryInterval = time.Second
+	ephemeral            = "#ephemeral"
+)
+
+// Client is the subset of the NSQ producer and consumer used by the Broker.
+type Client interface {
+	Publish(ctx context.Context, topic string, body []byte) error
+	// Consume calls handler with the messages of a channel of a topic until ctx is done or it
+	// fails, with at most maxInFlight messages in flight. The messages are finished when handler
+	// returns nil and requeued otherwise.
+	Consume(ctx context.Context, topic string, channel string, maxInFlight int, handler func(body []byte) error) error
+}
+
+// envelope is the body of the NSQ messages.
+type envelope struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Broker is a pubsub.Broker publishing and consuming through an NSQ topic. Run consumes the
+// messages and connects again after the failures.
+//
+// The messages are finished once they are delivered to the local subscriptions, even when they
+// can't be decoded: requeuing them would duplicate them for the subscriptions which received them.
+type Broker struct {
+	Client Client
+	// Topic is the NSQ topic of the messages, it defaults to "graphqlws".
+	Topic string
+	// Channel is the channel of the process, it defaults to "graphqlws-" followed by a random
+	// suffix. The "#ephemeral" suffix is added when missing.
+	Channel string
+	// MaxInFlight is the number of messages in flight, it defaults to 200.
+	MaxInFlight int
+	// RetryInterval is the delay before consuming again after a failure, it defaults to 1 second.
+	RetryInterval time.Duration
+	// ErrorFunc is called with the failures of the consumer and the messages which can't be
+	// decoded.
+	ErrorFunc func(ctx context.Context, err error)
+
+	once    sync.Once
+	channel string
+	fanout  pubsub.Fanout
+}
+
+var _ pubsub.Broker = &Broker{}
+
+func (b *Broker) init() {
+	b.once.Do(func() {
+		b.channel = b.Channel
+		if b.channel == "" {
+			suffix := make([]byte, 8)
+			_, _ = rand.Read(suffix)
+			b.channel = "graphqlws-" + hex.EncodeToString(suffix)
+		}
+		if !strings.HasSuffix(b.channel, ephemeral) {
+			b.channel += ephemeral
+		}
+	})
+}
+
+// ChannelName returns the ephemeral channel of the process.
+func (b *Broker) ChannelName() string {
+	b.init()
+	return b.channel
+}
+
+func (b *Broker) topic() string {
+	if b.Topic == "" {
+		return defaultTopic
+	}
+	return b.Topic
+}
+
+// Publish implements pubsub.Broker
+func (b *Broker) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	for _, level := range strings.Split(topic, "/") {
+		if level == "+" || level == "#" {
+			return pubsub.ErrInvalidTopic
+		}
+	}
+	body, err := json.Marshal(envelope{Topic: topic, Payload: payload})
+	if err != nil {
+		return err
+	}
+	return b.Client.Publish(ctx, b.topic(), body)
+}
+
+// Subscribe implements pubsub.Broker
+func (b *Broker) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	return b.fanout.Subscribe(ctx, topic)
+}
+
+// Run consumes the messages of the channel of the process until ctx is done.
+func (b *Broker) Run(ctx context.Context) error {
+	b.init()
+	maxInFlight := b.MaxInFlight
+	if maxInFlight == 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+	retryInterval := b.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultRetryInterval
+	}
+
+	handler := func(body []byte) error {
+		var msg envelope
+		if err := json.Unmarshal(body, &msg); err != nil {
+			b.report(ctx, err)
+			return nil
+		}
+		b.report(ctx, b.fanout.Deliver(ctx, pubsub.Message{Topic: msg.Topic, Payload: msg.Payload}))
+		return nil
+	}
+	for {
+		err := b.Client.Consume(ctx, b.topic(), b.channel, maxInFlight, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.report(ctx, err)
+
+		timer := time.NewTimer(retryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *Broker) report(ctx context.Context, err error) {
+	if err != nil && b.ErrorFunc != nil {
+		b.ErrorFunc(ctx, err)
+	}
+}
@@ -0,0 +1,98 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub/internal/pubsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient is an nsqd delivering the messages of a topic to every channel.
+type testClient struct {
+	mu       sync.Mutex
+	channels map[string]chan []byte
+	consumed []string
+	fail     bool
+}
+
+func (c *testClient) Publish(ctx context.Context, topic string, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, ch := range c.channels {
+		if strings.HasPrefix(name, topic+"/") {
+			ch <- body
+		}
+	}
+	return nil
+}
+
+func (c *testClient) Consume(ctx context.Context, topic string, channel string, maxInFlight int, handler func(body []byte) error) error {
+	c.mu.Lock()
+	c.consumed = append(c.consumed, topic+"/"+channel)
+	if c.fail {
+		c.fail = false
+		c.mu.Unlock()
+		return errors.New("no nsqd available")
+	}
+	messages := make(chan []byte, maxInFlight)
+	c.channels[topic+"/"+channel] = messages
+	c.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case body := <-messages:
+			_ = handler(body)
+		}
+	}
+}
+
+func TestBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &testClient{channels: map[string]chan []byte{}, fail: true}
+	var mu sync.Mutex
+	var errs []string
+	broker := &Broker{
+		Client:        client,
+		Channel:       "api-1",
+		RetryInterval: 10 * time.Millisecond,
+		ErrorFunc: func(ctx context.Context, err error) {
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		},
+	}
+	assert.Equal(t, "api-1#ephemeral", broker.ChannelName())
+
+	status, err := broker.Subscribe(ctx, "orders/+/status")
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- broker.Run(ctx) }()
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.channels) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, broker.Publish(ctx, "user/1", json.RawMessage(`{}`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/42/status", json.RawMessage(`{"status":"paid"}`)))
+	assert.Equal(t, pubsub.Message{Topic: "orders/42/status", Payload: json.RawMessage(`{"status":"paid"}`)}, pubsubtest.Receive(t, status))
+	assert.Equal(t, pubsub.ErrInvalidTopic, broker.Publish(ctx, "orders/#", json.RawMessage(`{}`)))
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	client.mu.Lock()
+	assert.Equal(t, []string{"graphqlws/api-1#ephemeral", "graphqlws/api-1#ephemeral"}, client.consumed)
+	client.mu.Unlock()
+	mu.Lock()
+	assert.Equal(t, []string{"no nsqd available"}, errs)
+	mu.Unlock()
+}
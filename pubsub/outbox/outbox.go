@@ -0,0 +1,205 @@
+// Package outbox publishes the events written to an outbox table by the transactions of the
+// application, so that the events are published if and only if the transactions commit. A Poller
+// reads the events in order, publishes them and marks them processed.
+//
+// The table of the SQLStore has the columns:
+//
+//	id           BIGINT PRIMARY KEY, increasing with the order of the events
+//	topic        TEXT NOT NULL
+//	payload      JSON NOT NULL
+//	processed_at TIMESTAMP NULL
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+const (
+	defaultTable     = "outbox"
+	defaultBatchSize = 100
+	defaultInterval  = time.Second
+)
+
+// Event is a row of the outbox table.
+type Event struct {
+	ID      int64
+	Topic   string
+	Payload json.RawMessage
+}
+
+// Store reads the events of an outbox.
+type Store interface {
+	// Process calls publish with up to limit unprocessed events in order, until it fails, and marks
+	// the events published processed. It returns the number of events processed. The events are
+	// locked meanwhile, so that the events are processed once across the replicas.
+	Process(ctx context.Context, limit int, publish func(Event) error) (int, error)
+}
+
+// Dialect is the SQL dialect of a database.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	MySQL
+)
+
+// placeholder returns the placeholder of the nth parameter of a query.
+func (d Dialect) placeholder(n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// SQLStore is a Store of a Postgres or MySQL table.
+type SQLStore struct {
+	DB      *sql.DB
+	Dialect Dialect
+	// Table is the outbox table, it defaults to "outbox".
+	Table string
+}
+
+var _ Store = &SQLStore{}
+
+func (s *SQLStore) table() string {
+	if s.Table == "" {
+		return defaultTable
+	}
+	return s.Table
+}
+
+// Process implements Store, the events are locked with SELECT ... FOR UPDATE until the transaction
+// marking them commits, the other replicas waiting for them.
+func (s *SQLStore) Process(ctx context.Context, limit int, publish func(Event) error) (n int, err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := "SELECT id, topic, payload FROM " + s.table() +
+		" WHERE processed_at IS NULL ORDER BY id LIMIT " + s.Dialect.placeholder(1) + " FOR UPDATE"
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Topic, &payload); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var published []any
+	var publishErr error
+	for _, event := range events {
+		if publishErr = publish(event); publishErr != nil {
+			break
+		}
+		published = append(published, event.ID)
+	}
+	if len(published) > 0 {
+		placeholders := make([]string, len(published))
+		for i := range published {
+			placeholders[i] = s.Dialect.placeholder(i + 1)
+		}
+		update := "UPDATE " + s.table() + " SET processed_at = CURRENT_TIMESTAMP WHERE id IN (" +
+			strings.Join(placeholders, ", ") + ")"
+		if _, err := tx.ExecContext(ctx, update, published...); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(published), publishErr
+}
+
+// Poller publishes the events of an outbox to a broker.
+type Poller struct {
+	Store  Store
+	Broker pubsub.Broker
+	// BatchSize is the number of events processed per transaction, it defaults to 100.
+	BatchSize int
+	// Interval is the delay between the polls finding the outbox empty, or failing, it defaults to
+	// 1 second. See Notify.
+	Interval time.Duration
+	// ErrorFunc is called with the failures of the store and of the broker.
+	ErrorFunc func(ctx context.Context, err error)
+
+	once   sync.Once
+	notify chan struct{}
+}
+
+func (p *Poller) init() {
+	p.once.Do(func() { p.notify = make(chan struct{}, 1) })
+}
+
+// Notify polls the outbox without waiting for the Interval, e.g. once a transaction writing to the
+// outbox commits or on a LISTEN notification of Postgres.
+func (p *Poller) Notify() {
+	p.init()
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the events until ctx is done.
+func (p *Poller) Run(ctx context.Context) error {
+	p.init()
+	batchSize := p.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+	interval := p.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+
+	for {
+		n, err := p.Store.Process(ctx, batchSize, func(event Event) error {
+			return p.Broker.Publish(ctx, event.Topic, event.Payload)
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && p.ErrorFunc != nil {
+			p.ErrorFunc(ctx, err)
+		}
+		if err == nil && n == batchSize {
+			// more events are waiting
+			continue
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-p.notify:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub/internal/pubsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDriver is a database/sql driver recording the statements and answering the queries with
+// its rows.
+type testDriver struct {
+	mu         sync.Mutex
+	rows       [][]driver.Value
+	statements []string
+	args       [][]driver.Value
+}
+
+func (d *testDriver) Open(name string) (driver.Conn, error)            { return &testConn{d}, nil }
+func (d *testDriver) Connect(ctx context.Context) (driver.Conn, error) { return &testConn{d}, nil }
+func (d *testDriver) Driver() driver.Driver                            { return d }
+
+type testConn struct{ driver *testDriver }
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) { return &testStmt{c.driver, query}, nil }
+func (c *testConn) Close() error                              { return nil }
+func (c *testConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *testConn) Commit() error                             { return c.driver.record("COMMIT", nil) }
+func (c *testConn) Rollback() error                           { return c.driver.record("ROLLBACK", nil) }
+
+func (d *testDriver) record(statement string, args []driver.Value) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, statement)
+	d.args = append(d.args, args)
+	return nil
+}
+
+type testStmt struct {
+	driver *testDriver
+	query  string
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(len(args)), s.driver.record(s.query, args)
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_ = s.driver.record(s.query, args)
+	return &testRows{rows: s.driver.rows}, nil
+}
+
+type testRows struct{ rows [][]driver.Value }
+
+func (r *testRows) Columns() []string { return []string{"id", "topic", "payload"} }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLStore(t *testing.T) {
+	d := &testDriver{rows: [][]driver.Value{
+		{int64(1), "orders/1", []byte(`{"status":"paid"}`)},
+		{int64(2), "orders/2", []byte(`{}`)},
+		{int64(3), "orders/3", []byte(`{}`)},
+	}}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	store := &SQLStore{DB: db, Dialect: Postgres}
+	var published []Event
+	errUnavailable := errors.New("unavailable")
+	n, err := store.Process(context.Background(), 10, func(event Event) error {
+		if event.ID == 3 {
+			return errUnavailable
+		}
+		published = append(published, event)
+		return nil
+	})
+	assert.Equal(t, 2, n)
+	assert.Equal(t, errUnavailable, err)
+	assert.Equal(t, []Event{
+		{ID: 1, Topic: "orders/1", Payload: json.RawMessage(`{"status":"paid"}`)},
+		{ID: 2, Topic: "orders/2", Payload: json.RawMessage(`{}`)},
+	}, published)
+
+	// the events published before the failure are marked processed
+	assert.Equal(t, []string{
+		"SELECT id, topic, payload FROM outbox WHERE processed_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE",
+		"UPDATE outbox SET processed_at = CURRENT_TIMESTAMP WHERE id IN ($1, $2)",
+		"COMMIT",
+	}, d.statements)
+	assert.Equal(t, []driver.Value{int64(1), int64(2)}, d.args[1])
+
+	d.statements, d.rows = nil, [][]driver.Value{{int64(4), "orders/4", []byte(`{}`)}}
+	store = &SQLStore{DB: db, Dialect: MySQL, Table: "events_outbox"}
+	n, err = store.Process(context.Background(), 10, func(event Event) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "UPDATE events_outbox SET processed_at = CURRENT_TIMESTAMP WHERE id IN (?)", d.statements[1])
+}
+
+// testStore is an outbox in memory.
+type testStore struct {
+	mu     sync.Mutex
+	events []Event
+	polls  int
+}
+
+func (s *testStore) add(event Event) {
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+}
+
+func (s *testStore) Process(ctx context.Context, limit int, publish func(Event) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polls++
+	n := 0
+	for n < limit && n < len(s.events) {
+		if err := publish(s.events[n]); err != nil {
+			break
+		}
+		n++
+	}
+	s.events = s.events[n:]
+	return n, nil
+}
+
+func TestPoller(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := pubsub.NewMemory()
+	orders, err := broker.Subscribe(ctx, "orders/+")
+	assert.NoError(t, err)
+
+	store := &testStore{}
+	for i := 1; i <= 3; i++ {
+		store.add(Event{ID: int64(i), Topic: "orders/" + strconv.Itoa(i), Payload: json.RawMessage(`{}`)})
+	}
+	poller := &Poller{Store: store, Broker: broker, BatchSize: 2, Interval: time.Hour}
+	done := make(chan error)
+	go func() { done <- poller.Run(ctx) }()
+
+	// the full batch is followed by the next one without waiting
+	for _, topic := range []string{"orders/1", "orders/2", "orders/3"} {
+		assert.Equal(t, topic, pubsubtest.Receive(t, orders).Topic)
+	}
+	store.add(Event{ID: 4, Topic: "orders/4", Payload: json.RawMessage(`{}`)})
+	poller.Notify()
+	assert.Equal(t, "orders/4", pubsubtest.Receive(t, orders).Topic)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.Equal(t, 3, store.polls)
+}
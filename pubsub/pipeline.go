@@ -0,0 +1,204 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrDrop is returned by a Stage to drop a message, it isn't published.
+var ErrDrop = errors.New("pubsub: message dropped")
+
+// Stage transforms a message of a Pipeline.
+type Stage func(ctx context.Context, msg Message) (Message, error)
+
+// Map returns a Stage replacing the payloads with the result of fn.
+func Map(fn func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error)) Stage {
+	return func(ctx context.Context, msg Message) (Message, error) {
+		payload, err := fn(ctx, msg.Payload)
+		if err != nil {
+			return msg, err
+		}
+		msg.Payload = payload
+		return msg, nil
+	}
+}
+
+// Filter returns a Stage dropping the messages for which keep returns false.
+func Filter(keep func(ctx context.Context, msg Message) bool) Stage {
+	return func(ctx context.Context, msg Message) (Message, error) {
+		if !keep(ctx, msg) {
+			return msg, ErrDrop
+		}
+		return msg, nil
+	}
+}
+
+// Enrich returns a Stage setting a field of the object payloads to the result of fn, e.g. the
+// display name of the user whose id is a field of the payload.
+func Enrich(field string, fn func(ctx context.Context, object map[string]interface{}) (interface{}, error)) Stage {
+	return objectStage(func(ctx context.Context, object map[string]interface{}) error {
+		value, err := fn(ctx, object)
+		if err != nil {
+			return err
+		}
+		object[field] = value
+		return nil
+	})
+}
+
+// Format returns a Stage replacing the value of a field of the object payloads with the result of
+// fn, e.g. an amount converted to the currency of the clients. The payloads without the field are
+// left unchanged.
+func Format(field string, fn func(ctx context.Context, value interface{}) (interface{}, error)) Stage {
+	return objectStage(func(ctx context.Context, object map[string]interface{}) error {
+		value, ok := object[field]
+		if !ok {
+			return nil
+		}
+		formatted, err := fn(ctx, value)
+		if err != nil {
+			return err
+		}
+		object[field] = formatted
+		return nil
+	})
+}
+
+// Redact returns a Stage removing fields of the payloads. The paths are the names of the fields
+// separated by dots, "*" matching every field of an object or item of a list, e.g. "user.email" or
+// "items.*.cost".
+func Redact(paths ...string) Stage {
+	split := make([][]string, len(paths))
+	for i, path := range paths {
+		split[i] = strings.Split(path, ".")
+	}
+	return func(ctx context.Context, msg Message) (Message, error) {
+		v, err := decodeJSON(msg.Payload)
+		if err != nil {
+			return msg, err
+		}
+		for _, path := range split {
+			redact(v, path)
+		}
+		if msg.Payload, err = json.Marshal(v); err != nil {
+			return msg, err
+		}
+		return msg, nil
+	}
+}
+
+func redact(v interface{}, path []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			if path[0] == "*" {
+				clear(v)
+			}
+			delete(v, path[0])
+			return
+		}
+		if path[0] == "*" {
+			for _, child := range v {
+				redact(child, path[1:])
+			}
+			return
+		}
+		if child, ok := v[path[0]]; ok {
+			redact(child, path[1:])
+		}
+	case []interface{}:
+		if path[0] != "*" {
+			return
+		}
+		for _, item := range v {
+			if len(path) > 1 {
+				redact(item, path[1:])
+			}
+		}
+	}
+}
+
+// objectStage returns a Stage changing the object payloads with fn, the other payloads are left
+// unchanged.
+func objectStage(fn func(ctx context.Context, object map[string]interface{}) error) Stage {
+	return func(ctx context.Context, msg Message) (Message, error) {
+		v, err := decodeJSON(msg.Payload)
+		if err != nil {
+			return msg, err
+		}
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return msg, nil
+		}
+		if err := fn(ctx, object); err != nil {
+			return msg, err
+		}
+		if msg.Payload, err = json.Marshal(object); err != nil {
+			return msg, err
+		}
+		return msg, nil
+	}
+}
+
+type pipelineRule struct {
+	pattern string
+	stages  []Stage
+}
+
+// Pipeline transforms the messages published to the topics with the stages of their patterns, e.g.
+// to enrich or redact them once rather than in the resolver of every subscription. The stages of
+// every pattern matching a topic are applied in the order of their registration.
+type Pipeline struct {
+	mu    sync.RWMutex
+	rules []pipelineRule
+}
+
+// Use appends stages transforming the messages published to the topics matching pattern.
+func (p *Pipeline) Use(pattern string, stages ...Stage) {
+	p.mu.Lock()
+	p.rules = append(p.rules, pipelineRule{pattern: pattern, stages: stages})
+	p.mu.Unlock()
+}
+
+// Apply returns a message transformed by the stages of its topic, or ErrDrop if a stage drops it.
+func (p *Pipeline) Apply(ctx context.Context, msg Message) (Message, error) {
+	p.mu.RLock()
+	rules := p.rules
+	p.mu.RUnlock()
+	for _, rule := range rules {
+		if !Match(rule.pattern, msg.Topic) {
+			continue
+		}
+		for _, stage := range rule.stages {
+			var err error
+			if msg, err = stage(ctx, msg); err != nil {
+				return msg, err
+			}
+		}
+	}
+	return msg, nil
+}
+
+// Transformed is a Broker transforming the messages with a Pipeline before publishing them, the
+// messages dropped by the pipeline aren't published.
+type Transformed struct {
+	Broker
+	Pipeline *Pipeline
+}
+
+var _ Broker = Transformed{}
+
+// Publish implements Broker
+func (t Transformed) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	msg, err := t.Pipeline.Apply(ctx, Message{Topic: topic, Payload: payload})
+	if errors.Is(err, ErrDrop) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return t.Broker.Publish(ctx, msg.Topic, msg.Payload)
+}
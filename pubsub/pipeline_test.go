@@ -0,0 +1,52 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	msg, err := Redact("user.email", "items.*.cost", "secret")(context.Background(), Message{
+		Payload: json.RawMessage(`{"user":{"id":1,"email":"a@b.c"},"items":[{"sku":"a","cost":1},{"sku":"b"}],"secret":true}`),
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"user":{"id":1},"items":[{"sku":"a"},{"sku":"b"}]}`, string(msg.Payload))
+}
+
+func TestTransformed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	names := map[string]string{"1": "Ann"}
+	pipeline := &Pipeline{}
+	pipeline.Use("orders/#",
+		Filter(func(ctx context.Context, msg Message) bool { return msg.Topic != "orders/internal" }),
+		Enrich("authorName", func(ctx context.Context, object map[string]interface{}) (interface{}, error) {
+			id, _ := object["authorId"].(json.Number)
+			return names[id.String()], nil
+		}),
+		Format("total", func(ctx context.Context, value interface{}) (interface{}, error) {
+			cents, err := value.(json.Number).Int64()
+			return float64(cents) / 100, err
+		}),
+	)
+	pipeline.Use("orders/+/status", Redact("authorId"))
+	errLookup := errors.New("lookup failed")
+	pipeline.Use("users/#", Map(func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return nil, errLookup
+	}))
+	broker := Transformed{Broker: NewMemory(), Pipeline: pipeline}
+
+	messages, err := broker.Subscribe(ctx, "orders/#")
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "orders/internal", json.RawMessage(`{}`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/1/status", json.RawMessage(`{"authorId":1,"total":1250}`)))
+	msg := receive(t, messages)
+	assert.Equal(t, "orders/1/status", msg.Topic)
+	assert.JSONEq(t, `{"authorName":"Ann","total":12.5}`, string(msg.Payload))
+
+	assert.Equal(t, errLookup, broker.Publish(ctx, "users/1", json.RawMessage(`{}`)))
+}
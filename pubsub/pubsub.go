@@ -0,0 +1,220 @@
+// Package pubsub delivers the events published to topics to the subscriptions of the transport,
+// e.g. a resolver subscribing to "orders/42/status" while a mutation publishes to it.
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTopic is returned when publishing to a topic with wildcards, or subscribing to a
+// pattern with a "#" wildcard before its last level.
+var ErrInvalidTopic = errors.New("pubsub: invalid topic")
+
+// Message is an event published to a topic.
+type Message struct {
+	Topic   string
+	Payload json.RawMessage
+	// Seq is the sequence number of the message, it is set by the brokers keeping a replay buffer.
+	Seq uint64
+	// Ephemeral is set on the signals, see Signaler.
+	Ephemeral bool
+}
+
+// Broker delivers the messages published to a topic to its subscribers.
+type Broker interface {
+	// Publish sends a payload to the subscribers of a topic.
+	Publish(ctx context.Context, topic string, payload json.RawMessage) error
+	// Subscribe returns the messages published to a topic after the call, until ctx is done. The
+	// topic may be a pattern with wildcards when the broker supports them, see Match.
+	Subscribe(ctx context.Context, topic string) (<-chan Message, error)
+}
+
+// validTopic returns true if the topic has no wildcard.
+func validTopic(topic string) bool {
+	for _, level := range strings.Split(topic, "/") {
+		if level == "+" || level == "#" {
+			return false
+		}
+	}
+	return true
+}
+
+// validPattern returns true if the pattern has no "#" wildcard before its last level.
+func validPattern(pattern string) bool {
+	levels := strings.Split(pattern, "/")
+	for i, level := range levels {
+		if level == "#" && i != len(levels)-1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Memory is a Broker for a single process, useful for tests and single node deployments. Its
+// subscriptions may use the wildcards of Match, e.g. "orders/+/status" or "user/#".
+type Memory struct {
+	// Retain keeps the last message of every topic and sends it to the new subscriptions matching
+	// the topic, so that they start from the current state, see Retained. It must be set before
+	// the broker is used.
+	Retain bool
+	// Replay keeps the recent messages of every topic for SubscribeFrom, it is disabled when nil.
+	// It must be set before the broker is used.
+	Replay *Replay
+	// SignalTTL is how long the signals wait for a lagging subscriber before expiring, it defaults
+	// to 5 seconds, see Signaler.
+	SignalTTL time.Duration
+
+	// publishMu serializes the publications so that the subscribers receive them in order, the
+	// sends happen without holding mu since the subscriptions need it to stop.
+	publishMu   sync.Mutex
+	mu          sync.Mutex
+	subscribers topicTrie
+	done        map[chan Message]<-chan struct{}
+	retained    map[string]Message
+	replays     map[string]*replayBuffer
+	signals     map[chan Message]*signalSlot
+	filters     map[chan Message]Predicate
+	seq         uint64
+}
+
+var _ Broker = &Memory{}
+
+// NewMemory returns a Memory broker without subscribers.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Publish implements Broker, it waits for the subscribers lagging behind until ctx is done.
+func (m *Memory) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	if !validTopic(topic) {
+		return ErrInvalidTopic
+	}
+
+	m.publishMu.Lock()
+	defer m.publishMu.Unlock()
+
+	m.mu.Lock()
+	msg := Message{Topic: topic, Payload: payload}
+	if m.Replay != nil && payload != nil {
+		m.replay(&msg)
+	}
+	if m.Retain && !m.retain(msg) {
+		m.mu.Unlock()
+		return nil
+	}
+	var subs []chan Message
+	m.subscribers.match(topic, func(sub chan Message) {
+		if m.accepts(sub, msg) {
+			subs = append(subs, sub)
+		}
+	})
+	done := make([]<-chan struct{}, len(subs))
+	for i, sub := range subs {
+		done[i] = m.done[sub]
+	}
+	m.mu.Unlock()
+
+	for i, sub := range subs {
+		select {
+		case sub <- msg:
+		case <-done[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe implements Broker
+func (m *Memory) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	if !validPattern(topic) {
+		return nil, ErrInvalidTopic
+	}
+
+	in := make(chan Message, 16)
+	m.mu.Lock()
+	m.addSubscriber(ctx, topic, in)
+	retained := m.matchRetained(topic)
+	m.mu.Unlock()
+
+	return m.forward(ctx, topic, in, retained), nil
+}
+
+// addSubscriber adds a subscription to a topic with the filter of ctx, m.mu must be held.
+func (m *Memory) addSubscriber(ctx context.Context, topic string, sub chan Message) {
+	m.subscribers.add(topic, sub)
+	if m.done == nil {
+		m.done = map[chan Message]<-chan struct{}{}
+	}
+	m.done[sub] = ctx.Done()
+	if pred := filterFrom(ctx); pred != nil {
+		if m.filters == nil {
+			m.filters = map[chan Message]Predicate{}
+		}
+		m.filters[sub] = pred
+	}
+}
+
+// accepts returns true if a subscription receives a message, m.mu must be held.
+func (m *Memory) accepts(sub chan Message, msg Message) bool {
+	pred, ok := m.filters[sub]
+	return !ok || pred(msg)
+}
+
+// forward sends the backlog of a subscription then the messages it receives, until ctx is done.
+func (m *Memory) forward(ctx context.Context, topic string, in chan Message, backlog []Message) <-chan Message {
+	pred := filterFrom(ctx)
+	m.mu.Lock()
+	slot := m.addSignalSlot(in)
+	m.mu.Unlock()
+
+	out := make(chan Message)
+	go func() {
+		defer close(out)
+		defer func() {
+			m.mu.Lock()
+			m.subscribers.remove(topic, in)
+			delete(m.signals, in)
+			delete(m.filters, in)
+			delete(m.done, in)
+			m.mu.Unlock()
+		}()
+
+		for _, msg := range backlog {
+			if pred != nil && !pred(msg) {
+				continue
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-in:
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			case <-slot.notify:
+				for _, msg := range m.takeSignals(slot) {
+					select {
+					case out <- msg:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return out
+}
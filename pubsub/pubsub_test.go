@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receive returns the next message of a subscription.
+func receive(t *testing.T, messages <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return Message{}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := NewMemory()
+
+	orders, err := broker.Subscribe(ctx, "orders")
+	assert.NoError(t, err)
+	users, err := broker.Subscribe(ctx, "users")
+	assert.NoError(t, err)
+
+	assert.NoError(t, broker.Publish(ctx, "orders", json.RawMessage(`{"id":1}`)))
+	assert.NoError(t, broker.Publish(ctx, "users", json.RawMessage(`{"id":2}`)))
+	assert.Equal(t, Message{Topic: "orders", Payload: json.RawMessage(`{"id":1}`)}, receive(t, orders))
+	assert.Equal(t, Message{Topic: "users", Payload: json.RawMessage(`{"id":2}`)}, receive(t, users))
+
+	cancel()
+	for range orders {
+	}
+	assert.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return broker.subscribers.size == 0 && len(broker.subscribers.root.children) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestMemoryCancelledSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := NewMemory()
+
+	_, err := broker.Subscribe(ctx, "orders")
+	assert.NoError(t, err)
+	orders, err := broker.Subscribe(context.Background(), "orders")
+	assert.NoError(t, err)
+
+	published := make(chan error, 1)
+	go func() {
+		for range 32 {
+			if err := broker.Publish(context.Background(), "orders", json.RawMessage(`{}`)); err != nil {
+				published <- err
+				return
+			}
+		}
+		published <- nil
+	}()
+	for range 16 {
+		receive(t, orders)
+	}
+	cancel()
+	for range 16 {
+		receive(t, orders)
+	}
+	select {
+	case err := <-published:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by a cancelled subscriber")
+	}
+}
+
+func TestMemoryWildcards(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemory()
+
+	status, err := broker.Subscribe(ctx, "orders/+/status")
+	assert.NoError(t, err)
+	user, err := broker.Subscribe(ctx, "user/#")
+	assert.NoError(t, err)
+	all, err := broker.Subscribe(ctx, "#")
+	assert.NoError(t, err)
+
+	for _, topic := range []string{"orders/42/items", "orders/42/status", "user", "user/1/messages"} {
+		assert.NoError(t, broker.Publish(ctx, topic, json.RawMessage(`{}`)))
+	}
+	assert.Equal(t, "orders/42/status", receive(t, status).Topic)
+	assert.Equal(t, "user", receive(t, user).Topic)
+	assert.Equal(t, "user/1/messages", receive(t, user).Topic)
+	for _, topic := range []string{"orders/42/items", "orders/42/status", "user", "user/1/messages"} {
+		assert.Equal(t, topic, receive(t, all).Topic)
+	}
+	select {
+	case msg := <-status:
+		t.Fatalf("unexpected message on %s", msg.Topic)
+	default:
+	}
+
+	assert.Equal(t, ErrInvalidTopic, broker.Publish(ctx, "orders/+/status", json.RawMessage(`{}`)))
+	_, err = broker.Subscribe(ctx, "user/#/messages")
+	assert.Equal(t, ErrInvalidTopic, err)
+}
@@ -0,0 +1,195 @@
+// Package pulsar is a pubsub driver for Apache Pulsar. The messages of every topic are sent to a
+// single Pulsar topic, keyed by their topic, and the processes receive them through a subscription
+// whose type decides how they are spread across the replicas.
+//
+// The topic of a message is both its key, used by the KeyShared subscriptions, and its "topic"
+// property, read by the Broker. The Client sends and receives them, e.g. with a producer and a
+// consumer of github.com/apache/pulsar-client-go.
+package pulsar
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+// TopicProperty is the property of the messages holding their topic.
+const TopicProperty = "topic"
+
+const (
+	defaultTopic         = "persistent://public/default/graphqlws"
+	defaultSubscription  = "graphqlws"
+	defaultRetryInterval = time.Second
+)
+
+// SubscriptionType is the type of the Pulsar subscription of the processes.
+type SubscriptionType int
+
+const (
+	// Exclusive subscribes every process with a subscription of its own, so that every process
+	// receives every message.
+	Exclusive SubscriptionType = iota
+	// Shared subscribes the replicas with the same subscription, every message is received by one
+	// of them.
+	Shared
+	// KeyShared subscribes the replicas with the same subscription, the messages of a topic are
+	// received in order by the same replica.
+	KeyShared
+)
+
+func (t SubscriptionType) String() string {
+	switch t {
+	case Exclusive:
+		return "exclusive"
+	case Shared:
+		return "shared"
+	case KeyShared:
+		return "key_shared"
+	default:
+		return "unknown"
+	}
+}
+
+// ProducerMessage is a message sent to Pulsar.
+type ProducerMessage struct {
+	Key        string
+	Payload    []byte
+	Properties map[string]string
+}
+
+// ConsumerMessage is a message received from Pulsar.
+type ConsumerMessage struct {
+	Key        string
+	Payload    []byte
+	Properties map[string]string
+	Ack        func()
+}
+
+// Client is the subset of the Pulsar producer and consumer used by the Broker.
+type Client interface {
+	Send(ctx context.Context, topic string, msg *ProducerMessage) error
+	// Receive subscribes to a topic and calls handler with its messages one at a time until ctx
+	// is done or it fails.
+	Receive(ctx context.Context, topic string, subscription string, subscriptionType SubscriptionType, handler func(ctx context.Context, msg *ConsumerMessage)) error
+}
+
+// Broker is a pubsub.Broker sending and receiving through a Pulsar topic. Run receives the messages
+// and subscribes again after the failures.
+//
+// The messages are keyed by their topic, so that a KeyShared subscription preserves their order
+// while the replicas share the load, e.g. when the clients are routed to the replicas by topic. The
+// messages are acknowledged once they are delivered to the local subscriptions.
+type Broker struct {
+	Client Client
+	// Topic is the Pulsar topic of the messages, it defaults to
+	// "persistent://public/default/graphqlws".
+	Topic string
+	// Type is the type of the subscription, it defaults to Exclusive.
+	Type SubscriptionType
+	// Subscription is the name of the subscription. It defaults to "graphqlws-" followed by a
+	// random suffix for an Exclusive subscription, and to "graphqlws" for the others, shared by the
+	// replicas.
+	Subscription string
+	// RetryInterval is the delay before receiving again after a failure, it defaults to 1 second.
+	RetryInterval time.Duration
+	// ErrorFunc is called with the failures of the consumer.
+	ErrorFunc func(ctx context.Context, err error)
+
+	once         sync.Once
+	subscription string
+	fanout       pubsub.Fanout
+}
+
+var _ pubsub.Broker = &Broker{}
+
+func (b *Broker) init() {
+	b.once.Do(func() {
+		b.subscription = b.Subscription
+		switch {
+		case b.subscription != "":
+		case b.Type == Exclusive:
+			suffix := make([]byte, 8)
+			_, _ = rand.Read(suffix)
+			b.subscription = defaultSubscription + "-" + hex.EncodeToString(suffix)
+		default:
+			b.subscription = defaultSubscription
+		}
+	})
+}
+
+// SubscriptionName returns the name of the subscription of the process.
+func (b *Broker) SubscriptionName() string {
+	b.init()
+	return b.subscription
+}
+
+func (b *Broker) topic() string {
+	if b.Topic == "" {
+		return defaultTopic
+	}
+	return b.Topic
+}
+
+// Publish implements pubsub.Broker
+func (b *Broker) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	for _, level := range strings.Split(topic, "/") {
+		if level == "+" || level == "#" {
+			return pubsub.ErrInvalidTopic
+		}
+	}
+	return b.Client.Send(ctx, b.topic(), &ProducerMessage{
+		Key:        topic,
+		Payload:    payload,
+		Properties: map[string]string{TopicProperty: topic},
+	})
+}
+
+// Subscribe implements pubsub.Broker
+func (b *Broker) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	return b.fanout.Subscribe(ctx, topic)
+}
+
+// Run receives the messages of the subscription until ctx is done.
+func (b *Broker) Run(ctx context.Context) error {
+	b.init()
+	retryInterval := b.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultRetryInterval
+	}
+
+	handler := func(ctx context.Context, msg *ConsumerMessage) {
+		defer msg.Ack()
+		topic := msg.Properties[TopicProperty]
+		if topic == "" {
+			topic = msg.Key
+		}
+		b.report(ctx, b.fanout.Deliver(ctx, pubsub.Message{Topic: topic, Payload: msg.Payload}))
+	}
+	for {
+		err := b.Client.Receive(ctx, b.topic(), b.subscription, b.Type, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.report(ctx, err)
+
+		timer := time.NewTimer(retryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *Broker) report(ctx context.Context, err error) {
+	if err != nil && b.ErrorFunc != nil {
+		b.ErrorFunc(ctx, err)
+	}
+}
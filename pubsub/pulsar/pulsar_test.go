@@ -0,0 +1,120 @@
+package pulsar
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient is a Pulsar topic dispatching the messages of a KeyShared subscription by the hash
+// of their key.
+type testClient struct {
+	mu        sync.Mutex
+	consumers map[string][]chan *ConsumerMessage
+	acked     int
+}
+
+func (c *testClient) Send(ctx context.Context, topic string, msg *ProducerMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(msg.Key))
+	for _, consumers := range c.consumers {
+		consumer := consumers[int(h.Sum32())%len(consumers)]
+		consumer <- &ConsumerMessage{Key: msg.Key, Payload: msg.Payload, Properties: msg.Properties, Ack: c.ack}
+	}
+	return nil
+}
+
+func (c *testClient) ack() {
+	c.mu.Lock()
+	c.acked++
+	c.mu.Unlock()
+}
+
+func (c *testClient) Receive(ctx context.Context, topic string, subscription string, subscriptionType SubscriptionType, handler func(ctx context.Context, msg *ConsumerMessage)) error {
+	messages := make(chan *ConsumerMessage, 16)
+	c.mu.Lock()
+	c.consumers[subscription] = append(c.consumers[subscription], messages)
+	c.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-messages:
+			handler(ctx, msg)
+		}
+	}
+}
+
+func (c *testClient) consumerCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, consumers := range c.consumers {
+		n += len(consumers)
+	}
+	return n
+}
+
+func TestSubscriptionName(t *testing.T) {
+	assert.Regexp(t, `^graphqlws-[0-9a-f]{16}$`, (&Broker{}).SubscriptionName())
+	assert.Equal(t, "graphqlws", (&Broker{Type: KeyShared}).SubscriptionName())
+	assert.Equal(t, "api", (&Broker{Type: Shared, Subscription: "api"}).SubscriptionName())
+	assert.Equal(t, "key_shared", KeyShared.String())
+}
+
+func TestBrokerKeyShared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &testClient{consumers: map[string][]chan *ConsumerMessage{}}
+	replicas := []*Broker{{Client: client, Type: KeyShared}, {Client: client, Type: KeyShared}}
+	var subscriptions []<-chan pubsub.Message
+	for _, replica := range replicas {
+		messages, err := replica.Subscribe(ctx, "orders/#")
+		assert.NoError(t, err)
+		subscriptions = append(subscriptions, messages)
+		go func() { _ = replica.Run(ctx) }()
+	}
+	assert.Eventually(t, func() bool { return client.consumerCount() == 2 }, time.Second, time.Millisecond)
+
+	// the messages of a topic are received in order by one of the replicas
+	for i := 0; i < 3; i++ {
+		payload := json.RawMessage(`{"n":` + strconv.Itoa(i) + `}`)
+		assert.NoError(t, replicas[0].Publish(ctx, "orders/42", payload))
+	}
+	var received []pubsub.Message
+	for len(received) < 3 {
+		select {
+		case msg := <-subscriptions[0]:
+			received = append(received, msg)
+		case msg := <-subscriptions[1]:
+			received = append(received, msg)
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+		}
+	}
+	for i, msg := range received {
+		assert.Equal(t, pubsub.Message{Topic: "orders/42", Payload: json.RawMessage(`{"n":` + strconv.Itoa(i) + `}`)}, msg)
+	}
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.acked == 3
+	}, time.Second, time.Millisecond)
+	select {
+	case <-subscriptions[0]:
+		t.Fatal("message received twice")
+	case <-subscriptions[1]:
+		t.Fatal("message received twice")
+	default:
+	}
+	assert.Equal(t, pubsub.ErrInvalidTopic, replicas[0].Publish(ctx, "orders/+", json.RawMessage(`{}`)))
+}
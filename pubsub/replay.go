@@ -0,0 +1,145 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+const defaultReplayMaxMessages = 100
+
+// ErrReplayUnavailable is returned when the messages following a sequence number were dropped from
+// the replay buffer, the subscriber has to resynchronise its state another way.
+var ErrReplayUnavailable = errors.New("pubsub: replay unavailable")
+
+// Replay keeps the recent messages of every topic in a bounded buffer, so that the late
+// subscribers and the resuming clients catch up with SubscribeFrom.
+type Replay struct {
+	// MaxMessages is the number of messages kept per topic, it defaults to 100.
+	MaxMessages int
+	// MaxAge is how long the messages are kept, they are kept until evicted by MaxMessages when
+	// zero.
+	MaxAge time.Duration
+}
+
+func (r *Replay) maxMessages() int {
+	if r.MaxMessages <= 0 {
+		return defaultReplayMaxMessages
+	}
+	return r.MaxMessages
+}
+
+// Replayer is implemented by the brokers keeping the recent messages of their topics.
+type Replayer interface {
+	// SubscribeFrom returns the kept messages of a topic following the sequence number, then the
+	// messages published after the call, until ctx is done.
+	SubscribeFrom(ctx context.Context, topic string, seq uint64) (<-chan Message, error)
+}
+
+var _ Replayer = &Memory{}
+
+// replayBuffer is the ring buffer of the recent messages of a topic.
+type replayBuffer struct {
+	messages []replayedMessage
+	start    int
+	size     int
+	// evicted is the sequence number of the last message dropped from the buffer
+	evicted uint64
+}
+
+type replayedMessage struct {
+	msg         Message
+	publishedAt time.Time
+}
+
+func (b *replayBuffer) push(r *Replay, msg Message, now time.Time) {
+	if b.messages == nil {
+		b.messages = make([]replayedMessage, r.maxMessages())
+	}
+	if b.size == len(b.messages) {
+		b.evicted = b.messages[b.start].msg.Seq
+		b.start = (b.start + 1) % len(b.messages)
+		b.size--
+	}
+	b.messages[(b.start+b.size)%len(b.messages)] = replayedMessage{msg: msg, publishedAt: now}
+	b.size++
+}
+
+// expire drops the messages older than the MaxAge.
+func (b *replayBuffer) expire(r *Replay, now time.Time) {
+	if r.MaxAge <= 0 {
+		return
+	}
+	for b.size > 0 && now.Sub(b.messages[b.start].publishedAt) > r.MaxAge {
+		b.evicted = b.messages[b.start].msg.Seq
+		b.messages[b.start] = replayedMessage{}
+		b.start = (b.start + 1) % len(b.messages)
+		b.size--
+	}
+}
+
+// after returns the messages following seq, or false if some were dropped.
+func (b *replayBuffer) after(seq uint64) ([]Message, bool) {
+	if b.evicted > seq {
+		return nil, false
+	}
+	var messages []Message
+	for i := 0; i < b.size; i++ {
+		if msg := b.messages[(b.start+i)%len(b.messages)].msg; msg.Seq > seq {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, true
+}
+
+// SubscribeFrom implements Replayer, the sequence numbers are shared by the topics of the broker so
+// that the topic may be a pattern. It requires a Replay, and returns ErrReplayUnavailable if a
+// message of a topic matching the pattern following seq was dropped.
+func (m *Memory) SubscribeFrom(ctx context.Context, topic string, seq uint64) (<-chan Message, error) {
+	if m.Replay == nil {
+		return nil, errors.New("pubsub: replay is disabled")
+	}
+	if !validPattern(topic) {
+		return nil, ErrInvalidTopic
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	var backlog []Message
+	for name, buffer := range m.replays {
+		if !Match(topic, name) {
+			continue
+		}
+		buffer.expire(m.Replay, now)
+		messages, ok := buffer.after(seq)
+		if !ok {
+			m.mu.Unlock()
+			return nil, ErrReplayUnavailable
+		}
+		backlog = append(backlog, messages...)
+	}
+	sort.Slice(backlog, func(i, j int) bool { return backlog[i].Seq < backlog[j].Seq })
+	in := make(chan Message, 16)
+	m.addSubscriber(ctx, topic, in)
+	m.mu.Unlock()
+
+	return m.forward(ctx, topic, in, backlog), nil
+}
+
+// replay keeps a message in the buffer of its topic, after setting its sequence number.
+func (m *Memory) replay(msg *Message) {
+	m.seq++
+	msg.Seq = m.seq
+	if m.replays == nil {
+		m.replays = map[string]*replayBuffer{}
+	}
+	buffer, ok := m.replays[msg.Topic]
+	if !ok {
+		buffer = &replayBuffer{}
+		m.replays[msg.Topic] = buffer
+	}
+	now := time.Now()
+	buffer.expire(m.Replay, now)
+	buffer.push(m.Replay, *msg, now)
+}
@@ -0,0 +1,55 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySubscribeFrom(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemory()
+	broker.Replay = &Replay{MaxMessages: 2}
+
+	for i, topic := range []string{"chat/a", "chat/b", "chat/a", "chat/a"} {
+		assert.NoError(t, broker.Publish(ctx, topic, json.RawMessage{byte('1' + i)}))
+	}
+
+	// the late subscriber catches up from the sequence numbers it has seen
+	messages, err := broker.SubscribeFrom(ctx, "chat/+", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, Message{Topic: "chat/a", Payload: json.RawMessage("3"), Seq: 3}, receive(t, messages))
+	assert.Equal(t, Message{Topic: "chat/a", Payload: json.RawMessage("4"), Seq: 4}, receive(t, messages))
+	assert.NoError(t, broker.Publish(ctx, "chat/b", json.RawMessage("5")))
+	assert.Equal(t, Message{Topic: "chat/b", Payload: json.RawMessage("5"), Seq: 5}, receive(t, messages))
+
+	// the first message of chat/a was evicted by MaxMessages
+	_, err = broker.SubscribeFrom(ctx, "chat/a", 0)
+	assert.Equal(t, ErrReplayUnavailable, err)
+	messages, err = broker.SubscribeFrom(ctx, "chat/b", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), receive(t, messages).Seq)
+	assert.Equal(t, uint64(5), receive(t, messages).Seq)
+}
+
+func TestMemoryReplayMaxAge(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemory()
+	broker.Replay = &Replay{MaxAge: 20 * time.Millisecond}
+
+	assert.NoError(t, broker.Publish(ctx, "ticker", json.RawMessage("1")))
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, broker.Publish(ctx, "ticker", json.RawMessage("2")))
+
+	_, err := broker.SubscribeFrom(ctx, "ticker", 0)
+	assert.Equal(t, ErrReplayUnavailable, err)
+	messages, err := broker.SubscribeFrom(ctx, "ticker", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage("2"), receive(t, messages).Payload)
+
+	_, err = NewMemory().SubscribeFrom(ctx, "ticker", 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package pubsub
+
+import "sort"
+
+// retain keeps the last message of its topic, it returns false if the message clears it: a
+// message without payload isn't sent to the subscribers.
+func (m *Memory) retain(msg Message) bool {
+	if msg.Payload == nil {
+		delete(m.retained, msg.Topic)
+		return false
+	}
+	if m.retained == nil {
+		m.retained = map[string]Message{}
+	}
+	m.retained[msg.Topic] = msg
+	return true
+}
+
+// matchRetained returns the retained messages of the topics matching pattern, sorted by topic.
+func (m *Memory) matchRetained(pattern string) []Message {
+	var messages []Message
+	for topic, msg := range m.retained {
+		if Match(pattern, topic) {
+			messages = append(messages, msg)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Topic < messages[j].Topic })
+	return messages
+}
+
+// Retained returns the message retained for a topic, publishing a nil payload to the topic
+// clears it.
+func (m *Memory) Retained(topic string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, ok := m.retained[topic]
+	return msg, ok
+}
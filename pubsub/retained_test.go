@@ -0,0 +1,42 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRetain(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemory()
+	broker.Retain = true
+
+	assert.NoError(t, broker.Publish(ctx, "orders/2/status", json.RawMessage(`"shipped"`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/1/status", json.RawMessage(`"paid"`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/1/status", json.RawMessage(`"packed"`)))
+
+	// the current state is sent first, by topic
+	status, err := broker.Subscribe(ctx, "orders/+/status")
+	assert.NoError(t, err)
+	assert.Equal(t, Message{Topic: "orders/1/status", Payload: json.RawMessage(`"packed"`)}, receive(t, status))
+	assert.Equal(t, Message{Topic: "orders/2/status", Payload: json.RawMessage(`"shipped"`)}, receive(t, status))
+
+	assert.NoError(t, broker.Publish(ctx, "orders/1/status", json.RawMessage(`"delivered"`)))
+	assert.Equal(t, Message{Topic: "orders/1/status", Payload: json.RawMessage(`"delivered"`)}, receive(t, status))
+
+	// a nil payload clears the retained message without being sent
+	assert.NoError(t, broker.Publish(ctx, "orders/2/status", nil))
+	_, ok := broker.Retained("orders/2/status")
+	assert.False(t, ok)
+	msg, ok := broker.Retained("orders/1/status")
+	assert.True(t, ok)
+	assert.Equal(t, json.RawMessage(`"delivered"`), msg.Payload)
+
+	one, err := broker.Subscribe(ctx, "orders/2/status")
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "orders/2/status", json.RawMessage(`"returned"`)))
+	assert.Equal(t, json.RawMessage(`"returned"`), receive(t, one).Payload)
+	assert.Equal(t, json.RawMessage(`"returned"`), receive(t, status).Payload)
+}
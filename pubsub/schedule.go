@@ -0,0 +1,309 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule returns the times of the ticks of a Ticker.
+type Schedule interface {
+	// Next returns the first tick after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Every returns a Schedule ticking every d.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+// cronSchedule is a Schedule of the minutes matching its fields.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// anyDay is true when the days of the month or the days of the week aren't restricted, a day
+	// matches both of them then, and either of them otherwise.
+	anyDay bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron returns the Schedule of a cron expression, with the five fields minute, hour, day of
+// the month, month and day of the week, e.g. "*/15 9-17 * * 1-5". The fields are lists of values,
+// ranges and steps. The macros "@hourly", "@daily", "@weekly", "@monthly", "@yearly" and
+// "@every <duration>" are supported as well.
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		duration, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("pubsub: invalid cron interval %q", d)
+		}
+		return Every(duration), nil
+	}
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("pubsub: cron expression %q doesn't have 5 fields", spec)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var bits [5]uint64
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, bounds[i][0], bounds[i][1]); err != nil {
+			return nil, fmt.Errorf("pubsub: cron expression %q: %w", spec, err)
+		}
+	}
+	// Sunday is 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDay: fields[2] == "*" || fields[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the bits of the values of a field.
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// the expressions matching no day, e.g. "0 0 30 2 *", are given up after 5 years
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		switch {
+		case c.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// TickFunc returns the payload of a tick of a Ticker.
+type TickFunc func(ctx context.Context, t time.Time) (json.RawMessage, error)
+
+// tickerJob is a topic of a Ticker.
+type tickerJob struct {
+	topic    string
+	schedule Schedule
+	jitter   time.Duration
+	payload  TickFunc
+	enabled  bool
+	cancel   context.CancelFunc
+}
+
+// Ticker publishes to topics on schedules, e.g. the heartbeats of the subscriptions or the
+// periodic refresh of an aggregate. The topics can be enabled and disabled at runtime.
+type Ticker struct {
+	Broker Broker
+	// ErrorFunc is called with the failures of the payloads and of the broker.
+	ErrorFunc func(ctx context.Context, topic string, err error)
+
+	mu   sync.Mutex
+	ctx  context.Context
+	jobs map[string]*tickerJob
+}
+
+// Schedule publishes to a topic on a schedule, replacing the schedule of the topic if any. The
+// ticks are delayed by a random duration up to jitter, e.g. so that the replicas don't refresh an
+// aggregate at the same time. The payload defaults to {"time": "<RFC 3339 time of the tick>"}.
+func (t *Ticker) Schedule(topic string, schedule Schedule, jitter time.Duration, payload TickFunc) {
+	if payload == nil {
+		payload = timePayload
+	}
+	job := &tickerJob{topic: topic, schedule: schedule, jitter: jitter, payload: payload, enabled: true}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.jobs == nil {
+		t.jobs = map[string]*tickerJob{}
+	}
+	if previous, ok := t.jobs[topic]; ok {
+		job.enabled = previous.enabled
+		if previous.cancel != nil {
+			previous.cancel()
+		}
+	}
+	t.jobs[topic] = job
+	if t.ctx != nil {
+		t.start(job)
+	}
+}
+
+// Unschedule stops publishing to a topic.
+func (t *Ticker) Unschedule(topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if job, ok := t.jobs[topic]; ok {
+		if job.cancel != nil {
+			job.cancel()
+		}
+		delete(t.jobs, topic)
+	}
+}
+
+// SetEnabled enables or disables the ticks of a topic, it returns false if the topic isn't
+// scheduled.
+func (t *Ticker) SetEnabled(topic string, enabled bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[topic]
+	if ok {
+		job.enabled = enabled
+	}
+	return ok
+}
+
+// Enabled returns true if the ticks of a topic are published.
+func (t *Ticker) Enabled(topic string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[topic]
+	return ok && job.enabled
+}
+
+// Run publishes the ticks of the topics until ctx is done.
+func (t *Ticker) Run(ctx context.Context) error {
+	t.mu.Lock()
+	t.ctx = ctx
+	for _, job := range t.jobs {
+		t.start(job)
+	}
+	t.mu.Unlock()
+
+	<-ctx.Done()
+	t.mu.Lock()
+	t.ctx = nil
+	for _, job := range t.jobs {
+		job.cancel = nil
+	}
+	t.mu.Unlock()
+	return ctx.Err()
+}
+
+// start runs a job until it is replaced or the ticker is done.
+func (t *Ticker) start(job *tickerJob) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	job.cancel = cancel
+	go func() {
+		defer cancel()
+		next := time.Now()
+		for {
+			next = job.schedule.Next(next)
+			if next.IsZero() {
+				return
+			}
+			delay := time.Until(next)
+			if job.jitter > 0 {
+				delay += rand.N(job.jitter)
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			t.mu.Lock()
+			enabled := job.enabled
+			t.mu.Unlock()
+			if enabled {
+				t.tick(ctx, job, next)
+			}
+		}
+	}()
+}
+
+func (t *Ticker) tick(ctx context.Context, job *tickerJob, tick time.Time) {
+	payload, err := job.payload(ctx, tick)
+	if err == nil {
+		err = t.Broker.Publish(ctx, job.topic, payload)
+	}
+	if err != nil && ctx.Err() == nil && t.ErrorFunc != nil {
+		t.ErrorFunc(ctx, job.topic, err)
+	}
+}
+
+func timePayload(ctx context.Context, t time.Time) (json.RawMessage, error) {
+	return json.Marshal(map[string]time.Time{"time": t})
+}
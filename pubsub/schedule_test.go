@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	// a Friday
+	from := time.Date(2024, 3, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 8 * * 1", time.Date(2024, 3, 18, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// either the day of the month or the day of the week
+		{"0 0 1 * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, 3, 15, 10, 9, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.spec)
+		if assert.NoError(t, err, tt.spec) {
+			assert.Equal(t, tt.want, schedule.Next(from), tt.spec)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every -1s", "a * * * *"} {
+		_, err := ParseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestTicker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := NewMemory()
+	heartbeats, err := broker.Subscribe(ctx, "heartbeat")
+	assert.NoError(t, err)
+	totals, err := broker.Subscribe(ctx, "totals")
+	assert.NoError(t, err)
+
+	errs := make(chan error, 16)
+	ticker := &Ticker{
+		Broker:    broker,
+		ErrorFunc: func(ctx context.Context, topic string, err error) { errs <- err },
+	}
+	ticker.Schedule("heartbeat", Every(10*time.Millisecond), 5*time.Millisecond, nil)
+	done := make(chan error)
+	go func() { done <- ticker.Run(ctx) }()
+
+	msg := receive(t, heartbeats)
+	var payload struct{ Time time.Time }
+	assert.NoError(t, json.Unmarshal(msg.Payload, &payload))
+	assert.WithinDuration(t, time.Now(), payload.Time, time.Second)
+
+	// scheduled while running
+	failed := false
+	ticker.Schedule("totals", Every(10*time.Millisecond), 0, func(ctx context.Context, t time.Time) (json.RawMessage, error) {
+		if !failed {
+			failed = true
+			return nil, errors.New("no totals")
+		}
+		return json.RawMessage(`{"total":42}`), nil
+	})
+	assert.Equal(t, json.RawMessage(`{"total":42}`), receive(t, totals).Payload)
+	assert.EqualError(t, <-errs, "no totals")
+
+	// disabled at runtime
+	assert.True(t, ticker.SetEnabled("heartbeat", false))
+	assert.False(t, ticker.Enabled("heartbeat"))
+	assert.False(t, ticker.SetEnabled("other", false))
+	drained := false
+	for !drained {
+		select {
+		case <-heartbeats:
+		case <-time.After(30 * time.Millisecond):
+			drained = true
+		}
+	}
+	select {
+	case <-heartbeats:
+		t.Fatal("heartbeat published while disabled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	ticker.SetEnabled("heartbeat", true)
+	receive(t, heartbeats)
+
+	ticker.Unschedule("totals")
+	assert.False(t, ticker.Enabled("totals"))
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
@@ -0,0 +1,164 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+const defaultSignalTTL = 5 * time.Second
+
+// ErrSignalUnavailable is returned when signaling through a broker that doesn't implement
+// Signaler.
+var ErrSignalUnavailable = errors.New("pubsub: signals unavailable")
+
+// Signaler is implemented by the brokers delivering ephemeral signals, e.g. the typing
+// indicators or the cursor positions of a document.
+//
+// A signal is never retained, replayed or persisted, it is conflated with the following signals
+// of its topic while a subscriber lags behind, so that it receives the last one only, and
+// expires when it isn't delivered soon enough. The signals of several sources must therefore be
+// published to their own topic, e.g. "chat/1/typing/alice", and subscribed to with a pattern.
+type Signaler interface {
+	// Signal sends an ephemeral payload to the subscribers of a topic without waiting for them.
+	Signal(ctx context.Context, topic string, payload json.RawMessage) error
+}
+
+var _ Signaler = &Memory{}
+
+// Signal publishes an ephemeral payload to a topic of a broker implementing Signaler, see
+// Signaler.
+func Signal(ctx context.Context, broker Broker, topic string, payload json.RawMessage) error {
+	signaler, ok := broker.(Signaler)
+	if !ok {
+		return ErrSignalUnavailable
+	}
+	return signaler.Signal(ctx, topic, payload)
+}
+
+// signalSlot holds the signals pending for a subscription, the last one of every topic.
+type signalSlot struct {
+	pending map[string]pendingSignal
+	notify  chan struct{}
+}
+
+type pendingSignal struct {
+	msg       Message
+	expiresAt time.Time
+}
+
+func newSignalSlot() *signalSlot {
+	return &signalSlot{notify: make(chan struct{}, 1)}
+}
+
+// Signal implements Signaler, the signals are delivered to the subscriptions of Subscribe and
+// SubscribeFrom with Ephemeral set, and expire after SignalTTL.
+func (m *Memory) Signal(ctx context.Context, topic string, payload json.RawMessage) error {
+	if !validTopic(topic) {
+		return ErrInvalidTopic
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	signal := pendingSignal{
+		msg:       Message{Topic: topic, Payload: payload, Ephemeral: true},
+		expiresAt: time.Now().Add(m.signalTTL()),
+	}
+	m.subscribers.match(topic, func(sub chan Message) {
+		slot, ok := m.signals[sub]
+		if !ok || !m.accepts(sub, signal.msg) {
+			return
+		}
+		if slot.pending == nil {
+			slot.pending = map[string]pendingSignal{}
+		}
+		slot.pending[topic] = signal
+		select {
+		case slot.notify <- struct{}{}:
+		default:
+		}
+	})
+	return nil
+}
+
+func (m *Memory) signalTTL() time.Duration {
+	if m.SignalTTL <= 0 {
+		return defaultSignalTTL
+	}
+	return m.SignalTTL
+}
+
+// addSignalSlot returns the slot of the signals of a subscription, m.mu must be held.
+func (m *Memory) addSignalSlot(sub chan Message) *signalSlot {
+	if m.signals == nil {
+		m.signals = map[chan Message]*signalSlot{}
+	}
+	slot := newSignalSlot()
+	m.signals[sub] = slot
+	return slot
+}
+
+// takeSignals returns the signals of a slot that haven't expired, in the order of publication.
+func (m *Memory) takeSignals(slot *signalSlot) []Message {
+	m.mu.Lock()
+	pending := slot.pending
+	slot.pending = nil
+	m.mu.Unlock()
+
+	now := time.Now()
+	signals := make([]pendingSignal, 0, len(pending))
+	for _, signal := range pending {
+		if now.Before(signal.expiresAt) {
+			signals = append(signals, signal)
+		}
+	}
+	sort.Slice(signals, func(i, j int) bool { return signals[i].expiresAt.Before(signals[j].expiresAt) })
+	messages := make([]Message, len(signals))
+	for i, signal := range signals {
+		messages[i] = signal.msg
+	}
+	return messages
+}
+
+// Signal implements Signaler when the broker does, the topic is checked as a publication.
+func (a Authorized) Signal(ctx context.Context, topic string, payload json.RawMessage) error {
+	signaler, ok := a.Broker.(Signaler)
+	if !ok {
+		return ErrSignalUnavailable
+	}
+	if err := a.Authorizer.CanPublish(ctx, topic); err != nil {
+		return err
+	}
+	return signaler.Signal(ctx, topic, payload)
+}
+
+// Signal implements Signaler when the broker does.
+func (v Validated) Signal(ctx context.Context, topic string, payload json.RawMessage) error {
+	signaler, ok := v.Broker.(Signaler)
+	if !ok {
+		return ErrSignalUnavailable
+	}
+	if err := v.Validator.Validate(topic, payload); err != nil {
+		return err
+	}
+	return signaler.Signal(ctx, topic, payload)
+}
+
+// Signal implements Signaler when the broker does.
+func (t Transformed) Signal(ctx context.Context, topic string, payload json.RawMessage) error {
+	signaler, ok := t.Broker.(Signaler)
+	if !ok {
+		return ErrSignalUnavailable
+	}
+	msg, err := t.Pipeline.Apply(ctx, Message{Topic: topic, Payload: payload, Ephemeral: true})
+	if errors.Is(err, ErrDrop) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return signaler.Signal(ctx, msg.Topic, msg.Payload)
+}
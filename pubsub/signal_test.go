@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := &Memory{Retain: true, Replay: &Replay{}}
+
+	typing, err := broker.Subscribe(ctx, "chat/1/typing/+")
+	assert.NoError(t, err)
+	// the subscriber lags behind, the signals don't wait for it and are conflated
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, broker.Signal(ctx, "chat/1/typing/alice", json.RawMessage(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+	assert.NoError(t, broker.Signal(ctx, "chat/1/typing/bob", json.RawMessage(`{"n":0}`)))
+
+	received := map[string]string{}
+	for count := 0; received["chat/1/typing/alice"] != `{"n":99}` || received["chat/1/typing/bob"] == ""; count++ {
+		msg := receive(t, typing)
+		assert.True(t, msg.Ephemeral)
+		received[msg.Topic] = string(msg.Payload)
+		assert.Less(t, count, 4)
+	}
+
+	// the signals are neither retained nor replayed
+	_, ok := broker.Retained("chat/1/typing/alice")
+	assert.False(t, ok)
+	late, err := broker.SubscribeFrom(ctx, "chat/1/typing/+", 0)
+	assert.NoError(t, err)
+	select {
+	case msg := <-late:
+		t.Fatalf("unexpected message on %s", msg.Topic)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	assert.Equal(t, ErrInvalidTopic, broker.Signal(ctx, "chat/+/typing", json.RawMessage(`{}`)))
+}
+
+func TestMemorySignalExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := &Memory{SignalTTL: 10 * time.Millisecond}
+
+	messages, err := broker.Subscribe(ctx, "documents/1/#")
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "documents/1", json.RawMessage(`{"title":"a"}`)))
+	assert.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		queued := 0
+		broker.subscribers.match("documents/1", func(sub chan Message) { queued += len(sub) })
+		return queued == 0
+	}, time.Second, time.Millisecond)
+	// the signal waits for the delivery of the message, then expires
+	assert.NoError(t, broker.Signal(ctx, "documents/1/cursor/alice", json.RawMessage(`{"line":3}`)))
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, "documents/1", receive(t, messages).Topic)
+	assert.NoError(t, broker.Publish(ctx, "documents/1", json.RawMessage(`{"title":"b"}`)))
+	msg := receive(t, messages)
+	assert.False(t, msg.Ephemeral)
+	assert.JSONEq(t, `{"title":"b"}`, string(msg.Payload))
+}
+
+func TestSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the embedded interface hides the Signal method of the broker
+	assert.Equal(t, ErrSignalUnavailable, Signal(ctx, struct{ Broker }{NewMemory()}, "typing", json.RawMessage(`{}`)))
+
+	authorizer := &Authorizer{DenyUnmatched: true}
+	authorizer.AuthorizeSubscribe("typing/#", func(ctx context.Context, topic string) error { return nil })
+	broker := Authorized{Broker: NewMemory(), Authorizer: authorizer}
+	assert.Equal(t, ErrForbidden, Signal(ctx, broker, "typing/alice", json.RawMessage(`{}`)))
+	authorizer.AuthorizePublish("typing/#", func(ctx context.Context, topic string) error { return nil })
+
+	typing, err := NewTopic[map[string]bool](broker, "typing/+").Subscribe(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, NewTopic[map[string]bool](broker, "typing/alice").Signal(ctx, map[string]bool{"typing": true}))
+	select {
+	case payload := <-typing:
+		assert.Equal(t, map[string]bool{"typing": true}, payload)
+	case <-time.After(time.Second):
+		t.Fatal("no signal received")
+	}
+}
@@ -0,0 +1,111 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Topic publishes and subscribes to a topic of a Broker with payloads of type T, encoded to JSON,
+// so that the resolvers don't assert the type of the payloads. The name may be a pattern for
+// the subscriptions.
+type Topic[T any] struct {
+	Broker Broker
+	Name   string
+	// ErrorFunc is called with the messages whose payload can't be decoded to T, they are dropped.
+	ErrorFunc func(ctx context.Context, msg Message, err error)
+}
+
+// NewTopic returns the topic name of broker.
+func NewTopic[T any](broker Broker, name string) *Topic[T] {
+	return &Topic[T]{Broker: broker, Name: name}
+}
+
+// Publish sends a payload to the subscribers of the topic.
+func (t *Topic[T]) Publish(ctx context.Context, payload T) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return t.Broker.Publish(ctx, t.Name, b)
+}
+
+// Signal sends an ephemeral payload to the subscribers of the topic, see Signaler.
+func (t *Topic[T]) Signal(ctx context.Context, payload T) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return Signal(ctx, t.Broker, t.Name, b)
+}
+
+// Subscribe returns the payloads published to the topic after the call, until ctx is done.
+func (t *Topic[T]) Subscribe(ctx context.Context) (<-chan T, error) {
+	messages, err := t.Broker.Subscribe(ctx, t.Name)
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(ctx, messages), nil
+}
+
+// SubscribeFrom returns the payloads following the sequence number, then the payloads published
+// after the call, see Replayer. The broker must implement Replayer.
+func (t *Topic[T]) SubscribeFrom(ctx context.Context, seq uint64) (<-chan T, error) {
+	replayer, ok := t.Broker.(Replayer)
+	if !ok {
+		return nil, ErrReplayUnavailable
+	}
+	messages, err := replayer.SubscribeFrom(ctx, t.Name, seq)
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(ctx, messages), nil
+}
+
+func (t *Topic[T]) decode(ctx context.Context, messages <-chan Message) <-chan T {
+	payloads := make(chan T)
+	go func() {
+		defer close(payloads)
+		for msg := range messages {
+			var payload T
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+				if t.ErrorFunc != nil {
+					t.ErrorFunc(ctx, msg, err)
+				}
+				continue
+			}
+			select {
+			case payloads <- payload:
+			case <-ctx.Done():
+				// the messages are closed with ctx
+			}
+		}
+	}()
+	return payloads
+}
+
+// ExpandTopic replaces the "{name}" placeholders of a topic template with the fields of a record,
+// e.g. "orders/{id}" with the id of a row, so that the sources publish the records to their own
+// topic.
+func ExpandTopic(template string, fields map[string]any) (string, error) {
+	var topic strings.Builder
+	rest := template
+	for {
+		before, after, found := strings.Cut(rest, "{")
+		topic.WriteString(before)
+		if !found {
+			return topic.String(), nil
+		}
+		name, after, found := strings.Cut(after, "}")
+		if !found {
+			return "", fmt.Errorf("pubsub: unterminated placeholder in topic %q", template)
+		}
+		value, ok := fields[name]
+		if !ok || value == nil {
+			return "", fmt.Errorf("pubsub: no field %q for topic %q", name, template)
+		}
+		fmt.Fprint(&topic, value)
+		rest = after
+	}
+}
@@ -0,0 +1,74 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type orderStatus struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+func TestTopic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := NewMemory()
+	errs := make(chan error, 1)
+	topic := NewTopic[orderStatus](broker, "orders/status")
+	topic.ErrorFunc = func(ctx context.Context, msg Message, err error) { errs <- err }
+
+	statuses, err := topic.Subscribe(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "orders/status", json.RawMessage(`"invalid"`)))
+	assert.NoError(t, topic.Publish(ctx, orderStatus{ID: 1, Status: "paid"}))
+
+	select {
+	case status := <-statuses:
+		assert.Equal(t, orderStatus{ID: 1, Status: "paid"}, status)
+	case <-time.After(time.Second):
+		t.Fatal("no payload received")
+	}
+	assert.Error(t, <-errs)
+
+	cancel()
+	for range statuses {
+	}
+}
+
+func TestTopicSubscribeFrom(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemory()
+	broker.Replay = &Replay{}
+	topic := NewTopic[int](broker, "counter")
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, topic.Publish(ctx, i))
+	}
+
+	counts, err := topic.SubscribeFrom(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, <-counts)
+	assert.Equal(t, 3, <-counts)
+
+	counts, err = NewTopic[int](Authorized{Broker: broker, Authorizer: &Authorizer{}}, "counter").SubscribeFrom(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, <-counts)
+
+	// the broker doesn't implement Replayer
+	_, err = NewTopic[int](struct{ Broker }{broker}, "counter").SubscribeFrom(ctx, 0)
+	assert.Equal(t, ErrReplayUnavailable, err)
+}
+
+func TestExpandTopic(t *testing.T) {
+	topic, err := ExpandTopic("orders/{id}/{status}", map[string]any{"id": json.Number("42"), "status": "paid"})
+	assert.NoError(t, err)
+	assert.Equal(t, "orders/42/paid", topic)
+
+	_, err = ExpandTopic("orders/{id", map[string]any{"id": 1})
+	assert.EqualError(t, err, `pubsub: unterminated placeholder in topic "orders/{id"`)
+	_, err = ExpandTopic("orders/{id}", map[string]any{})
+	assert.EqualError(t, err, `pubsub: no field "id" for topic "orders/{id}"`)
+}
@@ -0,0 +1,85 @@
+package pubsub
+
+import "strings"
+
+// topicTrie indexes the subscriptions by the levels of their pattern, so that publishing to a
+// topic walks its levels rather than every subscription.
+type topicTrie struct {
+	root trieNode
+	size int
+}
+
+type trieNode struct {
+	children    map[string]*trieNode
+	subscribers map[chan Message]struct{}
+}
+
+// add subscribes sub to the topics matching pattern.
+func (t *topicTrie) add(pattern string, sub chan Message) {
+	n := &t.root
+	for _, level := range strings.Split(pattern, "/") {
+		if n.children == nil {
+			n.children = map[string]*trieNode{}
+		}
+		child, ok := n.children[level]
+		if !ok {
+			child = &trieNode{}
+			n.children[level] = child
+		}
+		n = child
+	}
+	if n.subscribers == nil {
+		n.subscribers = map[chan Message]struct{}{}
+	}
+	n.subscribers[sub] = struct{}{}
+	t.size++
+}
+
+// remove unsubscribes sub from pattern, pruning the nodes left empty.
+func (t *topicTrie) remove(pattern string, sub chan Message) {
+	if t.root.remove(strings.Split(pattern, "/"), sub) {
+		t.size--
+	}
+}
+
+func (n *trieNode) remove(levels []string, sub chan Message) bool {
+	if len(levels) == 0 {
+		_, ok := n.subscribers[sub]
+		delete(n.subscribers, sub)
+		return ok
+	}
+	child, ok := n.children[levels[0]]
+	if !ok || !child.remove(levels[1:], sub) {
+		return false
+	}
+	if len(child.children) == 0 && len(child.subscribers) == 0 {
+		delete(n.children, levels[0])
+	}
+	return true
+}
+
+// match calls fn with the subscribers of the patterns matching topic.
+func (t *topicTrie) match(topic string, fn func(sub chan Message)) {
+	t.root.match(strings.Split(topic, "/"), fn)
+}
+
+func (n *trieNode) match(levels []string, fn func(sub chan Message)) {
+	if multi, ok := n.children["#"]; ok {
+		// "#" matches the parent level as well
+		for sub := range multi.subscribers {
+			fn(sub)
+		}
+	}
+	if len(levels) == 0 {
+		for sub := range n.subscribers {
+			fn(sub)
+		}
+		return
+	}
+	if child, ok := n.children[levels[0]]; ok {
+		child.match(levels[1:], fn)
+	}
+	if single, ok := n.children["+"]; ok && levels[0] != "+" {
+		single.match(levels[1:], fn)
+	}
+}
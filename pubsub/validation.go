@@ -0,0 +1,215 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// ValidationError is returned when publishing a payload rejected by the validators of its topic.
+type ValidationError struct {
+	Topic string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("pubsub: invalid payload for %s: %v", e.Topic, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateFunc returns an error if a payload is malformed.
+type ValidateFunc func(payload json.RawMessage) error
+
+type validationRule struct {
+	pattern string
+	fn      ValidateFunc
+}
+
+// Validator checks the payloads published to the topics against the validators of their patterns,
+// e.g. a JSONSchema or a GraphQLType, so that a malformed payload is rejected once when it is
+// published rather than by every subscription encoding it. Every validator whose pattern matches
+// a topic is evaluated, the topics matched by none of them are published unchecked.
+type Validator struct {
+	mu    sync.RWMutex
+	rules []validationRule
+}
+
+// Register adds a validator of the payloads published to the topics matching pattern.
+func (v *Validator) Register(pattern string, fn ValidateFunc) {
+	v.mu.Lock()
+	v.rules = append(v.rules, validationRule{pattern: pattern, fn: fn})
+	v.mu.Unlock()
+}
+
+// Validate returns a *ValidationError if a payload published to the topic is malformed.
+func (v *Validator) Validate(topic string, payload json.RawMessage) error {
+	v.mu.RLock()
+	rules := v.rules
+	v.mu.RUnlock()
+	for _, rule := range rules {
+		if !Match(rule.pattern, topic) {
+			continue
+		}
+		if err := rule.fn(payload); err != nil {
+			return &ValidationError{Topic: topic, Err: err}
+		}
+	}
+	return nil
+}
+
+// Validated is a Broker checking the payloads with a Validator before publishing them.
+type Validated struct {
+	Broker
+	Validator *Validator
+}
+
+var _ Broker = Validated{}
+
+// Publish implements Broker
+func (v Validated) Publish(ctx context.Context, topic string, payload json.RawMessage) error {
+	if err := v.Validator.Validate(topic, payload); err != nil {
+		return err
+	}
+	return v.Broker.Publish(ctx, topic, payload)
+}
+
+// decodeJSON decodes a payload keeping the numbers as json.Number.
+func decodeJSON(payload json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// GraphQLType returns a ValidateFunc checking that the payloads are values of a type of a schema,
+// e.g. the type of the field of a subscription: the fields must be fields of the type, the non
+// null fields must be set and the scalars and enums must have the values of their type.
+func GraphQLType(schema *ast.Schema, typ *ast.Type) ValidateFunc {
+	return func(payload json.RawMessage) error {
+		v, err := decodeJSON(payload)
+		if err != nil {
+			return err
+		}
+		return validateGraphQLValue(schema, typ, v, "$")
+	}
+}
+
+func validateGraphQLValue(schema *ast.Schema, typ *ast.Type, v interface{}, path string) error {
+	if v == nil {
+		if typ.NonNull {
+			return fmt.Errorf("%s: null for non null %s", path, typ.String())
+		}
+		return nil
+	}
+	if typ.Elem != nil {
+		list, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected a list of %s", path, typ.Elem.String())
+		}
+		for i, item := range list {
+			if err := validateGraphQLValue(schema, typ.Elem, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	def := schema.Types[typ.NamedType]
+	if def == nil {
+		return fmt.Errorf("%s: unknown type %s", path, typ.NamedType)
+	}
+	switch def.Kind {
+	case ast.Scalar:
+		return validateGraphQLScalar(def.Name, v, path)
+	case ast.Enum:
+		s, ok := v.(string)
+		if !ok || def.EnumValues.ForName(s) == nil {
+			return fmt.Errorf("%s: expected a value of %s", path, def.Name)
+		}
+		return nil
+	case ast.Interface, ast.Union:
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object of %s", path, def.Name)
+		}
+		// the possible type is known by its __typename only
+		name, _ := object["__typename"].(string)
+		if name == "" {
+			return nil
+		}
+		for _, possible := range schema.GetPossibleTypes(def) {
+			if possible.Name == name {
+				return validateGraphQLObject(schema, possible, object, path)
+			}
+		}
+		return fmt.Errorf("%s: %s isn't a possible type of %s", path, name, def.Name)
+	default:
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object of %s", path, def.Name)
+		}
+		return validateGraphQLObject(schema, def, object, path)
+	}
+}
+
+func validateGraphQLObject(schema *ast.Schema, def *ast.Definition, object map[string]interface{}, path string) error {
+	for name, value := range object {
+		if name == "__typename" {
+			continue
+		}
+		field := def.Fields.ForName(name)
+		if field == nil {
+			return fmt.Errorf("%s: unknown field %s of %s", path, name, def.Name)
+		}
+		if err := validateGraphQLValue(schema, field.Type, value, path+"."+name); err != nil {
+			return err
+		}
+	}
+	for _, field := range def.Fields {
+		if _, ok := object[field.Name]; !ok && field.Type.NonNull && !strings.HasPrefix(field.Name, "__") {
+			return fmt.Errorf("%s: missing non null field %s of %s", path, field.Name, def.Name)
+		}
+	}
+	return nil
+}
+
+func validateGraphQLScalar(name string, v interface{}, path string) error {
+	valid := true
+	switch name {
+	case "Int":
+		n, ok := v.(json.Number)
+		_, err := n.Int64()
+		valid = ok && err == nil
+	case "Float":
+		_, valid = v.(json.Number)
+	case "String":
+		_, valid = v.(string)
+	case "Boolean":
+		_, valid = v.(bool)
+	case "ID":
+		switch id := v.(type) {
+		case string:
+		case json.Number:
+			_, err := id.Int64()
+			valid = err == nil
+		default:
+			valid = false
+		}
+	}
+	// the custom scalars accept any value
+	if !valid {
+		return fmt.Errorf("%s: expected %s", path, name)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestJSONSchema(t *testing.T) {
+	validate, err := JSONSchema([]byte(`{
+		"type": "object",
+		"required": ["id", "status"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"status": {"enum": ["new", "paid"]},
+			"note": {"type": ["string", "null"], "maxLength": 5},
+			"items": {"type": "array", "maxItems": 2, "items": {"type": "number"}}
+		},
+		"additionalProperties": false
+	}`))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		payload string
+		err     string
+	}{
+		{`{"id":9007199254740993,"status":"paid","note":null,"items":[1.5,2]}`, ""},
+		{`{"id":1}`, "$: missing required property status"},
+		{`{"id":1.5,"status":"paid"}`, "$.id: expected [integer]"},
+		{`{"id":0,"status":"paid"}`, "$.id: less than 1"},
+		{`{"id":1,"status":"lost"}`, "$.status: not one of the values of the enum"},
+		{`{"id":1,"status":"new","note":"too long"}`, "$.note: longer than 5 characters"},
+		{`{"id":1,"status":"new","items":["a"]}`, "$.items[0]: expected [number]"},
+		{`{"id":1,"status":"new","items":[1,2,3]}`, "$.items: more than 2 items"},
+		{`{"id":1,"status":"new","extra":true}`, "$.extra: not allowed"},
+		{`[]`, "$: expected [object]"},
+	}
+	for _, tt := range tests {
+		err := validate(json.RawMessage(tt.payload))
+		if tt.err == "" {
+			assert.NoError(t, err, tt.payload)
+		} else {
+			assert.EqualError(t, err, tt.err, tt.payload)
+		}
+	}
+
+	_, err = JSONSchema([]byte(`{"type": 1}`))
+	assert.Error(t, err)
+}
+
+func TestGraphQLType(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Query { order: Order }
+		enum Status { NEW PAID }
+		interface Node { id: ID! }
+		type Order implements Node { id: ID! status: Status! total: Float lines: [Line!] owner: Node }
+		type Line { sku: String! quantity: Int! }
+		type User implements Node { id: ID! name: String }
+	`})
+	validate := GraphQLType(schema, ast.NonNullNamedType("Order", nil))
+
+	tests := []struct {
+		payload string
+		err     string
+	}{
+		{`{"id":"1","status":"PAID","total":9.5,"lines":[{"sku":"a","quantity":2}],"owner":{"__typename":"User","id":7,"name":"Ann"}}`, ""},
+		{`null`, "$: null for non null Order!"},
+		{`{"status":"PAID"}`, "$: missing non null field id of Order"},
+		{`{"id":"1","status":"LOST"}`, "$.status: expected a value of Status"},
+		{`{"id":"1","status":"NEW","lines":[{"sku":"a","quantity":1.5}]}`, "$.lines[0].quantity: expected Int"},
+		{`{"id":"1","status":"NEW","lines":{}}`, "$.lines: expected a list of Line!"},
+		{`{"id":"1","status":"NEW","coupon":"X"}`, "$: unknown field coupon of Order"},
+		{`{"id":"1","status":"NEW","owner":{"__typename":"User","id":true}}`, "$.owner.id: expected ID"},
+		{`{"id":"1","status":"NEW","owner":{"__typename":"Line"}}`, "$.owner: Line isn't a possible type of Node"},
+	}
+	for _, tt := range tests {
+		err := validate(json.RawMessage(tt.payload))
+		if tt.err == "" {
+			assert.NoError(t, err, tt.payload)
+		} else {
+			assert.EqualError(t, err, tt.err, tt.payload)
+		}
+	}
+}
+
+func TestValidated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validator := &Validator{}
+	validate, err := JSONSchema([]byte(`{"type": "object", "required": ["status"]}`))
+	assert.NoError(t, err)
+	validator.Register("orders/+/status", validate)
+	broker := Validated{Broker: NewMemory(), Validator: validator}
+
+	messages, err := broker.Subscribe(ctx, "orders/#")
+	assert.NoError(t, err)
+	err = broker.Publish(ctx, "orders/1/status", json.RawMessage(`{}`))
+	var validationErr *ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "orders/1/status", validationErr.Topic)
+	assert.EqualError(t, err, "pubsub: invalid payload for orders/1/status: $: missing required property status")
+
+	// the topics without validator are published unchecked
+	assert.NoError(t, broker.Publish(ctx, "orders/1/items", json.RawMessage(`[]`)))
+	assert.NoError(t, broker.Publish(ctx, "orders/1/status", json.RawMessage(`{"status":"paid"}`)))
+	assert.Equal(t, "orders/1/items", receive(t, messages).Topic)
+	assert.Equal(t, "orders/1/status", receive(t, messages).Topic)
+}
@@ -0,0 +1,232 @@
+// Package webhook serves an HTTP endpoint publishing the webhooks it receives to the topics of a
+// pubsub.Broker, e.g. the events of Stripe or GitHub, so that the clients subscribe to them.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+)
+
+const (
+	defaultMaxBodySize = 1 << 20
+	defaultTolerance   = 5 * time.Minute
+)
+
+// ErrInvalidSignature is returned by the VerifyFuncs when the signature of a request doesn't match
+// its body.
+var ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+// ErrExpiredSignature is returned by Stripe and HMACSHA256 when a request was signed outside of the
+// tolerance, e.g. a request replayed.
+var ErrExpiredSignature = errors.New("webhook: expired signature")
+
+// ErrTopicNotAllowed is returned by GitHub and Stripe when the topic of a request isn't allowed for
+// their secret, e.g. a signed request replayed to another topic.
+var ErrTopicNotAllowed = errors.New("webhook: topic not allowed")
+
+// VerifyFunc returns an error if the signature of a request doesn't match its body.
+type VerifyFunc func(r *http.Request, body []byte) error
+
+// HMACSHA256 returns a VerifyFunc checking the signatures of the senders under control of the
+// application. The Webhook-Timestamp header holds the unix time of the signature, which must be less
+// than tolerance ago, and the Webhook-Signature header the hex encoded HMAC-SHA256 of
+// "{timestamp}.{topic}.{body}" after "sha256=", so that a request can't be replayed later or to
+// another topic. The tolerance defaults to 5 minutes.
+func HMACSHA256(secret []byte, tolerance time.Duration) VerifyFunc {
+	if tolerance == 0 {
+		tolerance = defaultTolerance
+	}
+	return func(r *http.Request, body []byte) error {
+		timestamp := r.Header.Get("Webhook-Timestamp")
+		if err := checkTimestamp(timestamp, tolerance); err != nil {
+			return err
+		}
+		signature, ok := strings.CutPrefix(r.Header.Get("Webhook-Signature"), "sha256=")
+		signed := append([]byte(timestamp+"."+r.PathValue("topic")+"."), body...)
+		if !ok || !validMAC(secret, signed, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+}
+
+// GitHub returns a VerifyFunc checking the X-Hub-Signature-256 header of the GitHub webhooks. The
+// signature covers the body only, so the topic of the requests must match one of the patterns, see
+// pubsub.Match, every request is rejected without patterns.
+func GitHub(secret []byte, patterns ...string) VerifyFunc {
+	return func(r *http.Request, body []byte) error {
+		signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok || !validMAC(secret, body, signature) {
+			return ErrInvalidSignature
+		}
+		return allowTopic(r, patterns)
+	}
+}
+
+// Stripe returns a VerifyFunc checking the Stripe-Signature header of the Stripe webhooks, and that
+// they were signed less than tolerance ago. The tolerance defaults to 5 minutes. The signature
+// doesn't cover the topic, so it must match one of the patterns, see pubsub.Match, every request is
+// rejected without patterns.
+func Stripe(secret []byte, tolerance time.Duration, patterns ...string) VerifyFunc {
+	if tolerance == 0 {
+		tolerance = defaultTolerance
+	}
+	return func(r *http.Request, body []byte) error {
+		var timestamp string
+		var signatures []string
+		for _, field := range strings.Split(r.Header.Get("Stripe-Signature"), ",") {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signatures = append(signatures, value)
+			}
+		}
+		if err := checkTimestamp(timestamp, tolerance); err != nil {
+			return err
+		}
+		signed := append([]byte(timestamp+"."), body...)
+		for _, signature := range signatures {
+			if validMAC(secret, signed, signature) {
+				return allowTopic(r, patterns)
+			}
+		}
+		return ErrInvalidSignature
+	}
+}
+
+// checkTimestamp returns an error if the unix time of timestamp isn't within tolerance of now.
+func checkTimestamp(timestamp string, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+// allowTopic returns ErrTopicNotAllowed unless the topic of r matches one of the patterns.
+func allowTopic(r *http.Request, patterns []string) error {
+	topic := r.PathValue("topic")
+	for _, pattern := range patterns {
+		if pubsub.Match(pattern, topic) {
+			return nil
+		}
+	}
+	return ErrTopicNotAllowed
+}
+
+// validMAC returns true if signature is the hex encoded HMAC-SHA256 of message.
+func validMAC(secret []byte, message []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(message)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// Handler publishes the JSON body of the webhooks to the topic of their path. Mount it under a
+// prefix with http.StripPrefix:
+//
+//	POST /publish/{topic...}    publishes the body to the topic, e.g. /publish/payments/stripe
+//
+// It answers 202 once the body is published, 401 when its signature is invalid, 400 when it isn't
+// JSON or the topic is invalid, and 403 when the topic isn't allowed for the secret or the broker
+// forbids it, e.g. a pubsub.Authorized broker checking the topics allowed for the webhooks.
+type Handler struct {
+	Broker pubsub.Broker
+	// Verify checks the signature of the requests, e.g. with GitHub, Stripe or HMACSHA256. Every
+	// request is rejected with 401 when it is nil.
+	Verify VerifyFunc
+	// MaxBodySize is the size limit of the bodies, it defaults to 1MB.
+	MaxBodySize int64
+
+	once sync.Once
+	mux  *http.ServeMux
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(func() {
+		h.mux = http.NewServeMux()
+		h.mux.HandleFunc("POST /publish/{topic...}", h.publish)
+	})
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) publish(w http.ResponseWriter, r *http.Request) {
+	maxBodySize := h.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			sendError(w, http.StatusRequestEntityTooLarge, "body too large")
+			return
+		}
+		sendError(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+
+	if h.Verify == nil {
+		sendError(w, http.StatusUnauthorized, "no verification configured")
+		return
+	}
+	switch err := h.Verify(r, body); {
+	case errors.Is(err, ErrTopicNotAllowed):
+		sendError(w, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		sendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if !json.Valid(body) {
+		sendError(w, http.StatusBadRequest, "body isn't JSON")
+		return
+	}
+
+	topic := r.PathValue("topic")
+	if topic == "" {
+		sendError(w, http.StatusBadRequest, "missing topic")
+		return
+	}
+	err = h.Broker.Publish(r.Context(), topic, body)
+	switch {
+	case err == nil:
+		sendJSON(w, http.StatusAccepted, map[string]string{"topic": topic})
+	case errors.Is(err, pubsub.ErrInvalidTopic):
+		sendError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, pubsub.ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	default:
+		sendError(w, http.StatusBadGateway, "publish failed")
+	}
+}
+
+func sendJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func sendError(w http.ResponseWriter, code int, message string) {
+	sendJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = []byte("whsec_test")
+
+func sign(message string) string {
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func post(h http.Handler, path string, body string, header http.Header) (int, map[string]string) {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var response map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := pubsub.NewMemory()
+	events, err := broker.Subscribe(ctx, "github/#")
+	assert.NoError(t, err)
+	h := &Handler{Broker: broker, Verify: GitHub(testSecret, "github/#"), MaxBodySize: 64}
+
+	body := `{"action":"opened"}`
+	code, response := post(h, "/publish/github/pulls", body, http.Header{"X-Hub-Signature-256": {"sha256=" + sign(body)}})
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, map[string]string{"topic": "github/pulls"}, response)
+	select {
+	case msg := <-events:
+		assert.Equal(t, pubsub.Message{Topic: "github/pulls", Payload: json.RawMessage(body)}, msg)
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+
+	code, response = post(h, "/publish/github/pulls", body, http.Header{"X-Hub-Signature-256": {"sha256=" + sign("{}")}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ErrInvalidSignature.Error(), response["error"])
+	code, _ = post(h, "/publish/github/pulls", "not json", http.Header{"X-Hub-Signature-256": {"sha256=" + sign("not json")}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = post(h, "/publish/github/+", body, http.Header{"X-Hub-Signature-256": {"sha256=" + sign(body)}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, response = post(h, "/publish/payments", body, http.Header{"X-Hub-Signature-256": {"sha256=" + sign(body)}})
+	assert.Equal(t, http.StatusForbidden, code, "Expected a request replayed to another topic to be rejected")
+	assert.Equal(t, ErrTopicNotAllowed.Error(), response["error"])
+	large := `{"padding":"` + strings.Repeat("x", 64) + `"}`
+	code, _ = post(h, "/publish/github/pulls", large, http.Header{"X-Hub-Signature-256": {"sha256=" + sign(large)}})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	code, _ = post(h, "/other", body, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = post(&Handler{Broker: broker}, "/publish/github/pulls", body, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func signHMACSHA256(timestamp time.Time, topic string, body string) http.Header {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return http.Header{
+		"Webhook-Timestamp": {t},
+		"Webhook-Signature": {"sha256=" + sign(t+"."+topic+"."+body)},
+	}
+}
+
+func TestHandlerForbidden(t *testing.T) {
+	authorizer := &pubsub.Authorizer{DenyUnmatched: true}
+	authorizer.AuthorizePublish("webhooks/#", func(ctx context.Context, topic string) error { return nil })
+	h := &Handler{
+		Broker: pubsub.Authorized{Broker: pubsub.NewMemory(), Authorizer: authorizer},
+		Verify: HMACSHA256(testSecret, 0),
+	}
+	body := `{}`
+	code, _ := post(h, "/publish/orders/1", body, signHMACSHA256(time.Now(), "orders/1", body))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = post(h, "/publish/webhooks/orders", body, signHMACSHA256(time.Now(), "webhooks/orders", body))
+	assert.Equal(t, http.StatusAccepted, code)
+}
+
+func TestHMACSHA256(t *testing.T) {
+	h := &Handler{Broker: pubsub.NewMemory(), Verify: HMACSHA256(testSecret, time.Minute)}
+	body := `{"id":1}`
+
+	code, _ := post(h, "/publish/orders", body, signHMACSHA256(time.Now(), "orders", body))
+	assert.Equal(t, http.StatusAccepted, code)
+	code, response := post(h, "/publish/payments", body, signHMACSHA256(time.Now(), "orders", body))
+	assert.Equal(t, http.StatusUnauthorized, code, "Expected the signature to cover the topic")
+	assert.Equal(t, ErrInvalidSignature.Error(), response["error"])
+	code, response = post(h, "/publish/orders", body, signHMACSHA256(time.Now().Add(-2*time.Minute), "orders", body))
+	assert.Equal(t, http.StatusUnauthorized, code, "Expected a request replayed later to be rejected")
+	assert.Equal(t, ErrExpiredSignature.Error(), response["error"])
+
+	header := signHMACSHA256(time.Now(), "orders", body)
+	header.Set("Webhook-Timestamp", strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10))
+	code, _ = post(h, "/publish/orders", body, header)
+	assert.Equal(t, http.StatusUnauthorized, code, "Expected the signature to cover the timestamp")
+	code, _ = post(h, "/publish/orders", body, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestStripe(t *testing.T) {
+	verify := Stripe(testSecret, 0, "stripe")
+	body := []byte(`{"type":"payment_intent.succeeded"}`)
+	request := func(timestamp time.Time, signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/publish/stripe", nil)
+		r.SetPathValue("topic", "stripe")
+		t := strconv.FormatInt(timestamp.Unix(), 10)
+		if signature == "" {
+			signature = sign(t + "." + string(body))
+		}
+		r.Header.Set("Stripe-Signature", "t="+t+",v1="+sign("rotated")+",v1="+signature)
+		return r
+	}
+
+	assert.NoError(t, verify(request(time.Now(), ""), body))
+	assert.Equal(t, ErrInvalidSignature, verify(request(time.Now(), sign("other")), body))
+	assert.Equal(t, ErrExpiredSignature, verify(request(time.Now().Add(-time.Hour), ""), body))
+
+	r := request(time.Now(), "")
+	r.SetPathValue("topic", "stripe/refunds")
+	assert.Equal(t, ErrTopicNotAllowed, verify(r, body))
+	assert.Equal(t, ErrTopicNotAllowed, Stripe(testSecret, 0)(request(time.Now(), ""), body))
+}
@@ -0,0 +1,140 @@
+// Package redis adapts a Redis client to the cluster, resumption and presence features. They send
+// their commands through the Client interface, implemented with the client library of the
+// application, e.g. github.com/redis/go-redis or github.com/gomodule/redigo, so that its
+// connection pooling, TLS, ACL and Sentinel or cluster support apply.
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNil is returned by the typed helpers when the server replies with a nil bulk string.
+var ErrNil = errors.New("redis: nil reply")
+
+var errUnexpectedScanReply = errors.New("redis: unexpected SCAN reply")
+
+// Message is a message received on a subscribed channel.
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// Client sends the commands of the package users to a Redis server, it must be safe for
+// concurrent use. With go-redis, Do is client.Do(ctx, args...).Result() with redis.Nil replaced
+// by a nil reply, and Subscribe forwards the messages of client.Subscribe.
+type Client interface {
+	// Do sends a command whose arguments are strings, []byte, int or int64. The replies are nil,
+	// int64, bulk strings as string or []byte, and arrays as []interface{} of those, the error
+	// replies are returned as errors.
+	Do(ctx context.Context, args ...interface{}) (interface{}, error)
+	// Subscribe subscribes to channels, the messages published once it returns are received. The
+	// returned channel is closed when ctx is done or the subscription fails.
+	Subscribe(ctx context.Context, channels ...string) (<-chan Message, error)
+}
+
+// String converts a reply to a string, ErrNil is returned for nil replies.
+func String(reply interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v := reply.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case nil:
+		return "", ErrNil
+	default:
+		return "", fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+}
+
+// Int64 converts an integer reply.
+func Int64(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case nil:
+		return 0, ErrNil
+	default:
+		return 0, fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+}
+
+// Values converts an array reply.
+func Values(reply interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch v := reply.(type) {
+	case []interface{}:
+		return v, nil
+	case nil:
+		return nil, ErrNil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+}
+
+// Strings converts an array reply of bulk strings, nil items become empty strings.
+func Strings(reply interface{}, err error) ([]string, error) {
+	values, err := Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i], _ = String(v, nil)
+	}
+	return result, nil
+}
+
+// Scan returns the keys matching a glob pattern, see GlobEscape, iterating SCAN over the whole
+// keyspace.
+func Scan(ctx context.Context, client Client, pattern string) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := Values(client.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+		if err != nil {
+			return nil, err
+		}
+		if len(reply) != 2 {
+			return nil, errUnexpectedScanReply
+		}
+		batch, err := Strings(reply[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		cursor, _ = String(reply[0], nil)
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// GlobEscape escapes the characters of s matching other keys in a glob pattern, e.g. of SCAN.
+func GlobEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/redis"
+	"github.com/annibuliful-lab/graphqlws-subscription/redis/redistest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplies(t *testing.T) {
+	s, err := redis.String([]byte("value"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", s)
+	_, err = redis.String(nil, nil)
+	assert.Equal(t, redis.ErrNil, err)
+	_, err = redis.String(int64(1), nil)
+	assert.Error(t, err)
+
+	n, err := redis.Int64([]byte("42"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+
+	strings, err := redis.Strings([]interface{}{"a", []byte("b"), nil}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", ""}, strings)
+
+	unavailable := errors.New("connection refused")
+	_, err = redis.Values(nil, unavailable)
+	assert.Equal(t, unavailable, err)
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	client := redistest.NewClient()
+	for _, key := range []string{"a*:1", "a*:2", "ab:3"} {
+		_, err := client.Do(ctx, "SET", key, "value")
+		assert.NoError(t, err)
+	}
+
+	keys, err := redis.Scan(ctx, client, redis.GlobEscape("a*:")+"*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a*:1", "a*:2"}, keys)
+	assert.Equal(t, `a\*b\?\[c\]\\`, redis.GlobEscape(`a*b?[c]\`))
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := redistest.NewClient()
+
+	messages, err := client.Subscribe(ctx, "events")
+	assert.NoError(t, err)
+	n, err := redis.Int64(client.Do(ctx, "PUBLISH", "events", "hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, redis.Message{Channel: "events", Payload: "hello"}, <-messages)
+
+	cancel()
+	_, open := <-messages
+	assert.False(t, open)
+}
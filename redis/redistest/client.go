@@ -0,0 +1,573 @@
+// Package redistest provides an in-memory redis.Client implementing enough commands to test the
+// features built on the redis package.
+package redistest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/redis"
+)
+
+// Client is an in-memory redis.Client, the clients of several nodes share one in tests.
+type Client struct {
+	mu            sync.Mutex
+	values        map[string]string
+	streams       map[string]*stream
+	hashes        map[string]map[string]string
+	zsets         map[string]map[string]float64
+	expires       map[string]time.Time
+	subscriptions map[*subscription]struct{}
+}
+
+var _ redis.Client = &Client{}
+
+// NewClient returns an empty client.
+func NewClient() *Client {
+	return &Client{
+		values:        map[string]string{},
+		streams:       map[string]*stream{},
+		hashes:        map[string]map[string]string{},
+		zsets:         map[string]map[string]float64{},
+		expires:       map[string]time.Time{},
+		subscriptions: map[*subscription]struct{}{},
+	}
+}
+
+// Get returns the value of a key, for assertions in tests.
+func (c *Client) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key)
+}
+
+// FastForward moves the clock of key expiry forward.
+func (c *Client) FastForward(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, at := range c.expires {
+		c.expires[key] = at.Add(-d)
+	}
+}
+
+// Do implements redis.Client
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("ERR empty command")
+	}
+	cmd := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			cmd[i] = v
+		case []byte:
+			cmd[i] = string(v)
+		case int:
+			cmd[i] = strconv.Itoa(v)
+		case int64:
+			cmd[i] = strconv.FormatInt(v, 10)
+		default:
+			return nil, fmt.Errorf("ERR unsupported argument type %T", arg)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exec(strings.ToUpper(cmd[0]), cmd[1:])
+}
+
+// Subscribe implements redis.Client
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (<-chan redis.Message, error) {
+	sub := &subscription{channels: channels, ready: make(chan struct{}, 1)}
+	c.mu.Lock()
+	c.subscriptions[sub] = struct{}{}
+	c.mu.Unlock()
+
+	messages := make(chan redis.Message)
+	go func() {
+		defer close(messages)
+		defer func() {
+			c.mu.Lock()
+			delete(c.subscriptions, sub)
+			c.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-sub.ready:
+			case <-ctx.Done():
+				return
+			}
+			for _, m := range sub.take() {
+				select {
+				case messages <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return messages, nil
+}
+
+// subscription queues the messages of its channels, so that PUBLISH doesn't wait for them to be
+// received.
+type subscription struct {
+	channels []string
+	ready    chan struct{}
+
+	mu    sync.Mutex
+	queue []redis.Message
+}
+
+func (s *subscription) push(m redis.Message) {
+	s.mu.Lock()
+	s.queue = append(s.queue, m)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) take() []redis.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.queue
+	s.queue = nil
+	return queue
+}
+
+func (c *Client) get(key string) (string, bool) {
+	c.expire(key)
+	v, ok := c.values[key]
+	return v, ok
+}
+
+func (c *Client) expire(key string) {
+	if at, ok := c.expires[key]; ok && !time.Now().Before(at) {
+		c.del(key)
+	}
+}
+
+func (c *Client) del(key string) {
+	delete(c.values, key)
+	delete(c.streams, key)
+	delete(c.hashes, key)
+	delete(c.zsets, key)
+	delete(c.expires, key)
+}
+
+func (c *Client) exists(key string) bool {
+	c.expire(key)
+	_, isValue := c.values[key]
+	_, isStream := c.streams[key]
+	_, isHash := c.hashes[key]
+	_, isZSet := c.zsets[key]
+	return isValue || isStream || isHash || isZSet
+}
+
+func (c *Client) keys(pattern string) []string {
+	all := map[string]struct{}{}
+	for key := range c.values {
+		all[key] = struct{}{}
+	}
+	for key := range c.streams {
+		all[key] = struct{}{}
+	}
+	for key := range c.hashes {
+		all[key] = struct{}{}
+	}
+	for key := range c.zsets {
+		all[key] = struct{}{}
+	}
+
+	var keys []string
+	for key := range all {
+		if !c.exists(key) {
+			continue
+		}
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var errSyntax = errors.New("ERR syntax error")
+
+func (c *Client) exec(cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "PING":
+		return "PONG", nil
+	case "SET":
+		if len(args) < 2 {
+			return nil, errSyntax
+		}
+		c.del(args[0])
+		c.values[args[0]] = args[1]
+		for i := 2; i+1 < len(args); i += 2 {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			switch strings.ToUpper(args[i]) {
+			case "PX":
+				c.expires[args[0]] = time.Now().Add(time.Duration(n) * time.Millisecond)
+			case "EX":
+				c.expires[args[0]] = time.Now().Add(time.Duration(n) * time.Second)
+			}
+		}
+		return "OK", nil
+	case "GET":
+		if v, ok := c.get(args[0]); ok {
+			return v, nil
+		}
+		return nil, nil
+	case "MGET":
+		values := make([]interface{}, len(args))
+		for i, key := range args {
+			if v, ok := c.get(key); ok {
+				values[i] = v
+			}
+		}
+		return values, nil
+	case "DEL":
+		var n int64
+		for _, key := range args {
+			if c.exists(key) {
+				n++
+			}
+			c.del(key)
+		}
+		return n, nil
+	case "PEXPIRE":
+		if !c.exists(args[0]) {
+			return int64(0), nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, err
+		}
+		c.expires[args[0]] = time.Now().Add(time.Duration(n) * time.Millisecond)
+		return int64(1), nil
+	case "PEXPIREAT":
+		if !c.exists(args[0]) {
+			return int64(0), nil
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		c.expires[args[0]] = time.UnixMilli(n)
+		return int64(1), nil
+	case "SCAN":
+		pattern := "*"
+		for i := 1; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		return []interface{}{"0", toValues(c.keys(pattern))}, nil
+	case "PUBLISH":
+		var n int64
+		for sub := range c.subscriptions {
+			for _, channel := range sub.channels {
+				if channel == args[0] {
+					sub.push(redis.Message{Channel: args[0], Payload: args[1]})
+					n++
+				}
+			}
+		}
+		return n, nil
+	case "HSET", "HDEL", "HMGET":
+		return c.hash(cmd, args)
+	case "ZADD", "ZREM", "ZRANGE", "ZRANGEBYSCORE", "ZREMRANGEBYSCORE":
+		return c.zset(cmd, args)
+	case "XADD":
+		return c.xadd(args)
+	case "XRANGE":
+		return c.xrange(args)
+	default:
+		return nil, fmt.Errorf("ERR unknown command '%s'", cmd)
+	}
+}
+
+func toValues(items []string) []interface{} {
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		values[i] = item
+	}
+	return values
+}
+
+type stream struct {
+	lastID  int64
+	entries []streamEntry
+}
+
+type streamEntry struct {
+	id     int64
+	fields []string
+}
+
+// streamID formats ids as <sequence>-0, the fake client doesn't use timestamps.
+func streamID(n int64) string {
+	return strconv.FormatInt(n, 10) + "-0"
+}
+
+func parseStreamID(id string) (int64, error) {
+	ms, _, _ := strings.Cut(id, "-")
+	return strconv.ParseInt(ms, 10, 64)
+}
+
+func (c *Client) xadd(args []string) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, errSyntax
+	}
+	key := args[0]
+	args = args[1:]
+
+	maxLen := -1
+	if strings.ToUpper(args[0]) == "MAXLEN" {
+		args = args[1:]
+		if args[0] == "~" || args[0] == "=" {
+			args = args[1:]
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, err
+		}
+		maxLen = n
+		args = args[1:]
+	}
+	if len(args) < 3 || args[0] != "*" || len(args[1:])%2 != 0 {
+		return nil, errSyntax
+	}
+
+	c.expire(key)
+	st := c.streams[key]
+	if st == nil {
+		st = &stream{}
+		c.streams[key] = st
+	}
+	st.lastID++
+	st.entries = append(st.entries, streamEntry{id: st.lastID, fields: append([]string(nil), args[1:]...)})
+	if maxLen >= 0 && len(st.entries) > maxLen {
+		st.entries = st.entries[len(st.entries)-maxLen:]
+	}
+	return streamID(st.lastID), nil
+}
+
+func (c *Client) xrange(args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errSyntax
+	}
+
+	bound := func(id string, open int64) (int64, bool, error) {
+		switch id {
+		case "-", "+":
+			return open, false, nil
+		}
+		exclusive := strings.HasPrefix(id, "(")
+		n, err := parseStreamID(strings.TrimPrefix(id, "("))
+		return n, exclusive, err
+	}
+	start, startExclusive, err := bound(args[1], 0)
+	if err != nil {
+		return nil, err
+	}
+	end, endExclusive, err := bound(args[2], 1<<62)
+	if err != nil {
+		return nil, err
+	}
+
+	c.expire(args[0])
+	entries := []interface{}{}
+	if st := c.streams[args[0]]; st != nil {
+		for _, e := range st.entries {
+			if e.id < start || (startExclusive && e.id == start) || e.id > end || (endExclusive && e.id == end) {
+				continue
+			}
+			entries = append(entries, []interface{}{streamID(e.id), toValues(e.fields)})
+		}
+	}
+	return entries, nil
+}
+
+func (c *Client) hash(cmd string, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errSyntax
+	}
+	c.expire(args[0])
+	h := c.hashes[args[0]]
+	switch cmd {
+	case "HSET":
+		if len(args[1:])%2 != 0 {
+			return nil, errSyntax
+		}
+		if h == nil {
+			h = map[string]string{}
+			c.hashes[args[0]] = h
+		}
+		var n int64
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				n++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return n, nil
+	case "HDEL":
+		var n int64
+		for _, field := range args[1:] {
+			if _, ok := h[field]; ok {
+				delete(h, field)
+				n++
+			}
+		}
+		if h != nil && len(h) == 0 {
+			c.del(args[0])
+		}
+		return n, nil
+	default:
+		values := make([]interface{}, len(args)-1)
+		for i, field := range args[1:] {
+			if v, ok := h[field]; ok {
+				values[i] = v
+			}
+		}
+		return values, nil
+	}
+}
+
+// scoreBound parses a bound of ZRANGEBYSCORE, "(" makes it exclusive.
+func scoreBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	score, err := strconv.ParseFloat(strings.TrimPrefix(bound, "("), 64)
+	return score, exclusive, err
+}
+
+func (c *Client) zset(cmd string, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errSyntax
+	}
+	c.expire(args[0])
+	z := c.zsets[args[0]]
+	switch cmd {
+	case "ZADD":
+		if len(args[1:])%2 != 0 {
+			return nil, errSyntax
+		}
+		if z == nil {
+			z = map[string]float64{}
+			c.zsets[args[0]] = z
+		}
+		var n int64
+		for i := 1; i+1 < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := z[args[i+1]]; !ok {
+				n++
+			}
+			z[args[i+1]] = score
+		}
+		return n, nil
+	case "ZREM":
+		var n int64
+		for _, member := range args[1:] {
+			if _, ok := z[member]; ok {
+				delete(z, member)
+				n++
+			}
+		}
+		if z != nil && len(z) == 0 {
+			c.del(args[0])
+		}
+		return n, nil
+	}
+
+	// the members sorted by score, then member
+	members := make([]string, 0, len(z))
+	for member := range z {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if z[members[i]] != z[members[j]] {
+			return z[members[i]] < z[members[j]]
+		}
+		return members[i] < members[j]
+	})
+
+	if cmd == "ZRANGE" {
+		if len(args) < 3 {
+			return nil, errSyntax
+		}
+		start, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, err
+		}
+		stop, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if start < 0 {
+			start += len(members)
+		}
+		if stop < 0 {
+			stop += len(members)
+		}
+		start, stop = max(start, 0), min(stop, len(members)-1)
+		withScores := len(args) > 3 && strings.ToUpper(args[3]) == "WITHSCORES"
+		reply := []interface{}{}
+		for i := start; i <= stop; i++ {
+			reply = append(reply, members[i])
+			if withScores {
+				reply = append(reply, strconv.FormatFloat(z[members[i]], 'f', -1, 64))
+			}
+		}
+		return reply, nil
+	}
+
+	if len(args) < 3 {
+		return nil, errSyntax
+	}
+	min, minExclusive, err := scoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, maxExclusive, err := scoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, member := range members {
+		score := z[member]
+		if score < min || (minExclusive && score == min) || score > max || (maxExclusive && score == max) {
+			continue
+		}
+		matched = append(matched, member)
+	}
+	if cmd == "ZRANGEBYSCORE" {
+		return toValues(matched), nil
+	}
+	for _, member := range matched {
+		delete(z, member)
+	}
+	if z != nil && len(z) == 0 {
+		c.del(args[0])
+	}
+	return int64(len(matched)), nil
+}
@@ -0,0 +1,246 @@
+// Package rooms groups the subscriptions of the transport in logical rooms, e.g. the chat
+// channels, the documents or the matches of an application, so that the resolvers join a room
+// and the mutations publish to every member of it.
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+// eventTimeout bounds the publication of the Left events of the members whose context is done.
+const eventTimeout = 5 * time.Second
+
+var (
+	// ErrInvalidRoom is returned for the empty rooms and the rooms with an empty level or a
+	// wildcard, see pubsub.Match.
+	ErrInvalidRoom = errors.New("rooms: invalid room")
+	// ErrNotMember is returned when leaving a room the subscription didn't join.
+	ErrNotMember = errors.New("rooms: not a member")
+)
+
+// Member identifies a subscription in a room.
+type Member struct {
+	// ConnectionID is the id of the websocket connection of the subscription.
+	ConnectionID string `json:"connectionId"`
+	// OperationID is the id of the subscription on its connection.
+	OperationID string `json:"operationId"`
+	// UserID is the user of the subscription, it is set by a MemberFunc.
+	UserID string `json:"userId,omitempty"`
+}
+
+// EventType is the kind of a membership event.
+type EventType string
+
+const (
+	Joined EventType = "joined"
+	Left   EventType = "left"
+)
+
+// Event is published when a member joins or leaves a room.
+type Event struct {
+	Type   EventType `json:"type"`
+	Room   string    `json:"room"`
+	Member Member    `json:"member"`
+}
+
+type membership struct {
+	cancel context.CancelFunc
+}
+
+// Rooms tracks the members of the rooms of the process and publishes the messages and the
+// membership events of the rooms to a Broker, so that the rooms span the nodes of a cluster when
+// the broker does.
+//
+// The messages of a room are published to the topic "<prefix><room>/messages" and its
+// membership events to "<prefix><room>/members". The members are those of the process, a
+// member leaves its rooms when the context of its subscription is done.
+type Rooms struct {
+	Broker pubsub.Broker
+	// Prefix is the prefix of the topics of the rooms, it defaults to "rooms/".
+	Prefix string
+	// MemberFunc returns the member of a subscription context, it defaults to the ids of the
+	// connection and of the operation of the transport.
+	MemberFunc func(ctx context.Context) Member
+	// ErrorFunc is called with the failures to publish the membership events.
+	ErrorFunc func(ctx context.Context, err error)
+
+	mu    sync.Mutex
+	rooms map[string]map[Member]*membership
+}
+
+// New returns the rooms of broker.
+func New(broker pubsub.Broker) *Rooms {
+	return &Rooms{Broker: broker}
+}
+
+// Join adds the subscription of ctx to a room and returns the messages published to the room
+// until ctx is done or the subscription leaves the room. Joining a room again replaces the
+// previous membership.
+func (r *Rooms) Join(ctx context.Context, room string) (<-chan pubsub.Message, error) {
+	if !validRoom(room) {
+		return nil, ErrInvalidRoom
+	}
+	member := r.member(ctx)
+	if r.remove(room, member, nil) {
+		r.publishEvent(ctx, Event{Type: Left, Room: room, Member: member})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	messages, err := r.Broker.Subscribe(ctx, r.topic(room, "messages"))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	m := &membership{cancel: cancel}
+	r.mu.Lock()
+	if r.rooms == nil {
+		r.rooms = map[string]map[Member]*membership{}
+	}
+	if r.rooms[room] == nil {
+		r.rooms[room] = map[Member]*membership{}
+	}
+	r.rooms[room][member] = m
+	r.mu.Unlock()
+
+	r.publishEvent(ctx, Event{Type: Joined, Room: room, Member: member})
+	context.AfterFunc(ctx, func() {
+		if r.remove(room, member, m) {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventTimeout)
+			defer cancel()
+			r.publishEvent(ctx, Event{Type: Left, Room: room, Member: member})
+		}
+	})
+	return messages, nil
+}
+
+// Leave removes the subscription of ctx from a room and closes the messages of its Join.
+func (r *Rooms) Leave(ctx context.Context, room string) error {
+	member := r.member(ctx)
+	if !r.remove(room, member, nil) {
+		return ErrNotMember
+	}
+	r.publishEvent(ctx, Event{Type: Left, Room: room, Member: member})
+	return nil
+}
+
+// PublishToRoom sends a payload to the members of a room.
+func (r *Rooms) PublishToRoom(ctx context.Context, room string, payload json.RawMessage) error {
+	if !validRoom(room) {
+		return ErrInvalidRoom
+	}
+	return r.Broker.Publish(ctx, r.topic(room, "messages"), payload)
+}
+
+// Events returns the membership events of a room published after the call, until ctx is done.
+// The room may be a pattern, e.g. "documents/+".
+func (r *Rooms) Events(ctx context.Context, room string) (<-chan Event, error) {
+	if room == "" {
+		return nil, ErrInvalidRoom
+	}
+	return pubsub.NewTopic[Event](r.Broker, r.topic(room, "members")).Subscribe(ctx)
+}
+
+// Members returns the members of a room in the process, sorted by connection and operation.
+func (r *Rooms) Members(room string) []Member {
+	r.mu.Lock()
+	members := make([]Member, 0, len(r.rooms[room]))
+	for member := range r.rooms[room] {
+		members = append(members, member)
+	}
+	r.mu.Unlock()
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].ConnectionID != members[j].ConnectionID {
+			return members[i].ConnectionID < members[j].ConnectionID
+		}
+		return members[i].OperationID < members[j].OperationID
+	})
+	return members
+}
+
+// Rooms returns the sorted rooms joined by the subscriptions of a connection.
+func (r *Rooms) Rooms(connectionID string) []string {
+	r.mu.Lock()
+	var rooms []string
+	for room, members := range r.rooms {
+		for member := range members {
+			if member.ConnectionID == connectionID {
+				rooms = append(rooms, room)
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+	sort.Strings(rooms)
+	return rooms
+}
+
+// remove deletes the membership of a member, or m only when it isn't nil, and returns true if
+// it was deleted.
+func (r *Rooms) remove(room string, member Member, m *membership) bool {
+	r.mu.Lock()
+	current, ok := r.rooms[room][member]
+	if !ok || (m != nil && current != m) {
+		r.mu.Unlock()
+		return false
+	}
+	delete(r.rooms[room], member)
+	if len(r.rooms[room]) == 0 {
+		delete(r.rooms, room)
+	}
+	r.mu.Unlock()
+	current.cancel()
+	return true
+}
+
+func (r *Rooms) publishEvent(ctx context.Context, event Event) {
+	b, err := json.Marshal(event)
+	if err == nil {
+		err = r.Broker.Publish(ctx, r.topic(event.Room, "members"), b)
+	}
+	if err != nil && r.ErrorFunc != nil {
+		r.ErrorFunc(ctx, err)
+	}
+}
+
+func (r *Rooms) member(ctx context.Context) Member {
+	if r.MemberFunc != nil {
+		return r.MemberFunc(ctx)
+	}
+	var member Member
+	if info := transport.GetConnectionInfo(ctx); info != nil {
+		member.ConnectionID = info.ID
+	}
+	if info := transport.GetOperationInfo(ctx); info != nil {
+		member.OperationID = info.ID
+	}
+	return member
+}
+
+func (r *Rooms) topic(room string, kind string) string {
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = "rooms/"
+	}
+	return prefix + room + "/" + kind
+}
+
+func validRoom(room string) bool {
+	if room == "" {
+		return false
+	}
+	for _, level := range strings.Split(room, "/") {
+		if level == "" || level == "+" || level == "#" {
+			return false
+		}
+	}
+	return true
+}
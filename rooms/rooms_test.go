@@ -0,0 +1,110 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+type memberKey struct{}
+
+func withMember(ctx context.Context, connectionID string, operationID string) context.Context {
+	return context.WithValue(ctx, memberKey{}, Member{ConnectionID: connectionID, OperationID: operationID})
+}
+
+func newTestRooms() *Rooms {
+	r := New(pubsub.NewMemory())
+	r.MemberFunc = func(ctx context.Context) Member {
+		member, _ := ctx.Value(memberKey{}).(Member)
+		return member
+	}
+	return r
+}
+
+// receive returns the next value of a channel.
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("nothing received")
+	}
+	var zero T
+	return zero
+}
+
+func TestRooms(t *testing.T) {
+	r := newTestRooms()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := r.Events(ctx, "chat/general")
+	assert.NoError(t, err)
+
+	alice, err := r.Join(withMember(ctx, "c1", "1"), "chat/general")
+	assert.NoError(t, err)
+	assert.Equal(t, Event{Type: Joined, Room: "chat/general", Member: Member{ConnectionID: "c1", OperationID: "1"}}, receive(t, events))
+	bobCtx, bobCancel := context.WithCancel(withMember(ctx, "c2", "1"))
+	bob, err := r.Join(bobCtx, "chat/general")
+	assert.NoError(t, err)
+	receive(t, events)
+	_, err = r.Join(withMember(ctx, "c2", "2"), "chat/random")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Member{{ConnectionID: "c1", OperationID: "1"}, {ConnectionID: "c2", OperationID: "1"}}, r.Members("chat/general"))
+	assert.Equal(t, []string{"chat/general", "chat/random"}, r.Rooms("c2"))
+
+	assert.NoError(t, r.PublishToRoom(ctx, "chat/general", json.RawMessage(`{"text":"hi"}`)))
+	assert.JSONEq(t, `{"text":"hi"}`, string(receive(t, alice).Payload))
+	assert.JSONEq(t, `{"text":"hi"}`, string(receive(t, bob).Payload))
+
+	// the members leave their rooms with their subscription
+	bobCancel()
+	assert.Equal(t, Event{Type: Left, Room: "chat/general", Member: Member{ConnectionID: "c2", OperationID: "1"}}, receive(t, events))
+	assert.Equal(t, []Member{{ConnectionID: "c1", OperationID: "1"}}, r.Members("chat/general"))
+
+	assert.NoError(t, r.Leave(withMember(ctx, "c1", "1"), "chat/general"))
+	assert.Equal(t, Left, receive(t, events).Type)
+	for range alice {
+	}
+	assert.Empty(t, r.Members("chat/general"))
+	assert.Equal(t, ErrNotMember, r.Leave(withMember(ctx, "c1", "1"), "chat/general"))
+}
+
+func TestRoomsRejoin(t *testing.T) {
+	r := newTestRooms()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := r.Events(ctx, "+")
+	assert.NoError(t, err)
+
+	member := withMember(ctx, "c1", "1")
+	first, err := r.Join(member, "match")
+	assert.NoError(t, err)
+	receive(t, events)
+	_, err = r.Join(member, "match")
+	assert.NoError(t, err)
+	assert.Equal(t, Left, receive(t, events).Type)
+	assert.Equal(t, Joined, receive(t, events).Type)
+	for range first {
+	}
+	assert.Len(t, r.Members("match"), 1)
+}
+
+func TestInvalidRoom(t *testing.T) {
+	r := newTestRooms()
+	ctx := context.Background()
+	for _, room := range []string{"", "chat/+", "#", "chat//general"} {
+		_, err := r.Join(ctx, room)
+		assert.Equal(t, ErrInvalidRoom, err, room)
+		assert.Equal(t, ErrInvalidRoom, r.PublishToRoom(ctx, room, json.RawMessage(`{}`)), room)
+	}
+}
@@ -2,12 +2,16 @@ package transport
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
+// internalErrorJSON is sent in place of the errors that can't be encoded.
+const internalErrorJSON = `{"message":"internal server error"}`
+
 type gqlResponse struct {
 	Errors     gqlerror.List          `json:"errors,omitempty"`
 	Extensions map[string]interface{} `json:"extensions,omitempty"`
@@ -19,7 +23,7 @@ func SendError(w http.ResponseWriter, code int, errors ...*gqlerror.Error) {
 	w.WriteHeader(code)
 	b, err := json.Marshal(&gqlResponse{Errors: errors})
 	if err != nil {
-		panic(err)
+		b = []byte(`{"errors":[` + internalErrorJSON + `]}`)
 	}
 	_, _ = w.Write(b)
 }
@@ -30,7 +34,24 @@ func SendErrorf(w http.ResponseWriter, code int, format string, args ...interfac
 }
 
 func toGQLError(err error) *gqlerror.Error {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return &gqlerror.Error{
+			Err:        err,
+			Message:    redactedMessage,
+			Extensions: map[string]interface{}{"code": CodeInternalServerError},
+		}
+	}
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		return &gqlerror.Error{
+			Err:        err,
+			Message:    err.Error(),
+			Extensions: map[string]interface{}{"code": CodeForbidden},
+		}
+	}
 	return &gqlerror.Error{
+		Err:     err,
 		Message: err.Error(),
 	}
 }
@@ -0,0 +1,77 @@
+package transport
+
+import "net/http"
+
+// HandlerOption configures the transports of a Handler.
+type HandlerOption func(h *handler)
+
+type handler struct {
+	service   GraphQLService
+	websocket *Websocket
+	sse       *SSE
+	multipart *Multipart
+	fallback  http.Handler
+}
+
+// WithWebsocket serves the websocket upgrades with t, nil disables them.
+func WithWebsocket(t *Websocket) HandlerOption {
+	return func(h *handler) {
+		h.websocket = t
+	}
+}
+
+// WithSSE serves the requests accepting text/event-stream with t, nil disables them.
+func WithSSE(t *SSE) HandlerOption {
+	return func(h *handler) {
+		h.sse = t
+	}
+}
+
+// WithMultipart serves the requests accepting multipart/mixed with t, nil disables them.
+func WithMultipart(t *Multipart) HandlerOption {
+	return func(h *handler) {
+		h.multipart = t
+	}
+}
+
+// WithFallback serves the requests none of the transports supports with fallback, e.g. the
+// queries and mutations of the application.
+func WithFallback(fallback http.Handler) HandlerOption {
+	return func(h *handler) {
+		h.fallback = fallback
+	}
+}
+
+// Handler serves the operations of the service on a single endpoint, with the transport selected
+// from the request: a Websocket for the upgrades, SSE for the requests accepting
+// text/event-stream and Multipart for the requests accepting multipart/mixed. The transports are
+// enabled with their default configuration unless replaced by the options. The other requests
+// are served by the fallback, or answered with 406 Not Acceptable.
+func Handler(service GraphQLService, opts ...HandlerOption) http.Handler {
+	h := &handler{
+		service:   service,
+		websocket: &Websocket{},
+		sse:       &SSE{},
+		multipart: &Multipart{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case h.websocket != nil && IsWebsocketRequest(r):
+		h.websocket.Do(w, r, h.service)
+	case h.sse != nil && h.sse.Supports(r):
+		h.sse.Do(w, r, h.service)
+	case h.multipart != nil && h.multipart.Supports(r):
+		h.multipart.Do(w, r, h.service)
+	case h.fallback != nil:
+		h.fallback.ServeHTTP(w, r)
+	default:
+		SendErrorf(w, http.StatusNotAcceptable, "unsupported transport")
+	}
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsMediaType(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+	assert.False(t, acceptsMediaType(r, "text/event-stream"))
+
+	r.Header.Set("Accept", `multipart/mixed;subscriptionSpec="1.0", application/json`)
+	assert.True(t, acceptsMediaType(r, "multipart/mixed"))
+	assert.True(t, acceptsMediaType(r, "application/json"))
+	assert.False(t, acceptsMediaType(r, "text/event-stream"))
+}
+
+func TestHandler(t *testing.T) {
+	service := testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 1)
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+			close(payloads)
+			return payloads, nil
+		},
+	}
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	upgrader := Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	server := httptest.NewServer(Handler(service, WithWebsocket(&Websocket{Upgrader: upgrader}), WithFallback(fallback)))
+	defer server.Close()
+
+	post := func(accept string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{"query":"subscription { value }"}`))
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		resp.Body.Close()
+		return resp
+	}
+	assert.Equal(t, "text/event-stream; charset=utf-8", post("text/event-stream").Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(post("multipart/mixed").Header.Get("Content-Type"), "multipart/mixed"))
+	assert.Equal(t, http.StatusTeapot, post("application/json").StatusCode)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	server = httptest.NewServer(Handler(service, WithSSE(nil)))
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+	}
+}
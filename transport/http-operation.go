@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxOperationBodySize bounds the bodies of the operations requested over HTTP.
+const maxOperationBodySize = 1 << 20
+
+// acceptsMediaType returns true if the Accept header of the request lists the media type.
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	for _, header := range r.Header.Values("Accept") {
+		for _, accepted := range strings.Split(header, ",") {
+			if t, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil && t == mediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeHTTPOperation decodes the operation of a request served by the streaming HTTP transports:
+// from the query string of the GET requests, or from the JSON body of the POST requests.
+func decodeHTTPOperation(w http.ResponseWriter, r *http.Request) (*startMessagePayload, error) {
+	var params startMessagePayload
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		fields := map[string]interface{}{
+			"query":         query.Get("query"),
+			"operationName": query.Get("operationName"),
+		}
+		for _, name := range []string{"variables", "extensions"} {
+			if value := query.Get(name); value != "" {
+				fields[name] = json.RawMessage(value)
+			}
+		}
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return nil, errors.New("invalid variables or extensions")
+		}
+		if err := jsonDecode(b, &params); err != nil {
+			return nil, errors.New("invalid variables or extensions")
+		}
+	case http.MethodPost:
+		if err := jsonDecodeReader(http.MaxBytesReader(w, r.Body, maxOperationBodySize), &params); err != nil {
+			return nil, errors.New("invalid json")
+		}
+	default:
+		return nil, errors.New("unsupported method " + r.Method)
+	}
+	if params.Query == "" {
+		return nil, errors.New("missing query")
+	}
+	return &params, nil
+}
+
+// startHTTPOperation starts an operation of a streaming HTTP transport, or answers the request
+// with the error preventing it to start.
+func startHTTPOperation(w http.ResponseWriter, r *http.Request, service GraphQLService) (context.Context, context.CancelFunc, <-chan interface{}, bool) {
+	params, err := decodeHTTPOperation(w, r)
+	if err != nil {
+		SendErrorf(w, http.StatusBadRequest, "%s", err)
+		return nil, nil, nil, false
+	}
+
+	ctx := r.Context()
+	if params.Extensions.all != nil {
+		ctx = withOperationExtensions(ctx, params.Extensions.all)
+	}
+	ctx = withOperationInfo(ctx, newOperationInfo("", params))
+	ctx = withSubscriptionErrorContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	payloads, err := service.Subscribe(ctx, params.Query, params.OperationName, params.Variables)
+	if err != nil {
+		cancel()
+		SendError(w, http.StatusBadRequest, toGQLError(err))
+		return nil, nil, nil, false
+	}
+	return ctx, cancel, payloads, true
+}
+
+// pumpHTTPOperation writes the encoded payloads of an operation until it completes or the client
+// goes away, heartbeat is called when no payload was written for the interval. The payloads are
+// drained once it returns.
+func pumpHTTPOperation(ctx context.Context, cancel context.CancelFunc, payloads <-chan interface{}, interval time.Duration, write func(payload []byte) error, heartbeat func() error) {
+	defer func() {
+		cancel()
+		for range payloads { // drain input channel
+		}
+	}()
+
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			if err := heartbeat(); err != nil {
+				return
+			}
+		case payload, more := <-payloads:
+			if !more {
+				return
+			}
+			b, err := marshalPayload(payload)
+			if err != nil {
+				AddSubscriptionError(ctx, toGQLError(err))
+				return
+			}
+			if err := write(b); err != nil {
+				return
+			}
+		}
+	}
+}
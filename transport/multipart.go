@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	defaultMultipartHeartbeatInterval = 5 * time.Second
+
+	multipartBoundary = "graphql"
+)
+
+// Multipart serves the operations over multipart/mixed responses, following the multipart
+// subscription protocol of the Apollo clients: every payload is sent in a {"payload": ...} part,
+// and empty {} parts keep the idle responses open, see
+// https://www.apollographql.com/docs/graphos/routing/operations/subscriptions/multipart-protocol
+type Multipart struct {
+	// HeartbeatInterval is the interval of the heartbeat parts, it defaults to 5 seconds. A
+	// negative interval disables them.
+	HeartbeatInterval time.Duration
+}
+
+// Supports returns true if the request accepts multipart/mixed responses.
+func (t Multipart) Supports(r *http.Request) bool {
+	return acceptsMediaType(r, "multipart/mixed")
+}
+
+// Do serves an operation over a multipart response.
+func (t Multipart) Do(w http.ResponseWriter, r *http.Request, service GraphQLService) {
+	ctx, cancel, payloads, ok := startHTTPOperation(w, r, service)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", `multipart/mixed; boundary="`+multipartBoundary+`"; subscriptionSpec="1.0"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	var buf bytes.Buffer
+	writePart := func(part []byte) error {
+		buf.Reset()
+		buf.WriteString("\r\n--" + multipartBoundary + "\r\nContent-Type: application/json; charset=utf-8\r\n\r\n")
+		buf.Write(part)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	interval := t.HeartbeatInterval
+	if interval == 0 {
+		interval = defaultMultipartHeartbeatInterval
+	}
+	pumpHTTPOperation(ctx, cancel, payloads, interval, func(payload []byte) error {
+		return writePart(append(append([]byte(`{"payload":`), payload...), '}'))
+	}, func() error {
+		return writePart([]byte("{}"))
+	})
+
+	if r.Context().Err() != nil {
+		return
+	}
+	if errs := getSubscriptionError(ctx); len(errs) != 0 {
+		b, err := json.Marshal(map[string]interface{}{"payload": &gqlResponse{Errors: gqlerror.List(errs)}})
+		if err != nil {
+			b = []byte(`{"payload":{"errors":[` + internalErrorJSON + `]}}`)
+		}
+		_ = writePart(b)
+	}
+	_, _ = w.Write([]byte("\r\n--" + multipartBoundary + "--\r\n"))
+	_ = rc.Flush()
+}
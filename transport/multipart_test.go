@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestMultipart(t *testing.T) {
+	service := testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 2)
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 2}}
+			close(payloads)
+			AddSubscriptionError(ctx, gqlerror.Errorf("ended"))
+			return payloads, nil
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Multipart{}.Do(w, r, service)
+	}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"query":"subscription { value }"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+	assert.Equal(t, "1.0", params["subscriptionspec"])
+
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "application/json; charset=utf-8", part.Header.Get("Content-Type"))
+		b, _ := io.ReadAll(part)
+		parts = append(parts, string(b))
+	}
+	assert.Equal(t, []string{
+		`{"payload":{"data":{"value":1}}}`,
+		`{"payload":{"data":{"value":2}}}`,
+		`{"payload":{"errors":[{"message":"ended"}]}}`,
+	}, parts)
+}
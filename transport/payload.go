@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// SharedPayload is a payload fanned out to many operations. It is encoded once, the first time
+// it is written, and the encoding is reused by every connection it is written to.
+type SharedPayload struct {
+	value interface{}
+
+	jsonOnce sync.Once
+	json     []byte
+	jsonErr  error
+}
+
+var _ json.Marshaler = &SharedPayload{}
+
+// NewSharedPayload wraps v, it returns v unchanged if it is already a SharedPayload.
+func NewSharedPayload(v interface{}) *SharedPayload {
+	if p, ok := v.(*SharedPayload); ok {
+		return p
+	}
+	return &SharedPayload{value: v}
+}
+
+// Value returns the wrapped payload.
+func (p *SharedPayload) Value() interface{} {
+	return p.value
+}
+
+// MarshalJSON implements json.Marshaler, the encoding is computed once.
+func (p *SharedPayload) MarshalJSON() ([]byte, error) {
+	return p.bytes()
+}
+
+func (p *SharedPayload) bytes() ([]byte, error) {
+	p.jsonOnce.Do(func() {
+		p.json, p.jsonErr = json.Marshal(p.value)
+	})
+	return p.json, p.jsonErr
+}
+
+// marshalPayload encodes a payload received from a GraphQLService. The encoding of shared
+// payloads is copied as it may be modified by the response hooks.
+func marshalPayload(payload interface{}) ([]byte, error) {
+	shared, ok := payload.(*SharedPayload)
+	if !ok {
+		return json.Marshal(payload)
+	}
+
+	b, err := shared.bytes()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingMarshaler struct {
+	calls *int32
+}
+
+func (m countingMarshaler) MarshalJSON() ([]byte, error) {
+	atomic.AddInt32(m.calls, 1)
+	return []byte(`{"data":{"value":1}}`), nil
+}
+
+func TestSharedPayloadEncodesOnce(t *testing.T) {
+	var calls int32
+	p := NewSharedPayload(countingMarshaler{calls: &calls})
+	assert.Same(t, p, NewSharedPayload(p))
+
+	for i := 0; i < 3; i++ {
+		b, err := json.Marshal(p)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"data":{"value":1}}`, string(b))
+
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestMarshalPayloadCopiesSharedEncoding(t *testing.T) {
+	p := NewSharedPayload(map[string]int{"value": 1})
+
+	b, err := marshalPayload(p)
+	assert.NoError(t, err)
+	b[0] = 'x'
+
+	b, err = marshalPayload(p)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"value":1}`, string(b))
+}
+
+func TestSharedPayloadWrittenToEveryConnection(t *testing.T) {
+	shared := NewSharedPayload(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+	server := newTestServer(t, Websocket{}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 1)
+			payloads <- shared
+			return payloads, nil
+		},
+	})
+
+	expected, err := json.Marshal(shared)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+
+		m := readMessageOfType(t, conn, "next")
+		assert.JSONEq(t, string(expected), string(m["payload"]))
+	}
+}
+
+func benchmarkPayload() interface{} {
+	items := make([]map[string]interface{}, 20)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": fmt.Sprint(i), "name": "item", "price": 1.5}
+	}
+	return map[string]interface{}{"data": map[string]interface{}{"items": items}}
+}
+
+const benchmarkFanOut = 1000
+
+// BenchmarkFanOutMarshalPerConnection encodes the payload for every connection, as done for
+// payloads that aren't shared.
+func BenchmarkFanOutMarshalPerConnection(b *testing.B) {
+	payload := benchmarkPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < benchmarkFanOut; j++ {
+			if _, err := marshalPayload(payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkFanOutSharedPayload encodes the payload once for every connection.
+func BenchmarkFanOutSharedPayload(b *testing.B) {
+	payload := benchmarkPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		shared := NewSharedPayload(payload)
+		for j := 0; j < benchmarkFanOut; j++ {
+			if _, err := shared.bytes(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
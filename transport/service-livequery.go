@@ -0,0 +1,309 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// liveDirective marks the queries served by LiveQueries.
+const liveDirective = "live"
+
+var errNoLiveResult = errors.New("live query execution returned no result")
+
+// InvalidationBus delivers the invalidations of the data the live queries depend on.
+type InvalidationBus interface {
+	// Watch returns a channel receiving a value when one of keys is invalidated, until ctx is
+	// done. Invalidations happening while the previous one wasn't received yet may be coalesced.
+	Watch(ctx context.Context, keys []string) (<-chan struct{}, error)
+}
+
+// LiveQueryKeysFunc returns the invalidation keys a live query depends on.
+type LiveQueryKeysFunc func(ctx context.Context, op *ast.OperationDefinition, variableValues map[string]interface{}) []string
+
+// DefaultLiveQueryKeys returns a "Query.<field>" key for every root field of the query.
+func DefaultLiveQueryKeys(ctx context.Context, op *ast.OperationDefinition, variableValues map[string]interface{}) []string {
+	var keys []string
+	for _, selection := range op.SelectionSet {
+		if field, ok := selection.(*ast.Field); ok {
+			keys = append(keys, "Query."+field.Name)
+		}
+	}
+	return keys
+}
+
+// LiveQueryPayload is a payload of a live query. The first payload of a live query carries its
+// data, the next ones a JSON patch (RFC 6902) to apply to the data of the previous revision.
+type LiveQueryPayload struct {
+	Data       json.RawMessage      `json:"data,omitempty"`
+	Patch      []JSONPatchOperation `json:"patch,omitempty"`
+	Errors     json.RawMessage      `json:"errors,omitempty"`
+	Extensions json.RawMessage      `json:"extensions,omitempty"`
+	Revision   int                  `json:"revision"`
+}
+
+// JSONPatchOperation is an operation of a JSON patch, see https://www.rfc-editor.org/rfc/rfc6902
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+var _ GraphQLService = &LiveQueries{}
+
+// LiveQueries is a GraphQLService serving the queries marked with the @live directive. A live
+// query is executed once on the wrapped service, without the directive, and executed again every
+// time one of the keys it depends on is invalidated. The changes of its data are pushed as JSON
+// patches, executions leaving the data unchanged push nothing. Lists are replaced as a whole
+// when they change. A live query ends with an error when one of its executions fails. The other
+// operations are passed to the wrapped service.
+//
+// A Websocket with a Schema validates the live queries before they reach LiveQueries: the schema
+// must declare the directive, "directive @live on QUERY", and SubscriptionsOnly rejects them.
+type LiveQueries struct {
+	service  GraphQLService
+	bus      InvalidationBus
+	keysFunc LiveQueryKeysFunc
+}
+
+// NewLiveQueries wraps service, keysFunc defaults to DefaultLiveQueryKeys.
+func NewLiveQueries(service GraphQLService, bus InvalidationBus, keysFunc LiveQueryKeysFunc) *LiveQueries {
+	if keysFunc == nil {
+		keysFunc = DefaultLiveQueryKeys
+	}
+	return &LiveQueries{
+		service:  service,
+		bus:      bus,
+		keysFunc: keysFunc,
+	}
+}
+
+// Subscribe implements GraphQLService
+func (l *LiveQueries) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	op, document, ok := liveOperation(document, operationName)
+	if !ok {
+		return l.service.Subscribe(ctx, document, operationName, variableValues)
+	}
+
+	invalidations, err := l.bus.Watch(ctx, l.keysFunc(ctx, op, variableValues))
+	if err != nil {
+		return nil, err
+	}
+	result, err := l.execute(ctx, document, operationName, variableValues)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make(chan interface{}, 1)
+	payloads <- &LiveQueryPayload{Data: result.Data, Errors: result.Errors, Extensions: result.Extensions, Revision: 1}
+	go l.run(ctx, payloads, invalidations, result, document, operationName, variableValues)
+	return payloads, nil
+}
+
+func (l *LiveQueries) run(ctx context.Context, payloads chan<- interface{}, invalidations <-chan struct{}, prev *liveResult, document string, operationName string, variableValues map[string]interface{}) {
+	defer close(payloads)
+
+	revision := 1
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-invalidations:
+		}
+
+		result, err := l.execute(ctx, document, operationName, variableValues)
+		if err != nil {
+			if ctx.Err() == nil && getSubscriptionErrorStruct(ctx) != nil {
+				AddSubscriptionError(ctx, toGQLError(err))
+			}
+			return
+		}
+		patch := diffJSON("", prev.value, result.value, nil)
+		if len(patch) == 0 && bytes.Equal(prev.Errors, result.Errors) {
+			continue
+		}
+
+		revision++
+		prev = result
+		select {
+		case payloads <- &LiveQueryPayload{Patch: patch, Errors: result.Errors, Extensions: result.Extensions, Revision: revision}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type liveResult struct {
+	Data       json.RawMessage `json:"data"`
+	Errors     json.RawMessage `json:"errors,omitempty"`
+	Extensions json.RawMessage `json:"extensions,omitempty"`
+	value      interface{}
+}
+
+// execute runs the query once on the wrapped service and returns its first payload.
+func (l *LiveQueries) execute(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (*liveResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	payloads, err := l.service.Subscribe(ctx, document, operationName, variableValues)
+	if err != nil {
+		return nil, err
+	}
+	payload, ok := <-payloads
+	go func() {
+		for range payloads { // drain input channel
+		}
+	}()
+	if !ok {
+		return nil, errNoLiveResult
+	}
+
+	b, err := marshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	var result liveResult
+	if err := jsonDecode(b, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Data) != 0 {
+		if err := jsonDecode(result.Data, &result.value); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+// liveOperation returns the operation of the document if it is a query with the @live directive,
+// along with the document without the directive.
+func liveOperation(document string, operationName string) (*ast.OperationDefinition, string, bool) {
+	if !strings.Contains(document, "@"+liveDirective) {
+		return nil, document, false
+	}
+	doc, err := parser.ParseQuery(&ast.Source{Input: document})
+	if err != nil {
+		return nil, document, false
+	}
+	op := doc.Operations.ForName(operationName)
+	if op == nil || op.Operation != ast.Query || op.Directives.ForName(liveDirective) == nil {
+		return nil, document, false
+	}
+
+	directives := op.Directives[:0]
+	for _, directive := range op.Directives {
+		if directive.Name != liveDirective {
+			directives = append(directives, directive)
+		}
+	}
+	op.Directives = directives
+
+	var buf bytes.Buffer
+	formatter.NewFormatter(&buf).FormatQueryDocument(doc)
+	return op, buf.String(), true
+}
+
+// diffJSON appends to ops the operations turning a into b, two decoded JSON values.
+func diffJSON(path string, a interface{}, b interface{}, ops []JSONPatchOperation) []JSONPatchOperation {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		if !reflect.DeepEqual(a, b) {
+			ops = append(ops, JSONPatchOperation{Op: "replace", Path: path, Value: b})
+		}
+		return ops
+	}
+
+	for _, key := range sortedKeys(am) {
+		keyPath := path + "/" + escapeJSONPointer(key)
+		if bv, ok := bm[key]; ok {
+			ops = diffJSON(keyPath, am[key], bv, ops)
+		} else {
+			ops = append(ops, JSONPatchOperation{Op: "remove", Path: keyPath})
+		}
+	}
+	for _, key := range sortedKeys(bm) {
+		if _, ok := am[key]; !ok {
+			ops = append(ops, JSONPatchOperation{Op: "add", Path: path + "/" + escapeJSONPointer(key), Value: bm[key]})
+		}
+	}
+	return ops
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	jsonPointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+func escapeJSONPointer(key string) string {
+	return jsonPointerEscaper.Replace(key)
+}
+
+var _ InvalidationBus = &MemoryInvalidationBus{}
+
+// MemoryInvalidationBus is an InvalidationBus for a single process.
+type MemoryInvalidationBus struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan struct{}]struct{}
+}
+
+// Watch implements InvalidationBus
+func (b *MemoryInvalidationBus) Watch(ctx context.Context, keys []string) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	if b.watchers == nil {
+		b.watchers = map[string]map[chan struct{}]struct{}{}
+	}
+	for _, key := range keys {
+		if b.watchers[key] == nil {
+			b.watchers[key] = map[chan struct{}]struct{}{}
+		}
+		b.watchers[key][ch] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, key := range keys {
+			delete(b.watchers[key], ch)
+			if len(b.watchers[key]) == 0 {
+				delete(b.watchers, key)
+			}
+		}
+	})
+	return ch, nil
+}
+
+// Invalidate notifies the live queries depending on one of keys.
+func (b *MemoryInvalidationBus) Invalidate(keys ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, key := range keys {
+		for ch := range b.watchers[key] {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// queryService answers every operation with a single payload built from its current state.
+type queryService struct {
+	mu        sync.Mutex
+	state     map[string]interface{}
+	documents []string
+	err       error
+}
+
+func (s *queryService) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *queryService) set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state[key] = value
+}
+
+func (s *queryService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents = append(s.documents, document)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	data := map[string]interface{}{}
+	for key, value := range s.state {
+		data[key] = value
+	}
+	payloads := make(chan interface{}, 1)
+	payloads <- map[string]interface{}{"data": data}
+	close(payloads)
+	return payloads, nil
+}
+
+func TestLiveQueriesPushPatches(t *testing.T) {
+	svc := &queryService{state: map[string]interface{}{"user": map[string]interface{}{"name": "alice", "age": 30}}}
+	bus := &MemoryInvalidationBus{}
+	live := NewLiveQueries(svc, bus, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	payloads, err := live.Subscribe(ctx, "query @live { user { name age } }", "", nil)
+	assert.NoError(t, err)
+
+	first := receive(t, payloads).(*LiveQueryPayload)
+	assert.Equal(t, 1, first.Revision)
+	assert.JSONEq(t, `{"user":{"name":"alice","age":30}}`, string(first.Data))
+	assert.NotContains(t, svc.documents[0], "@live")
+
+	// unrelated invalidations and unchanged data push nothing
+	bus.Invalidate("Query.other")
+	bus.Invalidate("Query.user")
+	svc.set("user", map[string]interface{}{"name": "bob", "age": 30, "admin/role": true})
+	bus.Invalidate("Query.user")
+
+	patch := receive(t, payloads).(*LiveQueryPayload)
+	assert.Equal(t, 2, patch.Revision)
+	b, err := json.Marshal(patch)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"patch":[
+		{"op":"replace","path":"/user/name","value":"bob"},
+		{"op":"add","path":"/user/admin~1role","value":true}
+	],"revision":2}`, string(b))
+
+	cancel()
+	for range payloads {
+	}
+}
+
+func TestLiveQueriesReportFailedExecutions(t *testing.T) {
+	svc := &queryService{state: map[string]interface{}{"user": "alice"}}
+	bus := &MemoryInvalidationBus{}
+	live := NewLiveQueries(svc, bus, nil)
+
+	ctx, cancel := context.WithCancel(withSubscriptionErrorContext(context.Background()))
+	defer cancel()
+	payloads, err := live.Subscribe(ctx, "query @live { user }", "", nil)
+	assert.NoError(t, err)
+	receive(t, payloads)
+
+	svc.fail(errors.New("database unavailable"))
+	bus.Invalidate("Query.user")
+	for range payloads {
+	}
+	if errs := getSubscriptionError(ctx); assert.Len(t, errs, 1) {
+		assert.Equal(t, "database unavailable", errs[0].Message)
+	}
+}
+
+func TestLiveQueriesPassThroughOtherOperations(t *testing.T) {
+	svc := &countingService{}
+	live := NewLiveQueries(svc, &MemoryInvalidationBus{}, nil)
+
+	for _, document := range []string{
+		"subscription { feed }",
+		"query { feed }",
+		"subscription @live { feed }",
+	} {
+		_, err := live.Subscribe(context.Background(), document, "", nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, svc.count())
+}
+
+func TestDiffJSON(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		assert.NoError(t, jsonDecode([]byte(s), &v))
+		return v
+	}
+
+	assert.Empty(t, diffJSON("", decode(`{"a":[1,2],"b":{"c":null}}`), decode(`{"b":{"c":null},"a":[1,2]}`), nil))
+	assert.Equal(t, []JSONPatchOperation{
+		{Op: "replace", Path: "/a", Value: []interface{}{json.Number("1")}},
+		{Op: "remove", Path: "/b/c"},
+		{Op: "add", Path: "/b/d~0e", Value: nil},
+	}, diffJSON("", decode(`{"a":[1,2],"b":{"c":1}}`), decode(`{"a":[1],"b":{"d~e":null}}`), nil))
+	assert.Equal(t, []JSONPatchOperation{{Op: "replace", Path: "", Value: nil}}, diffJSON("", decode(`{}`), nil, nil))
+}
+
+func TestDefaultLiveQueryKeys(t *testing.T) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: "query @live { user { name } posts { id } }"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Query.user", "Query.posts"}, DefaultLiveQueryKeys(context.Background(), doc.Operations[0], nil))
+}
+
+func TestMemoryInvalidationBus(t *testing.T) {
+	bus := &MemoryInvalidationBus{}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := bus.Watch(ctx, []string{"a", "b"})
+	assert.NoError(t, err)
+
+	bus.Invalidate("a")
+	bus.Invalidate("b")
+	receive := func() bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+	assert.True(t, receive())
+	assert.False(t, receive(), "expected the invalidations to be coalesced")
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return len(bus.watchers) == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// MultiplexKeyFunc returns the key of an operation, operations with the same key share a single
+// upstream subscription. Returning an empty key runs the operation on its own.
+type MultiplexKeyFunc func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) string
+
+// DefaultMultiplexKey shares operations with the same document, operation name, variables,
+// identity, tenant and init payload authorization. The upstream subscription runs with the
+// context of its first subscriber, so the InitFuncs authenticating the clients otherwise, e.g.
+// from the headers or the TLS connection, must identify them with WithIdentity, as the auth
+// package does, for the clients not to receive the data resolved for another one.
+func DefaultMultiplexKey(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) string {
+	key, err := json.Marshal([]interface{}{
+		GetTenant(ctx), GetIdentity(ctx), GetInitPayload(ctx).Authorization(), operationName, document, variableValues,
+	})
+	if err != nil {
+		return ""
+	}
+	return string(key)
+}
+
+const defaultMultiplexSubscriberBuffer = 16
+
+var _ GraphQLService = &Multiplexer{}
+
+// Multiplexer is a GraphQLService running identical subscriptions once on the wrapped service and
+// fanning the payloads out to every subscriber. The upstream subscription runs with the context
+// of the first subscriber, without its cancellation, and is cancelled once every subscriber left.
+// Subscribers joining later only receive the payloads sent after they joined. Payloads are
+// wrapped in a SharedPayload so they are encoded once for every subscriber.
+//
+// Every subscriber buffers up to SubscriberBuffer payloads, a subscriber falling further behind
+// is ended with a slow consumer error rather than stalling the others.
+type Multiplexer struct {
+	// SubscriberBuffer is the number of payloads buffered for every subscriber, it defaults to 16
+	SubscriberBuffer int
+
+	service GraphQLService
+	keyFunc MultiplexKeyFunc
+
+	mu     sync.Mutex
+	groups map[string]*multiplexGroup
+}
+
+type multiplexGroup struct {
+	ready  chan struct{}
+	err    error
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	subscribers map[*multiplexSubscriber]struct{}
+}
+
+type multiplexSubscriber struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	payloads chan interface{}
+	closed   bool
+}
+
+// NewMultiplexer wraps service, keyFunc defaults to DefaultMultiplexKey.
+func NewMultiplexer(service GraphQLService, keyFunc MultiplexKeyFunc) *Multiplexer {
+	if keyFunc == nil {
+		keyFunc = DefaultMultiplexKey
+	}
+	return &Multiplexer{
+		service: service,
+		keyFunc: keyFunc,
+		groups:  map[string]*multiplexGroup{},
+	}
+}
+
+// Subscribe implements GraphQLService
+func (m *Multiplexer) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	key := m.keyFunc(ctx, document, operationName, variableValues)
+	if key == "" {
+		return m.service.Subscribe(ctx, document, operationName, variableValues)
+	}
+
+	buffer := m.SubscriberBuffer
+	if buffer <= 0 {
+		buffer = defaultMultiplexSubscriberBuffer
+	}
+	sub := &multiplexSubscriber{ctx: ctx, payloads: make(chan interface{}, buffer)}
+
+	m.mu.Lock()
+	g, exists := m.groups[key]
+	if !exists {
+		g = &multiplexGroup{
+			ready:       make(chan struct{}),
+			subscribers: map[*multiplexSubscriber]struct{}{},
+		}
+		m.groups[key] = g
+	}
+	g.mu.Lock()
+	g.subscribers[sub] = struct{}{}
+	g.mu.Unlock()
+	m.mu.Unlock()
+
+	if !exists {
+		m.start(key, g, ctx, document, operationName, variableValues)
+	}
+	<-g.ready
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	go func() {
+		<-ctx.Done()
+		m.leave(key, g, sub)
+	}()
+	return sub.payloads, nil
+}
+
+func (m *Multiplexer) start(key string, g *multiplexGroup, ctx context.Context, document string, operationName string, variableValues map[string]interface{}) {
+	defer close(g.ready)
+
+	upstreamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	payloads, err := m.service.Subscribe(upstreamCtx, document, operationName, variableValues)
+	if err != nil {
+		cancel()
+		g.err = err
+		m.remove(key, g)
+		return
+	}
+	g.cancel = cancel
+
+	go m.fanOut(key, g, payloads)
+}
+
+func (m *Multiplexer) fanOut(key string, g *multiplexGroup, payloads <-chan interface{}) {
+	for payload := range payloads {
+		shared := NewSharedPayload(payload)
+		for _, sub := range g.snapshot() {
+			sub.send(shared)
+		}
+	}
+
+	m.remove(key, g)
+	g.cancel()
+	for _, sub := range g.snapshot() {
+		sub.close()
+	}
+}
+
+// leave removes a subscriber whose operation ended, the upstream subscription is cancelled with
+// the last one.
+func (m *Multiplexer) leave(key string, g *multiplexGroup, sub *multiplexSubscriber) {
+	m.mu.Lock()
+	g.mu.Lock()
+	delete(g.subscribers, sub)
+	last := len(g.subscribers) == 0
+	g.mu.Unlock()
+	if last && m.groups[key] == g {
+		delete(m.groups, key)
+	}
+	m.mu.Unlock()
+
+	sub.close()
+	if last {
+		g.cancel()
+	}
+}
+
+func (m *Multiplexer) remove(key string, g *multiplexGroup) {
+	m.mu.Lock()
+	if m.groups[key] == g {
+		delete(m.groups, key)
+	}
+	m.mu.Unlock()
+}
+
+func (g *multiplexGroup) snapshot() []*multiplexSubscriber {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	subs := make([]*multiplexSubscriber, 0, len(g.subscribers))
+	for sub := range g.subscribers {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// send buffers a payload for the subscriber without blocking, the subscriber is ended as a slow
+// consumer when its buffer is full.
+func (sub *multiplexSubscriber) send(payload interface{}) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	select {
+	case sub.payloads <- payload:
+	default:
+		if getSubscriptionErrorStruct(sub.ctx) != nil {
+			AddSubscriptionError(sub.ctx, errSlowConsumer)
+		}
+		sub.closed = true
+		close(sub.payloads)
+	}
+}
+
+func (sub *multiplexSubscriber) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if !sub.closed {
+		sub.closed = true
+		close(sub.payloads)
+	}
+}
@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type upstreamSubscription struct {
+	ctx      context.Context
+	payloads chan interface{}
+}
+
+type countingService struct {
+	mu   sync.Mutex
+	subs []*upstreamSubscription
+	err  error
+}
+
+func (s *countingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	sub := &upstreamSubscription{ctx: ctx, payloads: make(chan interface{})}
+	s.subs = append(s.subs, sub)
+	return sub.payloads, nil
+}
+
+func (s *countingService) upstream(i int) *upstreamSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subs[i]
+}
+
+func (s *countingService) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs)
+}
+
+func receive(t *testing.T, payloads <-chan interface{}) interface{} {
+	select {
+	case p := <-payloads:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for payload")
+		return nil
+	}
+}
+
+func TestMultiplexerSharesIdenticalSubscriptions(t *testing.T) {
+	svc := &countingService{}
+	m := NewMultiplexer(svc, nil)
+	ctx := context.Background()
+
+	first, err := m.Subscribe(ctx, "subscription { feed }", "", map[string]interface{}{"a": 1})
+	assert.NoError(t, err)
+	second, err := m.Subscribe(ctx, "subscription { feed }", "", map[string]interface{}{"a": 1})
+	assert.NoError(t, err)
+	_, err = m.Subscribe(ctx, "subscription { feed }", "", map[string]interface{}{"a": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, svc.count())
+
+	// payloads are fanned out in no particular order, receive from both subscribers at once
+	go func() { svc.upstream(0).payloads <- "event" }()
+	received := make(chan interface{}, 1)
+	go func() { received <- <-second }()
+	shared := receive(t, first).(*SharedPayload)
+	assert.Equal(t, "event", shared.Value())
+	assert.Same(t, shared, receive(t, received), "Expected subscribers to share the payload")
+}
+
+func TestMultiplexerKeyIncludesAuthorization(t *testing.T) {
+	svc := &countingService{}
+	m := NewMultiplexer(svc, nil)
+
+	_, err := m.Subscribe(withInitPayload(context.Background(), InitPayload{"Authorization": "alice"}), "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+	_, err = m.Subscribe(withInitPayload(context.Background(), InitPayload{"Authorization": "bob"}), "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, svc.count())
+}
+
+func TestMultiplexerKeyIncludesIdentity(t *testing.T) {
+	svc := &countingService{}
+	m := NewMultiplexer(svc, nil)
+
+	for _, ctx := range []context.Context{
+		WithIdentity(context.Background(), "alice"),
+		WithIdentity(context.Background(), "bob"),
+		withTenant(WithIdentity(context.Background(), "bob"), "acme"),
+		WithIdentity(context.Background(), "alice"),
+	} {
+		_, err := m.Subscribe(ctx, "subscription { feed }", "", nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, svc.count())
+}
+
+func TestMultiplexerEndsSlowSubscribers(t *testing.T) {
+	svc := &countingService{}
+	m := NewMultiplexer(svc, nil)
+	m.SubscriberBuffer = 1
+
+	slowCtx := withSubscriptionErrorContext(context.Background())
+	slow, err := m.Subscribe(slowCtx, "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+	fast, err := m.Subscribe(context.Background(), "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+
+	// the subscriber that doesn't receive doesn't stall the other one
+	upstream := svc.upstream(0)
+	for i := range 3 {
+		upstream.payloads <- i
+		assert.Equal(t, i, receive(t, fast).(*SharedPayload).Value())
+	}
+	assert.Equal(t, 0, receive(t, slow).(*SharedPayload).Value())
+	_, open := <-slow
+	assert.False(t, open, "Expected the slow subscriber to be ended")
+	assert.Equal(t, []*gqlerror.Error{errSlowConsumer}, getSubscriptionError(slowCtx))
+}
+
+func TestMultiplexerCancelsUpstreamWithLastSubscriber(t *testing.T) {
+	svc := &countingService{}
+	m := NewMultiplexer(svc, nil)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	first, err := m.Subscribe(ctx1, "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+	second, err := m.Subscribe(ctx2, "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+	upstream := svc.upstream(0)
+
+	cancel1()
+	for range first {
+	}
+	assert.NoError(t, upstream.ctx.Err(), "Expected upstream to keep running for the remaining subscriber")
+
+	go func() { upstream.payloads <- "event" }()
+	assert.Equal(t, "event", receive(t, second).(*SharedPayload).Value())
+
+	cancel2()
+	for range second {
+	}
+	<-upstream.ctx.Done()
+
+	// the next subscriber starts a new upstream subscription
+	_, err = m.Subscribe(context.Background(), "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, svc.count())
+}
+
+func TestMultiplexerClosesSubscribersWhenUpstreamEnds(t *testing.T) {
+	svc := &countingService{}
+	m := NewMultiplexer(svc, nil)
+
+	first, err := m.Subscribe(context.Background(), "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+	second, err := m.Subscribe(context.Background(), "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+
+	close(svc.upstream(0).payloads)
+	for range first {
+	}
+	for range second {
+	}
+}
+
+func TestMultiplexerUpstreamError(t *testing.T) {
+	svc := &countingService{err: errors.New("unavailable")}
+	m := NewMultiplexer(svc, nil)
+
+	_, err := m.Subscribe(context.Background(), "subscription { feed }", "", nil)
+	assert.EqualError(t, err, "unavailable")
+
+	svc.err = nil
+	_, err = m.Subscribe(context.Background(), "subscription { feed }", "", nil)
+	assert.NoError(t, err)
+}
+
+func TestMultiplexerEmptyKeyBypasses(t *testing.T) {
+	svc := &countingService{}
+	m := NewMultiplexer(svc, func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) string {
+		return ""
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := m.Subscribe(context.Background(), "subscription { feed }", "", nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, svc.count())
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const defaultSSEKeepAliveInterval = 12 * time.Second
+
+// SSE serves the operations over server-sent events, following the distinct connections mode of
+// graphql-sse: every request carries an operation, whose payloads are streamed as "next" events
+// until a "complete" event, see https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md
+type SSE struct {
+	// KeepAliveInterval is the interval of the comments keeping the idle streams open, it defaults
+	// to 12 seconds. A negative interval disables them.
+	KeepAliveInterval time.Duration
+}
+
+// Supports returns true if the request accepts text/event-stream responses.
+func (t SSE) Supports(r *http.Request) bool {
+	return acceptsMediaType(r, "text/event-stream")
+}
+
+// Do serves an operation over server-sent events.
+func (t SSE) Do(w http.ResponseWriter, r *http.Request, service GraphQLService) {
+	ctx, cancel, payloads, ok := startHTTPOperation(w, r, service)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	var buf bytes.Buffer
+	writeEvent := func(event string, data []byte) error {
+		buf.Reset()
+		buf.WriteString("event: " + event + "\ndata: ")
+		buf.Write(data)
+		buf.WriteString("\n\n")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	interval := t.KeepAliveInterval
+	if interval == 0 {
+		interval = defaultSSEKeepAliveInterval
+	}
+	pumpHTTPOperation(ctx, cancel, payloads, interval, func(payload []byte) error {
+		return writeEvent("next", payload)
+	}, func() error {
+		if _, err := w.Write([]byte(":\n\n")); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+
+	if r.Context().Err() != nil {
+		return
+	}
+	if errs := getSubscriptionError(ctx); len(errs) != 0 {
+		b, err := json.Marshal(&gqlResponse{Errors: gqlerror.List(errs)})
+		if err != nil {
+			b = []byte(`{"errors":[` + internalErrorJSON + `]}`)
+		}
+		_ = writeEvent("next", b)
+	}
+	_ = writeEvent("complete", nil)
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestSSE(t *testing.T) {
+	operations := make(chan *OperationInfo, 1)
+	service := testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			operations <- GetOperationInfo(ctx)
+			payloads := make(chan interface{}, 2)
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"value": variableValues["n"]}}
+			payloads <- NewSharedPayload(map[string]interface{}{"data": map[string]interface{}{"value": 2}})
+			close(payloads)
+			AddSubscriptionError(ctx, gqlerror.Errorf("ended"))
+			return payloads, nil
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SSE{}.Do(w, r, service)
+	}))
+	defer server.Close()
+
+	query := url.Values{"query": {"subscription Count { value }"}, "variables": {`{"n":1}`}}
+	resp, err := http.Get(server.URL + "?" + query.Encode())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "event: next\ndata: {\"data\":{\"value\":1}}\n\n"+
+		"event: next\ndata: {\"data\":{\"value\":2}}\n\n"+
+		"event: next\ndata: {\"errors\":[{\"message\":\"ended\"}]}\n\n"+
+		"event: complete\ndata: \n\n", string(body))
+	assert.Equal(t, "Count", (<-operations).Name)
+}
+
+func TestSSEKeepAlive(t *testing.T) {
+	service := testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{})
+			context.AfterFunc(ctx, func() { close(payloads) })
+			return payloads, nil
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SSE{KeepAliveInterval: 10 * time.Millisecond}.Do(w, r, service)
+	}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"query":"subscription { value }"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(resp.Body, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ":\n\n", string(buf))
+}
+
+func TestSSEInvalidOperation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SSE{}.Do(w, r, testGraphQLService{})
+	}))
+	defer server.Close()
+
+	for _, body := range []string{`{"query":`, `{"variables":{}}`} {
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+}
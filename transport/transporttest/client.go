@@ -0,0 +1,220 @@
+package transporttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultReadTimeout = 2 * time.Second
+
+// Message is a protocol message exchanged between the client and the handler.
+type Message struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Operation is a GraphQL operation sent by a client.
+type Operation struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// ClientOption configures a Client
+type ClientOption func(*clientConfig)
+
+type clientConfig struct {
+	subprotocol string
+	header      http.Header
+	path        string
+	readTimeout time.Duration
+}
+
+// WithSubprotocol selects the subprotocol the client negotiates, it defaults to graphql-transport-ws.
+func WithSubprotocol(subprotocol string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.subprotocol = subprotocol
+	}
+}
+
+// WithHeader sets the headers of the upgrade request.
+func WithHeader(header http.Header) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.header = header
+	}
+}
+
+// WithPath sets the path of the upgrade request, it defaults to "/".
+func WithPath(path string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.path = path
+	}
+}
+
+// WithReadTimeout sets how long the client waits for a message before failing, it defaults to 2 seconds.
+func WithReadTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.readTimeout = timeout
+	}
+}
+
+// Client is a websocket client connected in process to an http.Handler. No network socket is
+// opened, the handler is served over an in memory connection.
+type Client struct {
+	conn    *websocket.Conn
+	server  *http.Server
+	dialect dialect
+	timeout time.Duration
+}
+
+// NewClient connects a client to the handler.
+func NewClient(handler http.Handler, opts ...ClientOption) (*Client, error) {
+	cfg := clientConfig{
+		subprotocol: "graphql-transport-ws",
+		header:      http.Header{},
+		path:        "/",
+		readTimeout: defaultReadTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	d, ok := dialectFor(cfg.subprotocol)
+	if !ok {
+		return nil, fmt.Errorf("unsupported subprotocol %s", cfg.subprotocol)
+	}
+
+	listener := newPipeListener()
+	server := &http.Server{Handler: handler}
+	go func() { _ = server.Serve(listener) }()
+
+	dialer := websocket.Dialer{
+		NetDialContext:   listener.DialContext,
+		Subprotocols:     []string{cfg.subprotocol},
+		HandshakeTimeout: cfg.readTimeout,
+	}
+	conn, _, err := dialer.Dial("ws://transporttest"+cfg.path, cfg.header)
+	if err != nil {
+		_ = server.Close()
+		return nil, err
+	}
+
+	return &Client{
+		conn:    conn,
+		server:  server,
+		dialect: d,
+		timeout: cfg.readTimeout,
+	}, nil
+}
+
+// Subprotocol returns the subprotocol negotiated with the handler.
+func (c *Client) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+// Send writes a raw message to the handler.
+func (c *Client) Send(m Message) error {
+	return c.conn.WriteJSON(m)
+}
+
+// SendRaw writes data as a text message, without validating it.
+func (c *Client) SendRaw(data []byte) error {
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Read reads the next message sent by the handler. Close frames are returned as
+// *websocket.CloseError.
+func (c *Client) Read() (Message, error) {
+	var m Message
+	_ = c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	err := c.conn.ReadJSON(&m)
+	return m, err
+}
+
+// Next reads the next message that isn't a keep alive. Pings sent by the handler are answered.
+func (c *Client) Next() (Message, error) {
+	return c.next("")
+}
+
+// Expect reads the next message and fails if it isn't of the given type. Keep alive messages and
+// pings are skipped unless they are the expected type.
+func (c *Client) Expect(typ string) (Message, error) {
+	m, err := c.next(typ)
+	if err != nil {
+		return m, err
+	}
+	if m.Type != typ {
+		return m, fmt.Errorf("expected %s, got %s", typ, m.Type)
+	}
+	return m, nil
+}
+
+func (c *Client) next(expected string) (Message, error) {
+	for {
+		m, err := c.Read()
+		if err != nil || m.Type == expected {
+			return m, err
+		}
+
+		switch {
+		case m.Type == "ka":
+		case m.Type == "ping" && c.dialect.ping == "ping":
+			if err := c.Send(Message{Type: "pong"}); err != nil {
+				return m, err
+			}
+		default:
+			return m, nil
+		}
+	}
+}
+
+// Init sends connection_init and waits for the handler to acknowledge it.
+func (c *Client) Init(payload interface{}) error {
+	m := Message{Type: "connection_init"}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		m.Payload = b
+	}
+
+	if err := c.Send(m); err != nil {
+		return err
+	}
+
+	_, err := c.Expect("connection_ack")
+	return err
+}
+
+// Subscribe starts an operation using the message type of the negotiated subprotocol.
+func (c *Client) Subscribe(id string, op Operation) error {
+	b, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	return c.Send(Message{Type: c.dialect.subscribe, ID: id, Payload: b})
+}
+
+// Stop stops an operation using the message type of the negotiated subprotocol.
+func (c *Client) Stop(id string) error {
+	return c.Send(Message{Type: c.dialect.stop, ID: id})
+}
+
+// Ping sends a ping, or a keep alive for graphql-ws.
+func (c *Client) Ping() error {
+	return c.Send(Message{Type: c.dialect.ping})
+}
+
+// Close closes the connection and stops serving the handler.
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	_ = c.server.Close()
+	return err
+}
@@ -0,0 +1,73 @@
+package transporttest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHandler(service transport.GraphQLService) http.Handler {
+	ws := &transport.Websocket{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.Do(w, r, service)
+	})
+}
+
+func TestClientSubscription(t *testing.T) {
+	svc := NewFakeService()
+	c, err := NewClient(newTestHandler(svc))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	assert.Equal(t, "graphql-transport-ws", c.Subprotocol())
+	assert.NoError(t, c.Init(map[string]interface{}{"token": "abc"}))
+
+	svc.Queue("first")
+	assert.NoError(t, c.Subscribe("1", Operation{Query: "subscription { value }", Variables: map[string]interface{}{"id": "1"}}))
+	m, err := c.Expect("next")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", m.ID)
+
+	waitFor(t, "subscription", func() bool { return svc.ActiveCount() == 1 })
+	svc.Publish("second")
+	m, err = c.Expect("next")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", m.ID)
+
+	svc.CompleteAll()
+	m, err = c.Expect("complete")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", m.ID)
+
+	ops := svc.Operations()
+	if assert.Len(t, ops, 1) {
+		assert.Equal(t, "subscription { value }", ops[0].Query)
+		assert.Equal(t, "1", ops[0].Variables["id"])
+	}
+}
+
+func TestClientLegacySubprotocol(t *testing.T) {
+	svc := NewFakeService()
+	c, err := NewClient(newTestHandler(svc), WithSubprotocol("graphql-ws"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	assert.NoError(t, c.Init(nil))
+	svc.FailWith(errors.New("boom"))
+	assert.NoError(t, c.Subscribe("1", Operation{Query: "subscription { value }"}))
+	m, err := c.Expect("error")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", m.ID)
+}
+
+func TestClientUnsupportedSubprotocol(t *testing.T) {
+	_, err := NewClient(newTestHandler(NewFakeService()), WithSubprotocol("unknown"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,208 @@
+// Package transporttest provides utilities for testing handlers built on top of the transport
+// package.
+package transporttest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/gorilla/websocket"
+)
+
+// NewHandlerFunc wires the handler under test with the service driven by the conformance suite.
+type NewHandlerFunc func(service transport.GraphQLService) http.Handler
+
+// dialect describes the message types a subprotocol uses for client operations.
+type dialect struct {
+	subprotocol string
+	subscribe   string
+	next        string
+	stop        string
+	ping        string
+	// pong is empty when the pings aren't answered, the keep alives of graphql-ws only show that
+	// the client is alive.
+	pong string
+	// replacesDuplicateID is set when a subscribe reusing the id of a running operation replaces
+	// it, rather than closing the connection with 4409.
+	replacesDuplicateID bool
+}
+
+var dialects = []dialect{
+	{
+		subprotocol: "graphql-ws",
+		subscribe:   "start",
+		next:        "data",
+		stop:        "stop",
+		ping:        "ka",
+
+		replacesDuplicateID: true,
+	},
+	{
+		subprotocol: "graphql-transport-ws",
+		subscribe:   "subscribe",
+		next:        "next",
+		stop:        "complete",
+		ping:        "ping",
+		pong:        "pong",
+	},
+}
+
+func dialectFor(subprotocol string) (dialect, bool) {
+	for _, d := range dialects {
+		if d.subprotocol == subprotocol {
+			return d, true
+		}
+	}
+	return dialect{}, false
+}
+
+var errSubscriptionFailed = errors.New("subscription failed")
+
+var valueOperation = Operation{
+	Query:         "subscription Value { value }",
+	OperationName: "Value",
+}
+
+// RunConformance runs the protocol conformance suite against the handler returned by newHandler,
+// once for every supported subprotocol. Any handler wrapping transport.Websocket must pass it.
+func RunConformance(t *testing.T, newHandler NewHandlerFunc) {
+	for _, d := range dialects {
+		d := d
+		t.Run(d.subprotocol, func(t *testing.T) {
+			t.Run("InitHandshake", func(t *testing.T) {
+				c, _ := startConformance(t, newHandler, d)
+				must(t, c.Init(map[string]interface{}{}))
+			})
+
+			t.Run("Ping", func(t *testing.T) {
+				c, svc := startConformance(t, newHandler, d)
+				must(t, c.Init(nil))
+				must(t, c.Ping())
+				if d.pong != "" {
+					_, err := c.Expect(d.pong)
+					must(t, err)
+					return
+				}
+				svc.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+				must(t, c.Subscribe("1", valueOperation))
+				_, err := c.Expect(d.next)
+				must(t, err)
+			})
+
+			t.Run("Next", func(t *testing.T) {
+				c, svc := startConformance(t, newHandler, d)
+				must(t, c.Init(nil))
+				svc.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+				must(t, c.Subscribe("1", valueOperation))
+				m, err := c.Expect(d.next)
+				must(t, err)
+				if m.ID != "1" {
+					t.Fatalf("expected %s for operation 1, got operation %q", d.next, m.ID)
+				}
+			})
+
+			t.Run("CompleteOnStop", func(t *testing.T) {
+				c, svc := startConformance(t, newHandler, d)
+				must(t, c.Init(nil))
+				svc.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+				must(t, c.Subscribe("1", valueOperation))
+				_, err := c.Expect(d.next)
+				must(t, err)
+				must(t, c.Stop("1"))
+				waitFor(t, "operation to be cancelled", func() bool { return svc.ActiveCount() == 0 })
+			})
+
+			t.Run("ErrorFrame", func(t *testing.T) {
+				c, svc := startConformance(t, newHandler, d)
+				must(t, c.Init(nil))
+				svc.FailWith(errSubscriptionFailed)
+				must(t, c.Subscribe("1", valueOperation))
+				m, err := c.Expect("error")
+				must(t, err)
+				if m.ID != "1" {
+					t.Fatalf("expected error for operation 1, got operation %q", m.ID)
+				}
+
+				var errs []struct {
+					Message string `json:"message"`
+				}
+				if err := json.Unmarshal(m.Payload, &errs); err != nil {
+					t.Fatalf("expected a list of errors as payload: %v", err)
+				}
+				if len(errs) != 1 || errs[0].Message != errSubscriptionFailed.Error() {
+					t.Fatalf("unexpected error payload %s", string(m.Payload))
+				}
+			})
+
+			t.Run("DuplicateID", func(t *testing.T) {
+				c, svc := startConformance(t, newHandler, d)
+				must(t, c.Init(nil))
+				svc.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+				must(t, c.Subscribe("1", valueOperation))
+				_, err := c.Expect(d.next)
+				must(t, err)
+				if !d.replacesDuplicateID {
+					must(t, c.Subscribe("1", valueOperation))
+					expectClose(t, c, 4409)
+					return
+				}
+				svc.Queue(map[string]interface{}{"data": map[string]interface{}{"value": 2}})
+				must(t, c.Subscribe("1", valueOperation))
+				m, err := c.Expect(d.next)
+				must(t, err)
+				if m.ID != "1" || string(m.Payload) != `{"data":{"value":2}}` {
+					t.Fatalf("expected the payload of the new operation 1, got %s for operation %q", string(m.Payload), m.ID)
+				}
+				waitFor(t, "operation to be replaced", func() bool { return svc.ActiveCount() == 1 })
+			})
+		})
+	}
+}
+
+func startConformance(t *testing.T, newHandler NewHandlerFunc, d dialect) (*Client, *FakeService) {
+	t.Helper()
+	svc := NewFakeService()
+	c, err := NewClient(newHandler(svc), WithSubprotocol(d.subprotocol))
+	if err != nil {
+		t.Fatalf("unable to connect to handler: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, svc
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(defaultReadTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expectClose(t *testing.T, c *Client, code int) {
+	t.Helper()
+	for {
+		_, err := c.Read()
+		if err == nil {
+			continue
+		}
+
+		if !websocket.IsCloseError(err, code) {
+			t.Fatalf("expected close with code %d, got %v", code, err)
+		}
+		return
+	}
+}
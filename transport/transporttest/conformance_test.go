@@ -0,0 +1,28 @@
+package transporttest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/graphqlws"
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+func TestConformanceDefaultHandler(t *testing.T) {
+	RunConformance(t, func(service transport.GraphQLService) http.Handler {
+		return graphqlws.NewHandlerFunc(service, http.NotFoundHandler())
+	})
+}
+
+func TestConformancePingPong(t *testing.T) {
+	RunConformance(t, func(service transport.GraphQLService) http.Handler {
+		ws := &transport.Websocket{
+			Upgrader: transport.Upgrader{
+				CheckOrigin: func(r *http.Request) bool { return true },
+			},
+			PingPongInterval: 10 * time.Millisecond,
+		}
+		return graphqlws.NewHandlerFunc(service, http.NotFoundHandler(), graphqlws.WithWebsocketTransport(ws))
+	})
+}
@@ -0,0 +1,184 @@
+package transporttest
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pipeListener is a net.Listener handing out in memory connections, it allows serving a handler
+// with a regular http.Server without opening network sockets.
+type pipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr("server")
+}
+
+// DialContext returns the client side of a new in memory connection to the listener.
+func (l *pipeListener) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := newPipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeBuffer is an unbounded byte queue with read deadline support. Unlike net.Pipe writes never
+// block, which mirrors the buffering of a real socket closely enough for tests.
+type pipeBuffer struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	data     []byte
+	eof      bool
+	closed   bool
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newPipeBuffer() *pipeBuffer {
+	b := &pipeBuffer{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *pipeBuffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		switch {
+		case b.closed:
+			return 0, net.ErrClosed
+		case len(b.data) > 0:
+			n := copy(p, b.data)
+			b.data = b.data[n:]
+			return n, nil
+		case b.eof:
+			return 0, io.EOF
+		case !b.deadline.IsZero() && !time.Now().Before(b.deadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+		b.cond.Wait()
+	}
+}
+
+func (b *pipeBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.eof || b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	b.data = append(b.data, p...)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+func (b *pipeBuffer) setDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deadline = t
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if !t.IsZero() {
+		b.timer = time.AfterFunc(time.Until(t), func() {
+			b.mu.Lock()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		})
+	}
+	b.cond.Broadcast()
+}
+
+// closeWrite signals the reader that no more data will arrive.
+func (b *pipeBuffer) closeWrite() {
+	b.mu.Lock()
+	b.eof = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// closeRead makes pending and future reads fail with net.ErrClosed.
+func (b *pipeBuffer) closeRead() {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+type pipeConn struct {
+	r, w          *pipeBuffer
+	local, remote net.Addr
+}
+
+func newPipe() (client net.Conn, server net.Conn) {
+	toServer, toClient := newPipeBuffer(), newPipeBuffer()
+	client = &pipeConn{r: toClient, w: toServer, local: pipeAddr("client"), remote: pipeAddr("server")}
+	server = &pipeConn{r: toServer, w: toClient, local: pipeAddr("server"), remote: pipeAddr("client")}
+	return client, server
+}
+
+func (c *pipeConn) Read(p []byte) (int, error)  { return c.r.read(p) }
+func (c *pipeConn) Write(p []byte) (int, error) { return c.w.write(p) }
+func (c *pipeConn) LocalAddr() net.Addr         { return c.local }
+func (c *pipeConn) RemoteAddr() net.Addr        { return c.remote }
+
+func (c *pipeConn) Close() error {
+	c.r.closeRead()
+	c.w.closeWrite()
+	return nil
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline is a no-op since writes never block.
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
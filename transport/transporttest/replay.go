@@ -0,0 +1,74 @@
+package transporttest
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/gorilla/websocket"
+)
+
+// defaultReplayQuietPeriod is how long Replay waits for further messages once the handler stops
+// sending.
+const defaultReplayQuietPeriod = 500 * time.Millisecond
+
+// Sessions groups recorded frames by connection, keeping their order.
+func Sessions(frames []transport.Frame) map[string][]transport.Frame {
+	sessions := map[string][]transport.Frame{}
+	for _, f := range frames {
+		sessions[f.ConnectionID] = append(sessions[f.ConnectionID], f)
+	}
+	return sessions
+}
+
+// Replay feeds the inbound frames of a recorded session back through the handler and returns the
+// messages the handler sends in response. The frames must belong to a single connection, see
+// Sessions. Replay returns once the handler closes the connection or stays quiet for the read
+// timeout, which defaults to 500ms and can be changed with WithReadTimeout.
+func Replay(handler http.Handler, frames []transport.Frame, opts ...ClientOption) ([]Message, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("no frames to replay")
+	}
+	for _, f := range frames {
+		if f.ConnectionID != frames[0].ConnectionID {
+			return nil, errors.New("frames belong to more than one connection")
+		}
+	}
+
+	subprotocol := frames[0].Subprotocol
+	if subprotocol == "" {
+		subprotocol = "graphql-ws"
+	}
+	opts = append([]ClientOption{WithSubprotocol(subprotocol), WithReadTimeout(defaultReplayQuietPeriod)}, opts...)
+
+	c, err := NewClient(handler, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	for _, f := range frames {
+		if f.Direction != transport.FrameInbound {
+			continue
+		}
+		if err := c.SendRaw(f.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	var messages []Message
+	for {
+		m, err := c.Read()
+		if err != nil {
+			var netErr net.Error
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) || (errors.As(err, &netErr) && netErr.Timeout()) {
+				return messages, nil
+			}
+			return messages, err
+		}
+		messages = append(messages, m)
+	}
+}
@@ -0,0 +1,59 @@
+package transporttest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	recorder := transport.NewRingRecorder(32)
+	svc := NewFakeService()
+	ws := &transport.Websocket{Recorder: recorder}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.Do(w, r, svc)
+	})
+
+	// Record a session
+	c, err := NewClient(handler)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c.Init(nil))
+	svc.FailWith(errSubscriptionFailed)
+	assert.NoError(t, c.Subscribe("1", valueOperation))
+	_, err = c.Expect("error")
+	assert.NoError(t, err)
+	assert.NoError(t, c.Close())
+
+	sessions := Sessions(recorder.Frames())
+	if !assert.Len(t, sessions, 1) {
+		return
+	}
+
+	// Replay it against a fresh handler
+	var frames []transport.Frame
+	for _, f := range sessions {
+		frames = f
+	}
+	messages, err := Replay(handler, frames)
+	assert.NoError(t, err)
+
+	var types []string
+	for _, m := range messages {
+		types = append(types, m.Type)
+	}
+	assert.Contains(t, types, "connection_ack")
+	assert.Contains(t, types, "error")
+	assert.Len(t, svc.Operations(), 2, "Expected the subscription to be replayed")
+}
+
+func TestReplayInvalidSessions(t *testing.T) {
+	_, err := Replay(http.NotFoundHandler(), nil)
+	assert.Error(t, err)
+
+	_, err = Replay(http.NotFoundHandler(), []transport.Frame{{ConnectionID: "a"}, {ConnectionID: "b"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,150 @@
+package transporttest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/annibuliful-lab/graphqlws-subscription/transport"
+)
+
+var _ transport.GraphQLService = &FakeService{}
+
+// FakeService is a scriptable transport.GraphQLService. It records the operations it receives
+// and lets tests decide what each subscription yields.
+type FakeService struct {
+	mu         sync.Mutex
+	operations []Operation
+	queued     []interface{}
+	err        error
+	active     map[*fakeSubscription]struct{}
+}
+
+type fakeSubscription struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	payloads chan interface{}
+	closed   bool
+}
+
+// NewFakeService returns a FakeService without queued payloads.
+func NewFakeService() *FakeService {
+	return &FakeService{active: map[*fakeSubscription]struct{}{}}
+}
+
+// Queue adds payloads that are delivered by the next subscription right after it starts.
+func (s *FakeService) Queue(payloads ...interface{}) {
+	s.mu.Lock()
+	s.queued = append(s.queued, payloads...)
+	s.mu.Unlock()
+}
+
+// FailWith makes Subscribe return err until it is reset with a nil error.
+func (s *FakeService) FailWith(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// Publish delivers a payload to every active subscription.
+func (s *FakeService) Publish(payload interface{}) {
+	s.mu.Lock()
+	subs := make([]*fakeSubscription, 0, len(s.active))
+	for sub := range s.active {
+		subs = append(subs, sub)
+	}
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.send(payload)
+	}
+}
+
+// CompleteAll ends every active subscription from the server side.
+func (s *FakeService) CompleteAll() {
+	s.mu.Lock()
+	subs := s.active
+	s.active = map[*fakeSubscription]struct{}{}
+	s.mu.Unlock()
+
+	for sub := range subs {
+		sub.close()
+	}
+}
+
+// Operations returns the operations received so far, in order.
+func (s *FakeService) Operations() []Operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Operation(nil), s.operations...)
+}
+
+// ActiveCount returns the number of subscriptions that are neither cancelled nor completed.
+func (s *FakeService) ActiveCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.active)
+}
+
+// Subscribe implements transport.GraphQLService.
+func (s *FakeService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	s.mu.Lock()
+	s.operations = append(s.operations, Operation{
+		Query:         document,
+		OperationName: operationName,
+		Variables:     variableValues,
+	})
+	if s.err != nil {
+		err := s.err
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	queued := s.queued
+	s.queued = nil
+	sub := &fakeSubscription{
+		ctx:      ctx,
+		payloads: make(chan interface{}, len(queued)+16),
+	}
+	for _, payload := range queued {
+		sub.payloads <- payload
+	}
+	if s.active == nil {
+		s.active = map[*fakeSubscription]struct{}{}
+	}
+	s.active[sub] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		delete(s.active, sub)
+		s.mu.Unlock()
+		sub.close()
+	}()
+
+	return sub.payloads, nil
+}
+
+func (sub *fakeSubscription) send(payload interface{}) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	select {
+	case sub.payloads <- payload:
+	case <-sub.ctx.Done():
+	}
+}
+
+func (sub *fakeSubscription) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if !sub.closed {
+		sub.closed = true
+		close(sub.payloads)
+	}
+}
@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultAdmissionMaxWait = 10 * time.Second
+
+// AdmissionStats reports the connections being established through an Admission, e.g. to export
+// metrics.
+type AdmissionStats struct {
+	// Establishing is the number of connections being established.
+	Establishing int
+	// Queued is the number of upgrade requests waiting to be established.
+	Queued int
+	// Rejected is the number of upgrade requests rejected since the Admission was created.
+	Rejected int64
+}
+
+// Admission bounds the connections being established at once, from their upgrade until their
+// InitFunc returns, so that a storm of connections, e.g. the clients reconnecting after a deploy,
+// doesn't overwhelm the InitFunc and what it depends on. The other upgrade requests wait in a
+// queue, first come first served, and are answered with 503 and a Retry-After header past
+// MaxQueue or MaxWait. It is safe for concurrent use and may be shared by several transports.
+type Admission struct {
+	// MaxConcurrent is the number of connections established at once, it is required.
+	MaxConcurrent int
+	// MaxQueue is the number of upgrade requests waiting for the others to be established, the
+	// requests beyond it are rejected right away.
+	MaxQueue int
+	// MaxWait is how long an upgrade request waits in the queue before being rejected, it
+	// defaults to 10 seconds.
+	MaxWait time.Duration
+
+	mu           sync.Mutex
+	establishing int
+	queue        []chan struct{}
+	rejected     atomic.Int64
+}
+
+// Stats returns the current activity of the admission.
+func (a *Admission) Stats() AdmissionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return AdmissionStats{Establishing: a.establishing, Queued: len(a.queue), Rejected: a.rejected.Load()}
+}
+
+// admit waits for a connection to be established, it returns false when the request is rejected.
+// The returned function must be called once the connection is established, or failed to be, it
+// may be called several times.
+func (a *Admission) admit(ctx context.Context) (func(), bool) {
+	a.mu.Lock()
+	if a.establishing < a.MaxConcurrent {
+		a.establishing++
+		a.mu.Unlock()
+		return a.releaseFunc(), true
+	}
+	if len(a.queue) >= a.MaxQueue {
+		a.mu.Unlock()
+		a.rejected.Add(1)
+		return nil, false
+	}
+	admitted := make(chan struct{})
+	a.queue = append(a.queue, admitted)
+	a.mu.Unlock()
+
+	maxWait := a.MaxWait
+	if maxWait <= 0 {
+		maxWait = defaultAdmissionMaxWait
+	}
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	select {
+	case <-admitted:
+		return a.releaseFunc(), true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	a.mu.Lock()
+	if i := slices.Index(a.queue, admitted); i >= 0 {
+		a.queue = slices.Delete(a.queue, i, i+1)
+		a.mu.Unlock()
+		a.rejected.Add(1)
+		return nil, false
+	}
+	a.mu.Unlock()
+	// admitted meanwhile
+	return a.releaseFunc(), true
+}
+
+func (a *Admission) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(a.release)
+	}
+}
+
+// release hands the slot of an established connection to the next request of the queue.
+func (a *Admission) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.queue) == 0 {
+		a.establishing--
+		return
+	}
+	close(a.queue[0])
+	a.queue[0] = nil
+	a.queue = a.queue[1:]
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmissionQueue(t *testing.T) {
+	a := &Admission{MaxConcurrent: 1, MaxQueue: 1, MaxWait: time.Minute}
+	ctx := context.Background()
+
+	release, ok := a.admit(ctx)
+	assert.True(t, ok)
+	queued := make(chan func())
+	go func() {
+		release, ok := a.admit(ctx)
+		assert.True(t, ok)
+		queued <- release
+	}()
+	assert.Eventually(t, func() bool { return a.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	_, ok = a.admit(ctx)
+	assert.False(t, ok, "Expected the requests beyond the queue to be rejected")
+
+	release()
+	release()
+	next := <-queued
+	assert.Equal(t, AdmissionStats{Establishing: 1, Rejected: 1}, a.Stats())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, ok = a.admit(cancelled)
+	assert.False(t, ok)
+	a.MaxWait = time.Millisecond
+	_, ok = a.admit(ctx)
+	assert.False(t, ok)
+
+	next()
+	assert.Equal(t, AdmissionStats{Rejected: 3}, a.Stats())
+}
+
+func TestWebsocketAdmission(t *testing.T) {
+	initialising := make(chan struct{})
+	proceed := make(chan struct{})
+	server := newTestServer(t, Websocket{
+		Admission:  &Admission{MaxConcurrent: 1},
+		RetryAfter: 5 * time.Second,
+		InitFunc: func(ctx context.Context, initPayload InitPayload) (context.Context, error) {
+			if initPayload.GetString("slow") != "" {
+				close(initialising)
+				<-proceed
+			}
+			return ctx, nil
+		},
+	}, testGraphQLService{})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"slow": "yes"}}))
+	<-initialising
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqltransportwsSubprotocol}}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	_, resp, err := dialer.Dial(url, nil)
+	if assert.Error(t, err) && assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+	}
+
+	close(proceed)
+	readMessageOfType(t, conn, "connection_ack")
+	other := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, other.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, other, "connection_ack")
+}
@@ -0,0 +1,245 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAuditBatchSize     = 100
+	defaultAuditFlushInterval = time.Second
+	defaultAuditBufferSize    = 10000
+)
+
+// AuditRecordType is the activity described by an AuditRecord.
+type AuditRecordType string
+
+const (
+	// AuditConnected is recorded once a connection is initialised.
+	AuditConnected AuditRecordType = "connected"
+	// AuditDisconnected is recorded once an initialised connection is closed.
+	AuditDisconnected AuditRecordType = "disconnected"
+	// AuditOperationStarted is recorded once an operation is started by the GraphQLService.
+	AuditOperationStarted AuditRecordType = "operation_started"
+	// AuditOperationEnded is recorded once a started operation is completed or stopped.
+	AuditOperationEnded AuditRecordType = "operation_ended"
+)
+
+// AuditRecord is an activity of a connection.
+type AuditRecord struct {
+	Type AuditRecordType
+	Time time.Time
+
+	ConnectionID string
+	RemoteAddr   string
+	// Subject is who opened the connection, as returned by the SubjectFunc of the AuditLog.
+	Subject string
+	Tenant  string
+
+	// OperationID, OperationName and QueryHash are set for the records of operations.
+	OperationID   string
+	OperationName string
+	QueryHash     string
+
+	// Duration is how long the connection or the operation lasted, it is set for the records of
+	// their end.
+	Duration time.Duration
+	// Events is the number of payloads sent to the operation, or to every operation of the
+	// connection, it is set for the records of their end.
+	Events int64
+	// Errors are the errors the operation ended with.
+	Errors []string
+}
+
+// AuditSink stores the records of an AuditLog, e.g. in a file, a database or a SIEM. Records are
+// written in batches by a single goroutine.
+type AuditSink interface {
+	WriteAudit(ctx context.Context, records []AuditRecord) error
+}
+
+// AuditSinkFunc is an AuditSink function.
+type AuditSinkFunc func(ctx context.Context, records []AuditRecord) error
+
+// WriteAudit implements AuditSink
+func (f AuditSinkFunc) WriteAudit(ctx context.Context, records []AuditRecord) error {
+	return f(ctx, records)
+}
+
+// AuditLog records who connects, from where, which operations they start, how long they last and
+// how many events they receive. The records are queued and delivered to the Sink in batches, off
+// the goroutines serving the connections.
+type AuditLog struct {
+	Sink AuditSink
+	// BatchSize is the maximum number of records written at once, it defaults to 100.
+	BatchSize int
+	// FlushInterval is the maximum time a record waits for its batch to fill up, it defaults to
+	// one second.
+	FlushInterval time.Duration
+	// BufferSize is the number of records queued for the Sink, it defaults to 10000. Records are
+	// dropped when the queue is full.
+	BufferSize int
+
+	// SubjectFunc returns who opened a connection, e.g. the user authenticated by the InitFunc.
+	SubjectFunc func(ctx context.Context) string
+	// ErrorFunc is called when the Sink fails to write a batch, or with ErrAuditRecordsDropped
+	// when records are dropped.
+	ErrorFunc func(err error)
+
+	once    sync.Once
+	records chan AuditRecord
+	done    chan struct{}
+	closed  bool
+	dropped atomic.Int64
+	mu      sync.RWMutex
+}
+
+// ErrAuditRecordsDropped is reported to the ErrorFunc of an AuditLog when its queue is full.
+var ErrAuditRecordsDropped = errors.New("audit records dropped")
+
+func (a *AuditLog) start() {
+	a.once.Do(func() {
+		size := a.BufferSize
+		if size <= 0 {
+			size = defaultAuditBufferSize
+		}
+		a.records = make(chan AuditRecord, size)
+		a.done = make(chan struct{})
+		go a.run()
+	})
+}
+
+// record queues a record, it never blocks.
+func (a *AuditLog) record(r AuditRecord) {
+	a.start()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.records <- r:
+	default:
+		if a.dropped.Add(1) == 1 && a.ErrorFunc != nil {
+			a.ErrorFunc(ErrAuditRecordsDropped)
+		}
+	}
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (a *AuditLog) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+func (a *AuditLog) run() {
+	defer close(a.done)
+
+	batchSize := a.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultAuditBatchSize
+	}
+	interval := a.FlushInterval
+	if interval <= 0 {
+		interval = defaultAuditFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]AuditRecord, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.Sink.WriteAudit(context.Background(), batch); err != nil && a.ErrorFunc != nil {
+			a.ErrorFunc(err)
+		}
+		batch = make([]AuditRecord, 0, batchSize)
+	}
+	for {
+		select {
+		case r, more := <-a.records:
+			if !more {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close delivers the queued records to the Sink and stops recording, it returns the error of the
+// context if it is done first.
+func (a *AuditLog) Close(ctx context.Context) error {
+	a.start()
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.records)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// auditRecord returns a record of the connection.
+func (c *wsConnection) auditRecord(t AuditRecordType) AuditRecord {
+	r := AuditRecord{Type: t, Time: time.Now(), Tenant: GetTenant(c.ctx)}
+	if info := GetConnectionInfo(c.ctx); info != nil {
+		r.ConnectionID = info.ID
+		r.RemoteAddr = info.RemoteAddr
+	}
+	if c.Audit.SubjectFunc != nil {
+		r.Subject = c.Audit.SubjectFunc(c.ctx)
+	}
+	return r
+}
+
+// auditConnected records the connection and returns the function recording its end.
+func (c *wsConnection) auditConnected() func() {
+	connected := c.auditRecord(AuditConnected)
+	c.Audit.record(connected)
+	return func() {
+		r := connected
+		r.Type = AuditDisconnected
+		r.Time = time.Now()
+		r.Duration = r.Time.Sub(connected.Time)
+		r.Events = c.auditEvents.Load()
+		c.Audit.record(r)
+	}
+}
+
+// auditOperation records an operation once started and returns the function recording its end
+// with the number of payloads sent.
+func (c *wsConnection) auditOperation(ctx context.Context) func(events int64) {
+	started := c.auditRecord(AuditOperationStarted)
+	if op := GetOperationInfo(ctx); op != nil {
+		started.OperationID = op.ID
+		started.OperationName = op.Name
+		started.QueryHash = op.QueryHash
+	}
+	c.Audit.record(started)
+	return func(events int64) {
+		r := started
+		r.Type = AuditOperationEnded
+		r.Time = time.Now()
+		r.Duration = r.Time.Sub(started.Time)
+		r.Events = events
+		for _, err := range getSubscriptionError(ctx) {
+			r.Errors = append(r.Errors, err.Message)
+		}
+		c.auditEvents.Add(events)
+		c.Audit.record(r)
+	}
+}
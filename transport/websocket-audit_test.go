@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testUserCtxKey struct{}
+
+type testAuditSink struct {
+	mu      sync.Mutex
+	batches [][]AuditRecord
+}
+
+func (s *testAuditSink) WriteAudit(ctx context.Context, records []AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, records)
+	return nil
+}
+
+func (s *testAuditSink) records() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []AuditRecord
+	for _, batch := range s.batches {
+		records = append(records, batch...)
+	}
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	sink := &testAuditSink{}
+	audit := &AuditLog{
+		Sink:          sink,
+		FlushInterval: 10 * time.Millisecond,
+		SubjectFunc: func(ctx context.Context) string {
+			user, _ := ctx.Value(testUserCtxKey{}).(string)
+			return user
+		},
+	}
+	server := newTestServer(t, Websocket{
+		Audit: audit,
+		InitFunc: func(ctx context.Context, initPayload InitPayload) (context.Context, error) {
+			return context.WithValue(ctx, testUserCtxKey{}, initPayload.GetString("user")), nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 2)
+			payloads <- map[string]interface{}{"data": 1}
+			payloads <- map[string]interface{}{"data": 2}
+			close(payloads)
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"user": "alice"}}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription Values { value }"}}))
+	readMessageOfType(t, conn, "complete")
+	conn.Close()
+
+	assert.Eventually(t, func() bool { return len(sink.records()) == 4 }, time.Second, time.Millisecond)
+	records := sink.records()
+	types := make([]AuditRecordType, len(records))
+	for i, r := range records {
+		types[i] = r.Type
+		assert.Equal(t, "alice", r.Subject)
+		assert.NotEmpty(t, r.ConnectionID)
+		assert.NotEmpty(t, r.RemoteAddr)
+	}
+	assert.Equal(t, []AuditRecordType{AuditConnected, AuditOperationStarted, AuditOperationEnded, AuditDisconnected}, types)
+	assert.Equal(t, "1", records[1].OperationID)
+	assert.Equal(t, "Values", records[1].OperationName)
+	assert.NotEmpty(t, records[1].QueryHash)
+	assert.Equal(t, int64(2), records[2].Events)
+	assert.Equal(t, int64(2), records[3].Events)
+	assert.NoError(t, audit.Close(context.Background()))
+}
+
+func TestAuditLogBatches(t *testing.T) {
+	sink := &testAuditSink{}
+	audit := &AuditLog{Sink: sink, BatchSize: 2, FlushInterval: time.Hour}
+	for i := 0; i < 5; i++ {
+		audit.record(AuditRecord{Type: AuditConnected})
+	}
+	assert.Eventually(t, func() bool {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		return len(sink.batches) == 2
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, audit.Close(context.Background()))
+	assert.Len(t, sink.batches, 3)
+	assert.Len(t, sink.batches[2], 1)
+
+	audit.record(AuditRecord{Type: AuditConnected})
+	assert.Len(t, sink.records(), 5)
+}
+
+func TestAuditLogDrops(t *testing.T) {
+	block := make(chan struct{})
+	var mu sync.Mutex
+	var errs []error
+	audit := &AuditLog{
+		Sink: AuditSinkFunc(func(ctx context.Context, records []AuditRecord) error {
+			<-block
+			return errors.New("sink down")
+		}),
+		BatchSize:  1,
+		BufferSize: 1,
+		ErrorFunc: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	}
+	audit.record(AuditRecord{})
+	assert.Eventually(t, func() bool { return len(audit.records) == 0 }, time.Second, time.Millisecond)
+	audit.record(AuditRecord{})
+	audit.record(AuditRecord{})
+	assert.Equal(t, int64(1), audit.Dropped())
+	mu.Lock()
+	assert.Equal(t, []error{ErrAuditRecordsDropped}, errs)
+	mu.Unlock()
+
+	close(block)
+	assert.NoError(t, audit.Close(context.Background()))
+	assert.Len(t, errs, 3)
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// CodeForbidden is the code of the errors of the operations the client isn't allowed to start.
+const CodeForbidden = "FORBIDDEN"
+
+// ForbiddenError rejects an operation the client isn't allowed to start, it is sent with the
+// FORBIDDEN code. The errors of the AuthorizeOperation are wrapped in a ForbiddenError, the
+// SubscribeFunc may return one too.
+type ForbiddenError struct {
+	Err error
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return e.Err
+}
+
+// authorizeOperation calls the AuthorizeOperation with the operation of params.
+func (c *wsConnection) authorizeOperation(ctx context.Context, params *startMessagePayload) error {
+	op := params.operation
+	if op == nil {
+		doc, err := parser.ParseQuery(&ast.Source{Input: params.Query})
+		if err != nil {
+			var gqlErr *gqlerror.Error
+			if errors.As(err, &gqlErr) {
+				return gqlErr
+			}
+			return err
+		}
+		if params.OperationName != "" {
+			op = doc.Operations.ForName(params.OperationName)
+		} else if len(doc.Operations) == 1 {
+			op = doc.Operations[0]
+		}
+		if op == nil {
+			return gqlerror.Errorf("operation %s not found", params.OperationName)
+		}
+		// the validation resolves the fragments of the spreads when there is a Schema
+		resolveFragments(doc, op.SelectionSet, map[string]bool{})
+	}
+	if err := c.AuthorizeOperation(ctx, op, params.Variables); err != nil {
+		var forbidden *ForbiddenError
+		if errors.As(err, &forbidden) {
+			return err
+		}
+		return &ForbiddenError{Err: err}
+	}
+	return nil
+}
+
+// resolveFragments sets the definition of the fragment spreads of a selection set from the
+// fragments of doc.
+func resolveFragments(doc *ast.QueryDocument, set ast.SelectionSet, visited map[string]bool) {
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			resolveFragments(doc, selection.SelectionSet, visited)
+		case *ast.InlineFragment:
+			resolveFragments(doc, selection.SelectionSet, visited)
+		case *ast.FragmentSpread:
+			if selection.Definition == nil {
+				selection.Definition = doc.Fragments.ForName(selection.Name)
+			}
+			if selection.Definition != nil && !visited[selection.Name] {
+				visited[selection.Name] = true
+				resolveFragments(doc, selection.Definition.SelectionSet, visited)
+			}
+		}
+	}
+}
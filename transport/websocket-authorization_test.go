@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// authorizeRoom allows the operations on the lobby only, and requires the definition of the fields
+// when requireDefinitions is set.
+func authorizeRoom(requireDefinitions bool) WebsocketAuthorizeOperationFunc {
+	var authorize func(set ast.SelectionSet, variables map[string]interface{}) error
+	authorize = func(set ast.SelectionSet, variables map[string]interface{}) error {
+		for _, selection := range set {
+			switch selection := selection.(type) {
+			case *ast.FragmentSpread:
+				if selection.Definition == nil {
+					return errors.New("no fragment")
+				}
+				if err := authorize(selection.Definition.SelectionSet, variables); err != nil {
+					return err
+				}
+			case *ast.Field:
+				if requireDefinitions && selection.Definition == nil {
+					return errors.New("no definition")
+				}
+				room := selection.Arguments.ForName("room")
+				if room == nil {
+					return errors.New("no room")
+				}
+				if value, err := room.Value.Value(variables); err != nil || value != "lobby" {
+					return errors.New("room not allowed")
+				}
+			}
+		}
+		return nil
+	}
+	return func(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) error {
+		return authorize(op.SelectionSet, variables)
+	}
+}
+
+func TestAuthorizeOperation(t *testing.T) {
+	queries := map[string]string{
+		"fields":    "subscription Messages($room: ID!) { messages(room: $room) }",
+		"fragments": "subscription Messages($room: ID!) { ...Room } fragment Room on Subscription { messages(room: $room) }",
+	}
+	for name, ws := range map[string]Websocket{
+		"without schema": {AuthorizeOperation: authorizeRoom(false)},
+		"with schema":    {AuthorizeOperation: authorizeRoom(true), Schema: testValidationSchema},
+	} {
+		for selection, query := range queries {
+			t.Run(name+" "+selection, func(t *testing.T) {
+				started := make(chan string, 2)
+				server := newTestServer(t, ws, testGraphQLService{
+					subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+						started <- variableValues["room"].(string)
+						return make(chan interface{}), nil
+					},
+				})
+
+				conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+				assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+				readMessageOfType(t, conn, "connection_ack")
+
+				assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+					"query": query, "variables": map[string]interface{}{"room": "admins"},
+				}}))
+				var errs []map[string]interface{}
+				assert.NoError(t, json.Unmarshal(readMessageOfType(t, conn, "error")["payload"], &errs))
+				assert.Equal(t, []map[string]interface{}{{"message": "room not allowed", "extensions": map[string]interface{}{"code": CodeForbidden}}}, errs)
+
+				assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "payload": map[string]interface{}{
+					"query": query, "variables": map[string]interface{}{"room": "lobby"},
+				}}))
+				select {
+				case room := <-started:
+					assert.Equal(t, "lobby", room)
+				case <-time.After(time.Second):
+					t.Fatal("Expected the operation to be started")
+				}
+				assert.Empty(t, started)
+			})
+		}
+	}
+}
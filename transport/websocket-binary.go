@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// binaryExtension is the operation extension requesting the Binary values as binary frames.
+const binaryExtension = "binary"
+
+// binaryKey is the key of the JSON objects encoding a Binary value.
+const binaryKey = "$binary"
+
+// binaryFrameType is the type of the recorded binary frames.
+const binaryFrameType = "binary"
+
+// Binary is a binary value of a payload, e.g. an image or a protobuf blob. It is encoded as
+// {"$binary":"<base64 data>","contentType":"..."}, unless the operation receives the binary values
+// as binary frames, see Websocket.BinaryPayloads.
+type Binary struct {
+	ContentType string
+	Data        []byte
+}
+
+// MarshalJSON implements json.Marshaler
+func (b Binary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Data        []byte `json:"$binary"`
+		ContentType string `json:"contentType,omitempty"`
+	}{b.Data, b.ContentType})
+}
+
+// BinaryRef references the binary frame of a Binary value in a payload, it is encoded as
+// {"$binary":{"ref":1,"contentType":"...","size":1024}}.
+type BinaryRef struct {
+	Ref         uint32 `json:"ref"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// wantsBinaryFrames returns true if the operation of ctx receives the binary values as binary
+// frames. The connections sealing or signing their payloads receive them in the payloads, the
+// binary frames would be sent in clear.
+func (c *wsConnection) wantsBinaryFrames(ctx context.Context) bool {
+	if !c.BinaryPayloads || c.cipher != nil || c.PayloadSigning != nil {
+		return false
+	}
+	wants, _ := GetOperationExtensions(ctx)[binaryExtension].(bool)
+	return wants
+}
+
+// binaryFrames returns the payload referencing the Binary values of a payload and their binary
+// frames. Every frame is the big-endian uint32 ref of its BinaryRef followed by the data, it is
+// written before the payload referencing it.
+func (c *wsConnection) binaryFrames(payload []byte) ([]byte, [][]byte, error) {
+	if !bytes.Contains(payload, []byte(`"`+binaryKey+`"`)) {
+		return payload, nil, nil
+	}
+	var v interface{}
+	if err := jsonDecode(payload, &v); err != nil {
+		return nil, nil, err
+	}
+	var frames [][]byte
+	v, err := c.extractBinary(v, &frames)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(frames) == 0 {
+		return payload, nil, nil
+	}
+	b, err := json.Marshal(v)
+	return b, frames, err
+}
+
+// sendMessage writes the binary frames of a message then the message, c.mu must be held.
+func (c *wsConnection) sendMessage(msg *message) error {
+	if err := c.writeBinaryFrames(msg); err != nil {
+		return err
+	}
+	return c.me.Send(msg)
+}
+
+// writeBinaryFrames writes the binary frames of a message, c.mu must be held.
+func (c *wsConnection) writeBinaryFrames(msg *message) error {
+	for _, frame := range msg.frames {
+		if err := c.conn.WriteBinary(frame); err != nil {
+			return fmt.Errorf("writing binary frame: %w", err)
+		}
+		if c.observe != nil {
+			// the recorded frames hold JSON, the binary frames are recorded as base64 strings
+			data, _ := json.Marshal(frame)
+			c.observe.frame(FrameOutbound, data, binaryFrameType, msg.id)
+		}
+	}
+	return nil
+}
+
+// extractBinary replaces the Binary values of v with their BinaryRef and appends their frames.
+func (c *wsConnection) extractBinary(v interface{}, frames *[][]byte) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if encoded, ok := v[binaryKey].(string); ok {
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, err
+			}
+			contentType, _ := v["contentType"].(string)
+			ref := BinaryRef{Ref: c.nextBinaryRef.Add(1), ContentType: contentType, Size: len(data)}
+			frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), ref.Ref)
+			*frames = append(*frames, append(frame, data...))
+			return map[string]interface{}{binaryKey: ref}, nil
+		}
+		for key, value := range v {
+			replaced, err := c.extractBinary(value, frames)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = replaced
+		}
+	case []interface{}:
+		for i, value := range v {
+			replaced, err := c.extractBinary(value, frames)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = replaced
+		}
+	}
+	return v, nil
+}
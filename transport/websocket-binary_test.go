@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func subscribeBinaryTestServer(t *testing.T, ws Websocket, extensions map[string]interface{}) *websocket.Conn {
+	payloads := make(chan interface{}, 1)
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"avatar": Binary{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}}}
+	ws.BinaryPayloads = true
+	server := newTestServer(t, ws, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query":      "subscription { avatar }",
+		"extensions": extensions,
+	}}))
+	return conn
+}
+
+func TestSubscribeSendsBinaryFrames(t *testing.T) {
+	recorder := NewRingRecorder(8)
+	conn := subscribeBinaryTestServer(t, Websocket{Recorder: recorder}, map[string]interface{}{"binary": true})
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	typ, frame, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.BinaryMessage, typ)
+	if assert.Len(t, frame, 8) {
+		assert.Equal(t, uint32(1), binary.BigEndian.Uint32(frame))
+		assert.Equal(t, []byte{0x89, 'P', 'N', 'G'}, frame[4:])
+	}
+
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"avatar": map[string]interface{}{
+		"$binary": map[string]interface{}{"ref": float64(1), "contentType": "image/png", "size": float64(4)},
+	}}}, readResponse(t, conn))
+
+	var binaryFrames []Frame
+	for _, f := range recorder.Frames() {
+		if f.Type == binaryFrameType {
+			binaryFrames = append(binaryFrames, f)
+		}
+	}
+	if assert.Len(t, binaryFrames, 1) {
+		assert.Equal(t, "1", binaryFrames[0].ID)
+		assert.Equal(t, `"AAAAAYlQTkc="`, string(binaryFrames[0].Data))
+	}
+}
+
+func TestSubscribeSealsBinaryValues(t *testing.T) {
+	pc, err := NewAESGCMCipher(make([]byte, 16))
+	assert.NoError(t, err)
+	conn := subscribeBinaryTestServer(t, Websocket{PayloadEncryption: &PayloadEncryption{
+		CipherFunc: func(ctx context.Context, initPayload InitPayload) (PayloadCipher, error) { return pc, nil },
+	}}, map[string]interface{}{"binary": true})
+
+	// the Binary values are sealed with the payload rather than sent in clear as binary frames
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	typ, b, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, typ)
+	var msg struct {
+		Type    string
+		Payload struct{ Sealed []byte }
+	}
+	assert.NoError(t, json.Unmarshal(b, &msg))
+	assert.Equal(t, "next", msg.Type)
+	opened, err := pc.Open(msg.Payload.Sealed)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"avatar":{"$binary":"iVBORw==","contentType":"image/png"}}}`, string(opened))
+}
+
+func TestSubscribeSendsBase64WithoutBinaryExtension(t *testing.T) {
+	conn := subscribeBinaryTestServer(t, Websocket{}, nil)
+
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"avatar": map[string]interface{}{
+		"$binary": "iVBORw==", "contentType": "image/png",
+	}}}, readResponse(t, conn))
+}
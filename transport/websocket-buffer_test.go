@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeJSONMatchesMarshal(t *testing.T) {
+	msg := &graphqltransportwsMessage{
+		ID:      "1",
+		Type:    graphqltransportwsNextMsg,
+		Payload: json.RawMessage(`{"data": {"html": "<b>&</b>"}}`),
+	}
+
+	expected, err := json.Marshal(msg)
+	assert.NoError(t, err)
+
+	b, err := encodeJSON(&bytes.Buffer{}, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(b))
+}
+
+func TestPutBufferDropsLargeBuffers(t *testing.T) {
+	buf := getBuffer()
+	buf.Grow(maxPooledBufferSize * 2)
+	putBuffer(buf)
+
+	assert.LessOrEqual(t, getBuffer().Cap(), maxPooledBufferSize)
+}
+
+func TestRecordedFramesOutliveBuffers(t *testing.T) {
+	recorder := NewRingRecorder(10)
+	server := newTestServer(t, Websocket{Recorder: recorder}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "ping"}))
+	readMessageOfType(t, conn, "pong")
+
+	var types []string
+	for _, f := range recorder.Frames() {
+		var m map[string]interface{}
+		assert.NoError(t, json.Unmarshal(f.Data, &m))
+		types = append(types, m["type"].(string))
+	}
+	assert.Equal(t, []string{"connection_init", "connection_ack", "ping", "pong"}, types)
+}
+
+// benchmarkExchanger returns an exchanger writing to a server discarding every message.
+func benchmarkExchanger(b *testing.B) graphqltransportwsMessageExchanger {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}))
+	b.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	return graphqltransportwsMessageExchanger{c: clientSocket{conn}}
+}
+
+// clientSocket writes to a gorilla client connection whatever the socket the package is built with.
+type clientSocket struct {
+	*websocket.Conn
+}
+
+func (s clientSocket) ReadMessage(buf *bytes.Buffer) error {
+	_, r, err := s.NextReader()
+	if err != nil {
+		return err
+	}
+	_, err = buf.ReadFrom(r)
+	return err
+}
+
+func (s clientSocket) Extensions() []string {
+	return nil
+}
+
+func (s clientSocket) WriteMessage(data []byte) error {
+	return s.Conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (s clientSocket) WriteBinary(data []byte) error {
+	return s.Conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (s clientSocket) WriteClose(code int, text string) error {
+	return s.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+}
+
+func (s clientSocket) OnPing(fn func()) {}
+
+func BenchmarkExchangerSend(b *testing.B) {
+	me := benchmarkExchanger(b)
+	msg := &message{t: dataMessageType, id: "1", payload: json.RawMessage(`{"data":{"value":1}}`)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := me.Send(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSendResponse(b *testing.B) {
+	c := &wsConnection{me: benchmarkExchanger(b)}
+	response := []byte(`{"data":{"value":1}}`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.sendResponse("1", response, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
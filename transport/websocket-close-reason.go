@@ -2,6 +2,11 @@ package transport
 
 import (
 	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // A private key for context that only this package can access. This is important
@@ -12,11 +17,106 @@ type wsCloseReasonContextKey struct {
 	name string
 }
 
+// retryAfterSuffix separates the delay advertised by a close reason from its text.
+const retryAfterSuffix = "; retry-after="
+
+// CloseReason is why the server closes a connection. The code and the text are sent in the close
+// frame, the clients decide whether to reconnect with Retryable and RetryAfter.
+type CloseReason struct {
+	Code   int
+	Reason string
+	// RetryAfter is how long the clients should wait before reconnecting, it is sent as a
+	// "; retry-after=<seconds>" suffix of the text.
+	RetryAfter time.Duration
+}
+
+// The close reasons sent by the transport.
+var (
+	// CloseReasonTerminated closes the connections ended by the client or by the server, through
+	// their context or a failing InitFunc.
+	CloseReasonTerminated = CloseReason{Code: closeNormalClosure, Reason: "terminated"}
+	// CloseReasonShuttingDown closes the connections of a server shutting down, the clients are
+	// expected to reconnect to another node.
+	CloseReasonShuttingDown = CloseReason{Code: closeGoingAway, Reason: "server shutting down"}
+	// CloseReasonUnexpectedMessage closes the connections receiving a message not allowed by the
+	// protocol in their state.
+	CloseReasonUnexpectedMessage = CloseReason{Code: closeProtocolError, Reason: "unexpected message"}
+	// CloseReasonDecodingError closes the connections receiving a message that isn't valid JSON.
+	CloseReasonDecodingError = CloseReason{Code: closeProtocolError, Reason: "decoding error"}
+	// CloseReasonInitTimeout closes the connections not initialised within the InitTimeout.
+	CloseReasonInitTimeout = CloseReason{Code: closeProtocolError, Reason: "connection initialisation timeout"}
+	// CloseReasonPongTimeout closes the connections not answering pings.
+	CloseReasonPongTimeout = CloseReason{Code: closeProtocolError, Reason: "pong timeout"}
+	// CloseReasonKeepAliveTimeout closes the graphql-ws connections not sending keep alives within
+	// the ClientKeepAliveTimeout.
+	CloseReasonKeepAliveTimeout = CloseReason{Code: closeProtocolError, Reason: "keep alive timeout"}
+	// CloseReasonUnexpectedClosure closes the connections failing to read a message.
+	CloseReasonUnexpectedClosure = CloseReason{Code: closeAbnormalClosure, Reason: "unexpected closure"}
+	// CloseReasonEventLoopClosed closes the connections handed to a closed EventLoop.
+	CloseReasonEventLoopClosed = CloseReason{Code: closeTryAgainLater, Reason: "event loop closed"}
+	// CloseReasonTenantConnections closes the connections beyond the limit of their tenant.
+	CloseReasonTenantConnections = CloseReason{Code: closeTryAgainLater, Reason: "too many connections for the tenant"}
+	// CloseReasonQuotaExceeded closes the connections breaching a Quota with the QuotaClose action.
+	CloseReasonQuotaExceeded = CloseReason{Code: closeQuotaExceeded, Reason: "quota exceeded"}
+)
+
+// Text returns the text of the close frame.
+func (r CloseReason) Text() string {
+	if r.RetryAfter <= 0 {
+		return r.Reason
+	}
+	return r.Reason + retryAfterSuffix + strconv.Itoa(int((r.RetryAfter+time.Second-1)/time.Second))
+}
+
+// Jittered returns a copy of the reason whose RetryAfter is extended by a random delay up to max,
+// so that the clients of the connections closed at once don't reconnect at once.
+func (r CloseReason) Jittered(max time.Duration) CloseReason {
+	if max > 0 {
+		r.RetryAfter += rand.N(max + 1)
+	}
+	return r
+}
+
+// Retryable returns true if the client may reconnect: the server went away, failed, or asked to
+// try again later. The connections closed because of the client, with a protocol error or one of
+// the 4xxx codes of graphql-transport-ws, would be closed the same way again.
+func (r CloseReason) Retryable() bool {
+	switch r.Code {
+	case closeGoingAway, closeAbnormalClosure, 1011, 1012, closeTryAgainLater, 1014:
+		return true
+	}
+	return false
+}
+
+// String implements fmt.Stringer
+func (r CloseReason) String() string {
+	return fmt.Sprintf("%d %s", r.Code, r.Text())
+}
+
+// ParseCloseReason returns the close reason of a close frame, the inverse of Text.
+func ParseCloseReason(code int, text string) CloseReason {
+	r := CloseReason{Code: code, Reason: text}
+	if i := strings.LastIndex(text, retryAfterSuffix); i >= 0 {
+		if seconds, err := strconv.Atoi(text[i+len(retryAfterSuffix):]); err == nil && seconds >= 0 {
+			r.Reason = text[:i]
+			r.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return r
+}
+
+// AppendCloseReason closes the connection of ctx with 1000 and the given reason once ctx is done.
 func AppendCloseReason(ctx context.Context, reason string) context.Context {
+	return WithCloseReason(ctx, CloseReason{Code: closeNormalClosure, Reason: reason})
+}
+
+// WithCloseReason closes the connection of ctx with the given reason once ctx is done, e.g. from
+// the InitFunc to close the connection when the credentials of the client expire.
+func WithCloseReason(ctx context.Context, reason CloseReason) context.Context {
 	return context.WithValue(ctx, closeReasonCtxKey, reason)
 }
 
-func closeReasonForContext(ctx context.Context) string {
-	reason, _ := ctx.Value(closeReasonCtxKey).(string)
-	return reason
+func closeReasonForContext(ctx context.Context) (CloseReason, bool) {
+	reason, ok := ctx.Value(closeReasonCtxKey).(CloseReason)
+	return reason, ok
 }
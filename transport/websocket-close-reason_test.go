@@ -3,13 +3,110 @@ package transport
 import (
 	"context"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCloseReasonForContext_NoReason(t *testing.T) {
 	ctx := context.Background()
 
 	// Test retrieving from a context without a set reason
-	if got := closeReasonForContext(ctx); got != "" {
-		t.Errorf("closeReasonForContext() = %v, want empty string", got)
+	if got, ok := closeReasonForContext(ctx); ok {
+		t.Errorf("closeReasonForContext() = %v, want no reason", got)
+	}
+}
+
+func TestCloseReasonText(t *testing.T) {
+	r := CloseReason{Code: closeTryAgainLater, Reason: "maintenance", RetryAfter: 1500 * time.Millisecond}
+	assert.Equal(t, "maintenance; retry-after=2", r.Text())
+	assert.Equal(t, "1013 maintenance; retry-after=2", r.String())
+	assert.Equal(t, CloseReason{Code: closeTryAgainLater, Reason: "maintenance", RetryAfter: 2 * time.Second}, ParseCloseReason(r.Code, r.Text()))
+
+	assert.Equal(t, "terminated", CloseReasonTerminated.Text())
+	assert.Equal(t, CloseReasonTerminated, ParseCloseReason(closeNormalClosure, "terminated"))
+	assert.Equal(t, CloseReason{Code: closeNormalClosure, Reason: "a; retry-after=soon"}, ParseCloseReason(closeNormalClosure, "a; retry-after=soon"))
+}
+
+func TestCloseReasonRetryable(t *testing.T) {
+	for _, r := range []CloseReason{CloseReasonShuttingDown, CloseReasonUnexpectedClosure, CloseReasonEventLoopClosed, CloseReasonTenantConnections} {
+		assert.True(t, r.Retryable(), r.String())
+	}
+	for _, r := range []CloseReason{CloseReasonTerminated, CloseReasonUnexpectedMessage, CloseReasonInitTimeout, CloseReasonQuotaExceeded, {Code: closeSubscriberAlreadyExists}} {
+		assert.False(t, r.Retryable(), r.String())
+	}
+}
+
+func TestWithCloseReason(t *testing.T) {
+	cancelConn := make(chan struct{})
+	server := newTestServer(t, Websocket{
+		InitFunc: func(ctx context.Context, initPayload InitPayload) (context.Context, error) {
+			ctx, cancel := context.WithCancel(ctx)
+			go func() {
+				<-cancelConn
+				cancel()
+			}()
+			return WithCloseReason(ctx, CloseReason{Code: 4401, Reason: "credentials expired"}), nil
+		},
+	}, testGraphQLService{})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	close(cancelConn)
+
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if assert.ErrorAs(t, err, &closeErr) {
+		assert.Equal(t, 4401, closeErr.Code)
+		assert.Equal(t, "credentials expired", closeErr.Text)
+	}
+}
+
+func TestCloseReasonJittered(t *testing.T) {
+	r := CloseReason{Code: closeTryAgainLater, Reason: "maintenance", RetryAfter: 10 * time.Second}
+	seen := map[time.Duration]bool{}
+	for range 100 {
+		jittered := r.Jittered(5 * time.Second)
+		assert.GreaterOrEqual(t, jittered.RetryAfter, 10*time.Second)
+		assert.LessOrEqual(t, jittered.RetryAfter, 15*time.Second)
+		seen[jittered.RetryAfter] = true
+	}
+	assert.Greater(t, len(seen), 1, "Expected random delays")
+	assert.Equal(t, r, r.Jittered(0))
+}
+
+func TestReconnectJitter(t *testing.T) {
+	for reason, retryable := range map[CloseReason]bool{CloseReasonLifetimeExceeded: true, CloseReasonTerminated: false} {
+		server := newTestServer(t, Websocket{
+			ReconnectJitter: time.Minute,
+			InitFunc: func(ctx context.Context, initPayload InitPayload) (context.Context, error) {
+				ctx, cancel := context.WithCancel(ctx)
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return WithCloseReason(ctx, reason), nil
+			},
+		}, testGraphQLService{})
+
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		var err error
+		for err == nil {
+			_, _, err = conn.ReadMessage()
+		}
+		var closeErr *websocket.CloseError
+		if assert.ErrorAs(t, err, &closeErr) {
+			parsed := ParseCloseReason(closeErr.Code, closeErr.Text)
+			assert.Equal(t, reason.Reason, parsed.Reason)
+			if retryable {
+				assert.LessOrEqual(t, parsed.RetryAfter, time.Minute)
+				assert.Contains(t, closeErr.Text, "; retry-after=")
+			} else {
+				assert.Zero(t, parsed.RetryAfter)
+			}
+		}
 	}
 }
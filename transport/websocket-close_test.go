@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebsocketCloseDuringDelivery(t *testing.T) {
+	const operations = 8
+	registry := NewRegistry()
+	var ended atomic.Int64
+	server := newTestServer(t, Websocket{Registry: registry}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{})
+			go func() {
+				defer ended.Add(1)
+				defer close(payloads)
+				for i := 0; ; i++ {
+					select {
+					case payloads <- map[string]int{"value": i}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	for i := range operations {
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": fmt.Sprint(i), "payload": map[string]string{"query": "subscription { value }"}}))
+	}
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+	assert.Eventually(t, func() bool {
+		conns := registry.Connections()
+		return len(conns) == 1 && len(conns[0].Subscriptions()) == operations
+	}, time.Second, time.Millisecond)
+	c := registry.Connections()[0]
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range operations / 2 {
+			_ = conn.WriteJSON(map[string]interface{}{"type": "complete", "id": fmt.Sprint(i)})
+		}
+	}()
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close(websocket.CloseGoingAway, "closing")
+		}()
+	}
+	wg.Wait()
+
+	// the close frame may be lost when the connection is reset with stop messages left unread
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the connection to be closed")
+	}
+	assert.Eventually(t, func() bool { return ended.Load() == operations }, time.Second, time.Millisecond)
+}
+
+func TestWebsocketCloseDuringSubscribe(t *testing.T) {
+	registry := NewRegistry()
+	subscribing := make(chan struct{})
+	proceed := make(chan struct{})
+	ended := make(chan struct{})
+	server := newTestServer(t, Websocket{Registry: registry}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			close(subscribing)
+			<-proceed
+			payloads := make(chan interface{})
+			go func() {
+				<-ctx.Done()
+				close(ended)
+				close(payloads)
+			}()
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+	<-subscribing
+
+	c := registry.Connections()[0]
+	c.Close(websocket.CloseGoingAway, "first")
+	c.Close(websocket.CloseNormalClosure, "second")
+	close(proceed)
+
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if assert.True(t, errors.As(err, &closeErr), "Expected a close frame, got %v", err) {
+		assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+		assert.Equal(t, "first", closeErr.Text)
+	}
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the operation started while closing to be ended")
+	}
+}
+
+// floodingService sends 64KB payloads to every operation as fast as they are written, counting
+// the payloads sent and the operations ended.
+type floodingService struct {
+	sent, ended *atomic.Int64
+}
+
+func (s floodingService) service() testGraphQLService {
+	padding := strings.Repeat("x", 64<<10)
+	return testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{})
+			go func() {
+				defer s.ended.Add(1)
+				defer close(payloads)
+				for {
+					select {
+					case payloads <- map[string]interface{}{"data": map[string]string{"padding": padding}}:
+						s.sent.Add(1)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return payloads, nil
+		},
+	}
+}
+
+// waitForStuckWrites waits until no payload is sent anymore, the writes to a client not reading
+// being blocked once the buffers of the network connection are full.
+func waitForStuckWrites(t *testing.T, sent *atomic.Int64) {
+	t.Helper()
+	last := sent.Load()
+	assert.Eventually(t, func() bool {
+		current := sent.Load()
+		stuck := current == last && current > 0
+		last = current
+		return stuck
+	}, 10*time.Second, 200*time.Millisecond)
+}
+
+func TestWebsocketCloseClientNotReading(t *testing.T) {
+	const operations = 4
+	registry := NewRegistry()
+	var sent, ended atomic.Int64
+	server := newTestServer(t, Websocket{Registry: registry}, floodingService{&sent, &ended}.service())
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	for i := range operations {
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": fmt.Sprint(i), "payload": map[string]string{"query": "subscription { value }"}}))
+	}
+	// the client stops reading
+	waitForStuckWrites(t, &sent)
+	if !assert.Len(t, registry.Connections(), 1) {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		registry.Connections()[0].Close(closeGoingAway, "bye")
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected the close not to wait for the client")
+	}
+	assert.Eventually(t, func() bool { return ended.Load() == operations }, time.Second, 5*time.Millisecond, "Expected every operation to end")
+	assert.Eventually(t, func() bool { return registry.Count() == 0 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,180 @@
+package transport
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCoalescingWindow   = 5 * time.Millisecond
+	defaultCoalescingMaxBatch = 64
+)
+
+// WriteCoalescing groups the data/next messages written to a connection within Window. Clients
+// sending "batching": true in their connection_init payload receive every group as a single
+// websocket message holding a JSON array of protocol messages when Batching is enabled, others
+// receive the grouped messages back to back.
+//
+// Every other message flushes the pending ones first, so the order of the messages is preserved.
+type WriteCoalescing struct {
+	// Window defaults to 5ms
+	Window time.Duration
+	// MaxBatch is the number of pending messages flushing a group early, it defaults to 64
+	MaxBatch int
+	// Batching enables the batched envelope for the clients asking for it
+	Batching bool
+}
+
+// frameEncoder is implemented by the message exchangers able to encode a message without writing it.
+type frameEncoder interface {
+	encode(buf *bytes.Buffer, m *message) ([]byte, error)
+}
+
+type writeCoalescer struct {
+	c        *wsConnection
+	window   time.Duration
+	maxBatch int
+	batching bool
+
+	mu      sync.Mutex
+	pending []*message
+	timer   *time.Timer
+}
+
+func newWriteCoalescer(c *wsConnection) *writeCoalescer {
+	w := &writeCoalescer{
+		c:        c,
+		window:   c.WriteCoalescing.Window,
+		maxBatch: c.WriteCoalescing.MaxBatch,
+	}
+	if w.window == 0 {
+		w.window = defaultCoalescingWindow
+	}
+	if w.maxBatch == 0 {
+		w.maxBatch = defaultCoalescingMaxBatch
+	}
+	if _, ok := c.me.(frameEncoder); ok && c.WriteCoalescing.Batching {
+		batching, _ := c.initPayload["batching"].(bool)
+		w.batching = batching
+	}
+	return w
+}
+
+// write queues data messages and writes the others right after the pending ones.
+func (w *writeCoalescer) write(msg *message) {
+	var errs []error
+	// the errors are reported once unlocked, the ErrorFunc may close the connection which flushes
+	// the coalescer
+	defer func() { w.report(errs) }()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if msg.t != dataMessageType {
+		errs = append(w.flushLocked(), w.c.sendNow(msg))
+		return
+	}
+
+	// the payload may live in a pooled buffer, it must outlive the call
+	queued := *msg
+	queued.payload = append([]byte(nil), msg.payload...)
+	w.pending = append(w.pending, &queued)
+
+	if len(w.pending) >= w.maxBatch {
+		errs = w.flushLocked()
+		return
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.window, w.flush)
+	}
+}
+
+func (w *writeCoalescer) flush() {
+	w.mu.Lock()
+	errs := w.flushLocked()
+	w.mu.Unlock()
+	w.report(errs)
+}
+
+func (w *writeCoalescer) report(errs []error) {
+	for _, err := range errs {
+		w.c.handlePossibleError(err, false)
+	}
+}
+
+// flushLocked writes the pending messages and returns the errors to report once w.mu is released.
+func (w *writeCoalescer) flushLocked() []error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	pending := w.pending
+	w.pending = nil
+	// the pending messages are written right away once the connection is closing
+	if len(pending) != 0 && w.c.FaultInjector != nil && !w.c.closing.Load() {
+		w.c.FaultInjector.delayWrite()
+	}
+	switch {
+	case len(pending) == 0:
+		return nil
+	case len(pending) == 1 || !w.batching:
+		var errs []error
+		w.c.mu.Lock()
+		for _, msg := range pending {
+			err := w.c.send(msg)
+			w.c.deadLetterWriteLocked(err, msg)
+			errs = append(errs, err)
+		}
+		w.c.mu.Unlock()
+		return errs
+	default:
+		w.c.mu.Lock()
+		var start time.Time
+		if w.c.slowConsumer != nil {
+			start = w.c.slowConsumer.startWrite()
+		}
+		err := w.writeBatch(pending)
+		if w.c.slowConsumer != nil {
+			w.c.slowConsumer.observeWrite(start)
+		}
+		w.c.deadLetterWriteLocked(err, pending...)
+		w.c.mu.Unlock()
+		return []error{err}
+	}
+}
+
+// writeBatch writes messages as a single websocket message holding a JSON array.
+func (w *writeCoalescer) writeBatch(messages []*message) error {
+	enc := w.c.me.(frameEncoder)
+	batch := getBuffer()
+	defer putBuffer(batch)
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	// the binary frames are written before the batch referencing them
+	for _, msg := range messages {
+		if err := w.c.writeBinaryFrames(msg); err != nil {
+			return err
+		}
+	}
+
+	batch.WriteByte('[')
+	for _, msg := range messages {
+		buf.Reset()
+		b, err := enc.encode(buf, msg)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			continue
+		}
+		if batch.Len() > 1 {
+			batch.WriteByte(',')
+		}
+		batch.Write(b)
+	}
+	batch.WriteByte(']')
+
+	return w.c.conn.WriteMessage(batch.Bytes())
+}
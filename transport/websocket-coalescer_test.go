@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func startCoalescedSubscription(t *testing.T, coalescing *WriteCoalescing, initPayload map[string]interface{}) (*websocket.Conn, chan interface{}) {
+	payloads := make(chan interface{})
+	server := newTestServer(t, Websocket{WriteCoalescing: coalescing}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": initPayload}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+	return conn, payloads
+}
+
+func readRaw(t *testing.T, conn *websocket.Conn) []byte {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, b, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriteCoalescingBatchesForSupportingClients(t *testing.T) {
+	conn, payloads := startCoalescedSubscription(t, &WriteCoalescing{Window: 50 * time.Millisecond, Batching: true}, map[string]interface{}{"batching": true})
+
+	for i := 1; i <= 3; i++ {
+		payloads <- map[string]interface{}{"data": map[string]interface{}{"value": i}}
+	}
+	close(payloads)
+
+	var batch []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(readRaw(t, conn), &batch))
+	if assert.Len(t, batch, 3) {
+		for _, m := range batch {
+			assert.Equal(t, "next", m["type"])
+			assert.Equal(t, "1", m["id"])
+		}
+	}
+
+	// complete flushes the pending messages and is written on its own
+	var complete map[string]interface{}
+	assert.NoError(t, json.Unmarshal(readRaw(t, conn), &complete))
+	assert.Equal(t, "complete", complete["type"])
+}
+
+func TestWriteCoalescingWithoutBatching(t *testing.T) {
+	conn, payloads := startCoalescedSubscription(t, &WriteCoalescing{Window: 50 * time.Millisecond, Batching: true}, nil)
+
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 2}}
+	close(payloads)
+
+	for _, typ := range []string{"next", "next", "complete"} {
+		var m map[string]interface{}
+		assert.NoError(t, json.Unmarshal(readRaw(t, conn), &m))
+		assert.Equal(t, typ, m["type"])
+	}
+}
+
+func TestWriteCoalescingMaxBatch(t *testing.T) {
+	conn, payloads := startCoalescedSubscription(t, &WriteCoalescing{Window: time.Hour, MaxBatch: 2, Batching: true}, map[string]interface{}{"batching": true})
+
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 2}}
+
+	var batch []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(readRaw(t, conn), &batch))
+	assert.Len(t, batch, 2)
+}
+
+// failingSource makes a FaultInjector fail every write but the ack and keep-alive of the
+// initialisation.
+type failingSource struct{ calls atomic.Int64 }
+
+func (s *failingSource) Int63() int64 {
+	if s.calls.Add(1) <= 2 {
+		return 1 << 62
+	}
+	return 0
+}
+
+func (s *failingSource) Seed(int64) {}
+
+func TestWriteCoalescingErrorFuncClosesConnection(t *testing.T) {
+	registry := NewRegistry()
+	payloads := make(chan interface{}, 1)
+	server := newTestServer(t, Websocket{
+		Registry:        registry,
+		WriteCoalescing: &WriteCoalescing{Window: time.Millisecond},
+		FaultInjector:   &FaultInjector{WriteFailureRate: 0.25, Rand: rand.New(&failingSource{})},
+		ErrorFunc: func(ctx context.Context, err error) {
+			if conns := registry.Connections(); len(conns) == 1 && errors.Is(err, ErrFaultInjected) {
+				conns[0].Close(websocket.CloseGoingAway, "write failed")
+			}
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+	payloads <- map[string]int{"value": 1}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if assert.True(t, errors.As(err, &closeErr), "Expected a close frame, got %v", err) {
+		assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package transport
+
+import "errors"
+
+// The close codes of graphql-transport-ws, https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const (
+	closeBadRequest            = 4400
+	closeUnauthorized          = 4401
+	closeInitialisationTimeout = 4408
+	closeTooManyInitRequests   = 4429
+)
+
+// The close reasons of graphql-transport-ws, sent instead of the generic ones to the connections
+// of a Websocket with StrictProtocol.
+var (
+	// CloseReasonBadRequest closes the connections receiving an invalid or unexpected message.
+	CloseReasonBadRequest = CloseReason{Code: closeBadRequest, Reason: "Invalid message received"}
+	// CloseReasonUnauthorized closes the connections starting an operation before being
+	// acknowledged.
+	CloseReasonUnauthorized = CloseReason{Code: closeUnauthorized, Reason: "Unauthorized"}
+	// CloseReasonInitialisationTimeout closes the connections not initialised within the
+	// InitTimeout.
+	CloseReasonInitialisationTimeout = CloseReason{Code: closeInitialisationTimeout, Reason: "Connection initialisation timeout"}
+	// CloseReasonTooManyInitialisationRequests closes the connections initialised twice.
+	CloseReasonTooManyInitialisationRequests = CloseReason{Code: closeTooManyInitRequests, Reason: "Too many initialisation requests"}
+)
+
+// strict returns true if the connection follows graphql-transport-ws to the letter.
+func (c *wsConnection) strict() bool {
+	return c.StrictProtocol && c.conn.Subprotocol() == graphqltransportwsSubprotocol
+}
+
+// closeWithProtocolReason closes the connection with the reason of graphql-transport-ws in the
+// strict mode, or with the generic reason otherwise.
+func (c *wsConnection) closeWithProtocolReason(generic CloseReason, strict CloseReason) {
+	if c.strict() {
+		c.closeWithReason(strict)
+		return
+	}
+	c.closeWithReason(generic)
+}
+
+// unexpectedMessage closes the connection receiving a message not allowed in its state.
+func (c *wsConnection) unexpectedMessage(t messageType, initialised bool) {
+	if !c.strict() {
+		c.sendConnectionError("unexpected message %s", t)
+		c.closeWithReason(CloseReasonUnexpectedMessage)
+		return
+	}
+
+	switch {
+	case t == initMessageType && initialised:
+		c.closeWithReason(CloseReasonTooManyInitialisationRequests)
+	case t == startMessageType && !initialised:
+		c.closeWithReason(CloseReasonUnauthorized)
+	default:
+		c.closeWithReason(CloseReasonBadRequest)
+	}
+}
+
+// closeOnInvalidMessage closes the connection of the strict mode failing to decode a message once
+// initialised, other read errors are left to the caller.
+func (c *wsConnection) closeOnInvalidMessage(err error) {
+	if c.strict() && errors.Is(err, errInvalidMsg) {
+		c.closeWithReason(CloseReasonBadRequest)
+	}
+}
@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// readCloseError reads the connection until it is closed and returns the close frame.
+func readCloseError(t *testing.T, conn *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if !assert.ErrorAs(t, err, &closeErr) {
+		return &websocket.CloseError{}
+	}
+	return closeErr
+}
+
+func TestStrictProtocol(t *testing.T) {
+	service := testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{})
+			context.AfterFunc(ctx, func() { close(payloads) })
+			return payloads, nil
+		},
+	}
+	subscribe := map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}
+
+	tests := []struct {
+		name     string
+		handler  Websocket
+		messages []interface{}
+		code     int
+		reason   string
+	}{
+		{
+			name:     "duplicate initialisation",
+			messages: []interface{}{map[string]interface{}{"type": "connection_init"}, map[string]interface{}{"type": "connection_init"}},
+			code:     4429,
+			reason:   "Too many initialisation requests",
+		},
+		{
+			name:     "subscribe before initialisation",
+			messages: []interface{}{subscribe},
+			code:     4401,
+			reason:   "Unauthorized",
+		},
+		{
+			name:     "unknown message type",
+			messages: []interface{}{map[string]interface{}{"type": "connection_init"}, map[string]interface{}{"type": "unknown"}},
+			code:     4400,
+			reason:   "Invalid message received",
+		},
+		{
+			name:     "server message type",
+			messages: []interface{}{map[string]interface{}{"type": "next", "id": "1"}},
+			code:     4400,
+			reason:   "Invalid message received",
+		},
+		{
+			name:     "invalid initialisation payload",
+			messages: []interface{}{map[string]interface{}{"type": "connection_init", "payload": "token"}},
+			code:     4400,
+			reason:   "Invalid message received",
+		},
+		{
+			name:     "initialisation timeout",
+			handler:  Websocket{InitTimeout: 50 * time.Millisecond},
+			messages: []interface{}{map[string]interface{}{"type": "ping"}},
+			code:     4408,
+			reason:   "Connection initialisation timeout",
+		},
+		{
+			name:     "duplicate operation",
+			messages: []interface{}{map[string]interface{}{"type": "connection_init"}, subscribe, subscribe},
+			code:     4409,
+			reason:   "Subscriber for 1 already exists",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.handler.StrictProtocol = true
+			server := newTestServer(t, tt.handler, service)
+			conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+			for _, m := range tt.messages {
+				assert.NoError(t, conn.WriteJSON(m))
+			}
+
+			closeErr := readCloseError(t, conn)
+			assert.Equal(t, tt.code, closeErr.Code)
+			assert.Equal(t, tt.reason, closeErr.Text)
+		})
+	}
+}
+
+func TestStrictProtocolPingBeforeInit(t *testing.T) {
+	server := newTestServer(t, Websocket{StrictProtocol: true, KeepAlivePingInterval: 10 * time.Millisecond}, nil)
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping", "payload": map[string]interface{}{"n": 1}}))
+	var pong map[string]interface{}
+	assert.NoError(t, conn.ReadJSON(&pong))
+	assert.Equal(t, "pong", pong["type"])
+	assert.Equal(t, map[string]interface{}{"n": float64(1)}, pong["payload"])
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	var ack map[string]interface{}
+	assert.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, "connection_ack", ack["type"])
+
+	// no legacy keep-alive is sent over graphql-transport-ws
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping"}))
+	assert.NoError(t, conn.ReadJSON(&pong))
+	assert.Equal(t, "pong", pong["type"])
+}
+
+func TestStrictProtocolGraphqlws(t *testing.T) {
+	// the generic reasons are kept for the connections of the other subprotocols, and without
+	// StrictProtocol
+	for _, tt := range []struct {
+		handler     Websocket
+		subprotocol string
+	}{
+		{Websocket{StrictProtocol: true}, graphqlwsSubprotocol},
+		{Websocket{}, graphqltransportwsSubprotocol},
+	} {
+		server := newTestServer(t, tt.handler, nil)
+		conn := dialTestServer(t, server, tt.subprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+
+		closeErr := readCloseError(t, conn)
+		assert.Equal(t, CloseReasonUnexpectedMessage.Code, closeErr.Code)
+		assert.Equal(t, CloseReasonUnexpectedMessage.Reason, closeErr.Text)
+	}
+}
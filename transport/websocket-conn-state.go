@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"sync"
+)
+
+// A private key for context that only this package can access. This is important
+// to prevent collisions between different context uses
+var connStateCtxKey = &wsConnStateContextKey{"conn-state"}
+
+type wsConnStateContextKey struct {
+	name string
+}
+
+// ConnectionState is a key/value store scoped to a single websocket connection. It is shared by
+// the InitFunc and every subscription started on the connection and is safe for concurrent use.
+type ConnectionState struct {
+	values sync.Map
+}
+
+// Get returns the value stored for key. It returns false if the state is nil or the key isn't set.
+func (s *ConnectionState) Get(key interface{}) (interface{}, bool) {
+	if s == nil {
+		return nil, false
+	}
+
+	return s.values.Load(key)
+}
+
+// Set stores a value for key. It is a no-op on a nil state.
+func (s *ConnectionState) Set(key interface{}, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.values.Store(key, value)
+}
+
+// Delete removes the value stored for key.
+func (s *ConnectionState) Delete(key interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.values.Delete(key)
+}
+
+func withConnState(ctx context.Context, state *ConnectionState) context.Context {
+	return context.WithValue(ctx, connStateCtxKey, state)
+}
+
+// ConnState returns the state of the websocket connection the context belongs to. It returns nil
+// outside of a websocket connection, the methods of a nil state are safe to call.
+func ConnState(ctx context.Context) *ConnectionState {
+	state, _ := ctx.Value(connStateCtxKey).(*ConnectionState)
+	return state
+}
@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnState(t *testing.T) {
+	ctx := withConnState(context.Background(), &ConnectionState{})
+
+	state := ConnState(ctx)
+	state.Set("user", "admin")
+
+	value, ok := ConnState(ctx).Get("user")
+	assert.True(t, ok)
+	assert.Equal(t, "admin", value)
+
+	state.Delete("user")
+	_, ok = state.Get("user")
+	assert.False(t, ok, "Expected value to be removed")
+}
+
+func TestConnStateWithoutConnection(t *testing.T) {
+	state := ConnState(context.Background())
+	assert.Nil(t, state)
+
+	// A nil state is safe to use
+	state.Set("user", "admin")
+	_, ok := state.Get("user")
+	assert.False(t, ok)
+	state.Delete("user")
+}
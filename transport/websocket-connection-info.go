@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// A private key for context that only this package can access. This is important
+// to prevent collisions between different context uses
+var connectionInfoCtxKey = &wsConnectionInfoContextKey{"connection-info"}
+
+type wsConnectionInfoContextKey struct {
+	name string
+}
+
+// ConnectionInfo describes the client side of a websocket connection. It is available in the
+// context passed to the InitFunc and to the GraphQLService.
+type ConnectionInfo struct {
+	// ID uniquely identifies the connection
+	ID string
+	// RemoteAddr is the network address of the client, as reported by the http request
+	RemoteAddr string
+	// Header contains the headers of the upgrade request
+	Header http.Header
+	// Subprotocol is the negotiated websocket subprotocol
+	Subprotocol string
+	// Extensions are the names of the negotiated websocket extensions, e.g. permessage-deflate
+	Extensions []string
+	// TLS is the connection state of the upgrade request, nil for unencrypted connections
+	TLS *tls.ConnectionState
+}
+
+func newConnectionInfo(r *http.Request, id string, subprotocol string) *ConnectionInfo {
+	return &ConnectionInfo{
+		ID:          id,
+		RemoteAddr:  r.RemoteAddr,
+		Header:      r.Header.Clone(),
+		Subprotocol: subprotocol,
+		TLS:         r.TLS,
+	}
+}
+
+// ClientCertificates returns the verified chain of the client certificate, leaf first, or nil when
+// the client wasn't authenticated with a certificate, see tls.Config.ClientAuth.
+func (i *ConnectionInfo) ClientCertificates() []*x509.Certificate {
+	if i == nil || i.TLS == nil || len(i.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return i.TLS.VerifiedChains[0]
+}
+
+func newConnectionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating connection id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func withConnectionInfo(ctx context.Context, info *ConnectionInfo) context.Context {
+	return context.WithValue(ctx, connectionInfoCtxKey, info)
+}
+
+// GetConnectionInfo returns the information about the websocket connection the context belongs to,
+// or nil if the context doesn't originate from a websocket connection.
+func GetConnectionInfo(ctx context.Context) *ConnectionInfo {
+	info, _ := ctx.Value(connectionInfoCtxKey).(*ConnectionInfo)
+	return info
+}
@@ -0,0 +1,54 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConnectionInfo(t *testing.T) {
+	r := httptest.NewRequest("GET", "/graphql", nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+	r.Header.Set("User-Agent", "test-client")
+	r.TLS = &tls.ConnectionState{ServerName: "example.com"}
+
+	id, err := newConnectionID()
+	assert.NoError(t, err)
+	info := newConnectionInfo(r, id, graphqltransportwsSubprotocol)
+
+	assert.Len(t, info.ID, 32)
+	other, err := newConnectionID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, info.ID, other, "Expected connection ids to be unique")
+	assert.Equal(t, "10.0.0.1:4321", info.RemoteAddr)
+	assert.Equal(t, "test-client", info.Header.Get("User-Agent"))
+	assert.Equal(t, graphqltransportwsSubprotocol, info.Subprotocol)
+	assert.Equal(t, "example.com", info.TLS.ServerName)
+
+	// The headers are copied so later changes to the request don't leak into the connection info
+	r.Header.Set("User-Agent", "changed")
+	assert.Equal(t, "test-client", info.Header.Get("User-Agent"))
+}
+
+func TestGetConnectionInfo(t *testing.T) {
+	assert.Nil(t, GetConnectionInfo(context.Background()), "Expected nil connection info for context without it")
+
+	info := &ConnectionInfo{RemoteAddr: "127.0.0.1:1234"}
+	ctx := withConnectionInfo(context.Background(), info)
+
+	assert.Same(t, info, GetConnectionInfo(ctx))
+}
+
+func TestConnectionInfoClientCertificates(t *testing.T) {
+	assert.Nil(t, (*ConnectionInfo)(nil).ClientCertificates())
+	assert.Nil(t, (&ConnectionInfo{}).ClientCertificates())
+	assert.Nil(t, (&ConnectionInfo{TLS: &tls.ConnectionState{}}).ClientCertificates())
+
+	leaf, ca := &x509.Certificate{}, &x509.Certificate{}
+	info := &ConnectionInfo{TLS: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf, ca}}}}
+	assert.Equal(t, []*x509.Certificate{leaf, ca}, info.ClientCertificates())
+}
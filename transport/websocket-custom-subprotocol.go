@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// The types of the messages exchanged with the clients, every subprotocol encodes them with its
+// own names.
+const (
+	// MessageInit initialises the connection, e.g. connection_init.
+	MessageInit = initMessageType
+	// MessageConnectionAck acknowledges the initialisation of the connection.
+	MessageConnectionAck = connectionAckMessageType
+	// MessageKeepAlive is sent periodically to graphql-ws clients.
+	MessageKeepAlive = keepAliveMessageType
+	// MessageConnectionError rejects the initialisation of the connection.
+	MessageConnectionError = connectionErrorMessageType
+	// MessageConnectionTerminate ends the connection.
+	MessageConnectionTerminate = connectionCloseMessageType
+	// MessageStart starts an operation, e.g. start or subscribe.
+	MessageStart = startMessageType
+	// MessageStop stops an operation on behalf of the client.
+	MessageStop = stopMessageType
+	// MessageData carries a payload of an operation, e.g. data or next.
+	MessageData = dataMessageType
+	// MessageComplete ends an operation on behalf of the server.
+	MessageComplete = completeMessageType
+	// MessageError carries the errors of an operation.
+	MessageError = errorMessageType
+	// MessagePing and MessagePong check the liveness of the connection.
+	MessagePing = pingMessageType
+	MessagePong = pongMessageType
+	// MessageSync carries a SyncFrame of a document, see DocumentSync.
+	MessageSync = syncMessageType
+)
+
+type (
+	// Message is a message exchanged with a client, whatever the subprotocol encoding it.
+	Message struct {
+		Type    MessageType
+		ID      string
+		Payload json.RawMessage
+	}
+
+	// MessageExchanger reads and writes the messages of a subprotocol registered with
+	// RegisterSubprotocol.
+	MessageExchanger interface {
+		// NextMessage reads the next message of the client, it returns ErrInvalidMessage when the
+		// message can't be decoded.
+		NextMessage() (Message, error)
+		// Send writes a message to the client, the messages the subprotocol doesn't have, like
+		// MessageKeepAlive, are skipped.
+		Send(m *Message) error
+	}
+
+	// SubprotocolConn is the websocket connection a MessageExchanger reads from and writes to.
+	SubprotocolConn interface {
+		// Subprotocol returns the negotiated subprotocol.
+		Subprotocol() string
+		// ReadMessage reads the next data message into buf.
+		ReadMessage(buf *bytes.Buffer) error
+		// WriteMessage writes a text message.
+		WriteMessage(data []byte) error
+	}
+)
+
+// RegisterSubprotocol serves the connections negotiating the subprotocol name with the exchanger
+// returned by newExchanger, e.g. for a proprietary dialect. Registering graphql-ws or
+// graphql-transport-ws replaces the implementation of the package. The frames of these
+// connections aren't recorded, and they are never served by the EventLoop.
+//
+// RegisterSubprotocol must be called before the Websocket serves connections.
+func (t *Websocket) RegisterSubprotocol(name string, newExchanger func(conn SubprotocolConn) MessageExchanger) {
+	if t.subprotocols == nil {
+		t.subprotocols = map[string]func(conn SubprotocolConn) MessageExchanger{}
+	}
+	t.subprotocols[name] = newExchanger
+	if !contains(t.Upgrader.Subprotocols, name) {
+		t.Upgrader.Subprotocols = append(t.Upgrader.Subprotocols, name)
+	}
+}
+
+// customExchanger adapts the MessageExchanger of a registered subprotocol.
+type customExchanger struct {
+	me MessageExchanger
+}
+
+func (e customExchanger) NextMessage() (message, error) {
+	m, err := e.me.NextMessage()
+	if err != nil {
+		return message{}, handleNextReaderError(err)
+	}
+	return message{t: m.Type, id: m.ID, payload: m.Payload}, nil
+}
+
+func (e customExchanger) Send(m *message) error {
+	return e.me.Send(&Message{Type: m.t, ID: m.id, Payload: m.payload})
+}
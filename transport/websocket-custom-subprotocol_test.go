@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSubprotocolOps = map[string]MessageType{
+	"hello":   MessageInit,
+	"welcome": MessageConnectionAck,
+	"watch":   MessageStart,
+	"unwatch": MessageStop,
+	"event":   MessageData,
+	"done":    MessageComplete,
+	"failed":  MessageError,
+}
+
+// testSubprotocolExchanger encodes the messages as {"op": ..., "ref": ..., "body": ...}.
+type testSubprotocolExchanger struct {
+	conn SubprotocolConn
+}
+
+type testSubprotocolMessage struct {
+	Op   string          `json:"op"`
+	Ref  string          `json:"ref,omitempty"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+func (e testSubprotocolExchanger) NextMessage() (Message, error) {
+	var buf bytes.Buffer
+	if err := e.conn.ReadMessage(&buf); err != nil {
+		return Message{}, err
+	}
+	var m testSubprotocolMessage
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		return Message{}, ErrInvalidMessage
+	}
+	t, ok := testSubprotocolOps[m.Op]
+	if !ok {
+		return Message{}, ErrInvalidMessage
+	}
+	return Message{Type: t, ID: m.Ref, Payload: m.Body}, nil
+}
+
+func (e testSubprotocolExchanger) Send(m *Message) error {
+	for op, t := range testSubprotocolOps {
+		if t == m.Type {
+			b, err := json.Marshal(testSubprotocolMessage{Op: op, Ref: m.ID, Body: m.Payload})
+			if err != nil {
+				return err
+			}
+			return e.conn.WriteMessage(b)
+		}
+	}
+	return nil
+}
+
+func TestRegisterSubprotocol(t *testing.T) {
+	handler := Websocket{}
+	handler.RegisterSubprotocol("x-test", func(conn SubprotocolConn) MessageExchanger {
+		return testSubprotocolExchanger{conn: conn}
+	})
+	assert.Contains(t, handler.Upgrader.Subprotocols, "x-test")
+
+	server := newTestServer(t, handler, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 1)
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+			close(payloads)
+			return payloads, nil
+		},
+	})
+	conn := dialTestServer(t, server, "x-test")
+	assert.Equal(t, "x-test", conn.Subprotocol())
+
+	read := func() testSubprotocolMessage {
+		var m testSubprotocolMessage
+		assert.NoError(t, conn.ReadJSON(&m))
+		return m
+	}
+	assert.NoError(t, conn.WriteJSON(testSubprotocolMessage{Op: "hello"}))
+	assert.Equal(t, "welcome", read().Op)
+
+	assert.NoError(t, conn.WriteJSON(testSubprotocolMessage{Op: "watch", Ref: "1", Body: json.RawMessage(`{"query":"subscription { value }"}`)}))
+	event := read()
+	assert.Equal(t, testSubprotocolMessage{Op: "event", Ref: "1", Body: json.RawMessage(`{"data":{"value":1}}`)}, event)
+	assert.Equal(t, testSubprotocolMessage{Op: "done", Ref: "1"}, read())
+
+	// the built-in subprotocols are still served
+	conn = dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+}
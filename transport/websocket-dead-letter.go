@@ -0,0 +1,185 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultDeadLetterBufferSize = 1000
+
+// DeadLetterReason is why a payload couldn't be delivered.
+type DeadLetterReason string
+
+const (
+	// DeadLetterEncoding is the reason of the payloads which can't be encoded to JSON.
+	DeadLetterEncoding DeadLetterReason = "encoding"
+	// DeadLetterTransform is the reason of the payloads failing the ResponseFunc, their incremental
+	// framing or their delta encoding.
+	DeadLetterTransform DeadLetterReason = "transform"
+	// DeadLetterWrite is the reason of the payloads which can't be written to the connection.
+	DeadLetterWrite DeadLetterReason = "write"
+)
+
+// DeadLetter is a payload of an operation which couldn't be delivered.
+type DeadLetter struct {
+	Reason DeadLetterReason
+	Time   time.Time
+
+	ConnectionID  string
+	RemoteAddr    string
+	Tenant        string
+	OperationID   string
+	OperationName string
+
+	// Payload is the payload encoded, it is nil when it can't be encoded.
+	Payload json.RawMessage
+	// Value is the payload returned by the GraphQLService, it is set when it can't be encoded.
+	Value interface{}
+	Err   error
+}
+
+// DeadLetterSink stores the dead letters, e.g. in a queue to inspect and replay them. Dead letters
+// are written one at a time by a single goroutine.
+type DeadLetterSink interface {
+	WriteDeadLetter(ctx context.Context, letter DeadLetter) error
+}
+
+// DeadLetterSinkFunc is a DeadLetterSink function.
+type DeadLetterSinkFunc func(ctx context.Context, letter DeadLetter) error
+
+// WriteDeadLetter implements DeadLetterSink
+func (f DeadLetterSinkFunc) WriteDeadLetter(ctx context.Context, letter DeadLetter) error {
+	return f(ctx, letter)
+}
+
+// DeadLetters routes the payloads which can't be delivered to a sink with their connection,
+// operation and error, rather than dropping them silently. The dead letters are queued and
+// delivered to the Sink off the goroutines serving the connections.
+type DeadLetters struct {
+	Sink DeadLetterSink
+	// BufferSize is the number of dead letters queued for the Sink, it defaults to 1000. Dead
+	// letters are dropped when the queue is full.
+	BufferSize int
+	// ErrorFunc is called when the Sink fails to write a dead letter, or with
+	// ErrDeadLettersDropped when dead letters are dropped.
+	ErrorFunc func(err error)
+
+	once    sync.Once
+	letters chan DeadLetter
+	done    chan struct{}
+	closed  bool
+	dropped atomic.Int64
+	mu      sync.RWMutex
+}
+
+// ErrDeadLettersDropped is reported to the ErrorFunc of DeadLetters when its queue is full.
+var ErrDeadLettersDropped = errors.New("dead letters dropped")
+
+func (d *DeadLetters) start() {
+	d.once.Do(func() {
+		size := d.BufferSize
+		if size <= 0 {
+			size = defaultDeadLetterBufferSize
+		}
+		d.letters = make(chan DeadLetter, size)
+		d.done = make(chan struct{})
+		go d.run()
+	})
+}
+
+// record queues a dead letter, it never blocks.
+func (d *DeadLetters) record(letter DeadLetter) {
+	d.start()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.letters <- letter:
+	default:
+		if d.dropped.Add(1) == 1 && d.ErrorFunc != nil {
+			d.ErrorFunc(ErrDeadLettersDropped)
+		}
+	}
+}
+
+// Dropped returns the number of dead letters dropped because the queue was full.
+func (d *DeadLetters) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+func (d *DeadLetters) run() {
+	defer close(d.done)
+	for letter := range d.letters {
+		if err := d.Sink.WriteDeadLetter(context.Background(), letter); err != nil && d.ErrorFunc != nil {
+			d.ErrorFunc(err)
+		}
+	}
+}
+
+// Close delivers the queued dead letters to the Sink and stops recording, it returns the error of
+// the context if it is done first.
+func (d *DeadLetters) Close(ctx context.Context) error {
+	d.start()
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.letters)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deadLetter records a payload of the operation of ctx which couldn't be delivered.
+func (c *wsConnection) deadLetter(ctx context.Context, reason DeadLetterReason, id string, value interface{}, payload json.RawMessage, err error) {
+	if c.DeadLetters == nil {
+		return
+	}
+	letter := c.newDeadLetter(reason, id, err)
+	if op := GetOperationInfo(ctx); op != nil {
+		letter.OperationName = op.Name
+	}
+	letter.Payload = payload
+	if payload == nil {
+		letter.Value = value
+	}
+	c.DeadLetters.record(letter)
+}
+
+// deadLetterWriteLocked records the data messages which couldn't be written, c.mu must be held.
+func (c *wsConnection) deadLetterWriteLocked(err error, messages ...*message) {
+	if c.DeadLetters == nil || err == nil {
+		return
+	}
+	for _, msg := range messages {
+		if msg.t != dataMessageType || msg.id == "" {
+			continue
+		}
+		letter := c.newDeadLetter(DeadLetterWrite, msg.id, err)
+		if op := c.operations[msg.id]; op != nil {
+			letter.OperationName = op.Name
+		}
+		letter.Payload = msg.payload
+		c.DeadLetters.record(letter)
+	}
+}
+
+func (c *wsConnection) newDeadLetter(reason DeadLetterReason, id string, err error) DeadLetter {
+	letter := DeadLetter{Reason: reason, Time: time.Now(), Tenant: GetTenant(c.ctx), OperationID: id, Err: err}
+	if info := GetConnectionInfo(c.ctx); info != nil {
+		letter.ConnectionID = info.ID
+		letter.RemoteAddr = info.RemoteAddr
+	}
+	return letter
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDeadLetterSink struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (s *testDeadLetterSink) WriteDeadLetter(ctx context.Context, letter DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+func (s *testDeadLetterSink) all() []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeadLetter(nil), s.letters...)
+}
+
+func TestDeadLetters(t *testing.T) {
+	sink := &testDeadLetterSink{}
+	errRedacted := errors.New("redaction failed")
+	server := newTestServer(t, Websocket{
+		DeadLetters: &DeadLetters{Sink: sink},
+		ResponseFunc: func(ctx context.Context, id string, payload json.RawMessage) (json.RawMessage, error) {
+			if string(payload) == `{"data":"secret"}` {
+				return nil, errRedacted
+			}
+			return payload, nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 3)
+			payloads <- map[string]interface{}{"data": "secret"}
+			payloads <- map[string]interface{}{"data": "public"}
+			payloads <- map[string]interface{}{"data": make(chan int)}
+			close(payloads)
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription Values { value }"}}))
+	readMessageOfType(t, conn, "error")
+	m := readMessageOfType(t, conn, "next")
+	assert.JSONEq(t, `{"data":"public"}`, string(m["payload"]))
+	readMessageOfType(t, conn, "error")
+
+	assert.Eventually(t, func() bool { return len(sink.all()) == 2 }, time.Second, time.Millisecond)
+	letters := sink.all()
+	assert.Equal(t, DeadLetterTransform, letters[0].Reason)
+	assert.Equal(t, "1", letters[0].OperationID)
+	assert.Equal(t, "Values", letters[0].OperationName)
+	assert.NotEmpty(t, letters[0].ConnectionID)
+	assert.JSONEq(t, `{"data":"secret"}`, string(letters[0].Payload))
+	assert.Equal(t, errRedacted, letters[0].Err)
+
+	assert.Equal(t, DeadLetterEncoding, letters[1].Reason)
+	assert.Nil(t, letters[1].Payload)
+	assert.IsType(t, map[string]interface{}{}, letters[1].Value)
+	assert.ErrorContains(t, letters[1].Err, "json: unsupported type")
+}
+
+func TestDeadLettersWrite(t *testing.T) {
+	sink := &testDeadLetterSink{}
+	deadLetters := &DeadLetters{Sink: sink}
+	c := &wsConnection{
+		Websocket:  Websocket{DeadLetters: deadLetters},
+		ctx:        withConnectionInfo(context.Background(), &ConnectionInfo{ID: "c1"}),
+		operations: map[string]*OperationInfo{"1": {ID: "1", Name: "Values"}},
+	}
+	errWrite := errors.New("broken pipe")
+	c.deadLetterWriteLocked(errWrite,
+		&message{t: dataMessageType, id: "1", payload: []byte(`{"data":1}`)},
+		&message{t: completeMessageType, id: "1"},
+		&message{t: pingMessageType},
+	)
+	assert.NoError(t, deadLetters.Close(context.Background()))
+
+	letters := sink.all()
+	if assert.Len(t, letters, 1) {
+		assert.Equal(t, DeadLetterWrite, letters[0].Reason)
+		assert.Equal(t, "c1", letters[0].ConnectionID)
+		assert.Equal(t, "Values", letters[0].OperationName)
+		assert.Equal(t, json.RawMessage(`{"data":1}`), letters[0].Payload)
+		assert.Equal(t, errWrite, letters[0].Err)
+	}
+	assert.Zero(t, deadLetters.Dropped())
+}
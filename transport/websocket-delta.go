@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// deltaExtension is the extension a client sends with an operation to receive deltas, its value
+// is the format of the deltas.
+const deltaExtension = "delta"
+
+// Formats of the deltas.
+const (
+	// DeltaJSONPatch sends RFC 6902 JSON patches, see https://www.rfc-editor.org/rfc/rfc6902
+	DeltaJSONPatch = "json-patch"
+	// DeltaMergePatch sends RFC 7386 JSON merge patches, see https://www.rfc-editor.org/rfc/rfc7386
+	DeltaMergePatch = "merge-patch"
+)
+
+// deltaPayload replaces a payload by its difference with the previous payload of the operation.
+type deltaPayload struct {
+	Patch interface{} `json:"patch"`
+}
+
+// deltaEncoder remembers the last payload of an operation to send the next ones as deltas. A
+// payload is sent whole when its delta isn't smaller or can't be expressed in the format, the
+// clients tell deltas apart by their patch field.
+type deltaEncoder struct {
+	format string
+	prev   interface{}
+}
+
+// newDeltaEncoder returns the encoder of the format requested by the client in the extensions of
+// an operation, or nil if it didn't request a supported format.
+func newDeltaEncoder(extensions OperationExtensions) *deltaEncoder {
+	switch format := extensions.GetString(deltaExtension); format {
+	case DeltaJSONPatch, DeltaMergePatch:
+		return &deltaEncoder{format: format}
+	default:
+		return nil
+	}
+}
+
+func (d *deltaEncoder) encode(payload []byte) ([]byte, error) {
+	var v interface{}
+	if err := jsonDecode(payload, &v); err != nil {
+		return nil, err
+	}
+	prev := d.prev
+	d.prev = v
+	if prev == nil {
+		return payload, nil
+	}
+
+	var patch interface{}
+	switch d.format {
+	case DeltaJSONPatch:
+		ops := diffJSON("", prev, v, nil)
+		if ops == nil {
+			ops = []JSONPatchOperation{}
+		}
+		patch = ops
+	case DeltaMergePatch:
+		var ok bool
+		if patch, ok = mergePatch(prev, v); !ok {
+			return payload, nil
+		}
+	}
+
+	b, err := json.Marshal(deltaPayload{Patch: patch})
+	if err != nil || len(b) >= len(payload) {
+		return payload, err
+	}
+	return b, nil
+}
+
+// mergePatch returns the merge patch turning a into b, two decoded JSON values. It returns false
+// if b has null values that a merge patch would remove instead.
+func mergePatch(a interface{}, b interface{}) (interface{}, bool) {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		return b, !containsNull(b)
+	}
+
+	patch := map[string]interface{}{}
+	for key := range am {
+		if _, ok := bm[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, bv := range bm {
+		av, ok := am[key]
+		if ok && reflect.DeepEqual(av, bv) {
+			continue
+		}
+		if !ok {
+			if containsNull(bv) {
+				return nil, false
+			}
+			patch[key] = bv
+			continue
+		}
+
+		sub, ok := mergePatch(av, bv)
+		if !ok {
+			return nil, false
+		}
+		patch[key] = sub
+	}
+	return patch, true
+}
+
+// containsNull returns true if v is null or an object with null values. Nulls in lists are kept
+// by merge patches.
+func containsNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, value := range m {
+		if containsNull(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeltaEncoder(t *testing.T) {
+	assert.Nil(t, newDeltaEncoder(nil))
+	assert.Nil(t, newDeltaEncoder(OperationExtensions{"delta": "unknown"}))
+	assert.Equal(t, DeltaMergePatch, newDeltaEncoder(OperationExtensions{"delta": "merge-patch"}).format)
+}
+
+func TestDeltaEncoderJSONPatch(t *testing.T) {
+	d := &deltaEncoder{format: DeltaJSONPatch}
+	large := strings.Repeat("x", 100)
+
+	first := `{"data":{"doc":{"body":"` + large + `","version":1}}}`
+	b, err := d.encode([]byte(first))
+	assert.NoError(t, err)
+	assert.Equal(t, first, string(b))
+
+	b, err = d.encode([]byte(`{"data":{"doc":{"body":"` + large + `","version":2}}}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"patch":[{"op":"replace","path":"/data/doc/version","value":2}]}`, string(b))
+
+	b, err = d.encode([]byte(`{"data":{"doc":{"body":"` + large + `","version":2}}}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"patch":[]}`, string(b))
+
+	// whole payloads are sent when they are smaller than their delta
+	b, err = d.encode([]byte(`{"data":{"doc":null}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data":{"doc":null}}`, string(b))
+}
+
+func TestDeltaEncoderMergePatch(t *testing.T) {
+	d := &deltaEncoder{format: DeltaMergePatch}
+	large := strings.Repeat("x", 100)
+
+	_, err := d.encode([]byte(`{"data":{"doc":{"body":"` + large + `","version":1,"tags":["a"],"draft":true}}}`))
+	assert.NoError(t, err)
+
+	b, err := d.encode([]byte(`{"data":{"doc":{"body":"` + large + `","version":2,"tags":["a",null]}}}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"patch":{"data":{"doc":{"version":2,"tags":["a",null],"draft":null}}}}`, string(b))
+
+	// null values can't be expressed by merge patches
+	next := `{"data":{"doc":{"body":"` + large + `","version":null,"tags":["a",null]}}}`
+	b, err = d.encode([]byte(next))
+	assert.NoError(t, err)
+	assert.Equal(t, next, string(b))
+}
+
+func TestSubscribeSendsDeltas(t *testing.T) {
+	payloads := make(chan interface{})
+	server := newTestServer(t, Websocket{DeltaPayloads: true}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query":      "subscription { doc { body version } }",
+		"extensions": map[string]interface{}{"delta": DeltaJSONPatch},
+	}}))
+
+	body := strings.Repeat("x", 100)
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"doc": map[string]interface{}{"body": body, "version": 1}}}
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"doc": map[string]interface{}{"body": body, "version": float64(1)}}}, readResponse(t, conn))
+
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"doc": map[string]interface{}{"body": body, "version": 2}}}
+	assert.Equal(t, map[string]interface{}{"patch": []interface{}{map[string]interface{}{
+		"op": "replace", "path": "/data/doc/version", "value": float64(2),
+	}}}, readResponse(t, conn))
+}
@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestUnencodablePayloads(t *testing.T) {
+	for name, payload := range map[string]interface{}{
+		"channel": map[string]interface{}{"data": make(chan int)},
+		"NaN":     map[string]interface{}{"data": math.NaN()},
+		"shared":  NewSharedPayload(map[string]interface{}{"data": math.Inf(1)}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var reported []error
+			server := newTestServer(t, Websocket{
+				ErrorFunc: func(ctx context.Context, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					reported = append(reported, err)
+				},
+			}, testGraphQLService{
+				subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+					payloads := make(chan interface{}, 2)
+					payloads <- payload
+					payloads <- map[string]interface{}{"data": 1}
+					context.AfterFunc(ctx, func() { close(payloads) })
+					return payloads, nil
+				},
+			})
+
+			conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+			assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+			readMessageOfType(t, conn, "connection_ack")
+			assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+
+			// the operation is stopped with an error instead of sending its next payload
+			var m map[string]json.RawMessage
+			assert.NoError(t, conn.ReadJSON(&m))
+			assert.Equal(t, `"error"`, string(m["type"]))
+			assert.Contains(t, string(m["payload"]), "json: unsupported")
+
+			assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping"}))
+			readMessageOfType(t, conn, "pong")
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, reported, 1) {
+				assert.Contains(t, reported[0].Error(), "encoding payload of operation 1")
+			}
+		})
+	}
+}
+
+func TestUnencodableErrors(t *testing.T) {
+	var mu sync.Mutex
+	var reported []error
+	server := newTestServer(t, Websocket{
+		ErrorFunc: func(ctx context.Context, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			AddSubscriptionError(ctx, &gqlerror.Error{Message: "boom", Extensions: map[string]interface{}{"value": math.NaN()}})
+			payloads := make(chan interface{})
+			close(payloads)
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	assert.JSONEq(t, `[{"message":"internal server error"}]`, string(readMessageOfType(t, conn, "error")["payload"]))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, reported, 1) {
+		assert.Contains(t, reported[0].Error(), "encoding errors of operation 1")
+	}
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// sealedKey is the key of the JSON objects encoding a sealed payload.
+const sealedKey = "sealed"
+
+// ErrPayloadNotSealed is returned for the payloads sent in clear to a connection requiring them to
+// be sealed.
+var ErrPayloadNotSealed = errors.New("payload not sealed")
+
+// PayloadCipher seals the payloads sent to a connection and opens the payloads it sends.
+type PayloadCipher interface {
+	// Seal encrypts an encoded payload.
+	Seal(payload []byte) ([]byte, error)
+	// Open decrypts a payload sealed by the client.
+	Open(sealed []byte) ([]byte, error)
+}
+
+// PayloadEncryption encrypts the payloads of the operations end-to-end, so that the proxies and
+// the load balancers between the server and the clients can't read them. The payloads of the
+// data/next and sync messages are sealed once encoded, right before being written, and the
+// payloads of the subscribe and sync messages may be sealed by the clients. A sealed payload is
+// sent as {"sealed":"<base64>"}. The Binary values are sealed in the payloads rather than sent
+// as binary frames, see Websocket.BinaryPayloads.
+type PayloadEncryption struct {
+	// CipherFunc returns the cipher of a connection once it is initialised, e.g. with a key
+	// negotiated in the init payload. The connection isn't encrypted when it returns nil, and is
+	// closed when it fails.
+	CipherFunc func(ctx context.Context, initPayload InitPayload) (PayloadCipher, error)
+	// Required rejects the subscribe messages whose payload isn't sealed, of the connections with a
+	// cipher.
+	Required bool
+}
+
+type sealedPayload struct {
+	Sealed []byte `json:"sealed"`
+}
+
+// NewAESGCMCipher returns a PayloadCipher sealing the payloads with AES-GCM, the key is 16, 24 or
+// 32 bytes long. The sealed payloads are the random nonce followed by the ciphertext.
+func NewAESGCMCipher(key []byte) (PayloadCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCMCipher{aead}, nil
+}
+
+type aesGCMCipher struct {
+	aead cipher.AEAD
+}
+
+func (c aesGCMCipher) Seal(payload []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(payload)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+func (c aesGCMCipher) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("sealed payload too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// initCipher sets the cipher of the connection, it returns false when the connection is closed.
+func (c *wsConnection) initCipher() bool {
+	pc, err := c.PayloadEncryption.CipherFunc(c.ctx, c.initPayload)
+	if err != nil {
+		c.handlePossibleError(fmt.Errorf("initialising payload encryption: %w", err), false)
+		c.sendConnectionError("payload encryption failed")
+		c.closeWithReason(CloseReasonTerminated)
+		return false
+	}
+	c.cipher = pc
+	return true
+}
+
+// sealPayload seals an encoded payload with the cipher of the connection.
+func (c *wsConnection) sealPayload(payload []byte) ([]byte, error) {
+	sealed, err := c.cipher.Seal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealedPayload{Sealed: sealed})
+}
+
+// openPayload opens the payload of a subscribe message when it is sealed.
+func (c *wsConnection) openPayload(payload []byte) ([]byte, error) {
+	if c.cipher == nil {
+		return payload, nil
+	}
+	var sealed sealedPayload
+	if !bytes.Contains(payload, []byte(`"`+sealedKey+`"`)) || jsonDecode(payload, &sealed) != nil || sealed.Sealed == nil {
+		if c.PayloadEncryption.Required {
+			return nil, ErrPayloadNotSealed
+		}
+		return payload, nil
+	}
+	return c.cipher.Open(sealed.Sealed)
+}
@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAESGCMCipher(t *testing.T) {
+	_, err := NewAESGCMCipher([]byte("short"))
+	assert.Error(t, err)
+
+	c, err := NewAESGCMCipher([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+	sealed, err := c.Seal([]byte(`{"data":{}}`))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "data")
+
+	opened, err := c.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data":{}}`, string(opened))
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = c.Open(sealed)
+	assert.Error(t, err)
+	_, err = c.Open([]byte("x"))
+	assert.Error(t, err)
+}
+
+func newEncryptionTestServer(t *testing.T, required bool) (*httptest.Server, PayloadCipher) {
+	key := []byte("0123456789abcdef")
+	pc, err := NewAESGCMCipher(key)
+	assert.NoError(t, err)
+	server := newTestServer(t, Websocket{PayloadEncryption: &PayloadEncryption{
+		CipherFunc: func(ctx context.Context, initPayload InitPayload) (PayloadCipher, error) {
+			switch initPayload.GetString("keyId") {
+			case "":
+				return nil, nil
+			case "k1":
+				return NewAESGCMCipher(key)
+			}
+			return nil, errors.New("unknown key")
+		},
+		Required: required,
+	}}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 1)
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"query": document}}
+			return payloads, nil
+		},
+	})
+	return server, pc
+}
+
+func TestSubscribeSealsPayloads(t *testing.T) {
+	server, pc := newEncryptionTestServer(t, true)
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"keyId": "k1"}}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	// the payloads sent in clear are rejected
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query": "subscription { clear }",
+	}}))
+	assert.Contains(t, string(readMessageOfType(t, conn, "error")["payload"]), ErrPayloadNotSealed.Error())
+
+	sealed, err := pc.Seal([]byte(`{"query":"subscription { sealed }"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "payload": map[string]interface{}{
+		"sealed": sealed,
+	}}))
+	var payload struct{ Sealed []byte }
+	assert.NoError(t, json.Unmarshal(readMessageOfType(t, conn, "next")["payload"], &payload))
+	opened, err := pc.Open(payload.Sealed)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"query":"subscription { sealed }"}}`, string(opened))
+}
+
+func TestSubscribeWithoutCipher(t *testing.T) {
+	server, _ := newEncryptionTestServer(t, true)
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query": "subscription { clear }",
+	}}))
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"query": "subscription { clear }"}}, readResponse(t, conn))
+}
+
+func TestInitClosesWhenCipherFails(t *testing.T) {
+	server, _ := newEncryptionTestServer(t, false)
+	conn := dialTestServer(t, server, graphqlwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"keyId": "unknown"}}))
+
+	msg := readMessageOfType(t, conn, "connection_error")
+	assert.JSONEq(t, `{"message":"payload encryption failed"}`, string(msg["payload"]))
+}
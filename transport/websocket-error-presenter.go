@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// CodeInternalServerError is the code of the errors redacted by RedactingErrorPresenter.
+const CodeInternalServerError = "INTERNAL_SERVER_ERROR"
+
+const redactedMessage = "internal server error"
+
+// ErrorPresenterFunc turns an error of an operation, or the error of an InitFunc, into the error
+// sent to the client. The errors created by the transport and the services are *gqlerror.Error,
+// the errors they wrap are available with errors.As.
+type ErrorPresenterFunc func(ctx context.Context, err error) *gqlerror.Error
+
+// ClientError is an error meant for the clients, its Code is sent in the "code" extension. Return
+// it, or wrap it, from a GraphQLService, a SubscribeFunc or an InitFunc.
+type ClientError struct {
+	Code    string
+	Message string
+	// Err is the cause of the error, it isn't sent to the clients.
+	Err error
+}
+
+// NewClientError returns a ClientError.
+func NewClientError(code string, message string) *ClientError {
+	return &ClientError{Code: code, Message: message}
+}
+
+func (e *ClientError) Error() string {
+	return e.Message
+}
+
+func (e *ClientError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultErrorPresenter sends the errors unchanged, the ClientErrors are sent with their code.
+func DefaultErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := asGQLError(err)
+	var clientErr *ClientError
+	if errors.As(err, &clientErr) {
+		return withErrorCode(gqlErr, clientErr)
+	}
+	return gqlErr
+}
+
+// RedactingErrorPresenter only sends the errors meant for the clients: the ClientErrors, the
+// *gqlerror.Error added with AddSubscriptionError or returned by the services, and the errors of
+// the protocol and of the validation. The other errors, e.g. of a database, are replaced by an
+// "internal server error" with the CodeInternalServerError code and passed to report when it
+// isn't nil.
+func RedactingErrorPresenter(report func(ctx context.Context, err error)) ErrorPresenterFunc {
+	return func(ctx context.Context, err error) *gqlerror.Error {
+		gqlErr := asGQLError(err)
+		var clientErr *ClientError
+		if errors.As(err, &clientErr) {
+			return withErrorCode(gqlErr, clientErr)
+		}
+		if gqlErr.Err == nil || isGQLError(gqlErr.Err) {
+			return gqlErr
+		}
+
+		if report != nil {
+			report(ctx, err)
+		}
+		return &gqlerror.Error{
+			Message:    redactedMessage,
+			Path:       gqlErr.Path,
+			Extensions: map[string]interface{}{"code": CodeInternalServerError},
+		}
+	}
+}
+
+func (c *wsConnection) presentError(err error) *gqlerror.Error {
+	if c.ErrorPresenter == nil {
+		return asGQLError(err)
+	}
+	return c.ErrorPresenter(c.ctx, err)
+}
+
+func asGQLError(err error) *gqlerror.Error {
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+	return toGQLError(err)
+}
+
+func isGQLError(err error) bool {
+	var gqlErr *gqlerror.Error
+	var list gqlerror.List
+	return errors.As(err, &gqlErr) || errors.As(err, &list)
+}
+
+// withErrorCode returns a copy of gqlErr with the message and the code of clientErr.
+func withErrorCode(gqlErr *gqlerror.Error, clientErr *ClientError) *gqlerror.Error {
+	extensions := make(map[string]interface{}, len(gqlErr.Extensions)+1)
+	for key, value := range gqlErr.Extensions {
+		extensions[key] = value
+	}
+	extensions["code"] = clientErr.Code
+	return &gqlerror.Error{
+		Err:        gqlErr.Err,
+		Message:    clientErr.Message,
+		Path:       gqlErr.Path,
+		Locations:  gqlErr.Locations,
+		Extensions: extensions,
+	}
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+var errDatabase = errors.New("pq: relation \"users\" does not exist")
+
+func TestDefaultErrorPresenter(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, &gqlerror.Error{Err: errDatabase, Message: errDatabase.Error()}, DefaultErrorPresenter(ctx, errDatabase))
+
+	clientErr := &ClientError{Code: "NOT_FOUND", Message: "user not found", Err: errDatabase}
+	presented := DefaultErrorPresenter(ctx, &gqlerror.Error{Err: clientErr, Message: "ignored", Path: ast.Path{ast.PathName("user")}})
+	assert.Equal(t, "user not found", presented.Message)
+	assert.Equal(t, map[string]interface{}{"code": "NOT_FOUND"}, presented.Extensions)
+	assert.Equal(t, ast.Path{ast.PathName("user")}, presented.Path)
+}
+
+func TestRedactingErrorPresenter(t *testing.T) {
+	var reported []error
+	presenter := RedactingErrorPresenter(func(ctx context.Context, err error) {
+		reported = append(reported, err)
+	})
+	ctx := context.Background()
+
+	redacted := presenter(ctx, toGQLError(fmt.Errorf("loading user: %w", errDatabase)))
+	assert.Equal(t, &gqlerror.Error{Message: "internal server error", Extensions: map[string]interface{}{"code": CodeInternalServerError}}, redacted)
+	if assert.Len(t, reported, 1) {
+		assert.ErrorIs(t, reported[0], errDatabase)
+	}
+
+	assert.Equal(t, "user not found", presenter(ctx, toGQLError(fmt.Errorf("wrapped: %w", NewClientError("NOT_FOUND", "user not found")))).Message)
+	safe := gqlerror.Errorf("stream failed")
+	assert.Same(t, safe, presenter(ctx, safe))
+	list := gqlerror.List{gqlerror.Errorf("invalid query")}
+	assert.Contains(t, presenter(ctx, toGQLError(list)).Message, "invalid query")
+	assert.Len(t, reported, 1)
+}
+
+func TestErrorPresenter(t *testing.T) {
+	server := newTestServer(t, Websocket{
+		ErrorPresenter: RedactingErrorPresenter(nil),
+		InitFunc: func(ctx context.Context, initPayload InitPayload) (context.Context, error) {
+			if initPayload.GetString("token") == "" {
+				return nil, errDatabase
+			}
+			return ctx, nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			if operationName == "Missing" {
+				return nil, NewClientError("NOT_FOUND", "no such stream")
+			}
+			return nil, errDatabase
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]string{"token": "t"}}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	var errs []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(readMessageOfType(t, conn, "error")["payload"], &errs))
+	assert.Equal(t, []map[string]interface{}{{"message": "internal server error", "extensions": map[string]interface{}{"code": CodeInternalServerError}}}, errs)
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "payload": map[string]interface{}{"query": "subscription Missing { value }", "operationName": "Missing"}}))
+	assert.NoError(t, json.Unmarshal(readMessageOfType(t, conn, "error")["payload"], &errs))
+	assert.Equal(t, []map[string]interface{}{{"message": "no such stream", "extensions": map[string]interface{}{"code": "NOT_FOUND"}}}, errs)
+
+	legacy := dialTestServer(t, server, graphqlwsSubprotocol)
+	assert.NoError(t, legacy.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	assert.NotContains(t, string(readMessageOfType(t, legacy, "connection_error")["payload"]), "pq:")
+}
@@ -0,0 +1,457 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const defaultEventLoopReadTimeout = 5 * time.Second
+
+var (
+	ErrEventLoopUnsupported = errors.New("event loop isn't supported on this platform")
+	errEventLoopClosed      = errors.New("event loop closed")
+	// errWouldBlock is returned by readNonBlocking when no data is available
+	errWouldBlock = errors.New("read would block")
+)
+
+// EventLoop serves initialised connections without dedicating goroutines to them. A single
+// goroutine waits for readable connections and hands them to a fixed pool of workers reading one
+// message at a time, keep alive and ping messages are sent from timers. Idle connections don't
+// hold any goroutine, which suits deployments keeping a very large number of connections open.
+// The operations are started on their own goroutine, so that slow service.Subscribe calls don't
+// hold the workers, the next messages of their connection are read once they are started.
+//
+// Connections that can't be polled, e.g. TLS connections terminated by the server, connections
+// negotiating compression or connections of coder/websocket, are served by goroutines as usual.
+// The request context isn't cancelled for connections served by the loop, they end when closed
+// by either side or when the loop is closed.
+type EventLoop struct {
+	// ReadTimeout bounds the time the rest of a message is waited for once its first bytes are
+	// readable, it defaults to 5 seconds. The worker reading an incomplete message is replaced by
+	// another one, it waits for the rest as the own goroutine of the connection.
+	ReadTimeout time.Duration
+
+	poller poller
+	tasks  chan *loopConn
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// closing is closed with the loop, the readable connections aren't handed to the workers
+	// anymore
+	closing chan struct{}
+
+	mu     sync.Mutex
+	conns  map[uint64]*loopConn
+	nextID uint64
+	closed bool
+}
+
+// poller reports the connections ready to be read, every connection is reported once until
+// rearmed.
+type poller interface {
+	add(fd int, id uint64) error
+	rearm(fd int, id uint64) error
+	remove(fd int) error
+	// wait calls ready with the id of every readable connection until the poller is closed.
+	wait(ready func(id uint64)) error
+	close() error
+}
+
+// NewEventLoop starts an event loop with the given number of workers, it defaults to the number
+// of CPUs. ErrEventLoopUnsupported is returned on platforms without a supported poller.
+func NewEventLoop(workers int) (*EventLoop, error) {
+	p, err := newPoller()
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	l := &EventLoop{
+		poller:  p,
+		tasks:   make(chan *loopConn),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+		conns:   map[uint64]*loopConn{},
+	}
+	for i := 0; i < workers; i++ {
+		l.wg.Add(1)
+		go l.work()
+	}
+	go l.poll()
+	return l, nil
+}
+
+// Count returns the number of connections served by the loop.
+func (l *EventLoop) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
+
+// Close closes the connections served by the loop and stops it. The connections are closed
+// concurrently, so that the clients not reading don't add up their write timeouts.
+func (l *EventLoop) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return errEventLoopClosed
+	}
+	l.closed = true
+	close(l.closing)
+	conns := make([]*loopConn, 0, len(l.conns))
+	for _, lc := range l.conns {
+		conns = append(conns, lc)
+	}
+	l.mu.Unlock()
+
+	var closing sync.WaitGroup
+	for _, lc := range conns {
+		closing.Add(1)
+		go func() {
+			defer closing.Done()
+			lc.c.closeWithReason(CloseReasonShuttingDown)
+		}()
+	}
+	closing.Wait()
+
+	err := l.poller.close()
+	<-l.done
+	close(l.tasks)
+	l.wg.Wait()
+	return err
+}
+
+func (l *EventLoop) poll() {
+	defer close(l.done)
+	_ = l.poller.wait(func(id uint64) {
+		l.mu.Lock()
+		lc := l.conns[id]
+		l.mu.Unlock()
+		if lc == nil {
+			return
+		}
+		// the workers may all be detached once the loop is closed
+		select {
+		case l.tasks <- lc:
+		case <-l.closing:
+		}
+	})
+}
+
+func (l *EventLoop) work() {
+	defer l.wg.Done()
+	for lc := range l.tasks {
+		if detached := lc.read(); detached {
+			return
+		}
+	}
+}
+
+// replaceWorker starts a worker replacing the one detached to read an incomplete message, unless
+// the loop is closed and its workers are being waited for.
+func (l *EventLoop) replaceWorker() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.wg.Add(1)
+	go l.work()
+}
+
+func (l *EventLoop) readTimeout() time.Duration {
+	if l.ReadTimeout == 0 {
+		return defaultEventLoopReadTimeout
+	}
+	return l.ReadTimeout
+}
+
+// pollFD returns the file descriptor of conn, it returns false if conn can't be polled.
+func pollFD(conn net.Conn) (int, bool) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	fd := -1
+	if err := raw.Control(func(s uintptr) { fd = int(s) }); err != nil || fd < 0 {
+		return 0, false
+	}
+	return fd, true
+}
+
+// loopConn is a connection served by an event loop.
+type loopConn struct {
+	loop *EventLoop
+	c    *wsConnection
+	fd   int
+
+	lastAlive atomic.Int64
+
+	mu         sync.Mutex
+	id         uint64
+	closed     bool
+	cancel     context.CancelFunc
+	stopCancel func() bool
+	unregister func()
+	keepAlive  *time.Timer
+	ping       *time.Timer
+	liveness   *time.Timer
+}
+
+func (l *EventLoop) newConn(c *wsConnection, fd int) *loopConn {
+	return &loopConn{loop: l, c: c, fd: fd}
+}
+
+// start hands the initialised connection to the loop, unregister is called once it is closed. It
+// returns false if the connection couldn't be added to the loop and must be closed.
+func (lc *loopConn) start(unregister func()) bool {
+	c := lc.c
+	l := lc.loop
+
+	lc.mu.Lock()
+	if lc.closed {
+		lc.mu.Unlock()
+		if unregister != nil {
+			unregister()
+		}
+		return true
+	}
+	defer lc.mu.Unlock()
+	lc.unregister = unregister
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return false
+	}
+	l.nextID++
+	lc.id = l.nextID
+	l.conns[lc.id] = lc
+	l.mu.Unlock()
+
+	var ctx context.Context
+	ctx, lc.cancel = context.WithCancel(c.ctx)
+
+	// If we're running in graphql-ws mode, send a keep alive message every interval
+	if (c.conn.Subprotocol() == "" || c.conn.Subprotocol() == graphqlwsSubprotocol) && c.KeepAlivePingInterval != 0 {
+		lc.every(&lc.keepAlive, c.KeepAlivePingInterval, func() {
+			c.write(&message{t: keepAliveMessageType})
+		})
+	}
+
+	// If we're running in graphql-transport-ws mode, send a ping message every interval and drop
+	// the connection once the client stayed silent for too long
+	if c.conn.Subprotocol() == graphqltransportwsSubprotocol && c.PingPongInterval != 0 {
+		lc.every(&lc.ping, c.PingPongInterval, c.sendPing)
+		lc.resetLiveness()
+		lc.liveness = time.AfterFunc(c.pongWait(), lc.checkLiveness)
+	}
+
+	// If we're running in graphql-ws mode, drop the connection once the client stopped sending
+	// keep alives
+	if c.conn.Subprotocol() != graphqltransportwsSubprotocol && c.ClientKeepAliveTimeout != 0 {
+		lc.resetLiveness()
+		lc.liveness = time.AfterFunc(c.livenessWait(), lc.checkLiveness)
+	}
+
+	// Close the connection when the context is cancelled.
+	lc.stopCancel = context.AfterFunc(ctx, func() { c.closeOnCancel(ctx) })
+
+	if err := l.poller.add(lc.fd, lc.id); err != nil {
+		c.handlePossibleError(err, true)
+		return false
+	}
+	return true
+}
+
+// every calls fn every interval until the connection is closed.
+func (lc *loopConn) every(timer **time.Timer, interval time.Duration, fn func()) {
+	var tick func()
+	tick = func() {
+		fn()
+		lc.mu.Lock()
+		if !lc.closed {
+			*timer = time.AfterFunc(interval, tick)
+		}
+		lc.mu.Unlock()
+	}
+	*timer = time.AfterFunc(interval, tick)
+}
+
+func (lc *loopConn) resetLiveness() {
+	lc.lastAlive.Store(time.Now().UnixNano())
+}
+
+func (lc *loopConn) checkLiveness() {
+	wait := lc.c.livenessWait()
+	if silent := time.Since(time.Unix(0, lc.lastAlive.Load())); silent < wait {
+		lc.mu.Lock()
+		if !lc.closed {
+			lc.liveness = time.AfterFunc(wait-silent, lc.checkLiveness)
+		}
+		lc.mu.Unlock()
+		return
+	}
+	lc.c.livenessFailure()
+}
+
+// read handles the next message of a readable connection and waits for the following one. It
+// returns true when the worker was detached to wait for the rest of an incomplete message, it then
+// stops being a worker.
+func (lc *loopConn) read() bool {
+	c := lc.c
+	_ = c.conn.SetReadDeadline(time.Now().Add(lc.loop.readTimeout()))
+
+	src := c.me.(netpollExchanger).src
+	src.polling.Store(true)
+	src.detached.Store(false)
+	m, err := c.me.NextMessage()
+	// the connection may be read by another worker once the message is handled
+	detached := src.detached.Load()
+	src.polling.Store(false)
+	if err != nil {
+		c.handleReadError(err)
+		c.closeOnInvalidMessage(err)
+		c.closeWithReason(CloseReasonUnexpectedClosure)
+		return detached
+	}
+
+	if m.t == startMessageType {
+		go lc.handle(&m)
+		return detached
+	}
+	lc.handle(&m)
+	return detached
+}
+
+// handle handles a message and waits for the next one.
+func (lc *loopConn) handle(m *message) {
+	c := lc.c
+	if !c.handleMessage(m) {
+		return
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if !lc.closed {
+		if err := lc.loop.poller.rearm(lc.fd, lc.id); err != nil {
+			c.handlePossibleError(err, true)
+		}
+	}
+}
+
+// teardown releases the resources of the connection, it is called before its network connection
+// is closed so the file descriptor can't be reused while still polled.
+func (lc *loopConn) teardown() {
+	lc.mu.Lock()
+	if lc.closed {
+		lc.mu.Unlock()
+		return
+	}
+	lc.closed = true
+	if lc.id != 0 {
+		_ = lc.loop.poller.remove(lc.fd)
+	}
+	for _, timer := range []*time.Timer{lc.keepAlive, lc.ping, lc.liveness} {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	lc.mu.Unlock()
+
+	if lc.stopCancel != nil {
+		lc.stopCancel()
+	}
+	if lc.cancel != nil {
+		lc.cancel()
+	}
+
+	l := lc.loop
+	l.mu.Lock()
+	if l.conns[lc.id] == lc {
+		delete(l.conns, lc.id)
+	}
+	l.mu.Unlock()
+
+	if lc.unregister != nil {
+		lc.unregister()
+	}
+}
+
+// frameDecoder is implemented by the message exchangers able to decode a message read elsewhere.
+type frameDecoder interface {
+	decode(data []byte) (message, error)
+}
+
+// netpollExchanger reads the messages of a connection served by an event loop with a frameReader
+// and leaves the encoding and writes to the wrapped exchanger.
+type netpollExchanger struct {
+	messageExchanger
+	reader *frameReader
+	src    *loopReader
+}
+
+func newNetpollExchanger(me messageExchanger, ws rawSocket, limit int64, loop *EventLoop) netpollExchanger {
+	src := &loopReader{conn: ws.NetConn(), loop: loop}
+	src.raw, _ = ws.NetConn().(syscall.Conn).SyscallConn()
+	return netpollExchanger{
+		messageExchanger: me,
+		reader:           &frameReader{src: src, ws: ws, limit: limit},
+		src:              src,
+	}
+}
+
+// loopReader reads the network connection of a connection served by an event loop. While polling,
+// i.e. read by a worker, it doesn't wait for the data: once the data available is read, the worker
+// is detached from the loop and replaced by another one, so that the clients sending incomplete
+// messages can't hold the workers. It is read by a single goroutine at a time, the workers handing
+// it to each other through the poller.
+type loopReader struct {
+	conn net.Conn
+	raw  syscall.RawConn
+	loop *EventLoop
+
+	polling  atomic.Bool
+	detached atomic.Bool
+}
+
+func (r *loopReader) Read(p []byte) (int, error) {
+	if r.polling.Load() && !r.detached.Load() {
+		n, err := readNonBlocking(r.raw, p)
+		if !errors.Is(err, errWouldBlock) {
+			return n, err
+		}
+		r.detached.Store(true)
+		r.loop.replaceWorker()
+	}
+	return r.conn.Read(p)
+}
+
+func (me netpollExchanger) NextMessage() (message, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	data, err := me.reader.read(buf)
+	if err != nil {
+		return message{}, handleNextReaderError(err)
+	}
+
+	return me.messageExchanger.(frameDecoder).decode(data)
+}
+
+func (me netpollExchanger) encode(buf *bytes.Buffer, m *message) ([]byte, error) {
+	return me.messageExchanger.(frameEncoder).encode(buf, m)
+}
@@ -0,0 +1,110 @@
+//go:build linux
+
+package transport
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+const epollEvents = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+
+// epoller is the poller of linux, connections are registered one shot and rearmed once read. The
+// read end of a pipe wakes the waiting goroutine up when the poller is closed.
+type epoller struct {
+	fd   int
+	wake [2]int
+}
+
+func newPoller() (poller, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &epoller{fd: fd}
+	if err := syscall.Pipe2(p.wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+	// the id 0 is never given to a connection
+	if err := syscall.EpollCtl(fd, syscall.EPOLL_CTL_ADD, p.wake[0], &syscall.EpollEvent{Events: syscall.EPOLLIN}); err != nil {
+		p.release()
+		return nil, err
+	}
+	return p, nil
+}
+
+func epollEvent(id uint64) *syscall.EpollEvent {
+	return &syscall.EpollEvent{Events: epollEvents, Fd: int32(uint32(id)), Pad: int32(uint32(id >> 32))}
+}
+
+func (p *epoller) add(fd int, id uint64) error {
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_ADD, fd, epollEvent(id))
+}
+
+func (p *epoller) rearm(fd int, id uint64) error {
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_MOD, fd, epollEvent(id))
+}
+
+func (p *epoller) remove(fd int) error {
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_DEL, fd, nil)
+}
+
+func (p *epoller) wait(ready func(id uint64)) error {
+	defer p.release()
+
+	events := make([]syscall.EpollEvent, 128)
+	for {
+		n, err := syscall.EpollWait(p.fd, events, -1)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return err
+		}
+
+		for _, event := range events[:n] {
+			id := uint64(uint32(event.Fd)) | uint64(uint32(event.Pad))<<32
+			if id == 0 {
+				return nil
+			}
+			ready(id)
+		}
+	}
+}
+
+func (p *epoller) close() error {
+	_, err := syscall.Write(p.wake[1], []byte{0})
+	return err
+}
+
+func (p *epoller) release() {
+	_ = syscall.Close(p.wake[0])
+	_ = syscall.Close(p.wake[1])
+	_ = syscall.Close(p.fd)
+}
+
+// readNonBlocking reads the data available on conn without waiting, it returns errWouldBlock when
+// there is none.
+func readNonBlocking(conn syscall.RawConn, p []byte) (int, error) {
+	var n int
+	var readErr error
+	if err := conn.Read(func(fd uintptr) bool {
+		n, readErr = syscall.Read(int(fd), p)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	switch {
+	case errors.Is(readErr, syscall.EAGAIN):
+		return 0, errWouldBlock
+	case readErr != nil:
+		return 0, os.NewSyscallError("read", readErr)
+	case n == 0 && len(p) > 0:
+		return 0, io.EOF
+	}
+	return n, nil
+}
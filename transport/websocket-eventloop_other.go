@@ -0,0 +1,13 @@
+//go:build !linux
+
+package transport
+
+import "syscall"
+
+func newPoller() (poller, error) {
+	return nil, ErrEventLoopUnsupported
+}
+
+func readNonBlocking(conn syscall.RawConn, p []byte) (int, error) {
+	return 0, errWouldBlock
+}
@@ -0,0 +1,274 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEventLoop(t *testing.T) *EventLoop {
+	t.Helper()
+	if socketLibrary == "coder/websocket" {
+		t.Skip("coder/websocket connections are served by goroutines")
+	}
+	loop, err := NewEventLoop(2)
+	if errors.Is(err, ErrEventLoopUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = loop.Close() })
+	return loop
+}
+
+func waitForLoopCount(t *testing.T, loop *EventLoop, count int) {
+	t.Helper()
+	assert.Eventually(t, func() bool { return loop.Count() == count }, time.Second, 5*time.Millisecond)
+}
+
+func TestEventLoopServesSubscriptions(t *testing.T) {
+	for _, subprotocol := range []string{graphqlwsSubprotocol, graphqltransportwsSubprotocol} {
+		t.Run(subprotocol, func(t *testing.T) {
+			loop := newTestEventLoop(t)
+			payloads := make(chan interface{})
+			server := newTestServer(t, Websocket{EventLoop: loop}, testGraphQLService{
+				subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+					return payloads, nil
+				},
+			})
+
+			conn := dialTestServer(t, server, subprotocol)
+			assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+			readMessageOfType(t, conn, "connection_ack")
+			waitForLoopCount(t, loop, 1)
+
+			start := "subscribe"
+			data := "next"
+			if subprotocol == graphqlwsSubprotocol {
+				start = "start"
+				data = "data"
+			}
+			assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": start, "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+			readMessageOfType(t, conn, data)
+			close(payloads)
+			assert.Equal(t, `"1"`, string(readMessageOfType(t, conn, "complete")["id"]))
+
+			assert.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+			waitForLoopCount(t, loop, 0)
+		})
+	}
+}
+
+func TestEventLoopSubscribesHoldNoWorker(t *testing.T) {
+	loop := newTestEventLoop(t)
+	proceed := make(chan struct{})
+	defer close(proceed)
+	server := newTestServer(t, Websocket{EventLoop: loop}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			<-proceed
+			return nil, errors.New("unavailable")
+		},
+	})
+
+	// more connections than workers wait for their operations to be started
+	for range 4 {
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	}
+	waitForLoopCount(t, loop, 4)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	waitForLoopCount(t, loop, 5)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping"}))
+	readMessageOfType(t, conn, "pong")
+}
+
+func TestEventLoopIdleConnectionsHoldNoGoroutine(t *testing.T) {
+	loop := newTestEventLoop(t)
+	server := newTestServer(t, Websocket{EventLoop: loop, KeepAlivePingInterval: time.Minute}, nil)
+
+	// the first connection starts the goroutines of the test server
+	conn := dialTestServer(t, server, graphqlwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	waitForLoopCount(t, loop, 1)
+	before := runtime.NumGoroutine()
+
+	const connections = 50
+	for i := 0; i < connections; i++ {
+		conn := dialTestServer(t, server, graphqlwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+	}
+	waitForLoopCount(t, loop, connections+1)
+
+	assert.Eventually(t, func() bool { return runtime.NumGoroutine()-before < connections/5 }, time.Second, 10*time.Millisecond)
+}
+
+func TestEventLoopReadsFragmentedMessagesAndControlFrames(t *testing.T) {
+	loop := newTestEventLoop(t)
+	server := newTestServer(t, Websocket{EventLoop: loop}, nil)
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqltransportwsSubprotocol}, WriteBufferSize: 8}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pongs <- data
+		return nil
+	})
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"padding": strings.Repeat("x", 64)}}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteControl(websocket.PingMessage, []byte("hello"), time.Now().Add(time.Second)))
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping"}))
+	readMessageOfType(t, conn, "pong")
+	select {
+	case data := <-pongs:
+		assert.Equal(t, "hello", data)
+	default:
+		t.Fatal("expected a pong control frame")
+	}
+}
+
+func TestEventLoopDropsSilentClients(t *testing.T) {
+	loop := newTestEventLoop(t)
+	failures := make(chan int, 1)
+	server := newTestServer(t, Websocket{
+		EventLoop:        loop,
+		PingPongInterval: 20 * time.Millisecond,
+		LivenessFailureFunc: func(ctx context.Context, missedPongs int) {
+			failures <- missedPongs
+		},
+	}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	readMessageOfType(t, conn, "ping")
+
+	select {
+	case missed := <-failures:
+		assert.Greater(t, missed, 0)
+	case <-time.After(time.Second):
+		t.Fatal("expected the connection to be dropped")
+	}
+	waitForLoopCount(t, loop, 0)
+}
+
+func TestEventLoopCloseClosesConnections(t *testing.T) {
+	loop := newTestEventLoop(t)
+	server := newTestServer(t, Websocket{EventLoop: loop}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	waitForLoopCount(t, loop, 1)
+
+	assert.NoError(t, loop.Close())
+	assert.Equal(t, 0, loop.Count())
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error %v", err)
+	assert.Error(t, loop.Close())
+}
+
+func TestEventLoopCloseClientsNotReading(t *testing.T) {
+	const clients = 4
+	loop := newTestEventLoop(t)
+	var sent, ended atomic.Int64
+	server := newTestServer(t, Websocket{EventLoop: loop}, floodingService{&sent, &ended}.service())
+
+	for i := 0; i < clients; i++ {
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+	}
+	// the clients stop reading
+	waitForStuckWrites(t, &sent)
+	waitForLoopCount(t, loop, clients)
+
+	// the write timeouts of the connections don't add up
+	start := time.Now()
+	assert.NoError(t, loop.Close())
+	assert.Less(t, time.Since(start), 2*clients*controlWriteTimeout/3)
+	assert.Equal(t, 0, loop.Count())
+	assert.Eventually(t, func() bool { return ended.Load() == clients }, time.Second, 5*time.Millisecond, "Expected every operation to end")
+}
+
+func TestEventLoopIncompleteMessagesHoldNoWorker(t *testing.T) {
+	loop := newTestEventLoop(t)
+	loop.ReadTimeout = time.Minute
+	server := newTestServer(t, Websocket{EventLoop: loop}, nil)
+
+	// more clients than workers send the first byte of a frame header only
+	for i := 0; i < 4; i++ {
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+		_, err := conn.UnderlyingConn().Write([]byte{0x81})
+		assert.NoError(t, err)
+	}
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping"}))
+	readMessageOfType(t, conn, "pong")
+}
+
+func TestEventLoopReadLimit(t *testing.T) {
+	loop := newTestEventLoop(t)
+	server := newTestServer(t, Websocket{EventLoop: loop, ReadLimit: 64}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	waitForLoopCount(t, loop, 1)
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping", "payload": map[string]interface{}{"padding": strings.Repeat("x", 64)}}))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, closeMessageTooBig), "unexpected error %v", err)
+	waitForLoopCount(t, loop, 0)
+}
+
+func TestEventLoopRejectsLengthsWithTheMostSignificantBit(t *testing.T) {
+	loop := newTestEventLoop(t)
+	server := newTestServer(t, Websocket{EventLoop: loop}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	waitForLoopCount(t, loop, 1)
+
+	// a masked text frame of 2^63 bytes
+	header := []byte{0x81, 0x80 | 127, 0x80, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}
+	_, err := conn.UnderlyingConn().Write(header)
+	assert.NoError(t, err)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, closeProtocolError), "unexpected error %v", err)
+	waitForLoopCount(t, loop, 0)
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+)
+
+var operationExtensionsCtxKey = &wsOperationExtensionsContextKey{"operation-extensions"}
+
+type wsOperationExtensionsContextKey struct {
+	name string
+}
+
+// OperationExtensions is the extensions map sent by the client with an operation, e.g. to carry
+// persisted query hashes, tracing headers or the version of the client.
+type OperationExtensions map[string]interface{}
+
+// GetString safely gets a string value from the extensions. It returns an empty string if the
+// extensions are nil or the value isn't set.
+func (e OperationExtensions) GetString(key string) string {
+	res, _ := e[key].(string)
+	return res
+}
+
+// Decode decodes the extension named key into v. It leaves v untouched if the extension isn't set.
+func (e OperationExtensions) Decode(key string, v interface{}) error {
+	value, ok := e[key]
+	if !ok {
+		return nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return jsonDecode(b, v)
+}
+
+// UnmarshalJSON keeps every extension while decoding the ones used by the transport.
+func (e *startMessageExtensions) UnmarshalJSON(b []byte) error {
+	type extensions startMessageExtensions
+	if err := jsonDecode(b, (*extensions)(e)); err != nil {
+		return err
+	}
+	return jsonDecode(b, &e.all)
+}
+
+func withOperationExtensions(ctx context.Context, extensions OperationExtensions) context.Context {
+	return context.WithValue(ctx, operationExtensionsCtxKey, extensions)
+}
+
+// GetOperationExtensions returns the extensions sent by the client with the operation the context
+// belongs to, or nil if the client didn't send any.
+func GetOperationExtensions(ctx context.Context) OperationExtensions {
+	extensions, _ := ctx.Value(operationExtensionsCtxKey).(OperationExtensions)
+	return extensions
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOperationExtensions(t *testing.T) {
+	assert.Nil(t, GetOperationExtensions(context.Background()))
+
+	extensions := OperationExtensions{"clientVersion": "1.2.0"}
+	ctx := withOperationExtensions(context.Background(), extensions)
+	assert.Equal(t, extensions, GetOperationExtensions(ctx))
+	assert.Equal(t, "1.2.0", GetOperationExtensions(ctx).GetString("clientVersion"))
+	assert.Equal(t, "", GetOperationExtensions(ctx).GetString("missing"))
+}
+
+func TestOperationExtensionsDecode(t *testing.T) {
+	extensions := OperationExtensions{
+		"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": "abc"},
+	}
+
+	var persistedQuery struct {
+		Version    int    `json:"version"`
+		Sha256Hash string `json:"sha256Hash"`
+	}
+	assert.NoError(t, extensions.Decode("persistedQuery", &persistedQuery))
+	assert.Equal(t, 1, persistedQuery.Version)
+	assert.Equal(t, "abc", persistedQuery.Sha256Hash)
+	assert.NoError(t, extensions.Decode("missing", &persistedQuery))
+}
+
+func TestSubscribePropagatesOperationExtensions(t *testing.T) {
+	extensions := make(chan OperationExtensions, 2)
+	server := newTestServer(t, Websocket{}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			extensions <- GetOperationExtensions(ctx)
+			return make(chan interface{}), nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query":      "subscription { value }",
+		"extensions": map[string]interface{}{"traceparent": "00-abc-def-01", "resumption": map[string]interface{}{}},
+	}}))
+	received := <-extensions
+	assert.Equal(t, "00-abc-def-01", received.GetString("traceparent"))
+	assert.Contains(t, received, "resumption")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "payload": map[string]interface{}{
+		"query": "subscription { value }",
+	}}))
+	assert.Nil(t, <-extensions)
+}
@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+var upgradeRequiredPage = template.Must(template.New("upgrade-required").Parse(`<!DOCTYPE html>
+<html>
+<head><title>WebSocket upgrade required</title></head>
+<body>
+<h1>WebSocket upgrade required</h1>
+<p>This endpoint serves GraphQL subscriptions over WebSocket connections negotiating one of these subprotocols:</p>
+<ul>{{range .Subprotocols}}<li><code>{{.}}</code></li>{{end}}</ul>
+{{if .Docs}}<p>See the <a href="{{.Docs}}">documentation</a>.</p>{{end}}
+</body>
+</html>
+`))
+
+// UpgradeRequired returns a Fallback answering 426 Upgrade Required, with the subprotocols the
+// Websocket supports and a link to the documentation when docs isn't empty: as an HTML page for
+// the browsers and as a GraphQL error response otherwise.
+func (t *Websocket) UpgradeRequired(docs string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subprotocols := t.Subprotocols()
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Connection", "Upgrade")
+
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUpgradeRequired)
+			_ = upgradeRequiredPage.Execute(w, struct {
+				Subprotocols []string
+				Docs         string
+			}{subprotocols, docs})
+			return
+		}
+
+		extensions := map[string]interface{}{"subprotocols": subprotocols}
+		if docs != "" {
+			extensions["docs"] = docs
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUpgradeRequired)
+		_ = json.NewEncoder(w).Encode(&gqlResponse{
+			Errors:     gqlerror.List{{Message: "websocket upgrade required"}},
+			Extensions: extensions,
+		})
+	})
+}
+
+// Subprotocols returns the subprotocols served by the Websocket, including the registered ones.
+func (t *Websocket) Subprotocols() []string {
+	subprotocols := append([]string{}, supportedSubprotocols...)
+	registered := make([]string, 0, len(t.subprotocols))
+	for name := range t.subprotocols {
+		if !contains(subprotocols, name) {
+			registered = append(registered, name)
+		}
+	}
+	sort.Strings(registered)
+	return append(subprotocols, registered...)
+}
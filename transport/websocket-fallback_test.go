@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsWebsocketRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+	assert.False(t, IsWebsocketRequest(r))
+
+	r.Header.Set("Upgrade", "h2c")
+	r.Header.Set("Connection", "Upgrade")
+	assert.False(t, IsWebsocketRequest(r))
+
+	r.Header.Set("Upgrade", "WebSocket")
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	assert.True(t, IsWebsocketRequest(r))
+	assert.True(t, Websocket{}.Supports(r))
+
+	r.Method = http.MethodPost
+	assert.False(t, IsWebsocketRequest(r))
+}
+
+func TestUpgradeRequired(t *testing.T) {
+	handler := Websocket{}
+	handler.RegisterSubprotocol("x-test", func(conn SubprotocolConn) MessageExchanger {
+		return testSubprotocolExchanger{conn: conn}
+	})
+	handler.Fallback = handler.UpgradeRequired("https://example.com/docs")
+	server := newTestServer(t, handler, nil)
+
+	resp, err := http.Get(server.URL)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+		assert.Equal(t, "websocket", resp.Header.Get("Upgrade"))
+		var body struct {
+			Errors     []struct{ Message string }
+			Extensions struct {
+				Subprotocols []string
+				Docs         string
+			}
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		if assert.Len(t, body.Errors, 1) {
+			assert.Equal(t, "websocket upgrade required", body.Errors[0].Message)
+		}
+		assert.Equal(t, []string{graphqlwsSubprotocol, graphqltransportwsSubprotocol, "x-test"}, body.Extensions.Subprotocols)
+		assert.Equal(t, "https://example.com/docs", body.Extensions.Docs)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err = http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+		page, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(page), "<code>graphql-transport-ws</code>")
+		assert.Contains(t, string(page), `href="https://example.com/docs"`)
+	}
+
+	// the websocket upgrades are still served
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+}
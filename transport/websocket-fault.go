@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrFaultInjected is reported to the ErrorFunc for writes disturbed by a FaultInjector.
+var ErrFaultInjected = errors.New("fault injected")
+
+// FaultInjector randomly disturbs the messages written to clients. It is meant to verify the
+// reconnection logic of clients in CI and must not be enabled in production. Every rate is a
+// probability between 0 and 1 and is evaluated for each outgoing message.
+type FaultInjector struct {
+	// CloseRate is the probability that the connection is closed abruptly, without a close frame.
+	CloseRate float64
+	// WriteFailureRate is the probability that a message is dropped and reported as a write error.
+	WriteFailureRate float64
+	// TruncateRate is the probability that only the first half of a message is written, resulting in
+	// invalid JSON on the client side.
+	TruncateRate float64
+	// DelayRate is the probability that a message is delayed by a random duration up to MaxDelay.
+	// The delay happens before the connection is locked for the write, so that it doesn't hold the
+	// other writes, e.g. the pings and the close frame, nor count as a slow write.
+	DelayRate float64
+	MaxDelay  time.Duration
+
+	// Rand is the source of randomness, a time seeded source is used when it is nil.
+	Rand *rand.Rand
+
+	mu sync.Mutex
+}
+
+func (f *FaultInjector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Rand == nil {
+		f.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return f.Rand.Float64() < rate
+}
+
+func (f *FaultInjector) delay() time.Duration {
+	if f.MaxDelay <= 0 {
+		return 0
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Duration(f.Rand.Int63n(int64(f.MaxDelay)))
+}
+
+// send writes msg with write unless a fault is injected.
+func (f *FaultInjector) send(conn socket, msg *message, write func(msg *message) error) error {
+	switch {
+	case f.roll(f.CloseRate):
+		_ = conn.Close()
+		return ErrFaultInjected
+	case f.roll(f.WriteFailureRate):
+		return ErrFaultInjected
+	case f.roll(f.TruncateRate):
+		b, err := json.Marshal(map[string]interface{}{"id": msg.id, "payload": msg.payload})
+		if err != nil {
+			return err
+		}
+		if err := conn.WriteMessage(b[:len(b)/2]); err != nil {
+			return err
+		}
+		return ErrFaultInjected
+	}
+
+	return write(msg)
+}
+
+// delayWrite waits before a write, when a delay is injected, without the lock of the connection.
+func (f *FaultInjector) delayWrite() {
+	if f.roll(f.DelayRate) {
+		time.Sleep(f.delay())
+	}
+}
+
+func (c *wsConnection) send(msg *message) error {
+	if c.slowConsumer != nil {
+		defer c.slowConsumer.observeWrite(c.slowConsumer.startWrite())
+	}
+	if c.FaultInjector != nil {
+		return c.FaultInjector.send(c.conn, msg, c.sendMessage)
+	}
+
+	return c.sendMessage(msg)
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjectorRoll(t *testing.T) {
+	f := &FaultInjector{Rand: rand.New(rand.NewSource(1))}
+
+	assert.False(t, f.roll(0), "Expected a zero rate to never inject a fault")
+	assert.True(t, f.roll(1), "Expected a rate of one to always inject a fault")
+}
+
+func TestFaultInjectorDelay(t *testing.T) {
+	f := &FaultInjector{Rand: rand.New(rand.NewSource(1))}
+	assert.Equal(t, time.Duration(0), f.delay())
+
+	f.MaxDelay = 10 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		d := f.delay()
+		assert.True(t, d >= 0 && d < 10*time.Millisecond)
+	}
+}
+
+func initWithFaults(t *testing.T, faults *FaultInjector) (*websocket.Conn, <-chan error) {
+	errs := make(chan error, 16)
+	server := newTestServer(t, Websocket{
+		FaultInjector: faults,
+		ErrorFunc: func(ctx context.Context, err error) {
+			errs <- err
+		},
+	}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+	return conn, errs
+}
+
+func TestFaultInjectorWriteFailure(t *testing.T) {
+	_, errs := initWithFaults(t, &FaultInjector{WriteFailureRate: 1})
+
+	select {
+	case err := <-errs:
+		assert.True(t, errors.Is(err, ErrFaultInjected))
+	case <-time.After(time.Second):
+		t.Fatal("Expected the injected write failure to be reported")
+	}
+}
+
+func TestFaultInjectorTruncate(t *testing.T) {
+	conn, _ := initWithFaults(t, &FaultInjector{TruncateRate: 1})
+
+	var msg map[string]interface{}
+	assert.Error(t, conn.ReadJSON(&msg), "Expected the truncated message to be invalid JSON")
+}
+
+func TestFaultInjectorClose(t *testing.T) {
+	conn, _ := initWithFaults(t, &FaultInjector{CloseRate: 1})
+
+	_, _, err := conn.ReadMessage()
+	assert.Error(t, err)
+	assert.False(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "Expected the connection to close without a close frame")
+}
+
+func TestFaultInjectorDelayDoesNotHoldConnection(t *testing.T) {
+	registry := NewRegistry()
+	// the seed delays the ack and the keep alive by a few milliseconds, and the pong by 2 seconds
+	server := newTestServer(t, Websocket{
+		Registry:      registry,
+		FaultInjector: &FaultInjector{DelayRate: 1, MaxDelay: 2 * time.Second, Rand: rand.New(rand.NewSource(331846))},
+	}, nil)
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.Eventually(t, func() bool { return registry.Count() == 1 }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "ping"}))
+	time.Sleep(50 * time.Millisecond)
+	if !assert.Len(t, registry.Connections(), 1) {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		registry.Connections()[0].Close(closeGoingAway, "bye")
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the close not to wait for the delayed pong")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, closeGoingAway), "Expected the close frame before the pong, got %v", err)
+}
+
+func TestFaultInjectorDelayedMessage(t *testing.T) {
+	conn, _ := initWithFaults(t, &FaultInjector{DelayRate: 1, MaxDelay: 5 * time.Millisecond})
+
+	var msg graphqltransportwsMessage
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, graphqltransportwsConnectionAckMsg, msg.Type)
+}
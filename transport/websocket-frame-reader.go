@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var errProtocolViolation = errors.New("websocket protocol violation")
+
+// frameReader reads client frames straight from the network connection. Nothing is read beyond
+// the current message, so the readiness reported by a poller for the connection stays accurate.
+// Control frames are answered through the socket, which keeps handling the writes.
+type frameReader struct {
+	src io.Reader
+	ws  rawSocket
+	hdr [8]byte
+	// limit bounds the size of the messages, it is disabled when zero
+	limit int64
+	// onPing is called for the ping frames when set
+	onPing func()
+}
+
+// read reads the next data message into buf. Close frames are returned as close errors of the
+// socket.
+func (r *frameReader) read(buf *bytes.Buffer) ([]byte, error) {
+	start := buf.Len()
+	inMessage := false
+	for {
+		fin, opcode, err := r.readFrame(buf, start)
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opText, opBinary:
+			if inMessage {
+				return nil, r.fail(closeProtocolError, errProtocolViolation)
+			}
+			inMessage = true
+		case opContinuation:
+			if !inMessage {
+				return nil, r.fail(closeProtocolError, errProtocolViolation)
+			}
+		default:
+			// control frames may be interleaved with the frames of a message
+			continue
+		}
+
+		if inMessage && fin {
+			return buf.Bytes()[start:], nil
+		}
+	}
+}
+
+// readFrame reads a frame, appending the payload of data frames to the message starting at start
+// in buf. Control frames are answered, an error is returned when they end the connection.
+func (r *frameReader) readFrame(buf *bytes.Buffer, start int) (bool, byte, error) {
+	if _, err := io.ReadFull(r.src, r.hdr[:2]); err != nil {
+		return false, 0, err
+	}
+
+	fin := r.hdr[0]&0x80 != 0
+	opcode := r.hdr[0] & 0x0f
+	masked := r.hdr[1]&0x80 != 0
+	length := uint64(r.hdr[1] & 0x7f)
+
+	// no extension is negotiated, RSV bits must be zero and client frames must be masked
+	if r.hdr[0]&0x70 != 0 || !masked {
+		return false, 0, r.fail(closeProtocolError, errProtocolViolation)
+	}
+
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(r.src, r.hdr[:2]); err != nil {
+			return false, 0, err
+		}
+		length = uint64(binary.BigEndian.Uint16(r.hdr[:2]))
+	case 127:
+		if _, err := io.ReadFull(r.src, r.hdr[:8]); err != nil {
+			return false, 0, err
+		}
+		length = binary.BigEndian.Uint64(r.hdr[:8])
+		// the most significant bit of the 64-bit length must be 0
+		if length>>63 != 0 {
+			return false, 0, r.fail(closeProtocolError, errProtocolViolation)
+		}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r.src, mask[:]); err != nil {
+		return false, 0, err
+	}
+
+	isControl := opcode&0x8 != 0
+	if isControl && (!fin || length > 125) {
+		return false, 0, r.fail(closeProtocolError, errProtocolViolation)
+	}
+
+	switch opcode {
+	case opContinuation, opText, opBinary:
+		if r.limit > 0 && length > uint64(r.limit)-uint64(buf.Len()-start) {
+			return false, 0, r.fail(closeMessageTooBig, errReadLimit)
+		}
+		frameStart := buf.Len()
+		if _, err := io.CopyN(buf, r.src, int64(length)); err != nil {
+			return false, 0, err
+		}
+		unmask(buf.Bytes()[frameStart:], mask)
+		return fin, opcode, nil
+	case opClose, opPing, opPong:
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r.src, payload); err != nil {
+			return false, 0, err
+		}
+		unmask(payload, mask)
+		return true, opcode, r.control(opcode, payload)
+	default:
+		return false, 0, r.fail(closeProtocolError, errProtocolViolation)
+	}
+}
+
+// control answers a control frame, it returns an error when the connection is closed.
+func (r *frameReader) control(opcode byte, payload []byte) error {
+	switch opcode {
+	case opPing:
+		if r.onPing != nil {
+			r.onPing()
+		}
+		return r.ws.WritePong(payload)
+	case opClose:
+		code, text := closeNoStatusReceived, ""
+		if len(payload) >= 2 {
+			code, text = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+			if !utf8.ValidString(text) {
+				return r.fail(closeProtocolError, errProtocolViolation)
+			}
+		}
+		_ = r.ws.WriteClose(code, "")
+		return newCloseError(code, text)
+	}
+	return nil
+}
+
+// fail closes the connection with code after a protocol violation or a message exceeding the
+// limit.
+func (r *frameReader) fail(code int, err error) error {
+	_ = r.ws.WriteClose(code, "")
+	return err
+}
+
+func unmask(b []byte, mask [4]byte) {
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// FrameDirection tells whether a frame was sent by the client or by the server
+type FrameDirection string
+
+const (
+	FrameInbound  FrameDirection = "inbound"
+	FrameOutbound FrameDirection = "outbound"
+)
+
+// Frame is a protocol message as it was read from or written to the websocket connection.
+type Frame struct {
+	ConnectionID string          `json:"connectionId"`
+	Subprotocol  string          `json:"subprotocol"`
+	Direction    FrameDirection  `json:"direction"`
+	Type         string          `json:"type"`
+	ID           string          `json:"id,omitempty"`
+	Size         int             `json:"size"`
+	Time         time.Time       `json:"time"`
+	Data         json.RawMessage `json:"data"`
+}
+
+// frameObserver is notified of every frame handled by a message exchanger. data is only valid
+// during the call, the exchangers reuse their buffers.
+type frameObserver func(direction FrameDirection, data []byte, typ string, id string)
+
+func (o frameObserver) frame(direction FrameDirection, data []byte, typ string, id string) {
+	if o != nil {
+		o(direction, data, typ, id)
+	}
+}
+
+// WebsocketFrameTapFunc receives every frame read from or written to a connection.
+type WebsocketFrameTapFunc func(ctx context.Context, f Frame)
+
+// newFrameObserver returns the observer forwarding the frames of a connection to the recorder and
+// the frame tap, or nil if the frames aren't needed.
+func (t *Websocket) newFrameObserver(ctx context.Context, r *http.Request, info *ConnectionInfo) frameObserver {
+	record := t.Recorder != nil && (t.RecordFunc == nil || t.RecordFunc(r))
+	if !record && t.FrameTap == nil {
+		return nil
+	}
+
+	return func(direction FrameDirection, data []byte, typ string, id string) {
+		f := Frame{
+			ConnectionID: info.ID,
+			Subprotocol:  info.Subprotocol,
+			Direction:    direction,
+			Type:         typ,
+			ID:           id,
+			Size:         len(data),
+			Time:         time.Now(),
+			Data:         append(json.RawMessage(nil), data...),
+		}
+
+		if record {
+			t.Recorder.Record(f)
+		}
+		if t.FrameTap != nil {
+			t.FrameTap(ctx, f)
+		}
+	}
+}
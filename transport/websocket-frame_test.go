@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFrameObserver(t *testing.T) {
+	r := httptest.NewRequest("GET", "/graphql", nil)
+	info := &ConnectionInfo{ID: "conn", Subprotocol: graphqltransportwsSubprotocol}
+
+	ws := &Websocket{}
+	assert.Nil(t, ws.newFrameObserver(context.Background(), r, info), "Expected no observer without recorder")
+
+	recorder := NewRingRecorder(4)
+	ws.Recorder = recorder
+	ws.RecordFunc = func(r *http.Request) bool { return false }
+	assert.Nil(t, ws.newFrameObserver(context.Background(), r, info), "Expected no observer for connections that aren't selected")
+
+	ws.RecordFunc = nil
+	observe := ws.newFrameObserver(context.Background(), r, info)
+	observe.frame(FrameOutbound, []byte(`{"type":"pong"}`), "pong", "")
+
+	frames := recorder.Frames()
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "conn", frames[0].ConnectionID)
+		assert.Equal(t, graphqltransportwsSubprotocol, frames[0].Subprotocol)
+		assert.Equal(t, 15, frames[0].Size)
+		assert.False(t, frames[0].Time.IsZero())
+	}
+}
+
+func TestFrameTap(t *testing.T) {
+	frames := make(chan Frame, 16)
+	server := newTestServer(t, Websocket{
+		FrameTap: func(ctx context.Context, f Frame) {
+			assert.NotNil(t, GetConnectionInfo(ctx))
+			frames <- f
+		},
+	}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+
+	var ack map[string]interface{}
+	assert.NoError(t, conn.ReadJSON(&ack))
+
+	inbound := <-frames
+	assert.Equal(t, FrameInbound, inbound.Direction)
+	assert.Equal(t, "connection_init", inbound.Type)
+
+	outbound := <-frames
+	assert.Equal(t, FrameOutbound, outbound.Direction)
+	assert.Equal(t, "connection_ack", outbound.Type)
+	assert.Equal(t, len(outbound.Data), outbound.Size)
+}
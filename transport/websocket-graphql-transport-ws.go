@@ -1,10 +1,9 @@
 package transport
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-
-	"github.com/gorilla/websocket"
 )
 
 // https://github.com/apollographql/subscriptions-transport-ws/blob/master/PROTOCOL.md
@@ -19,6 +18,7 @@ const (
 	graphqltransportwsCompleteMsg       = graphqltransportwsMessageType("complete")
 	graphqltransportwsPingMsg           = graphqltransportwsMessageType("ping")
 	graphqltransportwsPongMsg           = graphqltransportwsMessageType("pong")
+	graphqltransportwsSyncMsg           = graphqltransportwsMessageType("sync")
 )
 
 var allGraphqltransportwsMessageTypes = []graphqltransportwsMessageType{
@@ -30,11 +30,13 @@ var allGraphqltransportwsMessageTypes = []graphqltransportwsMessageType{
 	graphqltransportwsCompleteMsg,
 	graphqltransportwsPingMsg,
 	graphqltransportwsPongMsg,
+	graphqltransportwsSyncMsg,
 }
 
 type (
 	graphqltransportwsMessageExchanger struct {
-		c *websocket.Conn
+		c       socket
+		observe frameObserver
 	}
 
 	graphqltransportwsMessage struct {
@@ -48,13 +50,22 @@ type (
 )
 
 func (me graphqltransportwsMessageExchanger) NextMessage() (message, error) {
-	_, r, err := me.c.NextReader()
-	if err != nil {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := me.c.ReadMessage(buf); err != nil {
 		return message{}, handleNextReaderError(err)
 	}
 
+	return me.decode(buf.Bytes())
+}
+
+// decode decodes a message read from the connection.
+func (me graphqltransportwsMessageExchanger) decode(data []byte) (message, error) {
 	var graphqltransportwsMessage graphqltransportwsMessage
-	if err := jsonDecodeReader(r, &graphqltransportwsMessage); err != nil {
+	err := jsonDecode(data, &graphqltransportwsMessage)
+	me.observe.frame(FrameInbound, data, string(graphqltransportwsMessage.Type), graphqltransportwsMessage.ID)
+	if err != nil {
 		return message{}, errInvalidMsg
 	}
 
@@ -62,16 +73,35 @@ func (me graphqltransportwsMessageExchanger) NextMessage() (message, error) {
 }
 
 func (me graphqltransportwsMessageExchanger) Send(m *message) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	b, err := me.encode(buf, m)
+	if err != nil || b == nil {
+		return err
+	}
+
+	return me.c.WriteMessage(b)
+}
+
+// encode encodes m into buf, it returns nil for messages that aren't sent with this subprotocol.
+func (me graphqltransportwsMessageExchanger) encode(buf *bytes.Buffer, m *message) ([]byte, error) {
 	msg := &graphqltransportwsMessage{}
 	if err := msg.fromMessage(m); err != nil {
-		return err
+		return nil, err
 	}
 
 	if msg.noOp {
-		return nil
+		return nil, nil
+	}
+
+	b, err := encodeJSON(buf, msg)
+	if err != nil {
+		return nil, err
 	}
+	me.observe.frame(FrameOutbound, b, string(msg.Type), msg.ID)
 
-	return me.c.WriteJSON(msg)
+	return b, nil
 }
 
 func (t *graphqltransportwsMessageType) UnmarshalText(text []byte) (err error) {
@@ -100,7 +130,7 @@ func (m graphqltransportwsMessage) toMessage() (message, error) {
 	var err error
 	switch m.Type {
 	default:
-		err = fmt.Errorf("invalid client->server message type %s", m.Type)
+		err = fmt.Errorf("%w: unexpected client->server message type %s", errInvalidMsg, m.Type)
 	case graphqltransportwsConnectionInitMsg:
 		t = initMessageType
 	case graphqltransportwsSubscribeMsg:
@@ -111,6 +141,8 @@ func (m graphqltransportwsMessage) toMessage() (message, error) {
 		t = pingMessageType
 	case graphqltransportwsPongMsg:
 		t = pongMessageType
+	case graphqltransportwsSyncMsg:
+		t = syncMessageType
 	}
 
 	return message{
@@ -143,6 +175,8 @@ func (m *graphqltransportwsMessage) fromMessage(msg *message) (err error) {
 		m.Type = graphqltransportwsPingMsg
 	case pongMessageType:
 		m.Type = graphqltransportwsPongMsg
+	case syncMessageType:
+		m.Type = graphqltransportwsSyncMsg
 	}
 
 	return err
@@ -1,10 +1,9 @@
 package transport
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-
-	"github.com/gorilla/websocket"
 )
 
 // https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
@@ -21,6 +20,7 @@ const (
 	graphqlwsErrorMsg               = graphqlwsMessageType("error")
 	graphqlwsCompleteMsg            = graphqlwsMessageType("complete")
 	graphqlwsConnectionKeepAliveMsg = graphqlwsMessageType("ka")
+	graphqlwsSyncMsg                = graphqlwsMessageType("sync")
 )
 
 var allGraphqlwsMessageTypes = []graphqlwsMessageType{
@@ -34,11 +34,13 @@ var allGraphqlwsMessageTypes = []graphqlwsMessageType{
 	graphqlwsErrorMsg,
 	graphqlwsCompleteMsg,
 	graphqlwsConnectionKeepAliveMsg,
+	graphqlwsSyncMsg,
 }
 
 type (
 	graphqlwsMessageExchanger struct {
-		c *websocket.Conn
+		c       socket
+		observe frameObserver
 	}
 
 	graphqlwsMessage struct {
@@ -52,13 +54,22 @@ type (
 )
 
 func (me graphqlwsMessageExchanger) NextMessage() (message, error) {
-	_, r, err := me.c.NextReader()
-	if err != nil {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := me.c.ReadMessage(buf); err != nil {
 		return message{}, handleNextReaderError(err)
 	}
 
+	return me.decode(buf.Bytes())
+}
+
+// decode decodes a message read from the connection.
+func (me graphqlwsMessageExchanger) decode(data []byte) (message, error) {
 	var graphqlwsMessage graphqlwsMessage
-	if err := jsonDecodeReader(r, &graphqlwsMessage); err != nil {
+	err := jsonDecode(data, &graphqlwsMessage)
+	me.observe.frame(FrameInbound, data, string(graphqlwsMessage.Type), graphqlwsMessage.ID)
+	if err != nil {
 		return message{}, errInvalidMsg
 	}
 
@@ -66,16 +77,35 @@ func (me graphqlwsMessageExchanger) NextMessage() (message, error) {
 }
 
 func (me graphqlwsMessageExchanger) Send(m *message) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	b, err := me.encode(buf, m)
+	if err != nil || b == nil {
+		return err
+	}
+
+	return me.c.WriteMessage(b)
+}
+
+// encode encodes m into buf, it returns nil for messages that aren't sent with this subprotocol.
+func (me graphqlwsMessageExchanger) encode(buf *bytes.Buffer, m *message) ([]byte, error) {
 	msg := &graphqlwsMessage{}
 	if err := msg.fromMessage(m); err != nil {
-		return err
+		return nil, err
 	}
 
 	if msg.noOp {
-		return nil
+		return nil, nil
+	}
+
+	b, err := encodeJSON(buf, msg)
+	if err != nil {
+		return nil, err
 	}
+	me.observe.frame(FrameOutbound, b, string(msg.Type), msg.ID)
 
-	return me.c.WriteJSON(msg)
+	return b, nil
 }
 
 func (t *graphqlwsMessageType) UnmarshalText(text []byte) (err error) {
@@ -125,6 +155,8 @@ func (m graphqlwsMessage) toMessage() (message, error) {
 		t = completeMessageType
 	case graphqlwsConnectionKeepAliveMsg:
 		t = keepAliveMessageType
+	case graphqlwsSyncMsg:
+		t = syncMessageType
 	}
 
 	return message{
@@ -165,6 +197,8 @@ func (m *graphqlwsMessage) fromMessage(msg *message) (err error) {
 		m.noOp = true
 	case pongMessageType:
 		m.noOp = true
+	case syncMessageType:
+		m.Type = graphqlwsSyncMsg
 	}
 
 	return err
@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// HealthCheckFunc checks a backend the transport depends on, e.g. the pubsub.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthReport is the state of a node, as served by Health.
+type HealthReport struct {
+	Accepting bool `json:"accepting"`
+	// Connections is the number of initialised connections, it is only reported with a Registry.
+	Connections *int `json:"connections,omitempty"`
+	// Checks maps the names of the checks to their error, or to "ok".
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health integrates a Websocket transport with liveness and readiness probes, e.g. of Kubernetes.
+// It serves the readiness of the node as an http.Handler, and Liveness serves its liveness.
+type Health struct {
+	// Transport is drained through its Maintenance, which DrainOnSignal requires to be allocated
+	// before the transport serves requests, see SetAcceptingConnections.
+	Transport *Websocket
+	// Registry reports the number of connections, it is omitted when nil.
+	Registry *Registry
+	// Checks are the backends the transport depends on, by name. A failing check makes the node
+	// unhealthy and unready.
+	Checks map[string]HealthCheckFunc
+	// CheckTimeout bounds every check, it defaults to 2 seconds.
+	CheckTimeout time.Duration
+}
+
+// Healthy returns the first failing check, the node keeps being healthy while it is draining.
+func (h *Health) Healthy(ctx context.Context) error {
+	return h.report(ctx).err(false)
+}
+
+// Ready returns an error while the transport isn't accepting connections or a check fails.
+func (h *Health) Ready(ctx context.Context) error {
+	return h.report(ctx).err(true)
+}
+
+// ServeHTTP implements http.Handler, it serves the readiness of the node.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, true)
+}
+
+// Liveness returns an http.Handler serving the liveness of the node.
+func (h *Health) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, false)
+	})
+}
+
+// DrainOnSignal stops accepting connections once the process receives one of the signals, SIGTERM
+// by default, so that the readiness probe fails and the node is removed from the load balancers
+// while the open connections keep running. It returns when ctx is done or the node is draining.
+func (h *Health) DrainOnSignal(ctx context.Context, signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	defer signal.Stop(c)
+
+	select {
+	case <-c:
+		h.Transport.SetAcceptingConnections(false)
+	case <-ctx.Done():
+	}
+}
+
+func (h *Health) serve(w http.ResponseWriter, r *http.Request, readiness bool) {
+	report := h.report(r.Context())
+	code := http.StatusOK
+	if report.err(readiness) != nil {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+type healthResult struct {
+	name string
+	err  error
+}
+
+func (h *Health) report(ctx context.Context) healthReport {
+	report := healthReport{HealthReport: HealthReport{Accepting: h.Transport.AcceptingConnections()}}
+	if h.Registry != nil {
+		count := h.Registry.Count()
+		report.Connections = &count
+	}
+	if len(h.Checks) == 0 {
+		return report
+	}
+
+	timeout := h.CheckTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make(chan healthResult, len(h.Checks))
+	for name, check := range h.Checks {
+		go func(name string, check HealthCheckFunc) {
+			results <- healthResult{name: name, err: check(ctx)}
+		}(name, check)
+	}
+	report.Checks = make(map[string]string, len(h.Checks))
+	for len(report.Checks) < len(h.Checks) {
+		select {
+		case res := <-results:
+			report.Checks[res.name] = "ok"
+			if res.err != nil {
+				report.Checks[res.name] = res.err.Error()
+				report.failed = append(report.failed, res.name)
+			}
+		case <-ctx.Done():
+			// the checks ignoring the context time out
+			for name := range h.Checks {
+				if _, ok := report.Checks[name]; !ok {
+					report.Checks[name] = ctx.Err().Error()
+					report.failed = append(report.failed, name)
+				}
+			}
+		}
+	}
+	sort.Strings(report.failed)
+	return report
+}
+
+type healthReport struct {
+	HealthReport
+	failed []string
+}
+
+func (r healthReport) err(readiness bool) error {
+	if len(r.failed) != 0 {
+		name := r.failed[0]
+		return fmt.Errorf("%s: %s", name, r.Checks[name])
+	}
+	if readiness && !r.Accepting {
+		return errNotAccepting
+	}
+	return nil
+}
+
+var errNotAccepting = errors.New("not accepting connections")
@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthDrainOnSignal(t *testing.T) {
+	// SIGWINCH is ignored until the transport is notified of it
+	h := &Health{Transport: &Websocket{}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.DrainOnSignal(context.Background(), syscall.SIGWINCH)
+	}()
+
+	assert.Eventually(t, func() bool {
+		_ = syscall.Kill(syscall.Getpid(), syscall.SIGWINCH)
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, h.Transport.AcceptingConnections())
+}
@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serveHealth(t *testing.T, h http.Handler) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var report map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, report
+}
+
+func TestHealth(t *testing.T) {
+	var backendErr error
+	h := &Health{
+		Transport: &Websocket{},
+		Registry:  NewRegistry(),
+		Checks: map[string]HealthCheckFunc{
+			"pubsub": func(ctx context.Context) error { return backendErr },
+		},
+	}
+
+	code, report := serveHealth(t, h)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{
+		"accepting":   true,
+		"connections": float64(0),
+		"checks":      map[string]interface{}{"pubsub": "ok"},
+	}, report)
+	assert.NoError(t, h.Ready(context.Background()))
+	assert.NoError(t, h.Healthy(context.Background()))
+
+	h.Transport.SetAcceptingConnections(false)
+	code, report = serveHealth(t, h)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, false, report["accepting"])
+	assert.EqualError(t, h.Ready(context.Background()), "not accepting connections")
+	code, _ = serveHealth(t, h.Liveness())
+	assert.Equal(t, http.StatusOK, code, "draining nodes are alive")
+
+	backendErr = errors.New("connection refused")
+	code, report = serveHealth(t, h.Liveness())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, map[string]interface{}{"pubsub": "connection refused"}, report["checks"])
+	assert.EqualError(t, h.Healthy(context.Background()), "pubsub: connection refused")
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	h := &Health{
+		Transport:    &Websocket{},
+		CheckTimeout: 10 * time.Millisecond,
+		Checks: map[string]HealthCheckFunc{
+			"stuck": func(ctx context.Context) error {
+				<-block
+				return nil
+			},
+		},
+	}
+	assert.EqualError(t, h.Ready(context.Background()), "stuck: context deadline exceeded")
+}
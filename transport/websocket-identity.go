@@ -0,0 +1,26 @@
+package transport
+
+import "context"
+
+// A private key for context that only this package can access. This is important
+// to prevent collisions between different context uses
+var identityCtxKey = &wsIdentityContextKey{"identity"}
+
+type wsIdentityContextKey struct {
+	name string
+}
+
+// WithIdentity returns a copy of ctx identifying the client of its connection, e.g. the subject of
+// the token checked by the InitFunc. The identity scopes what the clients may share: the
+// resumption tokens and the multiplexed subscriptions. The auth package sets it with the ID of the
+// Principal.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityCtxKey, identity)
+}
+
+// GetIdentity returns the identity of the client of the connection the context belongs to, or an
+// empty string if it wasn't identified.
+func GetIdentity(ctx context.Context) string {
+	identity, _ := ctx.Value(identityCtxKey).(string)
+	return identity
+}
@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+var hasNextKey = []byte(`"hasNext"`)
+
+// incrementalFields are the fields of the partial results of operations using @defer or @stream
+// grouped under incremental, see https://github.com/graphql/graphql-wg/blob/main/rfcs/DeferStream.md
+var incrementalFields = []string{"data", "items", "errors", "path", "label"}
+
+// frameIncremental frames the partial results yielded by a service with a path and hasNext as
+// subsequent payloads of incremental delivery, grouping their fields under incremental. The other
+// fields, e.g. extensions, are kept at the top level. The other payloads, including the initial
+// payload of incremental delivery, are returned unchanged.
+func frameIncremental(payload []byte) ([]byte, error) {
+	if !bytes.Contains(payload, hasNextKey) {
+		return payload, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		// not an object, it can't be a partial result
+		return payload, nil
+	}
+	if _, ok := fields["path"]; !ok {
+		return payload, nil
+	}
+	if _, ok := fields["incremental"]; ok {
+		return payload, nil
+	}
+	var hasNext *bool
+	if err := json.Unmarshal(fields["hasNext"], &hasNext); err != nil || hasNext == nil {
+		return payload, nil
+	}
+
+	item := map[string]json.RawMessage{}
+	for _, field := range incrementalFields {
+		if value, ok := fields[field]; ok {
+			item[field] = value
+			delete(fields, field)
+		}
+	}
+	incremental, err := json.Marshal([]map[string]json.RawMessage{item})
+	if err != nil {
+		return nil, err
+	}
+	fields["incremental"] = incremental
+	return json.Marshal(fields)
+}
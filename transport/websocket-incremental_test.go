@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameIncremental(t *testing.T) {
+	for _, payload := range []string{
+		`{"data":{"value":1}}`,
+		`{"data":{"user":{"id":"1"}},"hasNext":true}`,
+		`{"incremental":[{"data":{"name":"a"},"path":["user"]}],"hasNext":false}`,
+		`{"hasNext":false}`,
+		`{"data":{"name":"a"},"path":["user"],"hasNext":null}`,
+		`"hasNext"`,
+	} {
+		framed, err := frameIncremental([]byte(payload))
+		assert.NoError(t, err)
+		assert.Equal(t, payload, string(framed))
+	}
+
+	framed, err := frameIncremental([]byte(`{"data":{"name":"a"},"path":["user"],"label":"profile","hasNext":true}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"incremental":[{"data":{"name":"a"},"path":["user"],"label":"profile"}],"hasNext":true}`, string(framed))
+
+	framed, err = frameIncremental([]byte(`{"items":[3],"path":["list",2],"errors":[{"message":"partial"}],"hasNext":false}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"incremental":[{"items":[3],"path":["list",2],"errors":[{"message":"partial"}]}],"hasNext":false}`, string(framed))
+
+	framed, err = frameIncremental([]byte(`{"data":{"name":"a"},"path":["user"],"hasNext":false,"extensions":{"cost":2},"x":1}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"incremental":[{"data":{"name":"a"},"path":["user"]}],"hasNext":false,"extensions":{"cost":2},"x":1}`, string(framed))
+}
+
+func TestSubscribeFramesIncrementalPayloads(t *testing.T) {
+	type partialResult struct {
+		Data    interface{}   `json:"data"`
+		Path    []interface{} `json:"path,omitempty"`
+		Label   string        `json:"label,omitempty"`
+		HasNext bool          `json:"hasNext"`
+	}
+
+	server := newTestServer(t, Websocket{}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 2)
+			payloads <- partialResult{Data: map[string]interface{}{"user": map[string]interface{}{"id": "1"}}, HasNext: true}
+			payloads <- partialResult{Data: map[string]interface{}{"name": "alice"}, Path: []interface{}{"user"}, Label: "profile"}
+			close(payloads)
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query": `query { user { id ... @defer(label: "profile") { name } } }`,
+	}}))
+
+	assert.Equal(t, map[string]interface{}{
+		"data":    map[string]interface{}{"user": map[string]interface{}{"id": "1"}},
+		"hasNext": true,
+	}, readResponse(t, conn))
+	assert.Equal(t, map[string]interface{}{
+		"incremental": []interface{}{map[string]interface{}{
+			"data":  map[string]interface{}{"name": "alice"},
+			"path":  []interface{}{"user"},
+			"label": "profile",
+		}},
+		"hasNext": false,
+	}, readResponse(t, conn))
+	readMessageOfType(t, conn, "complete")
+}
@@ -1,6 +1,9 @@
 package transport
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+)
 
 type key string
 
@@ -41,6 +44,17 @@ func (p InitPayload) Authorization() string {
 	return ""
 }
 
+// Decode decodes the payload into v, which should be a pointer to a struct or map with json tags
+// matching the connection params sent by the client.
+func (p InitPayload) Decode(v interface{}) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return jsonDecode(b, v)
+}
+
 func withInitPayload(ctx context.Context, payload InitPayload) context.Context {
 	return context.WithValue(ctx, initpayload, payload)
 }
@@ -55,3 +69,16 @@ func GetInitPayload(ctx context.Context) InitPayload {
 
 	return payload
 }
+
+// GetInitPayloadAs decodes the init payload stored in the context into a value of type T. It returns
+// the zero value of T if the context doesn't carry an init payload.
+func GetInitPayloadAs[T any](ctx context.Context) (T, error) {
+	var v T
+	payload := GetInitPayload(ctx)
+	if payload == nil {
+		return v, nil
+	}
+
+	err := payload.Decode(&v)
+	return v, err
+}
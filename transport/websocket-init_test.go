@@ -3,6 +3,7 @@ package transport
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -73,3 +74,87 @@ func TestAuthorization(t *testing.T) {
 	payloadNone := InitPayload{}
 	assert.Equal(t, "", payloadNone.Authorization(), "Expected empty string when no authorization is present")
 }
+
+func TestInitPayloadDecode(t *testing.T) {
+	payload := InitPayload{
+		"token":   "abc",
+		"version": 2,
+	}
+
+	var params struct {
+		Token   string `json:"token"`
+		Version int    `json:"version"`
+	}
+	err := payload.Decode(&params)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", params.Token)
+	assert.Equal(t, 2, params.Version)
+
+	var invalid struct {
+		Token int `json:"token"`
+	}
+	assert.Error(t, payload.Decode(&invalid), "Expected an error when types don't match")
+}
+
+func TestGetInitPayloadAs(t *testing.T) {
+	type connectionParams struct {
+		Authorization string `json:"Authorization"`
+	}
+
+	// Context without payload
+	params, err := GetInitPayloadAs[connectionParams](context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, connectionParams{}, params)
+
+	// Context with payload
+	ctx := withInitPayload(context.Background(), InitPayload{"Authorization": "Bearer token"})
+	params, err = GetInitPayloadAs[connectionParams](ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token", params.Authorization)
+}
+
+func TestInitPayloadInSubscribe(t *testing.T) {
+	type observed struct {
+		payload InitPayload
+		info    *ConnectionInfo
+	}
+	fromInit := make(chan InitPayload, 1)
+	fromSubscribeFunc := make(chan observed, 1)
+	fromService := make(chan observed, 1)
+	server := newTestServer(t, Websocket{
+		InitFunc: func(ctx context.Context, payload InitPayload) (context.Context, error) {
+			fromInit <- GetInitPayload(ctx)
+			return ctx, nil
+		},
+		SubscribeFunc: func(ctx context.Context, op *OperationInfo) (context.Context, error) {
+			fromSubscribeFunc <- observed{GetInitPayload(ctx), GetConnectionInfo(ctx)}
+			return ctx, nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			fromService <- observed{GetInitPayload(ctx), GetConnectionInfo(ctx)}
+			payloads := make(chan interface{})
+			context.AfterFunc(ctx, func() { close(payloads) })
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"Authorization": "Bearer token"}}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+
+	assert.Equal(t, "Bearer token", (<-fromInit).Authorization())
+	for _, ch := range []chan observed{fromSubscribeFunc, fromService} {
+		select {
+		case o := <-ch:
+			assert.Equal(t, "Bearer token", o.payload.Authorization())
+			if assert.NotNil(t, o.info) {
+				assert.Equal(t, graphqltransportwsSubprotocol, o.info.Subprotocol)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the operation wasn't started")
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OperationState is the state of an operation in its lifecycle: pending, then active once its
+// service subscribed, then completing or errored.
+type OperationState int
+
+const (
+	// OperationPending operations are being started: authorized and subscribed to their
+	// service.
+	OperationPending OperationState = iota
+	// OperationActive operations deliver the payloads of their service.
+	OperationActive
+	// OperationCompleting operations ended, by their service or by the client, and are being
+	// completed.
+	OperationCompleting
+	// OperationErrored operations failed to start, or ended with errors, and are being ended.
+	OperationErrored
+)
+
+var operationStateNames = [...]string{"pending", "active", "completing", "errored"}
+
+// String implements fmt.Stringer
+func (s OperationState) String() string {
+	if s < 0 || int(s) >= len(operationStateNames) {
+		return "unknown"
+	}
+	return operationStateNames[s]
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s OperationState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *OperationState) UnmarshalText(text []byte) error {
+	for state, name := range operationStateNames {
+		if name == string(text) {
+			*s = OperationState(state)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown operation state %q", text)
+}
+
+// OperationTransition is a change of the state of an operation.
+type OperationTransition struct {
+	State OperationState `json:"state"`
+	At    time.Time      `json:"at"`
+}
+
+// WebsocketOperationStateFunc is called with every transition of the operations of the
+// connections, e.g. to count the operations of every state or to log the stuck ones.
+type WebsocketOperationStateFunc func(ctx context.Context, op *OperationInfo, transition OperationTransition)
+
+// operationLifecycle records the transitions of an operation.
+type operationLifecycle struct {
+	mu          sync.Mutex
+	transitions []OperationTransition
+}
+
+// State returns the current state of the operation, pending when it wasn't started by the
+// transport.
+func (o *OperationInfo) State() OperationState {
+	if o.lifecycle == nil {
+		return OperationPending
+	}
+	o.lifecycle.mu.Lock()
+	defer o.lifecycle.mu.Unlock()
+	if len(o.lifecycle.transitions) == 0 {
+		return OperationPending
+	}
+	return o.lifecycle.transitions[len(o.lifecycle.transitions)-1].State
+}
+
+// Transitions returns the states the operation went through with the time it entered them,
+// oldest first.
+func (o *OperationInfo) Transitions() []OperationTransition {
+	if o.lifecycle == nil {
+		return nil
+	}
+	o.lifecycle.mu.Lock()
+	defer o.lifecycle.mu.Unlock()
+	return append([]OperationTransition(nil), o.lifecycle.transitions...)
+}
+
+// transition moves an operation to a state and reports it to the OperationStateFunc and the
+// operation listeners of the Registry.
+func (c *wsConnection) transition(ctx context.Context, op *OperationInfo, state OperationState) {
+	if op.lifecycle == nil {
+		return
+	}
+	transition := OperationTransition{State: state, At: time.Now()}
+	op.lifecycle.mu.Lock()
+	op.lifecycle.transitions = append(op.lifecycle.transitions, transition)
+	op.lifecycle.mu.Unlock()
+
+	if c.OperationStateFunc != nil {
+		c.OperationStateFunc(ctx, op, transition)
+	}
+	if c.registered != nil {
+		c.Registry.emitOperation(OperationEvent{Connection: c.registered, Operation: op, Transition: transition})
+	}
+}
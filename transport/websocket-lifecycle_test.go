@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestOperationLifecycle(t *testing.T) {
+	registry := NewRegistry()
+	events := make(chan OperationEvent, 16)
+	cancel := registry.ListenOperations(func(e OperationEvent) { events <- e })
+	defer cancel()
+
+	var mu sync.Mutex
+	states := map[string][]OperationState{}
+	payloads := make(chan interface{})
+	server := newTestServer(t, Websocket{
+		Registry: registry,
+		OperationStateFunc: func(ctx context.Context, op *OperationInfo, transition OperationTransition) {
+			mu.Lock()
+			defer mu.Unlock()
+			states[op.ID] = append(states[op.ID], transition.State)
+		},
+		SubscribeFunc: func(ctx context.Context, op *OperationInfo) (context.Context, error) {
+			if op.Name == "Forbidden" {
+				return ctx, errors.New("forbidden")
+			}
+			return ctx, nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			if operationName == "Failing" {
+				failing := make(chan interface{})
+				AddSubscriptionError(ctx, &gqlerror.Error{Message: "failed"})
+				close(failing)
+				return failing, nil
+			}
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+
+	pending, active := <-events, <-events
+	assert.Equal(t, OperationPending, pending.Transition.State)
+	assert.Equal(t, OperationActive, active.Transition.State)
+	assert.Same(t, pending.Operation, active.Operation)
+	assert.False(t, active.Transition.At.Before(pending.Transition.At))
+	if ops := active.Connection.Operations(); assert.Len(t, ops, 1) {
+		assert.Equal(t, OperationActive, ops[0].State())
+		assert.Equal(t, []OperationTransition{pending.Transition, active.Transition}, ops[0].Transitions())
+	}
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "complete", "id": "1"}))
+	completing := <-events
+	assert.Equal(t, OperationCompleting, completing.Transition.State)
+	assert.Equal(t, OperationCompleting, completing.Operation.State())
+
+	for _, name := range []string{"Forbidden", "Failing"} {
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": name, "payload": map[string]string{
+			"query": "subscription " + name + " { value }", "operationName": name,
+		}}))
+		readMessageOfType(t, conn, "error")
+	}
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(states["Failing"]) == 3
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string][]OperationState{
+		"1":         {OperationPending, OperationActive, OperationCompleting},
+		"Forbidden": {OperationPending, OperationErrored},
+		"Failing":   {OperationPending, OperationActive, OperationErrored},
+	}, states)
+}
+
+func TestOperationStateText(t *testing.T) {
+	text, err := OperationErrored.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "errored", string(text))
+	var state OperationState
+	assert.NoError(t, state.UnmarshalText(text))
+	assert.Equal(t, OperationErrored, state)
+	assert.Error(t, state.UnmarshalText([]byte("stuck")))
+	assert.Equal(t, "unknown", OperationState(42).String())
+	assert.Equal(t, OperationPending, (&OperationInfo{}).State())
+}
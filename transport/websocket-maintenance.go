@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultRetryAfter = 30 * time.Second
+
+// defaultMaintenanceReason is sent to the rejected clients when the Maintenance has no reason.
+const defaultMaintenanceReason = "not accepting connections"
+
+// SetAcceptingConnections enables the Maintenance of the transport to drain a node ahead of a
+// restart, or disables it. The Maintenance is allocated on the first call when nil, which must
+// happen before the transport serves requests, NewWebsocket allocates it. It is then safe to call
+// while the transport is serving requests.
+func (t *Websocket) SetAcceptingConnections(accepting bool) {
+	if t.Maintenance == nil {
+		t.Maintenance = &Maintenance{}
+	}
+	if accepting {
+		t.Maintenance.Disable()
+	} else {
+		t.Maintenance.Enable(defaultMaintenanceReason)
+	}
+}
+
+// AcceptingConnections returns false while the Maintenance of the transport is enabled.
+func (t Websocket) AcceptingConnections() bool {
+	_, enabled := t.Maintenance.Reason()
+	return !enabled
+}
+
+func (t Websocket) retryAfter() time.Duration {
+	if t.RetryAfter <= 0 {
+		return defaultRetryAfter
+	}
+	return t.RetryAfter
+}
+
+// Maintenance rejects the new connections of the Websocket transports it is assigned to while it
+// is enabled, their upgrade requests are answered with 503, a Retry-After header and the reason.
+// The open connections keep running. It is safe for concurrent use.
+type Maintenance struct {
+	mu      sync.RWMutex
+	enabled bool
+	reason  string
+}
+
+// Enable rejects the new connections with the given reason.
+func (m *Maintenance) Enable(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = true
+	m.reason = reason
+}
+
+// Disable accepts the new connections again.
+func (m *Maintenance) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = false
+	m.reason = ""
+}
+
+// Reason returns the reason of the rejected connections and whether maintenance is enabled. It is
+// never enabled on a nil Maintenance.
+func (m *Maintenance) Reason() (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.reason, m.enabled
+}
@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	maintenance := &Maintenance{}
+	server := newTestServer(t, Websocket{Maintenance: maintenance}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return make(chan interface{}), nil
+		},
+	})
+
+	open := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, open.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, open, "connection_ack")
+
+	maintenance.Enable("restarting")
+	reason, enabled := maintenance.Reason()
+	assert.True(t, enabled)
+	assert.Equal(t, "restarting", reason)
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqltransportwsSubprotocol}}
+	_, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+		assert.Contains(t, string(body), "restarting")
+	}
+
+	// the open connections keep running
+	assert.NoError(t, open.WriteJSON(map[string]interface{}{"type": "ping"}))
+	readMessageOfType(t, open, "pong")
+
+	maintenance.Disable()
+	accepted := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, accepted.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, accepted, "connection_ack")
+}
+
+func TestMaintenanceNil(t *testing.T) {
+	var maintenance *Maintenance
+	_, enabled := maintenance.Reason()
+	assert.False(t, enabled)
+}
+
+func TestSetAcceptingConnections(t *testing.T) {
+	ws, err := NewWebsocket(
+		WithCheckOrigin(func(r *http.Request) bool { return true }),
+		func(t *Websocket) { t.RetryAfter = 1500 * time.Millisecond },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a copy of the transport shares its Maintenance
+		ws := *ws
+		ws.Do(w, r, testGraphQLService{
+			subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+				return make(chan interface{}), nil
+			},
+		})
+	}))
+	defer server.Close()
+
+	open := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, open.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, open, "connection_ack")
+
+	ws.SetAcceptingConnections(false)
+	assert.False(t, ws.AcceptingConnections())
+	dialer := websocket.Dialer{Subprotocols: []string{graphqltransportwsSubprotocol}}
+	_, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	}
+
+	// the open connections keep running
+	assert.NoError(t, open.WriteJSON(map[string]interface{}{"type": "ping"}))
+	readMessageOfType(t, open, "pong")
+
+	ws.SetAcceptingConnections(true)
+	accepted := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, accepted.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, accepted, "connection_ack")
+}
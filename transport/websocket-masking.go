@@ -0,0 +1,248 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const defaultPermissionDirective = "permission"
+
+// ResponseMasking nulls the fields of the payloads the viewer of a connection isn't allowed to
+// read, so that a single upstream event is broadcast to viewers with different permissions. The
+// fields require the permission named by their directive in the Schema, e.g.
+// `salary: Int @permission(name: "hr")`. The items of incremental delivery and the patches of
+// live queries are masked too. It requires a Schema.
+type ResponseMasking struct {
+	// PermissionsFunc returns the permissions of the viewer of an operation, it is called once the
+	// SubscribeFunc returns.
+	PermissionsFunc func(ctx context.Context) []string
+	// Strip removes the fields from the payloads rather than nulling them.
+	Strip bool
+	// Directive is the name of the directive of the field definitions requiring a permission, in
+	// its "name" argument, it defaults to "permission".
+	Directive string
+}
+
+// responseMask is the fields of a selection set to mask, by response key, nil when there are
+// none.
+type responseMask struct {
+	masked bool
+	fields map[string]*responseMask
+}
+
+// mask returns the mask of an operation for the viewer of ctx.
+func (m *ResponseMasking) mask(ctx context.Context, op *ast.OperationDefinition) *responseMask {
+	allowed := map[string]bool{}
+	for _, permission := range m.PermissionsFunc(ctx) {
+		allowed[permission] = true
+	}
+	return m.maskSelectionSet(op.SelectionSet, allowed)
+}
+
+func (m *ResponseMasking) maskSelectionSet(set ast.SelectionSet, allowed map[string]bool) *responseMask {
+	var mask *responseMask
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if selection.Definition == nil {
+				continue
+			}
+			if permission := m.permission(selection.Definition); permission != "" && !allowed[permission] {
+				mask = mask.add(selection.Alias, &responseMask{masked: true})
+			} else if fields := m.maskSelectionSet(selection.SelectionSet, allowed); fields != nil {
+				mask = mask.add(selection.Alias, fields)
+			}
+		case *ast.InlineFragment:
+			mask = mask.merge(m.maskSelectionSet(selection.SelectionSet, allowed))
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				mask = mask.merge(m.maskSelectionSet(selection.Definition.SelectionSet, allowed))
+			}
+		}
+	}
+	return mask
+}
+
+// permission returns the permission required by a field, or an empty string.
+func (m *ResponseMasking) permission(field *ast.FieldDefinition) string {
+	name := m.Directive
+	if name == "" {
+		name = defaultPermissionDirective
+	}
+	directive := field.Directives.ForName(name)
+	if directive == nil {
+		return ""
+	}
+	argument := directive.Arguments.ForName("name")
+	if argument == nil || argument.Value == nil {
+		return ""
+	}
+	return argument.Value.Raw
+}
+
+// add masks the field of a response key, the fields selected several times, e.g. by fragments,
+// are masked as soon as one of their selections is.
+func (r *responseMask) add(key string, field *responseMask) *responseMask {
+	if r == nil {
+		r = &responseMask{fields: map[string]*responseMask{}}
+	}
+	existing, ok := r.fields[key]
+	switch {
+	case !ok:
+		r.fields[key] = field
+	case field.masked:
+		existing.masked = true
+	case !existing.masked:
+		for k, f := range field.fields {
+			existing.add(k, f)
+		}
+	}
+	return r
+}
+
+func (r *responseMask) merge(other *responseMask) *responseMask {
+	if other == nil {
+		return r
+	}
+	for key, field := range other.fields {
+		r = r.add(key, field)
+	}
+	return r
+}
+
+// apply masks the data of an encoded payload, including the items of incremental delivery,
+// rooted at their path, and the values of the patches of live queries. The items and the
+// patches under a masked field are dropped.
+func (r *responseMask) apply(payload json.RawMessage, strip bool) (json.RawMessage, error) {
+	var response map[string]interface{}
+	if err := jsonDecode(payload, &response); err != nil {
+		return nil, err
+	}
+	if data, ok := response["data"]; ok {
+		r.maskValue(data, strip)
+	}
+	if incremental, ok := response["incremental"].([]interface{}); ok {
+		response["incremental"] = r.maskIncremental(incremental, strip)
+	}
+	if patch, ok := response["patch"].([]interface{}); ok {
+		response["patch"] = r.maskPatch(patch, strip)
+	}
+	return json.Marshal(response)
+}
+
+// maskIncremental masks the data and the items of the incremental payloads at their path.
+func (r *responseMask) maskIncremental(incremental []interface{}, strip bool) []interface{} {
+	kept := incremental[:0]
+	for _, item := range incremental {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			kept = append(kept, item)
+			continue
+		}
+		path, _ := fields["path"].([]interface{})
+		keys := make([]string, 0, len(path))
+		for _, segment := range path {
+			// the indexes of the lists don't change the selection set
+			if key, ok := segment.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		mask, masked := r.at(keys)
+		if masked {
+			continue
+		}
+		if data, ok := fields["data"]; ok {
+			mask.maskValue(data, strip)
+		}
+		if items, ok := fields["items"]; ok {
+			mask.maskValue(items, strip)
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// maskPatch masks the values of the operations of a JSON patch, their paths are JSON pointers
+// into the data. The operations setting a masked field set it to null, unless strip is set.
+func (r *responseMask) maskPatch(patch []interface{}, strip bool) []interface{} {
+	kept := patch[:0]
+	for _, op := range patch {
+		fields, ok := op.(map[string]interface{})
+		if !ok {
+			kept = append(kept, op)
+			continue
+		}
+		pointer, _ := fields["path"].(string)
+		var keys []string
+		if pointer != "" {
+			for _, segment := range strings.Split(pointer[1:], "/") {
+				// the names of the fields can't start with a digit, these are indexes of lists
+				if segment != "" && (segment[0] < '0' || segment[0] > '9') && segment != "-" {
+					keys = append(keys, jsonPointerUnescaper.Replace(segment))
+				}
+			}
+		}
+		if len(keys) > 0 {
+			if _, masked := r.at(keys[:len(keys)-1]); masked {
+				continue
+			}
+		}
+		mask, masked := r.at(keys)
+		switch {
+		case !masked:
+			if value, ok := fields["value"]; ok {
+				mask.maskValue(value, strip)
+			}
+		case strip:
+			continue
+		case fields["op"] == "add" || fields["op"] == "replace":
+			fields["value"] = nil
+		}
+		kept = append(kept, op)
+	}
+	return kept
+}
+
+// at returns the mask of the selection set at the response keys of a path, masked is true when
+// the path is or is under a masked field.
+func (r *responseMask) at(keys []string) (mask *responseMask, masked bool) {
+	mask = r
+	for _, key := range keys {
+		if mask == nil {
+			return nil, false
+		}
+		mask = mask.fields[key]
+		if mask != nil && mask.masked {
+			return nil, true
+		}
+	}
+	return mask, false
+}
+
+func (r *responseMask) maskValue(v interface{}, strip bool) {
+	if r == nil {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, field := range r.fields {
+			value, ok := v[key]
+			switch {
+			case !ok:
+			case !field.masked:
+				field.maskValue(value, strip)
+			case strip:
+				delete(v, key)
+			default:
+				v[key] = nil
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			r.maskValue(item, strip)
+		}
+	}
+}
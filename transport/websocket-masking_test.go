@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var testMaskingSchema = gqlparser.MustLoadSchema(&ast.Source{Input: `
+	directive @permission(name: String!) on FIELD_DEFINITION
+	type Query { version: String }
+	type Subscription { employees: [Employee!]! }
+	type Employee {
+		name: String!
+		salary: Int @permission(name: "hr")
+		manager: Employee
+		reviews: [String!] @permission(name: "manager")
+	}
+`})
+
+func TestResponseMask(t *testing.T) {
+	doc, errs := gqlparser.LoadQuery(testMaskingSchema, `
+		subscription {
+			employees { name pay: salary ...Manager }
+		}
+		fragment Manager on Employee { manager { name salary } reviews }
+	`)
+	assert.Empty(t, errs)
+	m := &ResponseMasking{PermissionsFunc: func(ctx context.Context) []string { return []string{"manager"} }}
+	mask := m.mask(context.Background(), doc.Operations[0])
+
+	payload := `{"data":{"employees":[{"name":"a","pay":1,"manager":{"name":"b","salary":2},"reviews":["ok"]},{"name":"c","pay":3,"manager":null,"reviews":null}]}}`
+	b, err := mask.apply(json.RawMessage(payload), false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"employees":[{"name":"a","pay":null,"manager":{"name":"b","salary":null},"reviews":["ok"]},{"name":"c","pay":null,"manager":null,"reviews":null}]}}`, string(b))
+
+	b, err = mask.apply(json.RawMessage(payload), true)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"employees":[{"name":"a","manager":{"name":"b"},"reviews":["ok"]},{"name":"c","manager":null,"reviews":null}]}}`, string(b))
+
+	m.PermissionsFunc = func(ctx context.Context) []string { return []string{"hr", "manager"} }
+	assert.Nil(t, m.mask(context.Background(), doc.Operations[0]))
+}
+
+func TestResponseMaskIncremental(t *testing.T) {
+	doc, errs := gqlparser.LoadQuery(testMaskingSchema, `
+		subscription {
+			employees { name ... @defer { salary manager { name salary } } }
+		}
+	`)
+	assert.Empty(t, errs)
+	m := &ResponseMasking{PermissionsFunc: func(ctx context.Context) []string { return nil }}
+	mask := m.mask(context.Background(), doc.Operations[0])
+
+	payload := `{"incremental":[{"data":{"salary":100,"manager":{"name":"b","salary":2}},"path":["employees",0]},{"data":{"name":"c"},"path":["employees",1,"salary"]},{"items":[{"name":"d","salary":3}],"path":["employees",2]}],"hasNext":true}`
+	b, err := mask.apply(json.RawMessage(payload), false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"incremental":[{"data":{"salary":null,"manager":{"name":"b","salary":null}},"path":["employees",0]},{"items":[{"name":"d","salary":null}],"path":["employees",2]}],"hasNext":true}`, string(b))
+
+	framed, err := frameIncremental([]byte(`{"data":{"salary":100},"path":["employees",0],"hasNext":false}`))
+	assert.NoError(t, err)
+	b, err = mask.apply(framed, true)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"incremental":[{"data":{},"path":["employees",0]}],"hasNext":false}`, string(b))
+}
+
+func TestResponseMaskLiveQueryPatch(t *testing.T) {
+	doc, errs := gqlparser.LoadQuery(testMaskingSchema, `subscription { employees { name salary manager { salary } } }`)
+	assert.Empty(t, errs)
+	m := &ResponseMasking{PermissionsFunc: func(ctx context.Context) []string { return nil }}
+	mask := m.mask(context.Background(), doc.Operations[0])
+
+	payload := `{"patch":[{"op":"replace","path":"/employees/0/salary","value":100},{"op":"add","path":"/employees/1","value":{"name":"b","salary":2,"manager":{"salary":3}}},{"op":"replace","path":"/employees/0/name","value":"a"},{"op":"remove","path":"/employees/2/salary","value":null}],"revision":2}`
+	b, err := mask.apply(json.RawMessage(payload), false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"patch":[{"op":"replace","path":"/employees/0/salary","value":null},{"op":"add","path":"/employees/1","value":{"name":"b","salary":null,"manager":{"salary":null}}},{"op":"replace","path":"/employees/0/name","value":"a"},{"op":"remove","path":"/employees/2/salary","value":null}],"revision":2}`, string(b))
+
+	b, err = mask.apply(json.RawMessage(payload), true)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"patch":[{"op":"add","path":"/employees/1","value":{"name":"b","manager":{}}},{"op":"replace","path":"/employees/0/name","value":"a"}],"revision":2}`, string(b))
+}
+
+func TestSubscribeMasksResponses(t *testing.T) {
+	server := newTestServer(t, Websocket{
+		Schema: testMaskingSchema,
+		ResponseMasking: &ResponseMasking{
+			PermissionsFunc: func(ctx context.Context) []string {
+				if GetInitPayload(ctx).GetString("role") == "hr" {
+					return []string{"hr"}
+				}
+				return nil
+			},
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 1)
+			payloads <- NewSharedPayload(map[string]interface{}{"data": map[string]interface{}{"employees": []interface{}{
+				map[string]interface{}{"name": "a", "salary": 1},
+			}}})
+			return payloads, nil
+		},
+	})
+
+	for role, expected := range map[string]interface{}{"hr": float64(1), "": nil} {
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"role": role}}))
+		readMessageOfType(t, conn, "connection_ack")
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+			"query": "subscription { employees { name salary } }",
+		}}))
+		assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"employees": []interface{}{
+			map[string]interface{}{"name": "a", "salary": expected},
+		}}}, readResponse(t, conn), role)
+	}
+}
@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// The keys of the init payload read by a Negotiation. Their values are durations, as a number of
+// milliseconds or as a string like "30s".
+const (
+	// InitPayloadKeepAliveInterval is the interval of the keep-alive messages of graphql-ws, or of
+	// the pings of graphql-transport-ws, requested by the client.
+	InitPayloadKeepAliveInterval = "keepAliveInterval"
+	// InitPayloadConnectionLifetime is the maximum lifetime of the connection requested by the
+	// client.
+	InitPayloadConnectionLifetime = "connectionLifetime"
+	// InitPayloadOperationLifetime is the maximum lifetime of every operation requested by the
+	// client.
+	InitPayloadOperationLifetime = "operationLifetime"
+)
+
+// CloseReasonLifetimeExceeded closes the connections reaching their negotiated lifetime, the
+// clients are expected to reconnect.
+var CloseReasonLifetimeExceeded = CloseReason{Code: closeGoingAway, Reason: "connection lifetime exceeded"}
+
+// Negotiation lets the trusted clients tune the liveness of their connection through their init
+// payload, e.g. mobile clients pinging less often than dashboards, within the bounds of the
+// server. The values the clients can't request are ignored.
+type Negotiation struct {
+	// TrustFunc returns true if the client initialising a connection may negotiate, e.g. from the
+	// context returned by the InitFunc. Every client may when nil.
+	TrustFunc func(ctx context.Context, payload InitPayload) bool
+
+	// MinKeepAliveInterval is the shortest keep-alive interval the clients may request. The
+	// clients may only shorten the KeepAlivePingInterval or the PingPongInterval of the
+	// Websocket, unless it is disabled.
+	MinKeepAliveInterval time.Duration
+	// MaxConnectionLifetime bounds the lifetime requested by the clients, the connections live as
+	// long as the clients request when zero.
+	MaxConnectionLifetime time.Duration
+	// MaxOperationLifetime bounds the lifetime of the operations requested by the clients, they
+	// live as long as the clients request when zero.
+	MaxOperationLifetime time.Duration
+}
+
+// negotiate applies the liveness requested by the init payload to the connection.
+func (c *wsConnection) negotiate() {
+	n := c.Negotiation
+	if n.TrustFunc != nil && !n.TrustFunc(c.ctx, c.initPayload) {
+		return
+	}
+
+	if interval, ok := payloadDuration(c.initPayload, InitPayloadKeepAliveInterval); ok && interval >= n.MinKeepAliveInterval {
+		if c.KeepAlivePingInterval == 0 || interval < c.KeepAlivePingInterval {
+			c.KeepAlivePingInterval = interval
+		}
+		if c.PingPongInterval == 0 || interval < c.PingPongInterval {
+			c.PingPongInterval = interval
+		}
+	}
+	if lifetime, ok := payloadDuration(c.initPayload, InitPayloadOperationLifetime); ok {
+		c.operationLifetime = bounded(lifetime, n.MaxOperationLifetime)
+	}
+	if lifetime, ok := payloadDuration(c.initPayload, InitPayloadConnectionLifetime); ok {
+		ctx := WithCloseReason(c.ctx, CloseReasonLifetimeExceeded)
+		c.ctx, c.endLifetime = context.WithTimeout(ctx, bounded(lifetime, n.MaxConnectionLifetime))
+	}
+}
+
+// bounded returns d, or max when it is set and shorter.
+func bounded(d time.Duration, max time.Duration) time.Duration {
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+// payloadDuration returns the positive duration of the key of the payload.
+func payloadDuration(payload InitPayload, key string) (time.Duration, bool) {
+	var d time.Duration
+	switch value := payload[key].(type) {
+	case json.Number:
+		ms, err := value.Float64()
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(ms * float64(time.Millisecond))
+	case float64:
+		d = time.Duration(value * float64(time.Millisecond))
+	case string:
+		var err error
+		if d, err = time.ParseDuration(value); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return d, d > 0
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadDuration(t *testing.T) {
+	payload := InitPayload{
+		"number":   json.Number("1500"),
+		"float":    float64(250),
+		"string":   "2s",
+		"invalid":  "soon",
+		"negative": json.Number("-1"),
+	}
+	for key, expected := range map[string]time.Duration{
+		"number": 1500 * time.Millisecond,
+		"float":  250 * time.Millisecond,
+		"string": 2 * time.Second,
+	} {
+		d, ok := payloadDuration(payload, key)
+		assert.True(t, ok, key)
+		assert.Equal(t, expected, d, key)
+	}
+	for _, key := range []string{"invalid", "negative", "missing"} {
+		_, ok := payloadDuration(payload, key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name              string
+		websocket         Websocket
+		payload           InitPayload
+		keepAlive         time.Duration
+		operationLifetime time.Duration
+	}{
+		{
+			name:      "shorter keep-alive",
+			websocket: Websocket{KeepAlivePingInterval: 10 * time.Second, Negotiation: &Negotiation{MinKeepAliveInterval: time.Second}},
+			payload:   InitPayload{InitPayloadKeepAliveInterval: "5s"},
+			keepAlive: 5 * time.Second,
+		},
+		{
+			name:      "longer keep-alive",
+			websocket: Websocket{KeepAlivePingInterval: 10 * time.Second, Negotiation: &Negotiation{}},
+			payload:   InitPayload{InitPayloadKeepAliveInterval: "1m"},
+			keepAlive: 10 * time.Second,
+		},
+		{
+			name:      "keep-alive below the minimum",
+			websocket: Websocket{KeepAlivePingInterval: 10 * time.Second, Negotiation: &Negotiation{MinKeepAliveInterval: time.Second}},
+			payload:   InitPayload{InitPayloadKeepAliveInterval: json.Number("100")},
+			keepAlive: 10 * time.Second,
+		},
+		{
+			name:              "bounded operation lifetime",
+			websocket:         Websocket{Negotiation: &Negotiation{MaxOperationLifetime: time.Minute}},
+			payload:           InitPayload{InitPayloadOperationLifetime: "1h"},
+			operationLifetime: time.Minute,
+		},
+		{
+			name: "untrusted client",
+			websocket: Websocket{KeepAlivePingInterval: 10 * time.Second, Negotiation: &Negotiation{
+				TrustFunc: func(ctx context.Context, payload InitPayload) bool { return payload.Authorization() != "" },
+			}},
+			payload:   InitPayload{InitPayloadKeepAliveInterval: "5s", InitPayloadOperationLifetime: "1s"},
+			keepAlive: 10 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &wsConnection{Websocket: tt.websocket, ctx: context.Background(), initPayload: tt.payload}
+			c.negotiate()
+			assert.Equal(t, tt.keepAlive, c.KeepAlivePingInterval)
+			assert.Equal(t, tt.operationLifetime, c.operationLifetime)
+		})
+	}
+}
+
+func TestNegotiatedLifetimes(t *testing.T) {
+	server := newTestServer(t, Websocket{Negotiation: &Negotiation{MaxConnectionLifetime: 300 * time.Millisecond}}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{})
+			context.AfterFunc(ctx, func() { close(payloads) })
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{
+		InitPayloadOperationLifetime:  50,
+		InitPayloadConnectionLifetime: "1h",
+	}}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	start := time.Now()
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	readMessageOfType(t, conn, "complete")
+	assert.Less(t, time.Since(start), 250*time.Millisecond, "Expected the operation to end with its lifetime")
+
+	closeErr := readCloseError(t, conn)
+	assert.Equal(t, CloseReasonLifetimeExceeded.Code, closeErr.Code)
+	assert.Equal(t, CloseReasonLifetimeExceeded.Reason, closeErr.Text)
+}
@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+var operationInfoCtxKey = &wsOperationInfoContextKey{"operation-info"}
+
+type wsOperationInfoContextKey struct {
+	name string
+}
+
+// OperationInfo describes an operation started by a client, e.g. to label audit logs and metrics.
+type OperationInfo struct {
+	// ID is the id of the operation chosen by the client, unique on its connection.
+	ID string
+	// Name is the operation name sent by the client, or the name of the operation of the query
+	// when the client sent none.
+	Name  string
+	Query string
+	// QueryHash is the hex encoded SHA-256 of the query.
+	QueryHash string
+	// VariableNames are the sorted names of the variables sent by the client.
+	VariableNames []string
+	Extensions    OperationExtensions
+	// Priority is the priority of the operation when the Websocket has a WriteScheduling.
+	Priority Priority
+
+	lifecycle *operationLifecycle
+}
+
+func newOperationInfo(id string, params *startMessagePayload) *OperationInfo {
+	hash := sha256.Sum256([]byte(params.Query))
+	info := &OperationInfo{
+		ID:         id,
+		Name:       params.OperationName,
+		Query:      params.Query,
+		QueryHash:  hex.EncodeToString(hash[:]),
+		Extensions: params.Extensions.all,
+		lifecycle:  &operationLifecycle{},
+	}
+	variables := params.Variables
+	if params.operation != nil {
+		// the validated operation is reused, and its variables include the default values
+		variables = params.clientVariables
+		if info.Name == "" {
+			info.Name = params.operation.Name
+		}
+	} else if info.Name == "" {
+		info.Name = queryOperationName(params.Query)
+	}
+	for name := range variables {
+		info.VariableNames = append(info.VariableNames, name)
+	}
+	sort.Strings(info.VariableNames)
+	return info
+}
+
+// queryOperationName returns the name of the only operation of the query, or an empty string if
+// the query can't be parsed, has several operations or an anonymous one.
+func queryOperationName(query string) string {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil || len(doc.Operations) != 1 {
+		return ""
+	}
+	return doc.Operations[0].Name
+}
+
+func withOperationInfo(ctx context.Context, info *OperationInfo) context.Context {
+	return context.WithValue(ctx, operationInfoCtxKey, info)
+}
+
+// GetOperationInfo returns the information about the operation the context belongs to, or nil if
+// the context doesn't originate from an operation started over a websocket connection.
+func GetOperationInfo(ctx context.Context) *OperationInfo {
+	info, _ := ctx.Value(operationInfoCtxKey).(*OperationInfo)
+	return info
+}
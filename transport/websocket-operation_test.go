@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOperationInfo(t *testing.T) {
+	info := newOperationInfo("1", &startMessagePayload{
+		Query:     "subscription OnMessage($room: ID!, $after: Int) { message(room: $room, after: $after) }",
+		Variables: map[string]interface{}{"room": "lobby", "after": 3},
+	})
+
+	assert.Equal(t, "1", info.ID)
+	assert.Equal(t, "OnMessage", info.Name)
+	assert.Equal(t, []string{"after", "room"}, info.VariableNames)
+	assert.Len(t, info.QueryHash, 64)
+	assert.Equal(t, info.QueryHash, newOperationInfo("2", &startMessagePayload{Query: info.Query}).QueryHash)
+
+	named := newOperationInfo("3", &startMessagePayload{OperationName: "Second", Query: "subscription First { a } subscription Second { b }"})
+	assert.Equal(t, "Second", named.Name)
+
+	validated := &startMessagePayload{
+		Query:     "subscription Messages($room: ID!, $limit: Int = 10) { messages(room: $room, limit: $limit) }",
+		Variables: map[string]interface{}{"room": "lobby"},
+	}
+	assert.Empty(t, validateOperation(testValidationSchema, validated, false))
+	info = newOperationInfo("4", validated)
+	assert.Equal(t, "Messages", info.Name)
+	assert.Equal(t, []string{"room"}, info.VariableNames)
+}
+
+func TestQueryOperationName(t *testing.T) {
+	assert.Equal(t, "Feed", queryOperationName("subscription Feed { feed }"))
+	assert.Equal(t, "", queryOperationName("subscription { feed }"))
+	assert.Equal(t, "", queryOperationName("subscription A { a } subscription B { b }"))
+	assert.Equal(t, "", queryOperationName("subscription {"))
+}
+
+func TestGetOperationInfo(t *testing.T) {
+	assert.Nil(t, GetOperationInfo(context.Background()))
+
+	info := &OperationInfo{ID: "1"}
+	assert.Same(t, info, GetOperationInfo(withOperationInfo(context.Background(), info)))
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	subscribed := make(chan *OperationInfo, 1)
+	server := newTestServer(t, Websocket{
+		SubscribeFunc: func(ctx context.Context, op *OperationInfo) (context.Context, error) {
+			if op.Name == "Forbidden" {
+				return nil, errors.New("forbidden operation")
+			}
+			return ctx, nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			subscribed <- GetOperationInfo(ctx)
+			return make(chan interface{}), nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query": "subscription Forbidden { value }",
+	}}))
+	assert.Contains(t, string(readMessageOfType(t, conn, "error")["payload"]), "forbidden operation")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "payload": map[string]interface{}{
+		"query":     "subscription Feed($topic: String) { value(topic: $topic) }",
+		"variables": map[string]interface{}{"topic": "news"},
+	}}))
+	info := <-subscribed
+	assert.Equal(t, "2", info.ID)
+	assert.Equal(t, "Feed", info.Name)
+	assert.Equal(t, []string{"topic"}, info.VariableNames)
+}
@@ -0,0 +1,256 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Option configures a Websocket created by NewWebsocket.
+type Option func(t *Websocket)
+
+// NewWebsocket returns a Websocket configured by the options, or the error of the first invalid
+// setting, see Validate. It has a disabled Maintenance unless configured with one.
+func NewWebsocket(opts ...Option) (*Websocket, error) {
+	t := &Websocket{}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.Maintenance == nil {
+		t.Maintenance = &Maintenance{}
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WithUpgrader upgrades the connections with u.
+func WithUpgrader(u Upgrader) Option {
+	return func(t *Websocket) {
+		t.Upgrader = u
+	}
+}
+
+// WithCheckOrigin accepts the connections whose request is accepted by check.
+func WithCheckOrigin(check func(r *http.Request) bool) Option {
+	return func(t *Websocket) {
+		t.Upgrader.CheckOrigin = check
+	}
+}
+
+// WithCompression negotiates per message compression with the clients supporting it, when the
+// websocket library supports it, see CompressionSupported.
+func WithCompression(enabled bool) Option {
+	return func(t *Websocket) {
+		setCompression(&t.Upgrader, enabled)
+	}
+}
+
+// WithInitFunc calls f with the payload of the initialisation of every connection.
+func WithInitFunc(f WebsocketInitFunc) Option {
+	return func(t *Websocket) {
+		t.InitFunc = f
+	}
+}
+
+// WithInitTimeout closes the connections not initialised within the timeout.
+func WithInitTimeout(timeout time.Duration) Option {
+	return func(t *Websocket) {
+		t.InitTimeout = timeout
+	}
+}
+
+// WithReadLimit closes the connections sending a message larger than limit bytes with 1009.
+func WithReadLimit(limit int64) Option {
+	return func(t *Websocket) {
+		t.ReadLimit = limit
+	}
+}
+
+// WithSubscribeFunc calls f before every operation is started.
+func WithSubscribeFunc(f WebsocketSubscribeFunc) Option {
+	return func(t *Websocket) {
+		t.SubscribeFunc = f
+	}
+}
+
+// WithErrorFunc reports the errors of the connections to f.
+func WithErrorFunc(f WebsocketErrorFunc) Option {
+	return func(t *Websocket) {
+		t.ErrorFunc = f
+	}
+}
+
+// WithResponseFunc calls f with every payload before it is written.
+func WithResponseFunc(f WebsocketResponseFunc) Option {
+	return func(t *Websocket) {
+		t.ResponseFunc = f
+	}
+}
+
+// WithKeepAlive sends a keep-alive message to the graphql-ws clients at every interval.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(t *Websocket) {
+		t.KeepAlivePingInterval = interval
+	}
+}
+
+// WithClientKeepAliveTimeout drops the graphql-ws connections whose client stayed silent for
+// timeout, see ClientKeepAliveTimeout.
+func WithClientKeepAliveTimeout(timeout time.Duration) Option {
+	return func(t *Websocket) {
+		t.ClientKeepAliveTimeout = timeout
+	}
+}
+
+// WithPingPong pings the graphql-transport-ws clients at every interval, dropping the connections
+// not answering within multiplier intervals, see PongWaitMultiplier.
+func WithPingPong(interval time.Duration, multiplier int) Option {
+	return func(t *Websocket) {
+		t.PingPongInterval = interval
+		t.PongWaitMultiplier = multiplier
+	}
+}
+
+// WithLogger writes the failures that can't be reported to the ErrorFunc to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(t *Websocket) {
+		t.Logger = logger
+	}
+}
+
+// WithRegistry tracks the initialised connections in r.
+func WithRegistry(r *Registry) Option {
+	return func(t *Websocket) {
+		t.Registry = r
+	}
+}
+
+// WithSchema validates the operations against the schema, rejecting the queries and mutations
+// when subscriptionsOnly is set.
+func WithSchema(schema *ast.Schema, subscriptionsOnly bool) Option {
+	return func(t *Websocket) {
+		t.Schema = schema
+		t.SubscriptionsOnly = subscriptionsOnly
+	}
+}
+
+// WithErrorPresenter turns the errors of the operations into the errors sent to the clients with
+// presenter.
+func WithErrorPresenter(presenter ErrorPresenterFunc) Option {
+	return func(t *Websocket) {
+		t.ErrorPresenter = presenter
+	}
+}
+
+// WithPanicHandler calls handler with the panics recovered from the operations.
+func WithPanicHandler(handler WebsocketPanicFunc) Option {
+	return func(t *Websocket) {
+		t.PanicHandler = handler
+	}
+}
+
+// WithStrictProtocol follows graphql-transport-ws to the letter, see StrictProtocol.
+func WithStrictProtocol() Option {
+	return func(t *Websocket) {
+		t.StrictProtocol = true
+	}
+}
+
+// WithWebsocketFallback serves the requests that aren't websocket upgrades with fallback.
+func WithWebsocketFallback(fallback http.Handler) Option {
+	return func(t *Websocket) {
+		t.Fallback = fallback
+	}
+}
+
+// Validate returns an error if the configuration is inconsistent, e.g. a negative duration or a
+// setting depending on another one left unset.
+func (t *Websocket) Validate() error {
+	var errs []error
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"InitTimeout", t.InitTimeout},
+		{"KeepAlivePingInterval", t.KeepAlivePingInterval},
+		{"PingPongInterval", t.PingPongInterval},
+		{"ClientKeepAliveTimeout", t.ClientKeepAliveTimeout},
+		{"RetryAfter", t.RetryAfter},
+		{"ReconnectJitter", t.ReconnectJitter},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s is negative", d.name))
+		}
+	}
+	if t.ReadLimit < 0 {
+		errs = append(errs, errors.New("ReadLimit is negative"))
+	}
+	if t.PongWaitMultiplier < 0 {
+		errs = append(errs, errors.New("PongWaitMultiplier is negative"))
+	}
+	if t.MaxMissedPongs < 0 {
+		errs = append(errs, errors.New("MaxMissedPongs is negative"))
+	}
+	if t.MaxPumpsPerConnection < 0 {
+		errs = append(errs, errors.New("MaxPumpsPerConnection is negative"))
+	}
+	if t.WorkerPool != nil && (t.WorkerPool.Size < 0 || t.WorkerPool.MaxSubscribes < 0) {
+		errs = append(errs, errors.New("WorkerPool has a negative Size or MaxSubscribes"))
+	}
+	if t.Admission != nil {
+		if t.Admission.MaxConcurrent <= 0 {
+			errs = append(errs, errors.New("Admission requires a positive MaxConcurrent"))
+		}
+		if t.Admission.MaxQueue < 0 || t.Admission.MaxWait < 0 {
+			errs = append(errs, errors.New("Admission has a negative MaxQueue or MaxWait"))
+		}
+	}
+	if t.SubscriptionsOnly && t.Schema == nil {
+		errs = append(errs, errors.New("SubscriptionsOnly requires a Schema"))
+	}
+	if t.RecordFunc != nil && t.Recorder == nil {
+		errs = append(errs, errors.New("RecordFunc requires a Recorder"))
+	}
+	if t.Tenancy != nil && t.Tenancy.Resolver == nil {
+		errs = append(errs, errors.New("Tenancy requires a Resolver"))
+	}
+	if t.Quota != nil && t.Quota.PerTenant && t.Tenancy == nil {
+		errs = append(errs, errors.New("Quota.PerTenant requires a Tenancy"))
+	}
+	if t.Audit != nil && t.Audit.Sink == nil {
+		errs = append(errs, errors.New("Audit requires a Sink"))
+	}
+	if t.DocumentSync != nil && t.DocumentSync.Handler == nil {
+		errs = append(errs, errors.New("DocumentSync requires a Handler"))
+	}
+	if t.ResponseMasking != nil && (t.Schema == nil || t.ResponseMasking.PermissionsFunc == nil) {
+		errs = append(errs, errors.New("ResponseMasking requires a Schema and a PermissionsFunc"))
+	}
+	if t.PayloadEncryption != nil && t.PayloadEncryption.CipherFunc == nil {
+		errs = append(errs, errors.New("PayloadEncryption requires a CipherFunc"))
+	}
+	if t.PayloadSigning != nil && t.PayloadSigning.Keys == nil {
+		errs = append(errs, errors.New("PayloadSigning requires Keys"))
+	}
+	if t.DeadLetters != nil && t.DeadLetters.Sink == nil {
+		errs = append(errs, errors.New("DeadLetters requires a Sink"))
+	}
+	if t.WriteScheduling != nil && t.WriteScheduling.QueueSize < 0 {
+		errs = append(errs, errors.New("WriteScheduling.QueueSize is negative"))
+	}
+	if t.SlowConsumer != nil {
+		if t.SlowConsumer.MaxWriteLatency < 0 || t.SlowConsumer.MaxQueueDepth < 0 || t.SlowConsumer.Sustain < 0 || t.SlowConsumer.SampleInterval < 0 {
+			errs = append(errs, errors.New("SlowConsumer has a negative threshold"))
+		}
+		if t.SlowConsumer.MaxQueueDepth > 0 && t.WriteScheduling == nil {
+			errs = append(errs, errors.New("SlowConsumer.MaxQueueDepth requires a WriteScheduling"))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWebsocket(t *testing.T) {
+	registry := NewRegistry()
+	initFunc := func(ctx context.Context, payload InitPayload) (context.Context, error) { return ctx, nil }
+	ws, err := NewWebsocket(
+		WithInitFunc(initFunc),
+		WithInitTimeout(5*time.Second),
+		WithKeepAlive(10*time.Second),
+		WithPingPong(time.Second, 3),
+		WithRegistry(registry),
+		WithStrictProtocol(),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotNil(t, ws.InitFunc)
+	assert.Equal(t, 5*time.Second, ws.InitTimeout)
+	assert.Equal(t, 10*time.Second, ws.KeepAlivePingInterval)
+	assert.Equal(t, time.Second, ws.PingPongInterval)
+	assert.Equal(t, 3, ws.PongWaitMultiplier)
+	assert.Same(t, registry, ws.Registry)
+	assert.True(t, ws.StrictProtocol)
+}
+
+func TestWebsocketValidate(t *testing.T) {
+	_, err := NewWebsocket(WithInitTimeout(-time.Second), WithSchema(nil, true))
+	if assert.Error(t, err) {
+		assert.Equal(t, "InitTimeout is negative\nSubscriptionsOnly requires a Schema", err.Error())
+	}
+
+	assert.Error(t, (&Websocket{Tenancy: &Tenancy{}}).Validate())
+	assert.Error(t, (&Websocket{Quota: &Quota{PerTenant: true}}).Validate())
+	assert.Error(t, (&Websocket{Audit: &AuditLog{}}).Validate())
+	assert.Error(t, (&Websocket{PayloadEncryption: &PayloadEncryption{}}).Validate())
+	assert.Error(t, (&Websocket{PayloadSigning: &PayloadSigning{}}).Validate())
+	assert.Error(t, (&Websocket{ResponseMasking: &ResponseMasking{}}).Validate())
+	assert.Error(t, (&Websocket{MaxPumpsPerConnection: -1}).Validate())
+	assert.Error(t, (&Websocket{WorkerPool: &WorkerPool{Size: -1}}).Validate())
+	assert.Error(t, (&Websocket{WorkerPool: &WorkerPool{MaxSubscribes: -1}}).Validate())
+	assert.Error(t, (&Websocket{Admission: &Admission{}}).Validate())
+	assert.NoError(t, (&Websocket{}).Validate())
+}
+
+func TestWithLogger(t *testing.T) {
+	var logs bytes.Buffer
+	ws, err := NewWebsocket(WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+	ws.Do(httptest.NewRecorder(), r, nil)
+	assert.Contains(t, logs.String(), "unable to upgrade to websocket")
+}
@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// OrderedDelivery numbers the payloads of an operation from 1, in the order they are received,
+// including the payloads sent with Connection.SendRaw while its GraphQLService sends others.
+//
+// The numbers are taken when the payloads are received, the payloads dropped before being
+// written, e.g. by a Quota with the QuotaDrop action, leave a gap the clients can detect.
+type OrderedDelivery struct {
+	// SequenceExtension sends the number of every payload in extensions.sequence.
+	SequenceExtension bool
+}
+
+// orderedStream serialises the payloads of an operation.
+type orderedStream struct {
+	mu  sync.Mutex
+	seq int64
+}
+
+// next locks the stream for a payload and returns its number, the stream is unlocked by done.
+func (s *orderedStream) next() (seq int64, done func()) {
+	s.mu.Lock()
+	s.seq++
+	return s.seq, s.mu.Unlock
+}
+
+// withSequence sets the number of a payload in its extensions when they are enabled.
+func (c *wsConnection) withSequence(payload json.RawMessage, seq int64) json.RawMessage {
+	if c.OrderedDelivery == nil || !c.OrderedDelivery.SequenceExtension {
+		return payload
+	}
+	return withExtension(payload, "sequence", seq)
+}
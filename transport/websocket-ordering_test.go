@@ -0,0 +1,54 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedDelivery(t *testing.T) {
+	registry := NewRegistry()
+	events := make(chan RegistryEvent, 1)
+	cancel := registry.Listen(func(e RegistryEvent) { events <- e })
+	defer cancel()
+
+	payloads := make(chan interface{})
+	server := newTestServer(t, Websocket{
+		Registry:        registry,
+		OrderedDelivery: &OrderedDelivery{SequenceExtension: true},
+		Quota:           &Quota{MaxMessages: 3, Interval: 300 * time.Millisecond, Action: QuotaDrop},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return payloads, nil
+		},
+	})
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	registered := <-events
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+	assert.Eventually(t, func() bool {
+		return registered.Connection.SendRaw("1", json.RawMessage(`{"data":{"value":2}}`)) == nil
+	}, time.Second, 5*time.Millisecond)
+	payloads <- NewSharedPayload(map[string]interface{}{"data": map[string]interface{}{"value": 3}})
+	// the quota, which counts the payloads sent with SendRaw too, drops the fourth payload: the gap
+	// is visible in the sequence
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 4}}
+	time.Sleep(350 * time.Millisecond)
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 5}}
+
+	for _, want := range []string{
+		`{"data":{"value":1},"extensions":{"sequence":1}}`,
+		`{"data":{"value":2},"extensions":{"sequence":2}}`,
+		`{"data":{"value":3},"extensions":{"sequence":3}}`,
+		`{"data":{"value":5},"extensions":{"sequence":5,"quota":{"dropped":1}}}`,
+	} {
+		next := readMessageOfType(t, conn, "next")
+		assert.JSONEq(t, want, string(next["payload"]))
+	}
+}
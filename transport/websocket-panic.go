@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// WebsocketPanicFunc is called with the value recovered from a panic of an operation, the panic
+// is sent to the client as an internal server error and the connection keeps running.
+type WebsocketPanicFunc func(ctx context.Context, recovered interface{})
+
+// PanicError is the error of an operation recovered from a panic of the GraphQLService, of the
+// SubscribeFunc or while sending its payloads.
+type PanicError struct {
+	Recovered interface{}
+	// Stack is the stack of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Recovered)
+}
+
+// recovered reports a recovered panic to the PanicHandler and returns it as an error.
+func (c *wsConnection) recovered(ctx context.Context, r interface{}) error {
+	err := &PanicError{Recovered: r, Stack: debug.Stack()}
+	if c.PanicHandler != nil {
+		c.PanicHandler(ctx, r)
+	}
+	return err
+}
+
+// startService calls the SubscribeFunc and the GraphQLService, their panics are returned as
+// PanicErrors with the context of the operation.
+func (c *wsConnection) startService(ctx context.Context, params *startMessagePayload) (opCtx context.Context, _ <-chan interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			opCtx, err = ctx, c.recovered(ctx, r)
+		}
+	}()
+
+	if c.AuthorizeOperation != nil {
+		if err = c.authorizeOperation(ctx, params); err != nil {
+			return ctx, nil, err
+		}
+	}
+	if c.SubscribeFunc != nil {
+		if ctx, err = c.SubscribeFunc(ctx, GetOperationInfo(ctx)); err != nil {
+			return ctx, nil, err
+		}
+	}
+	ctx = withSubscriptionErrorContext(ctx)
+	var payloads <-chan interface{}
+	subscribe := func() {
+		payloads, err = c.service.Subscribe(ctx, params.Query, params.OperationName, params.Variables)
+	}
+	if c.WorkerPool != nil {
+		if waitErr := c.WorkerPool.subscribe(ctx, subscribe); waitErr != nil {
+			return ctx, nil, waitErr
+		}
+	} else {
+		subscribe()
+	}
+	return ctx, payloads, err
+}
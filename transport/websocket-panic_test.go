@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	var mu sync.Mutex
+	var recovered []interface{}
+	server := newTestServer(t, Websocket{
+		PanicHandler: func(ctx context.Context, r interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			recovered = append(recovered, r)
+		},
+		ResponseFunc: func(ctx context.Context, id string, payload json.RawMessage) (json.RawMessage, error) {
+			panic("response func")
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			if operationName == "Panic" {
+				panic("subscribe")
+			}
+			payloads := make(chan interface{}, 1)
+			payloads <- map[string]interface{}{"data": 1}
+			context.AfterFunc(ctx, func() { close(payloads) })
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	internal := []map[string]interface{}{{"message": "internal server error", "extensions": map[string]interface{}{"code": CodeInternalServerError}}}
+	var errs []map[string]interface{}
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription Panic { value }", "operationName": "Panic"}}))
+	msg := readMessageOfType(t, conn, "error")
+	assert.Equal(t, `"1"`, string(msg["id"]))
+	assert.NoError(t, json.Unmarshal(msg["payload"], &errs))
+	assert.Equal(t, internal, errs)
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	msg = readMessageOfType(t, conn, "error")
+	assert.Equal(t, `"2"`, string(msg["id"]))
+	assert.NoError(t, json.Unmarshal(msg["payload"], &errs))
+	assert.Equal(t, internal, errs)
+
+	// the connection is still alive
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping"}))
+	readMessageOfType(t, conn, "pong")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []interface{}{"subscribe", "response func"}, recovered)
+}
+
+func TestPanicOperationState(t *testing.T) {
+	states := make(chan OperationState, 4)
+	server := newTestServer(t, Websocket{
+		OperationStateFunc: func(ctx context.Context, op *OperationInfo, transition OperationTransition) {
+			assert.NotNil(t, ctx)
+			states <- transition.State
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			panic("subscribe")
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	readMessageOfType(t, conn, "error")
+	assert.Equal(t, OperationPending, <-states)
+	assert.Equal(t, OperationErrored, <-states)
+}
+
+func TestPanicErrorPresented(t *testing.T) {
+	var reported error
+	presenter := RedactingErrorPresenter(func(ctx context.Context, err error) { reported = err })
+	gqlErr := presenter(context.Background(), toGQLError(&PanicError{Recovered: "boom"}))
+	assert.Equal(t, "internal server error", gqlErr.Message)
+	var panicErr *PanicError
+	if assert.ErrorAs(t, reported, &panicErr) {
+		assert.Equal(t, "boom", panicErr.Recovered)
+	}
+}
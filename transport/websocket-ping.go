@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+const defaultPongWaitMultiplier = 2
+
+// pingSeqPayload is attached to graphql-transport-ws pings when round trip measurement is enabled.
+// The sequence number only matches the pong echoing it to the ping it answers, the round trip is
+// measured from the time the server sent that ping, the clock of the client is never trusted.
+type pingSeqPayload struct {
+	Seq uint64 `json:"seq"`
+}
+
+func newPingPayload(seq uint64) json.RawMessage {
+	return json.RawMessage(`{"seq":` + strconv.FormatUint(seq, 10) + `}`)
+}
+
+// pongRoundTrip computes the round trip of the last ping, sent at lastPing with the sequence number
+// seq, from the pong answering it. It returns false if the round trip can't be determined, e.g. the
+// pong echoes the payload of an older ping.
+func pongRoundTrip(payload json.RawMessage, seq uint64, lastPing time.Time, now time.Time) (time.Duration, bool) {
+	var p pingSeqPayload
+	if len(payload) > 0 && jsonDecode(payload, &p) == nil && p.Seq != 0 && p.Seq != seq {
+		return 0, false
+	}
+
+	if lastPing.IsZero() || lastPing.After(now) {
+		return 0, false
+	}
+
+	return now.Sub(lastPing), true
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c *wsConnection) pongWait() time.Duration {
+	multiplier := c.PongWaitMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultPongWaitMultiplier
+	}
+
+	return time.Duration(multiplier) * c.PingPongInterval
+}
+
+// livenessWait returns how long the client may stay silent before its connection is dropped, zero
+// when its liveness isn't checked.
+func (c *wsConnection) livenessWait() time.Duration {
+	if c.conn.Subprotocol() == graphqltransportwsSubprotocol {
+		if c.PingPongInterval == 0 {
+			return 0
+		}
+		return c.pongWait()
+	}
+	return c.ClientKeepAliveTimeout
+}
+
+func (c *wsConnection) sendPing() {
+	c.mu.Lock()
+	missed := c.missedPongs
+	c.mu.Unlock()
+
+	if c.MaxMissedPongs > 0 && missed >= c.MaxMissedPongs {
+		c.livenessFailure()
+		return
+	}
+
+	c.mu.Lock()
+	c.missedPongs++
+	c.pingSeq++
+	seq := c.pingSeq
+	c.lastPing = time.Now()
+	c.mu.Unlock()
+
+	payload := json.RawMessage{}
+	if c.RoundTripFunc != nil {
+		payload = newPingPayload(seq)
+	}
+
+	c.write(&message{t: pingMessageType, payload: payload})
+}
+
+// touchLiveness is called for every message of the client, it pushes the read deadline back.
+func (c *wsConnection) touchLiveness() {
+	if wait := c.livenessWait(); wait != 0 {
+		if c.loop != nil {
+			c.loop.resetLiveness()
+		} else {
+			_ = c.conn.SetReadDeadline(time.Now().UTC().Add(wait))
+		}
+	}
+}
+
+// resetLiveness is called whenever the client answers a ping, it pushes the read deadline back
+// and forgives previously missed pongs.
+func (c *wsConnection) resetLiveness() {
+	c.touchLiveness()
+
+	c.mu.Lock()
+	c.missedPongs = 0
+	c.mu.Unlock()
+}
+
+func (c *wsConnection) handlePong(m *message) {
+	c.resetLiveness()
+
+	c.mu.Lock()
+	seq := c.pingSeq
+	lastPing := c.lastPing
+	c.mu.Unlock()
+
+	if c.RoundTripFunc == nil {
+		return
+	}
+
+	if rtt, ok := pongRoundTrip(m.payload, seq, lastPing, time.Now()); ok {
+		c.RoundTripFunc(c.ctx, rtt)
+	}
+}
+
+// livenessFailure drops a connection whose client stopped answering pings. It only has an effect
+// the first time it is called.
+func (c *wsConnection) livenessFailure() {
+	c.mu.Lock()
+	failed := c.livenessFailed
+	c.livenessFailed = true
+	missed := c.missedPongs
+	c.mu.Unlock()
+
+	if failed {
+		return
+	}
+
+	if c.LivenessFailureFunc != nil {
+		c.LivenessFailureFunc(c.ctx, missed)
+	}
+	if c.conn.Subprotocol() != graphqltransportwsSubprotocol {
+		c.closeWithReason(CloseReasonKeepAliveTimeout)
+		return
+	}
+	c.closeWithReason(CloseReasonPongTimeout)
+}
+
+// handleClientKeepAlive accepts the keep alive messages sent by legacy graphql-ws clients. They
+// aren't answered: the server sends its own every KeepAlivePingInterval, and two peers answering
+// the keep alives would answer each other forever. Like any message, they push back the
+// ClientKeepAliveTimeout.
+func (c *wsConnection) handleClientKeepAlive() {
+	c.resetLiveness()
+}
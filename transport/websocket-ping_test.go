@@ -0,0 +1,301 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPongRoundTripFromLastPing(t *testing.T) {
+	lastPing := time.Now()
+	now := lastPing.Add(50 * time.Millisecond)
+
+	rtt, ok := pongRoundTrip(newPingPayload(3), 3, lastPing, now)
+	assert.True(t, ok)
+	assert.Equal(t, 50*time.Millisecond, rtt)
+
+	// Pongs that don't echo the payload are matched to the last ping
+	rtt, ok = pongRoundTrip(json.RawMessage{}, 3, lastPing, now)
+	assert.True(t, ok)
+	assert.Equal(t, 50*time.Millisecond, rtt)
+	rtt, ok = pongRoundTrip(json.RawMessage(`{"foo":"bar"}`), 3, lastPing, now)
+	assert.True(t, ok)
+	assert.Equal(t, 50*time.Millisecond, rtt)
+}
+
+func TestPongRoundTripIgnoresTheClientClock(t *testing.T) {
+	lastPing := time.Now()
+	now := lastPing.Add(50 * time.Millisecond)
+
+	rtt, ok := pongRoundTrip(json.RawMessage(`{"seq":3,"timestamp":1}`), 3, lastPing, now)
+	assert.True(t, ok)
+	assert.Equal(t, 50*time.Millisecond, rtt, "Expected a timestamp in the pong not to be trusted")
+}
+
+func TestPongRoundTripUnknown(t *testing.T) {
+	_, ok := pongRoundTrip(nil, 0, time.Time{}, time.Now())
+	assert.False(t, ok)
+
+	_, ok = pongRoundTrip(newPingPayload(2), 3, time.Now(), time.Now())
+	assert.False(t, ok, "Expected the pong of an older ping to be ignored")
+}
+
+func TestWebsocketRoundTripFunc(t *testing.T) {
+	rtts := make(chan time.Duration, 1)
+	server := newTestServer(t, Websocket{
+		PingPongInterval: 20 * time.Millisecond,
+		RoundTripFunc: func(ctx context.Context, rtt time.Duration) {
+			select {
+			case rtts <- rtt:
+			default:
+			}
+		},
+	}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+
+	for {
+		var msg graphqltransportwsMessage
+		if !assert.NoError(t, conn.ReadJSON(&msg)) {
+			return
+		}
+		if msg.Type == graphqltransportwsPingMsg {
+			assert.NotEmpty(t, msg.Payload, "Expected the ping to carry a sequence number")
+			assert.NoError(t, conn.WriteJSON(graphqltransportwsMessage{Type: graphqltransportwsPongMsg, Payload: msg.Payload}))
+			break
+		}
+	}
+
+	select {
+	case rtt := <-rtts:
+		assert.True(t, rtt >= 0)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the round trip to be reported")
+	}
+}
+
+func TestPongWait(t *testing.T) {
+	c := &wsConnection{}
+	c.PingPongInterval = time.Second
+	assert.Equal(t, 2*time.Second, c.pongWait(), "Expected the default multiplier to be used")
+
+	c.PongWaitMultiplier = 5
+	assert.Equal(t, 5*time.Second, c.pongWait())
+}
+
+func TestWebsocketMaxMissedPongs(t *testing.T) {
+	failures := make(chan int, 1)
+	server := newTestServer(t, Websocket{
+		PingPongInterval:   10 * time.Millisecond,
+		PongWaitMultiplier: 100,
+		MaxMissedPongs:     2,
+		LivenessFailureFunc: func(ctx context.Context, missedPongs int) {
+			failures <- missedPongs
+		},
+	}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+
+	select {
+	case missed := <-failures:
+		assert.Equal(t, 2, missed)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the connection to be dropped for missed pongs")
+	}
+}
+
+func TestWebsocketPongWaitTimeout(t *testing.T) {
+	failures := make(chan int, 1)
+	server := newTestServer(t, Websocket{
+		PingPongInterval:   10 * time.Millisecond,
+		PongWaitMultiplier: 3,
+		LivenessFailureFunc: func(ctx context.Context, missedPongs int) {
+			failures <- missedPongs
+		},
+	}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+
+	select {
+	case missed := <-failures:
+		assert.True(t, missed > 0)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the connection to be dropped when the read deadline passes")
+	}
+}
+
+func TestWebsocketPongWaitAnyMessage(t *testing.T) {
+	for name, loop := range map[string]func(t *testing.T) *EventLoop{
+		"goroutines": func(t *testing.T) *EventLoop { return nil },
+		"event loop": newTestEventLoop,
+	} {
+		t.Run(name, func(t *testing.T) {
+			failures := make(chan int, 1)
+			server := newTestServer(t, Websocket{
+				EventLoop:          loop(t),
+				PingPongInterval:   20 * time.Millisecond,
+				PongWaitMultiplier: 2,
+				LivenessFailureFunc: func(ctx context.Context, missedPongs int) {
+					failures <- missedPongs
+				},
+			}, nil)
+
+			conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+			assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+			readMessageOfType(t, conn, "connection_ack")
+
+			// The pings of the client keep the connection open past the pong wait, without pongs
+			for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+				assert.NoError(t, conn.WriteJSON(map[string]string{"type": "ping"}))
+				time.Sleep(10 * time.Millisecond)
+			}
+			select {
+			case <-failures:
+				t.Fatal("Expected the messages of the client to keep the connection open")
+			default:
+			}
+
+			// Once the client stays silent, the connection is dropped
+			select {
+			case missed := <-failures:
+				assert.True(t, missed > 0)
+			case <-time.After(time.Second):
+				t.Fatal("Expected the connection to be dropped once the client stays silent")
+			}
+		})
+	}
+}
+
+func TestWebsocketClientKeepAlive(t *testing.T) {
+	server := newTestServer(t, Websocket{KeepAlivePingInterval: time.Hour}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 1)
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+			close(payloads)
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqlwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+
+	var msg graphqlwsMessage
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, graphqlwsConnectionAckMsg, msg.Type)
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, graphqlwsConnectionKeepAliveMsg, msg.Type)
+
+	// A keep alive sent by the client is accepted instead of closing the connection, but not answered
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "ka"}))
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "start", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, graphqlwsDataMsg, msg.Type)
+}
+
+func TestWebsocketClientKeepAliveTimeout(t *testing.T) {
+	for name, loop := range map[string]func(t *testing.T) *EventLoop{
+		"goroutines": func(t *testing.T) *EventLoop { return nil },
+		"event loop": newTestEventLoop,
+	} {
+		t.Run(name, func(t *testing.T) {
+			failures := make(chan int, 1)
+			server := newTestServer(t, Websocket{
+				EventLoop:              loop(t),
+				ClientKeepAliveTimeout: 100 * time.Millisecond,
+				LivenessFailureFunc: func(ctx context.Context, missedPongs int) {
+					failures <- missedPongs
+				},
+			}, testGraphQLService{
+				subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+					payloads := make(chan interface{}, 1)
+					payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+					close(payloads)
+					return payloads, nil
+				},
+			})
+
+			conn := dialTestServer(t, server, graphqlwsSubprotocol)
+			assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+			readMessageOfType(t, conn, "connection_ack")
+
+			// The keep alives of the client keep the connection open past the timeout
+			for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); {
+				assert.NoError(t, conn.WriteJSON(map[string]string{"type": "ka"}))
+				time.Sleep(20 * time.Millisecond)
+			}
+			assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "start", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+			readMessageOfType(t, conn, "data")
+
+			// Once the client stops sending them, the connection is dropped
+			closeErr := readCloseError(t, conn)
+			// coder/websocket drops the connection whose read deadline passed without a close frame
+			if socketLibrary != "coder/websocket" {
+				assert.Equal(t, CloseReasonKeepAliveTimeout.Code, closeErr.Code)
+				assert.Equal(t, CloseReasonKeepAliveTimeout.Reason, closeErr.Text)
+			}
+			select {
+			case missed := <-failures:
+				assert.Equal(t, 0, missed)
+			case <-time.After(time.Second):
+				t.Fatal("Expected the liveness failure to be reported")
+			}
+		})
+	}
+}
+
+func TestWebsocketClientKeepAliveTimeoutAnyFrame(t *testing.T) {
+	for name, loop := range map[string]func(t *testing.T) *EventLoop{
+		"goroutines": func(t *testing.T) *EventLoop { return nil },
+		"event loop": newTestEventLoop,
+	} {
+		for frame, send := range map[string]func(conn *websocket.Conn) error{
+			"message": func(conn *websocket.Conn) error {
+				return conn.WriteJSON(map[string]string{"type": "stop", "id": "unknown"})
+			},
+			"websocket ping": func(conn *websocket.Conn) error {
+				return conn.WriteControl(websocket.PingMessage, []byte("alive"), time.Now().Add(time.Second))
+			},
+		} {
+			t.Run(name+"/"+frame, func(t *testing.T) {
+				failures := make(chan int, 1)
+				server := newTestServer(t, Websocket{
+					EventLoop:              loop(t),
+					ClientKeepAliveTimeout: 100 * time.Millisecond,
+					LivenessFailureFunc: func(ctx context.Context, missedPongs int) {
+						failures <- missedPongs
+					},
+				}, nil)
+
+				conn := dialTestServer(t, server, graphqlwsSubprotocol)
+				assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+				readMessageOfType(t, conn, "connection_ack")
+
+				// The frames of the client keep the connection open past the timeout, without keep
+				// alives
+				for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); {
+					assert.NoError(t, send(conn))
+					time.Sleep(20 * time.Millisecond)
+				}
+				select {
+				case <-failures:
+					t.Fatal("Expected the frames of the client to keep the connection open")
+				default:
+				}
+
+				// Once the client stays silent, the connection is dropped
+				select {
+				case <-failures:
+				case <-time.After(time.Second):
+					t.Fatal("Expected the connection to be dropped once the client stays silent")
+				}
+			})
+		}
+	}
+}
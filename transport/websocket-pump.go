@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// operationPump delivers the payloads of an operation to its connection.
+type operationPump struct {
+	ctx      context.Context
+	payloads <-chan interface{}
+	// deliver writes a payload, it returns false when the operation must end
+	deliver func(payload interface{}) bool
+	// finish ends the operation, with the panic recovered while delivering its payloads, if any
+	finish func(panicked interface{})
+	// closed is set once the payloads are closed
+	closed bool
+}
+
+// run delivers the payloads of the operation on the current goroutine.
+func (p *operationPump) run() {
+	defer func() {
+		p.finish(recover())
+		for range p.payloads { // drain input channel
+		}
+	}()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case payload, more := <-p.payloads:
+			if !more || !p.deliver(payload) {
+				return
+			}
+		}
+	}
+}
+
+// step delivers a payload, or ends the operation when end is true. It returns false once the
+// operation is finished.
+func (p *operationPump) step(payload interface{}, end bool) (goesOn bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.finish(r)
+			goesOn = false
+		}
+	}()
+	if !end && p.deliver(payload) {
+		return true
+	}
+	p.finish(nil)
+	return false
+}
+
+// workerPool runs the jobs submitted to it with at most limit goroutines, the others are queued.
+// The goroutines exit once the queue is empty.
+type workerPool struct {
+	limit int
+
+	mu      sync.Mutex
+	queue   []func()
+	workers int
+}
+
+func (w *workerPool) submit(job func()) {
+	w.mu.Lock()
+	if w.workers >= w.limit {
+		w.queue = append(w.queue, job)
+		w.mu.Unlock()
+		return
+	}
+	w.workers++
+	w.mu.Unlock()
+	go w.work(job)
+}
+
+func (w *workerPool) work(job func()) {
+	for job != nil {
+		job()
+		w.mu.Lock()
+		job = nil
+		if len(w.queue) != 0 {
+			job = w.queue[0]
+			w.queue[0] = nil
+			w.queue = w.queue[1:]
+		} else {
+			w.workers--
+		}
+		w.mu.Unlock()
+	}
+}
+
+// pumpPool delivers the payloads of the operations of a connection with a bounded number of
+// goroutines, see Websocket.MaxPumpsPerConnection: a dispatcher waits for the payloads of all the
+// operations and a workerPool, of the connection or of the WorkerPool of the Websocket, delivers
+// them. An operation is only waited for while none of its payloads is being delivered, so that
+// they are delivered in order.
+type pumpPool struct {
+	// limit bounds the payloads delivered at once when not zero
+	limit   int
+	workers *workerPool
+	wake    chan struct{}
+
+	mu         sync.Mutex
+	idle       []*operationPump
+	delivering int
+	// draining are the payloads of the finished operations, until their service closes them
+	draining []<-chan interface{}
+	// pumps counts the idle, delivering and draining operations, the dispatcher exits when zero
+	pumps   int
+	running bool
+}
+
+func newPumpPool(limit int, workers *workerPool) *pumpPool {
+	if workers == nil {
+		workers = &workerPool{limit: limit}
+	}
+	return &pumpPool{limit: limit, workers: workers, wake: make(chan struct{}, 1)}
+}
+
+// add delivers the payloads of an operation.
+func (p *pumpPool) add(pump *operationPump) {
+	p.mu.Lock()
+	p.pumps++
+	p.idle = append(p.idle, pump)
+	start := !p.running
+	p.running = true
+	p.mu.Unlock()
+	if start {
+		go p.dispatch()
+	} else {
+		p.notify()
+	}
+}
+
+func (p *pumpPool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// release waits for the next payload of an operation once one is delivered, or drains its
+// payloads once it is finished.
+func (p *pumpPool) release(pump *operationPump, goesOn bool) {
+	p.mu.Lock()
+	p.delivering--
+	switch {
+	case goesOn:
+		p.idle = append(p.idle, pump)
+	case !pump.closed:
+		p.draining = append(p.draining, pump.payloads)
+	default:
+		p.pumps--
+	}
+	p.mu.Unlock()
+	p.notify()
+}
+
+func (p *pumpPool) dispatch() {
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(p.wake)}}
+	for {
+		p.mu.Lock()
+		if p.pumps == 0 {
+			p.running = false
+			p.mu.Unlock()
+			return
+		}
+		// every idle operation has a case for its context then one for its payloads, they aren't
+		// waited for while the limit is reached
+		idle := p.idle
+		if p.limit > 0 && p.delivering >= p.limit {
+			idle = nil
+		}
+		cases = cases[:1]
+		for _, pump := range idle {
+			cases = append(cases,
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(pump.ctx.Done())},
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(pump.payloads)})
+		}
+		for _, payloads := range p.draining {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(payloads)})
+		}
+		draining := p.draining
+		p.mu.Unlock()
+
+		chosen, value, more := reflect.Select(cases)
+		switch {
+		case chosen == 0:
+		case chosen <= 2*len(idle):
+			pump := idle[(chosen-1)/2]
+			p.mu.Lock()
+			p.idle = slices.DeleteFunc(p.idle, func(idle *operationPump) bool { return idle == pump })
+			p.delivering++
+			p.mu.Unlock()
+			var payload interface{}
+			end := chosen%2 == 1 || !more
+			if chosen%2 == 0 {
+				if more {
+					payload = value.Interface()
+				} else {
+					pump.closed = true
+				}
+			}
+			p.workers.submit(func() {
+				p.release(pump, pump.step(payload, end))
+			})
+		case !more:
+			payloads := draining[chosen-1-2*len(idle)]
+			p.mu.Lock()
+			p.draining = slices.DeleteFunc(p.draining, func(draining <-chan interface{}) bool { return draining == payloads })
+			p.pumps--
+			p.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPumpPoolBoundsConcurrency(t *testing.T) {
+	pool := newPumpPool(3, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var concurrent, maxConcurrent atomic.Int32
+	var mu sync.Mutex
+	delivered := map[int][]int{}
+	var finished sync.WaitGroup
+	channels := make([]chan interface{}, 50)
+	for i := range channels {
+		channels[i] = make(chan interface{})
+		pump := &operationPump{ctx: ctx, payloads: channels[i]}
+		pump.deliver = func(payload interface{}) bool {
+			n := concurrent.Add(1)
+			defer concurrent.Add(-1)
+			for {
+				max := maxConcurrent.Load()
+				if n <= max || maxConcurrent.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			delivered[i] = append(delivered[i], payload.(int))
+			mu.Unlock()
+			return true
+		}
+		pump.finish = func(panicked interface{}) {
+			assert.Nil(t, panicked)
+			finished.Done()
+		}
+		finished.Add(1)
+		pool.add(pump)
+	}
+
+	var sent sync.WaitGroup
+	for i := range channels {
+		sent.Add(1)
+		go func() {
+			defer sent.Done()
+			for n := range 5 {
+				channels[i] <- n
+			}
+			close(channels[i])
+		}()
+	}
+	sent.Wait()
+	finished.Wait()
+
+	assert.LessOrEqual(t, maxConcurrent.Load(), int32(3))
+	for i := range channels {
+		assert.Equal(t, []int{0, 1, 2, 3, 4}, delivered[i], "Expected the payloads of %d in order", i)
+	}
+	assert.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return !pool.running
+	}, time.Second, time.Millisecond, "Expected the dispatcher to exit")
+}
+
+func TestPumpPoolFinishesCancelledAndPanickingOperations(t *testing.T) {
+	pool := newPumpPool(1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan interface{}, 2)
+
+	cancelled := make(chan interface{})
+	pool.add(&operationPump{ctx: ctx, payloads: cancelled, finish: func(panicked interface{}) { finished <- panicked }})
+	panicking := make(chan interface{}, 1)
+	panicking <- "payload"
+	pool.add(&operationPump{
+		ctx:      context.Background(),
+		payloads: panicking,
+		deliver:  func(payload interface{}) bool { panic("boom") },
+		finish:   func(panicked interface{}) { finished <- panicked },
+	})
+	assert.Equal(t, "boom", <-finished)
+
+	cancel()
+	select {
+	case panicked := <-finished:
+		assert.Nil(t, panicked)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the cancelled operation to finish")
+	}
+
+	// the finished operations are drained until their service closes them
+	cancelled <- "late"
+	close(cancelled)
+	close(panicking)
+	assert.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return !pool.running && pool.pumps == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestMaxPumpsPerConnection(t *testing.T) {
+	server := newTestServer(t, Websocket{MaxPumpsPerConnection: 1}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{})
+			go func() {
+				defer close(payloads)
+				for n := range 3 {
+					select {
+					case payloads <- map[string]interface{}{"data": map[string]interface{}{"n": n}}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	for i := range 10 {
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": fmt.Sprint(i), "payload": map[string]interface{}{
+			"query": "subscription { n }",
+		}}))
+	}
+
+	next := map[string]float64{}
+	completed := 0
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for completed < 10 {
+		var msg struct {
+			Type    string `json:"type"`
+			ID      string `json:"id"`
+			Payload struct {
+				Data struct {
+					N float64 `json:"n"`
+				} `json:"data"`
+			} `json:"payload"`
+		}
+		if !assert.NoError(t, conn.ReadJSON(&msg)) {
+			return
+		}
+		switch msg.Type {
+		case "next":
+			assert.Equal(t, next[msg.ID], msg.Payload.Data.N, "Expected the payloads of %s in order", msg.ID)
+			next[msg.ID]++
+		case "complete":
+			assert.Equal(t, float64(3), next[msg.ID])
+			completed++
+		}
+	}
+}
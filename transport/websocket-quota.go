@@ -0,0 +1,265 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// closeQuotaExceeded is sent when a connection breaches a Quota with the QuotaClose action.
+const closeQuotaExceeded = 4429
+
+const defaultQuotaInterval = time.Minute
+
+// QuotaAction tells what happens to the payloads beyond a Quota.
+type QuotaAction int
+
+const (
+	// QuotaThrottle delays the payloads until the next interval.
+	QuotaThrottle QuotaAction = iota
+	// QuotaDrop drops the payloads, the next payload sent to the connection carries the number of
+	// dropped payloads in extensions.quota.dropped.
+	QuotaDrop
+	// QuotaClose closes the connection with 4429.
+	QuotaClose
+)
+
+// QuotaUsage is the egress of a connection, or of the connections of a tenant, during an interval.
+type QuotaUsage struct {
+	// Tenant is the tenant of the connections, empty if the quota isn't per tenant.
+	Tenant string
+	// ConnectionID is the id of the connection, empty if the quota is per tenant.
+	ConnectionID string
+	Start        time.Time
+	Messages     int
+	Bytes        int
+}
+
+// Quota limits the data messages sent to the connections in every interval, the other messages of
+// the protocol aren't counted.
+type Quota struct {
+	// MaxMessages is the number of payloads sent per interval, it doesn't limit when zero.
+	MaxMessages int
+	// MaxBytes is the size of the payloads sent per interval, it doesn't limit when zero. A payload
+	// larger than MaxBytes is sent alone in an interval.
+	MaxBytes int
+	// Interval defaults to one minute.
+	Interval time.Duration
+	// PerTenant shares the quota between the connections of a tenant, it requires a Tenancy.
+	PerTenant bool
+	// Action is what happens to the payloads beyond the quota.
+	Action QuotaAction
+
+	// ExceededFunc is called the first time the quota is exceeded during an interval.
+	ExceededFunc func(ctx context.Context, usage QuotaUsage)
+	// UsageFunc is called with the usage of every interval with payloads, e.g. for billing. The
+	// usage of an interval is reported when the next payload is sent after it, and when the
+	// connection is closed for the quotas that aren't per tenant. The usage of a tenant is
+	// reported once the interval of its last connection ends, with a background context.
+	UsageFunc func(ctx context.Context, usage QuotaUsage)
+
+	mu      sync.Mutex
+	tenants map[string]*quotaWindow
+}
+
+func (q *Quota) interval() time.Duration {
+	if q.Interval == 0 {
+		return defaultQuotaInterval
+	}
+	return q.Interval
+}
+
+// window returns the window counting the payloads of a connection.
+func (q *Quota) window(tenant string, connectionID string) *quotaWindow {
+	if !q.PerTenant || tenant == "" {
+		return &quotaWindow{usage: QuotaUsage{ConnectionID: connectionID}}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.tenants == nil {
+		q.tenants = map[string]*quotaWindow{}
+	}
+	w, ok := q.tenants[tenant]
+	if !ok {
+		w = &quotaWindow{usage: QuotaUsage{Tenant: tenant}}
+		q.tenants[tenant] = w
+	}
+	w.refs++
+	return w
+}
+
+// release releases the window of a closed connection, the window of a tenant without connections
+// is removed once its interval ends, so that reconnecting doesn't reset it.
+func (q *Quota) release(tenant string, w *quotaWindow) {
+	if !q.PerTenant || tenant == "" {
+		return
+	}
+	q.mu.Lock()
+	w.refs--
+	idle := w.refs == 0
+	q.mu.Unlock()
+	if !idle {
+		return
+	}
+
+	w.mu.Lock()
+	end := w.usage.Start.Add(q.interval())
+	w.mu.Unlock()
+	time.AfterFunc(time.Until(end), func() { q.expire(tenant, w) })
+}
+
+// expire removes the window of a tenant unless a connection uses it again.
+func (q *Quota) expire(tenant string, w *quotaWindow) {
+	q.mu.Lock()
+	if w.refs != 0 || q.tenants[tenant] != w {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.tenants, tenant)
+	q.mu.Unlock()
+
+	if q.UsageFunc == nil {
+		return
+	}
+	if usage, ok := w.flush(); ok {
+		q.UsageFunc(context.Background(), usage)
+	}
+}
+
+// quotaWindow counts the payloads sent during the current interval.
+type quotaWindow struct {
+	mu       sync.Mutex
+	usage    QuotaUsage
+	exceeded bool
+	// refs is the number of connections of a tenant using the window, it is guarded by Quota.mu.
+	refs int
+}
+
+// quotaResult is the outcome of admitting a payload.
+type quotaResult struct {
+	admitted bool
+	// retryAt is when the next interval starts
+	retryAt  time.Time
+	exceeded *QuotaUsage
+	ended    *QuotaUsage
+}
+
+func (w *quotaWindow) admit(q *Quota, size int, now time.Time) quotaResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var res quotaResult
+	interval := q.interval()
+	if w.usage.Start.IsZero() || !now.Before(w.usage.Start.Add(interval)) {
+		if w.usage.Messages > 0 {
+			ended := w.usage
+			res.ended = &ended
+		}
+		w.usage.Start = now
+		w.usage.Messages, w.usage.Bytes = 0, 0
+		w.exceeded = false
+	}
+
+	// the payloads larger than MaxBytes are admitted alone, they would never be otherwise
+	if (q.MaxMessages > 0 && w.usage.Messages+1 > q.MaxMessages) || (q.MaxBytes > 0 && w.usage.Messages > 0 && w.usage.Bytes+size > q.MaxBytes) {
+		res.retryAt = w.usage.Start.Add(interval)
+		if !w.exceeded {
+			w.exceeded = true
+			exceeded := w.usage
+			res.exceeded = &exceeded
+		}
+		return res
+	}
+	w.usage.Messages++
+	w.usage.Bytes += size
+	res.admitted = true
+	return res
+}
+
+// flush returns the usage of the current interval and resets it.
+func (w *quotaWindow) flush() (QuotaUsage, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	usage := w.usage
+	w.usage.Messages, w.usage.Bytes = 0, 0
+	return usage, usage.Messages > 0
+}
+
+// admitPayload applies the Quota to a payload about to be sent, it returns the payload to send and
+// false when it must not be sent.
+func (c *wsConnection) admitPayload(ctx context.Context, payload []byte) ([]byte, bool) {
+	q := c.Quota
+	for {
+		res := c.quotaWindow.admit(q, len(payload), time.Now())
+		if res.ended != nil && q.UsageFunc != nil {
+			q.UsageFunc(c.ctx, *res.ended)
+		}
+		if res.exceeded != nil && q.ExceededFunc != nil {
+			q.ExceededFunc(c.ctx, *res.exceeded)
+		}
+		if res.admitted {
+			break
+		}
+
+		switch q.Action {
+		case QuotaDrop:
+			c.quotaDropped.Add(1)
+			return nil, false
+		case QuotaClose:
+			c.closeWithReason(CloseReasonQuotaExceeded)
+			return nil, false
+		}
+		timer := time.NewTimer(time.Until(res.retryAt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false
+		}
+	}
+
+	if dropped := c.quotaDropped.Swap(0); dropped > 0 {
+		payload = withExtension(payload, "quota", map[string]int64{"dropped": dropped})
+	}
+	return payload, true
+}
+
+// reportQuotaUsage reports the usage of the current interval of a connection once it is closed.
+func (c *wsConnection) reportQuotaUsage() {
+	if c.Quota.UsageFunc == nil || c.quotaWindow.usage.ConnectionID == "" {
+		return
+	}
+	if usage, ok := c.quotaWindow.flush(); ok {
+		c.Quota.UsageFunc(c.ctx, usage)
+	}
+}
+
+// withExtension sets an extension of a response, payloads that aren't JSON objects are returned
+// unchanged.
+func withExtension(payload json.RawMessage, name string, value interface{}) json.RawMessage {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &response); err != nil || response == nil {
+		return payload
+	}
+
+	extensions := map[string]json.RawMessage{}
+	if raw, ok := response["extensions"]; ok {
+		_ = json.Unmarshal(raw, &extensions)
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return payload
+	}
+	extensions[name] = b
+
+	if response["extensions"], err = json.Marshal(extensions); err != nil {
+		return payload
+	}
+	if b, err = json.Marshal(response); err != nil {
+		return payload
+	}
+	return b
+}
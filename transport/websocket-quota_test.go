@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newQuotaTestServer serves a subscription sending the payloads written to the returned channel.
+func newQuotaTestServer(t *testing.T, ws Websocket) (*websocket.Conn, chan<- interface{}) {
+	payloads := make(chan interface{})
+	server := newTestServer(t, ws, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	return conn, payloads
+}
+
+func TestQuotaDrop(t *testing.T) {
+	var mu sync.Mutex
+	var exceeded, used []QuotaUsage
+	quota := &Quota{
+		MaxMessages: 1,
+		Interval:    time.Hour,
+		Action:      QuotaDrop,
+		ExceededFunc: func(ctx context.Context, usage QuotaUsage) {
+			mu.Lock()
+			defer mu.Unlock()
+			exceeded = append(exceeded, usage)
+		},
+		UsageFunc: func(ctx context.Context, usage QuotaUsage) {
+			mu.Lock()
+			defer mu.Unlock()
+			used = append(used, usage)
+		},
+	}
+	conn, payloads := newQuotaTestServer(t, Websocket{Quota: quota})
+
+	payloads <- map[string]interface{}{"data": 1}
+	assert.Equal(t, map[string]interface{}{"data": float64(1)}, readResponse(t, conn))
+	payloads <- map[string]interface{}{"data": 2}
+	payloads <- map[string]interface{}{"data": 3}
+
+	mu.Lock()
+	if assert.Len(t, exceeded, 1) {
+		assert.Equal(t, 1, exceeded[0].Messages)
+		assert.NotEmpty(t, exceeded[0].ConnectionID)
+	}
+	mu.Unlock()
+
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(used) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 1, used[0].Messages)
+	assert.Equal(t, len(`{"data":1}`), used[0].Bytes)
+}
+
+func TestQuotaDropWarns(t *testing.T) {
+	conn, payloads := newQuotaTestServer(t, Websocket{Quota: &Quota{MaxMessages: 1, Interval: 50 * time.Millisecond, Action: QuotaDrop}})
+
+	payloads <- map[string]interface{}{"data": 1}
+	readResponse(t, conn)
+	payloads <- map[string]interface{}{"data": 2}
+	time.Sleep(60 * time.Millisecond)
+	payloads <- map[string]interface{}{"data": 3}
+	assert.Equal(t, map[string]interface{}{
+		"data":       float64(3),
+		"extensions": map[string]interface{}{"quota": map[string]interface{}{"dropped": float64(1)}},
+	}, readResponse(t, conn))
+}
+
+func TestQuotaThrottle(t *testing.T) {
+	conn, payloads := newQuotaTestServer(t, Websocket{Quota: &Quota{MaxBytes: 30, Interval: 100 * time.Millisecond}})
+
+	go func() {
+		payloads <- map[string]interface{}{"data": "first message"}
+		payloads <- map[string]interface{}{"data": "second message"}
+	}()
+	readResponse(t, conn)
+	start := time.Now()
+	assert.Equal(t, map[string]interface{}{"data": "second message"}, readResponse(t, conn))
+	assert.Greater(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestQuotaOversizedPayload(t *testing.T) {
+	quota := &Quota{MaxBytes: 5}
+	w := quota.window("", "1")
+	now := time.Now()
+	assert.True(t, w.admit(quota, 10, now).admitted)
+	assert.False(t, w.admit(quota, 10, now).admitted)
+	assert.True(t, w.admit(quota, 10, now.Add(time.Minute)).admitted)
+
+	conn, payloads := newQuotaTestServer(t, Websocket{Quota: &Quota{MaxBytes: 5, Interval: time.Hour}})
+	go func() { payloads <- map[string]interface{}{"data": "larger than the quota"} }()
+	assert.Equal(t, map[string]interface{}{"data": "larger than the quota"}, readResponse(t, conn))
+}
+
+func TestQuotaClose(t *testing.T) {
+	conn, payloads := newQuotaTestServer(t, Websocket{Quota: &Quota{MaxMessages: 1, Action: QuotaClose}})
+
+	payloads <- map[string]interface{}{"data": 1}
+	readResponse(t, conn)
+	payloads <- map[string]interface{}{"data": 2}
+
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, closeQuotaExceeded), "unexpected error %v", err)
+}
+
+func TestQuotaPerTenant(t *testing.T) {
+	quota := &Quota{MaxMessages: 1, PerTenant: true}
+	first := quota.window("acme", "1")
+	assert.Same(t, first, quota.window("acme", "2"))
+	assert.NotSame(t, first, quota.window("globex", "3"))
+	assert.NotSame(t, quota.window("", "4"), quota.window("", "5"))
+
+	now := time.Now()
+	assert.True(t, first.admit(quota, 10, now).admitted)
+	res := quota.window("acme", "2").admit(quota, 10, now)
+	assert.False(t, res.admitted)
+	assert.Equal(t, "acme", res.exceeded.Tenant)
+	assert.True(t, first.admit(quota, 10, now.Add(time.Minute)).admitted)
+}
+
+func TestQuotaPerTenantExpires(t *testing.T) {
+	used := make(chan QuotaUsage, 1)
+	quota := &Quota{
+		MaxMessages: 1,
+		PerTenant:   true,
+		Interval:    20 * time.Millisecond,
+		UsageFunc:   func(ctx context.Context, usage QuotaUsage) { used <- usage },
+	}
+	first := quota.window("acme", "1")
+	second := quota.window("acme", "2")
+	assert.True(t, first.admit(quota, 10, time.Now()).admitted)
+
+	quota.release("acme", first)
+	quota.release("acme", second)
+	// the window is kept until the interval ends
+	assert.Same(t, first, quota.window("acme", "3"))
+	quota.release("acme", first)
+
+	select {
+	case usage := <-used:
+		assert.Equal(t, QuotaUsage{Tenant: "acme", Start: usage.Start, Messages: 1, Bytes: 10}, usage)
+	case <-time.After(time.Second):
+		t.Fatal("usage not reported")
+	}
+	quota.mu.Lock()
+	defer quota.mu.Unlock()
+	assert.Empty(t, quota.tenants)
+}
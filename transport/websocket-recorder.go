@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// FrameRecorder receives the frames of the connections selected for recording. Record is called
+// concurrently for different connections.
+type FrameRecorder interface {
+	Record(f Frame)
+}
+
+// WebsocketRecordFunc decides whether the connection upgraded from the request is recorded.
+type WebsocketRecordFunc func(r *http.Request) bool
+
+// RingRecorder keeps the most recent frames in memory.
+type RingRecorder struct {
+	mu     sync.Mutex
+	frames []Frame
+	next   int
+	full   bool
+}
+
+// NewRingRecorder returns a recorder keeping the last size frames.
+func NewRingRecorder(size int) *RingRecorder {
+	return &RingRecorder{frames: make([]Frame, size)}
+}
+
+// Record implements FrameRecorder
+func (r *RingRecorder) Record(f Frame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.frames) == 0 {
+		return
+	}
+	r.frames[r.next] = f
+	r.next = (r.next + 1) % len(r.frames)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Frames returns the recorded frames, oldest first.
+func (r *RingRecorder) Frames() []Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]Frame(nil), r.frames[:r.next]...)
+	}
+	return append(append([]Frame(nil), r.frames[r.next:]...), r.frames[:r.next]...)
+}
+
+// JSONRecorder writes every frame as a line of JSON, the output can be read back with ReadFrames.
+type JSONRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// ErrorFunc is called when a frame can't be written
+	ErrorFunc func(err error)
+}
+
+// NewJSONRecorder returns a recorder writing to w.
+func NewJSONRecorder(w io.Writer) *JSONRecorder {
+	return &JSONRecorder{enc: json.NewEncoder(w)}
+}
+
+// Record implements FrameRecorder
+func (r *JSONRecorder) Record(f Frame) {
+	r.mu.Lock()
+	err := r.enc.Encode(f)
+	r.mu.Unlock()
+
+	if err != nil && r.ErrorFunc != nil {
+		r.ErrorFunc(err)
+	}
+}
+
+// ReadFrames reads frames written by a JSONRecorder.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var f Frame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+	}
+
+	return frames, scanner.Err()
+}
@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingRecorder(t *testing.T) {
+	r := NewRingRecorder(2)
+	assert.Empty(t, r.Frames())
+
+	r.Record(Frame{ID: "1"})
+	assert.Equal(t, []Frame{{ID: "1"}}, r.Frames())
+
+	r.Record(Frame{ID: "2"})
+	r.Record(Frame{ID: "3"})
+	assert.Equal(t, []Frame{{ID: "2"}, {ID: "3"}}, r.Frames(), "Expected the oldest frame to be dropped")
+
+	// A zero sized recorder doesn't keep anything
+	empty := NewRingRecorder(0)
+	empty.Record(Frame{ID: "1"})
+	assert.Empty(t, empty.Frames())
+}
+
+func TestJSONRecorderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSONRecorder(&buf)
+	r.Record(Frame{ConnectionID: "c", Direction: FrameInbound, Type: "connection_init", Data: []byte(`{"type":"connection_init"}`)})
+	r.Record(Frame{ConnectionID: "c", Direction: FrameOutbound, Type: "connection_ack", Data: []byte(`{"type":"connection_ack"}`)})
+
+	frames, err := ReadFrames(&buf)
+
+	assert.NoError(t, err)
+	if assert.Len(t, frames, 2) {
+		assert.Equal(t, FrameInbound, frames[0].Direction)
+		assert.Equal(t, "connection_init", frames[0].Type)
+		assert.JSONEq(t, `{"type":"connection_ack"}`, string(frames[1].Data))
+	}
+}
+
+func TestReadFramesInvalid(t *testing.T) {
+	_, err := ReadFrames(bytes.NewBufferString("not json\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,238 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RegistryEventType tells what happened to a connection tracked by a Registry
+type RegistryEventType int
+
+const (
+	// ConnectionRegistered is emitted once a connection is initialised
+	ConnectionRegistered RegistryEventType = iota
+	// ConnectionUnregistered is emitted when a connection is closed
+	ConnectionUnregistered
+)
+
+// RegistryEvent is sent to the listeners of a Registry
+type RegistryEvent struct {
+	Type       RegistryEventType
+	Connection *Connection
+}
+
+// OperationEvent is sent to the operation listeners of a Registry for every transition of the
+// operations of its connections.
+type OperationEvent struct {
+	Connection *Connection
+	Operation  *OperationInfo
+	Transition OperationTransition
+}
+
+// Connection is a handle on an initialised websocket connection tracked by a Registry.
+type Connection struct {
+	c           *wsConnection
+	connectedAt time.Time
+}
+
+// Info returns the information about the client of the connection.
+func (c *Connection) Info() *ConnectionInfo {
+	return GetConnectionInfo(c.c.ctx)
+}
+
+// Context returns the context of the connection, as returned by the InitFunc.
+func (c *Connection) Context() context.Context {
+	return c.c.ctx
+}
+
+// InitPayload returns the payload sent by the client with connection_init.
+func (c *Connection) InitPayload() InitPayload {
+	return c.c.initPayload
+}
+
+// ConnectedAt returns the time the connection was initialised.
+func (c *Connection) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// Subscriptions returns the ids of the active operations, sorted.
+func (c *Connection) Subscriptions() []string {
+	c.c.mu.Lock()
+	ids := make([]string, 0, len(c.c.active))
+	for id := range c.c.active {
+		ids = append(ids, id)
+	}
+	c.c.mu.Unlock()
+
+	sort.Strings(ids)
+	return ids
+}
+
+// Operations returns the operations being started, active or ending, sorted by id, see
+// OperationInfo.State.
+func (c *Connection) Operations() []*OperationInfo {
+	c.c.mu.Lock()
+	ops := make([]*OperationInfo, 0, len(c.c.operations))
+	for _, op := range c.c.operations {
+		ops = append(ops, op)
+	}
+	c.c.mu.Unlock()
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+	return ops
+}
+
+// SendRaw sends a payload encoded to JSON to an active operation of the connection, along with
+// the payloads of its GraphQLService. The payload is delivered like theirs, e.g. it is masked,
+// counted by the Quota and encrypted.
+func (c *Connection) SendRaw(id string, payload json.RawMessage) error {
+	if !json.Valid(payload) {
+		return fmt.Errorf("invalid JSON payload for operation %s", id)
+	}
+	c.c.mu.Lock()
+	_, ok := c.c.active[id]
+	deliver := c.c.deliveries[id]
+	c.c.mu.Unlock()
+	if !ok || deliver == nil {
+		return fmt.Errorf("operation %s is not active", id)
+	}
+	if !deliver(payload) {
+		return fmt.Errorf("operation %s failed to deliver the payload", id)
+	}
+	return nil
+}
+
+// Close closes the connection with the given websocket close code and reason.
+func (c *Connection) Close(code int, reason string) {
+	c.c.close(code, reason)
+}
+
+// Registry tracks the initialised connections of the Websocket transports it is assigned to. It is
+// safe for concurrent use and can be shared by several transports.
+type Registry struct {
+	mu                 sync.RWMutex
+	conns              map[string]*Connection
+	listeners          map[int]func(RegistryEvent)
+	operationListeners map[int]func(OperationEvent)
+	nextID             int
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		conns:              map[string]*Connection{},
+		listeners:          map[int]func(RegistryEvent){},
+		operationListeners: map[int]func(OperationEvent){},
+	}
+}
+
+// Connections returns the tracked connections, oldest first.
+func (r *Registry) Connections() []*Connection {
+	r.mu.RLock()
+	conns := make([]*Connection, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].connectedAt.Before(conns[j].connectedAt)
+	})
+	return conns
+}
+
+// Get returns the connection with the given id, or nil if it isn't tracked.
+func (r *Registry) Get(id string) *Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.conns[id]
+}
+
+// Count returns the number of tracked connections.
+func (r *Registry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.conns)
+}
+
+// Listen registers fn to be called for every connection registered or unregistered after the call.
+// Listeners are called synchronously and must not block. The returned function removes the listener.
+func (r *Registry) Listen(fn func(RegistryEvent)) (cancel func()) {
+	r.mu.Lock()
+	id := r.nextID
+	r.nextID++
+	r.listeners[id] = fn
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		delete(r.listeners, id)
+		r.mu.Unlock()
+	}
+}
+
+func (r *Registry) emit(event RegistryEvent) {
+	r.mu.RLock()
+	listeners := make([]func(RegistryEvent), 0, len(r.listeners))
+	for _, fn := range r.listeners {
+		listeners = append(listeners, fn)
+	}
+	r.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+// ListenOperations registers fn to be called for every transition of the operations of the
+// connections after the call, see OperationState, e.g. to find the operations stuck in a state.
+// Listeners are called synchronously and must not block. The returned function removes the
+// listener.
+func (r *Registry) ListenOperations(fn func(OperationEvent)) (cancel func()) {
+	r.mu.Lock()
+	id := r.nextID
+	r.nextID++
+	r.operationListeners[id] = fn
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		delete(r.operationListeners, id)
+		r.mu.Unlock()
+	}
+}
+
+func (r *Registry) emitOperation(event OperationEvent) {
+	r.mu.RLock()
+	listeners := make([]func(OperationEvent), 0, len(r.operationListeners))
+	for _, fn := range r.operationListeners {
+		listeners = append(listeners, fn)
+	}
+	r.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+func (r *Registry) register(c *wsConnection) *Connection {
+	conn := &Connection{c: c, connectedAt: time.Now()}
+	r.mu.Lock()
+	r.conns[GetConnectionInfo(c.ctx).ID] = conn
+	r.mu.Unlock()
+
+	r.emit(RegistryEvent{Type: ConnectionRegistered, Connection: conn})
+	return conn
+}
+
+func (r *Registry) unregister(conn *Connection) {
+	r.mu.Lock()
+	delete(r.conns, conn.Info().ID)
+	r.mu.Unlock()
+
+	r.emit(RegistryEvent{Type: ConnectionUnregistered, Connection: conn})
+}
@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryTracksConnections(t *testing.T) {
+	registry := NewRegistry()
+	events := make(chan RegistryEvent, 4)
+	cancel := registry.Listen(func(e RegistryEvent) { events <- e })
+	defer cancel()
+
+	payloads := make(chan interface{})
+	server := newTestServer(t, Websocket{Registry: registry}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]string{"user": "alice"}}))
+
+	registered := <-events
+	assert.Equal(t, ConnectionRegistered, registered.Type)
+	assert.Equal(t, 1, registry.Count())
+	assert.Same(t, registered.Connection, registry.Get(registered.Connection.Info().ID))
+	assert.Equal(t, "alice", registered.Connection.InitPayload().GetString("user"))
+	assert.False(t, registered.Connection.ConnectedAt().IsZero())
+	assert.NotNil(t, registered.Connection.Context())
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+	assert.Eventually(t, func() bool {
+		subs := registered.Connection.Subscriptions()
+		return len(subs) == 1 && subs[0] == "1"
+	}, time.Second, 5*time.Millisecond)
+	if ops := registered.Connection.Operations(); assert.Len(t, ops, 1) {
+		assert.Equal(t, "1", ops[0].ID)
+		assert.Equal(t, "subscription { value }", ops[0].Query)
+	}
+
+	assert.NoError(t, registered.Connection.SendRaw("1", json.RawMessage(`{"data":{"value":"raw"}}`)))
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"value": "raw"}}, readResponse(t, conn))
+	assert.EqualError(t, registered.Connection.SendRaw("2", json.RawMessage(`{}`)), "operation 2 is not active")
+	assert.EqualError(t, registered.Connection.SendRaw("1", json.RawMessage(`{`)), "invalid JSON payload for operation 1")
+
+	registry.Connections()[0].Close(websocket.CloseGoingAway, "bye")
+
+	unregistered := <-events
+	assert.Equal(t, ConnectionUnregistered, unregistered.Type)
+	assert.Equal(t, 0, registry.Count())
+	assert.Empty(t, registry.Connections())
+}
+
+func TestRegistrySendRawDeliversLikeService(t *testing.T) {
+	registry := NewRegistry()
+	events := make(chan RegistryEvent, 1)
+	cancel := registry.Listen(func(e RegistryEvent) { events <- e })
+	defer cancel()
+
+	server := newTestServer(t, Websocket{
+		Registry: registry,
+		ResponseFunc: func(ctx context.Context, id string, payload json.RawMessage) (json.RawMessage, error) {
+			return withExtension(payload, "transformed", true), nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return make(chan interface{}), nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	registered := <-events
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { value }"}}))
+	assert.Eventually(t, func() bool {
+		return registered.Connection.SendRaw("1", json.RawMessage(`{"data":{"value":"raw"}}`)) == nil
+	}, time.Second, 5*time.Millisecond)
+
+	next := readMessageOfType(t, conn, "next")
+	assert.JSONEq(t, `{"data":{"value":"raw"},"extensions":{"transformed":true}}`, string(next["payload"]))
+}
+
+func TestRegistryListenCancel(t *testing.T) {
+	registry := NewRegistry()
+	called := false
+	cancel := registry.Listen(func(e RegistryEvent) { called = true })
+	cancel()
+
+	registry.emit(RegistryEvent{})
+	assert.False(t, called, "Expected removed listener not to be called")
+}
@@ -48,3 +48,25 @@ func TestGetSubscriptionErrorEmpty(t *testing.T) {
 	// Assert on the expected empty result
 	assert.Empty(t, errs, "Expected no errors in the newly initialized context")
 }
+
+func TestAddSubscriptionErrorFromService(t *testing.T) {
+	server := newTestServer(t, Websocket{}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			ch := make(chan interface{})
+			go func() {
+				defer close(ch)
+				AddSubscriptionError(ctx, gqlerror.Errorf("stream failed"))
+			}()
+			return ch, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query": "subscription { value }",
+	}}))
+	assert.Contains(t, string(readMessageOfType(t, conn, "error")["payload"]), "stream failed")
+}
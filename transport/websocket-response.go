@@ -0,0 +1,15 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// transformResponse runs the configured ResponseFunc, if any, on an outgoing payload.
+func (c *wsConnection) transformResponse(ctx context.Context, id string, payload json.RawMessage) (json.RawMessage, error) {
+	if c.ResponseFunc == nil {
+		return payload, nil
+	}
+
+	return c.ResponseFunc(ctx, id, payload)
+}
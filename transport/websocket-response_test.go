@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformResponseWithoutFunc(t *testing.T) {
+	c := &wsConnection{}
+
+	payload, err := c.transformResponse(context.Background(), "1", json.RawMessage(`{"data":{}}`))
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data":{}}`, string(payload))
+}
+
+func TestTransformResponseWithFunc(t *testing.T) {
+	c := &wsConnection{}
+	c.ResponseFunc = func(ctx context.Context, id string, payload json.RawMessage) (json.RawMessage, error) {
+		assert.Equal(t, "1", id)
+		return json.RawMessage(`{"data":{},"extensions":{"redacted":true}}`), nil
+	}
+
+	payload, err := c.transformResponse(context.Background(), "1", json.RawMessage(`{"data":{"secret":"value"}}`))
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data":{},"extensions":{"redacted":true}}`, string(payload))
+}
+
+func TestTransformResponseError(t *testing.T) {
+	c := &wsConnection{}
+	c.ResponseFunc = func(ctx context.Context, id string, payload json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("cannot transform")
+	}
+
+	_, err := c.transformResponse(context.Background(), "1", json.RawMessage(`{}`))
+
+	assert.EqualError(t, err, "cannot transform")
+}
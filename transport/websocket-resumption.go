@@ -0,0 +1,294 @@
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultResumptionWindow = 30 * time.Second
+
+// BufferedEvent is a response stored for a resumable operation.
+type BufferedEvent struct {
+	ID      string
+	Payload json.RawMessage
+}
+
+// EventBuffer stores the responses of resumable operations by resumption token. Sharing a buffer
+// between nodes lets a client reconnect to any of them and still receive the events it missed.
+type EventBuffer interface {
+	// Append stores a response and returns the id of the event.
+	Append(ctx context.Context, token string, payload json.RawMessage) (string, error)
+	// After returns, in order, the events stored after the event with the given id.
+	After(ctx context.Context, token string, id string) ([]BufferedEvent, error)
+	// Claim records owner as the operation serving token.
+	Claim(ctx context.Context, token string, owner string) error
+	// Owner returns the operation serving token, or an empty string if it isn't claimed.
+	Owner(ctx context.Context, token string) (string, error)
+}
+
+// Resumption lets clients resume subscriptions after reconnecting. A client opts in by sending
+// extensions.resumption.token with the subscribe message, and lastEventId when resuming. Every
+// response of a resumable operation carries extensions.resumption.eventId.
+//
+// When the connection drops, resumable operations keep running for Window, buffering their
+// events, until the token is claimed by the resumed operation.
+//
+// The tokens are scoped to the identity and tenant of the connection, see WithIdentity, so that a
+// client can't resume the operations of another one by guessing or observing its token.
+type Resumption struct {
+	Buffer EventBuffer
+	// Window defaults to 30 seconds
+	Window time.Duration
+	// AllowAnonymous lets the connections without identity nor tenant resume their operations,
+	// they share a single scope so their tokens must be unguessable, e.g. random UUIDs.
+	AllowAnonymous bool
+}
+
+func (r *Resumption) window() time.Duration {
+	if r.Window == 0 {
+		return defaultResumptionWindow
+	}
+	return r.Window
+}
+
+type resumptionParams struct {
+	Token       string `json:"token"`
+	LastEventID string `json:"lastEventId"`
+}
+
+type resumptionExtension struct {
+	Token   string `json:"token"`
+	EventID string `json:"eventId"`
+}
+
+// resumableOperation tracks an operation started with a resumption token.
+type resumableOperation struct {
+	token string
+	// key is the token scoped to the connection in the buffer
+	key      string
+	owner    string
+	detached atomic.Bool
+}
+
+// resumableParams returns the resumption parameters of an operation, nil when resumption isn't
+// enabled or requested, or the connection is anonymous without AllowAnonymous.
+func (c *wsConnection) resumableParams(params *startMessagePayload) *resumptionParams {
+	if c.Resumption == nil || c.Resumption.Buffer == nil {
+		return nil
+	}
+	if params.Extensions.Resumption == nil || params.Extensions.Resumption.Token == "" {
+		return nil
+	}
+	if !c.Resumption.AllowAnonymous && GetIdentity(c.ctx) == "" && GetTenant(c.ctx) == "" {
+		return nil
+	}
+	return params.Extensions.Resumption
+}
+
+// bufferKey returns the key of a token in the buffer, scoped to the identity and tenant of the
+// connection. The tokens of the anonymous connections are used as is.
+func (c *wsConnection) bufferKey(token string) string {
+	identity, tenant := GetIdentity(c.ctx), GetTenant(c.ctx)
+	if identity == "" && tenant == "" {
+		return token
+	}
+	scope, _ := json.Marshal([]string{tenant, identity, token})
+	sum := sha256.Sum256(scope)
+	return hex.EncodeToString(sum[:])
+}
+
+// startResumable claims the token for the operation and sends the events buffered after the last
+// event received by the client.
+func (c *wsConnection) startResumable(ctx context.Context, id string, params *resumptionParams) *resumableOperation {
+	op := &resumableOperation{
+		token: params.Token,
+		key:   c.bufferKey(params.Token),
+		owner: GetConnectionInfo(c.ctx).ID + "/" + id,
+	}
+
+	buffer := c.Resumption.Buffer
+	c.reportResumptionError(ctx, buffer.Claim(ctx, op.key, op.owner))
+
+	if params.LastEventID == "" {
+		return op
+	}
+	events, err := buffer.After(ctx, op.key, params.LastEventID)
+	c.reportResumptionError(ctx, err)
+	for _, event := range events {
+		if err := c.sendResponse(id, withResumptionExtension(event.Payload, op.token, event.ID), nil); err != nil {
+			c.reportResumptionError(ctx, err)
+		}
+	}
+	return op
+}
+
+// bufferResponse stores a response of a resumable operation and returns the payload to send. It
+// returns false if the operation lost its token to a resumed operation and must stop.
+func (c *wsConnection) bufferResponse(ctx context.Context, op *resumableOperation, payload json.RawMessage) (json.RawMessage, bool) {
+	buffer := c.Resumption.Buffer
+	if op.detached.Load() {
+		owner, err := buffer.Owner(ctx, op.key)
+		if err != nil {
+			c.reportResumptionError(ctx, err)
+		} else if owner != op.owner {
+			return nil, false
+		}
+	}
+
+	eventID, err := buffer.Append(ctx, op.key, payload)
+	if err != nil {
+		c.reportResumptionError(ctx, err)
+		return payload, true
+	}
+	return withResumptionExtension(payload, op.token, eventID), true
+}
+
+// detach keeps the operation running without a connection for the resumption window.
+func (op *resumableOperation) detach(window time.Duration, cancel context.CancelFunc) {
+	if op.detached.CompareAndSwap(false, true) {
+		time.AfterFunc(window, cancel)
+	}
+}
+
+func (c *wsConnection) reportResumptionError(ctx context.Context, err error) {
+	if err != nil && c.ErrorFunc != nil {
+		c.ErrorFunc(ctx, err)
+	}
+}
+
+// withResumptionExtension adds extensions.resumption to a response, payloads that aren't JSON
+// objects are returned unchanged.
+func withResumptionExtension(payload json.RawMessage, token string, eventID string) json.RawMessage {
+	return withExtension(payload, "resumption", resumptionExtension{Token: token, EventID: eventID})
+}
+
+// MemoryEventBuffer is an EventBuffer for a single process. It keeps the last MaxEvents events of
+// every token, and forgets the tokens once they weren't written for TTL.
+type MemoryEventBuffer struct {
+	// MaxEvents defaults to 100
+	MaxEvents int
+	// TTL is how long the events and owner of a token are kept after the last write, it defaults
+	// to 10 minutes
+	TTL time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]*memoryTokenBuffer
+	swept  time.Time
+}
+
+type memoryTokenBuffer struct {
+	owner   string
+	nextID  int
+	events  []BufferedEvent
+	written time.Time
+}
+
+var _ EventBuffer = &MemoryEventBuffer{}
+
+const (
+	defaultMaxBufferedEvents = 100
+	defaultBufferTTL         = 10 * time.Minute
+)
+
+func (b *MemoryEventBuffer) ttl() time.Duration {
+	if b.TTL == 0 {
+		return defaultBufferTTL
+	}
+	return b.TTL
+}
+
+// lookup returns the buffer of a token, nil when it doesn't exist or expired.
+func (b *MemoryEventBuffer) lookup(token string) *memoryTokenBuffer {
+	tb := b.tokens[token]
+	if tb == nil || time.Since(tb.written) > b.ttl() {
+		return nil
+	}
+	return tb
+}
+
+// write returns the buffer of a token to write, the expired tokens are swept at most once per
+// TTL.
+func (b *MemoryEventBuffer) write(token string) *memoryTokenBuffer {
+	now := time.Now()
+	if b.tokens == nil {
+		b.tokens = map[string]*memoryTokenBuffer{}
+		b.swept = now
+	}
+	if ttl := b.ttl(); now.Sub(b.swept) > ttl {
+		for key, tb := range b.tokens {
+			if now.Sub(tb.written) > ttl {
+				delete(b.tokens, key)
+			}
+		}
+		b.swept = now
+	}
+	tb := b.lookup(token)
+	if tb == nil {
+		tb = &memoryTokenBuffer{}
+		b.tokens[token] = tb
+	}
+	tb.written = now
+	return tb
+}
+
+// Append implements EventBuffer
+func (b *MemoryEventBuffer) Append(ctx context.Context, token string, payload json.RawMessage) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	max := b.MaxEvents
+	if max == 0 {
+		max = defaultMaxBufferedEvents
+	}
+
+	tb := b.write(token)
+	tb.nextID++
+	tb.events = append(tb.events, BufferedEvent{ID: strconv.Itoa(tb.nextID), Payload: payload})
+	if len(tb.events) > max {
+		tb.events = tb.events[len(tb.events)-max:]
+	}
+	return strconv.Itoa(tb.nextID), nil
+}
+
+// After implements EventBuffer
+func (b *MemoryEventBuffer) After(ctx context.Context, token string, id string) ([]BufferedEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tb := b.lookup(token)
+	if tb == nil {
+		return nil, nil
+	}
+	after, _ := strconv.Atoi(id)
+	var events []BufferedEvent
+	for _, event := range tb.events {
+		if n, _ := strconv.Atoi(event.ID); n > after {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Claim implements EventBuffer
+func (b *MemoryEventBuffer) Claim(ctx context.Context, token string, owner string) error {
+	b.mu.Lock()
+	b.write(token).owner = owner
+	b.mu.Unlock()
+	return nil
+}
+
+// Owner implements EventBuffer
+func (b *MemoryEventBuffer) Owner(ctx context.Context, token string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if tb := b.lookup(token); tb != nil {
+		return tb.owner, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,246 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type resumptionTestService struct {
+	mu   sync.Mutex
+	subs []chan interface{}
+	ctxs []context.Context
+}
+
+func (s *resumptionTestService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payloads := make(chan interface{})
+	s.subs = append(s.subs, payloads)
+	s.ctxs = append(s.ctxs, ctx)
+	return payloads, nil
+}
+
+func (s *resumptionTestService) subscription(i int) (chan interface{}, context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subs[i], s.ctxs[i]
+}
+
+func (s *resumptionTestService) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs)
+}
+
+func subscribeResumable(t *testing.T, conn *websocket.Conn, resumption map[string]string) {
+	subscribeResumableAs(t, conn, "", resumption)
+}
+
+// subscribeResumableAs subscribes with the user sent in the init payload
+func subscribeResumableAs(t *testing.T, conn *websocket.Conn, user string, resumption map[string]string) {
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]string{"user": user}}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "subscribe",
+		"id":   "1",
+		"payload": map[string]interface{}{
+			"query":      "subscription { n }",
+			"extensions": map[string]interface{}{"resumption": resumption},
+		},
+	}))
+}
+
+func readMessageOfType(t *testing.T, conn *websocket.Conn, typ string) map[string]json.RawMessage {
+	for {
+		var m map[string]json.RawMessage
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("reading %s: %v", typ, err)
+		}
+		if string(m["type"]) == `"`+typ+`"` {
+			return m
+		}
+	}
+}
+
+// readResponse reads the next response and decodes its payload
+func readResponse(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	raw := readMessageOfType(t, conn, "next")["payload"]
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &payload))
+	return payload
+}
+
+func resumptionEventID(payload map[string]interface{}) interface{} {
+	extensions, _ := payload["extensions"].(map[string]interface{})
+	resumption, _ := extensions["resumption"].(map[string]interface{})
+	return resumption["eventId"]
+}
+
+func TestResumptionReplaysMissedEvents(t *testing.T) {
+	buffer := &MemoryEventBuffer{}
+	svc := &resumptionTestService{}
+	server := newTestServer(t, Websocket{Resumption: &Resumption{Buffer: buffer, Window: time.Second, AllowAnonymous: true}}, svc)
+
+	first := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	subscribeResumable(t, first, map[string]string{"token": "tok"})
+	assert.Eventually(t, func() bool { return svc.count() == 1 }, time.Second, 5*time.Millisecond)
+	payloads, firstCtx := svc.subscription(0)
+
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"n": 1}}
+	payload := readResponse(t, first)
+	assert.Equal(t, "1", resumptionEventID(payload))
+
+	// the operation keeps buffering once the connection is gone
+	first.Close()
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"n": 2}}
+	assert.Eventually(t, func() bool {
+		events, _ := buffer.After(context.Background(), "tok", "1")
+		return len(events) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	second := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	subscribeResumable(t, second, map[string]string{"token": "tok", "lastEventId": "1"})
+
+	payload = readResponse(t, second)
+	assert.Equal(t, "2", resumptionEventID(payload))
+	assert.Equal(t, map[string]interface{}{"n": float64(2)}, payload["data"])
+
+	// the detached operation stops once the token is claimed by the resumed one
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"n": 3}}
+	select {
+	case <-firstCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected detached operation to be cancelled")
+	}
+
+	resumed, _ := svc.subscription(1)
+	resumed <- map[string]interface{}{"data": map[string]interface{}{"n": 4}}
+	payload = readResponse(t, second)
+	assert.Equal(t, "3", resumptionEventID(payload))
+}
+
+func TestResumptionScopedToIdentity(t *testing.T) {
+	svc := &resumptionTestService{}
+	server := newTestServer(t, Websocket{
+		InitFunc: func(ctx context.Context, initPayload InitPayload) (context.Context, error) {
+			if user := initPayload.GetString("user"); user != "" {
+				ctx = WithIdentity(ctx, user)
+			}
+			return ctx, nil
+		},
+		Resumption: &Resumption{Buffer: &MemoryEventBuffer{}, Window: time.Second},
+	}, svc)
+
+	alice := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	subscribeResumableAs(t, alice, "alice", map[string]string{"token": "tok"})
+	assert.Eventually(t, func() bool { return svc.count() == 1 }, time.Second, 5*time.Millisecond)
+	payloads, aliceCtx := svc.subscription(0)
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"n": 1}}
+	assert.Equal(t, "1", resumptionEventID(readResponse(t, alice)))
+	alice.Close()
+	payloads <- map[string]interface{}{"data": map[string]interface{}{"n": 2}}
+
+	// another client using the token neither replays the events nor takes the operation over
+	mallory := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	subscribeResumableAs(t, mallory, "mallory", map[string]string{"token": "tok", "lastEventId": "0"})
+	assert.Eventually(t, func() bool { return svc.count() == 2 }, time.Second, 5*time.Millisecond)
+	other, _ := svc.subscription(1)
+	other <- map[string]interface{}{"data": map[string]interface{}{"n": 9}}
+	payload := readResponse(t, mallory)
+	assert.Equal(t, map[string]interface{}{"n": float64(9)}, payload["data"])
+	assert.Equal(t, "1", resumptionEventID(payload))
+	for n := 3; n <= 4; n++ {
+		select {
+		case payloads <- map[string]interface{}{"data": map[string]interface{}{"n": n}}:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the operation to keep running")
+		}
+	}
+	assert.NoError(t, aliceCtx.Err())
+
+	resumed := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	subscribeResumableAs(t, resumed, "alice", map[string]string{"token": "tok", "lastEventId": "1"})
+	payload = readResponse(t, resumed)
+	assert.Equal(t, "2", resumptionEventID(payload))
+	assert.Equal(t, map[string]interface{}{"n": float64(2)}, payload["data"])
+
+	// the anonymous connections don't resume without AllowAnonymous
+	anonymous := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	subscribeResumable(t, anonymous, map[string]string{"token": "tok"})
+	assert.Eventually(t, func() bool { return svc.count() == 4 }, time.Second, 5*time.Millisecond)
+	anonymousPayloads, _ := svc.subscription(3)
+	anonymousPayloads <- map[string]interface{}{"data": map[string]interface{}{"n": 1}}
+	assert.Nil(t, resumptionEventID(readResponse(t, anonymous)))
+}
+
+func TestResumptionWindowExpires(t *testing.T) {
+	svc := &resumptionTestService{}
+	server := newTestServer(t, Websocket{Resumption: &Resumption{Buffer: &MemoryEventBuffer{}, Window: 20 * time.Millisecond, AllowAnonymous: true}}, svc)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	subscribeResumable(t, conn, map[string]string{"token": "tok"})
+	assert.Eventually(t, func() bool { return svc.count() == 1 }, time.Second, 5*time.Millisecond)
+	_, ctx := svc.subscription(0)
+
+	conn.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected detached operation to be cancelled after the window")
+	}
+}
+
+func TestWithResumptionExtension(t *testing.T) {
+	payload := withResumptionExtension(json.RawMessage(`{"data":{},"extensions":{"cost":1}}`), "tok", "7")
+	assert.JSONEq(t, `{"data":{},"extensions":{"cost":1,"resumption":{"token":"tok","eventId":"7"}}}`, string(payload))
+
+	assert.Equal(t, `[1]`, string(withResumptionExtension(json.RawMessage(`[1]`), "tok", "7")))
+}
+
+func TestMemoryEventBufferRetainsMaxEvents(t *testing.T) {
+	ctx := context.Background()
+	buffer := &MemoryEventBuffer{MaxEvents: 2}
+	for i := 0; i < 3; i++ {
+		_, err := buffer.Append(ctx, "tok", json.RawMessage(`{}`))
+		assert.NoError(t, err)
+	}
+
+	events, err := buffer.After(ctx, "tok", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []BufferedEvent{{ID: "2", Payload: json.RawMessage(`{}`)}, {ID: "3", Payload: json.RawMessage(`{}`)}}, events)
+
+	assert.NoError(t, buffer.Claim(ctx, "tok", "a"))
+	owner, err := buffer.Owner(ctx, "tok")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", owner)
+}
+
+func TestMemoryEventBufferExpiresTokens(t *testing.T) {
+	ctx := context.Background()
+	buffer := &MemoryEventBuffer{TTL: 10 * time.Millisecond}
+	_, err := buffer.Append(ctx, "a", json.RawMessage(`{}`))
+	assert.NoError(t, err)
+	assert.NoError(t, buffer.Claim(ctx, "a", "owner"))
+	time.Sleep(20 * time.Millisecond)
+
+	events, err := buffer.After(ctx, "a", "")
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	owner, err := buffer.Owner(ctx, "a")
+	assert.NoError(t, err)
+	assert.Empty(t, owner)
+
+	id, err := buffer.Append(ctx, "b", json.RawMessage(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+	buffer.mu.Lock()
+	assert.Len(t, buffer.tokens, 1, "Expected the expired tokens to be swept")
+	buffer.mu.Unlock()
+}
@@ -0,0 +1,240 @@
+package transport
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+const defaultSchedulingQueueSize = 64
+
+// Priority is the class of an operation when writing to a congested connection.
+type Priority int
+
+const (
+	// PriorityLow is for the operations that can lag, e.g. analytics tickers.
+	PriorityLow Priority = iota
+	// PriorityNormal is the priority of the operations by default.
+	PriorityNormal
+	// PriorityHigh is for the operations that must not lag, e.g. alerts.
+	PriorityHigh
+
+	priorityClasses = 3
+)
+
+// String implements fmt.Stringer
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// defaultPriorityWeights are the number of messages written for every class per round.
+var defaultPriorityWeights = map[Priority]int{PriorityLow: 1, PriorityNormal: 4, PriorityHigh: 16}
+
+// WriteScheduling queues the messages of the operations of a connection by priority, and writes
+// them in weighted rounds: every round writes up to the weight of every class, the high priority
+// ones first. The messages of an operation keep their order.
+//
+// The priority of an operation is returned by the PriorityFunc, or set with a
+// @priority(level: HIGH) directive on the operation, LOW, NORMAL and HIGH being the levels.
+type WriteScheduling struct {
+	// Weights are the number of messages written for every priority per round, they default to 1
+	// for PriorityLow, 4 for PriorityNormal and 16 for PriorityHigh.
+	Weights map[Priority]int
+	// QueueSize is the number of messages queued for every priority before the operations wait
+	// for the connection, it defaults to 64.
+	QueueSize int
+	// PriorityFunc returns the priority of an operation, it overrides the directive when set.
+	PriorityFunc func(ctx context.Context, op *OperationInfo) Priority
+}
+
+// priority returns the priority of an operation.
+func (s *WriteScheduling) priority(ctx context.Context, op *OperationInfo) Priority {
+	if s.PriorityFunc != nil {
+		return clampPriority(s.PriorityFunc(ctx, op))
+	}
+	return directivePriority(op.Query, op.Name)
+}
+
+func clampPriority(p Priority) Priority {
+	switch {
+	case p < PriorityLow:
+		return PriorityLow
+	case p > PriorityHigh:
+		return PriorityHigh
+	}
+	return p
+}
+
+// directivePriority returns the priority set by the @priority directive of the operation.
+func directivePriority(query string, operationName string) Priority {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return PriorityNormal
+	}
+	var op *ast.OperationDefinition
+	if operationName != "" {
+		op = doc.Operations.ForName(operationName)
+	} else if len(doc.Operations) == 1 {
+		op = doc.Operations[0]
+	}
+	if op == nil {
+		return PriorityNormal
+	}
+	directive := op.Directives.ForName("priority")
+	if directive == nil {
+		return PriorityNormal
+	}
+	level := directive.Arguments.ForName("level")
+	if level == nil || level.Value == nil {
+		return PriorityNormal
+	}
+	switch strings.ToUpper(level.Value.Raw) {
+	case "LOW":
+		return PriorityLow
+	case "HIGH":
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// writeScheduler writes the messages of the operations of a connection from a goroutine, by
+// priority.
+type writeScheduler struct {
+	c         *wsConnection
+	weights   [priorityClasses]int
+	queueSize int
+
+	mu         sync.Mutex
+	queues     [priorityClasses][]*message
+	priorities map[string]Priority
+	// ready is signalled when a message is queued or the scheduler is closed, space when
+	// messages are dequeued
+	ready  *sync.Cond
+	space  *sync.Cond
+	closed bool
+}
+
+func newWriteScheduler(c *wsConnection) *writeScheduler {
+	s := &writeScheduler{
+		c:          c,
+		queueSize:  c.WriteScheduling.QueueSize,
+		priorities: map[string]Priority{},
+	}
+	if s.queueSize <= 0 {
+		s.queueSize = defaultSchedulingQueueSize
+	}
+	for p := PriorityLow; p <= PriorityHigh; p++ {
+		weight, ok := c.WriteScheduling.Weights[p]
+		if !ok || weight <= 0 {
+			weight = defaultPriorityWeights[p]
+		}
+		s.weights[p] = weight
+	}
+	s.ready = sync.NewCond(&s.mu)
+	s.space = sync.NewCond(&s.mu)
+	go s.run()
+	return s
+}
+
+// register sets the priority of the messages of an operation.
+func (s *writeScheduler) register(id string, p Priority) {
+	s.mu.Lock()
+	s.priorities[id] = p
+	s.mu.Unlock()
+}
+
+// forget drops the priority of an ended operation, its queued messages keep it.
+func (s *writeScheduler) forget(id string) {
+	s.mu.Lock()
+	delete(s.priorities, id)
+	s.mu.Unlock()
+}
+
+// write queues a message, it waits while the queue of its priority is full.
+func (s *writeScheduler) write(msg *message) {
+	// the payload may live in a pooled buffer, it must outlive the call
+	queued := *msg
+	queued.payload = append([]byte(nil), msg.payload...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.priorities[msg.id]
+	if !ok {
+		p = PriorityNormal
+	}
+	for !s.closed && len(s.queues[p]) >= s.queueSize {
+		s.space.Wait()
+	}
+	if s.closed {
+		return
+	}
+	s.queues[p] = append(s.queues[p], &queued)
+	s.ready.Signal()
+}
+
+// depth returns the number of queued messages.
+func (s *writeScheduler) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depthLocked()
+}
+
+func (s *writeScheduler) run() {
+	for {
+		s.mu.Lock()
+		for !s.closed && s.depthLocked() == 0 {
+			s.ready.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		round := s.nextRoundLocked()
+		s.space.Broadcast()
+		s.mu.Unlock()
+
+		for _, msg := range round {
+			s.c.writeOut(msg)
+		}
+	}
+}
+
+// nextRoundLocked dequeues up to the weight of every priority, the high priority messages first.
+func (s *writeScheduler) nextRoundLocked() []*message {
+	var round []*message
+	for p := PriorityHigh; p >= PriorityLow; p-- {
+		n := min(s.weights[p], len(s.queues[p]))
+		round = append(round, s.queues[p][:n]...)
+		s.queues[p] = s.queues[p][n:]
+	}
+	return round
+}
+
+func (s *writeScheduler) depthLocked() int {
+	n := 0
+	for _, queue := range s.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// close stops the scheduler, the queued messages are dropped: writing them would delay the close
+// of a congested connection.
+func (s *writeScheduler) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.queues = [priorityClasses][]*message{}
+	s.ready.Broadcast()
+	s.space.Broadcast()
+	s.mu.Unlock()
+}
@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectivePriority(t *testing.T) {
+	tests := []struct {
+		query         string
+		operationName string
+		want          Priority
+	}{
+		{"subscription @priority(level: HIGH) { alerts }", "", PriorityHigh},
+		{"subscription Ticker @priority(level: LOW) { ticker }", "", PriorityLow},
+		{"subscription { value }", "", PriorityNormal},
+		{"subscription @priority(level: URGENT) { value }", "", PriorityNormal},
+		{"subscription A @priority(level: LOW) { a } subscription B @priority(level: HIGH) { b }", "B", PriorityHigh},
+		{"subscription A @priority(level: LOW) { a } subscription B { b }", "", PriorityNormal},
+		{"subscription {", "", PriorityNormal},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, directivePriority(tt.query, tt.operationName), tt.query)
+	}
+}
+
+func TestWriteSchedulerRounds(t *testing.T) {
+	s := &writeScheduler{weights: [priorityClasses]int{PriorityLow: 1, PriorityNormal: 2, PriorityHigh: 3}}
+	for i := 0; i < 4; i++ {
+		s.queues[PriorityLow] = append(s.queues[PriorityLow], &message{id: "low"})
+		s.queues[PriorityNormal] = append(s.queues[PriorityNormal], &message{id: "normal"})
+		s.queues[PriorityHigh] = append(s.queues[PriorityHigh], &message{id: "high"})
+	}
+
+	ids := func(round []*message) []string {
+		var ids []string
+		for _, msg := range round {
+			ids = append(ids, msg.id)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"high", "high", "high", "normal", "normal", "low"}, ids(s.nextRoundLocked()))
+	assert.Equal(t, []string{"high", "normal", "normal", "low"}, ids(s.nextRoundLocked()))
+	assert.Equal(t, []string{"low"}, ids(s.nextRoundLocked()))
+	assert.Equal(t, 1, s.depthLocked())
+}
+
+func TestWriteScheduling(t *testing.T) {
+	priorities := make(chan Priority, 2)
+	server := newTestServer(t, Websocket{
+		WriteScheduling: &WriteScheduling{},
+		SubscribeFunc: func(ctx context.Context, op *OperationInfo) (context.Context, error) {
+			priorities <- GetOperationInfo(ctx).Priority
+			return ctx, nil
+		},
+	}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 2)
+			payloads <- map[string]interface{}{"n": 1}
+			payloads <- map[string]interface{}{"n": 2}
+			close(payloads)
+			return payloads, nil
+		},
+	})
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription @priority(level: HIGH) { alerts }"}}))
+	assert.Equal(t, PriorityHigh, <-priorities)
+	for _, payload := range []string{`{"n":1}`, `{"n":2}`} {
+		next := readMessageOfType(t, conn, "next")
+		assert.JSONEq(t, payload, string(next["payload"]))
+	}
+	readMessageOfType(t, conn, "complete")
+}
+
+func TestWriteSchedulingPriorityFunc(t *testing.T) {
+	scheduling := &WriteScheduling{PriorityFunc: func(ctx context.Context, op *OperationInfo) Priority {
+		return 10
+	}}
+	op := &OperationInfo{Query: "subscription @priority(level: LOW) { value }"}
+	assert.Equal(t, PriorityHigh, scheduling.priority(context.Background(), op))
+	assert.Equal(t, PriorityLow, (&WriteScheduling{}).priority(context.Background(), op))
+}
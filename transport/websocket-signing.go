@@ -0,0 +1,387 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// signatureExtension is the extension of the payloads holding their detached JWS.
+const signatureExtension = "signature"
+
+var (
+	// ErrPayloadUnsigned is returned by VerifyPayload for the payloads without signature.
+	ErrPayloadUnsigned = errors.New("payload not signed")
+	// ErrInvalidSignature is returned by VerifyPayload for the payloads whose signature doesn't
+	// match.
+	ErrInvalidSignature = errors.New("invalid payload signature")
+	// ErrUnknownSigningKey is returned by the SigningKeyProviders for the unknown key ids.
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+	// ErrUnsignablePayload is returned for the payloads that aren't JSON objects, or whose numbers
+	// aren't finite doubles, the operation sending them fails instead of sending them unsigned.
+	ErrUnsignablePayload = errors.New("payload can't be signed")
+)
+
+// SigningKey signs the payloads and verifies their signature, it is identified by its ID in the
+// JWS headers.
+type SigningKey interface {
+	ID() string
+	// Algorithm is the JWS algorithm of the key, e.g. "HS256" or "EdDSA".
+	Algorithm() string
+	Sign(input []byte) ([]byte, error)
+	Verify(input []byte, signature []byte) error
+}
+
+// SigningKeyProvider provides the key signing the payloads, and the keys verifying them, so that
+// the keys are rotated without invalidating the payloads already signed, e.g. RotatingKeys.
+type SigningKeyProvider interface {
+	// SigningKey returns the key signing the payloads.
+	SigningKey(ctx context.Context) (SigningKey, error)
+	// VerificationKey returns the key of an id, or ErrUnknownSigningKey.
+	VerificationKey(ctx context.Context, id string) (SigningKey, error)
+}
+
+// PayloadSigning signs the payloads of the data/next messages, so that the consumers verify that
+// the events were sent by the server even once stored or relayed, see VerifyPayload. The
+// signature is a detached JWS in the "signature" extension of the payloads, whose content is the
+// payload without the signature in the JSON canonicalization scheme of RFC 8785, so that the
+// consumers decoding and encoding the payloads again still verify them.
+type PayloadSigning struct {
+	Keys SigningKeyProvider
+}
+
+// signPayload sets the signature extension of a payload, ErrUnsignablePayload is returned for the
+// payloads that can't be canonicalized.
+func (s *PayloadSigning) signPayload(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+	content, err := canonicalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.Keys.SigningKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}{key.Algorithm(), key.ID()})
+	if err != nil {
+		return nil, err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+	signature, err := key.Sign(signingInput(encodedHeader, content))
+	if err != nil {
+		return nil, err
+	}
+	return withExtension(content, signatureExtension, encodedHeader+".."+base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
+// VerifyPayload verifies the signature of a payload signed by a PayloadSigning with one of the
+// keys of the provider.
+func VerifyPayload(ctx context.Context, payload []byte, keys SigningKeyProvider) error {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &response); err != nil {
+		return err
+	}
+	var extensions map[string]json.RawMessage
+	_ = json.Unmarshal(response["extensions"], &extensions)
+	var jws string
+	if err := json.Unmarshal(extensions[signatureExtension], &jws); err != nil || jws == "" {
+		return ErrPayloadUnsigned
+	}
+
+	encodedHeader, signature, ok := strings.Cut(jws, "..")
+	if !ok {
+		return ErrInvalidSignature
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+	if err != nil || json.Unmarshal(b, &header) != nil {
+		return ErrInvalidSignature
+	}
+	key, err := keys.VerificationKey(ctx, header.KeyID)
+	if err != nil {
+		return err
+	}
+	if key.Algorithm() != header.Algorithm {
+		return ErrInvalidSignature
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	content, err := canonicalPayload(payload)
+	if err != nil {
+		return err
+	}
+	return key.Verify(signingInput(encodedHeader, content), decoded)
+}
+
+// canonicalPayload returns a payload without signature in the JSON canonicalization scheme of
+// RFC 8785: the members of its objects sorted by their UTF-16 code units, the strings escaped
+// minimally and the numbers written as ECMAScript does.
+func canonicalPayload(payload json.RawMessage) (json.RawMessage, error) {
+	var response map[string]interface{}
+	if err := jsonDecode(payload, &response); err != nil || response == nil {
+		return nil, ErrUnsignablePayload
+	}
+	if extensions, ok := response["extensions"].(map[string]interface{}); ok {
+		delete(extensions, signatureExtension)
+		if len(extensions) == 0 {
+			delete(response, "extensions")
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, response); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonical writes a value decoded with UseNumber in the JSON canonicalization scheme.
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case string:
+		writeCanonicalString(buf, v)
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return ErrUnsignablePayload
+		}
+		buf.WriteString(canonicalNumber(f))
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return ErrUnsignablePayload
+	}
+	return nil
+}
+
+// writeCanonicalString only escapes the quotes, the backslashes and the control characters.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// canonicalNumber formats a finite double as the Number.prototype.toString of ECMAScript.
+func canonicalNumber(f float64) string {
+	if f == 0 {
+		return "0"
+	}
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	sign, digits := exponent[:1], strings.TrimLeft(exponent[1:], "0")
+	return mantissa + "e" + sign + digits
+}
+
+// lessUTF16 compares two strings by their UTF-16 code units.
+func lessUTF16(a string, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+func signingInput(encodedHeader string, content []byte) []byte {
+	return []byte(encodedHeader + "." + base64.RawURLEncoding.EncodeToString(content))
+}
+
+// NewHMACSigningKey returns a SigningKey signing with HMAC SHA-256, for the consumers sharing the
+// secret.
+func NewHMACSigningKey(id string, secret []byte) SigningKey {
+	return hmacSigningKey{id: id, secret: secret}
+}
+
+type hmacSigningKey struct {
+	id     string
+	secret []byte
+}
+
+func (k hmacSigningKey) ID() string        { return k.id }
+func (k hmacSigningKey) Algorithm() string { return "HS256" }
+
+func (k hmacSigningKey) Sign(input []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil), nil
+}
+
+func (k hmacSigningKey) Verify(input []byte, signature []byte) error {
+	expected, _ := k.Sign(input)
+	if !hmac.Equal(expected, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// NewEd25519SigningKey returns a SigningKey signing with Ed25519. The consumers verify the
+// payloads with the key returned by NewEd25519VerificationKey from the public key.
+func NewEd25519SigningKey(id string, key ed25519.PrivateKey) SigningKey {
+	return ed25519SigningKey{id: id, private: key, public: key.Public().(ed25519.PublicKey)}
+}
+
+// NewEd25519VerificationKey returns a SigningKey verifying the Ed25519 signatures, it can't sign.
+func NewEd25519VerificationKey(id string, key ed25519.PublicKey) SigningKey {
+	return ed25519SigningKey{id: id, public: key}
+}
+
+type ed25519SigningKey struct {
+	id      string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func (k ed25519SigningKey) ID() string        { return k.id }
+func (k ed25519SigningKey) Algorithm() string { return "EdDSA" }
+
+func (k ed25519SigningKey) Sign(input []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", k.id)
+	}
+	return ed25519.Sign(k.private, input), nil
+}
+
+func (k ed25519SigningKey) Verify(input []byte, signature []byte) error {
+	if !ed25519.Verify(k.public, input, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// RotatingKeys is a SigningKeyProvider signing with its current key, and verifying with the
+// current key and the previous ones, until they are rotated out.
+type RotatingKeys struct {
+	// MaxPrevious is the number of previous keys kept to verify the payloads, it defaults to 1.
+	MaxPrevious int
+
+	mu       sync.RWMutex
+	current  SigningKey
+	previous []SigningKey
+}
+
+var _ SigningKeyProvider = &RotatingKeys{}
+
+// NewRotatingKeys returns RotatingKeys signing with current.
+func NewRotatingKeys(current SigningKey) *RotatingKeys {
+	return &RotatingKeys{current: current}
+}
+
+// Rotate signs the following payloads with key, the current key is kept to verify the payloads
+// already signed.
+func (k *RotatingKeys) Rotate(key SigningKey) {
+	maxPrevious := k.MaxPrevious
+	if maxPrevious <= 0 {
+		maxPrevious = 1
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.current != nil {
+		k.previous = append([]SigningKey{k.current}, k.previous...)
+	}
+	if len(k.previous) > maxPrevious {
+		k.previous = k.previous[:maxPrevious]
+	}
+	k.current = key
+}
+
+// SigningKey implements SigningKeyProvider
+func (k *RotatingKeys) SigningKey(ctx context.Context) (SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.current == nil {
+		return nil, ErrUnknownSigningKey
+	}
+	return k.current, nil
+}
+
+// VerificationKey implements SigningKeyProvider
+func (k *RotatingKeys) VerificationKey(ctx context.Context, id string) (SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.current != nil && k.current.ID() == id {
+		return k.current, nil
+	}
+	for _, key := range k.previous {
+		if key.ID() == id {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownSigningKey
+}
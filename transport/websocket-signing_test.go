@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignPayload(t *testing.T) {
+	ctx := context.Background()
+	keys := NewRotatingKeys(NewHMACSigningKey("k1", []byte("secret")))
+	s := &PayloadSigning{Keys: keys}
+
+	signed, err := s.signPayload(ctx, json.RawMessage(`{"data": {"b": 1, "a": "<x>"}, "extensions": {"sequence": 2}}`))
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyPayload(ctx, signed, keys))
+
+	// the payloads are verified once decoded and encoded again, or indented
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(signed, &decoded))
+	reencoded, err := json.MarshalIndent(decoded, "", "  ")
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyPayload(ctx, reencoded, keys))
+
+	// or encoded with the HTML escaping and the numbers of json.Marshal
+	signed, err = s.signPayload(ctx, json.RawMessage(`{"data": {"html": "<a href=\"x\">&</a>", "price": 1.50, "big": 1E3}}`))
+	assert.NoError(t, err)
+	decoded = nil
+	assert.NoError(t, json.Unmarshal(signed, &decoded))
+	reencoded, err = json.Marshal(decoded)
+	assert.NoError(t, err)
+	assert.Contains(t, string(reencoded), `\u003ca`)
+	assert.NoError(t, VerifyPayload(ctx, reencoded, keys))
+
+	tampered := withExtension(signed, "sequence", 3)
+	assert.ErrorIs(t, VerifyPayload(ctx, tampered, keys), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifyPayload(ctx, []byte(`{"data":{}}`), keys), ErrPayloadUnsigned)
+
+	// the payloads signed with the previous key are verified until it is rotated out
+	keys.Rotate(NewHMACSigningKey("k2", []byte("other")))
+	assert.NoError(t, VerifyPayload(ctx, signed, keys))
+	rotated, err := s.signPayload(ctx, json.RawMessage(`{"data":{}}`))
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyPayload(ctx, rotated, keys))
+	keys.Rotate(NewHMACSigningKey("k3", []byte("third")))
+	assert.ErrorIs(t, VerifyPayload(ctx, signed, keys), ErrUnknownSigningKey)
+	assert.NoError(t, VerifyPayload(ctx, rotated, keys))
+}
+
+func TestSignPayloadUnsignable(t *testing.T) {
+	s := &PayloadSigning{Keys: NewRotatingKeys(NewHMACSigningKey("k1", []byte("secret")))}
+	for _, payload := range []string{`[{"data":{}}]`, `"data"`, `null`, `{"data":{"v":1e400}}`, `not json`} {
+		_, err := s.signPayload(context.Background(), json.RawMessage(payload))
+		assert.ErrorIs(t, err, ErrUnsignablePayload, payload)
+	}
+}
+
+func TestCanonicalPayload(t *testing.T) {
+	for payload, expected := range map[string]string{
+		// the members are sorted by their UTF-16 code units
+		`{"\u20ac":1,"\r":2,"\ufb33":3,"1":4,"\ud83d\ude00":5,"\u0080":6,"\u00f6":7}`: "{\"\\r\":2,\"1\":4,\"\u0080\":6,\"\u00f6\":7,\"\u20ac\":1,\"\U0001f600\":5,\"\ufb33\":3}",
+		// the numbers are written as ECMAScript does
+		`{"n":[0,-0,4.50,2e-3,1e-7,0.000001,1E30,-1e+21,100000000000000000000,333333333.33333329]}`: `{"n":[0,0,4.5,0.002,1e-7,0.000001,1e+30,-1e+21,100000000000000000000,333333333.3333333]}`,
+		// the strings are escaped minimally, and the signature is removed
+		`{"s":"<\u0026>\u2028\u001f\/\t","extensions":{"signature":"x"}}`: "{\"s\":\"<&>\u2028\\u001f/\\t\"}",
+		`{"extensions":{"signature":"x","sequence":1},"data":null}`:       `{"data":null,"extensions":{"sequence":1}}`,
+	} {
+		content, err := canonicalPayload(json.RawMessage(payload))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(content), payload)
+	}
+}
+
+func TestEd25519SigningKey(t *testing.T) {
+	ctx := context.Background()
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	signed, err := (&PayloadSigning{Keys: NewRotatingKeys(NewEd25519SigningKey("ed", private))}).signPayload(ctx, json.RawMessage(`{"data":{"v":1}}`))
+	assert.NoError(t, err)
+	verification := NewRotatingKeys(NewEd25519VerificationKey("ed", public))
+	assert.NoError(t, VerifyPayload(ctx, signed, verification))
+
+	_, err = NewEd25519VerificationKey("ed", public).Sign([]byte("x"))
+	assert.Error(t, err)
+}
+
+func TestSubscribeSignsPayloads(t *testing.T) {
+	keys := NewRotatingKeys(NewHMACSigningKey("k1", []byte("secret")))
+	server := newTestServer(t, Websocket{PayloadSigning: &PayloadSigning{Keys: keys}}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			payloads := make(chan interface{}, 1)
+			payloads <- NewSharedPayload(map[string]interface{}{"data": map[string]interface{}{"value": 1}})
+			return payloads, nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+
+	payload := readMessageOfType(t, conn, "next")["payload"]
+	assert.Contains(t, string(payload), `"signature":"`)
+	assert.NoError(t, VerifyPayload(context.Background(), payload, keys))
+}
@@ -0,0 +1,262 @@
+package transport
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// closeSlowConsumer is sent to the connections closed by a SlowConsumer policy.
+const closeSlowConsumer = 4008
+
+const (
+	defaultSlowConsumerSustain        = 5 * time.Second
+	defaultSlowConsumerSampleInterval = time.Second
+)
+
+// CloseReasonSlowConsumer closes the connections not keeping up with their messages.
+var CloseReasonSlowConsumer = CloseReason{Code: closeSlowConsumer, Reason: "slow consumer"}
+
+// errSlowConsumer is sent to the operations shed by a SlowConsumer policy.
+var errSlowConsumer = &gqlerror.Error{Message: "slow consumer", Extensions: map[string]interface{}{"code": "SLOW_CONSUMER"}}
+
+// SlowConsumerAction tells what happens to the slow consumers.
+type SlowConsumerAction int
+
+const (
+	// SlowConsumerShed ends the lowest priority operation of the connection with a "slow consumer"
+	// error every time it is detected, and closes it once no operation is left. A connection whose
+	// write stayed blocked for Sustain, e.g. of a client that stopped reading, is closed right
+	// away since its operations can't be ended while the write holds the connection.
+	SlowConsumerShed SlowConsumerAction = iota
+	// SlowConsumerClose closes the connection with 4008.
+	SlowConsumerClose
+)
+
+// SlowConsumerSample is the state of a connection detected as a slow consumer.
+type SlowConsumerSample struct {
+	ConnectionID string
+	// WriteLatency is the longest write since the previous sample, including the write in
+	// progress.
+	WriteLatency time.Duration
+	// QueueDepth is the number of messages waiting for the WriteScheduling.
+	QueueDepth int
+	// Since is when the connection started exceeding the thresholds.
+	Since time.Time
+}
+
+// SlowConsumerStats counts the slow consumers of a SlowConsumer policy, e.g. to export metrics.
+type SlowConsumerStats struct {
+	// Detections is the number of times a connection exceeded the thresholds for Sustain.
+	Detections int64
+	// Shed is the number of operations ended by the SlowConsumerShed action.
+	Shed int64
+	// Closed is the number of connections closed as slow consumers.
+	Closed int64
+}
+
+// SlowConsumer detects the connections not keeping up with their messages, e.g. clients on a
+// congested network, so that they don't hold the memory and the goroutines of the server. A
+// connection is a slow consumer when one of its samples exceeds a threshold for Sustain.
+type SlowConsumer struct {
+	// MaxWriteLatency is the longest a write may take, it isn't checked when zero.
+	MaxWriteLatency time.Duration
+	// MaxQueueDepth is the number of messages that may wait for the WriteScheduling, it isn't
+	// checked when zero or without a WriteScheduling.
+	MaxQueueDepth int
+	// Sustain is how long the thresholds are exceeded before acting, it defaults to 5 seconds.
+	Sustain time.Duration
+	// SampleInterval is the interval of the samples of every connection, it defaults to 1 second.
+	SampleInterval time.Duration
+	// Action is what happens to the slow consumers.
+	Action SlowConsumerAction
+
+	// DetectedFunc is called with the sample of the slow consumers before acting.
+	DetectedFunc func(ctx context.Context, sample SlowConsumerSample)
+	// ShedFunc is called with the operations ended by the SlowConsumerShed action.
+	ShedFunc func(ctx context.Context, op *OperationInfo)
+
+	detections atomic.Int64
+	shed       atomic.Int64
+	closed     atomic.Int64
+}
+
+// Stats returns the counters of the policy.
+func (s *SlowConsumer) Stats() SlowConsumerStats {
+	return SlowConsumerStats{
+		Detections: s.detections.Load(),
+		Shed:       s.shed.Load(),
+		Closed:     s.closed.Load(),
+	}
+}
+
+func (s *SlowConsumer) sustain() time.Duration {
+	if s.Sustain == 0 {
+		return defaultSlowConsumerSustain
+	}
+	return s.Sustain
+}
+
+func (s *SlowConsumer) sampleInterval() time.Duration {
+	if s.SampleInterval == 0 {
+		return defaultSlowConsumerSampleInterval
+	}
+	return s.SampleInterval
+}
+
+// slowConsumerMonitor samples a connection.
+type slowConsumerMonitor struct {
+	// maxLatency is the longest write since the previous sample, in nanoseconds
+	maxLatency atomic.Int64
+	// writing is the start of the write in progress in unix nanoseconds, zero without write
+	writing atomic.Int64
+	// shed are the operations ended by the monitor, guarded by the mutex of the connection
+	shed map[string]bool
+}
+
+// startWrite records the start of a write, so that the samples see the writes that don't return,
+// it returns the start to pass to observeWrite.
+func (m *slowConsumerMonitor) startWrite() time.Time {
+	start := time.Now()
+	m.writing.Store(start.UnixNano())
+	return start
+}
+
+// observeWrite records the latency of a write started at start.
+func (m *slowConsumerMonitor) observeWrite(start time.Time) {
+	m.writing.Store(0)
+	latency := int64(time.Since(start))
+	for {
+		current := m.maxLatency.Load()
+		if latency <= current || m.maxLatency.CompareAndSwap(current, latency) {
+			return
+		}
+	}
+}
+
+// monitorSlowConsumer samples the connection until the returned function is called.
+func (c *wsConnection) monitorSlowConsumer() (stop func()) {
+	c.slowConsumer = &slowConsumerMonitor{shed: map[string]bool{}}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.SlowConsumer.sampleInterval())
+		defer ticker.Stop()
+
+		var since time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				sample, blocked, slow := c.sampleSlowConsumer()
+				switch {
+				case !slow:
+					since = time.Time{}
+				case since.IsZero():
+					since = now
+				}
+				if !slow || now.Sub(since) < c.SlowConsumer.sustain() {
+					continue
+				}
+				sample.Since = since
+				since = time.Time{}
+				if !c.evictSlowConsumer(sample, blocked) {
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// sampleSlowConsumer returns the sample of the connection, how long its write in progress has been
+// blocked, and true if it exceeds a threshold.
+func (c *wsConnection) sampleSlowConsumer() (SlowConsumerSample, time.Duration, bool) {
+	sample := SlowConsumerSample{
+		ConnectionID: GetConnectionInfo(c.ctx).ID,
+		WriteLatency: time.Duration(c.slowConsumer.maxLatency.Swap(0)),
+	}
+	var blocked time.Duration
+	if start := c.slowConsumer.writing.Load(); start != 0 {
+		blocked = time.Since(time.Unix(0, start))
+		sample.WriteLatency = max(sample.WriteLatency, blocked)
+	}
+	if c.scheduler != nil {
+		sample.QueueDepth = c.scheduler.depth()
+	}
+	s := c.SlowConsumer
+	slow := (s.MaxWriteLatency > 0 && sample.WriteLatency > s.MaxWriteLatency) ||
+		(s.MaxQueueDepth > 0 && sample.QueueDepth > s.MaxQueueDepth)
+	return sample, blocked, slow
+}
+
+// evictSlowConsumer applies the action of the policy, it returns false once the connection is
+// closed. The connection is closed when its write in progress is blocked for Sustain, the
+// operations can't be shed while the write holds the connection.
+func (c *wsConnection) evictSlowConsumer(sample SlowConsumerSample, blocked time.Duration) bool {
+	s := c.SlowConsumer
+	s.detections.Add(1)
+	if s.DetectedFunc != nil {
+		s.DetectedFunc(c.ctx, sample)
+	}
+
+	if s.Action == SlowConsumerShed && blocked < s.sustain() {
+		// the shed waits for the write in progress, which may get stuck meanwhile
+		shed := make(chan *OperationInfo, 1)
+		go func() { shed <- c.shedOperation() }()
+		select {
+		case op := <-shed:
+			if op != nil {
+				if s.ShedFunc != nil {
+					s.ShedFunc(c.ctx, op)
+				}
+				return true
+			}
+		case <-time.After(s.sustain() - blocked):
+		}
+	}
+	s.closed.Add(1)
+	c.closeWithReason(CloseReasonSlowConsumer)
+	return false
+}
+
+// shedOperation ends the active operation with the lowest priority, the last one by id among
+// the operations of the same priority, and returns it, or nil if there is none.
+func (c *wsConnection) shedOperation() *OperationInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing.Load() {
+		return nil
+	}
+
+	var shed *OperationInfo
+	for id, op := range c.operations {
+		if c.slowConsumer.shed[id] || c.active[id] == nil {
+			continue
+		}
+		if shed == nil || op.Priority < shed.Priority || (op.Priority == shed.Priority && op.ID > shed.ID) {
+			shed = op
+		}
+	}
+	if shed == nil {
+		return nil
+	}
+	c.slowConsumer.shed[shed.ID] = true
+	c.SlowConsumer.shed.Add(1)
+	if cancel := c.active[shed.ID]; cancel != nil {
+		cancel()
+	}
+	return shed
+}
+
+// wasShed returns true if the operation was ended by the SlowConsumer policy.
+func (c *wsConnection) wasShed(id string) bool {
+	if c.slowConsumer == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.slowConsumer.shed[id]
+}
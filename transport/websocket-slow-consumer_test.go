@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSlowConsumerTestServer serves the transport with small socket buffers, so that the writes
+// to a client not keeping up block right away.
+func newSlowConsumerTestServer(t *testing.T, wsHandler Websocket, service GraphQLService) *httptest.Server {
+	t.Helper()
+	wsHandler.Upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsHandler.Do(w, r, service)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if tcp, ok := conn.(*net.TCPConn); ok && state == http.StateNew {
+			_ = tcp.SetWriteBuffer(16 << 10)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// slowReader reads its connection at most 8KB at a time every millisecond.
+type slowReader struct {
+	net.Conn
+}
+
+func (c slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return c.Conn.Read(p[:min(len(p), 8<<10)])
+}
+
+// dialSlowReader dials a client reading its connection slowly.
+func dialSlowReader(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{
+		Subprotocols: []string{graphqltransportwsSubprotocol},
+		NetDialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			_ = conn.(*net.TCPConn).SetReadBuffer(64 << 10)
+			return slowReader{conn}, nil
+		},
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dialing error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestSlowConsumerClose(t *testing.T) {
+	var mu sync.Mutex
+	var samples []SlowConsumerSample
+	var sent, ended atomic.Int64
+	policy := &SlowConsumer{
+		MaxWriteLatency: 50 * time.Millisecond,
+		Sustain:         100 * time.Millisecond,
+		SampleInterval:  20 * time.Millisecond,
+		Action:          SlowConsumerClose,
+		DetectedFunc: func(ctx context.Context, sample SlowConsumerSample) {
+			mu.Lock()
+			samples = append(samples, sample)
+			mu.Unlock()
+		},
+	}
+	server := newSlowConsumerTestServer(t, Websocket{SlowConsumer: policy}, floodingService{&sent, &ended}.service())
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { tick }"}}))
+
+	// the client never reads, its write stays blocked until the connection is closed
+	assert.Eventually(t, func() bool { return ended.Load() == 1 }, 3*time.Second, 5*time.Millisecond, "Expected the operation to end")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, samples, 1) {
+		assert.Greater(t, samples[0].WriteLatency, 50*time.Millisecond)
+		assert.NotEmpty(t, samples[0].ConnectionID)
+	}
+	assert.Equal(t, SlowConsumerStats{Detections: 1, Closed: 1}, policy.Stats())
+}
+
+func TestSlowConsumerShedClosesBlockedWrites(t *testing.T) {
+	var sent, ended atomic.Int64
+	policy := &SlowConsumer{MaxWriteLatency: 20 * time.Millisecond, Sustain: 100 * time.Millisecond, SampleInterval: 20 * time.Millisecond}
+	server := newSlowConsumerTestServer(t, Websocket{SlowConsumer: policy}, floodingService{&sent, &ended}.service())
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	for _, id := range []string{"1", "2"} {
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": id, "payload": map[string]string{"query": "subscription { tick }"}}))
+	}
+
+	// the operations can't be shed while the write holds the connection, it is closed instead
+	assert.Eventually(t, func() bool { return ended.Load() == 2 }, 3*time.Second, 5*time.Millisecond, "Expected the operations to end")
+	assert.Equal(t, SlowConsumerStats{Detections: 1, Closed: 1}, policy.Stats())
+}
+
+func TestSlowConsumerShed(t *testing.T) {
+	var mu sync.Mutex
+	var shed []string
+	var sent, ended atomic.Int64
+	policy := &SlowConsumer{
+		MaxWriteLatency: 5 * time.Millisecond,
+		Sustain:         500 * time.Millisecond,
+		SampleInterval:  20 * time.Millisecond,
+		ShedFunc: func(ctx context.Context, op *OperationInfo) {
+			mu.Lock()
+			shed = append(shed, op.ID)
+			mu.Unlock()
+		},
+	}
+	server := newSlowConsumerTestServer(t, Websocket{SlowConsumer: policy, WriteScheduling: &WriteScheduling{}}, floodingService{&sent, &ended}.service())
+	conn := dialSlowReader(t, server)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "alerts", "payload": map[string]string{"query": "subscription @priority(level: HIGH) { tick }"}}))
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "ticker", "payload": map[string]string{"query": "subscription @priority(level: LOW) { tick }"}}))
+
+	// the low priority operation is shed first, the connection is closed once every operation is
+	// shed
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if assert.ErrorAs(t, err, &closeErr) {
+		assert.Equal(t, CloseReasonSlowConsumer.Code, closeErr.Code)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"ticker", "alerts"}, shed)
+	assert.Equal(t, SlowConsumerStats{Detections: 3, Shed: 2, Closed: 1}, policy.Stats())
+}
+
+func TestSlowConsumerShedError(t *testing.T) {
+	var sent, ended atomic.Int64
+	policy := &SlowConsumer{MaxWriteLatency: 5 * time.Millisecond, Sustain: 500 * time.Millisecond, SampleInterval: 20 * time.Millisecond}
+	server := newSlowConsumerTestServer(t, Websocket{SlowConsumer: policy}, floodingService{&sent, &ended}.service())
+	conn := dialSlowReader(t, server)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]string{"query": "subscription { tick }"}}))
+
+	errMsg := readMessageOfType(t, conn, "error")
+	assert.JSONEq(t, `"1"`, string(errMsg["id"]))
+	assert.JSONEq(t, `[{"message":"slow consumer","extensions":{"code":"SLOW_CONSUMER"}}]`, string(errMsg["payload"]))
+	assert.Equal(t, int64(1), policy.Stats().Shed)
+}
+
+func TestSlowConsumerQueueDepthRequiresScheduling(t *testing.T) {
+	err := (&Websocket{SlowConsumer: &SlowConsumer{MaxQueueDepth: 10}}).Validate()
+	assert.EqualError(t, err, "SlowConsumer.MaxQueueDepth requires a WriteScheduling")
+}
@@ -0,0 +1,235 @@
+//go:build graphqlws_coder
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// CompressionSupported is true if the websocket library negotiates per message compression.
+const CompressionSupported = true
+
+// setCompression enables the negotiation of per message compression.
+func setCompression(u *Upgrader, enabled bool) {
+	u.EnableCompression = enabled
+}
+
+// socketLibrary is the library implementing the sockets.
+const socketLibrary = "coder/websocket"
+
+// Upgrader upgrades the HTTP connections to websocket connections with coder/websocket.
+type Upgrader struct {
+	Subprotocols []string
+	// CheckOrigin returns true if the origin of the request is accepted, the origin must match
+	// the host of the request when nil.
+	CheckOrigin func(r *http.Request) bool
+	// EnableCompression negotiates per message compression with the clients supporting it.
+	EnableCompression bool
+}
+
+type coderSocket struct {
+	conn       *websocket.Conn
+	deadline   atomic.Int64
+	closing    atomic.Bool
+	extensions []string
+	// onPing is called for the ping frames when set
+	onPing func()
+
+	// writes is the context of the writes, it is cancelled at their deadline
+	writes     context.Context
+	stopWrites context.CancelFunc
+	mu         sync.Mutex
+	stopTimer  *time.Timer
+}
+
+func upgrade(u *Upgrader, w http.ResponseWriter, r *http.Request, header http.Header) (socket, error) {
+	opts := &websocket.AcceptOptions{Subprotocols: u.Subprotocols}
+	if u.CheckOrigin != nil {
+		if !u.CheckOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return nil, errors.New("request origin not allowed by Upgrader.CheckOrigin")
+		}
+		opts.InsecureSkipVerify = true
+	}
+	if u.EnableCompression {
+		opts.CompressionMode = websocket.CompressionContextTakeover
+	}
+
+	s := &coderSocket{}
+	opts.OnPingReceived = func(ctx context.Context, payload []byte) bool {
+		if s.onPing != nil {
+			s.onPing()
+		}
+		return true
+	}
+
+	// Accept writes the headers of the response along with its own
+	for key, values := range header {
+		w.Header()[key] = values
+	}
+	conn, err := websocket.Accept(w, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	// messages are only bounded by the server, like with the other sockets
+	conn.SetReadLimit(-1)
+	s.conn = conn
+	s.writes, s.stopWrites = context.WithCancel(context.Background())
+	if u.EnableCompression && offersExtension(r, permessageDeflate) {
+		s.extensions = []string{permessageDeflate}
+	}
+	return s, nil
+}
+
+func (s *coderSocket) Subprotocol() string {
+	return s.conn.Subprotocol()
+}
+
+func (s *coderSocket) Extensions() []string {
+	return s.extensions
+}
+
+// ReadMessage implements socket, the connection is closed when the read deadline is exceeded.
+// The deadline may be pushed back while the read waits, e.g. when a ping is read.
+func (s *coderSocket) ReadMessage(buf *bytes.Buffer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer s.cancelAtDeadline(cancel)()
+
+	_, r, err := s.conn.Reader(ctx)
+	if err == nil {
+		_, err = buf.ReadFrom(r)
+	}
+	if err != nil && ctx.Err() != nil {
+		// the read was cancelled at its deadline
+		return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// cancelAtDeadline calls cancel once the read deadline passes, it returns a function stopping it.
+func (s *coderSocket) cancelAtDeadline(cancel context.CancelFunc) (stop func()) {
+	deadline := s.deadline.Load()
+	if deadline == 0 {
+		return func() {}
+	}
+
+	var mu sync.Mutex
+	var timer *time.Timer
+	var check func()
+	check = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		deadline := s.deadline.Load()
+		switch wait := time.Until(time.Unix(0, deadline)); {
+		case timer == nil || deadline == 0:
+			// stopped, or no deadline anymore
+		case wait > 0:
+			timer = time.AfterFunc(wait, check)
+		default:
+			cancel()
+		}
+	}
+	mu.Lock()
+	timer = time.AfterFunc(time.Until(time.Unix(0, deadline)), check)
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		timer.Stop()
+		timer = nil
+		mu.Unlock()
+	}
+}
+
+// WriteMessage implements socket, the messages written once the connection is closing are
+// rejected like with the other sockets.
+func (s *coderSocket) WriteMessage(data []byte) error {
+	if s.closing.Load() {
+		return net.ErrClosed
+	}
+	return s.conn.Write(s.writes, websocket.MessageText, data)
+}
+
+func (s *coderSocket) WriteBinary(data []byte) error {
+	if s.closing.Load() {
+		return net.ErrClosed
+	}
+	return s.conn.Write(s.writes, websocket.MessageBinary, data)
+}
+
+// WriteClose implements socket, the close handshake completes in the background, within 5
+// seconds, so that closing a connection doesn't wait for its client.
+func (s *coderSocket) WriteClose(code int, text string) error {
+	if !s.closing.CompareAndSwap(false, true) {
+		return net.ErrClosed
+	}
+	go func() {
+		_ = s.conn.Close(websocket.StatusCode(code), truncateCloseReason(text))
+	}()
+	return nil
+}
+
+func (s *coderSocket) OnPing(fn func()) {
+	s.onPing = fn
+}
+
+// SetReadLimit implements socket, coder/websocket closes the connection with 1009 itself.
+func (s *coderSocket) SetReadLimit(limit int64) {
+	if limit <= 0 {
+		limit = -1
+	}
+	s.conn.SetReadLimit(limit)
+}
+
+func (s *coderSocket) SetReadDeadline(t time.Time) error {
+	var deadline int64
+	if !t.IsZero() {
+		deadline = t.UnixNano()
+	}
+	s.deadline.Store(deadline)
+	return nil
+}
+
+// SetWriteDeadline implements socket, coder/websocket closes the connection when a write is
+// cancelled at the deadline.
+func (s *coderSocket) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopTimer != nil {
+		s.stopTimer.Stop()
+		s.stopTimer = nil
+	}
+	if !t.IsZero() {
+		s.stopTimer = time.AfterFunc(time.Until(t), s.stopWrites)
+	}
+	return nil
+}
+
+// Close implements socket, the connection is closed by the close handshake once started.
+func (s *coderSocket) Close() error {
+	if s.closing.Load() {
+		return nil
+	}
+	return s.conn.CloseNow()
+}
+
+func newCloseError(code int, text string) error {
+	return websocket.CloseError{Code: websocket.StatusCode(code), Reason: text}
+}
+
+func closeStatus(err error) (int, bool) {
+	if code := websocket.CloseStatus(err); code != -1 {
+		return int(code), true
+	}
+	return 0, false
+}
@@ -0,0 +1,231 @@
+//go:build graphqlws_gobwas && !graphqlws_coder
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// CompressionSupported is true if the websocket library negotiates per message compression.
+const CompressionSupported = false
+
+// setCompression does nothing, compression isn't supported.
+func setCompression(u *Upgrader, enabled bool) {}
+
+// socketLibrary is the library implementing the sockets.
+const socketLibrary = "gobwas/ws"
+
+// Upgrader upgrades the HTTP connections to websocket connections with gobwas/ws.
+type Upgrader struct {
+	Subprotocols []string
+	// CheckOrigin returns true if the origin of the request is accepted, the origin must match
+	// the host of the request when nil.
+	CheckOrigin func(r *http.Request) bool
+}
+
+var errCloseSent = errors.New("websocket close sent")
+
+type gobwasSocket struct {
+	conn        net.Conn
+	subprotocol string
+	// buffered is set when the client sent frames along with the handshake, they must be read
+	// through the reader of the handshake
+	buffered bool
+	reader   *wsutil.Reader
+	// limit bounds the size of the messages, it is disabled when zero
+	limit int64
+	// onPing is called for the ping frames when set
+	onPing func()
+
+	mu        sync.Mutex
+	w         *bufio.Writer
+	closeSent bool
+}
+
+var _ rawSocket = &gobwasSocket{}
+
+func upgrade(u *Upgrader, w http.ResponseWriter, r *http.Request, header http.Header) (socket, error) {
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = isSameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, errors.New("request origin not allowed by Upgrader.CheckOrigin")
+	}
+
+	upgrader := ws.HTTPUpgrader{
+		Protocol: func(subprotocol string) bool { return contains(u.Subprotocols, subprotocol) },
+		Header:   header,
+	}
+	conn, rw, hs, err := upgrader.Upgrade(r, w)
+	if err != nil {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return nil, err
+	}
+
+	s := &gobwasSocket{conn: conn, subprotocol: hs.Protocol, w: rw.Writer}
+	var src io.Reader = conn
+	if rw.Reader.Buffered() > 0 {
+		s.buffered = true
+		src = rw.Reader
+	}
+	s.reader = &wsutil.Reader{
+		Source:         src,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		OnIntermediate: s.handleControl,
+	}
+	return s, nil
+}
+
+func (s *gobwasSocket) Subprotocol() string {
+	return s.subprotocol
+}
+
+// Extensions implements socket, no extension is negotiated with gobwas/ws.
+func (s *gobwasSocket) Extensions() []string {
+	return nil
+}
+
+func (s *gobwasSocket) ReadMessage(buf *bytes.Buffer) error {
+	for {
+		hdr, err := s.reader.NextFrame()
+		if err != nil {
+			return err
+		}
+		if hdr.OpCode.IsControl() {
+			if err := s.handleControl(hdr, s.reader); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if s.limit <= 0 {
+			_, err = buf.ReadFrom(s.reader)
+			return err
+		}
+		n, err := buf.ReadFrom(io.LimitReader(s.reader, s.limit+1))
+		if err == nil && n > s.limit {
+			_ = s.WriteClose(closeMessageTooBig, "")
+			return errReadLimit
+		}
+		return err
+	}
+}
+
+// handleControl answers a control frame, it returns wsutil.ClosedError for close frames.
+func (s *gobwasSocket) handleControl(hdr ws.Header, r io.Reader) error {
+	payload := make([]byte, hdr.Length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+
+	switch hdr.OpCode {
+	case ws.OpPing:
+		if s.onPing != nil {
+			s.onPing()
+		}
+		return s.WritePong(payload)
+	case ws.OpClose:
+		code, reason := ws.ParseCloseFrameData(payload)
+		if code.Empty() {
+			code = ws.StatusNoStatusRcvd
+		}
+		_ = s.WriteClose(int(code), "")
+		return wsutil.ClosedError{Code: code, Reason: reason}
+	}
+	return nil
+}
+
+func (s *gobwasSocket) writeFrame(f ws.Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closeSent {
+		return errCloseSent
+	}
+	if f.Header.OpCode == ws.OpClose {
+		s.closeSent = true
+		_ = s.conn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	}
+	if err := ws.WriteFrame(s.w, f); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *gobwasSocket) WriteMessage(data []byte) error {
+	return s.writeFrame(ws.NewTextFrame(data))
+}
+
+func (s *gobwasSocket) WriteBinary(data []byte) error {
+	return s.writeFrame(ws.NewBinaryFrame(data))
+}
+
+func (s *gobwasSocket) WriteClose(code int, text string) error {
+	var body []byte
+	if code != closeNoStatusReceived {
+		body = ws.NewCloseFrameBody(ws.StatusCode(code), truncateCloseReason(text))
+	}
+	return s.writeFrame(ws.NewCloseFrame(body))
+}
+
+func (s *gobwasSocket) WritePong(data []byte) error {
+	err := s.writeFrame(ws.NewPongFrame(data))
+	if errors.Is(err, errCloseSent) {
+		return nil
+	}
+	return err
+}
+
+func (s *gobwasSocket) OnPing(fn func()) {
+	s.onPing = fn
+}
+
+func (s *gobwasSocket) SetReadLimit(limit int64) {
+	s.limit = limit
+}
+
+func (s *gobwasSocket) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+func (s *gobwasSocket) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
+func (s *gobwasSocket) NetConn() net.Conn {
+	if s.buffered {
+		return nil
+	}
+	return s.conn
+}
+
+func (s *gobwasSocket) Close() error {
+	return s.conn.Close()
+}
+
+func newCloseError(code int, text string) error {
+	return wsutil.ClosedError{Code: ws.StatusCode(code), Reason: text}
+}
+
+func closeStatus(err error) (int, bool) {
+	var closeErr wsutil.ClosedError
+	if errors.As(err, &closeErr) {
+		return int(closeErr.Code), true
+	}
+	return 0, false
+}
@@ -0,0 +1,144 @@
+//go:build !graphqlws_coder && !graphqlws_gobwas && !graphqlws_stdlib
+
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CompressionSupported is true if the websocket library negotiates per message compression.
+const CompressionSupported = true
+
+// setCompression enables the negotiation of per message compression.
+func setCompression(u *Upgrader, enabled bool) {
+	u.EnableCompression = enabled
+}
+
+// socketLibrary is the library implementing the sockets.
+const socketLibrary = "gorilla/websocket"
+
+// Upgrader upgrades the HTTP connections to websocket connections.
+type Upgrader = websocket.Upgrader
+
+type gorillaSocket struct {
+	*websocket.Conn
+	compression bool
+	extensions  []string
+	// writeDeadline is the deadline of the writes in unix nanoseconds, zero when unset
+	writeDeadline *atomic.Int64
+	// writing is true while a data write is in progress
+	writing *atomic.Bool
+}
+
+var _ rawSocket = gorillaSocket{}
+
+func upgrade(u *Upgrader, w http.ResponseWriter, r *http.Request, header http.Header) (socket, error) {
+	conn, err := u.Upgrade(w, r, header)
+	if err != nil {
+		return nil, err
+	}
+	s := gorillaSocket{Conn: conn, compression: u.EnableCompression, writeDeadline: &atomic.Int64{}, writing: &atomic.Bool{}}
+	if u.EnableCompression && offersExtension(r, permessageDeflate) {
+		s.extensions = []string{permessageDeflate}
+	}
+	return s, nil
+}
+
+func (s gorillaSocket) Extensions() []string {
+	return s.extensions
+}
+
+func (s gorillaSocket) ReadMessage(buf *bytes.Buffer) error {
+	_, r, err := s.NextReader()
+	if err != nil {
+		return err
+	}
+	_, err = buf.ReadFrom(r)
+	return err
+}
+
+func (s gorillaSocket) WriteMessage(data []byte) error {
+	return s.write(websocket.TextMessage, data)
+}
+
+func (s gorillaSocket) WriteBinary(data []byte) error {
+	return s.write(websocket.BinaryMessage, data)
+}
+
+func (s gorillaSocket) write(messageType int, data []byte) error {
+	s.applyWriteDeadline()
+	s.writing.Store(true)
+	defer s.writing.Store(false)
+	return s.Conn.WriteMessage(messageType, data)
+}
+
+func (s gorillaSocket) WriteClose(code int, text string) error {
+	return s.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, truncateCloseReason(text)), time.Now().Add(controlWriteTimeout))
+}
+
+func (s gorillaSocket) WritePong(data []byte) error {
+	err := s.WriteControl(websocket.PongMessage, data, time.Now().Add(controlWriteTimeout))
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return nil
+	}
+	return err
+}
+
+// OnPing implements socket, the pings are answered like with the default handler of
+// gorilla/websocket.
+func (s gorillaSocket) OnPing(fn func()) {
+	s.SetPingHandler(func(data string) error {
+		fn()
+		return s.WritePong([]byte(data))
+	})
+}
+
+// SetWriteDeadline implements socket. gorilla/websocket sets its own deadline on the network
+// connection for every frame it writes, so the deadline is set on the network connection for the
+// frame in progress and on gorilla/websocket for the following writes. The following frames of a
+// write in progress reset it though, the network connection is closed if the write is still in
+// progress at the deadline.
+func (s gorillaSocket) SetWriteDeadline(t time.Time) error {
+	s.writeDeadline.Store(t.UnixNano())
+	time.AfterFunc(time.Until(t), func() {
+		_ = s.Conn.NetConn().SetWriteDeadline(t)
+		if s.writing.Load() {
+			_ = s.Conn.NetConn().Close()
+		}
+	})
+	return s.Conn.NetConn().SetWriteDeadline(t)
+}
+
+// applyWriteDeadline sets the write deadline on gorilla/websocket, it is called by the data
+// writes, which gorilla/websocket doesn't allow concurrently.
+func (s gorillaSocket) applyWriteDeadline() {
+	if deadline := s.writeDeadline.Load(); deadline != 0 {
+		_ = s.Conn.SetWriteDeadline(time.Unix(0, deadline))
+	}
+}
+
+func (s gorillaSocket) NetConn() net.Conn {
+	if s.compression {
+		return nil
+	}
+	return s.Conn.NetConn()
+}
+
+func newCloseError(code int, text string) error {
+	return &websocket.CloseError{Code: code, Text: text}
+}
+
+func closeStatus(err error) (int, bool) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code, true
+	}
+	return 0, false
+}
@@ -0,0 +1,283 @@
+//go:build graphqlws_stdlib && !graphqlws_coder && !graphqlws_gobwas
+
+package transport
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CompressionSupported is true if the websocket library negotiates per message compression.
+const CompressionSupported = false
+
+// setCompression does nothing, compression isn't supported.
+func setCompression(u *Upgrader, enabled bool) {}
+
+// socketLibrary is the library implementing the sockets.
+const socketLibrary = "net/http"
+
+// websocketGUID is concatenated to the key of the client to compute the accept key of the
+// handshake, see https://www.rfc-editor.org/rfc/rfc6455#section-4.2.2
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Upgrader upgrades the HTTP connections to websocket connections with the standard library
+// alone, by hijacking the connections of net/http. Compression is not supported.
+type Upgrader struct {
+	Subprotocols []string
+	// CheckOrigin returns true if the origin of the request is accepted, the origin must match
+	// the host of the request when nil.
+	CheckOrigin func(r *http.Request) bool
+}
+
+var errCloseSent = errors.New("websocket close sent")
+
+// stdlibCloseError is returned by the reads once the peer closed the connection.
+type stdlibCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *stdlibCloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+type stdlibSocket struct {
+	conn        net.Conn
+	subprotocol string
+	// buffered is set when the client sent frames along with the handshake, they must be read
+	// through the reader of the handshake
+	buffered bool
+	reader   frameReader
+
+	mu        sync.Mutex
+	closeSent bool
+	// writeDeadline is the deadline of the writes in unix nanoseconds, restored after the
+	// control frames, zero when unset
+	writeDeadline atomic.Int64
+}
+
+var _ rawSocket = &stdlibSocket{}
+
+func upgrade(u *Upgrader, w http.ResponseWriter, r *http.Request, header http.Header) (socket, error) {
+	if err := checkHandshake(r); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, err
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = isSameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, errors.New("request origin not allowed by Upgrader.CheckOrigin")
+	}
+
+	subprotocol := selectSubprotocol(u.Subprotocols, r)
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	resp.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n")
+	if subprotocol != "" {
+		resp.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	_ = header.Write(&resp)
+	resp.WriteString("\r\n")
+
+	// the deadlines of net/http may still be set on the hijacked connection
+	_ = conn.SetDeadline(time.Time{})
+	_ = conn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	if _, err := io.WriteString(conn, resp.String()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+
+	s := &stdlibSocket{conn: conn, subprotocol: subprotocol}
+	var src io.Reader = conn
+	if rw.Reader.Buffered() > 0 {
+		s.buffered = true
+		src = rw.Reader
+	}
+	s.reader = frameReader{src: src, ws: s}
+	return s, nil
+}
+
+// checkHandshake validates the opening handshake of the client.
+func checkHandshake(r *http.Request) error {
+	switch {
+	case r.Method != http.MethodGet:
+		return errors.New("websocket: the handshake method is not GET")
+	case !headerContainsToken(r.Header, "Connection", "upgrade"):
+		return errors.New("websocket: the 'Connection' header does not contain 'upgrade'")
+	case !headerContainsToken(r.Header, "Upgrade", "websocket"):
+		return errors.New("websocket: the 'Upgrade' header does not contain 'websocket'")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		return errors.New("websocket: unsupported version")
+	case r.Header.Get("Sec-WebSocket-Key") == "":
+		return errors.New("websocket: the 'Sec-WebSocket-Key' header is missing")
+	}
+	return nil
+}
+
+// selectSubprotocol returns the first subprotocol of the server requested by the client.
+func selectSubprotocol(subprotocols []string, r *http.Request) string {
+	var requested []string
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, v := range strings.Split(value, ",") {
+			requested = append(requested, strings.TrimSpace(v))
+		}
+	}
+	for _, subprotocol := range subprotocols {
+		if contains(requested, subprotocol) {
+			return subprotocol
+		}
+	}
+	return ""
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (s *stdlibSocket) Subprotocol() string {
+	return s.subprotocol
+}
+
+// Extensions implements socket, no extension is negotiated with the standard library.
+func (s *stdlibSocket) Extensions() []string {
+	return nil
+}
+
+func (s *stdlibSocket) ReadMessage(buf *bytes.Buffer) error {
+	_, err := s.reader.read(buf)
+	return err
+}
+
+// writeFrame writes an unmasked server frame.
+func (s *stdlibSocket) writeFrame(opcode byte, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closeSent {
+		return errCloseSent
+	}
+	if opcode&0x8 != 0 {
+		if opcode == opClose {
+			s.closeSent = true
+		}
+		_ = s.conn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+		defer func() { _ = s.conn.SetWriteDeadline(s.deadline()) }()
+	}
+
+	hdr := make([]byte, 2, 10)
+	hdr[0] = 0x80 | opcode
+	switch length := len(payload); {
+	case length < 126:
+		hdr[1] = byte(length)
+	case length <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(length))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(length))
+	}
+
+	bufs := net.Buffers{hdr, payload}
+	_, err := bufs.WriteTo(s.conn)
+	return err
+}
+
+func (s *stdlibSocket) WriteMessage(data []byte) error {
+	return s.writeFrame(opText, data)
+}
+
+func (s *stdlibSocket) WriteBinary(data []byte) error {
+	return s.writeFrame(opBinary, data)
+}
+
+func (s *stdlibSocket) WriteClose(code int, text string) error {
+	var body []byte
+	if code != closeNoStatusReceived {
+		body = binary.BigEndian.AppendUint16(nil, uint16(code))
+		body = append(body, truncateCloseReason(text)...)
+	}
+	return s.writeFrame(opClose, body)
+}
+
+func (s *stdlibSocket) WritePong(data []byte) error {
+	err := s.writeFrame(opPong, data)
+	if errors.Is(err, errCloseSent) {
+		return nil
+	}
+	return err
+}
+
+func (s *stdlibSocket) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+func (s *stdlibSocket) SetWriteDeadline(t time.Time) error {
+	var deadline int64
+	if !t.IsZero() {
+		deadline = t.UnixNano()
+	}
+	s.writeDeadline.Store(deadline)
+	return s.conn.SetWriteDeadline(t)
+}
+
+// deadline returns the deadline of the writes.
+func (s *stdlibSocket) deadline() time.Time {
+	if deadline := s.writeDeadline.Load(); deadline != 0 {
+		return time.Unix(0, deadline)
+	}
+	return time.Time{}
+}
+
+func (s *stdlibSocket) OnPing(fn func()) {
+	s.reader.onPing = fn
+}
+
+func (s *stdlibSocket) SetReadLimit(limit int64) {
+	s.reader.limit = limit
+}
+
+func (s *stdlibSocket) NetConn() net.Conn {
+	if s.buffered {
+		return nil
+	}
+	return s.conn
+}
+
+func (s *stdlibSocket) Close() error {
+	return s.conn.Close()
+}
+
+func newCloseError(code int, text string) error {
+	return &stdlibCloseError{Code: code, Text: text}
+}
+
+func closeStatus(err error) (int, bool) {
+	var closeErr *stdlibCloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code, true
+	}
+	return 0, false
+}
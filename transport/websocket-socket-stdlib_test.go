@@ -0,0 +1,43 @@
+//go:build graphqlws_stdlib && !graphqlws_coder && !graphqlws_gobwas
+
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// example of https://www.rfc-editor.org/rfc/rfc6455#section-1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestUpgradeRejectsInvalidHandshakes(t *testing.T) {
+	server := newTestServer(t, Websocket{}, nil)
+
+	resp, err := http.Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	assert.Error(t, checkHandshake(r))
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	assert.NoError(t, checkHandshake(r))
+}
+
+func TestSelectSubprotocol(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Add("Sec-WebSocket-Protocol", "unknown, "+graphqlwsSubprotocol)
+	r.Header.Add("Sec-WebSocket-Protocol", graphqltransportwsSubprotocol)
+
+	assert.Equal(t, graphqltransportwsSubprotocol, selectSubprotocol([]string{graphqltransportwsSubprotocol, graphqlwsSubprotocol}, r))
+	assert.Equal(t, "", selectSubprotocol([]string{"other"}, r))
+}
@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Close codes used by the transport, see https://www.rfc-editor.org/rfc/rfc6455#section-7.4.1
+const (
+	closeNormalClosure    = 1000
+	closeGoingAway        = 1001
+	closeProtocolError    = 1002
+	closeNoStatusReceived = 1005
+	closeAbnormalClosure  = 1006
+	closeMessageTooBig    = 1009
+	closeTryAgainLater    = 1013
+)
+
+// errReadLimit is returned by the sockets reading a message larger than their read limit, they
+// are closed with closeMessageTooBig.
+var errReadLimit = errors.New("websocket: read limit exceeded")
+
+// maxCloseReason is the size limit of the reason of a close frame, whose payload is limited to 125
+// bytes with its code.
+const maxCloseReason = 123
+
+// truncateCloseReason truncates a close reason to maxCloseReason bytes on a UTF-8 boundary, so that
+// the close frame is valid.
+func truncateCloseReason(text string) string {
+	if len(text) <= maxCloseReason {
+		return text
+	}
+	end := maxCloseReason
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end]
+}
+
+// controlWriteTimeout bounds the writes of control frames, which may happen concurrently with the
+// writes of data messages.
+const controlWriteTimeout = time.Second
+
+// socket is an established websocket connection. The library implementing it is selected at
+// build time: gorilla/websocket by default, coder/websocket with the graphqlws_coder build tag,
+// gobwas/ws with the graphqlws_gobwas build tag and the standard library alone with the
+// graphqlws_stdlib build tag.
+//
+// WriteClose may be called concurrently with WriteMessage, the other methods are called from a
+// single goroutine at a time.
+type socket interface {
+	// Subprotocol returns the negotiated subprotocol.
+	Subprotocol() string
+	// Extensions returns the names of the negotiated extensions.
+	Extensions() []string
+	// ReadMessage reads the next data message into buf, control frames are answered. It returns
+	// an error recognised by closeStatus once the peer closed the connection.
+	ReadMessage(buf *bytes.Buffer) error
+	// WriteMessage writes a text message.
+	WriteMessage(data []byte) error
+	// WriteBinary writes a binary message.
+	WriteBinary(data []byte) error
+	// WriteClose writes a close frame, closeNoStatusReceived writes an empty close frame. The text
+	// is truncated with truncateCloseReason.
+	WriteClose(code int, text string) error
+	SetReadDeadline(t time.Time) error
+	// SetWriteDeadline bounds the writes, including the one in progress, so that a client not
+	// reading can't hold the writers. A write failing at the deadline leaves the connection
+	// unusable, it is only set once the connection is closing.
+	SetWriteDeadline(t time.Time) error
+	// SetReadLimit bounds the size of the messages read, it is disabled when zero.
+	SetReadLimit(limit int64)
+	// OnPing sets fn, called for every ping control frame read before it is answered. It is set
+	// before the connection is read.
+	OnPing(fn func())
+	Close() error
+}
+
+// rawSocket is implemented by the sockets whose frames can be read directly from the network
+// connection, which serving the connection with an event loop requires.
+type rawSocket interface {
+	socket
+	// NetConn returns the network connection, or nil when the frames can't be read directly, e.g.
+	// because compression was negotiated.
+	NetConn() net.Conn
+	// WritePong writes a pong control frame, it may be called concurrently with WriteMessage.
+	WritePong(data []byte) error
+}
+
+// permessageDeflate is the compression extension, see https://www.rfc-editor.org/rfc/rfc7692
+const permessageDeflate = "permessage-deflate"
+
+// offersExtension returns true if the upgrade request offers the extension.
+func offersExtension(r *http.Request, name string) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, offer := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(offer, ";")
+			if strings.EqualFold(strings.TrimSpace(token), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsWebsocketRequest returns true if the request asks to be upgraded to a websocket connection: a
+// GET request with the "Connection: Upgrade" and "Upgrade: websocket" headers. Routers may use it
+// to dispatch the requests between a Websocket and other handlers.
+func IsWebsocketRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// isSameOrigin accepts the requests without an origin or whose origin matches their host.
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
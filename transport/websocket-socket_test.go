@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseStatus(t *testing.T) {
+	code, ok := closeStatus(newCloseError(closeGoingAway, "bye"))
+	assert.True(t, ok)
+	assert.Equal(t, closeGoingAway, code)
+
+	_, ok = closeStatus(errors.New("read failed"))
+	assert.False(t, ok)
+}
+
+func TestTruncateCloseReason(t *testing.T) {
+	assert.Equal(t, "bye", truncateCloseReason("bye"))
+	assert.Equal(t, strings.Repeat("a", maxCloseReason), truncateCloseReason(strings.Repeat("a", 200)))
+
+	// a rune crossing the limit is dropped rather than split
+	truncated := truncateCloseReason(strings.Repeat("a", maxCloseReason-1) + "éa")
+	assert.Equal(t, strings.Repeat("a", maxCloseReason-1), truncated)
+	assert.True(t, utf8.ValidString(truncated))
+}
+
+func TestUpgraderNegotiatesSubprotocol(t *testing.T) {
+	server := newTestServer(t, Websocket{}, nil)
+
+	for _, subprotocol := range supportedSubprotocols {
+		conn := dialTestServer(t, server, subprotocol)
+		assert.Equal(t, subprotocol, conn.Subprotocol(), socketLibrary)
+	}
+}
+
+func TestUpgraderRejectsCrossOriginRequests(t *testing.T) {
+	handler := Websocket{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Do(w, r, nil)
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqltransportwsSubprotocol}}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	_, resp, err := dialer.Dial(url, http.Header{"Origin": []string{"http://example.com"}})
+	assert.Error(t, err, socketLibrary)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, socketLibrary)
+	}
+
+	conn, _, err := dialer.Dial(url, http.Header{"Origin": []string{server.URL}})
+	if assert.NoError(t, err, socketLibrary) {
+		conn.Close()
+	}
+}
+
+func TestUpgraderResponseHeaders(t *testing.T) {
+	infos := make(chan *ConnectionInfo, 1)
+	server := newTestServer(t, Websocket{
+		UpgradeHeaderFunc: func(r *http.Request) http.Header {
+			return http.Header{"Set-Cookie": {"session=" + r.URL.Query().Get("session")}}
+		},
+		InitFunc: func(ctx context.Context, payload InitPayload) (context.Context, error) {
+			infos <- GetConnectionInfo(ctx)
+			return ctx, nil
+		},
+	}, nil)
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqltransportwsSubprotocol}}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?session=abc", nil)
+	if !assert.NoError(t, err, socketLibrary) {
+		return
+	}
+	defer conn.Close()
+	assert.Equal(t, "session=abc", resp.Header.Get("Set-Cookie"), socketLibrary)
+
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+	info := <-infos
+	assert.Equal(t, graphqltransportwsSubprotocol, info.Subprotocol)
+	assert.Empty(t, info.Extensions)
+}
+
+func TestOffersExtension(t *testing.T) {
+	r := httptest.NewRequest("GET", "/graphql", nil)
+	assert.False(t, offersExtension(r, permessageDeflate))
+
+	r.Header.Add("Sec-WebSocket-Extensions", "x-webkit-deflate-frame")
+	r.Header.Add("Sec-WebSocket-Extensions", "foo, Permessage-Deflate; client_max_window_bits")
+	assert.True(t, offersExtension(r, permessageDeflate))
+	assert.False(t, offersExtension(r, "client_max_window_bits"))
+}
@@ -3,8 +3,6 @@ package transport
 import (
 	"encoding/json"
 	"errors"
-
-	"github.com/gorilla/websocket"
 )
 
 const (
@@ -20,6 +18,7 @@ const (
 	errorMessageType
 	pingMessageType
 	pongMessageType
+	syncMessageType
 )
 
 var (
@@ -29,15 +28,22 @@ var (
 	}
 
 	errWsConnClosed = errors.New("websocket connection closed")
-	errInvalidMsg   = errors.New("invalid message received")
+	errInvalidMsg   = ErrInvalidMessage
 )
 
+// ErrInvalidMessage is returned by the MessageExchangers reading a message they can't decode.
+var ErrInvalidMessage = errors.New("invalid message received")
+
 type (
-	messageType int
+	// MessageType is the type of a Message, whatever the subprotocol encoding it.
+	MessageType int
+	messageType = MessageType
 	message     struct {
 		payload json.RawMessage
 		id      string
 		t       messageType
+		// frames are the binary frames written right before the message, see Binary.
+		frames [][]byte
 	}
 	messageExchanger interface {
 		NextMessage() (message, error)
@@ -74,6 +80,8 @@ func (t messageType) String() string {
 		text = "ping"
 	case pongMessageType:
 		text = "pong"
+	case syncMessageType:
+		text = "sync"
 	}
 	return text
 }
@@ -108,7 +116,7 @@ func (t *Websocket) injectGraphQLWSSubprotocols() {
 func handleNextReaderError(err error) error {
 	// TODO: should we consider all closure scenarios here for the ws connection?
 	// for now we only list the error codes from the previous implementation
-	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+	if code, ok := closeStatus(err); ok && (code == closeNormalClosure || code == closeNoStatusReceived) {
 		return errWsConnClosed
 	}
 
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"testing"
 
-	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,18 +13,18 @@ func TestHandleNextReaderError(t *testing.T) {
 		input  error
 		expect error
 	}{
-		{"Normal Closure", &websocket.CloseError{Code: websocket.CloseNormalClosure}, errWsConnClosed},
-		{"No Status Received", &websocket.CloseError{Code: websocket.CloseNoStatusReceived}, errWsConnClosed},
+		{"Normal Closure", newCloseError(closeNormalClosure, ""), errWsConnClosed},
+		{"No Status Received", newCloseError(closeNoStatusReceived, ""), errWsConnClosed},
 		{"Other Error", errors.New("some other error"), errors.New("some other error")},
-		{"Random WebSocket Error", &websocket.CloseError{Code: websocket.CloseAbnormalClosure}, &websocket.CloseError{Code: websocket.CloseAbnormalClosure}},
+		{"Random WebSocket Error", newCloseError(closeAbnormalClosure, ""), newCloseError(closeAbnormalClosure, "")},
 	}
 
 	for _, test := range tests {
 		result := handleNextReaderError(test.input)
-		if ce, ok := test.expect.(*websocket.CloseError); ok {
-			if resCe, ok := result.(*websocket.CloseError); ok {
+		if code, ok := closeStatus(test.expect); ok {
+			if resCode, ok := closeStatus(result); ok {
 				// Check close error codes directly for websocket errors
-				assert.Equal(t, ce.Code, resCe.Code, test.name)
+				assert.Equal(t, code, resCode, test.name)
 			} else {
 				assert.Fail(t, "Expected a websocket close error", test.name)
 			}
@@ -0,0 +1,217 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const defaultSyncMaxDocuments = 32
+
+// The kinds of the frames of the sync messages.
+const (
+	// SyncJoin starts the sync of a document, with the Seq of the last update the client has.
+	SyncJoin SyncKind = "join"
+	// SyncLeave stops the sync of a document.
+	SyncLeave SyncKind = "leave"
+	// SyncUpdate carries an update of a document, e.g. a Yjs update or Automerge changes.
+	SyncUpdate SyncKind = "update"
+	// SyncAwareness carries the ephemeral state of a client, e.g. its cursor or selection.
+	SyncAwareness SyncKind = "awareness"
+	// SyncError is sent by the server when a frame is rejected.
+	SyncError SyncKind = "error"
+)
+
+// ErrSyncNotJoined is returned for the frames of a document the connection didn't join.
+var ErrSyncNotJoined = errors.New("document not joined")
+
+// SyncKind is the kind of a SyncFrame.
+type SyncKind string
+
+// SyncFrame is the payload of a sync message, the id of the message is the document.
+type SyncFrame struct {
+	Kind SyncKind `json:"kind"`
+	// ClientID identifies the client in the vector clocks and the awareness states.
+	ClientID string `json:"clientId,omitempty"`
+	// Seq is the sequence number of an update, assigned by the server, or of the last update
+	// received by a client joining a document.
+	Seq uint64 `json:"seq,omitempty"`
+	// Clock is the vector clock of an update.
+	Clock VectorClock `json:"clock,omitempty"`
+	// Update is the update of the document, opaque to the transport.
+	Update json.RawMessage `json:"update,omitempty"`
+	// Awareness is the awareness state of the client, opaque to the transport.
+	Awareness json.RawMessage `json:"awareness,omitempty"`
+	// Error is the reason of a SyncError.
+	Error string `json:"error,omitempty"`
+}
+
+// VectorClock counts the updates of every client of a document, so that the clients tell the
+// concurrent updates apart from the ordered ones.
+type VectorClock map[string]uint64
+
+// Merge returns the maximum of both clocks for every client.
+func (v VectorClock) Merge(other VectorClock) VectorClock {
+	merged := make(VectorClock, len(v))
+	for client, n := range v {
+		merged[client] = n
+	}
+	for client, n := range other {
+		if n > merged[client] {
+			merged[client] = n
+		}
+	}
+	return merged
+}
+
+// Descends returns true if v has seen every update seen by other.
+func (v VectorClock) Descends(other VectorClock) bool {
+	for client, n := range other {
+		if v[client] < n {
+			return false
+		}
+	}
+	return true
+}
+
+// Concurrent returns true if neither clock has seen every update of the other.
+func (v VectorClock) Concurrent(other VectorClock) bool {
+	return !v.Descends(other) && !other.Descends(v)
+}
+
+// SyncHandler relays the frames of the documents between the clients, e.g. a collab.Hub.
+type SyncHandler interface {
+	// Join returns the frames of a document to send to the client from the join frame, until ctx
+	// is done when the client leaves the document or the connection closes.
+	Join(ctx context.Context, document string, join SyncFrame) (<-chan SyncFrame, error)
+	// Receive handles a frame sent by the client for a document it joined.
+	Receive(ctx context.Context, document string, frame SyncFrame) error
+}
+
+// DocumentSync multiplexes the sync of collaborative documents on the connections, next to their
+// operations, with "sync" messages whose id is the document and payload a SyncFrame. The clients
+// join a document, then exchange its updates and awareness states until they leave it.
+type DocumentSync struct {
+	Handler SyncHandler
+	// MaxDocuments is the number of documents a connection may join, it defaults to 32.
+	MaxDocuments int
+}
+
+func (s *DocumentSync) maxDocuments() int {
+	if s.MaxDocuments <= 0 {
+		return defaultSyncMaxDocuments
+	}
+	return s.MaxDocuments
+}
+
+// syncDocument is a document joined by a connection.
+type syncDocument struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// handleSync handles a sync message of the client.
+func (c *wsConnection) handleSync(m *message) {
+	payload, err := c.openPayload(m.payload)
+	if err != nil {
+		c.sendSyncError(m.id, err)
+		return
+	}
+	var frame SyncFrame
+	if err := jsonDecode(payload, &frame); err != nil || m.id == "" {
+		c.sendSyncError(m.id, errors.New("invalid sync frame"))
+		return
+	}
+
+	c.mu.Lock()
+	doc := c.documents[m.id]
+	c.mu.Unlock()
+	switch frame.Kind {
+	case SyncJoin:
+		c.joinDocument(m.id, frame)
+	case SyncLeave:
+		if doc != nil {
+			c.leaveDocument(m.id, doc)
+		}
+	case SyncUpdate, SyncAwareness:
+		if doc == nil {
+			c.sendSyncError(m.id, ErrSyncNotJoined)
+			return
+		}
+		if err := c.DocumentSync.Handler.Receive(doc.ctx, m.id, frame); err != nil {
+			c.sendSyncError(m.id, err)
+		}
+	default:
+		c.sendSyncError(m.id, fmt.Errorf("unexpected sync frame %q", frame.Kind))
+	}
+}
+
+func (c *wsConnection) joinDocument(document string, join SyncFrame) {
+	c.mu.Lock()
+	// close leaves the documents joined before it
+	if c.closing.Load() {
+		c.mu.Unlock()
+		return
+	}
+	if _, ok := c.documents[document]; ok {
+		c.mu.Unlock()
+		c.sendSyncError(document, errors.New("document already joined"))
+		return
+	}
+	if len(c.documents) >= c.DocumentSync.maxDocuments() {
+		c.mu.Unlock()
+		c.sendSyncError(document, errors.New("too many documents joined"))
+		return
+	}
+	if c.documents == nil {
+		c.documents = map[string]*syncDocument{}
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	doc := &syncDocument{ctx: ctx, cancel: cancel}
+	c.documents[document] = doc
+	c.mu.Unlock()
+
+	frames, err := c.DocumentSync.Handler.Join(ctx, document, join)
+	if err != nil {
+		c.leaveDocument(document, doc)
+		c.sendSyncError(document, err)
+		return
+	}
+	go func() {
+		defer c.leaveDocument(document, doc)
+		for frame := range frames {
+			c.sendSync(document, frame)
+		}
+	}()
+}
+
+// leaveDocument stops the sync of a document, unless it was joined again.
+func (c *wsConnection) leaveDocument(document string, doc *syncDocument) {
+	doc.cancel()
+	c.mu.Lock()
+	if c.documents[document] == doc {
+		delete(c.documents, document)
+	}
+	c.mu.Unlock()
+}
+
+func (c *wsConnection) sendSync(document string, frame SyncFrame) {
+	b, err := json.Marshal(frame)
+	if err != nil {
+		c.handlePossibleError(fmt.Errorf("encoding sync frame of %s: %w", document, err), false)
+		return
+	}
+	if c.cipher != nil {
+		if b, err = c.sealPayload(b); err != nil {
+			c.handlePossibleError(fmt.Errorf("sealing sync frame of %s: %w", document, err), false)
+			return
+		}
+	}
+	// the sync messages aren't operations, they aren't scheduled
+	c.writeOut(&message{t: syncMessageType, id: document, payload: b})
+}
+
+func (c *wsConnection) sendSyncError(document string, err error) {
+	c.sendSync(document, SyncFrame{Kind: SyncError, Error: err.Error()})
+}
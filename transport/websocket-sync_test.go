@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSyncHandler relays the frames of a document to every client which joined it.
+type testSyncHandler struct {
+	mu      sync.Mutex
+	seq     uint64
+	members map[string]map[chan SyncFrame]struct{}
+}
+
+func (h *testSyncHandler) Join(ctx context.Context, document string, join SyncFrame) (<-chan SyncFrame, error) {
+	frames := make(chan SyncFrame, 16)
+	h.mu.Lock()
+	if h.members == nil {
+		h.members = map[string]map[chan SyncFrame]struct{}{}
+	}
+	if h.members[document] == nil {
+		h.members[document] = map[chan SyncFrame]struct{}{}
+	}
+	h.members[document][frames] = struct{}{}
+	h.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		h.mu.Lock()
+		delete(h.members[document], frames)
+		h.mu.Unlock()
+		close(frames)
+	})
+	return frames, nil
+}
+
+func (h *testSyncHandler) Receive(ctx context.Context, document string, frame SyncFrame) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if frame.Kind == SyncUpdate {
+		h.seq++
+		frame.Seq = h.seq
+	}
+	for frames := range h.members[document] {
+		frames <- frame
+	}
+	return nil
+}
+
+func (h *testSyncHandler) count(document string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.members[document])
+}
+
+func TestDocumentSync(t *testing.T) {
+	handler := &testSyncHandler{}
+	server := newTestServer(t, Websocket{DocumentSync: &DocumentSync{Handler: handler, MaxDocuments: 1}}, testGraphQLService{})
+
+	alice := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, alice, "connection_ack")
+	bob := dialTestServer(t, server, graphqlwsSubprotocol)
+	assert.NoError(t, bob.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, bob, "connection_ack")
+
+	// an update of a document not joined is rejected
+	assert.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"kind": "update", "update": "AQ=="}}))
+	m := readMessageOfType(t, alice, "sync")
+	assert.JSONEq(t, `{"kind":"error","error":"document not joined"}`, string(m["payload"]))
+
+	assert.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"kind": "join", "clientId": "a"}}))
+	assert.NoError(t, bob.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"kind": "join", "clientId": "b"}}))
+	assert.Eventually(t, func() bool { return handler.count("doc1") == 2 }, time.Second, time.Millisecond)
+
+	assert.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"kind": "update", "clientId": "a", "clock": map[string]int{"a": 1}, "update": "AQ=="}}))
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		m := readMessageOfType(t, conn, "sync")
+		assert.Equal(t, `"doc1"`, string(m["id"]))
+		var frame SyncFrame
+		assert.NoError(t, json.Unmarshal(m["payload"], &frame))
+		assert.Equal(t, SyncFrame{Kind: SyncUpdate, ClientID: "a", Seq: 1, Clock: VectorClock{"a": 1}, Update: json.RawMessage(`"AQ=="`)}, frame)
+	}
+
+	assert.NoError(t, bob.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc2", "payload": map[string]interface{}{"kind": "join", "clientId": "b"}}))
+	m = readMessageOfType(t, bob, "sync")
+	assert.JSONEq(t, `{"kind":"error","error":"too many documents joined"}`, string(m["payload"]))
+
+	assert.NoError(t, bob.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"kind": "leave"}}))
+	assert.Eventually(t, func() bool { return handler.count("doc1") == 1 }, time.Second, time.Millisecond)
+	alice.Close()
+	assert.Eventually(t, func() bool { return handler.count("doc1") == 0 }, time.Second, time.Millisecond)
+}
+
+func TestDocumentSyncSealed(t *testing.T) {
+	pc, err := NewAESGCMCipher(make([]byte, 16))
+	assert.NoError(t, err)
+	handler := &testSyncHandler{}
+	server := newTestServer(t, Websocket{
+		DocumentSync: &DocumentSync{Handler: handler},
+		PayloadEncryption: &PayloadEncryption{
+			CipherFunc: func(ctx context.Context, initPayload InitPayload) (PayloadCipher, error) { return pc, nil },
+			Required:   true,
+		},
+	}, testGraphQLService{})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	for _, frame := range []string{`{"kind":"join","clientId":"a"}`, `{"kind":"update","clientId":"a","update":"AQ=="}`} {
+		sealed, err := pc.Seal([]byte(frame))
+		assert.NoError(t, err)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"sealed": sealed}}))
+	}
+
+	var payload struct{ Sealed []byte }
+	assert.NoError(t, json.Unmarshal(readMessageOfType(t, conn, "sync")["payload"], &payload))
+	opened, err := pc.Open(payload.Sealed)
+	assert.NoError(t, err)
+	var frame SyncFrame
+	assert.NoError(t, json.Unmarshal(opened, &frame))
+	assert.Equal(t, SyncUpdate, frame.Kind)
+}
+
+func TestDocumentSyncEventLoop(t *testing.T) {
+	loop := newTestEventLoop(t)
+	handler := &testSyncHandler{}
+	server := newTestServer(t, Websocket{EventLoop: loop, DocumentSync: &DocumentSync{Handler: handler}}, testGraphQLService{})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	waitForLoopCount(t, loop, 1)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"kind": "join", "clientId": "a"}}))
+	assert.Eventually(t, func() bool { return handler.count("doc1") == 1 }, time.Second, time.Millisecond)
+
+	conn.Close()
+	waitForLoopCount(t, loop, 0)
+	assert.Eventually(t, func() bool { return handler.count("doc1") == 0 }, time.Second, time.Millisecond)
+}
+
+func TestDocumentSyncDisabled(t *testing.T) {
+	server := newTestServer(t, Websocket{}, testGraphQLService{})
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "sync", "id": "doc1", "payload": map[string]interface{}{"kind": "join"}}))
+	_, _, err := conn.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestVectorClock(t *testing.T) {
+	a := VectorClock{"a": 2, "b": 1}
+	b := VectorClock{"a": 1, "b": 2}
+	assert.True(t, a.Concurrent(b))
+	merged := a.Merge(b)
+	assert.Equal(t, VectorClock{"a": 2, "b": 2}, merged)
+	assert.True(t, merged.Descends(a))
+	assert.True(t, merged.Descends(b))
+	assert.False(t, a.Descends(merged))
+	assert.False(t, merged.Concurrent(a))
+}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A private key for context that only this package can access. This is important
+// to prevent collisions between different context uses
+var tenantCtxKey = &wsTenantContextKey{"tenant"}
+
+type wsTenantContextKey struct {
+	name string
+}
+
+// TenantResolver returns the tenant of a connection from its init payload. It is called once the
+// InitFunc accepted the connection, with the context it returned. Returning an error rejects the
+// connection.
+type TenantResolver func(ctx context.Context, initPayload InitPayload) (string, error)
+
+// TenantLimits are the limits applied to every tenant, zero values don't limit.
+type TenantLimits struct {
+	// MaxConnections caps the initialised connections of a tenant, the connections beyond it are
+	// closed with 1013 Try Again Later.
+	MaxConnections int
+	// OperationsPerSecond caps the rate at which the connections of a tenant start operations, the
+	// operations beyond it receive an error.
+	OperationsPerSecond float64
+	// OperationBurst is the number of operations a tenant may start at once, it defaults to
+	// OperationsPerSecond rounded up.
+	OperationBurst int
+}
+
+// TenantStats describes the activity of a tenant, e.g. to label metrics with the tenant.
+type TenantStats struct {
+	Tenant      string
+	Connections int
+	Operations  int
+}
+
+// Tenancy isolates the tenants sharing a server: every connection belongs to the tenant returned
+// by the Resolver, and the connections and operations of every tenant are counted and limited
+// separately. The tenant is available in the contexts of the connection with GetTenant, and
+// TenantTopic namespaces the topics of the pubsub systems by tenant.
+//
+// A Tenancy may be shared by several transports.
+type Tenancy struct {
+	Resolver TenantResolver
+	// Limits are the limits of the tenants.
+	Limits TenantLimits
+	// LimitsFunc returns the limits of a tenant, it overrides Limits when set.
+	LimitsFunc func(tenant string) TenantLimits
+
+	mu      sync.Mutex
+	tenants map[string]*tenantState
+}
+
+type tenantState struct {
+	name        string
+	limits      TenantLimits
+	connections int
+	operations  int
+	tokens      float64
+	refilledAt  time.Time
+}
+
+func (t *Tenancy) limits(tenant string) TenantLimits {
+	if t.LimitsFunc != nil {
+		return t.LimitsFunc(tenant)
+	}
+	return t.Limits
+}
+
+// connect counts a connection of tenant, it returns nil if the tenant has too many connections.
+func (t *Tenancy) connect(tenant string) *tenantState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tenants == nil {
+		t.tenants = map[string]*tenantState{}
+	}
+	state, ok := t.tenants[tenant]
+	if !ok {
+		state = &tenantState{name: tenant, limits: t.limits(tenant)}
+		state.tokens = float64(state.burst())
+		state.refilledAt = time.Now()
+		t.tenants[tenant] = state
+	}
+	if state.limits.MaxConnections > 0 && state.connections >= state.limits.MaxConnections {
+		return nil
+	}
+	state.connections++
+	return state
+}
+
+// disconnect releases a connection counted by connect, the tenants without activity are forgotten.
+func (t *Tenancy) disconnect(state *tenantState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state.connections--
+	t.forget(state)
+}
+
+// startOperation counts an operation started by a connection of the tenant, it returns false if the
+// tenant started too many operations recently.
+func (t *Tenancy) startOperation(state *tenantState) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rate := state.limits.OperationsPerSecond; rate > 0 {
+		now := time.Now()
+		state.tokens = math.Min(float64(state.burst()), state.tokens+now.Sub(state.refilledAt).Seconds()*rate)
+		state.refilledAt = now
+		if state.tokens < 1 {
+			return false
+		}
+		state.tokens--
+	}
+	state.operations++
+	return true
+}
+
+func (t *Tenancy) endOperation(state *tenantState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state.operations--
+	t.forget(state)
+}
+
+func (t *Tenancy) forget(state *tenantState) {
+	if state.connections == 0 && state.operations == 0 {
+		delete(t.tenants, state.name)
+	}
+}
+
+func (s *tenantState) burst() int {
+	if s.limits.OperationBurst > 0 {
+		return s.limits.OperationBurst
+	}
+	return int(math.Ceil(s.limits.OperationsPerSecond))
+}
+
+// Stats returns the activity of the tenants with connections or operations, sorted by tenant.
+func (t *Tenancy) Stats() []TenantStats {
+	t.mu.Lock()
+	stats := make([]TenantStats, 0, len(t.tenants))
+	for _, state := range t.tenants {
+		stats = append(stats, TenantStats{Tenant: state.name, Connections: state.connections, Operations: state.operations})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Tenant < stats[j].Tenant })
+	return stats
+}
+
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey, tenant)
+}
+
+// GetTenant returns the tenant of the connection the context belongs to, or an empty string if the
+// transport has no Tenancy.
+func GetTenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantCtxKey).(string)
+	return tenant
+}
+
+// TenantTopic prefixes a pubsub topic with the tenant of the context, so that the tenants can't
+// receive the events of each other. The topic is returned as is when the context has no tenant.
+func TenantTopic(ctx context.Context, topic string) string {
+	if tenant := GetTenant(ctx); tenant != "" {
+		return tenant + ":" + topic
+	}
+	return topic
+}
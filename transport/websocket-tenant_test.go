@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTenantTestServer(t *testing.T, tenancy *Tenancy, service GraphQLService) func(tenant string) *websocket.Conn {
+	tenancy.Resolver = func(ctx context.Context, initPayload InitPayload) (string, error) {
+		if tenant := initPayload.GetString("tenant"); tenant != "" {
+			return tenant, nil
+		}
+		return "", errors.New("missing tenant")
+	}
+	server := newTestServer(t, Websocket{Tenancy: tenancy}, service)
+	return func(tenant string) *websocket.Conn {
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]interface{}{"tenant": tenant}}))
+		return conn
+	}
+}
+
+func TestTenancyConnectionLimit(t *testing.T) {
+	tenancy := &Tenancy{Limits: TenantLimits{MaxConnections: 1}}
+	connect := newTenantTestServer(t, tenancy, testGraphQLService{})
+
+	first := connect("acme")
+	readMessageOfType(t, first, "connection_ack")
+	readMessageOfType(t, connect("globex"), "connection_ack")
+
+	rejected := connect("acme")
+	_, _, err := rejected.ReadMessage()
+	for err == nil {
+		_, _, err = rejected.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, closeTryAgainLater), "unexpected error %v", err)
+	assert.Equal(t, []TenantStats{{Tenant: "acme", Connections: 1}, {Tenant: "globex", Connections: 1}}, tenancy.Stats())
+
+	rejected = connect("")
+	_, _, err = rejected.ReadMessage()
+	for err == nil {
+		_, _, err = rejected.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, closeNormalClosure), "unexpected error %v", err)
+
+	assert.NoError(t, first.Close())
+	assert.Eventually(t, func() bool { return len(tenancy.Stats()) == 1 }, time.Second, time.Millisecond)
+	readMessageOfType(t, connect("acme"), "connection_ack")
+}
+
+func TestTenancyResolverError(t *testing.T) {
+	tenancy := &Tenancy{Resolver: func(ctx context.Context, initPayload InitPayload) (string, error) {
+		return "", errors.New("tenant 100% unknown")
+	}}
+	server := newTestServer(t, Websocket{Tenancy: tenancy}, testGraphQLService{})
+	conn := dialTestServer(t, server, graphqlwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+
+	var payload struct {
+		Message string `json:"message"`
+	}
+	assert.NoError(t, json.Unmarshal(readMessageOfType(t, conn, "connection_error")["payload"], &payload))
+	assert.Equal(t, "tenant 100% unknown", payload.Message)
+}
+
+func TestTenancyOperationRate(t *testing.T) {
+	tenants := make(chan string, 2)
+	tenancy := &Tenancy{
+		LimitsFunc: func(tenant string) TenantLimits {
+			return TenantLimits{OperationsPerSecond: 0.001, OperationBurst: 2}
+		},
+	}
+	connect := newTenantTestServer(t, tenancy, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			tenants <- TenantTopic(ctx, "messages")
+			ch := make(chan interface{})
+			context.AfterFunc(ctx, func() { close(ch) })
+			return ch, nil
+		},
+	})
+
+	conn := connect("acme")
+	readMessageOfType(t, conn, "connection_ack")
+	for _, id := range []string{"1", "2", "3"} {
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": id, "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	}
+	assert.Equal(t, "acme:messages", <-tenants)
+	assert.Equal(t, "acme:messages", <-tenants)
+	assert.Contains(t, string(readMessageOfType(t, conn, "error")["payload"]), "too many operations started by the tenant")
+	assert.Equal(t, []TenantStats{{Tenant: "acme", Connections: 1, Operations: 2}}, tenancy.Stats())
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "complete", "id": "1"}))
+	assert.Eventually(t, func() bool { return tenancy.Stats()[0].Operations == 1 }, time.Second, time.Millisecond)
+}
+
+func TestTenantTopic(t *testing.T) {
+	assert.Equal(t, "messages", TenantTopic(context.Background(), "messages"))
+	assert.Equal(t, "acme", GetTenant(withTenant(context.Background(), "acme")))
+	assert.Equal(t, "acme:messages", TenantTopic(withTenant(context.Background(), "acme"), "messages"))
+}
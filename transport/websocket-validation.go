@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"errors"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// validateOperation validates the query of an operation against the schema and replaces the
+// variables of the operation with their values coerced to the variable definitions. Queries and
+// mutations are rejected when subscriptionsOnly is set.
+func validateOperation(schema *ast.Schema, params *startMessagePayload, subscriptionsOnly bool) gqlerror.List {
+	doc, errs := gqlparser.LoadQuery(schema, params.Query)
+	if len(errs) != 0 {
+		return errs
+	}
+
+	op := doc.Operations.ForName(params.OperationName)
+	if op == nil {
+		if params.OperationName == "" {
+			return gqlerror.List{gqlerror.Errorf("an operation name is required")}
+		}
+		return gqlerror.List{gqlerror.Errorf("operation %s not found", params.OperationName)}
+	}
+	if subscriptionsOnly && op.Operation != ast.Subscription {
+		return gqlerror.List{gqlerror.ErrorPosf(op.Position, "only subscriptions are allowed, got a %s", op.Operation)}
+	}
+
+	variables, err := validator.VariableValues(schema, op, params.Variables)
+	if err != nil {
+		var gqlErr *gqlerror.Error
+		if !errors.As(err, &gqlErr) {
+			gqlErr = toGQLError(err)
+		}
+		return gqlerror.List{gqlErr}
+	}
+	params.clientVariables = params.Variables
+	params.Variables = variables
+	params.operation = op
+	return nil
+}
@@ -0,0 +1,133 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+var testValidationSchema = gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Query { version: String }
+	type Subscription {
+		messages(room: ID!, limit: Int = 10, filter: Filter): String
+		typing(room: ID!): Boolean
+	}
+	input Filter { from: String! }
+`})
+
+func TestValidateOperationCoercesVariables(t *testing.T) {
+	params := startMessagePayload{
+		Query:     "subscription Messages($room: ID!, $limit: Int = 10) { messages(room: $room, limit: $limit) }",
+		Variables: map[string]interface{}{"room": "lobby"},
+	}
+	assert.Empty(t, validateOperation(testValidationSchema, &params, false))
+	assert.Equal(t, map[string]interface{}{"room": "lobby", "limit": int64(10)}, params.Variables)
+
+	params = startMessagePayload{
+		Query:     "subscription Messages($limit: Int) { messages(room: \"lobby\", limit: $limit) }",
+		Variables: map[string]interface{}{"limit": json.Number("3")},
+	}
+	assert.Empty(t, validateOperation(testValidationSchema, &params, false))
+	assert.Equal(t, int64(3), params.Variables["limit"])
+}
+
+func TestValidateOperationErrors(t *testing.T) {
+	errs := validateOperation(testValidationSchema, &startMessagePayload{Query: "subscription { unknown }"}, false)
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Message, "unknown")
+		assert.Equal(t, []gqlerror.Location{{Line: 1, Column: 16}}, errs[0].Locations)
+	}
+
+	errs = validateOperation(testValidationSchema, &startMessagePayload{
+		Query:     "subscription Messages($filter: Filter) { messages(room: \"lobby\", filter: $filter) }",
+		Variables: map[string]interface{}{"filter": map[string]interface{}{}},
+	}, false)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "variable.filter.from", errs[0].Path.String())
+	}
+
+	errs = validateOperation(testValidationSchema, &startMessagePayload{
+		Query:         "subscription A { messages(room: \"a\") } subscription B { messages(room: \"b\") }",
+		OperationName: "C",
+	}, false)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "operation C not found", errs[0].Message)
+	}
+}
+
+func TestValidateOperationRejectsInvalidDocuments(t *testing.T) {
+	for query, message := range map[string]string{
+		"subscription { ...Unknown }":                            `Unknown fragment "Unknown".`,
+		`subscription { messages(room: "a") typing(room: "a") }`: "must select only one top level field",
+	} {
+		errs := validateOperation(testValidationSchema, &startMessagePayload{Query: query}, false)
+		if assert.NotEmpty(t, errs, query) {
+			assert.Contains(t, errs[0].Message, message)
+			assert.NotEmpty(t, errs[0].Locations)
+		}
+	}
+}
+
+func TestValidateOperationSubscriptionsOnly(t *testing.T) {
+	params := startMessagePayload{Query: "query {\n  version\n}"}
+	assert.Empty(t, validateOperation(testValidationSchema, &params, false))
+
+	errs := validateOperation(testValidationSchema, &params, true)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "only subscriptions are allowed, got a query", errs[0].Message)
+		assert.Equal(t, []gqlerror.Location{{Line: 1, Column: 1}}, errs[0].Locations)
+	}
+}
+
+func TestSchemaRejectsInvalidVariables(t *testing.T) {
+	variables := make(chan map[string]interface{}, 1)
+	server := newTestServer(t, Websocket{Schema: testValidationSchema}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			variables <- variableValues
+			return make(chan interface{}), nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+
+	query := "subscription Messages($room: ID!, $limit: Int) { messages(room: $room, limit: $limit) }"
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{
+		"query":     query,
+		"variables": map[string]interface{}{"limit": 5},
+	}}))
+	assert.Contains(t, string(readMessageOfType(t, conn, "error")["payload"]), "must be defined")
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "payload": map[string]interface{}{
+		"query":     query,
+		"variables": map[string]interface{}{"room": "lobby", "limit": 5},
+	}}))
+	assert.Equal(t, map[string]interface{}{"room": "lobby", "limit": int64(5)}, <-variables)
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "3", "payload": map[string]interface{}{
+		"query": "subscription { messages(room: \"lobby\", unknown: 1) }",
+	}}))
+	var errs []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(readMessageOfType(t, conn, "error")["payload"], &errs))
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0]["message"], "Unknown argument")
+		assert.Equal(t, []interface{}{map[string]interface{}{"line": float64(1), "column": float64(16)}}, errs[0]["locations"])
+	}
+}
+
+func TestValidateOperationLiveQuery(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		directive @live on QUERY
+		type Query { version: String }
+	`})
+	params := startMessagePayload{Query: "query @live { version }"}
+	assert.Empty(t, validateOperation(schema, &params, false))
+	assert.NotEmpty(t, validateOperation(testValidationSchema, &params, false))
+	assert.NotEmpty(t, validateOperation(schema, &params, true))
+}
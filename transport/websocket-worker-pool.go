@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// defaultWorkerPoolSizePerProc is the number of goroutines of a WorkerPool per GOMAXPROCS, the
+// payloads are mostly waiting for their writes.
+const defaultWorkerPoolSizePerProc = 4
+
+// WorkerPoolStats reports the activity of a WorkerPool, e.g. to export metrics.
+type WorkerPoolStats struct {
+	// Workers is the number of goroutines running jobs.
+	Workers int
+	// Queued is the number of jobs waiting for a goroutine.
+	Queued int
+	// Subscribing is the number of service.Subscribe calls running.
+	Subscribing int
+}
+
+// WorkerPool bounds the service.Subscribe calls and delivers the payloads of the operations of all
+// the connections of the transports sharing it with a fixed number of goroutines, so that a storm
+// of connections is smoothed rather than spawning goroutines for all of them at once. The other
+// payloads wait in its queue.
+//
+// The service.Subscribe calls have their own bound, MaxSubscribes, so that the new operations don't
+// wait behind the payloads being delivered, they wait until the operation is completed otherwise.
+//
+// The goroutines are shared by all the connections, the slow writes of a connection hold them
+// longer: combine it with a SlowConsumer policy or a WriteScheduling, or MaxPumpsPerConnection to
+// bound the goroutines a single connection holds.
+type WorkerPool struct {
+	// Size is the maximum number of goroutines, it defaults to 4 times GOMAXPROCS.
+	Size int
+	// MaxSubscribes is the maximum number of service.Subscribe calls running at once, it defaults
+	// to Size.
+	MaxSubscribes int
+
+	once       sync.Once
+	workers    *workerPool
+	subscribes chan struct{}
+}
+
+func (p *WorkerPool) pool() *workerPool {
+	if p == nil {
+		return nil
+	}
+	p.once.Do(func() {
+		size := p.Size
+		if size <= 0 {
+			size = defaultWorkerPoolSizePerProc * runtime.GOMAXPROCS(0)
+		}
+		p.workers = &workerPool{limit: size}
+		subscribes := p.MaxSubscribes
+		if subscribes <= 0 {
+			subscribes = size
+		}
+		p.subscribes = make(chan struct{}, subscribes)
+	})
+	return p.workers
+}
+
+// Stats returns the current activity of the pool.
+func (p *WorkerPool) Stats() WorkerPoolStats {
+	w := p.pool()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WorkerPoolStats{Workers: w.workers, Queued: len(w.queue), Subscribing: len(p.subscribes)}
+}
+
+// subscribe runs f once fewer than MaxSubscribes calls are running, or returns the error of ctx if
+// it is done first.
+func (p *WorkerPool) subscribe(ctx context.Context, f func()) error {
+	p.pool()
+	select {
+	case p.subscribes <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.subscribes }()
+	f()
+	return nil
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolSubscribe(t *testing.T) {
+	pool := &WorkerPool{Size: 1, MaxSubscribes: 2}
+	var concurrent, maxConcurrent atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, pool.subscribe(context.Background(), func() {
+				n := concurrent.Add(1)
+				defer concurrent.Add(-1)
+				for {
+					max := maxConcurrent.Load()
+					if n <= max || maxConcurrent.CompareAndSwap(max, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+			}))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), maxConcurrent.Load())
+	assert.Panics(t, func() { _ = pool.subscribe(context.Background(), func() { panic("boom") }) })
+	assert.Equal(t, WorkerPoolStats{}, pool.Stats())
+
+	// the subscribes don't wait for the goroutines delivering the payloads
+	delivering := make(chan struct{})
+	pool.pool().submit(func() { <-delivering })
+	assert.NoError(t, pool.subscribe(context.Background(), func() {}))
+	close(delivering)
+
+	// but stop waiting for the other subscribes once their context is done
+	subscribing := make(chan struct{})
+	for range 2 {
+		go func() { _ = pool.subscribe(context.Background(), func() { <-subscribing }) }()
+	}
+	assert.Eventually(t, func() bool { return pool.Stats().Subscribing == 2 }, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	called := false
+	assert.ErrorIs(t, pool.subscribe(ctx, func() { called = true }), context.DeadlineExceeded)
+	assert.False(t, called)
+	close(subscribing)
+	assert.Eventually(t, func() bool { return pool.Stats() == WorkerPoolStats{} }, time.Second, time.Millisecond)
+}
+
+func TestWebsocketWorkerPool(t *testing.T) {
+	pool := &WorkerPool{Size: 2}
+	var subscribing, maxSubscribing atomic.Int32
+	server := newTestServer(t, Websocket{WorkerPool: pool}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			n := subscribing.Add(1)
+			defer subscribing.Add(-1)
+			for {
+				max := maxSubscribing.Load()
+				if n <= max || maxSubscribing.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			payloads := make(chan interface{}, 2)
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"n": 0}}
+			payloads <- map[string]interface{}{"data": map[string]interface{}{"n": 1}}
+			close(payloads)
+			return payloads, nil
+		},
+	})
+
+	var conns []*websocket.Conn
+	for range 5 {
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+		for i := range 4 {
+			assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": fmt.Sprint(i), "payload": map[string]interface{}{
+				"query": "subscription { n }",
+			}}))
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		for range 4 {
+			readMessageOfType(t, conn, "complete")
+		}
+	}
+
+	assert.LessOrEqual(t, maxSubscribing.Load(), int32(2))
+	assert.Eventually(t, func() bool { return pool.Stats() == WorkerPoolStats{} }, time.Second, time.Millisecond)
+}
@@ -6,36 +6,235 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/vektah/gqlparser/v2/ast"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 type (
 	Websocket struct {
-		Upgrader              websocket.Upgrader
-		InitFunc              WebsocketInitFunc
-		InitTimeout           time.Duration
+		Upgrader Upgrader
+		// UpgradeHeaderFunc adds headers to the upgrade responses, e.g. Set-Cookie. The negotiated
+		// subprotocol and extensions are reported by the ConnectionInfo.
+		UpgradeHeaderFunc WebsocketUpgradeHeaderFunc
+		// ReadLimit bounds the size in bytes of the messages read from the clients, the connections
+		// sending a larger message are closed with 1009 (message too big). It is disabled when zero.
+		ReadLimit   int64
+		InitFunc    WebsocketInitFunc
+		InitTimeout time.Duration
+		// SubscribeFunc is called before every operation is started, returning an error rejects the
+		// operation.
+		SubscribeFunc WebsocketSubscribeFunc
+		// AuthorizeOperation is called with the parsed operation before the SubscribeFunc, returning
+		// an error rejects the operation with the FORBIDDEN code, see ForbiddenError.
+		AuthorizeOperation    WebsocketAuthorizeOperationFunc
 		ErrorFunc             WebsocketErrorFunc
+		ResponseFunc          WebsocketResponseFunc
 		KeepAlivePingInterval time.Duration
 		PingPongInterval      time.Duration
+		RoundTripFunc         WebsocketRoundTripFunc
+
+		// PongWaitMultiplier defines how many ping intervals the server waits for any message from a
+		// graphql-transport-ws client, not only a pong, or a websocket ping before dropping the
+		// connection, it defaults to 2.
+		PongWaitMultiplier int
+		// MaxMissedPongs is the number of consecutive pings that may stay unanswered before the
+		// connection is dropped. Zero only relies on PongWaitMultiplier.
+		MaxMissedPongs int
+		// ClientKeepAliveTimeout drops the graphql-ws connections whose client sent neither a
+		// message, e.g. a keep alive, nor a websocket ping within the timeout, it is disabled when
+		// zero.
+		ClientKeepAliveTimeout time.Duration
+		LivenessFailureFunc    WebsocketLivenessFailureFunc
+
+		// FaultInjector disturbs outgoing messages for resilience testing, it is disabled when nil.
+		FaultInjector *FaultInjector
+
+		// Recorder receives the frames of the connections selected by RecordFunc, or of every
+		// connection if RecordFunc is nil.
+		Recorder   FrameRecorder
+		RecordFunc WebsocketRecordFunc
+
+		// FrameTap receives every frame of every connection, e.g. to mirror traffic to a debugging sink.
+		FrameTap WebsocketFrameTapFunc
+
+		// Registry tracks the initialised connections when set.
+		Registry *Registry
+
+		// OperationStateFunc is called with every transition of the operations, see
+		// OperationState, it is disabled when nil.
+		OperationStateFunc WebsocketOperationStateFunc
+
+		// Resumption lets clients resume their subscriptions after reconnecting, it is disabled when nil.
+		Resumption *Resumption
+
+		// WriteCoalescing groups the data messages written within a small window, it is disabled when nil.
+		WriteCoalescing *WriteCoalescing
+
+		// WriteScheduling writes the messages of the high priority operations first when the
+		// connection is congested, it is disabled when nil.
+		WriteScheduling *WriteScheduling
+
+		// SlowConsumer sheds the operations of the connections not keeping up with their
+		// messages, or closes them, it is disabled when nil.
+		SlowConsumer *SlowConsumer
+
+		// OrderedDelivery numbers the payloads of every operation and writes them in order, it is
+		// disabled when nil.
+		OrderedDelivery *OrderedDelivery
+
+		// Schema validates the operations and coerces their variables before they are started, the
+		// operations are passed through unchecked when nil.
+		Schema *ast.Schema
+		// SubscriptionsOnly rejects the queries and mutations validated against the Schema.
+		SubscriptionsOnly bool
+
+		// DeltaPayloads lets the clients receive the payloads of an operation as patches of its
+		// previous payload, by sending a "delta" extension set to DeltaJSONPatch or DeltaMergePatch.
+		// Resumable operations always receive whole payloads.
+		DeltaPayloads bool
+
+		// BinaryPayloads lets the clients receive the Binary values of the payloads of an operation
+		// as binary frames rather than base64, by sending a "binary" extension set to true.
+		// Resumable operations, and the connections sealing or signing their payloads, always
+		// receive them as base64.
+		BinaryPayloads bool
+
+		// MaxPumpsPerConnection bounds the goroutines delivering the payloads of the operations of
+		// every connection, shared by all of its operations rather than one per operation, it is
+		// disabled when zero.
+		MaxPumpsPerConnection int
+
+		// WorkerPool bounds the service.Subscribe calls and delivers the payloads of the operations
+		// of all the connections, it is disabled when nil.
+		WorkerPool *WorkerPool
+
+		// EventLoop serves the initialised connections without dedicating goroutines to them, it is
+		// disabled when nil.
+		EventLoop *EventLoop
+
+		// Tenancy counts and limits the connections and operations of every tenant separately, it
+		// is disabled when nil.
+		Tenancy *Tenancy
+
+		// Quota limits the payloads sent to every connection, or to every tenant, it is disabled
+		// when nil.
+		Quota *Quota
+
+		// LegacyPayloadEncoding sends the payloads of the data/next messages as base64 encoded JSON
+		// strings, as the previous versions did, for the clients depending on it.
+		LegacyPayloadEncoding bool
+
+		// PanicHandler is called with the panics recovered from the operations, they are sent to the
+		// clients as internal server errors.
+		PanicHandler WebsocketPanicFunc
+
+		// ErrorPresenter turns the errors of the operations into the errors sent to the clients,
+		// they are sent unchanged when nil.
+		ErrorPresenter ErrorPresenterFunc
+
+		// Audit records the activity of the connections, it is disabled when nil.
+		Audit *AuditLog
+
+		// DocumentSync multiplexes the sync of collaborative documents on the connections, it is
+		// disabled when nil.
+		DocumentSync *DocumentSync
+
+		// ResponseMasking nulls the fields of the payloads the viewers aren't allowed to read, it
+		// is disabled when nil.
+		ResponseMasking *ResponseMasking
+
+		// PayloadEncryption seals the payloads of the operations of the connections, it is disabled
+		// when nil.
+		PayloadEncryption *PayloadEncryption
+
+		// PayloadSigning signs the payloads of the operations, it is disabled when nil.
+		PayloadSigning *PayloadSigning
+
+		// DeadLetters receives the payloads which can't be delivered, because they can't be
+		// encoded or transformed or the connection fails to write them, it is disabled when nil.
+		DeadLetters *DeadLetters
+
+		// Logger receives the failures that can't be reported to the ErrorFunc, they are written
+		// with the log package when nil.
+		Logger *slog.Logger
+
+		// Fallback serves the requests that aren't websocket upgrades, e.g. the browsers opening the
+		// endpoint, see UpgradeRequired. They fail to be upgraded when nil.
+		Fallback http.Handler
+
+		// Maintenance rejects the new connections while it is enabled, it is disabled when nil, see
+		// SetAcceptingConnections.
+		Maintenance *Maintenance
+		// Admission queues the upgrade requests beyond the connections being established at once,
+		// it is disabled when nil.
+		Admission *Admission
+		// RetryAfter is advertised to the clients rejected while the Maintenance is enabled or the
+		// Admission queue is full, it defaults to 30 seconds.
+		RetryAfter time.Duration
+		// ReconnectJitter extends the retry-after of the connections closed by the server for a
+		// retryable reason, e.g. shutting down, reaching their lifetime or for maintenance, by a
+		// random delay up to it, so that their clients spread their reconnects, see
+		// CloseReason.Jittered. It is disabled when zero.
+		ReconnectJitter time.Duration
+
+		// Negotiation lets the clients tune the liveness of their connection through their init
+		// payload, it is disabled when nil.
+		Negotiation *Negotiation
+
+		// StrictProtocol follows graphql-transport-ws to the letter: the connections are closed
+		// with the 4400, 4401, 4408 and 4429 codes of the protocol instead of the generic ones, e.g.
+		// when initialised twice or starting an operation before being acknowledged, and they may
+		// ping before being initialised.
+		StrictProtocol bool
+
+		subprotocols map[string]func(conn SubprotocolConn) MessageExchanger
 
 		didInjectSubprotocols bool
 	}
 	wsConnection struct {
 		Websocket
 		ctx             context.Context
-		conn            *websocket.Conn
+		conn            socket
 		me              messageExchanger
 		active          map[string]context.CancelFunc
+		operations      map[string]*OperationInfo
+		resumable       map[string]*resumableOperation
+		deliveries      map[string]func(payload interface{}) bool
+		documents       map[string]*syncDocument
 		mu              sync.Mutex
 		keepAliveTicker *time.Ticker
 		pingPongTicker  *time.Ticker
+		lastPing        time.Time
+		pingSeq         uint64
+		missedPongs     int
+		livenessFailed  bool
 		service         GraphQLService
+		coalescer       *writeCoalescer
+		scheduler       *writeScheduler
+		slowConsumer    *slowConsumerMonitor
+		loop            *loopConn
+		tenant          *tenantState
+		quotaWindow     *quotaWindow
+		quotaDropped    atomic.Int64
+		auditEvents     atomic.Int64
+		nextBinaryRef   atomic.Uint32
+		observe         frameObserver
+		cipher          PayloadCipher
+		pumps           *pumpPool
+		closing         atomic.Bool
+		registered      *Connection
+		// operationLifetime bounds the operations when set, endLifetime releases the lifetime of
+		// the connection, both are negotiated
+		operationLifetime time.Duration
+		endLifetime       context.CancelFunc
 
 		initPayload InitPayload
 	}
@@ -43,15 +242,56 @@ type (
 	WebsocketInitFunc  func(ctx context.Context, initPayload InitPayload) (context.Context, error)
 	WebsocketErrorFunc func(ctx context.Context, err error)
 
+	// WebsocketSubscribeFunc is called with the operation a client starts, the returned context is
+	// passed to the GraphQLService.
+	WebsocketSubscribeFunc func(ctx context.Context, op *OperationInfo) (context.Context, error)
+
+	// WebsocketAuthorizeOperationFunc is called with the operation a client starts and its
+	// variables. The fields of the operation have their definition when the Websocket has a Schema,
+	// the fragment spreads have the definition of their fragment either way.
+	WebsocketAuthorizeOperationFunc func(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) error
+
+	// WebsocketResponseFunc is called with every payload right before it is written to the client as a
+	// data/next message. The returned payload replaces the original one, returning an error sends an error
+	// message for the operation instead.
+	WebsocketResponseFunc func(ctx context.Context, id string, payload json.RawMessage) (json.RawMessage, error)
+
+	// WebsocketRoundTripFunc is called with the measured round trip of every ping answered by a
+	// graphql-transport-ws client.
+	WebsocketRoundTripFunc func(ctx context.Context, rtt time.Duration)
+
+	// WebsocketLivenessFailureFunc is called when a graphql-transport-ws connection is dropped because
+	// the client stopped answering pings, or a graphql-ws connection because the client stopped
+	// sending keep alives, see ClientKeepAliveTimeout.
+	WebsocketLivenessFailureFunc func(ctx context.Context, missedPongs int)
+
+	// WebsocketUpgradeHeaderFunc returns the headers added to the response upgrading a request to a
+	// websocket connection.
+	WebsocketUpgradeHeaderFunc func(r *http.Request) http.Header
+
 	startMessagePayload struct {
 		OperationName string                 `json:"operationName"`
 		Query         string                 `json:"query"`
 		Variables     map[string]interface{} `json:"variables"`
+		Extensions    startMessageExtensions `json:"extensions"`
+		// operation is the operation of the query once validated against the Schema
+		operation *ast.OperationDefinition
+		// clientVariables are the variables sent by the client once Variables are coerced
+		clientVariables map[string]interface{}
+	}
+	startMessageExtensions struct {
+		Resumption *resumptionParams `json:"resumption"`
+		// all holds every extension sent by the client
+		all OperationExtensions
 	}
 )
 
 var errReadTimeout = errors.New("read timeout")
 
+// closeSubscriberAlreadyExists is sent when a client of graphql-transport-ws starts an operation
+// with an id that is already in use on the connection, graphql-ws replaces the operation instead.
+const closeSubscriberAlreadyExists = 4409
+
 var _ error = WebsocketError{}
 
 type WebsocketError struct {
@@ -68,46 +308,207 @@ func (e WebsocketError) Error() string {
 	return fmt.Sprintf("websocket write: %v", e.Err)
 }
 
+func (e WebsocketError) Unwrap() error {
+	return e.Err
+}
+
+// Supports returns true if the request is a websocket upgrade, see IsWebsocketRequest.
 func (t Websocket) Supports(r *http.Request) bool {
-	return r.Header.Get("Upgrade") != ""
+	return IsWebsocketRequest(r)
 }
 
+// Do serves a websocket connection. It answers 503 while the Maintenance is enabled, see
+// SetAcceptingConnections. The requests that aren't websocket upgrades are served by the Fallback,
+// if any.
 func (t Websocket) Do(w http.ResponseWriter, r *http.Request, service GraphQLService) {
+	if t.Fallback != nil && !IsWebsocketRequest(r) {
+		t.Fallback.ServeHTTP(w, r)
+		return
+	}
+	if reason, enabled := t.Maintenance.Reason(); enabled {
+		if reason == "" {
+			reason = defaultMaintenanceReason
+		}
+		t.sendRetryAfter(w, reason)
+		return
+	}
+	established := func() {}
+	if t.Admission != nil {
+		var admitted bool
+		if established, admitted = t.Admission.admit(r.Context()); !admitted {
+			t.sendRetryAfter(w, "too many connections being established")
+			return
+		}
+	}
+	t.serve(w, r, service, established)
+}
+
+// sendRetryAfter answers a rejected upgrade request with 503 and the jittered Retry-After.
+func (t Websocket) sendRetryAfter(w http.ResponseWriter, reason string) {
+	retryAfter := CloseReason{RetryAfter: t.retryAfter()}.Jittered(t.ReconnectJitter).RetryAfter
+	w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	SendErrorf(w, http.StatusServiceUnavailable, "%s", reason)
+}
+
+// serve upgrades a request and serves its connection, established is called once the connection
+// is initialised or failed to be.
+func (t Websocket) serve(w http.ResponseWriter, r *http.Request, service GraphQLService, established func()) {
+	defer established()
 	t.injectGraphQLWSSubprotocols()
-	ws, err := t.Upgrader.Upgrade(w, r, http.Header{})
+	id, err := newConnectionID()
 	if err != nil {
-		log.Printf("unable to upgrade %T to websocket %s: ", w, err.Error())
+		if t.Logger != nil {
+			t.Logger.Error("unable to identify the connection", "error", err)
+		} else {
+			log.Printf("unable to identify the connection: %s", err.Error())
+		}
+		SendErrorf(w, http.StatusInternalServerError, "unable to identify the connection")
+		return
+	}
+	header := http.Header{}
+	if t.UpgradeHeaderFunc != nil {
+		header = t.UpgradeHeaderFunc(r)
+	}
+	ws, err := upgrade(&t.Upgrader, w, r, header)
+	if err != nil {
+		if t.Logger != nil {
+			t.Logger.Warn("unable to upgrade to websocket", "writer", fmt.Sprintf("%T", w), "error", err)
+		} else {
+			log.Printf("unable to upgrade %T to websocket %s: ", w, err.Error())
+		}
 		SendErrorf(w, http.StatusBadRequest, "unable to upgrade")
 		return
 	}
+	ws.SetReadLimit(t.ReadLimit)
+
+	var fd int
+	polled := false
+	raw, isRaw := ws.(rawSocket)
+	newExchanger := t.subprotocols[ws.Subprotocol()]
+	if t.EventLoop != nil && newExchanger == nil && isRaw && raw.NetConn() != nil {
+		fd, polled = pollFD(raw.NetConn())
+	}
+
+	info := newConnectionInfo(r, id, ws.Subprotocol())
+	info.Extensions = ws.Extensions()
+	ctx := r.Context()
+	if polled {
+		// the request context ends with Do, which returns once the connection is handed to the loop
+		ctx = context.WithoutCancel(ctx)
+	}
+	ctx = withConnectionInfo(ctx, info)
+	ctx = withConnState(ctx, &ConnectionState{})
+	observe := t.newFrameObserver(ctx, r, info)
 
 	var me messageExchanger
-	switch ws.Subprotocol() {
+	switch subprotocol := ws.Subprotocol(); {
 	default:
-		msg := websocket.FormatCloseMessage(websocket.CloseProtocolError, fmt.Sprintf("unsupported negotiated subprotocol %s", ws.Subprotocol()))
-		_ = ws.WriteMessage(websocket.CloseMessage, msg)
+		_ = ws.WriteClose(closeProtocolError, fmt.Sprintf("unsupported negotiated subprotocol %s", subprotocol))
 		return
-	case graphqlwsSubprotocol, "":
+	case newExchanger != nil:
+		me = customExchanger{me: newExchanger(ws)}
+	case subprotocol == graphqlwsSubprotocol || subprotocol == "":
 		// clients are required to send a subprotocol, to be backward compatible with the previous implementation we select
 		// "graphql-ws" by default
-		me = graphqlwsMessageExchanger{c: ws}
-	case graphqltransportwsSubprotocol:
-		me = graphqltransportwsMessageExchanger{c: ws}
+		me = graphqlwsMessageExchanger{c: ws, observe: observe}
+	case subprotocol == graphqltransportwsSubprotocol:
+		me = graphqltransportwsMessageExchanger{c: ws, observe: observe}
+	}
+	if polled {
+		me = newNetpollExchanger(me, raw, t.ReadLimit, t.EventLoop)
 	}
 
 	conn := wsConnection{
-		active:    map[string]context.CancelFunc{},
-		conn:      ws,
-		ctx:       r.Context(),
-		service:   service,
-		me:        me,
-		Websocket: t,
+		active:     map[string]context.CancelFunc{},
+		operations: map[string]*OperationInfo{},
+		resumable:  map[string]*resumableOperation{},
+		deliveries: map[string]func(payload interface{}) bool{},
+		conn:       ws,
+		ctx:        ctx,
+		service:    service,
+		me:         me,
+		observe:    observe,
+		Websocket:  t,
+	}
+	// the pings of the client prove it is alive like its messages
+	ws.OnPing(conn.touchLiveness)
+	if polled {
+		me.(netpollExchanger).reader.onPing = conn.touchLiveness
+		conn.loop = t.EventLoop.newConn(&conn, fd)
 	}
 
 	if !conn.init() {
 		return
 	}
+	established()
+
+	if t.WriteCoalescing != nil {
+		conn.coalescer = newWriteCoalescer(&conn)
+	}
+	if t.WriteScheduling != nil {
+		conn.scheduler = newWriteScheduler(&conn)
+	}
+	if t.MaxPumpsPerConnection > 0 || t.WorkerPool != nil {
+		conn.pumps = newPumpPool(t.MaxPumpsPerConnection, t.WorkerPool.pool())
+	}
+
+	var unregister func()
+	if t.Registry != nil {
+		registered := t.Registry.register(&conn)
+		conn.registered = registered
+		unregister = func() { t.Registry.unregister(registered) }
+	}
+	if conn.tenant != nil {
+		unregisterConn := unregister
+		unregister = func() {
+			if unregisterConn != nil {
+				unregisterConn()
+			}
+			t.Tenancy.disconnect(conn.tenant)
+		}
+	}
+	if t.Quota != nil {
+		conn.quotaWindow = t.Quota.window(GetTenant(conn.ctx), info.ID)
+		unregisterConn := unregister
+		unregister = func() {
+			if unregisterConn != nil {
+				unregisterConn()
+			}
+			conn.reportQuotaUsage()
+			t.Quota.release(GetTenant(conn.ctx), conn.quotaWindow)
+		}
+	}
+	if t.SlowConsumer != nil {
+		stop := conn.monitorSlowConsumer()
+		unregisterConn := unregister
+		unregister = func() {
+			if unregisterConn != nil {
+				unregisterConn()
+			}
+			stop()
+		}
+	}
+	if t.Audit != nil {
+		disconnected := conn.auditConnected()
+		unregisterConn := unregister
+		unregister = func() {
+			if unregisterConn != nil {
+				unregisterConn()
+			}
+			disconnected()
+		}
+	}
+
+	if conn.loop != nil {
+		if !conn.loop.start(unregister) {
+			conn.closeWithReason(CloseReasonEventLoopClosed)
+		}
+		return
+	}
 
+	if unregister != nil {
+		defer unregister()
+	}
 	conn.run()
 }
 
@@ -141,19 +542,32 @@ func (c *wsConnection) nextMessageWithTimeout(timeout time.Duration) (message, e
 	}
 }
 
-func (c *wsConnection) init() bool {
-	var m message
-	var err error
+// nextInitMessage reads the next message before the deadline of the initialisation, if any.
+func (c *wsConnection) nextInitMessage(deadline time.Time) (message, error) {
+	if deadline.IsZero() {
+		return c.me.NextMessage()
+	}
+	return c.nextMessageWithTimeout(time.Until(deadline))
+}
 
+func (c *wsConnection) init() bool {
+	var deadline time.Time
 	if c.InitTimeout != 0 {
-		m, err = c.nextMessageWithTimeout(c.InitTimeout)
-	} else {
-		m, err = c.me.NextMessage()
+		deadline = time.Now().Add(c.InitTimeout)
+	}
+
+	m, err := c.nextInitMessage(deadline)
+	for err == nil && c.strict() && (m.t == pingMessageType || m.t == pongMessageType) {
+		// graphql-transport-ws lets the clients ping at any time
+		if m.t == pingMessageType {
+			c.write(&message{t: pongMessageType, payload: m.payload})
+		}
+		m, err = c.nextInitMessage(deadline)
 	}
 
 	if err != nil {
 		if err == errReadTimeout {
-			c.close(websocket.CloseProtocolError, "connection initialisation timeout")
+			c.closeWithProtocolReason(CloseReasonInitTimeout, CloseReasonInitialisationTimeout)
 			return false
 		}
 
@@ -161,7 +575,7 @@ func (c *wsConnection) init() bool {
 			c.sendConnectionError("invalid json")
 		}
 
-		c.close(websocket.CloseProtocolError, "decoding error")
+		c.closeWithProtocolReason(CloseReasonDecodingError, CloseReasonBadRequest)
 		return false
 	}
 
@@ -171,38 +585,99 @@ func (c *wsConnection) init() bool {
 			c.initPayload = make(InitPayload)
 			err := jsonDecode(m.payload, &c.initPayload)
 			if err != nil {
+				c.closeWithProtocolReason(CloseReasonDecodingError, CloseReasonBadRequest)
 				return false
 			}
+			// the payload is available to the InitFunc, the SubscribeFunc and the GraphQLService
+			c.ctx = withInitPayload(c.ctx, c.initPayload)
 		}
 
 		if c.InitFunc != nil {
 			ctx, err := c.InitFunc(c.ctx, c.initPayload)
 			if err != nil {
-				c.sendConnectionError(err.Error())
-				c.close(websocket.CloseNormalClosure, "terminated")
+				message := err.Error()
+				if c.ErrorPresenter != nil {
+					message = c.ErrorPresenter(c.ctx, err).Message
+				}
+				c.sendConnectionError("%s", message)
+				c.closeWithReason(CloseReasonTerminated)
 				return false
 			}
 			c.ctx = ctx
 		}
+		if c.Tenancy != nil && !c.initTenant() {
+			return false
+		}
+		if c.Negotiation != nil {
+			c.negotiate()
+		}
+		if c.PayloadEncryption != nil && !c.initCipher() {
+			return false
+		}
 
 		c.write(&message{t: connectionAckMessageType})
 		c.write(&message{t: keepAliveMessageType})
 	case connectionCloseMessageType:
-		c.close(websocket.CloseNormalClosure, "terminated")
+		c.closeWithReason(CloseReasonTerminated)
 		return false
 	default:
-		c.sendConnectionError("unexpected message %s", m.t)
-		c.close(websocket.CloseProtocolError, "unexpected message")
+		c.unexpectedMessage(m.t, false)
 		return false
 	}
 
 	return true
 }
 
+// initTenant resolves the tenant of the connection and counts the connection, it returns false
+// when the connection is rejected.
+func (c *wsConnection) initTenant() bool {
+	tenant, err := c.Tenancy.Resolver(c.ctx, c.initPayload)
+	if err != nil {
+		c.sendConnectionError("%s", err)
+		c.closeWithReason(CloseReasonTerminated)
+		return false
+	}
+	if c.tenant = c.Tenancy.connect(tenant); c.tenant == nil {
+		c.sendConnectionError("too many connections for the tenant")
+		c.closeWithReason(CloseReasonTenantConnections)
+		return false
+	}
+	c.ctx = withTenant(c.ctx, tenant)
+	return true
+}
+
 func (c *wsConnection) write(msg *message) {
+	if c.scheduler != nil && msg.id != "" {
+		c.scheduler.write(msg)
+		return
+	}
+	c.writeOut(msg)
+}
+
+// writeOut writes a message to the coalescer or to the connection, after its scheduling.
+func (c *wsConnection) writeOut(msg *message) {
+	if c.coalescer != nil {
+		c.coalescer.write(msg)
+		return
+	}
+	c.writeNow(msg)
+}
+
+func (c *wsConnection) writeNow(msg *message) {
+	// reported without the lock, the ErrorFunc may close the connection
+	c.handlePossibleError(c.sendNow(msg), false)
+}
+
+// sendNow writes a message to the connection and returns the error to report.
+func (c *wsConnection) sendNow(msg *message) error {
+	if c.FaultInjector != nil {
+		c.FaultInjector.delayWrite()
+	}
 	c.mu.Lock()
-	c.handlePossibleError(c.me.Send(msg), false)
-	c.mu.Unlock()
+	defer c.mu.Unlock()
+	err := c.send(msg)
+	c.deadLetterWriteLocked(err, msg)
+	return err
 }
 
 func (c *wsConnection) run() {
@@ -211,7 +686,7 @@ func (c *wsConnection) run() {
 	ctx, cancel := context.WithCancel(c.ctx)
 	defer func() {
 		cancel()
-		c.close(websocket.CloseAbnormalClosure, "unexpected closure")
+		c.closeWithReason(CloseReasonUnexpectedClosure)
 	}()
 
 	// If we're running in graphql-ws mode, create a timer that will trigger a
@@ -224,6 +699,12 @@ func (c *wsConnection) run() {
 		go c.keepAlive(ctx)
 	}
 
+	// If we're running in graphql-ws mode, drop the connection once the client stopped sending
+	// keep alives
+	if c.conn.Subprotocol() != graphqltransportwsSubprotocol && c.ClientKeepAliveTimeout != 0 {
+		_ = c.conn.SetReadDeadline(time.Now().UTC().Add(c.livenessWait()))
+	}
+
 	// If we're running in graphql-transport-ws mode, create a timer that will
 	// trigger a ping message every interval
 	if c.conn.Subprotocol() == graphqltransportwsSubprotocol && c.PingPongInterval != 0 {
@@ -233,7 +714,7 @@ func (c *wsConnection) run() {
 
 		// Note: when the connection is closed by this deadline, the client
 		// will receive an "invalid close code"
-		_ = c.conn.SetReadDeadline(time.Now().UTC().Add(2 * c.PingPongInterval))
+		_ = c.conn.SetReadDeadline(time.Now().UTC().Add(c.pongWait()))
 		go c.ping(ctx)
 	}
 
@@ -244,38 +725,64 @@ func (c *wsConnection) run() {
 	for {
 		m, err := c.me.NextMessage()
 		if err != nil {
-			// If the connection got closed by us, don't report the error
-			if !errors.Is(err, net.ErrClosed) {
-				c.handlePossibleError(err, true)
+			c.handleReadError(err)
+			c.closeOnInvalidMessage(err)
+			if c.livenessWait() != 0 && isTimeout(err) {
+				c.livenessFailure()
 			}
 			return
 		}
 
-		switch m.t {
-		case startMessageType:
-			c.subscribe(c.ctx, &m)
-		case stopMessageType:
-			c.mu.Lock()
-			closer := c.active[m.id]
-			c.mu.Unlock()
-			if closer != nil {
-				closer()
-			}
-		case connectionCloseMessageType:
-			c.close(websocket.CloseNormalClosure, "terminated")
-			return
-		case pingMessageType:
-			c.write(&message{t: pongMessageType, payload: m.payload})
-		case pongMessageType:
-			_ = c.conn.SetReadDeadline(time.Now().UTC().Add(2 * c.PingPongInterval))
-		default:
-			c.sendConnectionError("unexpected message %s", m.t)
-			c.close(websocket.CloseProtocolError, "unexpected message")
+		if !c.handleMessage(&m) {
 			return
 		}
 	}
 }
 
+func (c *wsConnection) handleReadError(err error) {
+	// If the connection got closed by us, don't report the error
+	if !errors.Is(err, net.ErrClosed) {
+		c.handlePossibleError(err, true)
+	}
+}
+
+// handleMessage handles a message read once the connection is initialised, it returns false when
+// the connection stops reading.
+func (c *wsConnection) handleMessage(m *message) bool {
+	// any message proves the client is alive, not only its pongs and keep alives
+	c.touchLiveness()
+	switch m.t {
+	case startMessageType:
+		c.subscribe(c.ctx, m)
+	case stopMessageType:
+		c.mu.Lock()
+		closer := c.active[m.id]
+		c.mu.Unlock()
+		if closer != nil {
+			closer()
+		}
+	case connectionCloseMessageType:
+		c.closeWithReason(CloseReasonTerminated)
+		return false
+	case pingMessageType:
+		c.write(&message{t: pongMessageType, payload: m.payload})
+	case pongMessageType:
+		c.handlePong(m)
+	case keepAliveMessageType:
+		c.handleClientKeepAlive()
+	case syncMessageType:
+		if c.DocumentSync == nil {
+			c.unexpectedMessage(m.t, true)
+			return false
+		}
+		c.handleSync(m)
+	default:
+		c.unexpectedMessage(m.t, true)
+		return false
+	}
+	return true
+}
+
 func (c *wsConnection) keepAlive(ctx context.Context) {
 	for {
 		select {
@@ -295,7 +802,7 @@ func (c *wsConnection) ping(ctx context.Context) {
 			c.pingPongTicker.Stop()
 			return
 		case <-c.pingPongTicker.C:
-			c.write(&message{t: pingMessageType, payload: json.RawMessage{}})
+			c.sendPing()
 		}
 	}
 }
@@ -303,81 +810,373 @@ func (c *wsConnection) ping(ctx context.Context) {
 func (c *wsConnection) closeOnCancel(ctx context.Context) {
 	<-ctx.Done()
 
-	if r := closeReasonForContext(ctx); r != "" {
-		c.sendConnectionError(r)
+	reason := CloseReasonTerminated
+	if r, ok := closeReasonForContext(ctx); ok {
+		c.sendConnectionError("%s", r.Reason)
+		reason = r
 	}
-	c.close(websocket.CloseNormalClosure, "terminated")
+	c.closeWithReason(reason)
 }
 
 func (c *wsConnection) subscribe(ctx context.Context, msg *message) {
+	c.mu.Lock()
+	_, exists := c.active[msg.id]
+	c.mu.Unlock()
+	if exists && c.conn.Subprotocol() == graphqltransportwsSubprotocol {
+		c.close(closeSubscriberAlreadyExists, fmt.Sprintf("Subscriber for %s already exists", msg.id))
+		return
+	}
+	if exists {
+		c.replaceOperation(msg.id)
+	}
+
+	payload, err := c.openPayload(msg.payload)
+	if err != nil {
+		c.sendError(msg.id, &gqlerror.Error{Message: err.Error()})
+		c.complete(msg.id)
+		return
+	}
 	var params startMessagePayload
-	if err := jsonDecode(msg.payload, &params); err != nil {
+	if err := jsonDecode(payload, &params); err != nil {
 		c.sendError(msg.id, &gqlerror.Error{Message: "invalid json"})
 		c.complete(msg.id)
 		return
 	}
+	endOperation := func() {}
+	if tenant := c.tenant; tenant != nil {
+		if !c.Tenancy.startOperation(tenant) {
+			c.sendError(msg.id, &gqlerror.Error{Message: "too many operations started by the tenant"})
+			c.complete(msg.id)
+			return
+		}
+		endOperation = func() { c.Tenancy.endOperation(tenant) }
+	}
+	started := false
+	defer func() {
+		if !started {
+			endOperation()
+		}
+	}()
+	if c.Schema != nil {
+		if errs := validateOperation(c.Schema, &params, c.SubscriptionsOnly); len(errs) != 0 {
+			c.sendError(msg.id, errs...)
+			c.complete(msg.id)
+			return
+		}
+	}
 
-	ctx, cancel := context.WithCancel(ctx)
-
-	payloads, err := c.service.Subscribe(ctx, params.Query, params.OperationName, params.Variables)
+	resume := c.resumableParams(&params)
+	if resume != nil {
+		// resumable operations outlive the connection for the resumption window
+		ctx = context.WithoutCancel(ctx)
+	}
+	if params.Extensions.all != nil {
+		ctx = withOperationExtensions(ctx, params.Extensions.all)
+	}
+	info := newOperationInfo(msg.id, &params)
+	if c.scheduler != nil {
+		info.Priority = c.WriteScheduling.priority(ctx, info)
+		c.scheduler.register(msg.id, info.Priority)
+	}
+	ctx = withOperationInfo(ctx, info)
+	c.mu.Lock()
+	c.operations[msg.id] = info
+	c.mu.Unlock()
+	c.transition(ctx, info, OperationPending)
+	var cancel context.CancelFunc
+	if c.operationLifetime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.operationLifetime)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	ctx, payloads, err := c.startService(ctx, &params)
 	if err != nil {
+		c.transition(ctx, info, OperationErrored)
+		c.mu.Lock()
+		delete(c.operations, msg.id)
+		c.mu.Unlock()
 		c.sendError(msg.id, toGQLError(err))
 		c.complete(msg.id)
+		if c.scheduler != nil {
+			c.scheduler.forget(msg.id)
+		}
 		cancel()
 		return
 	}
 
-	if c.initPayload != nil {
-		ctx = withInitPayload(ctx, c.initPayload)
+	var op *resumableOperation
+	if resume != nil {
+		op = c.startResumable(ctx, msg.id, resume)
+	}
+	var delta *deltaEncoder
+	if c.DeltaPayloads && op == nil {
+		delta = newDeltaEncoder(params.Extensions.all)
+	}
+	var mask *responseMask
+	if c.ResponseMasking != nil && params.operation != nil {
+		mask = c.ResponseMasking.mask(ctx, params.operation)
+	}
+
+	var stream *orderedStream
+	if c.OrderedDelivery != nil {
+		stream = &orderedStream{}
 	}
 
+	// the payloads sent with Connection.SendRaw are delivered like the payloads of the service,
+	// one at a time
+	var (
+		delivering sync.Mutex
+		events     int64
+	)
+	deliver := func(payload interface{}) bool {
+		delivering.Lock()
+		defer delivering.Unlock()
+		var seq int64
+		unlock := func() {}
+		if stream != nil {
+			seq, unlock = stream.next()
+		}
+		ok := c.handlePayload(ctx, msg.id, payload, op, delta, mask, seq, &events)
+		unlock()
+		return ok
+	}
+
+	c.transition(ctx, info, OperationActive)
 	c.mu.Lock()
-	c.active[msg.id] = cancel
+	// the connection closing meanwhile doesn't see the operation, it is ended here instead
+	closing := c.closing.Load()
+	if !closing {
+		c.active[msg.id] = cancel
+	}
+	if op != nil {
+		c.resumable[msg.id] = op
+	}
+	c.deliveries[msg.id] = deliver
 	c.mu.Unlock()
+	if closing {
+		c.endOnClose(cancel, op)
+	}
 
-	go func() {
-		ctx = withSubscriptionErrorContext(ctx)
+	started = true
+	ended := func(events int64) {}
+	if c.Audit != nil {
+		ended = c.auditOperation(ctx)
+	}
+	pump := &operationPump{ctx: ctx, payloads: payloads, deliver: deliver}
+	pump.finish = func(panicked interface{}) {
+		defer endOperation()
 		defer func() {
-			if errs := getSubscriptionError(ctx); len(errs) != 0 {
+			delivering.Lock()
+			defer delivering.Unlock()
+			ended(events)
+		}()
+		if panicked != nil {
+			AddSubscriptionError(ctx, toGQLError(c.recovered(ctx, panicked)))
+		}
+		if c.wasShed(msg.id) {
+			AddSubscriptionError(ctx, errSlowConsumer)
+		}
+		// an operation replaced by a start with the same id ends silently, the entries of the id
+		// belong to the new operation
+		replaced := func() bool {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.operations[msg.id] != info
+		}
+		errs := getSubscriptionError(ctx)
+		if len(errs) != 0 {
+			c.transition(ctx, info, OperationErrored)
+		} else {
+			c.transition(ctx, info, OperationCompleting)
+		}
+		if (op == nil || !op.detached.Load()) && !replaced() {
+			if len(errs) != 0 {
 				c.sendError(msg.id, errs...)
 			} else {
 				c.complete(msg.id)
 			}
-			c.mu.Lock()
-			delete(c.active, msg.id)
-			c.mu.Unlock()
-			cancel()
-			for range payloads { // drain input channel
-			}
-		}()
+		}
+		c.mu.Lock()
+		owned := c.operations[msg.id] == info
+		if owned {
+			c.forgetOperation(msg.id)
+		}
+		c.mu.Unlock()
+		if c.scheduler != nil && owned {
+			c.scheduler.forget(msg.id)
+		}
+		cancel()
+	}
+	if c.pumps != nil {
+		c.pumps.add(pump)
+	} else {
+		go pump.run()
+	}
+}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case payload, more := <-payloads:
-				if !more {
-					return
-				}
-				jsonPayload, err := json.Marshal(payload)
-				if err != nil {
-					c.sendError(msg.id, toGQLError(err))
-					continue
-				}
-				c.sendResponse(msg.id, jsonPayload)
-			}
+// replaceOperation ends the running operation of an id silently, for a start of graphql-ws
+// reusing it.
+func (c *wsConnection) replaceOperation(id string) {
+	c.mu.Lock()
+	cancel := c.active[id]
+	c.forgetOperation(id)
+	c.mu.Unlock()
+	if c.scheduler != nil {
+		c.scheduler.forget(id)
+	}
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// forgetOperation removes the entries of an operation, c.mu must be held.
+func (c *wsConnection) forgetOperation(id string) {
+	delete(c.active, id)
+	delete(c.operations, id)
+	delete(c.resumable, id)
+	delete(c.deliveries, id)
+	if c.slowConsumer != nil {
+		delete(c.slowConsumer.shed, id)
+	}
+}
+
+// handlePayload writes a payload of an operation, numbered seq when its delivery is ordered. It
+// returns false when the operation must end.
+func (c *wsConnection) handlePayload(ctx context.Context, id string, payload interface{}, op *resumableOperation, delta *deltaEncoder, mask *responseMask, seq int64, events *int64) bool {
+	binaryFrames := op == nil && c.wantsBinaryFrames(ctx)
+	if shared, ok := payload.(*SharedPayload); ok && c.ResponseFunc == nil && op == nil && delta == nil && c.Quota == nil && !c.LegacyPayloadEncoding && seq == 0 && !binaryFrames && c.cipher == nil && c.PayloadSigning == nil && mask == nil {
+		// nothing is specific to the connection, reuse the encoding of the payload
+		b, err := shared.bytes()
+		if err != nil {
+			c.deadLetter(ctx, DeadLetterEncoding, id, payload, nil, err)
+			c.failOperation(ctx, id, err)
+			return false
 		}
+		c.writeResponse(id, b, nil)
+		*events++
+		return true
+	}
 
-	}()
+	jsonPayload, err := marshalPayload(payload)
+	if err != nil {
+		c.deadLetter(ctx, DeadLetterEncoding, id, payload, nil, err)
+		c.failOperation(ctx, id, err)
+		return false
+	}
+	framed, err := frameIncremental(jsonPayload)
+	if err != nil {
+		c.deadLetter(ctx, DeadLetterTransform, id, payload, jsonPayload, err)
+		c.sendError(id, toGQLError(err))
+		return true
+	}
+	if mask != nil {
+		masked, err := mask.apply(framed, c.ResponseMasking.Strip)
+		if err != nil {
+			c.deadLetter(ctx, DeadLetterTransform, id, payload, framed, err)
+			c.sendError(id, toGQLError(err))
+			return true
+		}
+		framed = masked
+	}
+	jsonPayload, err = c.transformResponse(ctx, id, framed)
+	if err != nil {
+		c.deadLetter(ctx, DeadLetterTransform, id, payload, framed, err)
+		c.sendError(id, toGQLError(err))
+		return true
+	}
+	if op != nil {
+		var ok bool
+		if jsonPayload, ok = c.bufferResponse(ctx, op, jsonPayload); !ok {
+			return false
+		}
+		if op.detached.Load() {
+			return true
+		}
+	}
+	if c.Quota != nil {
+		var ok bool
+		if jsonPayload, ok = c.admitPayload(ctx, jsonPayload); !ok {
+			return true
+		}
+	}
+	if delta != nil {
+		encoded, err := delta.encode(jsonPayload)
+		if err != nil {
+			c.deadLetter(ctx, DeadLetterTransform, id, payload, jsonPayload, err)
+			c.sendError(id, toGQLError(err))
+			return true
+		}
+		jsonPayload = encoded
+	}
+	if seq != 0 {
+		jsonPayload = c.withSequence(jsonPayload, seq)
+	}
+	var frames [][]byte
+	if binaryFrames {
+		framed, binary, err := c.binaryFrames(jsonPayload)
+		if err != nil {
+			c.deadLetter(ctx, DeadLetterTransform, id, payload, jsonPayload, err)
+			c.sendError(id, toGQLError(err))
+			return true
+		}
+		jsonPayload, frames = framed, binary
+	}
+	if err := c.sendResponse(id, jsonPayload, frames); err != nil {
+		c.deadLetter(ctx, DeadLetterEncoding, id, payload, jsonPayload, err)
+		c.failOperation(ctx, id, err)
+		return false
+	}
+	*events++
+	return true
 }
 
-func (c *wsConnection) sendResponse(id string, response []byte) {
-	b, err := json.Marshal(response)
+// sendResponse writes a data/next message with an encoded payload, after the binary frames it
+// references.
+func (c *wsConnection) sendResponse(id string, response []byte, frames [][]byte) error {
+	if c.PayloadSigning != nil {
+		signed, err := c.PayloadSigning.signPayload(c.ctx, response)
+		if err != nil {
+			return err
+		}
+		response = signed
+	}
+	if c.cipher != nil {
+		sealed, err := c.sealPayload(response)
+		if err != nil {
+			return err
+		}
+		response = sealed
+	}
+	if !c.LegacyPayloadEncoding {
+		c.writeResponse(id, response, frames)
+		return nil
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	// the payload is sent as a base64 JSON string
+	b, err := encodeJSON(buf, response)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	c.writeResponse(id, b, frames)
+	return nil
+}
+
+// failOperation ends an operation whose payload can't be encoded, the error is reported to the
+// ErrorFunc and sent to the client once the operation is stopped.
+func (c *wsConnection) failOperation(ctx context.Context, id string, err error) {
+	c.handlePossibleError(fmt.Errorf("encoding payload of operation %s: %w", id, err), false)
+	AddSubscriptionError(ctx, toGQLError(err))
+}
+
+// writeResponse writes a data/next message whose payload is already encoded, after the binary
+// frames it references.
+func (c *wsConnection) writeResponse(id string, payload []byte, frames [][]byte) {
 	c.write(&message{
-		payload: b,
+		payload: payload,
+		frames:  frames,
 		id:      id,
 		t:       dataMessageType,
 	})
@@ -390,11 +1189,12 @@ func (c *wsConnection) complete(id string) {
 func (c *wsConnection) sendError(id string, errors ...*gqlerror.Error) {
 	errs := make([]error, len(errors))
 	for i, err := range errors {
-		errs[i] = err
+		errs[i] = c.presentError(err)
 	}
 	b, err := json.Marshal(errs)
 	if err != nil {
-		panic(err)
+		c.handlePossibleError(fmt.Errorf("encoding errors of operation %s: %w", id, err), false)
+		b = []byte(`[` + internalErrorJSON + `]`)
 	}
 	c.write(&message{t: errorMessageType, id: id, payload: b})
 }
@@ -402,18 +1202,75 @@ func (c *wsConnection) sendError(id string, errors ...*gqlerror.Error) {
 func (c *wsConnection) sendConnectionError(format string, args ...interface{}) {
 	b, err := json.Marshal(&gqlerror.Error{Message: fmt.Sprintf(format, args...)})
 	if err != nil {
-		panic(err)
+		c.handlePossibleError(fmt.Errorf("encoding connection error: %w", err), false)
+		b = []byte(internalErrorJSON)
 	}
 
 	c.write(&message{t: connectionErrorMessageType, payload: b})
 }
 
+func (c *wsConnection) closeWithReason(r CloseReason) {
+	if c.ReconnectJitter > 0 && r.Retryable() && r.Code != closeAbnormalClosure {
+		r = r.Jittered(c.ReconnectJitter)
+	}
+	c.close(r.Code, r.Text())
+}
+
+// close closes the connection and ends its operations, only the first call does so and the others
+// return right away.
 func (c *wsConnection) close(closeCode int, message string) {
+	if !c.closing.CompareAndSwap(false, true) {
+		return
+	}
+	// a write blocked on a client not reading holds the lock of the connection, the deadline
+	// fails it so that neither the close frame nor the operations wait for the client
+	_ = c.conn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	if c.scheduler != nil {
+		c.scheduler.close()
+	}
+	if c.coalescer != nil {
+		c.coalescer.flush()
+	}
+
+	// the close frame is written with the other messages, the operations are ended once the
+	// lock is released since they write their completion when they end
 	c.mu.Lock()
-	_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, message))
-	for _, closer := range c.active {
-		closer()
+	_ = c.conn.WriteClose(closeCode, message)
+	active := make(map[string]context.CancelFunc, len(c.active))
+	resumable := make(map[string]*resumableOperation, len(c.resumable))
+	for id, closer := range c.active {
+		active[id] = closer
+		if op := c.resumable[id]; op != nil {
+			resumable[id] = op
+		}
+	}
+	// the documents don't derive from the context of the connection on an EventLoop
+	documents := make(map[string]*syncDocument, len(c.documents))
+	for document, doc := range c.documents {
+		documents[document] = doc
 	}
 	c.mu.Unlock()
+	for id, closer := range active {
+		c.endOnClose(closer, resumable[id])
+	}
+	for document, doc := range documents {
+		c.leaveDocument(document, doc)
+	}
+	if c.loop != nil {
+		c.loop.teardown()
+	}
+	if c.endLifetime != nil {
+		c.endLifetime()
+	}
 	_ = c.conn.Close()
 }
+
+// endOnClose ends an operation of a closed connection, resumable operations are detached for the
+// resumption window instead.
+func (c *wsConnection) endOnClose(cancel context.CancelFunc, op *resumableOperation) {
+	if op != nil {
+		op.detach(c.Resumption.window(), cancel)
+		return
+	}
+	cancel()
+}
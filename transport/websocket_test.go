@@ -2,11 +2,14 @@ package transport
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -28,7 +31,7 @@ func (m *MockMessageExchanger) Send(msg *message) error {
 }
 
 func TestWebsocketUpgrade(t *testing.T) {
-	upgrader := websocket.Upgrader{
+	upgrader := Upgrader{
 		CheckOrigin: func(r *http.Request) bool { return true },
 	}
 	wsHandler := Websocket{
@@ -58,3 +61,165 @@ func TestWebsocketUpgrade(t *testing.T) {
 
 	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode, "Expected successful websocket upgrade")
 }
+
+type testGraphQLService struct {
+	subscribe func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error)
+}
+
+func (s testGraphQLService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	return s.subscribe(ctx, document, operationName, variableValues)
+}
+
+func newTestServer(t *testing.T, wsHandler Websocket, service GraphQLService) *httptest.Server {
+	t.Helper()
+	wsHandler.Upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsHandler.Do(w, r, service)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialTestServer(t *testing.T, server *httptest.Server, subprotocol string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{
+		Subprotocols: []string{subprotocol},
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dialing error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestWebsocketInitFuncReceivesConnectionInfo(t *testing.T) {
+	infos := make(chan *ConnectionInfo, 1)
+	server := newTestServer(t, Websocket{
+		InitFunc: func(ctx context.Context, payload InitPayload) (context.Context, error) {
+			infos <- GetConnectionInfo(ctx)
+			return ctx, nil
+		},
+	}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "connection_init"}))
+
+	var ack map[string]interface{}
+	assert.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, "connection_ack", ack["type"])
+
+	info := <-infos
+	if assert.NotNil(t, info) {
+		assert.Equal(t, graphqltransportwsSubprotocol, info.Subprotocol)
+		assert.NotEmpty(t, info.RemoteAddr)
+	}
+}
+
+func TestWebsocketPayloadEncoding(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		server := newTestServer(t, Websocket{LegacyPayloadEncoding: legacy}, testGraphQLService{
+			subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+				payloads := make(chan interface{}, 2)
+				payloads <- map[string]interface{}{"data": map[string]interface{}{"value": 1}}
+				payloads <- NewSharedPayload(map[string]interface{}{"data": map[string]interface{}{"value": 2}})
+				close(payloads)
+				return payloads, nil
+			},
+		})
+
+		conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+
+		for _, expected := range []string{`{"data":{"value":1}}`, `{"data":{"value":2}}`} {
+			payload := readMessageOfType(t, conn, "next")["payload"]
+			if legacy {
+				encoded, _ := json.Marshal([]byte(expected))
+				assert.Equal(t, string(encoded), string(payload))
+			} else {
+				assert.Equal(t, expected, string(payload))
+			}
+		}
+	}
+}
+
+func TestWebsocketDuplicateLongOperationID(t *testing.T) {
+	server := newTestServer(t, Websocket{}, testGraphQLService{
+		subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+			return make(chan interface{}), nil
+		},
+	})
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	id := strings.Repeat("é", 100)
+	for range 2 {
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "subscribe", "id": id, "payload": map[string]interface{}{"query": "subscription { value }"}}))
+	}
+
+	// the reason is truncated to fit in the close frame, without splitting a rune
+	closeErr := readCloseError(t, conn)
+	assert.Equal(t, closeSubscriberAlreadyExists, closeErr.Code)
+	assert.True(t, strings.HasPrefix(closeErr.Text, "Subscriber for éé"), closeErr.Text)
+	assert.LessOrEqual(t, len(closeErr.Text), maxCloseReason)
+	assert.True(t, utf8.ValidString(closeErr.Text))
+}
+
+func TestWebsocketDuplicateOperationID(t *testing.T) {
+	for _, subprotocol := range []string{graphqlwsSubprotocol, graphqltransportwsSubprotocol} {
+		ended := make(chan struct{}, 2)
+		var started atomic.Int32
+		server := newTestServer(t, Websocket{}, testGraphQLService{
+			subscribe: func(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+				payloads := make(chan interface{}, 1)
+				payloads <- map[string]interface{}{"data": map[string]interface{}{"value": started.Add(1)}}
+				go func() {
+					<-ctx.Done()
+					ended <- struct{}{}
+				}()
+				return payloads, nil
+			},
+		})
+
+		subscribe, data := "subscribe", "next"
+		if subprotocol == graphqlwsSubprotocol {
+			subscribe, data = "start", "data"
+		}
+		conn := dialTestServer(t, server, subprotocol)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+		readMessageOfType(t, conn, "connection_ack")
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": subscribe, "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+		readMessageOfType(t, conn, data)
+		assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": subscribe, "id": "1", "payload": map[string]interface{}{"query": "subscription { value }"}}))
+
+		if subprotocol == graphqltransportwsSubprotocol {
+			closeErr := readCloseError(t, conn)
+			assert.Equal(t, closeSubscriberAlreadyExists, closeErr.Code)
+			assert.Equal(t, "Subscriber for 1 already exists", closeErr.Text)
+		} else {
+			// the running operation is replaced without completing the id
+			var m map[string]json.RawMessage
+			assert.NoError(t, conn.ReadJSON(&m))
+			assert.Equal(t, `"`+data+`"`, string(m["type"]))
+			assert.JSONEq(t, `{"data":{"value":2}}`, string(m["payload"]))
+		}
+		select {
+		case <-ended:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the running operation to be ended with %s", subprotocol)
+		}
+	}
+}
+
+func TestWebsocketReadLimit(t *testing.T) {
+	server := newTestServer(t, Websocket{ReadLimit: 64}, nil)
+
+	conn := dialTestServer(t, server, graphqltransportwsSubprotocol)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "connection_init"}))
+	readMessageOfType(t, conn, "connection_ack")
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "ping", "payload": map[string]interface{}{"padding": strings.Repeat("x", 64)}}))
+	assert.Equal(t, closeMessageTooBig, readCloseError(t, conn).Code)
+}